@@ -2,12 +2,15 @@ package main
 
 import (
 	pb "PProject/gen/gateway"
+	sessionpb "PProject/gen/session"
 	"PProject/global/config"
 	"PProject/logger"
-	mid "PProject/middleware"
+	"PProject/module/chat/seq"
+	chatService "PProject/module/chat/service"
 	msg "PProject/module/message"
-	"PProject/module/user"
+	"PProject/module/node"
 	"PProject/service/chat"
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -31,7 +34,12 @@ func main() {
 	config.ConfigRedis()
 	config.ConfigMgo()
 	config.ConfigMiddleware()
-	config.ConfigKafka(msg.HandlerTopicMessage)
+	config.ConfigBus(msg.HandlerTopicMessage)
+
+	// 历史查询依赖的索引
+	if err := seq.EnsureIndexes(context.Background()); err != nil {
+		logger.Errorf("ensure indexes error: %v", err)
+	}
 
 	// 1) Prepare parameters
 	gwID := os.Getenv("GATEWAY_ID")
@@ -69,6 +77,8 @@ func main() {
 
 		// Register gateway gRPC service
 		pb.RegisterGatewayControlServer(gs, chat.NewMsgGatewayService(g, conn))
+		sessionpb.RegisterMessageServiceServer(gs, chatService.NewMessageServer())
+		sessionpb.RegisterArchiveServiceServer(gs, chatService.NewArchiveServer())
 
 		// Register health check service
 		healthServer := health.NewServer()
@@ -89,9 +99,7 @@ func main() {
 	r := gin.New()
 	r.Use(gin.Recovery())
 
-	mid.POST(r, "/login", user.HandlerLogin, mid.RouteOpt{IsAuth: false})
-	mid.POST(r, "/check", user.HandlerCheck, mid.RouteOpt{IsAuth: true})
-	mid.POST(r, "/user", user.HandleUserInfo, mid.RouteOpt{IsAuth: true})
+	node.RegisterApiRoutes(r)
 
 	logger.Infof("[HTTP] Listening on :%d", config.Global.Port)
 	if err := r.Run(fmt.Sprintf(":%d", config.Global.Port)); err != nil {
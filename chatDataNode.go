@@ -4,7 +4,7 @@ import (
 	pb "PProject/gen/gateway"
 	"PProject/global/config"
 	"PProject/logger"
-	"PProject/module/message/handler"
+	"PProject/module/node"
 	"PProject/service/chat"
 	"PProject/service/registry"
 	"context"
@@ -36,7 +36,21 @@ func main() {
 	config.ConfigRedis()
 	config.ConfigMgo()
 	config.ConfigMiddleware()
-	config.ConfigKafka(msg.HandlerTopicMessage)
+	config.ConfigPush()
+	config.ConfigBus(msg.HandlerTopicMessage)
+
+	// 阅后即焚/定时销毁调度
+	msg.StartDestructScheduler(ctx)
+
+	// 定时消息调度（多个数据节点选主，只有 leader 投递）
+	msg.StartScheduledMessageScheduler(ctx)
+
+	// outbox 补发：消息落库后没能发布到 Kafka 的下发帧/回执
+	msg.StartOutboxRelay(ctx)
+	msg.StartGroupFanoutResumer(ctx)
+
+	// 机器人 Webhook 投递（消息事件、组件交互），失败指数退避重试
+	msg.StartBotWebhookDispatcher(ctx)
 
 	err := registry.Global().StartWatch(ctx, "chat-service-GetSenderTopicKey")
 	if err != nil {
@@ -69,13 +83,7 @@ func main() {
 	}
 
 	chatCtx := &chat.ChatContext{S: g}
-	g.Disp().Register(handler.NewConnectHandler(chatCtx))
-	g.Disp().Register(handler.NewPingHandler(chatCtx))
-	g.Disp().Register(handler.NewAuthHandler(chatCtx))
-	g.Disp().Register(handler.NewAckHandler(chatCtx))
-	g.Disp().Register(handler.NewDataHandler(chatCtx))
-	g.Disp().Register(handler.NewCAckHandler(chatCtx))
-	g.Disp().Register(handler.NewRelayHandler(chatCtx))
+	node.RegisterGatewayHandlers(chatCtx)
 
 	err = g.Disp().Run(chatCtx)
 	if err != nil {
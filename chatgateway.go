@@ -2,13 +2,16 @@ package main
 
 import (
 	pb "PProject/gen/gateway"
+	sessionpb "PProject/gen/session"
 	"PProject/global/config"
 	"PProject/logger"
-	"PProject/module/message/handler"
+	chatService "PProject/module/chat/service"
+	"PProject/module/node"
 	"PProject/service/chat"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"time"
 
@@ -38,7 +41,7 @@ func main() {
 	config.ConfigRedis()
 	config.ConfigMgo()
 	config.ConfigMiddleware()
-	config.ConfigKafka(msg.HandlerTopicMessage)
+	config.ConfigBus(msg.HandlerTopicMessage)
 
 	// 延迟获取
 
@@ -63,13 +66,7 @@ func main() {
 	}
 
 	chatCtx := &chat.ChatContext{S: g}
-	g.Disp().Register(handler.NewConnectHandler(chatCtx))
-	g.Disp().Register(handler.NewPingHandler(chatCtx))
-	g.Disp().Register(handler.NewAuthHandler(chatCtx))
-	g.Disp().Register(handler.NewAckHandler(chatCtx))
-	g.Disp().Register(handler.NewDataHandler(chatCtx))
-	g.Disp().Register(handler.NewCAckHandler(chatCtx))
-	g.Disp().Register(handler.NewRelayHandler(chatCtx))
+	node.RegisterGatewayHandlers(chatCtx)
 
 	err = g.Disp().Run(chatCtx)
 	if err != nil {
@@ -87,6 +84,8 @@ func main() {
 
 		// Register gateway gRPC service
 		pb.RegisterGatewayControlServer(gs, chat.NewMsgGatewayService(g, conn))
+		// 在线状态/正在输入，供后端服务调用和订阅
+		sessionpb.RegisterPresenceServiceServer(gs, chatService.NewPresenceServer())
 
 		// Register health check service
 		healthServer := health.NewServer()
@@ -108,6 +107,8 @@ func main() {
 	r.Use(gin.Recovery())
 
 	r.GET("/chat", g.HandleWS)
+	// 至少一次下发的计数：重传次数、判死连接、ack 延迟
+	r.GET("/debug/qos", func(c *gin.Context) { c.JSON(http.StatusOK, g.Qos().Stats()) })
 
 	logger.Infof("[HTTP] Listening on :%d", config.Global.Port)
 	if err := r.Run(fmt.Sprintf(":%d", config.Global.Port)); err != nil {
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"PProject/global/config"
+	"PProject/logger"
+	"PProject/module/node"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 单进程开发模式：网关 + 数据节点 + API 节点，不需要 Kafka / Redis / Consul
+// 仍需要一个 MongoDB 副本集（消息落库用事务，单机 mongod 加 --replSet 即可），用 MONGO_URI、MONGO_DB 指定
+// go run ./cmd/allinone
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	app, err := node.StartAllInOne(ctx, 30*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Bus.Close()
+	defer app.Redis.Close()
+
+	logger.Infof("[HTTP] Listening on :%d (all in one)", config.Global.Port)
+	if err := app.Engine.Run(fmt.Sprintf(":%d", config.Global.Port)); err != nil {
+		logger.Errorf("HTTP server failed: %v", err)
+	}
+}
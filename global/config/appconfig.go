@@ -14,4 +14,21 @@ type AppConfig struct {
 	Port         int                                 // http 启动端口
 	GrpcPort     int
 	TopicHandler ka.MessageHandler // 消息处理handler
+	Push         PushConfig        // 离线推送通道
+}
+
+// PushConfig 离线推送通道配置，空字段由 PUSH_* 环境变量补齐
+// 凭证缺失时不会静默降级：只有 Fake=true 才使用内存 Fake 通道
+type PushConfig struct {
+	Fake bool // 显式使用内存 Fake 通道（本地开发/测试），PUSH_FAKE=1
+
+	APNsEndpoint string // 默认 https://api.push.apple.com，PUSH_APNS_ENDPOINT
+	APNsTopic    string // bundle id，PUSH_APNS_TOPIC
+	APNsKeyFile  string // .p8 私钥路径，PUSH_APNS_KEY_FILE
+	APNsKeyID    string // PUSH_APNS_KEY_ID
+	APNsTeamID   string // PUSH_APNS_TEAM_ID
+
+	FCMEndpoint           string // 默认 https://fcm.googleapis.com，PUSH_FCM_ENDPOINT
+	FCMProjectID          string // 为空时取服务账号里的 project_id，PUSH_FCM_PROJECT
+	FCMServiceAccountFile string // 服务账号 JSON 路径，PUSH_FCM_SERVICE_ACCOUNT
 }
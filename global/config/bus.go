@@ -0,0 +1,153 @@
+package config
+
+import (
+	"PProject/logger"
+	"PProject/service/bus"
+	"PProject/service/dispatcher/kafka"
+	"PProject/service/natsx"
+	"PProject/service/storage/redis"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// busIdemTTL 同一个消息 ID 的去重窗口，覆盖 outbox relay 的重发间隔
+	busIdemTTL = 24 * time.Hour
+	// busIdemProcessingTTL 处理中标记的有效期：覆盖一次处理的耗时，进程崩溃后过期让重投能再处理
+	busIdemProcessingTTL = 2 * time.Minute
+)
+
+var busMwsOnce sync.Once
+
+// configBusMiddlewares 注册总线全局中间件（Kafka / NATS / 内存总线都生效），必须在订阅前调用
+func configBusMiddlewares() {
+	busMwsOnce.Do(func() {
+		bus.Use(bus.WithMsgID(bus.FromNatsx(natsx.NatsxIdemMiddleware(redisIdem{}, busIdemProcessingTTL, busIdemTTL))))
+	})
+}
+
+// redisIdem 幂等标记放 Redis，多个节点共享同一个去重窗口；Redis 出错时放行（宁可重复不丢）
+// bus:idem:<id> 是完成标记，bus:idem:p:<id> 是处理中标记
+type redisIdem struct{}
+
+func redisIdemKey(id string) string { return "bus:idem:" + id }
+
+func redisIdemProcessingKey(id string) string { return "bus:idem:p:" + id }
+
+func (redisIdem) Begin(id string, processingTTL time.Duration) (bool, bool, error) {
+	ctx := context.Background()
+	n, err := redis.GetRedis().Exists(ctx, redisIdemKey(id)).Result()
+	if err != nil {
+		return false, false, err
+	}
+	if n > 0 {
+		return true, false, nil
+	}
+	ok, err := redis.GetRedis().SetNX(ctx, redisIdemProcessingKey(id), 1, processingTTL).Result()
+	if err != nil {
+		return false, false, err
+	}
+	return false, !ok, nil
+}
+
+func (redisIdem) Done(id string, ttl time.Duration) error {
+	ctx := context.Background()
+	if err := redis.GetRedis().Set(ctx, redisIdemKey(id), 1, ttl).Err(); err != nil {
+		return err
+	}
+	return redis.GetRedis().Del(ctx, redisIdemProcessingKey(id)).Err()
+}
+
+func (redisIdem) Abort(id string) {
+	_ = redis.GetRedis().Del(context.Background(), redisIdemProcessingKey(id)).Err()
+}
+
+// BusBackend 消息总线后端：环境变量 MSG_BUS=kafka|nats，默认 kafka
+func BusBackend() string {
+	switch strings.ToLower(os.Getenv("MSG_BUS")) {
+	case bus.BackendNats:
+		return bus.BackendNats
+	default:
+		return bus.BackendKafka
+	}
+}
+
+// ConfigBus 按配置启动消息总线；网关/数据节点/API 节点的代码与后端无关
+func ConfigBus(handler kafka.MessageHandler) {
+	logger.Infof("[Bus] backend=%s", BusBackend())
+	configBusMiddlewares()
+	if BusBackend() == bus.BackendNats {
+		ConfigNatsBus(handler)
+		return
+	}
+	ConfigKafka(handler)
+}
+
+// ConfigNatsBus 在后台 goroutine 中连接 NATS JetStream 并订阅本节点的 topic
+func ConfigNatsBus(handler kafka.MessageHandler) {
+	configTopics(handler)
+
+	servers := []string{"nats://127.0.0.1:4222"}
+	if v := os.Getenv("NATS_SERVERS"); v != "" {
+		servers = strings.Split(v, ",")
+	}
+
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// NATS 没有分区，NATS_ORDERED=1 时串行消费换取同一个 key 的顺序
+		ordered := os.Getenv("NATS_ORDERED") == "1"
+		if !ordered {
+			logger.Infof("[Bus] nats consumers are concurrent, per-key ordering is not guaranteed (set NATS_ORDERED=1)")
+		}
+		nb, err := bus.NewNatsBus(bus.NatsConfig{Servers: servers, Name: Global.NodeId, Ordered: ordered})
+		if err != nil {
+			logger.Errorf("[Bus][ERR] connect nats: %v", err)
+			return
+		}
+		bus.SetDefault(nb)
+
+		keys := kafka.Cfg.GetAllTopicKeys()
+		if err := registerTopicKeys(&ctx, keys); err != nil {
+			logger.Errorf("[Bus][ERR] register topic keys: %v", err)
+			return
+		}
+		if err := nb.Subscribe(ctx, Global.GroupId, keys, bus.FromMessageHandler(handler)); err != nil {
+			logger.Errorf("[Bus][ERR] subscribe: %v", err)
+			return
+		}
+
+		<-ctx.Done()
+		logger.Infof("[Bus] context done, shutting down")
+	}()
+}
+
+// ConfigMemoryBus 单进程模式：进程内总线；数据节点和网关各用自己的消费组订阅，topic 与分布式部署一致
+func ConfigMemoryBus(dataHandler, gatewayHandler kafka.MessageHandler) *bus.MemoryBus {
+	configTopics(gatewayHandler)
+	configBusMiddlewares()
+	mb := bus.NewMemoryBus(bus.MemoryConfig{})
+	bus.SetDefault(mb)
+
+	var dataKeys, gatewayKeys []string
+	for _, mc := range kafka.Cfg.MessageConfigs {
+		dataKeys = append(dataKeys, mc.SendTopicKeys()...)
+		gatewayKeys = append(gatewayKeys, mc.ReceiveTopicKeys(true)...)
+	}
+
+	ctx := context.Background()
+	if err := registerTopicKeys(&ctx, gatewayKeys); err != nil {
+		logger.Errorf("[Bus][ERR] register topic keys: %v", err)
+	}
+	if err := mb.Subscribe(ctx, MessageDataConfig.GroupId, dataKeys, bus.FromMessageHandler(dataHandler)); err != nil {
+		logger.Errorf("[Bus][ERR] subscribe data node: %v", err)
+	}
+	if err := mb.Subscribe(ctx, MessageGatewayConfig.GroupId, gatewayKeys, bus.FromMessageHandler(gatewayHandler)); err != nil {
+		logger.Errorf("[Bus][ERR] subscribe gateway: %v", err)
+	}
+	return mb
+}
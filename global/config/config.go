@@ -5,13 +5,22 @@ import (
 	pb "PProject/gen/message"
 	"PProject/logger"
 	mid "PProject/middleware"
+	"PProject/service/bus"
 	"PProject/service/dispatcher/kafka"
 	mgoSrv "PProject/service/mgo"
+	"PProject/service/push"
 	"PProject/service/registry"
 	redis "PProject/service/storage/redis"
 	ids "PProject/tools/ids"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
@@ -19,6 +28,7 @@ import (
 const NodeTypeMsgGateWay = "msgGateWay" // 网关节点
 const NodeTypeDataNode = "msgDataNode"  // 数据节点
 const NodeTypeApiNode = "apiNode"
+const NodeTypeAllInOne = "allInOne" // 单进程开发模式：网关 + 数据节点 + API 节点
 
 var Global = AppConfig{
 	NodeType: NodeTypeMsgGateWay,  // 是否是消息网关
@@ -66,6 +76,17 @@ func ConfigRedis() {
 	}
 }
 
+// ConfigMemoryRedis 单进程模式：用进程内的内存 Redis，不需要外部 Redis
+func ConfigMemoryRedis() *redis.MemoryServer {
+	srv, err := redis.InitMemoryRedis()
+	if err != nil {
+		logger.Errorf("[Redis][ERR] start memory redis: %v", err)
+		return nil
+	}
+	logger.Infof("[Redis] memory redis listening on %s", srv.Addr())
+	return srv
+}
+
 func ConfigMgo() {
 
 	go func() {
@@ -80,6 +101,13 @@ func ConfigMgo() {
 			Password:    "example",
 			MaxRetry:    3, // 这里不用了，StartAsync 里我们自己做了指数退避
 		}
+		// MONGO_URI 覆盖默认地址，账号密码写在 URI 里
+		if uri := os.Getenv("MONGO_URI"); uri != "" {
+			cfg.Uri, cfg.Username, cfg.Password = uri, "", ""
+		}
+		if db := os.Getenv("MONGO_DB"); db != "" {
+			cfg.Database = db
+		}
 
 		// 1) 异步启动
 		mgoSrv.StartAsync(ctx, cfg)
@@ -94,8 +122,8 @@ func ConfigMgo() {
 
 }
 
-// ConfigKafka 在后台 goroutine 中启动 Kafka Client / Producer / Consumer
-func ConfigKafka(handler kafka.MessageHandler) {
+// configTopics 按节点类型生成 topic 配置（两种总线后端共用同一套 topic 命名）
+func configTopics(handler kafka.MessageHandler) {
 
 	isSenderConsumer := false
 	nodeId := MessageGatewayConfig.NodeId
@@ -129,6 +157,25 @@ func ConfigKafka(handler kafka.MessageHandler) {
 
 	kafka.Cfg.GroupID = Global.GroupId
 	kafka.Cfg.MessageConfigs = []kafka.MessageHandlerConfig{dataCfg, cackCfg}
+	// 回执对时效敏感：重试阶梯短一些，尽快进死信
+	kafka.Cfg.TopicRetry = map[string]kafka.RetryPolicy{
+		cackCfg.SendTopicPattern:    {Delays: []time.Duration{time.Second, 5 * time.Second}},
+		cackCfg.ReceiveTopicPattern: {Delays: []time.Duration{time.Second, 5 * time.Second}},
+	}
+}
+
+// registerTopicKeys 把本节点消费的 topic 注册到服务发现，供其它节点选择投递目标
+func registerTopicKeys(ctx *context.Context, keys []string) error {
+	return registry.Global().RegisterMethod(ctx, "GetSenderTopicKey", map[string]string{
+		"keys": strings.Join(keys, ","),
+	})
+}
+
+// ConfigKafka 在后台 goroutine 中启动 Kafka Client / Producer / Consumer
+func ConfigKafka(handler kafka.MessageHandler) {
+	configTopics(handler)
+	kb := bus.NewKafkaBus(&kafka.Cfg)
+	bus.SetDefault(kb)
 
 	go func() {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -161,11 +208,14 @@ func ConfigKafka(handler kafka.MessageHandler) {
 		}
 
 		keys := kafka.Cfg.GetAllTopicKeys()
+		// 重试 topic 由同一个消费组消费，延迟到点后交回原 topic 的 handler
+		keys = append(keys, kafka.Cfg.RetryTopicsFor(keys)...)
+
+		// 处理函数经由总线注册，总线的全局中间件对 Kafka 同样生效
+		kb.Bind(kafka.Cfg.GetAllTopicKeys(), bus.FromMessageHandler(handler))
 
 		receiveKeys := kafka.Cfg.GetAllTopicKeys()
-		err := registry.Global().RegisterMethod(&ctx, "GetSenderTopicKey", map[string]string{
-			"keys": strings.Join(receiveKeys, ","),
-		})
+		err := registerTopicKeys(&ctx, receiveKeys)
 		if err != nil {
 			return
 		}
@@ -187,6 +237,90 @@ func ConfigKafka(handler kafka.MessageHandler) {
 	}()
 }
 
+// ConfigPush 配置离线推送通道：APNs 用 .p8 私钥在进程内签发 JWT，FCM 用服务账号在进程内刷新 access token
+// 凭证配置错误直接退出；未配置且没有显式开启 Fake 时该平台不挂通道，推送会逐条报错
+func ConfigPush() {
+	cfg := Global.Push.withEnv()
+	m := push.NewManager()
+
+	if cfg.Fake {
+		logger.Warn("[push] fake providers enabled, offline pushes are NOT delivered")
+		m.Register(push.PlatformIOS, push.NewFakeProvider("fake-apns"))
+		m.Register(push.PlatformAndroid, push.NewFakeProvider("fake-fcm"))
+		push.Init(m)
+		m.Start(8)
+		return
+	}
+
+	if cfg.APNsTopic != "" || cfg.APNsKeyFile != "" {
+		key, err := os.ReadFile(cfg.APNsKeyFile)
+		if err != nil {
+			log.Fatalf("[push] read apns key %q: %v", cfg.APNsKeyFile, err)
+		}
+		token, err := push.NewAPNsTokenSource(key, cfg.APNsKeyID, cfg.APNsTeamID)
+		if err != nil {
+			log.Fatalf("[push] apns: %v", err)
+		}
+		if cfg.APNsTopic == "" {
+			log.Fatalf("[push] apns topic (bundle id) required")
+		}
+		m.Register(push.PlatformIOS, push.NewAPNsProvider(cfg.APNsEndpoint, cfg.APNsTopic, token))
+	} else {
+		logger.Errorf("[push] APNs not configured (PUSH_APNS_*), iOS offline pushes will fail; set PUSH_FAKE=1 for local development")
+	}
+
+	if cfg.FCMServiceAccountFile != "" {
+		raw, err := os.ReadFile(cfg.FCMServiceAccountFile)
+		if err != nil {
+			log.Fatalf("[push] read fcm service account %q: %v", cfg.FCMServiceAccountFile, err)
+		}
+		src, err := push.NewFCMTokenSource(raw, nil)
+		if err != nil {
+			log.Fatalf("[push] fcm: %v", err)
+		}
+		project := cfg.FCMProjectID
+		if project == "" {
+			project = src.ProjectID
+		}
+		if project == "" {
+			log.Fatalf("[push] fcm project id required")
+		}
+		m.Register(push.PlatformAndroid, push.NewFCMProvider(cfg.FCMEndpoint, project, src.Token))
+	} else {
+		logger.Errorf("[push] FCM not configured (PUSH_FCM_*), Android offline pushes will fail; set PUSH_FAKE=1 for local development")
+	}
+
+	push.Init(m)
+	m.Start(8)
+}
+
+// withEnv 用 PUSH_* 环境变量补齐未配置的字段，并填默认 endpoint
+func (c PushConfig) withEnv() PushConfig {
+	env := func(dst *string, name string) {
+		if *dst == "" {
+			*dst = os.Getenv(name)
+		}
+	}
+	if os.Getenv("PUSH_FAKE") == "1" {
+		c.Fake = true
+	}
+	env(&c.APNsEndpoint, "PUSH_APNS_ENDPOINT")
+	env(&c.APNsTopic, "PUSH_APNS_TOPIC")
+	env(&c.APNsKeyFile, "PUSH_APNS_KEY_FILE")
+	env(&c.APNsKeyID, "PUSH_APNS_KEY_ID")
+	env(&c.APNsTeamID, "PUSH_APNS_TEAM_ID")
+	env(&c.FCMEndpoint, "PUSH_FCM_ENDPOINT")
+	env(&c.FCMProjectID, "PUSH_FCM_PROJECT")
+	env(&c.FCMServiceAccountFile, "PUSH_FCM_SERVICE_ACCOUNT")
+	if c.APNsEndpoint == "" {
+		c.APNsEndpoint = "https://api.push.apple.com"
+	}
+	if c.FCMEndpoint == "" {
+		c.FCMEndpoint = "https://fcm.googleapis.com"
+	}
+	return c
+}
+
 func ConfigMiddleware() {
 	mid.Config()
 }
@@ -199,3 +333,20 @@ func ConfigRegistry(name, nodeId string) {
 func GetTenantID() string {
 	return "tenant_001"
 }
+
+var (
+	instanceOnce sync.Once
+	instanceID   string
+)
+
+// InstanceID 本进程的唯一标识（NodeId-主机名-pid-随机串），选主/领取任务用
+// NodeId 是静态配置，同一份配置起多个副本时会重复，不能拿来区分进程
+func InstanceID() string {
+	instanceOnce.Do(func() {
+		host, _ := os.Hostname()
+		b := make([]byte, 4)
+		_, _ = rand.Read(b)
+		instanceID = fmt.Sprintf("%s-%s-%d-%s", Global.NodeId, host, os.Getpid(), hex.EncodeToString(b))
+	})
+	return instanceID
+}
@@ -65,3 +65,22 @@ var MessageApiNodeConfig = AppConfig{
 	Port:     9090,
 	GrpcPort: 50053,
 }
+
+// MessageAllInOneConfig 单进程开发模式：网关、数据节点、API 节点跑在同一个进程里
+// NodeId 与 MessageGatewayConfig 一致，topic 命名和分布式部署完全相同
+var MessageAllInOneConfig = AppConfig{
+	NodeType: NodeTypeAllInOne,
+	GroupId:  "message_all_in_one",
+	NodeId:   "gateway_01",
+	ReceiveTopic: map[pb.MessageFrameData_Type]string{
+		pb.MessageFrameData_DATA: "message_receive_data",
+		pb.MessageFrameData_CACK: "message_receive_ack",
+	}, // 接收消息的topic
+	SendMsgTopic: map[pb.MessageFrameData_Type]string{
+		pb.MessageFrameData_DATA: "message_sender_data",
+		pb.MessageFrameData_CACK: "message_sender_ack",
+	},
+	Port:     8080,
+	GrpcPort: 50051,
+	Push:     PushConfig{Fake: true}, // 单进程开发模式不连真实推送
+}
@@ -57,3 +57,19 @@ func RunService(srvName, serviceID string, port int, meta map[string]string) {
 	}()
 
 }
+
+// RunMemoryService 单进程模式：进程内注册中心，同步完成初始化（之后马上就能 RegisterMethod）
+func RunMemoryService(srvName, serviceID string, port int, meta map[string]string) {
+	registry.InitDefault(registry.NewMemory(), 20*time.Second)
+	registry.Global().SetSelf(
+		registry.Instance{
+			Service:  srvName,
+			ID:       serviceID,
+			Address:  "127.0.0.1",
+			Port:     port,
+			Metadata: meta,
+		},
+		registry.RegisterOptions{},
+		srvName,
+	)
+}
@@ -4,9 +4,11 @@ import (
 	"PProject/global/config"
 	errors "PProject/tools/errs"
 	jwtlib "PProject/tools/security"
+	"context"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
 )
 
 // UserSession 全局的接口请求 需要处理的session
@@ -27,6 +29,25 @@ func GetAuthInfo(c *gin.Context) (*AuthInfo, error) {
 	authHeader := c.GetHeader("authorization")
 	authHash := c.GetHeader("authorizationHash")
 
+	return verifyAuth(authHeader, authHash)
+}
+
+// GetAuthInfoFromContext 从 gRPC metadata 中获取用户授权信息（authorization / authorizationHash）
+func GetAuthInfoFromContext(ctx context.Context) (*AuthInfo, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, errors.New("metadata is empty")
+	}
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	return verifyAuth(first("authorization"), first("authorizationhash"))
+}
+
+func verifyAuth(authHeader, authHash string) (*AuthInfo, error) {
 	token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
 
 	if token == "" || authHash == "" {
@@ -0,0 +1,211 @@
+package chat
+
+import (
+	"PProject/global"
+	"PProject/global/config"
+	"PProject/logger"
+	chatService "PProject/module/chat/service"
+	botModel "PProject/module/chatBox/model"
+	"PProject/tools/errs"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getBotAuth 机器人 API 鉴权：Authorization: Bot <token>
+func getBotAuth(c *gin.Context) (*botModel.AgentBot, error) {
+	token, ok := strings.CutPrefix(c.GetHeader("authorization"), "Bot ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return nil, errs.ErrTokenInvalid.WrapMsg("bot token is empty")
+	}
+	return chatService.AuthenticateBot(c.Request.Context(), config.GetTenantID(), strings.TrimSpace(token))
+}
+
+type BotParams struct {
+	BotUserID    string `json:"bot_user_id"`   // 修改/重置时必填
+	RotateSecret bool   `json:"rotate_secret"` // 重置 token 时一并更换 Webhook 签名密钥
+	chatService.BotInput
+}
+
+// HandlerCreateBot 创建机器人，返回一次性的 API token 和 Webhook 签名密钥
+func HandlerCreateBot(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in BotParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	creds, err := chatService.CreateBot(c.Request.Context(), config.GetTenantID(), authInfo.UserId, &in.BotInput)
+	if err != nil {
+		logger.Errorf("create bot user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(creds))
+}
+
+// HandlerUpdateBot 修改机器人资料/Webhook/状态/申请特权意图（仅创建者，特权意图需应用管理员审批）
+func HandlerUpdateBot(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in BotParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	bot, err := chatService.UpdateBot(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.BotUserID, &in.BotInput)
+	if err != nil {
+		logger.Errorf("update bot user=%s bot=%s err=%v", authInfo.UserId, in.BotUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(bot))
+}
+
+// HandlerResetBotToken 重置机器人 API token（仅创建者），旧 token 立即失效
+func HandlerResetBotToken(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in BotParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	creds, err := chatService.ResetBotToken(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.BotUserID, in.RotateSecret)
+	if err != nil {
+		logger.Errorf("reset bot token user=%s bot=%s err=%v", authInfo.UserId, in.BotUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(creds))
+}
+
+// HandlerListBots 我创建的机器人
+func HandlerListBots(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	bots, err := chatService.ListMyBots(c.Request.Context(), config.GetTenantID(), authInfo.UserId)
+	if err != nil {
+		logger.Errorf("list bots user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"bots": bots}))
+}
+
+type BotMessageParams struct {
+	Message json.RawMessage `json:"message"` // MessageData（protojson）
+}
+
+// HandlerBotSendMessage 机器人发消息（Authorization: Bot <token>）
+func HandlerBotSendMessage(c *gin.Context) {
+	bot, err := getBotAuth(c)
+	if err != nil {
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	var in BotMessageParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	md, err := parseMessageData(in.Message)
+	if err != nil || md == nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	clientMsgID, err := chatService.BotSendMessage(c.Request.Context(), config.GetTenantID(), bot, md)
+	if err != nil {
+		logger.Errorf("bot send message bot=%s err=%v", bot.UserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"client_msg_id": clientMsgID}))
+}
+
+// HandlerCreateInteraction 用户点击机器人消息上的组件（按钮/下拉/输入），交互推给机器人的 Webhook
+func HandlerCreateInteraction(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in chatService.InteractionInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.CreateInteraction(c.Request.Context(), config.GetTenantID(), authInfo.UserId, &in)
+	if err != nil {
+		logger.Errorf("create interaction user=%s msg=%s custom_id=%s err=%v", authInfo.UserId, in.ServerMsgID, in.CustomID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type InteractionRespondParams struct {
+	chatService.InteractionResponse
+	Message json.RawMessage `json:"message"` // MessageData（protojson）
+}
+
+// HandlerRespondInteraction 机器人回应交互（Authorization: Bot <token>）：update_message 更新原消息，ephemeral 仅点击者可见
+func HandlerRespondInteraction(c *gin.Context) {
+	bot, err := getBotAuth(c)
+	if err != nil {
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	var in InteractionRespondParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	md, err := parseMessageData(in.Message)
+	if err != nil || md == nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	in.InteractionResponse.Message = md
+
+	if err := chatService.RespondInteraction(c.Request.Context(), config.GetTenantID(), bot, &in.InteractionResponse); err != nil {
+		logger.Errorf("respond interaction bot=%s interaction=%s err=%v", bot.UserID, in.InteractionID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
@@ -0,0 +1,1751 @@
+package chat
+
+import (
+	messagepb "PProject/gen/message"
+	sessionpb "PProject/gen/session"
+	"PProject/global"
+	"PProject/global/config"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	chatService "PProject/module/chat/service"
+	"PProject/tools/errs"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var pbUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// HandlerListHistory 历史消息分页（入参/出参与 ListHistoryReq/ListHistoryResp 一致）
+func HandlerListHistory(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	req := &sessionpb.ListHistoryReq{}
+	if len(body) > 0 {
+		if err := pbUnmarshal.Unmarshal(body, req); err != nil {
+			c.JSON(http.StatusOK, errs.ErrArgs)
+			return
+		}
+	}
+
+	resp, err := chatService.ListHistory(c.Request.Context(), config.GetTenantID(), authInfo.UserId, req)
+	if err != nil {
+		logger.Errorf("list history user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(resp))
+}
+
+// HandlerSearchMessages 消息检索（入参与 SearchReq 一致），返回消息 + 高亮摘要
+func HandlerSearchMessages(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	req := &sessionpb.SearchReq{}
+	if len(body) > 0 {
+		if err := pbUnmarshal.Unmarshal(body, req); err != nil {
+			c.JSON(http.StatusOK, errs.ErrArgs)
+			return
+		}
+	}
+
+	res, err := chatService.Search(c.Request.Context(), config.GetTenantID(), authInfo.UserId, req)
+	if err != nil {
+		logger.Errorf("search messages user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(res))
+}
+
+// toCodeError 业务错误原样返回，其它错误统一按服务端内部错误返回
+func toCodeError(err error) *errs.CodeError {
+	var codeErr *errs.CodeError
+	if errors.As(err, &codeErr) {
+		return codeErr
+	}
+	return &errs.ErrInternalServer
+}
+
+type MentionParams struct {
+	ConversationID string `json:"conversation_id"` // 为空表示全部会话
+	Limit          int64  `json:"limit"`
+}
+
+// HandlerListMentions 未读 @ 列表（跨会话）
+func HandlerListMentions(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in MentionParams
+	if err := c.ShouldBindJSON(&in); err != nil && err != io.EOF {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	items, err := chatService.ListUnreadMentions(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.ConversationID, in.Limit)
+	if err != nil {
+		logger.Errorf("list mentions user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+type MarkReadParams struct {
+	ConversationID string `json:"conversation_id"`
+	ReadSeq        int64  `json:"read_seq"` // <=0 表示读到最新
+}
+
+// HandlerMarkRead 标记已读，已读范围内的 @ 同时清理
+func HandlerMarkRead(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in MarkReadParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.ConversationID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	err = chatService.MarkRead(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.ConversationID, in.ReadSeq)
+	if err != nil {
+		logger.Errorf("mark read user=%s conv=%s err=%v", authInfo.UserId, in.ConversationID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type ScheduleMessageParams struct {
+	ScheduleID string          `json:"schedule_id"` // 修改时必填
+	SendAtMS   int64           `json:"send_at_ms"`  // 计划发送时间（ms）；修改时 <=0 表示不改
+	Message    json.RawMessage `json:"message"`     // MessageData（protojson）；修改时为空表示不改
+}
+
+// parseMessageData 按 protojson 解析 MessageData（定时消息、机器人发消息/回应交互），为空返回 nil
+func parseMessageData(raw json.RawMessage) (*messagepb.MessageData, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	md := &messagepb.MessageData{}
+	if err := pbUnmarshal.Unmarshal(raw, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// HandlerScheduleMessage 新建定时消息
+func HandlerScheduleMessage(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ScheduleMessageParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	md, err := parseMessageData(in.Message)
+	if err != nil || md == nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.CreateScheduledMessage(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.SendAtMS, md)
+	if err != nil {
+		logger.Errorf("schedule message user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type ListScheduledParams struct {
+	Statuses []int32 `json:"statuses"` // 为空只列待发送的
+}
+
+// HandlerListScheduledMessages 我的定时消息
+func HandlerListScheduledMessages(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ListScheduledParams
+	if err := c.ShouldBindJSON(&in); err != nil && err != io.EOF {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	items, err := chatService.ListScheduledMessages(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.Statuses)
+	if err != nil {
+		logger.Errorf("list scheduled user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+// HandlerUpdateScheduledMessage 修改定时消息的发送时间/内容（发出前）
+func HandlerUpdateScheduledMessage(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ScheduleMessageParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.ScheduleID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	md, err := parseMessageData(in.Message)
+	if err != nil || (md == nil && in.SendAtMS <= 0) {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.UpdateScheduledMessage(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.ScheduleID, in.SendAtMS, md)
+	if err != nil {
+		logger.Errorf("update scheduled user=%s schedule=%s err=%v", authInfo.UserId, in.ScheduleID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type CancelScheduledParams struct {
+	ScheduleID string `json:"schedule_id"`
+}
+
+// HandlerCancelScheduledMessage 取消定时消息（发出前）
+func HandlerCancelScheduledMessage(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in CancelScheduledParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.ScheduleID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.CancelScheduledMessage(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.ScheduleID); err != nil {
+		logger.Errorf("cancel scheduled user=%s schedule=%s err=%v", authInfo.UserId, in.ScheduleID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type PresenceSubscribeParams struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// HandlerSubscribePresence 显式订阅非好友的在线状态（好友默认已订阅）
+func HandlerSubscribePresence(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in PresenceSubscribeParams
+	if err := c.ShouldBindJSON(&in); err != nil || len(in.UserIDs) == 0 {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.SubscribePresence(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.UserIDs); err != nil {
+		logger.Errorf("subscribe presence user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerUnsubscribePresence 取消显式订阅
+func HandlerUnsubscribePresence(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in PresenceSubscribeParams
+	if err := c.ShouldBindJSON(&in); err != nil || len(in.UserIDs) == 0 {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.UnsubscribePresence(c.Request.Context(), authInfo.UserId, in.UserIDs); err != nil {
+		logger.Errorf("unsubscribe presence user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type LastSeenPrivacyParams struct {
+	Privacy string `json:"privacy"` // everyone / contacts / nobody
+}
+
+// HandlerSetLastSeenPrivacy 设置最后在线（含在线状态）对谁可见
+func HandlerSetLastSeenPrivacy(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in LastSeenPrivacyParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.Privacy == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.SetLastSeenPrivacy(c.Request.Context(), authInfo.UserId, in.Privacy); err != nil {
+		logger.Errorf("set last seen privacy user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerListConversations 会话列表（置顶在前、按最新消息倒序），带未读/@未读/最新消息和增量同步游标
+func HandlerListConversations(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	resp, err := chatService.ListConversations(c.Request.Context(), config.GetTenantID(), authInfo.UserId)
+	if err != nil {
+		logger.Errorf("list conversations user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(resp))
+}
+
+type SyncConversationsParams struct {
+	Cursor string `json:"cursor"` // 上次返回的 next_cursor；为空从头全量同步
+	Size   int64  `json:"size"`
+}
+
+// HandlerSyncConversations 增量同步：返回游标之后有变化的会话
+func HandlerSyncConversations(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in SyncConversationsParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	resp, err := chatService.SyncConversations(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.Cursor, in.Size)
+	if err != nil {
+		logger.Errorf("sync conversations user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(resp))
+}
+
+type ConversationSettingsParams struct {
+	ConversationID string `json:"conversation_id"`
+	chatService.ConversationSettings
+}
+
+// HandlerUpdateConversation 置顶/免打扰
+func HandlerUpdateConversation(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ConversationSettingsParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.ConversationID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.UpdateConversationSettings(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.ConversationID, &in.ConversationSettings); err != nil {
+		logger.Errorf("update conversation user=%s conv=%s err=%v", authInfo.UserId, in.ConversationID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type FriendRequestParams struct {
+	chatService.FriendRequestInput
+	DeviceID string `json:"device_id"`
+}
+
+// HandlerSendFriendRequest 发起好友申请，对方在线时收到 SYSTEM_EVENT 通知
+func HandlerSendFriendRequest(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in FriendRequestParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.ToUserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	meta := chatService.FriendRequestMeta{ClientIP: c.ClientIP(), DeviceID: in.DeviceID}
+	item, err := chatService.SendFriendRequest(c.Request.Context(), config.GetTenantID(), authInfo.UserId, &in.FriendRequestInput, meta)
+	if err != nil {
+		logger.Errorf("send friend request user=%s to=%s err=%v", authInfo.UserId, in.ToUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type HandleFriendRequestParams struct {
+	RequestID string `json:"request_id"`
+	Accept    bool   `json:"accept"`
+	HandleMsg string `json:"handle_msg"`
+	chatService.FriendSettings
+}
+
+// HandlerHandleFriendRequest 同意/拒绝好友申请；同意时可同时设置自己这边的备注/标签
+func HandlerHandleFriendRequest(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in HandleFriendRequestParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.RequestID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.HandleFriendRequest(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.RequestID, in.Accept, in.HandleMsg, &in.FriendSettings)
+	if err != nil {
+		logger.Errorf("handle friend request user=%s request=%s err=%v", authInfo.UserId, in.RequestID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type ListFriendRequestsParams struct {
+	Outgoing bool `json:"outgoing"` // 默认查收到的，true 查自己发出的
+}
+
+// HandlerListFriendRequests 好友申请列表
+func HandlerListFriendRequests(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ListFriendRequestsParams
+	if err := c.ShouldBindJSON(&in); err != nil && err != io.EOF {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	items, err := chatService.ListFriendRequests(c.Request.Context(), config.GetTenantID(), authInfo.UserId, !in.Outgoing)
+	if err != nil {
+		logger.Errorf("list friend requests user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+// HandlerListFriends 好友列表
+func HandlerListFriends(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	items, err := chatService.ListFriends(c.Request.Context(), config.GetTenantID(), authInfo.UserId)
+	if err != nil {
+		logger.Errorf("list friends user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+type UpdateFriendParams struct {
+	FriendUserID string `json:"friend_user_id"`
+	chatService.FriendSettings
+}
+
+// HandlerUpdateFriend 修改好友备注/标签
+func HandlerUpdateFriend(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in UpdateFriendParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.FriendUserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.UpdateFriend(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.FriendUserID, &in.FriendSettings); err != nil {
+		logger.Errorf("update friend user=%s friend=%s err=%v", authInfo.UserId, in.FriendUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type FriendUserParams struct {
+	FriendUserID string `json:"friend_user_id"`
+}
+
+// HandlerDeleteFriend 删除好友（双向）
+func HandlerDeleteFriend(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in FriendUserParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.FriendUserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.DeleteFriend(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.FriendUserID); err != nil {
+		logger.Errorf("delete friend user=%s friend=%s err=%v", authInfo.UserId, in.FriendUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type BlackParams struct {
+	BlockUserID string `json:"block_user_id"`
+}
+
+// HandlerAddBlack 拉黑
+func HandlerAddBlack(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in BlackParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.BlockUserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.AddBlack(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.BlockUserID); err != nil {
+		logger.Errorf("add black user=%s block=%s err=%v", authInfo.UserId, in.BlockUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerRemoveBlack 移出黑名单
+func HandlerRemoveBlack(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in BlackParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.BlockUserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.RemoveBlack(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.BlockUserID); err != nil {
+		logger.Errorf("remove black user=%s block=%s err=%v", authInfo.UserId, in.BlockUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerListBlacks 黑名单列表
+func HandlerListBlacks(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	items, err := chatService.ListBlacks(c.Request.Context(), config.GetTenantID(), authInfo.UserId)
+	if err != nil {
+		logger.Errorf("list blacks user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+// HandlerCreateGroup 建群，创建者为群主
+func HandlerCreateGroup(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in chatService.CreateGroupInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.CreateGroup(c.Request.Context(), config.GetTenantID(), authInfo.UserId, &in)
+	if err != nil {
+		logger.Errorf("create group user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type GroupIDParams struct {
+	GroupID string `json:"group_id"`
+}
+
+// HandlerGetGroupInfo 群资料
+func HandlerGetGroupInfo(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupIDParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.GetGroupInfo(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID)
+	if err != nil {
+		logger.Errorf("get group info user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type UpdateGroupParams struct {
+	GroupID string `json:"group_id"`
+	chatService.GroupInfoUpdate
+}
+
+// HandlerUpdateGroup 修改群资料/入群设置
+func HandlerUpdateGroup(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in UpdateGroupParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.UpdateGroupInfo(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, &in.GroupInfoUpdate)
+	if err != nil {
+		logger.Errorf("update group user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type GroupAnnouncementParams struct {
+	GroupID      string `json:"group_id"`
+	Notification string `json:"notification"`
+}
+
+// HandlerSetGroupAnnouncement 发布群公告，空字符串为清空
+func HandlerSetGroupAnnouncement(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupAnnouncementParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.SetGroupAnnouncement(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.Notification); err != nil {
+		logger.Errorf("set group announcement user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerDismissGroup 解散群（仅群主）
+func HandlerDismissGroup(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupIDParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.DismissGroup(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID); err != nil {
+		logger.Errorf("dismiss group user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type JoinGroupParams struct {
+	chatService.JoinGroupInput
+	DeviceID string `json:"device_id"`
+}
+
+// HandlerJoinGroup 入群：邀请链接/免验证/答题直接入群，需要审批时返回 request_id
+func HandlerJoinGroup(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in JoinGroupParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	meta := chatService.FriendRequestMeta{ClientIP: c.ClientIP(), DeviceID: in.DeviceID}
+	res, err := chatService.JoinGroup(c.Request.Context(), config.GetTenantID(), authInfo.UserId, &in.JoinGroupInput, meta)
+	if err != nil {
+		logger.Errorf("join group user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(res))
+}
+
+// HandlerQuitGroup 退群；群主需先转让
+func HandlerQuitGroup(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupIDParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.QuitGroup(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID); err != nil {
+		logger.Errorf("quit group user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type ListGroupRequestsParams struct {
+	GroupID     string `json:"group_id"`
+	PendingOnly bool   `json:"pending_only"`
+}
+
+// HandlerListGroupRequests 入群申请列表（群主/有审批权限的管理员）
+func HandlerListGroupRequests(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ListGroupRequestsParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	items, err := chatService.ListGroupRequests(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.PendingOnly)
+	if err != nil {
+		logger.Errorf("list group requests user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+type HandleGroupRequestParams struct {
+	GroupID   string `json:"group_id"`
+	RequestID string `json:"request_id"`
+	Accept    bool   `json:"accept"`
+	HandleMsg string `json:"handle_msg"`
+}
+
+// HandlerHandleGroupRequest 审批入群申请
+func HandlerHandleGroupRequest(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in HandleGroupRequestParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || in.RequestID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.HandleGroupRequest(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.RequestID, in.Accept, in.HandleMsg)
+	if err != nil {
+		logger.Errorf("handle group request user=%s request=%s err=%v", authInfo.UserId, in.RequestID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerRotateGroupInviteLink 重新生成邀请链接，旧链接失效
+func HandlerRotateGroupInviteLink(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupIDParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	hash, err := chatService.RotateInviteLink(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID)
+	if err != nil {
+		logger.Errorf("rotate invite link user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"invite_link_hash": hash}))
+}
+
+type ListGroupMembersParams struct {
+	GroupID string `json:"group_id"`
+	Cursor  string `json:"cursor"` // 上页返回的 next_cursor
+	Size    int32  `json:"size"`
+}
+
+// HandlerListGroupMembers 群成员列表，按游标翻页
+func HandlerListGroupMembers(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ListGroupMembersParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	page := &messagepb.Page{Cursor: in.Cursor, Size: in.Size}
+	items, resp, err := chatService.ListGroupMembers(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, page)
+	if err != nil {
+		logger.Errorf("list group members user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"items": items, "page": resp}))
+}
+
+type GroupMembersParams struct {
+	GroupID string   `json:"group_id"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// HandlerAddGroupMembers 拉人入群，返回实际新加入的人
+func HandlerAddGroupMembers(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupMembersParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || len(in.UserIDs) == 0 {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	added, err := chatService.InviteGroupMembers(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.UserIDs)
+	if err != nil {
+		logger.Errorf("add group members user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"user_ids": added}))
+}
+
+// HandlerKickGroupMembers 踢人，返回实际被移出的人
+func HandlerKickGroupMembers(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupMembersParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || len(in.UserIDs) == 0 {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	kicked, err := chatService.KickGroupMembers(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.UserIDs)
+	if err != nil {
+		logger.Errorf("kick group members user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"user_ids": kicked}))
+}
+
+type SetGroupAdminParams struct {
+	GroupID        string `json:"group_id"`
+	UserID         string `json:"user_id"`
+	Grant          bool   `json:"grant"`
+	PermissionMask int64  `json:"permission_mask"` // 0=默认管理员权限
+}
+
+// HandlerSetGroupAdmin 设置/取消管理员（仅群主）
+func HandlerSetGroupAdmin(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in SetGroupAdminParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || in.UserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.SetGroupAdmin(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.UserID, in.Grant, in.PermissionMask); err != nil {
+		logger.Errorf("set group admin user=%s group=%s target=%s err=%v", authInfo.UserId, in.GroupID, in.UserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type TransferGroupParams struct {
+	GroupID        string `json:"group_id"`
+	NewOwnerUserID string `json:"new_owner_user_id"`
+}
+
+// HandlerTransferGroupOwner 转让群主
+func HandlerTransferGroupOwner(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in TransferGroupParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || in.NewOwnerUserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.TransferGroupOwner(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.NewOwnerUserID); err != nil {
+		logger.Errorf("transfer group user=%s group=%s to=%s err=%v", authInfo.UserId, in.GroupID, in.NewOwnerUserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type MuteGroupMemberParams struct {
+	GroupID string `json:"group_id"`
+	UserID  string `json:"user_id"`
+	Seconds int64  `json:"seconds"` // <=0 解除禁言
+}
+
+// HandlerMuteGroupMember 禁言/解除禁言成员
+func HandlerMuteGroupMember(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in MuteGroupMemberParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || in.UserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.MuteGroupMember(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.UserID, in.Seconds); err != nil {
+		logger.Errorf("mute group member user=%s group=%s target=%s err=%v", authInfo.UserId, in.GroupID, in.UserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type GroupModerationParams struct {
+	GroupID string `json:"group_id"`
+	chatService.GroupModerationUpdate
+}
+
+// HandlerUpdateGroupModeration 全员禁言/白名单/慢速模式/媒体大小上限
+func HandlerUpdateGroupModeration(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupModerationParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.UpdateGroupModeration(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, &in.GroupModerationUpdate)
+	if err != nil {
+		logger.Errorf("update group moderation user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type BanGroupMemberParams struct {
+	GroupID string `json:"group_id"`
+	UserID  string `json:"user_id"`
+	BanType int32  `json:"ban_type"` // 0=禁止入群(移出) 1=禁止发言 2=两者
+	Seconds int64  `json:"seconds"`  // <=0 永久
+	Reason  string `json:"reason"`
+}
+
+// HandlerBanGroupMember 封禁成员
+func HandlerBanGroupMember(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in BanGroupMemberParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || in.UserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.BanGroupMember(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.UserID, in.BanType, in.Seconds, in.Reason); err != nil {
+		logger.Errorf("ban group member user=%s group=%s target=%s err=%v", authInfo.UserId, in.GroupID, in.UserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type GroupMemberParams struct {
+	GroupID string `json:"group_id"`
+	UserID  string `json:"user_id"`
+}
+
+// HandlerUnbanGroupMember 解除封禁
+func HandlerUnbanGroupMember(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupMemberParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" || in.UserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.UnbanGroupMember(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.UserID); err != nil {
+		logger.Errorf("unban group member user=%s group=%s target=%s err=%v", authInfo.UserId, in.GroupID, in.UserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerListGroupBans 群封禁列表
+func HandlerListGroupBans(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GroupIDParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	items, err := chatService.ListGroupBans(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID)
+	if err != nil {
+		logger.Errorf("list group bans user=%s group=%s err=%v", authInfo.UserId, in.GroupID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+type FreezeGroupParams struct {
+	GroupID string `json:"group_id"`
+	Frozen  bool   `json:"frozen"`
+}
+
+// HandlerFreezeGroup 冻结/解冻群（仅群主）
+func HandlerFreezeGroup(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in FreezeGroupParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GroupID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.SetGroupFrozen(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GroupID, in.Frozen); err != nil {
+		logger.Errorf("freeze group user=%s group=%s frozen=%v err=%v", authInfo.UserId, in.GroupID, in.Frozen, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerListChannels 我订阅的广播频道和未读数
+func HandlerListChannels(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	items, err := chatService.ListMyChannels(c.Request.Context(), config.GetTenantID(), authInfo.UserId)
+	if err != nil {
+		logger.Errorf("list channels user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+type MarkChannelReadParams struct {
+	ChannelID string `json:"channel_id"`
+	Seq       int64  `json:"seq"` // 读到的 seq，0 表示读到最新
+}
+
+// HandlerMarkChannelRead 推进频道已读游标
+func HandlerMarkChannelRead(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in MarkChannelReadParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.ChannelID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	readSeq, err := chatService.MarkChannelRead(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.ChannelID, in.Seq)
+	if err != nil {
+		logger.Errorf("mark channel read user=%s channel=%s seq=%d err=%v", authInfo.UserId, in.ChannelID, in.Seq, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"read_seq": readSeq}))
+}
+
+type SetChannelPublisherParams struct {
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	Enable    bool   `json:"enable"`
+}
+
+// HandlerSetChannelPublisher 授予/收回频道发布者（群主/管理员）
+func HandlerSetChannelPublisher(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in SetChannelPublisherParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.ChannelID == "" || in.UserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.SetChannelPublisher(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.ChannelID, in.UserID, in.Enable); err != nil {
+		logger.Errorf("set channel publisher user=%s channel=%s target=%s err=%v", authInfo.UserId, in.ChannelID, in.UserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerCreateGuild 创建服务器：自带 @everyone 角色、一个文字分类和默认频道
+func HandlerCreateGuild(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in chatService.CreateGuildInput
+	if err := c.ShouldBindJSON(&in); err != nil || in.Name == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.CreateGuild(c.Request.Context(), config.GetTenantID(), authInfo.UserId, &in)
+	if err != nil {
+		logger.Errorf("create guild user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+type GuildParams struct {
+	GuildID string `json:"guild_id"`
+}
+
+// HandlerGetGuild 服务器资料（成员可见）
+func HandlerGetGuild(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.GetGuild(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID)
+	if err != nil {
+		logger.Errorf("get guild user=%s guild=%s err=%v", authInfo.UserId, in.GuildID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerListGuilds 我加入的服务器
+func HandlerListGuilds(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	items, err := chatService.ListMyGuilds(c.Request.Context(), config.GetTenantID(), authInfo.UserId)
+	if err != nil {
+		logger.Errorf("list guilds user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+// HandlerJoinGuild 加入公开服务器
+func HandlerJoinGuild(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.JoinGuild(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID)
+	if err != nil {
+		logger.Errorf("join guild user=%s guild=%s err=%v", authInfo.UserId, in.GuildID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerLeaveGuild 退出服务器；所有者不能退出
+func HandlerLeaveGuild(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.LeaveGuild(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID); err != nil {
+		logger.Errorf("leave guild user=%s guild=%s err=%v", authInfo.UserId, in.GuildID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type GuildMemberParams struct {
+	GuildID string `json:"guild_id"`
+	UserID  string `json:"user_id"`
+}
+
+// HandlerKickGuildMember 踢出成员（需要踢人权限，且只能踢角色比自己低的）
+func HandlerKickGuildMember(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildMemberParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.UserID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.KickGuildMember(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.UserID); err != nil {
+		logger.Errorf("kick guild member user=%s guild=%s target=%s err=%v", authInfo.UserId, in.GuildID, in.UserID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type GuildChannelParams struct {
+	GuildID   string `json:"guild_id"`
+	ChannelID string `json:"channel_id"`
+	chatService.GuildChannelInput
+}
+
+// HandlerCreateGuildChannel 建频道/分类（需要管理频道权限）
+func HandlerCreateGuildChannel(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildChannelParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.Name == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.CreateGuildChannel(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, &in.GuildChannelInput)
+	if err != nil {
+		logger.Errorf("create guild channel user=%s guild=%s err=%v", authInfo.UserId, in.GuildID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerUpdateGuildChannel 改频道名称/话题/位置/所属分类
+func HandlerUpdateGuildChannel(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildChannelParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.ChannelID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.UpdateGuildChannel(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.ChannelID, &in.GuildChannelInput)
+	if err != nil {
+		logger.Errorf("update guild channel user=%s channel=%s err=%v", authInfo.UserId, in.ChannelID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerDeleteGuildChannel 删频道；删分类时子频道移到顶层
+func HandlerDeleteGuildChannel(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildChannelParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.ChannelID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.DeleteGuildChannel(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.ChannelID); err != nil {
+		logger.Errorf("delete guild channel user=%s channel=%s err=%v", authInfo.UserId, in.ChannelID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerListGuildChannels 我能看到的频道和分类
+func HandlerListGuildChannels(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	items, err := chatService.ListGuildChannels(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID)
+	if err != nil {
+		logger.Errorf("list guild channels user=%s guild=%s err=%v", authInfo.UserId, in.GuildID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+type ChannelOverwriteParams struct {
+	GuildID   string                  `json:"guild_id"`
+	ChannelID string                  `json:"channel_id"`
+	Overwrite chatModel.PermOverwrite `json:"overwrite"`
+	Remove    bool                    `json:"remove"`
+}
+
+// HandlerSetChannelOverwrite 设置/删除频道的角色或成员权限覆盖（需要管理角色权限）
+func HandlerSetChannelOverwrite(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in ChannelOverwriteParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.ChannelID == "" || in.Overwrite.TargetID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.SetChannelOverwrite(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.ChannelID, in.Overwrite, in.Remove)
+	if err != nil {
+		logger.Errorf("set channel overwrite user=%s channel=%s target=%s err=%v", authInfo.UserId, in.ChannelID, in.Overwrite.TargetID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerListGuildRoles 服务器角色，按位置从低到高
+func HandlerListGuildRoles(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	items, err := chatService.ListGuildRoles(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID)
+	if err != nil {
+		logger.Errorf("list guild roles user=%s guild=%s err=%v", authInfo.UserId, in.GuildID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(items))
+}
+
+type GuildRoleParams struct {
+	GuildID string `json:"guild_id"`
+	RoleID  string `json:"role_id"`
+	chatService.GuildRoleInput
+}
+
+// HandlerCreateGuildRole 建角色（需要管理角色权限，不能给出自己没有的权限）
+func HandlerCreateGuildRole(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildRoleParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.Name == nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.CreateGuildRole(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, &in.GuildRoleInput)
+	if err != nil {
+		logger.Errorf("create guild role user=%s guild=%s err=%v", authInfo.UserId, in.GuildID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerUpdateGuildRole 改角色名称/颜色/权限/位置
+func HandlerUpdateGuildRole(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildRoleParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.RoleID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	item, err := chatService.UpdateGuildRole(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.RoleID, &in.GuildRoleInput)
+	if err != nil {
+		logger.Errorf("update guild role user=%s role=%s err=%v", authInfo.UserId, in.RoleID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(item))
+}
+
+// HandlerDeleteGuildRole 删角色，成员身上和频道覆盖里的一并去掉
+func HandlerDeleteGuildRole(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildRoleParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.RoleID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.DeleteGuildRole(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.RoleID); err != nil {
+		logger.Errorf("delete guild role user=%s role=%s err=%v", authInfo.UserId, in.RoleID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+type GuildMemberRoleParams struct {
+	GuildID string `json:"guild_id"`
+	UserID  string `json:"user_id"`
+	RoleID  string `json:"role_id"`
+	Enable  bool   `json:"enable"`
+}
+
+// HandlerSetGuildMemberRole 给成员加/去角色
+func HandlerSetGuildMemberRole(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildMemberRoleParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" || in.UserID == "" || in.RoleID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := chatService.SetGuildMemberRole(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.UserID, in.RoleID, in.Enable); err != nil {
+		logger.Errorf("set guild member role user=%s guild=%s target=%s role=%s err=%v", authInfo.UserId, in.GuildID, in.UserID, in.RoleID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerGetGuildPermissions 我在服务器（传 channel_id 时为该频道）的最终权限位
+func HandlerGetGuildPermissions(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+
+	var in GuildChannelParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.GuildID == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	perms, err := chatService.GetMyGuildPermissions(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.GuildID, in.ChannelID)
+	if err != nil {
+		logger.Errorf("get guild permissions user=%s guild=%s channel=%s err=%v", authInfo.UserId, in.GuildID, in.ChannelID, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"permissions": perms}))
+}
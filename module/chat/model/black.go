@@ -1,9 +1,24 @@
 package model
 
 import (
+	"PProject/service/mgo"
+	"context"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Black collection field constants
+const (
+	BlackFieldTenantID    = "tenant_id"
+	BlackFieldOwnerUserID = "owner_user_id"
+	BlackFieldBlockUserID = "block_user_id"
+	BlackFieldCreateTime  = "create_time"
 )
 
+// Black 黑名单：OwnerUserID 拉黑了 BlockUserID（单向）
 type Black struct {
 	TenantID       string    `bson:"tenant_id"` // PK
 	OwnerUserID    string    `bson:"owner_user_id"`
@@ -13,3 +28,100 @@ type Black struct {
 	OperatorUserID string    `bson:"operator_user_id"`
 	Ex             string    `bson:"ex"`
 }
+
+func (sess *Black) GetTableName() string {
+	return "black"
+}
+
+func (sess *Black) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// AddBlack 拉黑，重复拉黑保留第一次的记录
+func (sess *Black) AddBlack(ctx context.Context, b *Black) error {
+	filter := bson.M{
+		BlackFieldTenantID:    b.TenantID,
+		BlackFieldOwnerUserID: b.OwnerUserID,
+		BlackFieldBlockUserID: b.BlockUserID,
+	}
+	_, err := sess.Collection().UpdateOne(ctx, filter, bson.M{"$setOnInsert": b}, options.Update().SetUpsert(true))
+	return err
+}
+
+// RemoveBlack 移出黑名单，不在黑名单里返回 false
+func (sess *Black) RemoveBlack(ctx context.Context, tenantID, ownerUserID, blockUserID string) (bool, error) {
+	filter := bson.M{
+		BlackFieldTenantID:    tenantID,
+		BlackFieldOwnerUserID: ownerUserID,
+		BlackFieldBlockUserID: blockUserID,
+	}
+	res, err := sess.Collection().DeleteOne(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// IsBlocked ownerUserID 是否拉黑了 blockUserID
+func (sess *Black) IsBlocked(ctx context.Context, tenantID, ownerUserID, blockUserID string) (bool, error) {
+	filter := bson.M{
+		BlackFieldTenantID:    tenantID,
+		BlackFieldOwnerUserID: ownerUserID,
+		BlackFieldBlockUserID: blockUserID,
+	}
+	n, err := sess.Collection().CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ListBlacks ownerUserID 的黑名单，按拉黑时间倒序
+func (sess *Black) ListBlacks(ctx context.Context, tenantID, ownerUserID string, limit int64) ([]*Black, error) {
+	filter := bson.M{
+		BlackFieldTenantID:    tenantID,
+		BlackFieldOwnerUserID: ownerUserID,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: BlackFieldCreateTime, Value: -1}}).SetLimit(limit)
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Black
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// FilterBlockPairs others 中和 userID 之间有拉黑关系（任意一方拉黑另一方）的那部分
+func (sess *Black) FilterBlockPairs(ctx context.Context, tenantID, userID string, others []string) ([]string, error) {
+	if len(others) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		BlackFieldTenantID: tenantID,
+		"$or": bson.A{
+			bson.M{BlackFieldOwnerUserID: userID, BlackFieldBlockUserID: bson.M{"$in": others}},
+			bson.M{BlackFieldOwnerUserID: bson.M{"$in": others}, BlackFieldBlockUserID: userID},
+		},
+	}
+	opts := options.Find().SetProjection(bson.M{BlackFieldOwnerUserID: 1, BlackFieldBlockUserID: 1})
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Black
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(list))
+	for _, b := range list {
+		if b.OwnerUserID == userID {
+			ids = append(ids, b.BlockUserID)
+		} else {
+			ids = append(ids, b.OwnerUserID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BotInteraction collection field constants
+const (
+	BotInteractionFieldID             = "_id"
+	BotInteractionFieldTenantID       = "tenant_id"
+	BotInteractionFieldInteractionID  = "interaction_id"
+	BotInteractionFieldTokenHash      = "token_hash"
+	BotInteractionFieldBotUserID      = "bot_user_id"
+	BotInteractionFieldUserID         = "user_id"
+	BotInteractionFieldServerMsgID    = "server_msg_id"
+	BotInteractionFieldConversationID = "conversation_id"
+	BotInteractionFieldCustomID       = "custom_id"
+	BotInteractionFieldValues         = "values"
+	BotInteractionFieldResponded      = "responded"
+	BotInteractionFieldRespondedAt    = "responded_at"
+	BotInteractionFieldExpireAt       = "expire_at"
+	BotInteractionFieldCreateTime     = "create_time"
+)
+
+// BotInteraction 用户点了机器人消息上的组件（按钮/下拉/输入）产生的一次交互
+// 机器人凭 interaction_id + token 在有效期内回应一次（更新原消息或回一条仅点击者可见的消息）
+type BotInteraction struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID       string             `bson:"tenant_id"`
+	InteractionID  string             `bson:"interaction_id"`
+	TokenHash      string             `bson:"token_hash"` // SHA256(token)，token 只随 Webhook 下发
+	BotUserID      string             `bson:"bot_user_id"`
+	UserID         string             `bson:"user_id"` // 点击者
+	ServerMsgID    string             `bson:"server_msg_id"`
+	ConversationID string             `bson:"conversation_id"`
+	CustomID       string             `bson:"custom_id"`
+	Values         []string           `bson:"values,omitempty"` // 下拉选中的值/输入框内容
+	Responded      bool               `bson:"responded"`
+	RespondedAt    *time.Time         `bson:"responded_at,omitempty"`
+	ExpireAt       time.Time          `bson:"expire_at"` // TTL 索引清理
+	CreateTime     time.Time          `bson:"create_time"`
+}
+
+func (sess *BotInteraction) GetTableName() string {
+	return "bot_interaction"
+}
+
+func (sess *BotInteraction) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// InsertBotInteraction 记录一次交互
+func (sess *BotInteraction) InsertBotInteraction(ctx context.Context, it *BotInteraction) error {
+	it.CreateTime = time.Now()
+	_, err := sess.Collection().InsertOne(ctx, it)
+	return err
+}
+
+// ClaimBotInteraction 机器人回应交互：token 匹配、未过期、未回应过才能领到，领到即标记已回应（只能回应一次）
+func (sess *BotInteraction) ClaimBotInteraction(ctx context.Context, tenantID, interactionID, botUserID, tokenHash string, now time.Time) (*BotInteraction, error) {
+	filter := bson.M{
+		BotInteractionFieldTenantID:      tenantID,
+		BotInteractionFieldInteractionID: interactionID,
+		BotInteractionFieldBotUserID:     botUserID,
+		BotInteractionFieldTokenHash:     tokenHash,
+		BotInteractionFieldResponded:     false,
+		BotInteractionFieldExpireAt:      bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{
+		BotInteractionFieldResponded:   true,
+		BotInteractionFieldRespondedAt: now,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var it BotInteraction
+	if err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&it); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &it, nil
+}
+
+// ReleaseBotInteraction 回应失败时放回，机器人可以在有效期内重试
+func (sess *BotInteraction) ReleaseBotInteraction(ctx context.Context, id primitive.ObjectID) error {
+	_, err := sess.Collection().UpdateOne(ctx,
+		bson.M{BotInteractionFieldID: id},
+		bson.M{
+			"$set":   bson.M{BotInteractionFieldResponded: false},
+			"$unset": bson.M{BotInteractionFieldRespondedAt: ""},
+		})
+	return err
+}
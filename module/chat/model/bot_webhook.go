@@ -0,0 +1,146 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BotWebhookDelivery collection field constants
+const (
+	BotWebhookFieldID            = "_id"
+	BotWebhookFieldTenantID      = "tenant_id"
+	BotWebhookFieldBotUserID     = "bot_user_id"
+	BotWebhookFieldEventID       = "event_id"
+	BotWebhookFieldEventType     = "event_type"
+	BotWebhookFieldBody          = "body"
+	BotWebhookFieldStatus        = "status"
+	BotWebhookFieldAttempts      = "attempts"
+	BotWebhookFieldNextAttemptMS = "next_attempt_ms"
+	BotWebhookFieldLastError     = "last_error"
+	BotWebhookFieldCreateTime    = "create_time"
+	BotWebhookFieldSentAt        = "sent_at"
+	BotWebhookFieldUpdatedAt     = "updated_at"
+)
+
+// Status
+const (
+	BotWebhookStatusPending int32 = 0 // 待投递
+	BotWebhookStatusSent    int32 = 1 // 机器人已返回 2xx
+	BotWebhookStatusFailed  int32 = 2 // 多次投递失败，放弃
+)
+
+// BotWebhookDelivery 待投递给机器人 Webhook 的一条事件（消息、组件交互）
+// 和 outbox 一样按 next_attempt_ms 租约领取：投递进程宕机后租约到期，可被其它节点重新领取
+type BotWebhookDelivery struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID      string             `bson:"tenant_id"`
+	BotUserID     string             `bson:"bot_user_id"`
+	EventID       string             `bson:"event_id"` // 机器人按它去重（重试时不变）
+	EventType     string             `bson:"event_type"`
+	Body          []byte             `bson:"body"` // 事件 JSON，原样 POST
+	Status        int32              `bson:"status"`
+	Attempts      int32              `bson:"attempts"`
+	NextAttemptMS int64              `bson:"next_attempt_ms"`
+	LastError     string             `bson:"last_error,omitempty"`
+	CreateTime    time.Time          `bson:"create_time"`
+	SentAt        *time.Time         `bson:"sent_at,omitempty"` // TTL 索引按这个字段清理已投递的记录
+	UpdatedAt     time.Time          `bson:"updated_at"`
+}
+
+func (sess *BotWebhookDelivery) GetTableName() string {
+	return "bot_webhook_delivery"
+}
+
+func (sess *BotWebhookDelivery) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// InsertBotWebhookDeliveries 写入待投递事件，立即可领取
+func (sess *BotWebhookDelivery) InsertBotWebhookDeliveries(ctx context.Context, list []*BotWebhookDelivery) error {
+	if len(list) == 0 {
+		return nil
+	}
+	now := time.Now()
+	docs := make([]any, 0, len(list))
+	for _, d := range list {
+		if d.ID.IsZero() {
+			d.ID = primitive.NewObjectID()
+		}
+		d.Status = BotWebhookStatusPending
+		d.NextAttemptMS = now.UnixMilli()
+		d.CreateTime = now
+		d.UpdatedAt = now
+		docs = append(docs, d)
+	}
+	_, err := sess.Collection().InsertMany(ctx, docs)
+	return err
+}
+
+// ClaimPendingBotWebhook 领取一条到期的待投递事件：把 next_attempt_ms 推到 leaseUntilMS
+func (sess *BotWebhookDelivery) ClaimPendingBotWebhook(ctx context.Context, nowMS, leaseUntilMS int64) (*BotWebhookDelivery, error) {
+	filter := bson.M{
+		BotWebhookFieldStatus:        BotWebhookStatusPending,
+		BotWebhookFieldNextAttemptMS: bson.M{"$lte": nowMS},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			BotWebhookFieldNextAttemptMS: leaseUntilMS,
+			BotWebhookFieldUpdatedAt:     time.Now(),
+		},
+		"$inc": bson.M{BotWebhookFieldAttempts: int32(1)},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: BotWebhookFieldNextAttemptMS, Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var d BotWebhookDelivery
+	if err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&d); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// MarkBotWebhookSent 投递成功
+func (sess *BotWebhookDelivery) MarkBotWebhookSent(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	_, err := sess.Collection().UpdateOne(ctx,
+		bson.M{
+			BotWebhookFieldID:     id,
+			BotWebhookFieldStatus: BotWebhookStatusPending,
+		},
+		bson.M{"$set": bson.M{
+			BotWebhookFieldStatus:    BotWebhookStatusSent,
+			BotWebhookFieldSentAt:    now,
+			BotWebhookFieldUpdatedAt: now,
+		}})
+	return err
+}
+
+// RetryBotWebhook 投递失败：retryAtMS 之后再试；failed=true 表示放弃
+func (sess *BotWebhookDelivery) RetryBotWebhook(ctx context.Context, id primitive.ObjectID, retryAtMS int64, lastError string, failed bool) error {
+	set := bson.M{
+		BotWebhookFieldNextAttemptMS: retryAtMS,
+		BotWebhookFieldLastError:     lastError,
+		BotWebhookFieldUpdatedAt:     time.Now(),
+	}
+	if failed {
+		set[BotWebhookFieldStatus] = BotWebhookStatusFailed
+	}
+	_, err := sess.Collection().UpdateOne(ctx,
+		bson.M{
+			BotWebhookFieldID:     id,
+			BotWebhookFieldStatus: BotWebhookStatusPending,
+		},
+		bson.M{"$set": set})
+	return err
+}
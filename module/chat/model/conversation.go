@@ -39,6 +39,7 @@ const (
 	ConversationFieldIsMsgDestruct         = "is_msg_destruct"
 	ConversationFieldMsgDestructTime       = "msg_destruct_time"
 	ConversationFieldLatestMsgDestructTime = "latest_msg_destruct_time"
+	ConversationFieldVersion               = "version"
 )
 
 const (
@@ -81,8 +82,11 @@ type Conversation struct {
 	CreateTime            time.Time `bson:"create_time"`
 	UpdatedAt             time.Time `bson:"updated_at"`
 	IsMsgDestruct         bool      `bson:"is_msg_destruct"`
-	MsgDestructTime       time.Time `bson:"msg_destruct_time"`
+	MsgDestructTime       int64     `bson:"msg_destruct_time"` // 消息定时销毁时长（秒），IsMsgDestruct 开启时生效
 	LatestMsgDestructTime time.Time `bson:"latest_msg_destruct_time"`
+
+	// —— 会话列表增量同步 —— //
+	Version int64 `bson:"version,omitempty"` // 用户维度单调递增，会话有变化（新消息/已读/@/置顶/免打扰）时前移
 }
 
 func (sess *Conversation) GetTableName() string {
@@ -178,3 +182,234 @@ func (sess *Conversation) GetConversationByID(ctx context.Context, tenantID, con
 	}
 	return &conv, nil
 }
+
+// GetUserConversation 根据 TenantID + OwnerUserID + ConversationID 查询某个用户自己的会话记录
+func (sess *Conversation) GetUserConversation(ctx context.Context, tenantID, ownerUserID, conversationID string) (*Conversation, error) {
+	filter := bson.M{
+		ConversationFieldTenantID:       tenantID,
+		ConversationFieldOwnerUserID:    ownerUserID,
+		ConversationFieldConversationID: conversationID,
+	}
+
+	var conv Conversation
+	err := sess.Collection().FindOne(ctx, filter).Decode(&conv)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil // 没找到
+		}
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// ListConversationOwners 查询某个会话下所有持有会话记录的用户
+func (sess *Conversation) ListConversationOwners(ctx context.Context, tenantID, conversationID string) ([]string, error) {
+	filter := bson.M{
+		ConversationFieldTenantID:       tenantID,
+		ConversationFieldConversationID: conversationID,
+	}
+	opts := options.Find().SetProjection(bson.M{ConversationFieldOwnerUserID: 1})
+
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		OwnerUserID string `bson:"owner_user_id"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	owners := make([]string, 0, len(rows))
+	for _, r := range rows {
+		owners = append(owners, r.OwnerUserID)
+	}
+	return owners, nil
+}
+
+// ListUserConversations 用户最近更新的会话（按 updated_at 倒序）
+func (sess *Conversation) ListUserConversations(ctx context.Context, tenantID, ownerUserID string, limit int64) ([]*Conversation, error) {
+	filter := bson.M{
+		ConversationFieldTenantID:    tenantID,
+		ConversationFieldOwnerUserID: ownerUserID,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: ConversationFieldUpdatedAt, Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Conversation
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListConversationsByOwners 同一会话下一批用户各自的会话记录
+func (sess *Conversation) ListConversationsByOwners(ctx context.Context, tenantID, conversationID string, owners []string) ([]*Conversation, error) {
+	if len(owners) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		ConversationFieldTenantID:       tenantID,
+		ConversationFieldConversationID: conversationID,
+		ConversationFieldOwnerUserID:    bson.M{"$in": owners},
+	}
+	cur, err := sess.Collection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Conversation
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// IncMentionUnread 给一批用户的会话 @未读 +1
+func (sess *Conversation) IncMentionUnread(ctx context.Context, tenantID, conversationID string, owners []string) error {
+	if len(owners) == 0 {
+		return nil
+	}
+	filter := bson.M{
+		ConversationFieldTenantID:       tenantID,
+		ConversationFieldConversationID: conversationID,
+		ConversationFieldOwnerUserID:    bson.M{"$in": owners},
+	}
+	update := bson.M{
+		"$inc": bson.M{ConversationFieldMentionUnread: int32(1)},
+		"$set": bson.M{ConversationFieldUpdatedAt: time.Now()},
+	}
+	_, err := sess.Collection().UpdateMany(ctx, filter, update)
+	return err
+}
+
+// UpdateReadSeq 推进个人已读游标（只前移），同时刷新 @未读 计数
+func (sess *Conversation) UpdateReadSeq(ctx context.Context, tenantID, ownerUserID, conversationID string, readSeq int64, mentionUnread int64) error {
+	filter := bson.M{
+		ConversationFieldTenantID:       tenantID,
+		ConversationFieldOwnerUserID:    ownerUserID,
+		ConversationFieldConversationID: conversationID,
+	}
+	update := bson.M{
+		"$max": bson.M{
+			ConversationFieldReadSeq:        readSeq,
+			ConversationFieldMentionReadSeq: readSeq,
+		},
+		"$set": bson.M{
+			ConversationFieldMentionUnread: int32(mentionUnread),
+			ConversationFieldUpdatedAt:     time.Now(),
+		},
+	}
+	_, err := sess.Collection().UpdateOne(ctx, filter, update)
+	return err
+}
+
+// EnsureGroupConversations 给一批群成员确保会话记录存在，并把 server_max_seq 前移到最新（未读 = server_max_seq - read_seq）
+func (sess *Conversation) EnsureGroupConversations(ctx context.Context, tenantID, conversationID, groupID string, convType int32, owners []string, serverMaxSeq int64) error {
+	if len(owners) == 0 {
+		return nil
+	}
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(owners))
+	for _, owner := range owners {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				ConversationFieldTenantID:       tenantID,
+				ConversationFieldOwnerUserID:    owner,
+				ConversationFieldConversationID: conversationID,
+			}).
+			SetUpdate(bson.M{
+				"$setOnInsert": bson.M{
+					ConversationFieldConversationType: convType,
+					ConversationFieldGroupID:          groupID,
+					ConversationFieldRecvMsgOpt:       int32(0),
+					ConversationFieldIsPinned:         false,
+					ConversationFieldIsPrivateChat:    false,
+					ConversationFieldBurnDuration:     int32(0),
+					ConversationFieldGroupAtType:      int32(0),
+					ConversationFieldAttachedInfo:     "",
+					ConversationFieldEx:               "",
+					ConversationFieldReadSeq:          int64(0),
+					ConversationFieldMinSeq:           int64(0),
+					ConversationFieldCreateTime:       now,
+					ConversationFieldIsMsgDestruct:    false,
+				},
+				"$max": bson.M{ConversationFieldServerMaxSeq: serverMaxSeq},
+				"$set": bson.M{ConversationFieldUpdatedAt: now},
+			}).
+			SetUpsert(true))
+	}
+	_, err := sess.Collection().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// SetVersions 前移一批用户在同一会话上的版本号（只增不减）
+func (sess *Conversation) SetVersions(ctx context.Context, tenantID, conversationID string, versions map[string]int64) error {
+	if len(versions) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(versions))
+	for owner, v := range versions {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				ConversationFieldTenantID:       tenantID,
+				ConversationFieldOwnerUserID:    owner,
+				ConversationFieldConversationID: conversationID,
+			}).
+			SetUpdate(bson.M{"$max": bson.M{ConversationFieldVersion: v}}))
+	}
+	_, err := sess.Collection().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// ListConversationsAfter 用户会话按 (version, conversation_id) 升序，取游标之后的一页
+// 没有 version 的旧记录按 0 处理，首次全量同步时一并返回
+func (sess *Conversation) ListConversationsAfter(ctx context.Context, tenantID, ownerUserID string, version int64, conversationID string, limit int64) ([]*Conversation, error) {
+	sameVersion := bson.M{ConversationFieldVersion: version}
+	if version == 0 {
+		sameVersion = bson.M{ConversationFieldVersion: bson.M{"$in": bson.A{int64(0), nil}}}
+	}
+	sameVersion[ConversationFieldConversationID] = bson.M{"$gt": conversationID}
+
+	filter := bson.M{
+		ConversationFieldTenantID:    tenantID,
+		ConversationFieldOwnerUserID: ownerUserID,
+		"$or": bson.A{
+			bson.M{ConversationFieldVersion: bson.M{"$gt": version}},
+			sameVersion,
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: ConversationFieldVersion, Value: 1}, {Key: ConversationFieldConversationID, Value: 1}}).
+		SetLimit(limit)
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Conversation
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateUserSettings 修改用户自己的会话设置（置顶/免打扰等），返回是否找到会话
+func (sess *Conversation) UpdateUserSettings(ctx context.Context, tenantID, ownerUserID, conversationID string, set bson.M) (bool, error) {
+	if len(set) == 0 {
+		return false, nil
+	}
+	set[ConversationFieldUpdatedAt] = time.Now()
+	res, err := sess.Collection().UpdateOne(ctx, bson.M{
+		ConversationFieldTenantID:       tenantID,
+		ConversationFieldOwnerUserID:    ownerUserID,
+		ConversationFieldConversationID: conversationID,
+	}, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
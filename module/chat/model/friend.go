@@ -1,8 +1,36 @@
 package model
 
 import (
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"PProject/service/mgo"
+	"context"
+	"errors"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Friend collection field constants
+const (
+	FriendFieldTenantID     = "tenant_id"
+	FriendFieldOwnerUserID  = "owner_user_id"
+	FriendFieldFriendUserID = "friend_user_id"
+	FriendFieldStatus       = "status"
+	FriendFieldRemark       = "remark"
+	FriendFieldTags         = "tags"
+	FriendFieldIsBlocked    = "is_blocked"
+	FriendFieldUpdateTime   = "update_time"
+	FriendFieldDeleteTime   = "delete_time"
+)
+
+// Status
+const (
+	FriendStatusPending  int32 = 0
+	FriendStatusAccepted int32 = 1
+	FriendStatusRejected int32 = 2
+	FriendStatusDeleted  int32 = 3
 )
 
 // Friend 表示用户好友关系（单向存储，一般为双向各存一条记录）
@@ -35,3 +63,218 @@ type Friend struct {
 
 	Ex string `bson:"ex"` // 预留扩展字段(JSON，可存标签、备注扩展等)
 }
+
+func (sess *Friend) GetTableName() string {
+	return "friend"
+}
+
+func (sess *Friend) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// ListFriendIDs ownerUserID 已同意且未拉黑的好友ID，最多 limit 个
+func (sess *Friend) ListFriendIDs(ctx context.Context, tenantID, ownerUserID string, limit int64) ([]string, error) {
+	filter := bson.M{
+		FriendFieldTenantID:    tenantID,
+		FriendFieldOwnerUserID: ownerUserID,
+		FriendFieldStatus:      FriendStatusAccepted,
+		FriendFieldIsBlocked:   bson.M{"$ne": true},
+	}
+	opts := options.Find().
+		SetProjection(bson.M{FriendFieldFriendUserID: 1}).
+		SetLimit(limit)
+	return sess.findUserIDs(ctx, filter, opts, FriendFieldFriendUserID)
+}
+
+// FilterFriendIDs userIDs 中是 ownerUserID 已同意且未拉黑的好友的那部分
+func (sess *Friend) FilterFriendIDs(ctx context.Context, tenantID, ownerUserID string, userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		FriendFieldTenantID:     tenantID,
+		FriendFieldOwnerUserID:  ownerUserID,
+		FriendFieldFriendUserID: bson.M{"$in": userIDs},
+		FriendFieldStatus:       FriendStatusAccepted,
+		FriendFieldIsBlocked:    bson.M{"$ne": true},
+	}
+	opts := options.Find().SetProjection(bson.M{FriendFieldFriendUserID: 1})
+	return sess.findUserIDs(ctx, filter, opts, FriendFieldFriendUserID)
+}
+
+// FilterOwnersOf ownerUserIDs 中把 friendUserID 当作已同意好友且未拉黑的那部分
+func (sess *Friend) FilterOwnersOf(ctx context.Context, tenantID, friendUserID string, ownerUserIDs []string) ([]string, error) {
+	if len(ownerUserIDs) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		FriendFieldTenantID:     tenantID,
+		FriendFieldOwnerUserID:  bson.M{"$in": ownerUserIDs},
+		FriendFieldFriendUserID: friendUserID,
+		FriendFieldStatus:       FriendStatusAccepted,
+		FriendFieldIsBlocked:    bson.M{"$ne": true},
+	}
+	opts := options.Find().SetProjection(bson.M{FriendFieldOwnerUserID: 1})
+	return sess.findUserIDs(ctx, filter, opts, FriendFieldOwnerUserID)
+}
+
+func (sess *Friend) findUserIDs(ctx context.Context, filter bson.M, opts *options.FindOptions, field string) ([]string, error) {
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []bson.M
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		if id, ok := r[field].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// GetFriend 查询 ownerUserID 名下对 friendUserID 的关系记录（任意状态）
+func (sess *Friend) GetFriend(ctx context.Context, tenantID, ownerUserID, friendUserID string) (*Friend, error) {
+	filter := bson.M{
+		FriendFieldTenantID:     tenantID,
+		FriendFieldOwnerUserID:  ownerUserID,
+		FriendFieldFriendUserID: friendUserID,
+	}
+	var f Friend
+	err := sess.Collection().FindOne(ctx, filter).Decode(&f)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &f, nil
+}
+
+// IsFriend ownerUserID 是否把 friendUserID 当作已同意好友
+func (sess *Friend) IsFriend(ctx context.Context, tenantID, ownerUserID, friendUserID string) (bool, error) {
+	ids, err := sess.FilterFriendIDs(ctx, tenantID, ownerUserID, []string{friendUserID})
+	return len(ids) > 0, err
+}
+
+// ListFriends ownerUserID 已同意的好友，按 friend_user_id 升序，最多 limit 个
+func (sess *Friend) ListFriends(ctx context.Context, tenantID, ownerUserID string, limit int64) ([]*Friend, error) {
+	filter := bson.M{
+		FriendFieldTenantID:    tenantID,
+		FriendFieldOwnerUserID: ownerUserID,
+		FriendFieldStatus:      FriendStatusAccepted,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: FriendFieldFriendUserID, Value: 1}}).SetLimit(limit)
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Friend
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// FriendSide 建立好友关系时某一方自己的设置
+type FriendSide struct {
+	UserID    string
+	Remark    string
+	Tags      []string
+	AddSource int32
+}
+
+// UpsertFriendPair 双向写入已同意的好友关系（两条记录一次批量写），重复调用幂等
+// 之前删除过的记录恢复为已同意；remark/tags 只在给了值时覆盖
+func (sess *Friend) UpsertFriendPair(ctx context.Context, tenantID string, a, b FriendSide, operatorUserID string, now time.Time) error {
+	side := func(owner, peer FriendSide) mongo.WriteModel {
+		set := bson.M{
+			FriendFieldStatus:     FriendStatusAccepted,
+			FriendFieldUpdateTime: now,
+		}
+		if owner.Remark != "" {
+			set[FriendFieldRemark] = owner.Remark
+		}
+		if owner.Tags != nil {
+			set[FriendFieldTags] = owner.Tags
+		}
+		onInsert := bson.M{
+			"_id":              primitive.NewObjectID(),
+			"create_time":      now,
+			"add_source":       owner.AddSource,
+			"operator_user_id": operatorUserID,
+		}
+		if owner.Remark == "" {
+			onInsert[FriendFieldRemark] = ""
+		}
+		if owner.Tags == nil {
+			onInsert[FriendFieldTags] = []string{}
+		}
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				FriendFieldTenantID:     tenantID,
+				FriendFieldOwnerUserID:  owner.UserID,
+				FriendFieldFriendUserID: peer.UserID,
+			}).
+			SetUpdate(bson.M{
+				"$set":         set,
+				"$unset":       bson.M{FriendFieldDeleteTime: ""},
+				"$setOnInsert": onInsert,
+			}).
+			SetUpsert(true)
+	}
+	_, err := sess.Collection().BulkWrite(ctx, []mongo.WriteModel{side(a, b), side(b, a)})
+	return err
+}
+
+// UpdateFriendInfo 修改 ownerUserID 对好友的备注/标签等；不是好友返回 false
+func (sess *Friend) UpdateFriendInfo(ctx context.Context, tenantID, ownerUserID, friendUserID string, set bson.M) (bool, error) {
+	filter := bson.M{
+		FriendFieldTenantID:     tenantID,
+		FriendFieldOwnerUserID:  ownerUserID,
+		FriendFieldFriendUserID: friendUserID,
+		FriendFieldStatus:       FriendStatusAccepted,
+	}
+	res, err := sess.Collection().UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// DeleteFriendPair 双向逻辑删除好友关系，返回实际删除的记录数（0 表示本来就不是好友）
+func (sess *Friend) DeleteFriendPair(ctx context.Context, tenantID, userA, userB string, now time.Time) (int64, error) {
+	filter := bson.M{
+		FriendFieldTenantID: tenantID,
+		FriendFieldStatus:   FriendStatusAccepted,
+		"$or": bson.A{
+			bson.M{FriendFieldOwnerUserID: userA, FriendFieldFriendUserID: userB},
+			bson.M{FriendFieldOwnerUserID: userB, FriendFieldFriendUserID: userA},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		FriendFieldStatus:     FriendStatusDeleted,
+		FriendFieldUpdateTime: now,
+		FriendFieldDeleteTime: now,
+	}}
+	res, err := sess.Collection().UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// SetBlocked 同步好友记录上的拉黑标记（不是好友时没有记录，忽略）
+func (sess *Friend) SetBlocked(ctx context.Context, tenantID, ownerUserID, friendUserID string, blocked bool, now time.Time) error {
+	filter := bson.M{
+		FriendFieldTenantID:     tenantID,
+		FriendFieldOwnerUserID:  ownerUserID,
+		FriendFieldFriendUserID: friendUserID,
+	}
+	update := bson.M{"$set": bson.M{FriendFieldIsBlocked: blocked, FriendFieldUpdateTime: now}}
+	_, err := sess.Collection().UpdateOne(ctx, filter, update)
+	return err
+}
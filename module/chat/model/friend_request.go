@@ -1,7 +1,49 @@
 package model
 
 import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FriendRequest collection field constants
+const (
+	FriendReqFieldTenantID      = "tenant_id"
+	FriendReqFieldFromUserID    = "from_user_id"
+	FriendReqFieldToUserID      = "to_user_id"
+	FriendReqFieldHandleResult  = "handle_result"
+	FriendReqFieldReqMsg        = "req_msg"
+	FriendReqFieldCreateTime    = "create_time"
+	FriendReqFieldHandlerUserID = "handler_user_id"
+	FriendReqFieldHandleMsg     = "handle_msg"
+	FriendReqFieldHandleTime    = "handle_time"
+	FriendReqFieldRequestID     = "request_id"
+	FriendReqFieldStatus        = "status"
+	FriendReqFieldExpireTime    = "expire_time"
+	FriendReqFieldUpdateTime    = "update_time"
+	FriendReqFieldIsRead        = "is_read"
+	FriendReqFieldRemarkName    = "remark_name"
+	FriendReqFieldTags          = "tags"
+)
+
+// HandleResult
+const (
+	FriendReqResultPending  int32 = 0
+	FriendReqResultAccepted int32 = 1
+	FriendReqResultRejected int32 = 2
+	FriendReqResultIgnored  int32 = 3
+)
+
+// Status
+const (
+	FriendReqStatusValid   int32 = 0
+	FriendReqStatusRevoked int32 = 1
+	FriendReqStatusExpired int32 = 2
 )
 
 // FriendRequest 表示一次好友申请的完整生命周期。
@@ -37,3 +79,146 @@ type FriendRequest struct {
 
 	Ex string `bson:"ex"` // 预留扩展字段（JSON，可存客户端设备信息等）
 }
+
+func (sess *FriendRequest) GetTableName() string {
+	return "friend_request"
+}
+
+func (sess *FriendRequest) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// friendReqPendingFilter 未处理、未撤回且未过期的申请
+func friendReqPendingFilter(tenantID string, now time.Time) bson.M {
+	return bson.M{
+		FriendReqFieldTenantID:     tenantID,
+		FriendReqFieldHandleResult: FriendReqResultPending,
+		FriendReqFieldStatus:       FriendReqStatusValid,
+		FriendReqFieldExpireTime:   bson.M{"$gt": now},
+	}
+}
+
+// CreateFriendRequest 写入一条新申请
+func (sess *FriendRequest) CreateFriendRequest(ctx context.Context, req *FriendRequest) error {
+	_, err := sess.Collection().InsertOne(ctx, req)
+	return err
+}
+
+// GetFriendRequest 按 request_id 查询
+func (sess *FriendRequest) GetFriendRequest(ctx context.Context, tenantID, requestID string) (*FriendRequest, error) {
+	filter := bson.M{
+		FriendReqFieldTenantID:  tenantID,
+		FriendReqFieldRequestID: requestID,
+	}
+	var r FriendRequest
+	err := sess.Collection().FindOne(ctx, filter).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetPendingRequest from -> to 最近一条待处理的申请；没有返回 nil
+func (sess *FriendRequest) GetPendingRequest(ctx context.Context, tenantID, fromUserID, toUserID string, now time.Time) (*FriendRequest, error) {
+	filter := friendReqPendingFilter(tenantID, now)
+	filter[FriendReqFieldFromUserID] = fromUserID
+	filter[FriendReqFieldToUserID] = toUserID
+
+	opts := options.FindOne().SetSort(bson.D{{Key: FriendReqFieldCreateTime, Value: -1}})
+	var r FriendRequest
+	err := sess.Collection().FindOne(ctx, filter, opts).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// RefreshPendingRequest from -> to 已有待处理申请时更新留言并顺延有效期，返回更新后的申请；没有返回 nil
+func (sess *FriendRequest) RefreshPendingRequest(ctx context.Context, tenantID, fromUserID, toUserID string, set bson.M, now time.Time) (*FriendRequest, error) {
+	filter := friendReqPendingFilter(tenantID, now)
+	filter[FriendReqFieldFromUserID] = fromUserID
+	filter[FriendReqFieldToUserID] = toUserID
+
+	set[FriendReqFieldUpdateTime] = now
+	set[FriendReqFieldIsRead] = false
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: FriendReqFieldCreateTime, Value: -1}}).
+		SetReturnDocument(options.After)
+	var r FriendRequest
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// HandleFriendRequest 处理一条待处理的申请（只有接收方能处理），返回处理后的申请；已处理/撤回/过期返回 nil
+func (sess *FriendRequest) HandleFriendRequest(ctx context.Context, tenantID, requestID, handlerUserID string, result int32, handleMsg string, now time.Time) (*FriendRequest, error) {
+	filter := friendReqPendingFilter(tenantID, now)
+	filter[FriendReqFieldRequestID] = requestID
+	filter[FriendReqFieldToUserID] = handlerUserID
+
+	update := bson.M{"$set": bson.M{
+		FriendReqFieldHandleResult:  result,
+		FriendReqFieldHandlerUserID: handlerUserID,
+		FriendReqFieldHandleMsg:     handleMsg,
+		FriendReqFieldHandleTime:    now,
+		FriendReqFieldUpdateTime:    now,
+		FriendReqFieldIsRead:        true,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var r FriendRequest
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// AcceptPendingBetween 双方互加时把两人之间所有待处理的申请一并标记为同意
+func (sess *FriendRequest) AcceptPendingBetween(ctx context.Context, tenantID, userA, userB string, now time.Time) error {
+	filter := friendReqPendingFilter(tenantID, now)
+	filter["$or"] = bson.A{
+		bson.M{FriendReqFieldFromUserID: userA, FriendReqFieldToUserID: userB},
+		bson.M{FriendReqFieldFromUserID: userB, FriendReqFieldToUserID: userA},
+	}
+	update := bson.M{"$set": bson.M{
+		FriendReqFieldHandleResult: FriendReqResultAccepted,
+		FriendReqFieldHandleTime:   now,
+		FriendReqFieldUpdateTime:   now,
+	}}
+	_, err := sess.Collection().UpdateMany(ctx, filter, update)
+	return err
+}
+
+// ListFriendRequests 用户收到（incoming）或发出的申请，按创建时间倒序
+func (sess *FriendRequest) ListFriendRequests(ctx context.Context, tenantID, userID string, incoming bool, limit int64) ([]*FriendRequest, error) {
+	filter := bson.M{FriendReqFieldTenantID: tenantID}
+	if incoming {
+		filter[FriendReqFieldToUserID] = userID
+	} else {
+		filter[FriendReqFieldFromUserID] = userID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: FriendReqFieldCreateTime, Value: -1}}).SetLimit(limit)
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*FriendRequest
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -1,7 +1,45 @@
 package model
 
 import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Group collection field constants
+const (
+	GroupFieldTenantID      = "tenant_id"
+	GroupFieldGroupID       = "group_id"
+	GroupFieldStatus        = "status"
+	GroupFieldGroupType     = "group_type"
+	GroupFieldRetentionDays = "retention_days"
+
+	GroupFieldGroupName              = "group_name"
+	GroupFieldFaceURL                = "face_url"
+	GroupFieldIntroduction           = "introduction"
+	GroupFieldNotification           = "notification"
+	GroupFieldNotificationUpdateTime = "notification_update_time"
+	GroupFieldNotificationUserID     = "notification_user_id"
+	GroupFieldCreatorUserID          = "creator_user_id"
+	GroupFieldUpdateTime             = "update_time"
+	GroupFieldNeedVerification       = "need_verification"
+	GroupFieldIsDiscoverable         = "is_discoverable"
+	GroupFieldIsJoinByLink           = "is_join_by_link"
+	GroupFieldInviteLinkHash         = "invite_link_hash"
+	GroupFieldVerificationQAs        = "verification_qas"
+	GroupFieldVerificationTips       = "verification_tips"
+	GroupFieldMemberCount            = "member_count"
+	GroupFieldAdminCount             = "admin_count"
+	GroupFieldDeletedAt              = "deleted_at"
+	GroupFieldMuteAll                = "mute_all"
+	GroupFieldMuteAllWhitelist       = "mute_all_whitelist"
+	GroupFieldSlowModeInterval       = "slow_mode_interval"
+	GroupFieldMediaMaxSizeMB         = "media_max_size_mb"
 )
 
 // Status
@@ -70,11 +108,12 @@ type Group struct {
 	ApplyMemberFriend int32 `bson:"apply_member_friend"` // 0=不可互加, 1=允许成员相互加好友（产品策略）
 
 	// 管理/风控（常见开关）
-	MuteAll          bool  `bson:"mute_all"`           // 全员禁言（管理员/白名单例外）
-	SlowModeInterval int32 `bson:"slow_mode_interval"` // 慢速模式：成员发言间隔(秒)，0=关闭
-	RetentionDays    int32 `bson:"retention_days"`     // 消息留存天数（0=永久）；离线清理策略配合
-	AllowAtAll       bool  `bson:"allow_at_all"`       // 是否允许 @全体 成员
-	MediaMaxSizeMB   int32 `bson:"media_max_size_mb"`  // 上传媒体大小上限
+	MuteAll          bool     `bson:"mute_all"`           // 全员禁言（管理员/白名单例外）
+	MuteAllWhitelist []string `bson:"mute_all_whitelist"` // 全员禁言时仍可发言的成员
+	SlowModeInterval int32    `bson:"slow_mode_interval"` // 慢速模式：成员发言间隔(秒)，0=关闭
+	RetentionDays    int32    `bson:"retention_days"`     // 消息留存天数（0=永久）；离线清理策略配合
+	AllowAtAll       bool     `bson:"allow_at_all"`       // 是否允许 @全体 成员
+	MediaMaxSizeMB   int32    `bson:"media_max_size_mb"`  // 上传媒体大小上限
 
 	// 统计/只读缓存（写路径维护，供展示与排序）
 	MemberCount int32 `bson:"member_count"` // 当前成员数（用于发现页/排序，异步一致可容忍轻微漂移）
@@ -89,3 +128,133 @@ type Group struct {
 	SchemaVersion int32      `bson:"schema_version"`       // 文档结构版本（灰度升级/后向兼容）
 	DeletedAt     *time.Time `bson:"deleted_at,omitempty"` // 逻辑删除/解散时间（Status=2 时有效）
 }
+
+func (sess *Group) GetTableName() string {
+	return "group"
+}
+
+func (sess *Group) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// GetGroupByID 根据 TenantID + GroupID 查询群
+func (sess *Group) GetGroupByID(ctx context.Context, tenantID, groupID string) (*Group, error) {
+	filter := bson.M{
+		GroupFieldTenantID: tenantID,
+		GroupFieldGroupID:  groupID,
+	}
+
+	var g Group
+	err := sess.Collection().FindOne(ctx, filter).Decode(&g)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil // 没找到
+		}
+		return nil, err
+	}
+	return &g, nil
+}
+
+// InsertGroup 新建群
+func (sess *Group) InsertGroup(ctx context.Context, g *Group) error {
+	_, err := sess.Collection().InsertOne(ctx, g)
+	return err
+}
+
+// UpdateGroupFields 修改正常状态的群，群不存在或不可写返回 nil
+func (sess *Group) UpdateGroupFields(ctx context.Context, tenantID, groupID string, set bson.M) (*Group, error) {
+	filter := bson.M{
+		GroupFieldTenantID: tenantID,
+		GroupFieldGroupID:  groupID,
+		GroupFieldStatus:   GroupStatusNormal,
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var g Group
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&g)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &g, nil
+}
+
+// IncGroupCounts 成员数/管理员数增量（只在成员状态真正变化后调用，保证计数不漂移）
+func (sess *Group) IncGroupCounts(ctx context.Context, tenantID, groupID string, members, admins int32) error {
+	inc := bson.M{}
+	if members != 0 {
+		inc[GroupFieldMemberCount] = members
+	}
+	if admins != 0 {
+		inc[GroupFieldAdminCount] = admins
+	}
+	if len(inc) == 0 {
+		return nil
+	}
+	filter := bson.M{
+		GroupFieldTenantID: tenantID,
+		GroupFieldGroupID:  groupID,
+	}
+	_, err := sess.Collection().UpdateOne(ctx, filter, bson.M{"$inc": inc, "$set": bson.M{GroupFieldUpdateTime: time.Now()}})
+	return err
+}
+
+// SetGroupStatus 群状态从 from 切到 to（冻结/解冻），状态已变返回 false
+func (sess *Group) SetGroupStatus(ctx context.Context, tenantID, groupID string, from, to int32, now time.Time) (bool, error) {
+	filter := bson.M{
+		GroupFieldTenantID: tenantID,
+		GroupFieldGroupID:  groupID,
+		GroupFieldStatus:   from,
+	}
+	update := bson.M{"$set": bson.M{
+		GroupFieldStatus:     to,
+		GroupFieldUpdateTime: now,
+	}}
+	res, err := sess.Collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// DismissGroup 解散（逻辑删除），已解散的返回 false
+func (sess *Group) DismissGroup(ctx context.Context, tenantID, groupID string, now time.Time) (bool, error) {
+	filter := bson.M{
+		GroupFieldTenantID: tenantID,
+		GroupFieldGroupID:  groupID,
+		GroupFieldStatus:   bson.M{"$ne": GroupStatusDismiss},
+	}
+	update := bson.M{"$set": bson.M{
+		GroupFieldStatus:     GroupStatusDismiss,
+		GroupFieldDeletedAt:  now,
+		GroupFieldUpdateTime: now,
+	}}
+	res, err := sess.Collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// ListGroupsByType 批量查询指定类型、未解散的群
+func (sess *Group) ListGroupsByType(ctx context.Context, tenantID string, groupIDs []string, groupType int32) ([]*Group, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		GroupFieldTenantID:  tenantID,
+		GroupFieldGroupID:   bson.M{"$in": groupIDs},
+		GroupFieldGroupType: groupType,
+		GroupFieldStatus:    bson.M{"$ne": GroupStatusDismiss},
+	}
+	cur, err := sess.Collection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*Group
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
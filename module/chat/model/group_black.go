@@ -1,6 +1,42 @@
 package model
 
-import "time"
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupBlack collection field constants
+const (
+	GroupBlackFieldTenantID      = "tenant_id"
+	GroupBlackFieldGroupID       = "group_id"
+	GroupBlackFieldBlockUserID   = "block_user_id"
+	GroupBlackFieldCreateTime    = "create_time"
+	GroupBlackFieldExpireTime    = "expire_time"
+	GroupBlackFieldStatus        = "status"
+	GroupBlackFieldUnblockTime   = "unblock_time"
+	GroupBlackFieldUnblockUserID = "unblock_user_id"
+	GroupBlackFieldUpdateTime    = "update_time"
+)
+
+// Status
+const (
+	GroupBlackStatusActive  int32 = 0
+	GroupBlackStatusLifted  int32 = 1
+	GroupBlackStatusExpired int32 = 2
+)
+
+// BanType
+const (
+	GroupBanJoin  int32 = 0 // 移出并禁止再入群
+	GroupBanSpeak int32 = 1 // 留在群里但不能发言
+	GroupBanBoth  int32 = 2
+)
 
 // GroupBlack 表示群组黑名单记录。
 // 一条记录对应“某个群组”里“某个被拉黑用户”的封禁状态。
@@ -31,3 +67,93 @@ type GroupBlack struct {
 
 	Ex string `bson:"ex"` // 预留扩展字段（JSON，可存客户端设备信息/来源等）
 }
+
+func (sess *GroupBlack) GetTableName() string {
+	return "group_black"
+}
+
+func (sess *GroupBlack) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// BlocksJoin 是否禁止入群
+func (sess *GroupBlack) BlocksJoin() bool {
+	return sess.BanType == GroupBanJoin || sess.BanType == GroupBanBoth
+}
+
+// BlocksSpeak 是否禁止发言
+func (sess *GroupBlack) BlocksSpeak() bool {
+	return sess.BanType == GroupBanSpeak || sess.BanType == GroupBanBoth
+}
+
+// activeBanFilter 生效中且未过期（ExpireTime 为空=永久）
+func activeBanFilter(tenantID, groupID string, now time.Time) bson.M {
+	return bson.M{
+		GroupBlackFieldTenantID: tenantID,
+		GroupBlackFieldGroupID:  groupID,
+		GroupBlackFieldStatus:   GroupBlackStatusActive,
+		"$or": bson.A{
+			bson.M{GroupBlackFieldExpireTime: bson.M{"$exists": false}},
+			bson.M{GroupBlackFieldExpireTime: bson.M{"$gt": now}},
+		},
+	}
+}
+
+// BanGroupUser 写入/覆盖某人在群里的封禁记录（每人一条，重复封禁以最新为准）
+func (sess *GroupBlack) BanGroupUser(ctx context.Context, b *GroupBlack) error {
+	filter := bson.M{
+		GroupBlackFieldTenantID:    b.TenantID,
+		GroupBlackFieldGroupID:     b.GroupID,
+		GroupBlackFieldBlockUserID: b.BlockUserID,
+	}
+	_, err := sess.Collection().ReplaceOne(ctx, filter, b, options.Replace().SetUpsert(true))
+	return err
+}
+
+// LiftGroupBan 解除封禁，没有生效中的封禁返回 nil
+func (sess *GroupBlack) LiftGroupBan(ctx context.Context, tenantID, groupID, userID, operatorUserID string, now time.Time) (*GroupBlack, error) {
+	filter := activeBanFilter(tenantID, groupID, now)
+	filter[GroupBlackFieldBlockUserID] = userID
+	update := bson.M{"$set": bson.M{
+		GroupBlackFieldStatus:        GroupBlackStatusLifted,
+		GroupBlackFieldUnblockTime:   now,
+		GroupBlackFieldUnblockUserID: operatorUserID,
+		GroupBlackFieldUpdateTime:    now,
+	}}
+	var b GroupBlack
+	if err := sess.Collection().FindOneAndUpdate(ctx, filter, update).Decode(&b); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetActiveBan 某人在群里生效中的封禁，没有返回 nil
+func (sess *GroupBlack) GetActiveBan(ctx context.Context, tenantID, groupID, userID string, now time.Time) (*GroupBlack, error) {
+	filter := activeBanFilter(tenantID, groupID, now)
+	filter[GroupBlackFieldBlockUserID] = userID
+	var b GroupBlack
+	if err := sess.Collection().FindOne(ctx, filter).Decode(&b); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListActiveBans 群里生效中的封禁，按封禁时间倒序
+func (sess *GroupBlack) ListActiveBans(ctx context.Context, tenantID, groupID string, now time.Time, limit int64) ([]*GroupBlack, error) {
+	opts := options.Find().SetSort(bson.D{{Key: GroupBlackFieldCreateTime, Value: -1}}).SetLimit(limit)
+	cur, err := sess.Collection().Find(ctx, activeBanFilter(tenantID, groupID, now), opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*GroupBlack
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupFanoutJob collection field constants
+const (
+	FanoutFieldID           = "_id"
+	FanoutFieldStatus       = "status"
+	FanoutFieldCursor       = "cursor"
+	FanoutFieldAttempts     = "attempts"
+	FanoutFieldLeaseUntilMS = "lease_until_ms"
+	FanoutFieldLastError    = "last_error"
+	FanoutFieldDoneAt       = "done_at"
+	FanoutFieldUpdatedAt    = "updated_at"
+)
+
+// Status
+const (
+	FanoutStatusPending int32 = 0 // 未扇出完
+	FanoutStatusDone    int32 = 1 // 所有成员都处理过
+	FanoutStatusFailed  int32 = 2 // 多次续跑失败，放弃（成员靠 SYNC 补齐）
+)
+
+// GroupFanoutJob 群消息扇出任务：和消息在同一个事务里写入，扇出按成员 user_id 分页推进 cursor
+// 执行方持有 lease_until_ms 租约，进程崩溃/后台扇出丢失时租约到期，由续跑任务从 cursor 接着扇出
+type GroupFanoutJob struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID       string             `bson:"tenant_id"`
+	GroupID        string             `bson:"group_id"`
+	ConversationID string             `bson:"conversation_id"`
+	ServerMsgID    string             `bson:"server_msg_id"`
+	Seq            int64              `bson:"seq"`
+	Key            string             `bson:"key"`   // 下发用的总线 key
+	Frame          []byte             `bson:"frame"` // 原始请求帧
+	IncludeSender  bool               `bson:"include_sender"`
+	OfflineQueue   bool               `bson:"offline_queue"`
+	Cursor         string             `bson:"cursor"` // 已处理到的最后一个成员 user_id
+	Status         int32              `bson:"status"`
+	Attempts       int32              `bson:"attempts"`
+	LeaseUntilMS   int64              `bson:"lease_until_ms"`
+	LastError      string             `bson:"last_error,omitempty"`
+	CreateTime     time.Time          `bson:"create_time"`
+	DoneAt         *time.Time         `bson:"done_at,omitempty"` // TTL 索引按这个字段清理完成的任务
+	UpdatedAt      time.Time          `bson:"updated_at"`
+}
+
+func (sess *GroupFanoutJob) GetTableName() string {
+	return "group_fanout_job"
+}
+
+func (sess *GroupFanoutJob) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// InsertGroupFanoutJob 写入扇出任务；leaseUntilMS 之前由写入方自己执行，续跑任务领不到
+func (sess *GroupFanoutJob) InsertGroupFanoutJob(ctx context.Context, job *GroupFanoutJob, leaseUntilMS int64) error {
+	now := time.Now()
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	job.Status = FanoutStatusPending
+	job.LeaseUntilMS = leaseUntilMS
+	job.CreateTime = now
+	job.UpdatedAt = now
+	_, err := sess.Collection().InsertOne(ctx, job)
+	return err
+}
+
+// ClaimGroupFanoutJob 领取一个租约已过期的未完成任务，租约推到 leaseUntilMS
+func (sess *GroupFanoutJob) ClaimGroupFanoutJob(ctx context.Context, nowMS, leaseUntilMS int64) (*GroupFanoutJob, error) {
+	filter := bson.M{
+		FanoutFieldStatus:       FanoutStatusPending,
+		FanoutFieldLeaseUntilMS: bson.M{"$lte": nowMS},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			FanoutFieldLeaseUntilMS: leaseUntilMS,
+			FanoutFieldUpdatedAt:    time.Now(),
+		},
+		"$inc": bson.M{FanoutFieldAttempts: int32(1)},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: FanoutFieldLeaseUntilMS, Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job GroupFanoutJob
+	if err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&job); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// SaveGroupFanoutCursor 一批成员处理完：记下 cursor 并续租
+func (sess *GroupFanoutJob) SaveGroupFanoutCursor(ctx context.Context, id primitive.ObjectID, cursor string, leaseUntilMS int64) error {
+	_, err := sess.Collection().UpdateOne(ctx,
+		bson.M{FanoutFieldID: id, FanoutFieldStatus: FanoutStatusPending},
+		bson.M{"$set": bson.M{
+			FanoutFieldCursor:       cursor,
+			FanoutFieldLeaseUntilMS: leaseUntilMS,
+			FanoutFieldUpdatedAt:    time.Now(),
+		}})
+	return err
+}
+
+// FinishGroupFanoutJob 扇出结束；failed=true 表示放弃
+func (sess *GroupFanoutJob) FinishGroupFanoutJob(ctx context.Context, id primitive.ObjectID, lastError string, failed bool) error {
+	now := time.Now()
+	status := FanoutStatusDone
+	if failed {
+		status = FanoutStatusFailed
+	}
+	set := bson.M{
+		FanoutFieldStatus:    status,
+		FanoutFieldDoneAt:    now,
+		FanoutFieldUpdatedAt: now,
+	}
+	if lastError != "" {
+		set[FanoutFieldLastError] = lastError
+	}
+	_, err := sess.Collection().UpdateOne(ctx,
+		bson.M{FanoutFieldID: id, FanoutFieldStatus: FanoutStatusPending},
+		bson.M{"$set": set})
+	return err
+}
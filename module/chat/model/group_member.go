@@ -1,6 +1,79 @@
 package model
 
-import "time"
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupMember collection field constants
+const (
+	GroupMemberFieldTenantID = "tenant_id"
+	GroupMemberFieldGroupID  = "group_id"
+	GroupMemberFieldUserID   = "user_id"
+	GroupMemberFieldStatus   = "status"
+
+	GroupMemberFieldRoleLevel      = "role_level"
+	GroupMemberFieldIsOwner        = "is_owner"
+	GroupMemberFieldIsAdmin        = "is_admin"
+	GroupMemberFieldPermissionMask = "permission_mask"
+	GroupMemberFieldOperatorUserID = "operator_user_id"
+	GroupMemberFieldUpdateTime     = "update_time"
+	GroupMemberFieldQuitTime       = "quit_time"
+	GroupMemberFieldMuteEndTime    = "mute_end_time"
+	GroupMemberFieldIsBanned       = "is_banned"
+	GroupMemberFieldBanReason      = "ban_reason"
+	GroupMemberFieldRoles          = "roles"
+	GroupMemberFieldLastReadSeq    = "last_read_seq"
+)
+
+// Status
+const (
+	GroupMemberStatusNormal int32 = 0
+	GroupMemberStatusQuit   int32 = 1
+	GroupMemberStatusKicked int32 = 2
+	GroupMemberStatusDenied int32 = 3
+)
+
+// RoleLevel
+const (
+	RoleLevelMember int32 = 0
+	RoleLevelAdmin  int32 = 1
+	RoleLevelOwner  int32 = 2
+)
+
+// Roles 里的内置角色
+const (
+	GroupRolePublisher = "publisher" // 频道发布者：非管理员也可以在频道里发消息
+)
+
+// JoinSource
+const (
+	GroupJoinSourceLink    int32 = 1 // 邀请链接
+	GroupJoinSourceSearch  int32 = 2 // 搜索申请
+	GroupJoinSourceQRCode  int32 = 3 // 扫码
+	GroupJoinSourceInvited int32 = 4 // 管理员拉入
+)
+
+// PermissionMask 管理员的细粒度权限位；群主拥有全部权限
+const (
+	GroupPermEditInfo   int64 = 1 << 0 // 改群资料/公告
+	GroupPermInvite     int64 = 1 << 1 // 拉人入群
+	GroupPermKick       int64 = 1 << 2 // 踢人
+	GroupPermMute       int64 = 1 << 3 // 禁言成员
+	GroupPermApprove    int64 = 1 << 4 // 审批入群申请
+	GroupPermAtAll      int64 = 1 << 5 // @全体
+	GroupPermInviteLink int64 = 1 << 6 // 管理邀请链接
+
+	GroupPermAdminDefault = GroupPermEditInfo | GroupPermInvite | GroupPermKick | GroupPermMute |
+		GroupPermApprove | GroupPermAtAll | GroupPermInviteLink
+)
 
 // GroupMember 表示群内的单个成员记录。
 // 一条记录对应一个群 + 一个用户。
@@ -55,3 +128,318 @@ type GroupMember struct {
 	IPAddress string `bson:"ip_address"` // 加入/操作时的IP（风控）
 
 }
+
+func (sess *GroupMember) GetTableName() string {
+	return "group_member"
+}
+
+func (sess *GroupMember) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// GetGroupMember 查询群内某个成员
+func (sess *GroupMember) GetGroupMember(ctx context.Context, tenantID, groupID, userID string) (*GroupMember, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldUserID:   userID,
+	}
+
+	var m GroupMember
+	err := sess.Collection().FindOne(ctx, filter).Decode(&m)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil // 没找到
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// IsManager 群主或管理员
+func (sess *GroupMember) IsManager() bool {
+	return sess.IsOwner || sess.IsAdmin || sess.RoleLevel == RoleLevelAdmin || sess.RoleLevel == RoleLevelOwner
+}
+
+// HasPermission 群主全部放行；管理员按 PermissionMask，老数据没有掩码的管理员按默认权限
+func (sess *GroupMember) HasPermission(perm int64) bool {
+	if sess.Status != GroupMemberStatusNormal {
+		return false
+	}
+	if sess.IsOwner || sess.RoleLevel == RoleLevelOwner {
+		return true
+	}
+	if !sess.IsAdmin && sess.RoleLevel != RoleLevelAdmin {
+		return false
+	}
+	mask := sess.PermissionMask
+	if mask == 0 {
+		mask = GroupPermAdminDefault
+	}
+	return mask&perm == perm
+}
+
+// IsMuted 当前是否处于禁言期
+func (sess *GroupMember) IsMuted(now time.Time) bool {
+	return !sess.MuteEndTime.IsZero() && sess.MuteEndTime.After(now)
+}
+
+// ListGroupMemberIDs 按 user_id 升序分页拉取正常状态的成员ID；afterUserID 为上一页最后一个
+func (sess *GroupMember) ListGroupMemberIDs(ctx context.Context, tenantID, groupID, afterUserID string, limit int64) ([]string, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	if afterUserID != "" {
+		filter[GroupMemberFieldUserID] = bson.M{"$gt": afterUserID}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: GroupMemberFieldUserID, Value: 1}}).
+		SetProjection(bson.M{GroupMemberFieldUserID: 1}).
+		SetLimit(limit)
+
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		UserID string `bson:"user_id"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.UserID)
+	}
+	return ids, nil
+}
+
+// FilterGroupMemberIDs 从 userIDs 里筛出群里的正常成员（一次 $in 查询）
+func (sess *GroupMember) FilterGroupMemberIDs(ctx context.Context, tenantID, groupID string, userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldUserID:   bson.M{"$in": userIDs},
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	cur, err := sess.Collection().Find(ctx, filter, options.Find().SetProjection(bson.M{GroupMemberFieldUserID: 1}))
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		UserID string `bson:"user_id"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.UserID)
+	}
+	return ids, nil
+}
+
+// AddGroupMember 加入/重新加入群：没有记录或已退出/被踢的写成正常成员；已经是正常成员返回 false
+func (sess *GroupMember) AddGroupMember(ctx context.Context, m *GroupMember) (bool, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: m.TenantID,
+		GroupMemberFieldGroupID:  m.GroupID,
+		GroupMemberFieldUserID:   m.UserID,
+		GroupMemberFieldStatus:   bson.M{"$ne": GroupMemberStatusNormal},
+	}
+	m.Status = GroupMemberStatusNormal
+	_, err := sess.Collection().ReplaceOne(ctx, filter, m, options.Replace().SetUpsert(true))
+	if err != nil {
+		// 正常成员的记录不匹配 filter，upsert 撞上唯一索引
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveGroupMember 退群/踢人：正常成员改成 status，返回修改前的记录；本来就不是成员返回 nil
+func (sess *GroupMember) RemoveGroupMember(ctx context.Context, tenantID, groupID, userID string, status int32, operatorUserID string, now time.Time) (*GroupMember, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldUserID:   userID,
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	update := bson.M{"$set": bson.M{
+		GroupMemberFieldStatus:         status,
+		GroupMemberFieldRoleLevel:      RoleLevelMember,
+		GroupMemberFieldIsOwner:        false,
+		GroupMemberFieldIsAdmin:        false,
+		GroupMemberFieldPermissionMask: int64(0),
+		GroupMemberFieldOperatorUserID: operatorUserID,
+		GroupMemberFieldQuitTime:       now,
+		GroupMemberFieldUpdateTime:     now,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	var m GroupMember
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&m)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// UpdateMemberRole 正常成员且当前角色为 fromRole 时修改角色字段，返回是否修改成功（并发下只有一个成功）
+func (sess *GroupMember) UpdateMemberRole(ctx context.Context, tenantID, groupID, userID string, fromRole int32, set bson.M) (bool, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID:  tenantID,
+		GroupMemberFieldGroupID:   groupID,
+		GroupMemberFieldUserID:    userID,
+		GroupMemberFieldStatus:    GroupMemberStatusNormal,
+		GroupMemberFieldRoleLevel: fromRole,
+	}
+	res, err := sess.Collection().UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// UpdateMemberFields 修改正常成员的字段，不是成员返回 false
+func (sess *GroupMember) UpdateMemberFields(ctx context.Context, tenantID, groupID, userID string, set bson.M) (bool, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldUserID:   userID,
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	res, err := sess.Collection().UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ListGroupMembers 按 user_id 升序分页拉取正常状态的成员；afterUserID 为上一页最后一个
+func (sess *GroupMember) ListGroupMembers(ctx context.Context, tenantID, groupID, afterUserID string, limit int64) ([]*GroupMember, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	if afterUserID != "" {
+		filter[GroupMemberFieldUserID] = bson.M{"$gt": afterUserID}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: GroupMemberFieldUserID, Value: 1}}).SetLimit(limit)
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*GroupMember
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListGroupManagerIDs 群主和管理员
+func (sess *GroupMember) ListGroupManagerIDs(ctx context.Context, tenantID, groupID string) ([]string, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID:  tenantID,
+		GroupMemberFieldGroupID:   groupID,
+		GroupMemberFieldStatus:    GroupMemberStatusNormal,
+		GroupMemberFieldRoleLevel: bson.M{"$in": bson.A{RoleLevelAdmin, RoleLevelOwner}},
+	}
+	opts := options.Find().SetProjection(bson.M{GroupMemberFieldUserID: 1})
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		UserID string `bson:"user_id"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.UserID)
+	}
+	return ids, nil
+}
+
+// IsPublisher 频道里能发消息：群主/管理员或带发布者角色
+func (sess *GroupMember) IsPublisher() bool {
+	return sess.IsManager() || slices.Contains(sess.Roles, GroupRolePublisher)
+}
+
+// SetMemberRole 给正常成员加/去掉一个角色，不是成员返回 false
+func (sess *GroupMember) SetMemberRole(ctx context.Context, tenantID, groupID, userID, role string, enable bool) (bool, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldUserID:   userID,
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	op := "$pull"
+	if enable {
+		op = "$addToSet"
+	}
+	update := bson.M{
+		op:     bson.M{GroupMemberFieldRoles: role},
+		"$set": bson.M{GroupMemberFieldUpdateTime: time.Now()},
+	}
+	res, err := sess.Collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// MarkGroupRead 推进成员的已读游标（只前进不后退），不是成员返回 false
+func (sess *GroupMember) MarkGroupRead(ctx context.Context, tenantID, groupID, userID string, seq int64) (bool, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldGroupID:  groupID,
+		GroupMemberFieldUserID:   userID,
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	update := bson.M{"$max": bson.M{GroupMemberFieldLastReadSeq: seq}}
+	res, err := sess.Collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ListUserGroups 用户以正常成员身份所在的群（只取群ID/角色/已读游标）
+func (sess *GroupMember) ListUserGroups(ctx context.Context, tenantID, userID string) ([]*GroupMember, error) {
+	filter := bson.M{
+		GroupMemberFieldTenantID: tenantID,
+		GroupMemberFieldUserID:   userID,
+		GroupMemberFieldStatus:   GroupMemberStatusNormal,
+	}
+	opts := options.Find().SetProjection(bson.M{
+		GroupMemberFieldGroupID:     1,
+		GroupMemberFieldUserID:      1,
+		GroupMemberFieldRoleLevel:   1,
+		GroupMemberFieldIsOwner:     1,
+		GroupMemberFieldIsAdmin:     1,
+		GroupMemberFieldRoles:       1,
+		GroupMemberFieldLastReadSeq: 1,
+	})
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*GroupMember
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -1,7 +1,49 @@
 package model
 
 import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupRequest collection field constants
+const (
+	GroupReqFieldTenantID      = "tenant_id"
+	GroupReqFieldUserID        = "user_id"
+	GroupReqFieldGroupID       = "group_id"
+	GroupReqFieldHandleResult  = "handle_result"
+	GroupReqFieldReqMsg        = "req_msg"
+	GroupReqFieldHandledMsg    = "handled_msg"
+	GroupReqFieldReqTime       = "req_time"
+	GroupReqFieldHandleUserID  = "handle_user_id"
+	GroupReqFieldHandledTime   = "handled_time"
+	GroupReqFieldRequestID     = "request_id"
+	GroupReqFieldStatus        = "status"
+	GroupReqFieldExpireTime    = "expire_time"
+	GroupReqFieldUpdateTime    = "update_time"
+	GroupReqFieldIsRead        = "is_read"
+	GroupReqFieldVerifyAnswers = "verify_answers"
+)
+
+// HandleResult
+const (
+	GroupReqResultPending  int32 = 0
+	GroupReqResultAccepted int32 = 1
+	GroupReqResultRejected int32 = 2
+	GroupReqResultIgnored  int32 = 3
+	GroupReqResultExpired  int32 = 4
+)
+
+// Status
+const (
+	GroupReqStatusValid   int32 = 0
+	GroupReqStatusRevoked int32 = 1
+	GroupReqStatusExpired int32 = 2
 )
 
 // GroupRequest 表示一次入群申请。
@@ -40,3 +82,114 @@ type GroupRequest struct {
 	Ex string `bson:"ex"` // 扩展字段(JSON)，可存自定义信息
 
 }
+
+func (sess *GroupRequest) GetTableName() string {
+	return "group_request"
+}
+
+func (sess *GroupRequest) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// groupReqPendingFilter 未处理、未撤回且未过期的申请
+func groupReqPendingFilter(tenantID string, now time.Time) bson.M {
+	return bson.M{
+		GroupReqFieldTenantID:     tenantID,
+		GroupReqFieldHandleResult: GroupReqResultPending,
+		GroupReqFieldStatus:       GroupReqStatusValid,
+		GroupReqFieldExpireTime:   bson.M{"$gt": now},
+	}
+}
+
+// UpsertPendingRequest 同一用户对同一个群只保留一条待处理申请：有就刷新留言/答案和有效期，没有就新建
+func (sess *GroupRequest) UpsertPendingRequest(ctx context.Context, req *GroupRequest, now time.Time) (*GroupRequest, error) {
+	filter := groupReqPendingFilter(req.TenantID, now)
+	filter[GroupReqFieldGroupID] = req.GroupID
+	filter[GroupReqFieldUserID] = req.UserID
+
+	update := bson.M{"$set": bson.M{
+		GroupReqFieldReqMsg:        req.ReqMsg,
+		GroupReqFieldVerifyAnswers: req.VerifyAnswers,
+		GroupReqFieldExpireTime:    req.ExpireTime,
+		GroupReqFieldUpdateTime:    now,
+		GroupReqFieldIsRead:        false,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var r GroupRequest
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&r)
+	if err == nil {
+		return &r, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if _, err := sess.Collection().InsertOne(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// GetGroupRequest 按 request_id 查询
+func (sess *GroupRequest) GetGroupRequest(ctx context.Context, tenantID, requestID string) (*GroupRequest, error) {
+	filter := bson.M{
+		GroupReqFieldTenantID:  tenantID,
+		GroupReqFieldRequestID: requestID,
+	}
+	var r GroupRequest
+	err := sess.Collection().FindOne(ctx, filter).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// HandleGroupRequest 审批一条待处理申请，返回处理后的申请；已处理/撤回/过期返回 nil
+func (sess *GroupRequest) HandleGroupRequest(ctx context.Context, tenantID, groupID, requestID, handlerUserID string, result int32, handledMsg string, now time.Time) (*GroupRequest, error) {
+	filter := groupReqPendingFilter(tenantID, now)
+	filter[GroupReqFieldGroupID] = groupID
+	filter[GroupReqFieldRequestID] = requestID
+
+	update := bson.M{"$set": bson.M{
+		GroupReqFieldHandleResult: result,
+		GroupReqFieldHandleUserID: handlerUserID,
+		GroupReqFieldHandledMsg:   handledMsg,
+		GroupReqFieldHandledTime:  now,
+		GroupReqFieldUpdateTime:   now,
+		GroupReqFieldIsRead:       true,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var r GroupRequest
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListGroupRequests 群的入群申请，按申请时间倒序；pendingOnly 只看待处理的
+func (sess *GroupRequest) ListGroupRequests(ctx context.Context, tenantID, groupID string, pendingOnly bool, limit int64) ([]*GroupRequest, error) {
+	filter := bson.M{
+		GroupReqFieldTenantID: tenantID,
+		GroupReqFieldGroupID:  groupID,
+	}
+	if pendingOnly {
+		filter = groupReqPendingFilter(tenantID, time.Now())
+		filter[GroupReqFieldGroupID] = groupID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: GroupReqFieldReqTime, Value: -1}}).SetLimit(limit)
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*GroupRequest
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Guild collection field constants
+const (
+	GuildFieldTenantID    = "tenant_id"
+	GuildFieldGuildID     = "guild_id"
+	GuildFieldName        = "name"
+	GuildFieldIconURL     = "icon_url"
+	GuildFieldDescription = "description"
+	GuildFieldOwnerUserID = "owner_user_id"
+	GuildFieldIsPublic    = "is_public"
+	GuildFieldStatus      = "status"
+	GuildFieldMemberCount = "member_count"
+	GuildFieldUpdateTime  = "update_time"
+	GuildFieldDeletedAt   = "deleted_at"
+)
+
+// Status
+const (
+	GuildStatusNormal  int32 = 0
+	GuildStatusDeleted int32 = 1
+)
+
+// Guild 服务器（Discord 风格）：下面挂分类/频道，成员通过角色获得权限
+// @everyone 角色的 RoleID 等于 GuildID，每个成员都隐含拥有
+type Guild struct {
+	TenantID    string `bson:"tenant_id"`     // PK
+	GuildID     string `bson:"guild_id"`      // 服务器ID
+	Name        string `bson:"name"`          // 名称
+	IconURL     string `bson:"icon_url"`      // 图标
+	Description string `bson:"description"`   // 简介
+	OwnerUserID string `bson:"owner_user_id"` // 所有者（拥有全部权限）
+	IsPublic    bool   `bson:"is_public"`     // 公开服务器：任何人可直接加入
+
+	Status      int32 `bson:"status"`       // 0=正常,1=已删除
+	MemberCount int32 `bson:"member_count"` // 成员数
+
+	CreateTime time.Time `bson:"create_time"`
+	UpdateTime time.Time `bson:"update_time"`
+	DeletedAt  time.Time `bson:"deleted_at,omitempty"`
+
+	Ex string `bson:"ex,omitempty"` // JSON 扩展
+}
+
+func (sess *Guild) GetTableName() string {
+	return "guild"
+}
+
+func (sess *Guild) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// GetGuildByID 查询服务器，不存在返回 nil
+func (sess *Guild) GetGuildByID(ctx context.Context, tenantID, guildID string) (*Guild, error) {
+	filter := bson.M{
+		GuildFieldTenantID: tenantID,
+		GuildFieldGuildID:  guildID,
+	}
+	var g Guild
+	err := sess.Collection().FindOne(ctx, filter).Decode(&g)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &g, nil
+}
+
+// InsertGuild 新建服务器
+func (sess *Guild) InsertGuild(ctx context.Context, g *Guild) error {
+	_, err := sess.Collection().InsertOne(ctx, g)
+	return err
+}
+
+// UpdateGuildFields 修改正常状态的服务器，不存在或已删除返回 nil
+func (sess *Guild) UpdateGuildFields(ctx context.Context, tenantID, guildID string, set bson.M) (*Guild, error) {
+	filter := bson.M{
+		GuildFieldTenantID: tenantID,
+		GuildFieldGuildID:  guildID,
+		GuildFieldStatus:   GuildStatusNormal,
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var g Guild
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&g)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &g, nil
+}
+
+// IncGuildMemberCount 成员数增量
+func (sess *Guild) IncGuildMemberCount(ctx context.Context, tenantID, guildID string, delta int32) error {
+	filter := bson.M{
+		GuildFieldTenantID: tenantID,
+		GuildFieldGuildID:  guildID,
+	}
+	_, err := sess.Collection().UpdateOne(ctx, filter, bson.M{
+		"$inc": bson.M{GuildFieldMemberCount: delta},
+		"$set": bson.M{GuildFieldUpdateTime: time.Now()},
+	})
+	return err
+}
+
+// DeleteGuild 删除（逻辑删除），已删除的返回 false
+func (sess *Guild) DeleteGuild(ctx context.Context, tenantID, guildID string, now time.Time) (bool, error) {
+	filter := bson.M{
+		GuildFieldTenantID: tenantID,
+		GuildFieldGuildID:  guildID,
+		GuildFieldStatus:   GuildStatusNormal,
+	}
+	res, err := sess.Collection().UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		GuildFieldStatus:     GuildStatusDeleted,
+		GuildFieldDeletedAt:  now,
+		GuildFieldUpdateTime: now,
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GuildChannel collection field constants
+const (
+	GuildChannelFieldTenantID        = "tenant_id"
+	GuildChannelFieldGuildID         = "guild_id"
+	GuildChannelFieldChannelID       = "channel_id"
+	GuildChannelFieldParentID        = "parent_id"
+	GuildChannelFieldType            = "type"
+	GuildChannelFieldName            = "name"
+	GuildChannelFieldTopic           = "topic"
+	GuildChannelFieldPosition        = "position"
+	GuildChannelFieldOverwrites      = "overwrites"
+	GuildChannelFieldPermissionsSync = "permissions_synced"
+	GuildChannelFieldStatus          = "status"
+	GuildChannelFieldUpdateTime      = "update_time"
+)
+
+// Type
+const (
+	GuildChannelTypeText     int32 = 0 // 文字频道
+	GuildChannelTypeCategory int32 = 4 // 分类（只用来分组和继承权限，不能发消息）
+	GuildChannelTypeNews     int32 = 5 // 公告频道
+)
+
+// Status
+const (
+	GuildChannelStatusNormal  int32 = 0
+	GuildChannelStatusDeleted int32 = 1
+)
+
+// OverwriteType
+const (
+	OverwriteTypeRole   int32 = 0
+	OverwriteTypeMember int32 = 1
+)
+
+// PermOverwrite 频道权限覆盖（对应 session.proto PermissionOverwrite），TargetID 为角色或用户
+type PermOverwrite struct {
+	TargetID string `bson:"target_id" json:"target_id"`
+	Type     int32  `bson:"type"      json:"type"` // 0=角色,1=成员
+	Allow    int64  `bson:"allow"     json:"allow"`
+	Deny     int64  `bson:"deny"      json:"deny"`
+}
+
+// GuildChannel 服务器下的频道/分类；消息流的会话ID为 chan:<channel_id>
+// PermissionsSynced 时使用所属分类的覆盖规则（分类改了子频道跟着变）
+type GuildChannel struct {
+	TenantID  string `bson:"tenant_id"`  // PK
+	GuildID   string `bson:"guild_id"`   // 服务器ID
+	ChannelID string `bson:"channel_id"` // 频道ID
+	ParentID  string `bson:"parent_id"`  // 所属分类，空=不在分类下
+	Type      int32  `bson:"type"`       // 0=文字,4=分类,5=公告
+	Name      string `bson:"name"`       // 名称
+	Topic     string `bson:"topic"`      // 频道主题
+	Position  int32  `bson:"position"`   // 排序
+
+	Overwrites        []PermOverwrite `bson:"overwrites"`         // 权限覆盖
+	PermissionsSynced bool            `bson:"permissions_synced"` // 跟随分类的覆盖
+
+	Status     int32     `bson:"status"` // 0=正常,1=已删除
+	CreateTime time.Time `bson:"create_time"`
+	UpdateTime time.Time `bson:"update_time"`
+}
+
+func (sess *GuildChannel) GetTableName() string {
+	return "guild_channel"
+}
+
+func (sess *GuildChannel) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// InsertChannel 新建频道/分类
+func (sess *GuildChannel) InsertChannel(ctx context.Context, c *GuildChannel) error {
+	_, err := sess.Collection().InsertOne(ctx, c)
+	return err
+}
+
+// GetChannel 按频道ID查询未删除的频道，不存在返回 nil
+func (sess *GuildChannel) GetChannel(ctx context.Context, tenantID, channelID string) (*GuildChannel, error) {
+	filter := bson.M{
+		GuildChannelFieldTenantID:  tenantID,
+		GuildChannelFieldChannelID: channelID,
+		GuildChannelFieldStatus:    GuildChannelStatusNormal,
+	}
+	var c GuildChannel
+	err := sess.Collection().FindOne(ctx, filter).Decode(&c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListChannels 服务器下未删除的频道和分类，按排序
+func (sess *GuildChannel) ListChannels(ctx context.Context, tenantID, guildID string) ([]*GuildChannel, error) {
+	filter := bson.M{
+		GuildChannelFieldTenantID: tenantID,
+		GuildChannelFieldGuildID:  guildID,
+		GuildChannelFieldStatus:   GuildChannelStatusNormal,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: GuildChannelFieldPosition, Value: 1}, {Key: GuildChannelFieldChannelID, Value: 1}})
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*GuildChannel
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateChannelFields 修改未删除的频道，不存在返回 nil
+func (sess *GuildChannel) UpdateChannelFields(ctx context.Context, tenantID, channelID string, set bson.M) (*GuildChannel, error) {
+	filter := bson.M{
+		GuildChannelFieldTenantID:  tenantID,
+		GuildChannelFieldChannelID: channelID,
+		GuildChannelFieldStatus:    GuildChannelStatusNormal,
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var c GuildChannel
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// PullRoleOverwrites 删除角色时去掉所有频道上该角色的覆盖
+func (sess *GuildChannel) PullRoleOverwrites(ctx context.Context, tenantID, guildID, roleID string) error {
+	filter := bson.M{
+		GuildChannelFieldTenantID: tenantID,
+		GuildChannelFieldGuildID:  guildID,
+	}
+	_, err := sess.Collection().UpdateMany(ctx, filter, bson.M{"$pull": bson.M{
+		GuildChannelFieldOverwrites: bson.M{"target_id": roleID, "type": OverwriteTypeRole},
+	}})
+	return err
+}
+
+// DetachChildren 删除分类时子频道移到顶层；跟随分类的子频道把分类的覆盖拷过来，权限不变
+func (sess *GuildChannel) DetachChildren(ctx context.Context, tenantID, guildID string, parent *GuildChannel, now time.Time) error {
+	filter := bson.M{
+		GuildChannelFieldTenantID:        tenantID,
+		GuildChannelFieldGuildID:         guildID,
+		GuildChannelFieldParentID:        parent.ChannelID,
+		GuildChannelFieldPermissionsSync: true,
+	}
+	overwrites := parent.Overwrites
+	if overwrites == nil {
+		overwrites = []PermOverwrite{}
+	}
+	if _, err := sess.Collection().UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		GuildChannelFieldOverwrites:      overwrites,
+		GuildChannelFieldPermissionsSync: false,
+	}}); err != nil {
+		return err
+	}
+	delete(filter, GuildChannelFieldPermissionsSync)
+	_, err := sess.Collection().UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		GuildChannelFieldParentID:   "",
+		GuildChannelFieldUpdateTime: now,
+	}})
+	return err
+}
@@ -0,0 +1,189 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GuildMember collection field constants
+const (
+	GuildMemberFieldTenantID   = "tenant_id"
+	GuildMemberFieldGuildID    = "guild_id"
+	GuildMemberFieldUserID     = "user_id"
+	GuildMemberFieldNick       = "nick"
+	GuildMemberFieldRoleIDs    = "role_ids"
+	GuildMemberFieldStatus     = "status"
+	GuildMemberFieldJoinTime   = "join_time"
+	GuildMemberFieldUpdateTime = "update_time"
+)
+
+// Status
+const (
+	GuildMemberStatusNormal int32 = 0
+	GuildMemberStatusLeft   int32 = 1
+	GuildMemberStatusKicked int32 = 2
+)
+
+// GuildMember 服务器成员；RoleIDs 不含 @everyone（所有成员隐含拥有）
+type GuildMember struct {
+	TenantID string   `bson:"tenant_id"` // PK
+	GuildID  string   `bson:"guild_id"`  // 服务器ID
+	UserID   string   `bson:"user_id"`   // 用户ID
+	Nick     string   `bson:"nick"`      // 服务器内昵称
+	RoleIDs  []string `bson:"role_ids"`  // 拥有的角色
+
+	Status     int32     `bson:"status"` // 0=正常,1=已离开,2=被踢
+	JoinTime   time.Time `bson:"join_time"`
+	UpdateTime time.Time `bson:"update_time"`
+}
+
+func (sess *GuildMember) GetTableName() string {
+	return "guild_member"
+}
+
+func (sess *GuildMember) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// GetGuildMember 查询正常成员，不是成员返回 nil
+func (sess *GuildMember) GetGuildMember(ctx context.Context, tenantID, guildID, userID string) (*GuildMember, error) {
+	filter := bson.M{
+		GuildMemberFieldTenantID: tenantID,
+		GuildMemberFieldGuildID:  guildID,
+		GuildMemberFieldUserID:   userID,
+		GuildMemberFieldStatus:   GuildMemberStatusNormal,
+	}
+	var m GuildMember
+	err := sess.Collection().FindOne(ctx, filter).Decode(&m)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// AddGuildMember 加入/重新加入：已经是正常成员返回 false
+func (sess *GuildMember) AddGuildMember(ctx context.Context, m *GuildMember) (bool, error) {
+	filter := bson.M{
+		GuildMemberFieldTenantID: m.TenantID,
+		GuildMemberFieldGuildID:  m.GuildID,
+		GuildMemberFieldUserID:   m.UserID,
+		GuildMemberFieldStatus:   bson.M{"$ne": GuildMemberStatusNormal},
+	}
+	m.Status = GuildMemberStatusNormal
+	_, err := sess.Collection().ReplaceOne(ctx, filter, m, options.Replace().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveGuildMember 离开/被踢，不是成员返回 false
+func (sess *GuildMember) RemoveGuildMember(ctx context.Context, tenantID, guildID, userID string, status int32, now time.Time) (bool, error) {
+	filter := bson.M{
+		GuildMemberFieldTenantID: tenantID,
+		GuildMemberFieldGuildID:  guildID,
+		GuildMemberFieldUserID:   userID,
+		GuildMemberFieldStatus:   GuildMemberStatusNormal,
+	}
+	res, err := sess.Collection().UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		GuildMemberFieldStatus:     status,
+		GuildMemberFieldRoleIDs:    []string{},
+		GuildMemberFieldUpdateTime: now,
+	}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// SetMemberRole 给成员加/去掉一个角色，不是成员返回 false
+func (sess *GuildMember) SetMemberRole(ctx context.Context, tenantID, guildID, userID, roleID string, enable bool) (bool, error) {
+	filter := bson.M{
+		GuildMemberFieldTenantID: tenantID,
+		GuildMemberFieldGuildID:  guildID,
+		GuildMemberFieldUserID:   userID,
+		GuildMemberFieldStatus:   GuildMemberStatusNormal,
+	}
+	op := "$pull"
+	if enable {
+		op = "$addToSet"
+	}
+	res, err := sess.Collection().UpdateOne(ctx, filter, bson.M{
+		op:     bson.M{GuildMemberFieldRoleIDs: roleID},
+		"$set": bson.M{GuildMemberFieldUpdateTime: time.Now()},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// PullRoleFromMembers 删除角色时从所有成员身上去掉
+func (sess *GuildMember) PullRoleFromMembers(ctx context.Context, tenantID, guildID, roleID string) error {
+	filter := bson.M{
+		GuildMemberFieldTenantID: tenantID,
+		GuildMemberFieldGuildID:  guildID,
+		GuildMemberFieldRoleIDs:  roleID,
+	}
+	_, err := sess.Collection().UpdateMany(ctx, filter, bson.M{"$pull": bson.M{GuildMemberFieldRoleIDs: roleID}})
+	return err
+}
+
+// ListUserGuildIDs 用户加入的服务器
+func (sess *GuildMember) ListUserGuildIDs(ctx context.Context, tenantID, userID string) ([]string, error) {
+	filter := bson.M{
+		GuildMemberFieldTenantID: tenantID,
+		GuildMemberFieldUserID:   userID,
+		GuildMemberFieldStatus:   GuildMemberStatusNormal,
+	}
+	opts := options.Find().SetProjection(bson.M{GuildMemberFieldGuildID: 1})
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		GuildID string `bson:"guild_id"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.GuildID)
+	}
+	return ids, nil
+}
+
+// ListGuildMembersByIDs 批量查询正常成员（权限计算用）
+func (sess *GuildMember) ListGuildMembersByIDs(ctx context.Context, tenantID, guildID string, userIDs []string) ([]*GuildMember, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		GuildMemberFieldTenantID: tenantID,
+		GuildMemberFieldGuildID:  guildID,
+		GuildMemberFieldUserID:   bson.M{"$in": userIDs},
+		GuildMemberFieldStatus:   GuildMemberStatusNormal,
+	}
+	cur, err := sess.Collection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*GuildMember
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GuildRole collection field constants
+const (
+	GuildRoleFieldTenantID    = "tenant_id"
+	GuildRoleFieldGuildID     = "guild_id"
+	GuildRoleFieldRoleID      = "role_id"
+	GuildRoleFieldName        = "name"
+	GuildRoleFieldColor       = "color"
+	GuildRoleFieldPermissions = "permissions"
+	GuildRoleFieldPosition    = "position"
+	GuildRoleFieldUpdateTime  = "update_time"
+)
+
+// 权限位（和 Discord 的位定义一致，便于客户端复用）
+const (
+	GuildPermCreateInvite       int64 = 1 << 0  // 创建邀请
+	GuildPermKickMembers        int64 = 1 << 1  // 踢出成员
+	GuildPermBanMembers         int64 = 1 << 2  // 封禁成员
+	GuildPermAdministrator      int64 = 1 << 3  // 管理员：拥有全部权限，无视频道覆盖
+	GuildPermManageChannels     int64 = 1 << 4  // 管理频道/分类
+	GuildPermManageGuild        int64 = 1 << 5  // 管理服务器资料
+	GuildPermAddReactions       int64 = 1 << 6  // 添加表情回应
+	GuildPermViewChannel        int64 = 1 << 10 // 查看频道（看不到的频道其余权限全部失效）
+	GuildPermSendMessages       int64 = 1 << 11 // 发消息
+	GuildPermManageMessages     int64 = 1 << 13 // 管理消息
+	GuildPermAttachFiles        int64 = 1 << 15 // 上传文件
+	GuildPermReadMessageHistory int64 = 1 << 16 // 读历史消息
+	GuildPermMentionEveryone    int64 = 1 << 17 // @全体
+	GuildPermManageRoles        int64 = 1 << 28 // 管理角色和频道权限覆盖
+
+	GuildPermAll int64 = GuildPermCreateInvite | GuildPermKickMembers | GuildPermBanMembers | GuildPermAdministrator |
+		GuildPermManageChannels | GuildPermManageGuild | GuildPermAddReactions | GuildPermViewChannel |
+		GuildPermSendMessages | GuildPermManageMessages | GuildPermAttachFiles | GuildPermReadMessageHistory |
+		GuildPermMentionEveryone | GuildPermManageRoles
+
+	// GuildPermEveryoneDefault 新建服务器时 @everyone 的权限
+	GuildPermEveryoneDefault = GuildPermCreateInvite | GuildPermAddReactions | GuildPermViewChannel |
+		GuildPermSendMessages | GuildPermAttachFiles | GuildPermReadMessageHistory
+)
+
+// GuildRole 服务器角色（对应 session.proto Role）；Position 越大层级越高，只能管理比自己低的角色
+// RoleID == GuildID 的是 @everyone，Position 固定为 0
+type GuildRole struct {
+	TenantID    string `bson:"tenant_id"`   // PK
+	GuildID     string `bson:"guild_id"`    // 服务器ID
+	RoleID      string `bson:"role_id"`     // 角色ID
+	Name        string `bson:"name"`        // 名称
+	Color       int32  `bson:"color"`       // 显示颜色（RGB）
+	Permissions int64  `bson:"permissions"` // 权限位图（GuildPerm*）
+	Position    int32  `bson:"position"`    // 层级
+
+	CreateTime time.Time `bson:"create_time"`
+	UpdateTime time.Time `bson:"update_time"`
+}
+
+func (sess *GuildRole) GetTableName() string {
+	return "guild_role"
+}
+
+func (sess *GuildRole) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// IsEveryone 是否为 @everyone
+func (sess *GuildRole) IsEveryone() bool {
+	return sess.RoleID == sess.GuildID
+}
+
+// InsertRole 新建角色
+func (sess *GuildRole) InsertRole(ctx context.Context, r *GuildRole) error {
+	_, err := sess.Collection().InsertOne(ctx, r)
+	return err
+}
+
+// GetRole 查询角色，不存在返回 nil
+func (sess *GuildRole) GetRole(ctx context.Context, tenantID, guildID, roleID string) (*GuildRole, error) {
+	filter := bson.M{
+		GuildRoleFieldTenantID: tenantID,
+		GuildRoleFieldGuildID:  guildID,
+		GuildRoleFieldRoleID:   roleID,
+	}
+	var r GuildRole
+	err := sess.Collection().FindOne(ctx, filter).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListRoles 服务器的全部角色，按层级从低到高
+func (sess *GuildRole) ListRoles(ctx context.Context, tenantID, guildID string) ([]*GuildRole, error) {
+	filter := bson.M{
+		GuildRoleFieldTenantID: tenantID,
+		GuildRoleFieldGuildID:  guildID,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: GuildRoleFieldPosition, Value: 1}, {Key: GuildRoleFieldRoleID, Value: 1}})
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*GuildRole
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateRoleFields 修改角色，不存在返回 nil
+func (sess *GuildRole) UpdateRoleFields(ctx context.Context, tenantID, guildID, roleID string, set bson.M) (*GuildRole, error) {
+	filter := bson.M{
+		GuildRoleFieldTenantID: tenantID,
+		GuildRoleFieldGuildID:  guildID,
+		GuildRoleFieldRoleID:   roleID,
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var r GuildRole
+	err := sess.Collection().FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&r)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DeleteRole 删除角色，不存在返回 false
+func (sess *GuildRole) DeleteRole(ctx context.Context, tenantID, guildID, roleID string) (bool, error) {
+	filter := bson.M{
+		GuildRoleFieldTenantID: tenantID,
+		GuildRoleFieldGuildID:  guildID,
+		GuildRoleFieldRoleID:   roleID,
+	}
+	res, err := sess.Collection().DeleteOne(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
@@ -2,8 +2,11 @@ package model
 
 import (
 	"PProject/service/mgo"
+	"context"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MentionIndex collection field constants
@@ -16,6 +19,16 @@ const (
 	MIFieldCreatedAt      = "created_at"
 )
 
+// MentionIndex Kind
+const (
+	MentionKindMention = "mention" // @某人
+	MentionKindAll     = "all"     // @全体
+	MentionKindReply   = "reply"   // 回复/引用了某人的消息
+)
+
+// AtAllTag AtTextElem.AtUserList 中表示 @全体 的占位
+const AtAllTag = "AtAllTag"
+
 // MentionIndex 存储@某人的 游标
 type MentionIndex struct {
 	TenantID       string `bson:"tenant_id"`
@@ -33,3 +46,81 @@ func (sess *MentionIndex) GetTableName() string {
 func (sess *MentionIndex) Collection() *mongo.Collection {
 	return mgo.GetDB().Collection(sess.GetTableName())
 }
+
+// InsertMentions 批量写入 @ 索引：(tenant, conv, target, seq) 唯一，已存在的不重复写
+// 返回本次新写入的目标用户（扇出续跑等重复调用时只给新写入的 @未读 +1）
+func InsertMentions(ctx context.Context, list []*MentionIndex) ([]string, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	models := make([]mongo.WriteModel, 0, len(list))
+	for _, m := range list {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				MIFieldTenantID:       m.TenantID,
+				MIFieldConversationID: m.ConversationID,
+				MIFieldTargetUserID:   m.TargetUserID,
+				MIFieldSeq:            m.Seq,
+			}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{
+				MIFieldKind:      m.Kind,
+				MIFieldCreatedAt: m.CreatedAt,
+			}}).
+			SetUpsert(true))
+	}
+	model := MentionIndex{}
+	res, err := model.Collection().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return nil, err
+	}
+	inserted := make([]string, 0, len(res.UpsertedIDs))
+	for i := range res.UpsertedIDs {
+		inserted = append(inserted, list[i].TargetUserID)
+	}
+	return inserted, nil
+}
+
+// ListUnreadMentions 查询某个用户未读的 @（跨会话，按时间倒序）；conversationID 为空表示全部会话
+func ListUnreadMentions(ctx context.Context, tenantID, userID, conversationID string, limit int64) ([]*MentionIndex, error) {
+	filter := bson.M{
+		MIFieldTenantID:     tenantID,
+		MIFieldTargetUserID: userID,
+	}
+	if conversationID != "" {
+		filter[MIFieldConversationID] = conversationID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: MIFieldCreatedAt, Value: -1}, {Key: MIFieldSeq, Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	model := MentionIndex{}
+	cur, err := model.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*MentionIndex
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ClearMentionsUpTo 已读推进到 seq 后，清理 ≤seq 的 @ 记录，返回该会话剩余未读 @ 数
+func ClearMentionsUpTo(ctx context.Context, tenantID, conversationID, userID string, seq int64) (int64, error) {
+	model := MentionIndex{}
+	base := bson.M{
+		MIFieldTenantID:       tenantID,
+		MIFieldConversationID: conversationID,
+		MIFieldTargetUserID:   userID,
+	}
+
+	del := bson.M{MIFieldSeq: bson.M{"$lte": seq}}
+	for k, v := range base {
+		del[k] = v
+	}
+	if _, err := model.Collection().DeleteMany(ctx, del); err != nil {
+		return 0, err
+	}
+	return model.Collection().CountDocuments(ctx, base)
+}
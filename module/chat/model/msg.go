@@ -10,6 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 //
@@ -24,6 +25,7 @@ const (
 	MsgFieldID               = "_id"
 	MsgFieldTenantID         = "tenant_id"
 	MsgFieldClientMsgID      = "client_msg_id"
+	MsgFieldDedupID          = "dedup_id"
 	MsgFieldServerMsgID      = "server_msg_id"
 	MsgFieldCreateTimeMS     = "create_time_ms"
 	MsgFieldSendTimeMS       = "send_time_ms"
@@ -83,6 +85,7 @@ const (
 	MsgFieldTags         = "tags"
 	MsgFieldReplyTo      = "reply_to"
 	MsgFieldIsEphemeral  = "is_ephemeral"
+	MsgFieldBurnDuration = "burn_duration"
 
 	// Rich media / automod
 	MsgFieldRich    = "rich"
@@ -90,6 +93,13 @@ const (
 
 	// Revoke info
 	MsgFieldRevoke = "revoke"
+
+	// Thread summary (root message only)
+	MsgFieldThread             = "thread"
+	MsgFieldThreadReplyCount   = "thread.reply_count"
+	MsgFieldThreadLastReplyMS  = "thread.last_reply_ms"
+	MsgFieldThreadLastReplySeq = "thread.last_reply_seq"
+	MsgFieldThreadParticipants = "thread.participants"
 )
 
 const (
@@ -314,6 +324,15 @@ type MessageEntity struct {
 	Ex     string `bson:"ex,omitempty"     json:"ex,omitempty"`     // 扩展（JSON）
 }
 
+// ThreadSummary 话题摘要，只挂在话题的根消息上
+type ThreadSummary struct {
+	ThreadID     string   `bson:"thread_id"      json:"thread_id"`
+	ReplyCount   int64    `bson:"reply_count"    json:"reply_count"`
+	LastReplyMS  int64    `bson:"last_reply_ms"  json:"last_reply_ms"`
+	LastReplySeq int64    `bson:"last_reply_seq" json:"last_reply_seq"` // 话题会话内的最新 seq
+	Participants []string `bson:"participants"   json:"participants"`   // 参与者（根消息作者 + 回复者）
+}
+
 // 离线推送配置（跨平台）
 type OfflinePushInfo struct {
 	Title string `bson:"title,omitempty" json:"title,omitempty"` // 推送标题
@@ -336,6 +355,7 @@ type MessageModel struct {
 
 	// —— 标识/时间/路由 —— //
 	ClientMsgID      string      `bson:"client_msg_id,omitempty" json:"client_msg_id,omitempty"`
+	DedupID          string      `bson:"dedup_id,omitempty"      json:"-"` // 发送帧上的幂等键（服务端代发的消息没有 client_msg_id）
 	ServerMsgID      string      `bson:"server_msg_id"           json:"server_msg_id"`
 	CreateTimeMS     int64       `bson:"create_time_ms"          json:"create_time_ms"`
 	SendTimeMS       int64       `bson:"send_time_ms"            json:"send_time_ms"`
@@ -396,6 +416,7 @@ type MessageModel struct {
 	Tags         []string `bson:"tags,omitempty"           json:"tags,omitempty"`
 	ReplyTo      string   `bson:"reply_to,omitempty"       json:"reply_to,omitempty"`
 	IsEphemeral  int      `bson:"is_ephemeral,omitempty"   json:"is_ephemeral,omitempty"`
+	BurnDuration int32    `bson:"burn_duration,omitempty"  json:"burn_duration,omitempty"` // 阅后即焚时长（秒），接收方已读后开始倒计时
 
 	// —— 富媒体复合体/自动审核 —— //
 	Rich    map[string]interface{}   `bson:"rich,omitempty"    json:"rich,omitempty"`
@@ -403,6 +424,9 @@ type MessageModel struct {
 
 	// —— 撤回信息（可选） —— //
 	Revoke *RevokeModel `bson:"revoke,omitempty" json:"revoke,omitempty"`
+
+	// —— 话题摘要（仅根消息） —— //
+	Thread *ThreadSummary `bson:"thread,omitempty" json:"thread,omitempty"`
 }
 
 func (sess *MessageModel) GetTableName() string {
@@ -446,3 +470,428 @@ func GetMessageByServerMsgID(ctx context.Context, serverMsgID string) (*MessageM
 	}
 	return &msg, nil
 }
+
+// 消息状态（与 pb.MessageData.Status 保持一致）
+const (
+	MsgStatusNormal  = 0 // 正常
+	MsgStatusRevoked = 1 // 撤回
+	MsgStatusDeleted = 2 // 删除（墓碑，只保留占位）
+	MsgStatusFailed  = 3 // 失败
+)
+
+// HistoryQuery 历史消息查询条件；由上层算好水位/留存边界后传入
+type HistoryQuery struct {
+	TenantID       string
+	ConversationID string
+
+	MinSeq     int64 // 可见的最小 seq（含），清空历史/会话水位
+	MinSendTMS int64 // 可见的最早发送时间（含），留存策略
+
+	// seq 游标模式（ByTime=false）
+	CursorSeq int64 // 游标 seq（不含）；0 表示从头/从尾开始
+
+	// 时间游标模式（ByTime=true），按 (send_time_ms, seq) 排序
+	ByTime     bool
+	CursorTMS  int64 // 游标时间（ms）；0 表示从 Before/After 边界开始
+	BeforeTMS  int64 // < ts（ms），0=不限
+	AfterTMS   int64 // > ts（ms），0=不限
+	CursorSeqT int64 // 同一毫秒内的 seq 决胜
+
+	Forward         bool // true=向新消息方向；false=向旧消息方向
+	Limit           int64
+	ContentTypes    []int32
+	IncludeDeleted  bool
+	IncludeRecalled bool
+}
+
+// ListHistoryMessages 按游标拉取历史消息；返回结果始终按 seq 升序
+func ListHistoryMessages(ctx context.Context, q *HistoryQuery) ([]*MessageModel, error) {
+	filter, sort := historyFilter(q, time.Now().UnixMilli())
+	opts := options.Find().SetSort(sort)
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+
+	model := MessageModel{}
+	cur, err := model.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*MessageModel
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	// 向旧方向翻页时是倒序查出来的，翻转成升序
+	if !q.Forward {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+	return list, nil
+}
+
+// historyFilter 历史查询的过滤条件和排序
+func historyFilter(q *HistoryQuery, nowMS int64) (bson.M, bson.D) {
+	filter := bson.M{
+		MsgFieldTenantID:       q.TenantID,
+		MsgFieldConversationID: q.ConversationID,
+		// 临时消息不进历史
+		MsgFieldIsEphemeral: bson.M{"$ne": 1},
+	}
+
+	// 状态过滤：失败的消息永远不返回，墓碑/撤回按需返回
+	excluded := []int{MsgStatusFailed}
+	if !q.IncludeDeleted {
+		excluded = append(excluded, MsgStatusDeleted)
+	}
+	if !q.IncludeRecalled {
+		excluded = append(excluded, MsgStatusRevoked)
+	}
+	filter[MsgFieldStatus] = bson.M{"$nin": excluded}
+
+	if len(q.ContentTypes) > 0 {
+		filter[MsgFieldContentType] = bson.M{"$in": q.ContentTypes}
+	}
+
+	and := bson.A{
+		// 已过期（阅后即焚/定时删除）的不返回
+		bson.M{"$or": bson.A{
+			bson.M{MsgFieldExpireAtMS: bson.M{"$exists": false}},
+			bson.M{MsgFieldExpireAtMS: 0},
+			bson.M{MsgFieldExpireAtMS: bson.M{"$gt": nowMS}},
+		}},
+	}
+
+	seqCond := bson.M{}
+	if q.MinSeq > 0 {
+		seqCond["$gte"] = q.MinSeq
+	}
+	timeCond := bson.M{}
+	if q.MinSendTMS > 0 {
+		timeCond["$gte"] = q.MinSendTMS
+	}
+
+	var sort bson.D
+	if q.ByTime {
+		if q.BeforeTMS > 0 {
+			timeCond["$lt"] = q.BeforeTMS
+		}
+		if q.AfterTMS > 0 {
+			timeCond["$gt"] = q.AfterTMS
+		}
+		if q.CursorTMS > 0 {
+			op := "$lt"
+			if q.Forward {
+				op = "$gt"
+			}
+			and = append(and, bson.M{"$or": bson.A{
+				bson.M{MsgFieldSendTimeMS: bson.M{op: q.CursorTMS}},
+				bson.M{MsgFieldSendTimeMS: q.CursorTMS, MsgFieldSeq: bson.M{op: q.CursorSeqT}},
+			}})
+		}
+		dir := -1
+		if q.Forward {
+			dir = 1
+		}
+		sort = bson.D{{Key: MsgFieldSendTimeMS, Value: dir}, {Key: MsgFieldSeq, Value: dir}}
+	} else {
+		if q.CursorSeq > 0 {
+			if q.Forward {
+				seqCond["$gt"] = q.CursorSeq
+			} else {
+				seqCond["$lt"] = q.CursorSeq
+			}
+		}
+		dir := -1
+		if q.Forward {
+			dir = 1
+		}
+		sort = bson.D{{Key: MsgFieldSeq, Value: dir}}
+	}
+
+	if len(seqCond) > 0 {
+		filter[MsgFieldSeq] = seqCond
+	}
+	if len(timeCond) > 0 {
+		filter[MsgFieldSendTimeMS] = timeCond
+	}
+	filter["$and"] = and
+	return filter, sort
+}
+
+// GetMessageByClientMsgID 在会话内按客户端消息ID查询（用于锚点定位）
+func GetMessageByClientMsgID(ctx context.Context, tenantID, conversationID, clientMsgID string) (*MessageModel, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:       tenantID,
+		MsgFieldConversationID: conversationID,
+		MsgFieldClientMsgID:    clientMsgID,
+	}
+	var msg MessageModel
+	err := model.Collection().FindOne(ctx, filter).Decode(&msg)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetMessageByDedupID 在会话内按发送帧的 dedup_id 查询（幂等兜底）
+func GetMessageByDedupID(ctx context.Context, tenantID, conversationID, dedupID string) (*MessageModel, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:       tenantID,
+		MsgFieldConversationID: conversationID,
+		MsgFieldDedupID:        dedupID,
+	}
+	var msg MessageModel
+	err := model.Collection().FindOne(ctx, filter).Decode(&msg)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetMessagesBySeqs 在会话内按 seq 批量查询
+func GetMessagesBySeqs(ctx context.Context, tenantID, conversationID string, seqs []int64) ([]*MessageModel, error) {
+	if len(seqs) == 0 {
+		return nil, nil
+	}
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:       tenantID,
+		MsgFieldConversationID: conversationID,
+		MsgFieldSeq:            bson.M{"$in": seqs},
+	}
+	cur, err := model.Collection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var list []*MessageModel
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetMessagesAtSeqs 跨会话按 (会话, seq) 批量查询，会话列表取最新一条消息用
+func GetMessagesAtSeqs(ctx context.Context, tenantID string, seqs map[string]int64) ([]*MessageModel, error) {
+	if len(seqs) == 0 {
+		return nil, nil
+	}
+	or := make(bson.A, 0, len(seqs))
+	for convID, seq := range seqs {
+		or = append(or, bson.M{MsgFieldConversationID: convID, MsgFieldSeq: seq})
+	}
+	model := MessageModel{}
+	cur, err := model.Collection().Find(ctx, bson.M{MsgFieldTenantID: tenantID, "$or": or})
+	if err != nil {
+		return nil, err
+	}
+	var list []*MessageModel
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateThreadSummary 话题有新回复时更新根消息上的摘要，返回更新后的摘要
+func UpdateThreadSummary(ctx context.Context, tenantID, rootServerMsgID, threadID string, participants []string, replySeq, replyTimeMS int64) (*ThreadSummary, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:    tenantID,
+		MsgFieldServerMsgID: rootServerMsgID,
+	}
+	update := threadSummaryUpdate(threadID, participants, replySeq, replyTimeMS)
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{MsgFieldThread: 1})
+
+	var out struct {
+		Thread *ThreadSummary `bson:"thread"`
+	}
+	if err := model.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Thread, nil
+}
+
+// threadSummaryUpdate 一条新回复对根消息摘要的更新：回复数 +1，最新回复只前移（乱序提交不回退），参与者去重
+// 和回复在同一个事务里提交，重复投递的回复插入失败时整个事务回滚，回复数不会多加
+func threadSummaryUpdate(threadID string, participants []string, replySeq, replyTimeMS int64) bson.M {
+	return bson.M{
+		"$set":      bson.M{MsgFieldThread + ".thread_id": threadID},
+		"$inc":      bson.M{MsgFieldThreadReplyCount: int64(1)},
+		"$max":      bson.M{MsgFieldThreadLastReplyMS: replyTimeMS, MsgFieldThreadLastReplySeq: replySeq},
+		"$addToSet": bson.M{MsgFieldThreadParticipants: bson.M{"$each": participants}},
+	}
+}
+
+// ListBurnPendingMessages 会话内 (afterSeq, uptoSeq] 区间里尚未开始倒计时的阅后即焚消息（reader 自己发的不算）
+func ListBurnPendingMessages(ctx context.Context, tenantID, conversationID, readerID string, afterSeq, uptoSeq int64, limit int64) ([]*MessageModel, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:       tenantID,
+		MsgFieldConversationID: conversationID,
+		MsgFieldSeq:            bson.M{"$gt": afterSeq, "$lte": uptoSeq},
+		MsgFieldSendID:         bson.M{"$ne": readerID},
+		MsgFieldBurnDuration:   bson.M{"$gt": 0},
+		MsgFieldStatus:         bson.M{"$nin": []int{MsgStatusDeleted, MsgStatusRevoked}},
+		"$or": bson.A{
+			bson.M{MsgFieldExpireAtMS: bson.M{"$exists": false}},
+			bson.M{MsgFieldExpireAtMS: 0},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: MsgFieldSeq, Value: 1}}).
+		SetProjection(bson.M{MsgFieldServerMsgID: 1, MsgFieldSeq: 1, MsgFieldBurnDuration: 1, MsgFieldConversationID: 1, MsgFieldTenantID: 1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := model.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*MessageModel
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SetMessageExpireAt 设置销毁时间；已有更早的销毁时间时不覆盖，返回是否生效
+func SetMessageExpireAt(ctx context.Context, tenantID, serverMsgID string, expireAtMS int64) (bool, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:    tenantID,
+		MsgFieldServerMsgID: serverMsgID,
+		MsgFieldStatus:      bson.M{"$ne": MsgStatusDeleted},
+		"$or": bson.A{
+			bson.M{MsgFieldExpireAtMS: bson.M{"$exists": false}},
+			bson.M{MsgFieldExpireAtMS: 0},
+			bson.M{MsgFieldExpireAtMS: bson.M{"$gt": expireAtMS}},
+		},
+	}
+	res, err := model.Collection().UpdateOne(ctx, filter, bson.M{"$set": bson.M{MsgFieldExpireAtMS: expireAtMS}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// EditMessageContent 编辑文本类消息的内容（文本/富文本/Markdown + 富内容组件）：只改 senderID 自己发的正常消息
+// edit_version +1，返回编辑后的消息；消息不存在/不是本人/已撤回删除时返回 nil
+func EditMessageContent(ctx context.Context, tenantID, serverMsgID, senderID string, content *MessageModel, editedAtMS int64) (*MessageModel, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:    tenantID,
+		MsgFieldServerMsgID: serverMsgID,
+		MsgFieldSendID:      senderID,
+		MsgFieldStatus:      MsgStatusNormal,
+	}
+	set := bson.M{
+		MsgFieldContentType: content.ContentType,
+		MsgFieldContentText: content.ContentText,
+		MsgFieldIsEdited:    1,
+		MsgFieldEditedAtMS:  editedAtMS,
+	}
+	unset := bson.M{}
+	fields := []struct {
+		name  string
+		value any
+		empty bool
+	}{
+		{MsgFieldTextElem, content.TextElem, content.TextElem == nil},
+		{MsgFieldAdvancedTextElem, content.AdvancedTextElem, content.AdvancedTextElem == nil},
+		{MsgFieldMarkdownTextElem, content.MarkdownTextElem, content.MarkdownTextElem == nil},
+		{MsgFieldRich, content.Rich, len(content.Rich) == 0},
+	}
+	for _, f := range fields {
+		if f.empty {
+			unset[f.name] = ""
+		} else {
+			set[f.name] = f.value
+		}
+	}
+	update := bson.M{
+		"$set":   set,
+		"$unset": unset,
+		"$inc":   bson.M{MsgFieldEditVersion: int32(1)},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var msg MessageModel
+	if err := model.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// TombstoneMessage 物理删除消息内容，只保留 seq 等骨架作为墓碑（保证 seq 连续）
+// 已经是墓碑或不存在时返回 nil
+func TombstoneMessage(ctx context.Context, tenantID, serverMsgID string) (*MessageModel, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldTenantID:    tenantID,
+		MsgFieldServerMsgID: serverMsgID,
+		MsgFieldStatus:      bson.M{"$ne": MsgStatusDeleted},
+	}
+	unset := bson.M{}
+	for _, f := range []string{
+		MsgFieldTextElem, MsgFieldAdvancedTextElem, MsgFieldMarkdownTextElem, MsgFieldPictureElem,
+		MsgFieldSoundElem, MsgFieldVideoElem, MsgFieldFileElem, MsgFieldLocationElem, MsgFieldCardElem,
+		MsgFieldAtTextElem, MsgFieldFaceElem, MsgFieldMergeElem, MsgFieldQuoteElem, MsgFieldCustomElem,
+		MsgFieldNotificationElem, MsgFieldContentText, MsgFieldOfflinePush, MsgFieldAttachedInfo,
+		MsgFieldEx, MsgFieldLocalEx, MsgFieldRich, MsgFieldAutoMod, MsgFieldExpireAtMS, MsgFieldBurnDuration,
+	} {
+		unset[f] = ""
+	}
+	update := bson.M{
+		"$set":   bson.M{MsgFieldStatus: MsgStatusDeleted},
+		"$unset": unset,
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var msg MessageModel
+	if err := model.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ListExpiringMessages 按 _id 分页列出设置了销毁时间、尚未销毁的消息（用于重建销毁队列）
+func ListExpiringMessages(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]*MessageModel, error) {
+	model := MessageModel{}
+	filter := bson.M{
+		MsgFieldExpireAtMS: bson.M{"$gt": 0},
+		MsgFieldStatus:     bson.M{"$ne": MsgStatusDeleted},
+	}
+	if !afterID.IsZero() {
+		filter[MsgFieldID] = bson.M{"$gt": afterID}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: MsgFieldID, Value: 1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{MsgFieldID: 1, MsgFieldTenantID: 1, MsgFieldServerMsgID: 1, MsgFieldExpireAtMS: 1})
+	cur, err := model.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*MessageModel
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
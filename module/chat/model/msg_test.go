@@ -0,0 +1,98 @@
+package model
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestHistoryFilterSeqMode(t *testing.T) {
+	// 清空历史的水位和留存边界总是生效；向旧翻按 seq 倒序取游标之前的
+	filter, sort := historyFilter(&HistoryQuery{
+		TenantID:       "t1",
+		ConversationID: "grp:g1",
+		MinSeq:         10,
+		MinSendTMS:     5000,
+		CursorSeq:      30,
+		BeforeTMS:      9999, // seq 模式下由上层清零，这里没有 ByTime 不生效
+	}, 1)
+	seq := filter[MsgFieldSeq].(bson.M)
+	if seq["$gte"] != int64(10) || seq["$lt"] != int64(30) || seq["$gt"] != nil {
+		t.Fatalf("seq cond = %v", seq)
+	}
+	if tm := filter[MsgFieldSendTimeMS].(bson.M); tm["$gte"] != int64(5000) || len(tm) != 1 {
+		t.Fatalf("time cond = %v", tm)
+	}
+	if len(sort) != 1 || sort[0].Key != MsgFieldSeq || sort[0].Value != -1 {
+		t.Fatalf("sort = %v", sort)
+	}
+
+	// 向新翻：游标之后，升序
+	filter, sort = historyFilter(&HistoryQuery{MinSeq: 10, CursorSeq: 30, Forward: true}, 1)
+	if seq := filter[MsgFieldSeq].(bson.M); seq["$gte"] != int64(10) || seq["$gt"] != int64(30) {
+		t.Fatalf("forward seq cond = %v", seq)
+	}
+	if sort[0].Value != 1 {
+		t.Fatalf("forward sort = %v", sort)
+	}
+
+	// 没有水位也没有游标时不加 seq 条件
+	filter, _ = historyFilter(&HistoryQuery{}, 1)
+	if _, ok := filter[MsgFieldSeq]; ok {
+		t.Fatalf("unexpected seq cond %v", filter[MsgFieldSeq])
+	}
+}
+
+func TestHistoryFilterTimeMode(t *testing.T) {
+	filter, sort := historyFilter(&HistoryQuery{
+		MinSeq:     10,
+		MinSendTMS: 5000,
+		ByTime:     true,
+		BeforeTMS:  9000,
+		CursorTMS:  8000,
+		CursorSeqT: 42,
+	}, 1)
+	tm := filter[MsgFieldSendTimeMS].(bson.M)
+	if tm["$gte"] != int64(5000) || tm["$lt"] != int64(9000) {
+		t.Fatalf("time cond = %v", tm)
+	}
+	// 水位在时间模式下也生效
+	if seq := filter[MsgFieldSeq].(bson.M); seq["$gte"] != int64(10) {
+		t.Fatalf("seq cond = %v", seq)
+	}
+	// (send_time_ms, seq) 组合游标：更早的毫秒，或同一毫秒里更小的 seq
+	and := filter["$and"].(bson.A)
+	if len(and) != 2 {
+		t.Fatalf("$and = %v", and)
+	}
+	or := and[1].(bson.M)["$or"].(bson.A)
+	if or[0].(bson.M)[MsgFieldSendTimeMS].(bson.M)["$lt"] != int64(8000) {
+		t.Fatalf("cursor time = %v", or[0])
+	}
+	same := or[1].(bson.M)
+	if same[MsgFieldSendTimeMS] != int64(8000) || same[MsgFieldSeq].(bson.M)["$lt"] != int64(42) {
+		t.Fatalf("cursor tie-break = %v", same)
+	}
+	if len(sort) != 2 || sort[0].Key != MsgFieldSendTimeMS || sort[1].Key != MsgFieldSeq || sort[0].Value != -1 {
+		t.Fatalf("sort = %v", sort)
+	}
+}
+
+func TestThreadSummaryUpdate(t *testing.T) {
+	u := threadSummaryUpdate("root-1", []string{"author", "replier"}, 7, 1_700_000_000_000)
+	if u["$inc"].(bson.M)[MsgFieldThreadReplyCount] != int64(1) {
+		t.Fatalf("$inc = %v", u["$inc"])
+	}
+	// 最新回复用 $max：先提交 seq 8 再提交 seq 7 也不会回退
+	max := u["$max"].(bson.M)
+	if max[MsgFieldThreadLastReplySeq] != int64(7) || max[MsgFieldThreadLastReplyMS] != int64(1_700_000_000_000) {
+		t.Fatalf("$max = %v", max)
+	}
+	each := u["$addToSet"].(bson.M)[MsgFieldThreadParticipants].(bson.M)["$each"].([]string)
+	if len(each) != 2 || each[0] != "author" || each[1] != "replier" {
+		t.Fatalf("$addToSet = %v", u["$addToSet"])
+	}
+	if u["$set"].(bson.M)[MsgFieldThread+".thread_id"] != "root-1" {
+		t.Fatalf("$set = %v", u["$set"])
+	}
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxEvent collection field constants
+const (
+	OutboxFieldID            = "_id"
+	OutboxFieldTenantID      = "tenant_id"
+	OutboxFieldAggregateID   = "aggregate_id"
+	OutboxFieldTopic         = "topic"
+	OutboxFieldKey           = "key"
+	OutboxFieldValue         = "value"
+	OutboxFieldStatus        = "status"
+	OutboxFieldAttempts      = "attempts"
+	OutboxFieldNextAttemptMS = "next_attempt_ms"
+	OutboxFieldLastError     = "last_error"
+	OutboxFieldCreateTime    = "create_time"
+	OutboxFieldSentAt        = "sent_at"
+	OutboxFieldUpdatedAt     = "updated_at"
+)
+
+// Status
+const (
+	OutboxStatusPending int32 = 0 // 待发布
+	OutboxStatusSent    int32 = 1 // 已发布到 Kafka
+	OutboxStatusFailed  int32 = 2 // 多次发布失败，放弃（需人工处理）
+)
+
+// OutboxEvent 事务性发件箱：和消息/会话在同一个 Mongo 事务里写入，提交后再发布到 Kafka
+// 发布方通过 next_attempt_ms 租约领取，领取后未完成（进程崩溃）到期可被重新领取
+type OutboxEvent struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID      string             `bson:"tenant_id"`
+	AggregateID   string             `bson:"aggregate_id"` // 关联的业务ID（server_msg_id）
+	Topic         string             `bson:"topic"`
+	Key           string             `bson:"key"`
+	Value         []byte             `bson:"value"`
+	Status        int32              `bson:"status"`
+	Attempts      int32              `bson:"attempts"`
+	NextAttemptMS int64              `bson:"next_attempt_ms"`
+	LastError     string             `bson:"last_error,omitempty"`
+	CreateTime    time.Time          `bson:"create_time"`
+	SentAt        *time.Time         `bson:"sent_at,omitempty"` // TTL 索引按这个字段清理已发布的记录
+	UpdatedAt     time.Time          `bson:"updated_at"`
+}
+
+func (sess *OutboxEvent) GetTableName() string {
+	return "msg_outbox"
+}
+
+func (sess *OutboxEvent) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// NewOutboxEvent 待发布的一条 Kafka 消息
+func NewOutboxEvent(tenantID, aggregateID, topic, key string, value []byte) *OutboxEvent {
+	return &OutboxEvent{
+		ID:          primitive.NewObjectID(),
+		TenantID:    tenantID,
+		AggregateID: aggregateID,
+		Topic:       topic,
+		Key:         key,
+		Value:       value,
+	}
+}
+
+// InsertOutboxEvents 写入发件箱；availableAtMS 之前 relay 不会领取（留给提交后的直接发布）
+func (sess *OutboxEvent) InsertOutboxEvents(ctx context.Context, events []*OutboxEvent, availableAtMS int64) error {
+	if len(events) == 0 {
+		return nil
+	}
+	now := time.Now()
+	docs := make([]any, 0, len(events))
+	for _, e := range events {
+		if e.ID.IsZero() {
+			e.ID = primitive.NewObjectID()
+		}
+		e.Status = OutboxStatusPending
+		e.NextAttemptMS = availableAtMS
+		e.CreateTime = now
+		e.UpdatedAt = now
+		docs = append(docs, e)
+	}
+	_, err := sess.Collection().InsertMany(ctx, docs)
+	return err
+}
+
+// ClaimPendingOutboxEvent 领取一条到期的待发布记录：把 next_attempt_ms 推到 leaseUntilMS，其它 relay 在此之前领不到
+func (sess *OutboxEvent) ClaimPendingOutboxEvent(ctx context.Context, nowMS, leaseUntilMS int64) (*OutboxEvent, error) {
+	filter := bson.M{
+		OutboxFieldStatus:        OutboxStatusPending,
+		OutboxFieldNextAttemptMS: bson.M{"$lte": nowMS},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			OutboxFieldNextAttemptMS: leaseUntilMS,
+			OutboxFieldUpdatedAt:     time.Now(),
+		},
+		"$inc": bson.M{OutboxFieldAttempts: int32(1)},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: OutboxFieldNextAttemptMS, Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var e OutboxEvent
+	if err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&e); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+// MarkOutboxSent 发布成功
+func (sess *OutboxEvent) MarkOutboxSent(ctx context.Context, ids ...primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	_, err := sess.Collection().UpdateMany(ctx,
+		bson.M{
+			OutboxFieldID:     bson.M{"$in": ids},
+			OutboxFieldStatus: OutboxStatusPending,
+		},
+		bson.M{"$set": bson.M{
+			OutboxFieldStatus:    OutboxStatusSent,
+			OutboxFieldSentAt:    now,
+			OutboxFieldUpdatedAt: now,
+		}})
+	return err
+}
+
+// RetryOutboxEvent 发布失败：retryAtMS 之后再试；failed=true 表示放弃
+func (sess *OutboxEvent) RetryOutboxEvent(ctx context.Context, id primitive.ObjectID, retryAtMS int64, lastError string, failed bool) error {
+	set := bson.M{
+		OutboxFieldNextAttemptMS: retryAtMS,
+		OutboxFieldLastError:     lastError,
+		OutboxFieldUpdatedAt:     time.Now(),
+	}
+	if failed {
+		set[OutboxFieldStatus] = OutboxStatusFailed
+	}
+	_, err := sess.Collection().UpdateOne(ctx,
+		bson.M{
+			OutboxFieldID:     id,
+			OutboxFieldStatus: OutboxStatusPending,
+		},
+		bson.M{"$set": set})
+	return err
+}
@@ -0,0 +1,253 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ScheduledMessage collection field constants
+const (
+	ScheduledMsgFieldID             = "_id"
+	ScheduledMsgFieldTenantID       = "tenant_id"
+	ScheduledMsgFieldScheduleID     = "schedule_id"
+	ScheduledMsgFieldOwnerUserID    = "owner_user_id"
+	ScheduledMsgFieldConversationID = "conversation_id"
+	ScheduledMsgFieldClientMsgID    = "client_msg_id"
+	ScheduledMsgFieldSendAtMS       = "send_at_ms"
+	ScheduledMsgFieldStatus         = "status"
+	ScheduledMsgFieldPayload        = "payload"
+	ScheduledMsgFieldVersion        = "version"
+	ScheduledMsgFieldAttempts       = "attempts"
+	ScheduledMsgFieldClaimedBy      = "claimed_by"
+	ScheduledMsgFieldClaimedAtMS    = "claimed_at_ms"
+	ScheduledMsgFieldServerMsgID    = "server_msg_id"
+	ScheduledMsgFieldLastError      = "last_error"
+	ScheduledMsgFieldCreateTime     = "create_time"
+	ScheduledMsgFieldUpdatedAt      = "updated_at"
+)
+
+// Status
+const (
+	ScheduledMsgStatusPending  int32 = 0 // 等待发送，可编辑/取消
+	ScheduledMsgStatusSending  int32 = 1 // 调度器已领取，正在投递
+	ScheduledMsgStatusSent     int32 = 2 // 已进入正常发送链路
+	ScheduledMsgStatusCanceled int32 = 3 // 用户取消
+	ScheduledMsgStatusFailed   int32 = 4 // 多次投递失败，放弃
+)
+
+// ScheduledMessage 定时发送的消息：到点后由数据节点的调度器注入正常的消息链路
+// client_msg_id 在创建时固定，投递重试时据此判断是否已经落库，保证只发一次
+type ScheduledMessage struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID       string             `bson:"tenant_id"`
+	ScheduleID     string             `bson:"schedule_id"`     // 对外ID
+	OwnerUserID    string             `bson:"owner_user_id"`   // 发送者
+	ConversationID string             `bson:"conversation_id"` // 目标会话
+	ClientMsgID    string             `bson:"client_msg_id"`   // 幂等键
+	SendAtMS       int64              `bson:"send_at_ms"`      // 计划发送时间
+	Status         int32              `bson:"status"`
+	Payload        []byte             `bson:"payload"` // pb.MessageData 序列化
+	Version        int64              `bson:"version"` // 每次编辑 +1
+
+	// —— 调度 —— //
+	Attempts    int32  `bson:"attempts"`
+	ClaimedBy   string `bson:"claimed_by,omitempty"`
+	ClaimedAtMS int64  `bson:"claimed_at_ms,omitempty"`
+	ServerMsgID string `bson:"server_msg_id,omitempty"` // 发出后回填
+	LastError   string `bson:"last_error,omitempty"`
+
+	CreateTime time.Time `bson:"create_time"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
+
+func (sess *ScheduledMessage) GetTableName() string {
+	return "scheduled_message"
+}
+
+func (sess *ScheduledMessage) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// InsertScheduledMessage 新建定时消息
+func (sess *ScheduledMessage) InsertScheduledMessage(ctx context.Context, m *ScheduledMessage) error {
+	now := time.Now()
+	if m.ID.IsZero() {
+		m.ID = primitive.NewObjectID()
+	}
+	m.Status = ScheduledMsgStatusPending
+	m.CreateTime = now
+	m.UpdatedAt = now
+	_, err := sess.Collection().InsertOne(ctx, m)
+	return err
+}
+
+// GetScheduledMessage 按 schedule_id 查询（只能查自己的）
+func (sess *ScheduledMessage) GetScheduledMessage(ctx context.Context, tenantID, ownerUserID, scheduleID string) (*ScheduledMessage, error) {
+	filter := bson.M{
+		ScheduledMsgFieldTenantID:    tenantID,
+		ScheduledMsgFieldOwnerUserID: ownerUserID,
+		ScheduledMsgFieldScheduleID:  scheduleID,
+	}
+	var m ScheduledMessage
+	if err := sess.Collection().FindOne(ctx, filter).Decode(&m); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListScheduledMessages 用户的定时消息，按计划发送时间升序；statuses 为空表示只看待发送的
+func (sess *ScheduledMessage) ListScheduledMessages(ctx context.Context, tenantID, ownerUserID string, statuses []int32, limit int64) ([]*ScheduledMessage, error) {
+	if len(statuses) == 0 {
+		statuses = []int32{ScheduledMsgStatusPending}
+	}
+	filter := bson.M{
+		ScheduledMsgFieldTenantID:    tenantID,
+		ScheduledMsgFieldOwnerUserID: ownerUserID,
+		ScheduledMsgFieldStatus:      bson.M{"$in": statuses},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: ScheduledMsgFieldSendAtMS, Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*ScheduledMessage
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// CountPendingScheduledMessages 用户待发送的定时消息数
+func (sess *ScheduledMessage) CountPendingScheduledMessages(ctx context.Context, tenantID, ownerUserID string) (int64, error) {
+	return sess.Collection().CountDocuments(ctx, bson.M{
+		ScheduledMsgFieldTenantID:    tenantID,
+		ScheduledMsgFieldOwnerUserID: ownerUserID,
+		ScheduledMsgFieldStatus:      ScheduledMsgStatusPending,
+	})
+}
+
+// UpdatePendingScheduledMessage 只有待发送状态才能修改；sendAtMS<=0 / payload 为空表示不改
+// 已被调度器领取或已取消时返回 nil
+func (sess *ScheduledMessage) UpdatePendingScheduledMessage(ctx context.Context, tenantID, ownerUserID, scheduleID string, sendAtMS int64, payload []byte) (*ScheduledMessage, error) {
+	filter := bson.M{
+		ScheduledMsgFieldTenantID:    tenantID,
+		ScheduledMsgFieldOwnerUserID: ownerUserID,
+		ScheduledMsgFieldScheduleID:  scheduleID,
+		ScheduledMsgFieldStatus:      ScheduledMsgStatusPending,
+	}
+	set := bson.M{ScheduledMsgFieldUpdatedAt: time.Now()}
+	if sendAtMS > 0 {
+		set[ScheduledMsgFieldSendAtMS] = sendAtMS
+	}
+	if len(payload) > 0 {
+		set[ScheduledMsgFieldPayload] = payload
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{ScheduledMsgFieldVersion: int64(1)},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var m ScheduledMessage
+	if err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&m); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// CancelScheduledMessage 取消待发送的定时消息，返回是否取消成功
+func (sess *ScheduledMessage) CancelScheduledMessage(ctx context.Context, tenantID, ownerUserID, scheduleID string) (bool, error) {
+	filter := bson.M{
+		ScheduledMsgFieldTenantID:    tenantID,
+		ScheduledMsgFieldOwnerUserID: ownerUserID,
+		ScheduledMsgFieldScheduleID:  scheduleID,
+		ScheduledMsgFieldStatus:      ScheduledMsgStatusPending,
+	}
+	update := bson.M{"$set": bson.M{
+		ScheduledMsgFieldStatus:    ScheduledMsgStatusCanceled,
+		ScheduledMsgFieldUpdatedAt: time.Now(),
+	}}
+	res, err := sess.Collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// ClaimDueScheduledMessage 领取一条到期的定时消息（pending -> sending）
+// 领取后超过 staleBeforeMS 仍未完成的（节点崩溃），视为可重新领取
+func (sess *ScheduledMessage) ClaimDueScheduledMessage(ctx context.Context, nowMS, staleBeforeMS int64, nodeID string) (*ScheduledMessage, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{
+			ScheduledMsgFieldStatus:   ScheduledMsgStatusPending,
+			ScheduledMsgFieldSendAtMS: bson.M{"$lte": nowMS},
+		},
+		bson.M{
+			ScheduledMsgFieldStatus:      ScheduledMsgStatusSending,
+			ScheduledMsgFieldClaimedAtMS: bson.M{"$lt": staleBeforeMS},
+		},
+	}}
+	update := bson.M{
+		"$set": bson.M{
+			ScheduledMsgFieldStatus:      ScheduledMsgStatusSending,
+			ScheduledMsgFieldClaimedBy:   nodeID,
+			ScheduledMsgFieldClaimedAtMS: nowMS,
+			ScheduledMsgFieldUpdatedAt:   time.Now(),
+		},
+		"$inc": bson.M{ScheduledMsgFieldAttempts: int32(1)},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: ScheduledMsgFieldSendAtMS, Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var m ScheduledMessage
+	if err := sess.Collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&m); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// FinishScheduledMessage 投递结束：sent/failed 为终态，pending 表示放回去稍后重试
+// 只有本次领取（claimed_at_ms 相同）才能结束，过期后被别的节点重新领取的不会被旧领取者覆盖
+func (sess *ScheduledMessage) FinishScheduledMessage(ctx context.Context, id primitive.ObjectID, claimedAtMS int64, status int32, serverMsgID, lastError string, retryAtMS int64) error {
+	set := bson.M{
+		ScheduledMsgFieldStatus:    status,
+		ScheduledMsgFieldUpdatedAt: time.Now(),
+	}
+	if serverMsgID != "" {
+		set[ScheduledMsgFieldServerMsgID] = serverMsgID
+	}
+	if lastError != "" {
+		set[ScheduledMsgFieldLastError] = lastError
+	}
+	if status == ScheduledMsgStatusPending && retryAtMS > 0 {
+		set[ScheduledMsgFieldSendAtMS] = retryAtMS
+	}
+	_, err := sess.Collection().UpdateOne(ctx,
+		bson.M{
+			ScheduledMsgFieldID:          id,
+			ScheduledMsgFieldStatus:      ScheduledMsgStatusSending,
+			ScheduledMsgFieldClaimedAtMS: claimedAtMS,
+		},
+		bson.M{"$set": set})
+	return err
+}
@@ -0,0 +1,227 @@
+package model
+
+import (
+	"PProject/service/mgo"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MessageSearch collection field constants
+const (
+	MSFieldID             = "_id"
+	MSFieldTenantID       = "tenant_id"
+	MSFieldConversationID = "conversation_id"
+	MSFieldSeq            = "seq"
+	MSFieldServerMsgID    = "server_msg_id"
+	MSFieldSendID         = "send_id"
+	MSFieldContentType    = "content_type"
+	MSFieldSendTimeMS     = "send_time_ms"
+	MSFieldGuildID        = "guild_id"
+	MSFieldChannelID      = "channel_id"
+	MSFieldThreadID       = "thread_id"
+	MSFieldTags           = "tags"
+	MSFieldTokens         = "tokens"
+	MSFieldText           = "text"
+	MSFieldUpdatedAtMS    = "updated_at_ms"
+)
+
+// MessageSearch 消息全文检索索引（一条消息一条记录，tenant_id + conversation_id + seq 唯一）
+// tokens 为分词结果（中文单字 + 二元组），text 为参与检索的全文，用于生成高亮摘要
+// 消息表是唯一数据源，索引可以随时从消息表重建
+type MessageSearch struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	TenantID       string             `bson:"tenant_id"`
+	ConversationID string             `bson:"conversation_id"`
+	Seq            int64              `bson:"seq"`
+	ServerMsgID    string             `bson:"server_msg_id"`
+	SendID         string             `bson:"send_id"`
+	ContentType    int32              `bson:"content_type"`
+	SendTimeMS     int64              `bson:"send_time_ms"`
+	GuildID        string             `bson:"guild_id,omitempty"`
+	ChannelID      string             `bson:"channel_id,omitempty"`
+	ThreadID       string             `bson:"thread_id,omitempty"`
+	Tags           []string           `bson:"tags,omitempty"`
+	Tokens         []string           `bson:"tokens"`
+	Text           string             `bson:"text"`
+	UpdatedAtMS    int64              `bson:"updated_at_ms"`
+}
+
+func (sess *MessageSearch) GetTableName() string {
+	return "message_search"
+}
+
+func (sess *MessageSearch) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// UpsertMessageSearch 新消息写入、编辑后覆盖
+func UpsertMessageSearch(ctx context.Context, doc *MessageSearch) error {
+	doc.UpdatedAtMS = time.Now().UnixMilli()
+	filter := bson.M{
+		MSFieldTenantID:       doc.TenantID,
+		MSFieldConversationID: doc.ConversationID,
+		MSFieldSeq:            doc.Seq,
+	}
+	update := bson.M{"$set": bson.M{
+		MSFieldServerMsgID: doc.ServerMsgID,
+		MSFieldSendID:      doc.SendID,
+		MSFieldContentType: doc.ContentType,
+		MSFieldSendTimeMS:  doc.SendTimeMS,
+		MSFieldGuildID:     doc.GuildID,
+		MSFieldChannelID:   doc.ChannelID,
+		MSFieldThreadID:    doc.ThreadID,
+		MSFieldTags:        doc.Tags,
+		MSFieldTokens:      doc.Tokens,
+		MSFieldText:        doc.Text,
+		MSFieldUpdatedAtMS: doc.UpdatedAtMS,
+	}}
+	model := MessageSearch{}
+	_, err := model.Collection().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// DeleteMessageSearch 撤回/删除/销毁后移出索引
+func DeleteMessageSearch(ctx context.Context, tenantID, conversationID string, seq int64) error {
+	model := MessageSearch{}
+	_, err := model.Collection().DeleteOne(ctx, bson.M{
+		MSFieldTenantID:       tenantID,
+		MSFieldConversationID: conversationID,
+		MSFieldSeq:            seq,
+	})
+	return err
+}
+
+// SearchScope 可检索的会话：seq >= MinSeq 的消息可见
+type SearchScope struct {
+	ConversationID string
+	MinSeq         int64
+}
+
+// SearchQuery 检索条件；结果按 send_time_ms、_id 倒序
+type SearchQuery struct {
+	TenantID     string
+	Terms        []string // 分词后的查询词，全部命中
+	Tags         []string // 全部命中
+	ContentTypes []int32
+	Scopes       []SearchScope
+	GuildID      string
+	ChannelID    string
+	ThreadID     string
+	FromMS       int64 // >=
+	ToMS         int64 // <=
+	CursorTMS    int64 // 游标：上一页最后一条
+	CursorID     primitive.ObjectID
+	Limit        int64
+}
+
+// SearchMessages 按条件查索引
+func SearchMessages(ctx context.Context, q *SearchQuery) ([]*MessageSearch, error) {
+	if len(q.Scopes) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{MSFieldTenantID: q.TenantID}
+	if len(q.Terms) > 0 {
+		filter[MSFieldTokens] = bson.M{"$all": q.Terms}
+	}
+	if len(q.Tags) > 0 {
+		filter[MSFieldTags] = bson.M{"$all": q.Tags}
+	}
+	if len(q.ContentTypes) > 0 {
+		filter[MSFieldContentType] = bson.M{"$in": q.ContentTypes}
+	}
+	if q.GuildID != "" {
+		filter[MSFieldGuildID] = q.GuildID
+	}
+	if q.ChannelID != "" {
+		filter[MSFieldChannelID] = q.ChannelID
+	}
+	if q.ThreadID != "" {
+		filter[MSFieldThreadID] = q.ThreadID
+	}
+	timeCond := bson.M{}
+	if q.FromMS > 0 {
+		timeCond["$gte"] = q.FromMS
+	}
+	if q.ToMS > 0 {
+		timeCond["$lte"] = q.ToMS
+	}
+	if len(timeCond) > 0 {
+		filter[MSFieldSendTimeMS] = timeCond
+	}
+
+	// 会话范围：没清过历史的会话合成一个 $in，其余逐个带 seq 下限
+	var plain []string
+	scopes := bson.A{}
+	for _, s := range q.Scopes {
+		if s.MinSeq <= 0 {
+			plain = append(plain, s.ConversationID)
+			continue
+		}
+		scopes = append(scopes, bson.M{
+			MSFieldConversationID: s.ConversationID,
+			MSFieldSeq:            bson.M{"$gte": s.MinSeq},
+		})
+	}
+	if len(plain) > 0 {
+		scopes = append(scopes, bson.M{MSFieldConversationID: bson.M{"$in": plain}})
+	}
+	and := bson.A{bson.M{"$or": scopes}}
+
+	if q.CursorTMS > 0 {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{MSFieldSendTimeMS: bson.M{"$lt": q.CursorTMS}},
+			bson.M{MSFieldSendTimeMS: q.CursorTMS, MSFieldID: bson.M{"$lt": q.CursorID}},
+		}})
+	}
+	filter["$and"] = and
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: MSFieldSendTimeMS, Value: -1}, {Key: MSFieldID, Value: -1}}).
+		SetProjection(bson.M{MSFieldTokens: 0})
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+
+	model := MessageSearch{}
+	cur, err := model.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []*MessageSearch
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ScanMessages 按 _id 顺序遍历消息（重建索引用）；conversationID 为空表示租户下全部消息
+func ScanMessages(ctx context.Context, tenantID, conversationID string, batchSize int32, fn func(*MessageModel) error) error {
+	filter := bson.M{MsgFieldTenantID: tenantID}
+	if conversationID != "" {
+		filter[MsgFieldConversationID] = conversationID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(batchSize)
+
+	model := MessageModel{}
+	cur, err := model.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var m MessageModel
+		if err := cur.Decode(&m); err != nil {
+			return err
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
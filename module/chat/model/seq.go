@@ -2,9 +2,13 @@ package model
 
 import (
 	"PProject/service/mgo"
+	"context"
+	"errors"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
@@ -51,3 +55,45 @@ func (sess *SeqConversation) GetTableName() string {
 func (sess *SeqConversation) Collection() *mongo.Collection {
 	return mgo.GetDB().Collection(sess.GetTableName())
 }
+
+// GetSeqConversation 查询会话级水位
+func (sess *SeqConversation) GetSeqConversation(ctx context.Context, tenantID, conversationID string) (*SeqConversation, error) {
+	filter := bson.M{
+		SeqConvFieldTenantID:       tenantID,
+		SeqConvFieldConversationID: conversationID,
+	}
+	var sc SeqConversation
+	err := sess.Collection().FindOne(ctx, filter).Decode(&sc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil // 没找到
+		}
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// ListMaxSeqs 批量查询会话的已提交水位：conversationID -> max_seq，不存在的会话不返回
+func (sess *SeqConversation) ListMaxSeqs(ctx context.Context, tenantID string, conversationIDs []string) (map[string]int64, error) {
+	out := make(map[string]int64, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return out, nil
+	}
+	filter := bson.M{
+		SeqConvFieldTenantID:       tenantID,
+		SeqConvFieldConversationID: bson.M{"$in": conversationIDs},
+	}
+	opts := options.Find().SetProjection(bson.M{SeqConvFieldConversationID: 1, SeqConvFieldMaxSeq: 1})
+	cur, err := sess.Collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rows []SeqConversation
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.ConversationID] = r.MaxSeq
+	}
+	return out, nil
+}
@@ -2,6 +2,8 @@ package seq
 
 import (
 	chatmodel "PProject/module/chat/model"
+	botmodel "PProject/module/chatBox/model"
+	usermodel "PProject/module/user/model"
 	"PProject/service/mgo"
 	"context"
 	"fmt"
@@ -15,12 +17,22 @@ import (
 
 const ConvTypeP2P int = 100
 const ConvTypeGroup int = 200
-const convTypeChannel int = 300
+const ConvTypeChannel int = 300
+const ConvTypeThread int = 400
 
 // EnsureSeqConversation 用于确保 “p2p:min_max” 这一条会话级水位存在；只维护水位和元数据
 func EnsureSeqConversation(ctx context.Context, tenantID, userA, userB string, chatType int32) (conversationID string, created bool, err error) {
 
 	conversationID = buildP2PConvID(userA, userB)
+	created, err = EnsureSeqConversationByID(ctx, tenantID, conversationID)
+	if err != nil {
+		return "", false, err
+	}
+	return conversationID, created, nil
+}
+
+// EnsureSeqConversationByID 已知会话ID（grp:xxx / thread:xxx）时确保会话级水位存在
+func EnsureSeqConversationByID(ctx context.Context, tenantID, conversationID string) (created bool, err error) {
 
 	var sc chatmodel.SeqConversation
 	c := sc.Collection() // 这里还是你项目里的 collection 取法
@@ -49,9 +61,9 @@ func EnsureSeqConversation(ctx context.Context, tenantID, userA, userB string, c
 
 	res, err := c.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
 	if err != nil {
-		return "", false, err
+		return false, err
 	}
-	return conversationID, res.UpsertedCount > 0, nil
+	return res.UpsertedCount > 0, nil
 }
 
 func UpdateMaxSeq(ctx context.Context, conversationID string, newMax int64) (int64, error) {
@@ -213,6 +225,25 @@ func EnsureIndexes(ctx context.Context) error {
 	msg := chatmodel.MessageModel{}
 	rsb := chatmodel.ReadSparseBlock{}
 	met := chatmodel.MentionIndex{}
+	grp := chatmodel.Group{}
+	gm := chatmodel.GroupMember{}
+	sm := chatmodel.ScheduledMessage{}
+	pd := usermodel.PushDevice{}
+	ob := chatmodel.OutboxEvent{}
+	gfj := chatmodel.GroupFanoutJob{}
+	ms := chatmodel.MessageSearch{}
+	fr := chatmodel.Friend{}
+	frq := chatmodel.FriendRequest{}
+	blk := chatmodel.Black{}
+	grq := chatmodel.GroupRequest{}
+	gbk := chatmodel.GroupBlack{}
+	gld := chatmodel.Guild{}
+	gdm := chatmodel.GuildMember{}
+	gdr := chatmodel.GuildRole{}
+	gdc := chatmodel.GuildChannel{}
+	bwd := chatmodel.BotWebhookDelivery{}
+	bia := chatmodel.BotInteraction{}
+	bot := botmodel.AgentBot{}
 
 	collections := map[string][]mongo.IndexModel{
 		seq.GetTableName(): {{
@@ -225,6 +256,13 @@ func EnsureIndexes(ctx context.Context) error {
 				{chatmodel.ConversationFieldOwnerUserID, 1},
 				{chatmodel.ConversationFieldConversationID, 1}},
 			Options: options.Index().SetUnique(true).SetName("uniq_user_conv"),
+		}, {
+			// 会话列表增量同步：按用户版本号翻页
+			Keys: bson.D{{chatmodel.ConversationFieldTenantID, 1},
+				{chatmodel.ConversationFieldOwnerUserID, 1},
+				{chatmodel.ConversationFieldVersion, 1},
+				{chatmodel.ConversationFieldConversationID, 1}},
+			Options: options.Index().SetName("ix_user_conv_version"),
 		}},
 		msg.GetTableName(): {
 			{
@@ -240,7 +278,54 @@ func EnsureIndexes(ctx context.Context) error {
 					{chatmodel.MsgFieldSeq, 1}},
 				Options: options.Index().SetName("ix_sender_seq"),
 			},
+			{
+				// 历史消息按时间翻页
+				Keys: bson.D{{chatmodel.MsgFieldTenantID, 1},
+					{chatmodel.MsgFieldConversationID, 1},
+					{chatmodel.MsgFieldSendTimeMS, 1},
+					{chatmodel.MsgFieldSeq, 1}},
+				Options: options.Index().SetName("ix_conv_time_seq"),
+			},
+			{
+				// 历史消息锚点定位 + 幂等兜底：同一会话内 client_msg_id 唯一
+				Keys: bson.D{{chatmodel.MsgFieldTenantID, 1},
+					{chatmodel.MsgFieldConversationID, 1},
+					{chatmodel.MsgFieldClientMsgID, 1}},
+				Options: options.Index().SetUnique(true).SetName("uniq_conv_client_msg").
+					SetPartialFilterExpression(bson.M{chatmodel.MsgFieldClientMsgID: bson.M{"$exists": true}}),
+			},
+			{
+				// 幂等兜底：同一会话内发送帧的 dedup_id 唯一
+				Keys: bson.D{{chatmodel.MsgFieldTenantID, 1},
+					{chatmodel.MsgFieldConversationID, 1},
+					{chatmodel.MsgFieldDedupID, 1}},
+				Options: options.Index().SetUnique(true).SetName("uniq_conv_dedup").
+					SetPartialFilterExpression(bson.M{chatmodel.MsgFieldDedupID: bson.M{"$exists": true}}),
+			},
+			{
+				// 定时销毁/阅后即焚：只索引设置了销毁时间的消息，用于重建销毁队列
+				Keys: bson.D{{chatmodel.MsgFieldExpireAtMS, 1}},
+				Options: options.Index().SetName("ix_expire_at").
+					SetPartialFilterExpression(bson.M{chatmodel.MsgFieldExpireAtMS: bson.M{"$gt": 0}}),
+			},
 		},
+		gm.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GroupMemberFieldTenantID, 1},
+				{chatmodel.GroupMemberFieldGroupID, 1},
+				{chatmodel.GroupMemberFieldUserID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_group_member"),
+		}, {
+			// 用户加入的群/订阅的频道
+			Keys: bson.D{{chatmodel.GroupMemberFieldTenantID, 1},
+				{chatmodel.GroupMemberFieldUserID, 1},
+				{chatmodel.GroupMemberFieldStatus, 1}},
+			Options: options.Index().SetName("ix_group_member_user"),
+		}},
+		grp.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GroupFieldTenantID, 1},
+				{chatmodel.GroupFieldGroupID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_tenant_group"),
+		}},
 		rsb.GetTableName(): {{
 			Keys: bson.D{{chatmodel.RSBFieldTenantID, 1},
 				{chatmodel.RSBFieldConversationID, 1},
@@ -253,8 +338,199 @@ func EnsureIndexes(ctx context.Context) error {
 				{chatmodel.MIFieldConversationID, 1},
 				{chatmodel.MIFieldTargetUserID, 1},
 				{chatmodel.MIFieldSeq, 1}},
-			Options: options.Index().SetName("ix_mention_range"),
+			Options: options.Index().SetUnique(true).SetName("uniq_mention_target"),
+		}, {
+			// 跨会话的未读 @ 列表
+			Keys: bson.D{{chatmodel.MIFieldTenantID, 1},
+				{chatmodel.MIFieldTargetUserID, 1},
+				{chatmodel.MIFieldCreatedAt, -1}},
+			Options: options.Index().SetName("ix_mention_user_time"),
+		}},
+		sm.GetTableName(): {{
+			Keys: bson.D{{chatmodel.ScheduledMsgFieldTenantID, 1},
+				{chatmodel.ScheduledMsgFieldScheduleID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_tenant_schedule"),
+		}, {
+			// 用户查看自己的定时消息
+			Keys: bson.D{{chatmodel.ScheduledMsgFieldTenantID, 1},
+				{chatmodel.ScheduledMsgFieldOwnerUserID, 1},
+				{chatmodel.ScheduledMsgFieldStatus, 1},
+				{chatmodel.ScheduledMsgFieldSendAtMS, 1}},
+			Options: options.Index().SetName("ix_schedule_owner"),
+		}, {
+			// 调度器领取到期项
+			Keys: bson.D{{chatmodel.ScheduledMsgFieldStatus, 1},
+				{chatmodel.ScheduledMsgFieldSendAtMS, 1}},
+			Options: options.Index().SetName("ix_schedule_due"),
+		}},
+		pd.GetTableName(): {{
+			Keys: bson.D{{usermodel.PushDeviceFieldTenantID, 1},
+				{usermodel.PushDeviceFieldUserID, 1},
+				{usermodel.PushDeviceFieldDeviceID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_push_device"),
+		}, {
+			// 通道反馈 token 失效时按 token 删除
+			Keys: bson.D{{usermodel.PushDeviceFieldTenantID, 1},
+				{usermodel.PushDeviceFieldToken, 1}},
+			Options: options.Index().SetName("ix_push_token"),
+		}},
+		ob.GetTableName(): {{
+			// relay 领取到期的待发布记录
+			Keys: bson.D{{chatmodel.OutboxFieldStatus, 1},
+				{chatmodel.OutboxFieldNextAttemptMS, 1}},
+			Options: options.Index().SetName("ix_outbox_due"),
+		}, {
+			// 已发布的记录保留 3 天后清理（未发布的没有 sent_at，不受影响）
+			Keys:    bson.D{{chatmodel.OutboxFieldSentAt, 1}},
+			Options: options.Index().SetExpireAfterSeconds(3 * 24 * 3600).SetName("ttl_outbox_sent"),
+		}},
+		gfj.GetTableName(): {{
+			// 续跑任务领取租约过期的未完成扇出
+			Keys: bson.D{{chatmodel.FanoutFieldStatus, 1},
+				{chatmodel.FanoutFieldLeaseUntilMS, 1}},
+			Options: options.Index().SetName("ix_fanout_due"),
+		}, {
+			// 结束的任务保留 1 天后清理
+			Keys:    bson.D{{chatmodel.FanoutFieldDoneAt, 1}},
+			Options: options.Index().SetExpireAfterSeconds(24 * 3600).SetName("ttl_fanout_done"),
+		}},
+		ms.GetTableName(): {{
+			Keys: bson.D{{chatmodel.MSFieldTenantID, 1},
+				{chatmodel.MSFieldConversationID, 1},
+				{chatmodel.MSFieldSeq, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_search_conv_seq"),
+		}, {
+			// 全文检索：按词命中后按时间倒序
+			Keys: bson.D{{chatmodel.MSFieldTenantID, 1},
+				{chatmodel.MSFieldTokens, 1},
+				{chatmodel.MSFieldSendTimeMS, -1}},
+			Options: options.Index().SetName("ix_search_tokens_time"),
+		}},
+		fr.GetTableName(): {{
+			Keys: bson.D{{chatmodel.FriendFieldTenantID, 1},
+				{chatmodel.FriendFieldOwnerUserID, 1},
+				{chatmodel.FriendFieldFriendUserID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_friend_owner_peer"),
+		}},
+		frq.GetTableName(): {{
+			Keys: bson.D{{chatmodel.FriendReqFieldTenantID, 1},
+				{chatmodel.FriendReqFieldRequestID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_tenant_friend_request"),
+		}, {
+			// 收到的申请
+			Keys: bson.D{{chatmodel.FriendReqFieldTenantID, 1},
+				{chatmodel.FriendReqFieldToUserID, 1},
+				{chatmodel.FriendReqFieldCreateTime, -1}},
+			Options: options.Index().SetName("ix_friend_request_to"),
+		}, {
+			// 发出的申请 + 两人之间的待处理申请
+			Keys: bson.D{{chatmodel.FriendReqFieldTenantID, 1},
+				{chatmodel.FriendReqFieldFromUserID, 1},
+				{chatmodel.FriendReqFieldToUserID, 1},
+				{chatmodel.FriendReqFieldCreateTime, -1}},
+			Options: options.Index().SetName("ix_friend_request_from"),
+		}},
+		blk.GetTableName(): {{
+			Keys: bson.D{{chatmodel.BlackFieldTenantID, 1},
+				{chatmodel.BlackFieldOwnerUserID, 1},
+				{chatmodel.BlackFieldBlockUserID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_black_owner_peer"),
+		}},
+		grq.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GroupReqFieldTenantID, 1},
+				{chatmodel.GroupReqFieldRequestID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_tenant_group_request"),
+		}, {
+			// 群的申请列表 + 某人对某群的待处理申请
+			Keys: bson.D{{chatmodel.GroupReqFieldTenantID, 1},
+				{chatmodel.GroupReqFieldGroupID, 1},
+				{chatmodel.GroupReqFieldUserID, 1},
+				{chatmodel.GroupReqFieldReqTime, -1}},
+			Options: options.Index().SetName("ix_group_request_group_user"),
+		}, {
+			Keys: bson.D{{chatmodel.GroupReqFieldTenantID, 1},
+				{chatmodel.GroupReqFieldGroupID, 1},
+				{chatmodel.GroupReqFieldReqTime, -1}},
+			Options: options.Index().SetName("ix_group_request_group_time"),
+		}},
+		gbk.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GroupBlackFieldTenantID, 1},
+				{chatmodel.GroupBlackFieldGroupID, 1},
+				{chatmodel.GroupBlackFieldBlockUserID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_group_black_user"),
+		}, {
+			Keys: bson.D{{chatmodel.GroupBlackFieldTenantID, 1},
+				{chatmodel.GroupBlackFieldGroupID, 1},
+				{chatmodel.GroupBlackFieldCreateTime, -1}},
+			Options: options.Index().SetName("ix_group_black_group_time"),
 		}},
+		gld.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GuildFieldTenantID, 1},
+				{chatmodel.GuildFieldGuildID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_tenant_guild"),
+		}},
+		gdm.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GuildMemberFieldTenantID, 1},
+				{chatmodel.GuildMemberFieldGuildID, 1},
+				{chatmodel.GuildMemberFieldUserID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_guild_member"),
+		}, {
+			// 用户加入的服务器
+			Keys: bson.D{{chatmodel.GuildMemberFieldTenantID, 1},
+				{chatmodel.GuildMemberFieldUserID, 1},
+				{chatmodel.GuildMemberFieldStatus, 1}},
+			Options: options.Index().SetName("ix_guild_member_user"),
+		}},
+		gdr.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GuildRoleFieldTenantID, 1},
+				{chatmodel.GuildRoleFieldGuildID, 1},
+				{chatmodel.GuildRoleFieldRoleID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_guild_role"),
+		}},
+		gdc.GetTableName(): {{
+			Keys: bson.D{{chatmodel.GuildChannelFieldTenantID, 1},
+				{chatmodel.GuildChannelFieldChannelID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_guild_channel"),
+		}, {
+			Keys: bson.D{{chatmodel.GuildChannelFieldTenantID, 1},
+				{chatmodel.GuildChannelFieldGuildID, 1},
+				{chatmodel.GuildChannelFieldPosition, 1}},
+			Options: options.Index().SetName("ix_guild_channel_position"),
+		}},
+		bwd.GetTableName(): {{
+			// 投递器领取到期的待投递事件
+			Keys: bson.D{{chatmodel.BotWebhookFieldStatus, 1},
+				{chatmodel.BotWebhookFieldNextAttemptMS, 1}},
+			Options: options.Index().SetName("ix_bot_webhook_due"),
+		}, {
+			// 已投递的事件保留 3 天后清理
+			Keys:    bson.D{{chatmodel.BotWebhookFieldSentAt, 1}},
+			Options: options.Index().SetExpireAfterSeconds(3 * 24 * 3600).SetName("ttl_bot_webhook_sent"),
+		}},
+		bia.GetTableName(): {{
+			Keys: bson.D{{chatmodel.BotInteractionFieldTenantID, 1},
+				{chatmodel.BotInteractionFieldInteractionID, 1}},
+			Options: options.Index().SetUnique(true).SetName("uniq_tenant_interaction"),
+		}, {
+			// 过期即删
+			Keys:    bson.D{{chatmodel.BotInteractionFieldExpireAt, 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("ttl_interaction_expire"),
+		}},
+		bot.GetTableName(): {{
+			// 按机器人账号鉴权/查找
+			Keys: bson.D{{botmodel.BotFieldTenantID, 1},
+				{botmodel.BotFieldUserID, 1}},
+			Options: options.Index().SetName("ix_bot_user"),
+		}, {
+			Keys: bson.D{{botmodel.BotFieldTenantID, 1},
+				{botmodel.BotFieldOwnerUserID, 1}},
+			Options: options.Index().SetName("ix_bot_owner"),
+		}},
+	}
+
+	// 被替换掉的旧索引（同样的键，换成了唯一索引）
+	legacy := map[string][]string{
+		met.GetTableName(): {"ix_mention_range"},
 	}
 
 	for collName, indexes := range collections {
@@ -269,6 +545,13 @@ func EnsureIndexes(ctx context.Context) error {
 		for _, spec := range existing {
 			existingNames[spec.Name] = struct{}{}
 		}
+		for _, name := range legacy[collName] {
+			if _, ok := existingNames[name]; ok {
+				if _, err := coll.Indexes().DropOne(ctx, name); err != nil {
+					return fmt.Errorf("drop index %s on %s: %w", name, collName, err)
+				}
+			}
+		}
 
 		// 只创建不存在的
 		for _, idx := range indexes {
@@ -0,0 +1,40 @@
+package seq
+
+import (
+	redis2 "PProject/service/storage/redis"
+	"strconv"
+)
+
+// 内存 Redis 下 luaInSegment / luaSetSegment 的等价实现（单进程开发模式）
+func init() {
+	redis2.RegisterScript(luaInSegment, func(c *redis2.ScriptCall) any {
+		k := c.Keys[0]
+		need, segEnd, nowms := c.ArgInt(0), c.ArgInt(1), c.ArgInt(2)
+
+		currS, ok1 := c.Call("HGET", k, "curr").(string)
+		endS, ok2 := c.Call("HGET", k, "end").(string)
+		if !ok1 || !ok2 {
+			return []any{1}
+		}
+		curr, _ := strconv.ParseInt(currS, 10, 64)
+		endv, _ := strconv.ParseInt(endS, 10, 64)
+
+		if segEnd != 0 && segEnd != endv {
+			return []any{3, curr, endv, 0, nowms}
+		}
+		start := curr + 1
+		newv := curr + need
+		if newv > endv {
+			return []any{3, curr, endv, 0, nowms}
+		}
+		c.Call("HSET", k, "curr", newv, "mill", nowms)
+		return []any{0, start, 0, endv, nowms}
+	})
+
+	redis2.RegisterScript(luaSetSegment, func(c *redis2.ScriptCall) any {
+		k := c.Keys[0]
+		c.Call("HSET", k, "curr", c.ArgInt(0), "end", c.ArgInt(1), "mill", c.ArgInt(2))
+		c.Call("PEXPIRE", k, 3600000)
+		return 1
+	})
+}
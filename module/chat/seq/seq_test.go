@@ -0,0 +1,118 @@
+package seq
+
+import (
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"sync"
+	"testing"
+)
+
+type fakeSegDAO struct {
+	mu   sync.Mutex
+	next map[string]int64
+}
+
+func (d *fakeSegDAO) AllocSegment(_ context.Context, tenantID, conversationID string, block int64) (int64, int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := tenantID + ":" + conversationID
+	start := d.next[k] + 1
+	d.next[k] = start + block - 1
+	return start, d.next[k], nil
+}
+
+func TestAllocatorOnMemoryRedis(t *testing.T) {
+	srv, err := redis2.StartMemoryServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	rdb := srv.NewClient()
+	defer rdb.Close()
+
+	alloc := &Allocator{
+		Rdb:         rdb,
+		DAO:         &fakeSegDAO{next: map[string]int64{}},
+		BlockSizeFn: func(string, string, int64) int64 { return 4 },
+	}
+	ctx := context.Background()
+	// 跨越多个段，seq 仍然连续
+	for want := int64(1); want <= 10; want++ {
+		got, _, err := alloc.Malloc(ctx, "t1", "c1", 1)
+		if err != nil {
+			t.Fatalf("malloc: %v", err)
+		}
+		if got != want {
+			t.Fatalf("seq = %d, want %d", got, want)
+		}
+	}
+	if got, _, _ := alloc.Malloc(ctx, "t1", "c2", 1); got != 1 {
+		t.Fatalf("other conversation starts at %d", got)
+	}
+}
+
+func TestThreadSeqIndependentOfParent(t *testing.T) {
+	srv, err := redis2.StartMemoryServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	rdb := srv.NewClient()
+	defer rdb.Close()
+
+	alloc := &Allocator{
+		Rdb:         rdb,
+		DAO:         &fakeSegDAO{next: map[string]int64{}},
+		BlockSizeFn: func(string, string, int64) int64 { return 8 },
+	}
+	ctx := context.Background()
+	parent, thread := GroupConvID("g1"), ThreadConvID("root-1")
+	if tid, ok := ThreadIDOf(thread); !ok || tid != "root-1" {
+		t.Fatalf("ThreadIDOf(%s) = %s, %v", thread, tid, ok)
+	}
+	if _, ok := ThreadIDOf(parent); ok {
+		t.Fatal("group conversation parsed as thread")
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := alloc.Malloc(ctx, "t1", parent, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 话题有自己的 seq，从 1 开始，不占父会话的号
+	if got, _, _ := alloc.Malloc(ctx, "t1", thread, 1); got != 1 {
+		t.Fatalf("first thread seq = %d", got)
+	}
+	if got, _, _ := alloc.Malloc(ctx, "t1", parent, 1); got != 6 {
+		t.Fatalf("parent seq = %d, want 6", got)
+	}
+
+	// 并发回复：号不重复（并发回源领段时可能跳号）
+	var (
+		mu   sync.Mutex
+		seen = map[int64]bool{1: true}
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, _, err := alloc.Malloc(ctx, "t1", thread, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[got] {
+				t.Errorf("thread seq %d issued twice", got)
+			}
+			seen[got] = true
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 21 {
+		t.Fatalf("issued %d distinct thread seqs", len(seen))
+	}
+}
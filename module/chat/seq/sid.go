@@ -1,6 +1,9 @@
 package seq
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // 辅助：构造会话ID
 func P2PConvID(u1, u2 string) string {
@@ -9,5 +12,12 @@ func P2PConvID(u1, u2 string) string {
 	}
 	return fmt.Sprintf("p2p:%s:%s", u2, u1)
 }
-func GroupConvID(gid string) string  { return "grp:" + gid }
-func ThreadConvID(tid string) string { return "thread:" + tid }
+func GroupConvID(gid string) string   { return "grp:" + gid }
+func ThreadConvID(tid string) string  { return "thread:" + tid }
+func ChannelConvID(cid string) string { return "chan:" + cid }
+
+// ChannelIDOf 从频道会话ID取频道ID，不是频道会话返回 false
+func ChannelIDOf(convID string) (string, bool) { return strings.CutPrefix(convID, "chan:") }
+
+// ThreadIDOf 从话题会话ID取话题ID（根消息的 server_msg_id），不是话题会话返回 false
+func ThreadIDOf(convID string) (string, bool) { return strings.CutPrefix(convID, "thread:") }
@@ -21,3 +21,8 @@ func buildP2PConvID(a, b string) string {
 	lo, hi := normPair(a, b)
 	return "p2p:" + lo + "_" + hi
 }
+
+// BuildP2PConvID 对外暴露单聊会话ID（与 EnsureSeqConversation 生成的保持一致）
+func BuildP2PConvID(a, b string) string {
+	return buildP2PConvID(a, b)
+}
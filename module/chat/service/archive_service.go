@@ -0,0 +1,37 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	sessionpb "PProject/gen/session"
+	"PProject/global"
+	"PProject/global/config"
+	errors "PProject/tools/errs"
+	"context"
+)
+
+// ArchiveServer ArchiveService 的 gRPC 实现
+type ArchiveServer struct {
+	sessionpb.UnimplementedArchiveServiceServer
+}
+
+func NewArchiveServer() *ArchiveServer {
+	return &ArchiveServer{}
+}
+
+// Search 消息检索；items 里的 content 换成高亮摘要
+func (s *ArchiveServer) Search(ctx context.Context, req *sessionpb.SearchReq) (*sessionpb.SearchResp, error) {
+	authInfo, err := global.GetAuthInfoFromContext(ctx)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid.WrapMsg(err.Error())
+	}
+	res, err := Search(ctx, config.GetTenantID(), authInfo.UserId, req)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*pb.MessageData, 0, len(res.Items))
+	for _, h := range res.Items {
+		h.Message.Content = h.Snippet
+		items = append(items, h.Message)
+	}
+	return &sessionpb.SearchResp{Items: items, Page: res.Page}, nil
+}
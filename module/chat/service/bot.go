@@ -0,0 +1,487 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	"PProject/module/chat/seq"
+	botModel "PProject/module/chatBox/model"
+	userModel "PProject/module/user/model"
+	"PProject/service/bus"
+	"PProject/service/chat"
+	ka "PProject/service/dispatcher/kafka"
+	util "PProject/tools"
+	errors "PProject/tools/errs"
+	ids "PProject/tools/ids"
+	jwtlib "PProject/tools/security"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	botNameMaxRunes = 32
+	botSecretBytes  = 32
+	botMaxPerOwner  = 20
+)
+
+// BotInput 创建/修改机器人；修改时空字段表示不改
+type BotInput struct {
+	Name             string `json:"name"`
+	AvatarURL        string `json:"avatar_url"`
+	Description      string `json:"description"`
+	WebhookURL       string `json:"webhook_url"`
+	Status           string `json:"status"`            // enabled|disabled，仅修改时
+	RequestedIntents *int64 `json:"requested_intents"` // 申请的特权意图（成员/在线状态/消息内容），应用管理员审批后才生效
+}
+
+// BotItem 机器人资料
+type BotItem struct {
+	UserID            string `json:"user_id"`
+	Name              string `json:"name"`
+	AvatarURL         string `json:"avatar_url,omitempty"`
+	Description       string `json:"description,omitempty"`
+	WebhookURL        string `json:"webhook_url,omitempty"`
+	Status            string `json:"status"`
+	RequestedIntents  int64  `json:"requested_intents"`
+	PrivilegedIntents int64  `json:"privileged_intents"` // 已开通的
+	CreateTime        int64  `json:"create_time"`
+}
+
+// BotCredentials 机器人凭证：只在创建/重置时返回一次，服务端只存 token 的哈希
+type BotCredentials struct {
+	Bot           *BotItem `json:"bot"`
+	Token         string   `json:"token,omitempty"`          // 调 API 用：Authorization: Bot <token>
+	WebhookSecret string   `json:"webhook_secret,omitempty"` // 校验 Webhook 签名用
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newBotToken token 形如 <bot_user_id>.<随机串>，鉴权时先按前缀找到机器人再比对哈希
+func newBotToken(botUserID string) (string, error) {
+	secret, err := randomHex(botSecretBytes)
+	if err != nil {
+		return "", err
+	}
+	return botUserID + "." + secret, nil
+}
+
+// checkWebhookURL Webhook 必须是 http(s) 且解析到公网地址；投递时拨号前还会再校验一次（防 DNS 重绑定）
+func checkWebhookURL(ctx context.Context, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.ErrArgs.WrapMsg("invalid webhook_url", "webhook_url", raw)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return errors.ErrArgs.WrapMsg("webhook host unresolvable", "webhook_url", raw)
+	}
+	for _, a := range addrs {
+		if !webhookIPAllowed(a.IP) {
+			return errors.ErrArgs.WrapMsg("webhook address not allowed", "webhook_url", raw, "ip", a.IP.String())
+		}
+	}
+	return nil
+}
+
+func checkPrivilegedIntents(v *int64) error {
+	if v != nil && (*v < 0 || uint64(*v)&^chat.IntentsPrivileged != 0) {
+		return errors.ErrArgs.WrapMsg("privileged intents out of range", "intents", *v)
+	}
+	return nil
+}
+
+// CreateBot 创建机器人：建一个机器人账号（AccountType=2）和机器人资料，返回 API token 和 Webhook 签名密钥
+func CreateBot(ctx context.Context, tenantID, ownerID string, in *BotInput) (*BotCredentials, error) {
+	if in == nil || strings.TrimSpace(in.Name) == "" {
+		return nil, errors.ErrArgs.WrapMsg("name is empty")
+	}
+	if utf8.RuneCountInString(in.Name) > botNameMaxRunes {
+		return nil, errors.ErrArgs.WrapMsg("name too long", "max", botNameMaxRunes)
+	}
+	if err := checkWebhookURL(ctx, in.WebhookURL); err != nil {
+		return nil, err
+	}
+	if err := checkPrivilegedIntents(in.RequestedIntents); err != nil {
+		return nil, err
+	}
+	bm := botModel.AgentBot{}
+	owned, err := bm.ListBotsByOwner(ctx, tenantID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(owned) >= botMaxPerOwner {
+		return nil, errors.ErrArgs.WrapMsg("too many bots", "max", botMaxPerOwner)
+	}
+
+	botUserID := ids.GenerateString()
+	token, err := newBotToken(botUserID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(botSecretBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &userModel.User{
+		UserID:      botUserID,
+		TenantID:    tenantID,
+		Nickname:    in.Name,
+		FaceURL:     in.AvatarURL,
+		Bio:         in.Description,
+		AccountType: userModel.AccountBot,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	if _, err := user.Collection().InsertOne(ctx, user); err != nil {
+		return nil, err
+	}
+
+	bot := &botModel.AgentBot{
+		TenantID:      tenantID,
+		Name:          in.Name,
+		AvatarURL:     in.AvatarURL,
+		Description:   in.Description,
+		WebhookURL:    in.WebhookURL,
+		UserID:        botUserID,
+		OwnerUserID:   ownerID,
+		WebhookSecret: secret,
+		TokenHash:     jwtlib.HashToken(token),
+		Status:        botModel.BotStatusEnabled,
+	}
+	if in.RequestedIntents != nil {
+		bot.RequestedIntents = *in.RequestedIntents
+	}
+	if err := bm.InsertBot(ctx, bot); err != nil {
+		return nil, err
+	}
+	return &BotCredentials{Bot: toBotItem(bot, user), Token: token, WebhookSecret: secret}, nil
+}
+
+// ownedBot 只有创建者能管理机器人
+func ownedBot(ctx context.Context, tenantID, ownerID, botUserID string) (*botModel.AgentBot, error) {
+	if botUserID == "" {
+		return nil, errors.ErrArgs.WrapMsg("bot_user_id is empty")
+	}
+	bm := botModel.AgentBot{}
+	bot, err := bm.GetBotByUserID(ctx, tenantID, botUserID)
+	if err != nil {
+		return nil, err
+	}
+	if bot == nil {
+		return nil, errors.ErrBotUnavailable.WrapMsg("bot not found", "bot_user_id", botUserID)
+	}
+	if bot.OwnerUserID != ownerID {
+		return nil, errors.ErrNoPermission.WrapMsg("not bot owner", "bot_user_id", botUserID)
+	}
+	return bot, nil
+}
+
+// UpdateBot 修改机器人资料/Webhook/状态/申请的特权意图；撤回申请时已开通的对应意图一并收回
+func UpdateBot(ctx context.Context, tenantID, ownerID, botUserID string, in *BotInput) (*BotItem, error) {
+	if in == nil {
+		return nil, errors.ErrArgs.WrapMsg("nil input")
+	}
+	bot, err := ownedBot(ctx, tenantID, ownerID, botUserID)
+	if err != nil {
+		return nil, err
+	}
+	set := bson.M{}
+	userSet := bson.M{}
+	if name := strings.TrimSpace(in.Name); name != "" {
+		if utf8.RuneCountInString(name) > botNameMaxRunes {
+			return nil, errors.ErrArgs.WrapMsg("name too long", "max", botNameMaxRunes)
+		}
+		set[botModel.BotFieldName] = name
+		userSet["nickname"] = name
+	}
+	if in.AvatarURL != "" {
+		set[botModel.BotFieldAvatarURL] = in.AvatarURL
+		userSet["face_url"] = in.AvatarURL
+	}
+	if in.Description != "" {
+		set[botModel.BotFieldDescription] = in.Description
+		userSet["bio"] = in.Description
+	}
+	if in.WebhookURL != "" {
+		if err := checkWebhookURL(ctx, in.WebhookURL); err != nil {
+			return nil, err
+		}
+		set[botModel.BotFieldWebhookURL] = in.WebhookURL
+	}
+	switch in.Status {
+	case "":
+	case botModel.BotStatusEnabled, botModel.BotStatusDisabled:
+		set[botModel.BotFieldStatus] = in.Status
+	default:
+		return nil, errors.ErrArgs.WrapMsg("invalid status", "status", in.Status)
+	}
+	if err := checkPrivilegedIntents(in.RequestedIntents); err != nil {
+		return nil, err
+	}
+	um := userModel.User{}
+	if in.RequestedIntents != nil {
+		set[botModel.BotFieldRequested] = *in.RequestedIntents
+		user, err := um.GetUserByID(ctx, bot.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && user.PrivilegedIntents&^*in.RequestedIntents != 0 {
+			userSet["privileged_intents"] = user.PrivilegedIntents & *in.RequestedIntents
+		}
+	}
+
+	bm := botModel.AgentBot{}
+	if len(set) > 0 {
+		if _, err := bm.UpdateBotFields(ctx, tenantID, bot.UserID, set); err != nil {
+			return nil, err
+		}
+	}
+	if len(userSet) > 0 {
+		userSet["update_time"] = time.Now()
+		if _, err := um.Collection().UpdateOne(ctx, bson.M{"user_id": bot.UserID}, bson.M{"$set": userSet}); err != nil {
+			return nil, err
+		}
+	}
+	if bot, err = bm.GetBotByUserID(ctx, tenantID, bot.UserID); err != nil {
+		return nil, err
+	}
+	user, err := um.GetUserByID(ctx, bot.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return toBotItem(bot, user), nil
+}
+
+// ResetBotToken 重置 API token（旧 token 立即失效）；rotateSecret 时一并更换 Webhook 签名密钥
+func ResetBotToken(ctx context.Context, tenantID, ownerID, botUserID string, rotateSecret bool) (*BotCredentials, error) {
+	bot, err := ownedBot(ctx, tenantID, ownerID, botUserID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newBotToken(bot.UserID)
+	if err != nil {
+		return nil, err
+	}
+	out := &BotCredentials{Token: token}
+	set := bson.M{botModel.BotFieldTokenHash: jwtlib.HashToken(token)}
+	if rotateSecret {
+		if out.WebhookSecret, err = randomHex(botSecretBytes); err != nil {
+			return nil, err
+		}
+		set[botModel.BotFieldWebhookSecret] = out.WebhookSecret
+	}
+	bm := botModel.AgentBot{}
+	if _, err := bm.UpdateBotFields(ctx, tenantID, bot.UserID, set); err != nil {
+		return nil, err
+	}
+	um := userModel.User{}
+	user, err := um.GetUserByID(ctx, bot.UserID)
+	if err != nil {
+		return nil, err
+	}
+	out.Bot = toBotItem(bot, user)
+	return out, nil
+}
+
+// ListMyBots 我创建的机器人
+func ListMyBots(ctx context.Context, tenantID, ownerID string) ([]*BotItem, error) {
+	bm := botModel.AgentBot{}
+	bots, err := bm.ListBotsByOwner(ctx, tenantID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]string, 0, len(bots))
+	for _, b := range bots {
+		userIDs = append(userIDs, b.UserID)
+	}
+	um := userModel.User{}
+	users, err := um.ListUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*userModel.User, len(users))
+	for _, u := range users {
+		byID[u.UserID] = u
+	}
+	out := make([]*BotItem, 0, len(bots))
+	for _, b := range bots {
+		out = append(out, toBotItem(b, byID[b.UserID]))
+	}
+	return out, nil
+}
+
+// GrantBotIntents 应用管理员审批特权意图：只能开通创建者申请过的，传 0 收回全部
+func GrantBotIntents(ctx context.Context, tenantID, botUserID string, intents int64) (*BotItem, error) {
+	if err := checkPrivilegedIntents(&intents); err != nil {
+		return nil, err
+	}
+	bm := botModel.AgentBot{}
+	bot, err := bm.GetBotByUserID(ctx, tenantID, botUserID)
+	if err != nil {
+		return nil, err
+	}
+	if bot == nil {
+		return nil, errors.ErrBotUnavailable.WrapMsg("bot not found", "bot_user_id", botUserID)
+	}
+	if intents&^bot.RequestedIntents != 0 {
+		return nil, errors.ErrArgs.WrapMsg("intents not requested", "requested", bot.RequestedIntents, "intents", intents)
+	}
+	um := userModel.User{}
+	if _, err := um.Collection().UpdateOne(ctx, bson.M{"user_id": bot.UserID}, bson.M{"$set": bson.M{
+		"privileged_intents": intents,
+		"update_time":        time.Now(),
+	}}); err != nil {
+		return nil, err
+	}
+	user, err := um.GetUserByID(ctx, bot.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return toBotItem(bot, user), nil
+}
+
+// AuthenticateBot 校验机器人 API token，返回启用中的机器人
+func AuthenticateBot(ctx context.Context, tenantID, token string) (*botModel.AgentBot, error) {
+	botUserID, _, ok := strings.Cut(token, ".")
+	if !ok || botUserID == "" {
+		return nil, errors.ErrTokenInvalid.WrapMsg("malformed bot token")
+	}
+	bm := botModel.AgentBot{}
+	bot, err := bm.GetBotByUserID(ctx, tenantID, botUserID)
+	if err != nil {
+		return nil, err
+	}
+	if bot == nil || bot.TokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(bot.TokenHash), []byte(jwtlib.HashToken(token))) != 1 {
+		return nil, errors.ErrTokenInvalid.WrapMsg("bot token mismatch")
+	}
+	if !bot.Enabled() {
+		return nil, errors.ErrBotUnavailable.WrapMsg("bot disabled", "bot_user_id", bot.UserID)
+	}
+	return bot, nil
+}
+
+// botMessageTarget 机器人消息的目标：话题 > 服务器频道/广播频道 > 群 > 单聊，返回帧的 to
+func botMessageTarget(md *pb.MessageData) string {
+	switch {
+	case md.GetThreadId() != "":
+		return md.GetThreadId()
+	case md.GetChannelId() != "":
+		return md.GetChannelId()
+	case md.GetGroupId() != "":
+		return md.GetGroupId()
+	}
+	return md.GetRecvId()
+}
+
+// BotSendMessage 机器人通过 API 发消息：构造一条普通 DATA 帧投进发送链路
+// 机器人没有长连接收不到 NACK，所以群/频道权限、黑名单、禁言等校验在投递前同步做一遍，不通过直接返回错误
+// 返回 client_msg_id，机器人可以用它查历史对上 server_msg_id
+func BotSendMessage(ctx context.Context, tenantID string, bot *botModel.AgentBot, md *pb.MessageData) (string, error) {
+	if md == nil {
+		return "", errors.ErrArgs.WrapMsg("message is required")
+	}
+	to := botMessageTarget(md)
+	if to == "" {
+		return "", errors.ErrArgs.WrapMsg("recv_id, group_id, channel_id or thread_id is required")
+	}
+	now := time.Now().UnixMilli()
+	md.SendId = bot.UserID
+	md.SenderNickname = bot.Name
+	md.SenderFaceUrl = bot.AvatarURL
+	md.MsgFrom = int32(pb.MsgFrom_ROBOT)
+	md.SenderPlatformId = int32(pb.PlatformID_API)
+	md.IsEphemeral = false
+	md.CreateTime = now
+	md.SendTime = now
+	if md.GetClientMsgId() == "" {
+		md.ClientMsgId = ids.GenerateString()
+	}
+	// 提前校验内容，不合法的直接返回，不进发送链路
+	if _, err := BuildMessageModelFromPB(tenantID, md, 0, seq.BuildP2PConvID(bot.UserID, to)); err != nil {
+		return "", errors.ErrArgs.WrapMsg(err.Error())
+	}
+	if err := checkBotSend(ctx, tenantID, bot.UserID, md); err != nil {
+		return "", err
+	}
+
+	frame := &pb.MessageFrameData{
+		Type:     pb.MessageFrameData_DATA,
+		From:     bot.UserID,
+		To:       to,
+		Ts:       now,
+		TenantId: tenantID,
+		DedupId:  "bot-" + md.GetClientMsgId(),
+		Body:     &pb.MessageFrameData_Payload{Payload: md},
+	}
+	value, err := util.EncodeFrame(frame)
+	if err != nil {
+		return "", err
+	}
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).SendTopicKeys()
+	topic := ka.SelectTopicByUser(to, keys)
+	if err := bus.Publish(ctx, &bus.Message{Topic: topic, Key: []byte(to), Value: value}); err != nil {
+		logger.Errorf("[Bot] publish bot=%s to=%s err=%v", bot.UserID, to, err)
+		return "", err
+	}
+	return md.GetClientMsgId(), nil
+}
+
+// checkBotSend 按数据节点的路由顺序（话题 > 服务器频道 > 群 > 单聊）做发送校验
+// 慢速模式在数据节点落库前占位，这里不占
+func checkBotSend(ctx context.Context, tenantID, botUserID string, md *pb.MessageData) error {
+	switch {
+	case md.GetThreadId() != "":
+		root, err := GetThreadRoot(ctx, tenantID, md.GetThreadId())
+		if err != nil {
+			return err
+		}
+		_, err = CheckThreadAccess(ctx, tenantID, botUserID, root, md)
+		return err
+	case md.GetGuildId() != "":
+		_, err := CheckGuildSend(ctx, tenantID, botUserID, md)
+		return err
+	case md.GetGroupId() != "":
+		if _, err := CheckGroupSend(ctx, tenantID, md.GetGroupId(), botUserID, md); err != nil {
+			return err
+		}
+		return CheckAtAllPolicy(ctx, tenantID, md)
+	}
+	return CheckP2PSendPolicy(ctx, tenantID, botUserID, md.GetRecvId())
+}
+
+func toBotItem(b *botModel.AgentBot, u *userModel.User) *BotItem {
+	item := &BotItem{
+		UserID:           b.UserID,
+		Name:             b.Name,
+		AvatarURL:        b.AvatarURL,
+		Description:      b.Description,
+		WebhookURL:       b.WebhookURL,
+		Status:           b.Status,
+		RequestedIntents: b.RequestedIntents,
+		CreateTime:       b.CreatedAt.UnixMilli(),
+	}
+	if u != nil {
+		item.PrivilegedIntents = u.PrivilegedIntents
+	}
+	return item
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/module/chat/seq"
+	botModel "PProject/module/chatBox/model"
+	"PProject/service/bus"
+	"PProject/service/chat"
+	ka "PProject/service/dispatcher/kafka"
+	online "PProject/service/storage"
+	util "PProject/tools"
+	errors "PProject/tools/errs"
+	ids "PProject/tools/ids"
+	jwtlib "PProject/tools/security"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	interactionTTL       = 15 * time.Minute // 机器人回应交互的有效期
+	interactionMaxValues = 25
+)
+
+// 交互回应方式
+const (
+	InteractionRespondUpdateMessage = "update_message" // 更新原消息（所有人可见）
+	InteractionRespondEphemeral     = "ephemeral"      // 只给点击者看的回复，不落库
+)
+
+// InteractionInput 用户点击组件
+type InteractionInput struct {
+	ServerMsgID string   `json:"server_msg_id"`
+	CustomID    string   `json:"custom_id"`
+	Values      []string `json:"values"` // 下拉选中的值/输入框内容
+}
+
+// InteractionItem 交互受理结果
+type InteractionItem struct {
+	InteractionID string `json:"interaction_id"`
+	ExpireAt      int64  `json:"expire_at"`
+}
+
+// InteractionResponse 机器人回应交互
+type InteractionResponse struct {
+	InteractionID string          `json:"interaction_id"`
+	Token         string          `json:"token"`
+	Type          string          `json:"type"` // update_message | ephemeral
+	Message       *pb.MessageData `json:"-"`    // 新内容（文本/富文本/Markdown + rich 组件）
+}
+
+// findComponent 按 custom_id 找消息上的组件（行容器没有 custom_id，不能交互）
+func findComponent(rich *pb.RichMessage, customID string) *pb.Component {
+	for _, c := range rich.GetComponents() {
+		if c.GetType() != pb.Component_ACTION_ROW && c.GetCustomId() == customID {
+			return c
+		}
+	}
+	return nil
+}
+
+// checkComponentValues 下拉只能选组件上有的选项；按钮不带值
+func checkComponentValues(c *pb.Component, values []string) error {
+	if len(values) > interactionMaxValues {
+		return errors.ErrArgs.WrapMsg("too many values", "max", interactionMaxValues)
+	}
+	switch c.GetType() {
+	case pb.Component_BUTTON:
+		if len(values) > 0 {
+			return errors.ErrArgs.WrapMsg("button takes no values", "custom_id", c.GetCustomId())
+		}
+	case pb.Component_SELECT:
+		for _, v := range values {
+			if !slices.ContainsFunc(c.GetOptions(), func(o *pb.ComponentOption) bool { return o.GetValue() == v }) {
+				return errors.ErrArgs.WrapMsg("unknown option", "custom_id", c.GetCustomId(), "value", v)
+			}
+		}
+	}
+	return nil
+}
+
+// messageReadable 用户能不能看到这条消息所在的会话：有会话记录，或能看父会话（话题）/ 频道
+func messageReadable(ctx context.Context, tenantID, userID string, m *msgModel.MessageModel) (bool, error) {
+	if m.GuildID != "" || m.ChannelID != "" {
+		conv, err := channelReadableConversation(ctx, tenantID, userID, m.ChannelID)
+		return conv != nil, err
+	}
+	cm := msgModel.Conversation{}
+	conv, err := cm.GetUserConversation(ctx, tenantID, userID, m.ConversationID)
+	if err != nil || conv != nil {
+		return conv != nil, err
+	}
+	if m.ThreadID != "" {
+		conv, err = threadReadableConversation(ctx, tenantID, userID, m.ThreadID)
+		return conv != nil, err
+	}
+	return false, nil
+}
+
+// CreateInteraction 用户点击机器人消息上的组件：校验后记一条交互，异步推给机器人的 Webhook
+func CreateInteraction(ctx context.Context, tenantID, userID string, in *InteractionInput) (*InteractionItem, error) {
+	if in == nil || in.ServerMsgID == "" || in.CustomID == "" {
+		return nil, errors.ErrArgs.WrapMsg("server_msg_id and custom_id are required")
+	}
+	m, err := msgModel.GetMessageByServerMsgID(ctx, in.ServerMsgID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.TenantID != tenantID || m.Status != msgModel.MsgStatusNormal {
+		return nil, errors.ErrRecordNotFound.WrapMsg("message not found", "server_msg_id", in.ServerMsgID)
+	}
+	ok, err := messageReadable(ctx, tenantID, userID, m)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.ErrNoPermission.WrapMsg("message not visible", "server_msg_id", in.ServerMsgID)
+	}
+
+	bm := botModel.AgentBot{}
+	bot, err := bm.GetBotByUserID(ctx, tenantID, m.SendID)
+	if err != nil {
+		return nil, err
+	}
+	if bot == nil || !bot.Enabled() || bot.WebhookURL == "" {
+		return nil, errors.ErrBotUnavailable.WrapMsg("message sender is not an available bot", "sender", m.SendID)
+	}
+	comp := findComponent(RichFromMap(m.Rich), in.CustomID)
+	if comp == nil || comp.GetDisabled() {
+		return nil, errors.ErrArgs.WrapMsg("component not found or disabled", "custom_id", in.CustomID)
+	}
+	if err := checkComponentValues(comp, in.Values); err != nil {
+		return nil, err
+	}
+
+	token, err := randomHex(botSecretBytes)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	it := &msgModel.BotInteraction{
+		TenantID:       tenantID,
+		InteractionID:  ids.GenerateString(),
+		TokenHash:      jwtlib.HashToken(token),
+		BotUserID:      bot.UserID,
+		UserID:         userID,
+		ServerMsgID:    m.ServerMsgID,
+		ConversationID: m.ConversationID,
+		CustomID:       in.CustomID,
+		Values:         in.Values,
+		ExpireAt:       now.Add(interactionTTL),
+	}
+	im := msgModel.BotInteraction{}
+	if err := im.InsertBotInteraction(ctx, it); err != nil {
+		return nil, err
+	}
+
+	msg, err := protojson.Marshal(BuildPBFromMessageModel(m))
+	if err != nil {
+		return nil, err
+	}
+	ev := newBotEvent(tenantID, bot.UserID, BotEventInteractionCreate)
+	ev.Message = msg
+	ev.Interaction = &BotInteractionEvent{
+		InteractionID: it.InteractionID,
+		Token:         token,
+		UserID:        userID,
+		CustomID:      in.CustomID,
+		ComponentType: comp.GetType().String(),
+		Values:        in.Values,
+		ExpireAt:      it.ExpireAt.UnixMilli(),
+	}
+	d, err := newBotDelivery(ev)
+	if err != nil {
+		return nil, err
+	}
+	dm := msgModel.BotWebhookDelivery{}
+	if err := dm.InsertBotWebhookDeliveries(ctx, []*msgModel.BotWebhookDelivery{d}); err != nil {
+		return nil, err
+	}
+	return &InteractionItem{InteractionID: it.InteractionID, ExpireAt: it.ExpireAt.UnixMilli()}, nil
+}
+
+// RespondInteraction 机器人回应交互（每个交互只能回应一次）：更新原消息，或给点击者发一条仅自己可见的消息
+func RespondInteraction(ctx context.Context, tenantID string, bot *botModel.AgentBot, in *InteractionResponse) error {
+	if in == nil || in.InteractionID == "" || in.Token == "" || in.Message == nil {
+		return errors.ErrArgs.WrapMsg("interaction_id, token and message are required")
+	}
+	if in.Type != InteractionRespondUpdateMessage && in.Type != InteractionRespondEphemeral {
+		return errors.ErrArgs.WrapMsg("invalid response type", "type", in.Type)
+	}
+	// 先校验内容，避免占用了唯一一次回应机会
+	content, err := BuildMessageModelFromPB(tenantID, in.Message, 0, "")
+	if err != nil {
+		return errors.ErrArgs.WrapMsg(err.Error())
+	}
+	if in.Type == InteractionRespondUpdateMessage {
+		switch content.ContentType {
+		case msgModel.TEXT, msgModel.ADVANCED_TEXT, msgModel.MARKDOWN:
+		default:
+			return errors.ErrArgs.WrapMsg("only text messages can be updated", "content_type", content.ContentType)
+		}
+	}
+
+	im := msgModel.BotInteraction{}
+	it, err := im.ClaimBotInteraction(ctx, tenantID, in.InteractionID, bot.UserID, jwtlib.HashToken(in.Token), time.Now())
+	if err != nil {
+		return err
+	}
+	if it == nil {
+		return errors.ErrInteractionInvalid.WrapMsg("interaction unknown, expired or answered", "interaction_id", in.InteractionID)
+	}
+
+	if in.Type == InteractionRespondUpdateMessage {
+		err = updateInteractionMessage(ctx, tenantID, bot, it, content)
+	} else {
+		err = sendEphemeralReply(ctx, tenantID, bot, it, in.Message)
+	}
+	if err != nil {
+		if rerr := im.ReleaseBotInteraction(ctx, it.ID); rerr != nil {
+			logger.Errorf("[BotInteraction] release interaction=%s err=%v", it.InteractionID, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// updateInteractionMessage 改原消息内容并通知会话里的所有人
+// 内容改成功就算回应成功：通知失败时客户端靠历史/SYNC 拿到新版本（edit_version）
+func updateInteractionMessage(ctx context.Context, tenantID string, bot *botModel.AgentBot, it *msgModel.BotInteraction, content *msgModel.MessageModel) error {
+	m, err := msgModel.EditMessageContent(ctx, tenantID, it.ServerMsgID, bot.UserID, content, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.ErrRecordNotFound.WrapMsg("message not editable", "server_msg_id", it.ServerMsgID)
+	}
+	if err := IndexMessageSearch(ctx, tenantID, m); err != nil {
+		logger.Errorf("[BotInteraction] reindex msg=%s err=%v", m.ServerMsgID, err)
+	}
+
+	md := BuildPBFromMessageModel(m)
+	if _, ok := seq.ChannelIDOf(m.ConversationID); ok {
+		// 读扩散频道没有成员会话：按频道路由广播（服务器频道按服务器路由，网关再按查看权限过滤）
+		route := m.ChannelID
+		if m.GuildID != "" {
+			route = m.GuildID
+		}
+		err = publishToChannel(ctx, route, func(gateway string) *pb.MessageFrameData {
+			return chat.BuildMessageEdited(gateway, tenantID, bot.UserID, m.ConversationID, route, nil, md)
+		})
+	} else {
+		cm := msgModel.Conversation{}
+		var owners []string
+		if owners, err = cm.ListConversationOwners(ctx, tenantID, m.ConversationID); err == nil {
+			err = publishToGateways(ctx, m.ConversationID, owners, func(gateway string, users []string) *pb.MessageFrameData {
+				return chat.BuildMessageEdited(gateway, tenantID, bot.UserID, m.ConversationID, "", users, md)
+			})
+		}
+	}
+	if err != nil {
+		logger.Errorf("[BotInteraction] notify edit msg=%s conv=%s err=%v", m.ServerMsgID, m.ConversationID, err)
+	}
+	return nil
+}
+
+// sendEphemeralReply 仅点击者可见的回复：挂在原消息的会话里、回复原消息，不落库、不分配 seq、离线就丢
+func sendEphemeralReply(ctx context.Context, tenantID string, bot *botModel.AgentBot, it *msgModel.BotInteraction, md *pb.MessageData) error {
+	orig, err := msgModel.GetMessageByServerMsgID(ctx, it.ServerMsgID)
+	if err != nil {
+		return err
+	}
+	if orig == nil {
+		return errors.ErrRecordNotFound.WrapMsg("message not found", "server_msg_id", it.ServerMsgID)
+	}
+	now := time.Now().UnixMilli()
+	md.ServerMsgId = ids.GenerateString()
+	if md.GetClientMsgId() == "" {
+		md.ClientMsgId = md.ServerMsgId
+	}
+	md.SendId = bot.UserID
+	md.SenderNickname = bot.Name
+	md.SenderFaceUrl = bot.AvatarURL
+	md.MsgFrom = int32(pb.MsgFrom_ROBOT)
+	md.SenderPlatformId = int32(pb.PlatformID_API)
+	md.SessionType = int32(orig.SessionType)
+	md.RecvId = it.UserID
+	md.GroupId = orig.GroupID
+	md.GuildId = orig.GuildID
+	md.ChannelId = orig.ChannelID
+	md.ThreadId = orig.ThreadID
+	md.ReplyTo = orig.ServerMsgID
+	md.IsEphemeral = true
+	md.CreateTime = now
+	md.SendTime = now
+	md.Seq = 0
+
+	return publishToGateways(ctx, it.UserID, []string{it.UserID}, func(gateway string, users []string) *pb.MessageFrameData {
+		return chat.BuildEphemeralDeliver(gateway, tenantID, bot.UserID, users, md)
+	})
+}
+
+// publishToChannel 给频道路由里的每个网关发一帧
+func publishToChannel(ctx context.Context, route string, build func(gateway string) *pb.MessageFrameData) error {
+	gateways, err := online.ListChannelGateways(ctx, route)
+	if err != nil {
+		return err
+	}
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).ReceiveTopicKeys(false)
+	for _, gateway := range gateways {
+		value, err := util.EncodeFrame(build(gateway))
+		if err != nil {
+			return err
+		}
+		topic := fmt.Sprintf("%v_%v", gateway, ka.SelectCAckTopicByUser(route, keys))
+		if err := bus.Publish(ctx, &bus.Message{Topic: topic, Key: []byte(route), Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	botModel "PProject/module/chatBox/model"
+	userModel "PProject/module/user/model"
+	"PProject/service/chat"
+	ids "PProject/tools/ids"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Webhook 事件类型
+const (
+	BotEventMessageCreate     = "message_create"
+	BotEventInteractionCreate = "interaction_create"
+)
+
+// Webhook 请求头：签名 = hex(HMAC-SHA256(webhook_secret, timestamp + "." + body))
+const (
+	BotHeaderEvent     = "X-Bot-Event"
+	BotHeaderEventID   = "X-Bot-Event-Id"
+	BotHeaderTimestamp = "X-Bot-Timestamp"
+	BotHeaderSignature = "X-Bot-Signature"
+)
+
+// 租户机器人列表的本地缓存：每条消息都要判断会话里有没有机器人，没有机器人的租户不能每条都查库
+const botListCacheTTL = 10 * time.Second
+
+var botListCache = struct {
+	sync.Mutex
+	items map[string]botListEntry
+}{items: map[string]botListEntry{}}
+
+type botListEntry struct {
+	bots     []*botModel.AgentBot
+	expireAt time.Time
+}
+
+// BotEvent 投递给机器人 Webhook 的事件
+type BotEvent struct {
+	EventID     string               `json:"event_id"`
+	Type        string               `json:"type"`
+	TenantID    string               `json:"tenant_id"`
+	BotUserID   string               `json:"bot_user_id"`
+	Timestamp   int64                `json:"timestamp"`
+	Message     json.RawMessage      `json:"message,omitempty"` // MessageData（protojson）
+	Interaction *BotInteractionEvent `json:"interaction,omitempty"`
+}
+
+// BotInteractionEvent 组件交互：机器人凭 interaction_id + token 在有效期内回应一次
+type BotInteractionEvent struct {
+	InteractionID string   `json:"interaction_id"`
+	Token         string   `json:"token"`
+	UserID        string   `json:"user_id"`
+	CustomID      string   `json:"custom_id"`
+	ComponentType string   `json:"component_type"`
+	Values        []string `json:"values,omitempty"`
+	ExpireAt      int64    `json:"expire_at"`
+}
+
+// SignBotWebhook Webhook 签名；时间戳一起签进去，机器人据此拒绝重放
+func SignBotWebhook(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyBotWebhook 机器人侧校验签名（SDK/测试用）
+func VerifyBotWebhook(secret string, ts int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignBotWebhook(secret, ts, body)), []byte(signature))
+}
+
+// 运营商级 NAT 地址段，net.IP.IsPrivate 不包含
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// webhookIPAllowed Webhook 只能投到公网：回环/内网/链路本地（含云厂商元数据地址）/组播/未指定地址都拒绝，防止借机器人探测内网
+func webhookIPAllowed(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if ip4[0] == 0 || cgnatNet.Contains(ip4) {
+			return false
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// NewBotWebhookClient 投递用的 http.Client：拨号时按实际连接的 IP 再校验一次，不走代理、不跟随重定向
+func NewBotWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !webhookIPAllowed(ip) {
+				return fmt.Errorf("webhook address %s not allowed", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// newBotDelivery 事件序列化成一条待投递记录
+func newBotDelivery(ev *BotEvent) (*msgModel.BotWebhookDelivery, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	return &msgModel.BotWebhookDelivery{
+		TenantID:  ev.TenantID,
+		BotUserID: ev.BotUserID,
+		EventID:   ev.EventID,
+		EventType: ev.Type,
+		Body:      body,
+	}, nil
+}
+
+func newBotEvent(tenantID, botUserID, typ string) *BotEvent {
+	return &BotEvent{
+		EventID:   ids.GenerateString(),
+		Type:      typ,
+		TenantID:  tenantID,
+		BotUserID: botUserID,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// tenantWebhookBots 租户下配置了 Webhook 的机器人（带本地缓存）
+func tenantWebhookBots(ctx context.Context, tenantID string) ([]*botModel.AgentBot, error) {
+	now := time.Now()
+	botListCache.Lock()
+	e, ok := botListCache.items[tenantID]
+	botListCache.Unlock()
+	if ok && now.Before(e.expireAt) {
+		return e.bots, nil
+	}
+	bm := botModel.AgentBot{}
+	bots, err := bm.ListTenantWebhookBots(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	botListCache.Lock()
+	botListCache.items[tenantID] = botListEntry{bots: bots, expireAt: now.Add(botListCacheTTL)}
+	botListCache.Unlock()
+	return bots, nil
+}
+
+// messageBotRecipients 能看到这条消息的机器人（不含发送者自己）
+func messageBotRecipients(ctx context.Context, tenantID string, m *msgModel.MessageModel) ([]*botModel.AgentBot, error) {
+	bots, err := tenantWebhookBots(ctx, tenantID)
+	if err != nil || len(bots) == 0 {
+		return nil, err
+	}
+	byUser := make(map[string]*botModel.AgentBot, len(bots))
+	for _, b := range bots {
+		if b.UserID != m.SendID {
+			byUser[b.UserID] = b
+		}
+	}
+	if len(byUser) == 0 {
+		return nil, nil
+	}
+
+	candidates := make([]string, 0, len(byUser))
+	for uid := range byUser {
+		candidates = append(candidates, uid)
+	}
+	var visible []string
+	switch {
+	case m.GuildID != "":
+		if visible, err = FilterGuildChannelViewers(ctx, tenantID, m.GuildID, m.ChannelID, candidates); err != nil {
+			return nil, err
+		}
+	case m.GroupID != "" || m.ChannelID != "":
+		groupID := m.GroupID
+		if groupID == "" {
+			groupID = m.ChannelID
+		}
+		gm := msgModel.GroupMember{}
+		if visible, err = gm.FilterGroupMemberIDs(ctx, tenantID, groupID, candidates); err != nil {
+			return nil, err
+		}
+	default:
+		if _, ok := byUser[m.RecvID]; ok {
+			visible = []string{m.RecvID}
+		}
+	}
+
+	out := make([]*botModel.AgentBot, 0, len(visible))
+	for _, uid := range visible {
+		out = append(out, byUser[uid])
+	}
+	return out, nil
+}
+
+// EnqueueBotMessageEvents 消息落库后，给会话里配置了 Webhook 的机器人各写一条 message_create 事件
+// 机器人按网关意图的规则收消息：没开通消息内容特权时，只有单聊和 @ 自己的消息带内容
+func EnqueueBotMessageEvents(ctx context.Context, tenantID string, m *msgModel.MessageModel) error {
+	bots, err := messageBotRecipients(ctx, tenantID, m)
+	if err != nil || len(bots) == 0 {
+		return err
+	}
+	botIDs := make([]string, 0, len(bots))
+	for _, b := range bots {
+		botIDs = append(botIDs, b.UserID)
+	}
+	um := userModel.User{}
+	users, err := um.ListUsersByIDs(ctx, botIDs)
+	if err != nil {
+		return err
+	}
+	privileged := make(map[string]int64, len(users))
+	for _, u := range users {
+		privileged[u.UserID] = u.PrivilegedIntents
+	}
+
+	frame := &pb.MessageFrameData{
+		Type: pb.MessageFrameData_DELIVER,
+		Body: &pb.MessageFrameData_Payload{Payload: BuildPBFromMessageModel(m)},
+	}
+	list := make([]*msgModel.BotWebhookDelivery, 0, len(bots))
+	for _, b := range bots {
+		filter := &chat.ConnFilter{Intents: chat.IntentsDefault | uint64(privileged[b.UserID])&chat.IntentsPrivileged}
+		f, ok := filter.Apply(b.UserID, frame)
+		if !ok {
+			continue
+		}
+		msg, err := protojson.Marshal(f.GetPayload())
+		if err != nil {
+			return err
+		}
+		ev := newBotEvent(tenantID, b.UserID, BotEventMessageCreate)
+		ev.Message = msg
+		d, err := newBotDelivery(ev)
+		if err != nil {
+			return err
+		}
+		list = append(list, d)
+	}
+	dm := msgModel.BotWebhookDelivery{}
+	return dm.InsertBotWebhookDeliveries(ctx, list)
+}
+
+// DeliverBotWebhook 投递一条事件：按机器人当前的 Webhook 地址和密钥签名后 POST，2xx 视为成功
+// 返回 permanent=true 表示不必再重试（机器人已删除/禁用/没有 Webhook）
+func DeliverBotWebhook(ctx context.Context, client *http.Client, d *msgModel.BotWebhookDelivery) (permanent bool, err error) {
+	bm := botModel.AgentBot{}
+	bot, err := bm.GetBotByUserID(ctx, d.TenantID, d.BotUserID)
+	if err != nil {
+		return false, err
+	}
+	if bot == nil || !bot.Enabled() || bot.WebhookURL == "" {
+		return true, fmt.Errorf("bot %s unavailable", d.BotUserID)
+	}
+	return false, PostBotWebhook(ctx, client, bot.WebhookURL, bot.WebhookSecret, d)
+}
+
+// PostBotWebhook 签名并 POST 事件；超时由 client 控制
+func PostBotWebhook(ctx context.Context, client *http.Client, webhookURL, secret string, d *msgModel.BotWebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(BotHeaderEvent, d.EventType)
+	req.Header.Set(BotHeaderEventID, d.EventID)
+	req.Header.Set(BotHeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(BotHeaderSignature, SignBotWebhook(secret, ts, d.Body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NotifyBotMessage 数据节点落库后调用：写入失败只打日志，不影响消息投递
+func NotifyBotMessage(ctx context.Context, tenantID string, m *msgModel.MessageModel) {
+	if err := EnqueueBotMessageEvents(ctx, tenantID, m); err != nil {
+		logger.Errorf("[BotWebhook] enqueue msg=%s conv=%s err=%v", m.ServerMsgID, m.ConversationID, err)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPostBotWebhook(t *testing.T) {
+	const secret = "s3cret"
+	d := &msgModel.BotWebhookDelivery{
+		EventID:   "e1",
+		EventType: BotEventMessageCreate,
+		Body:      []byte(`{"event_id":"e1"}`),
+	}
+
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(BotHeaderTimestamp), 10, 64)
+		if r.Header.Get(BotHeaderEvent) != BotEventMessageCreate || r.Header.Get(BotHeaderEventID) != "e1" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if !VerifyBotWebhook(secret, ts, body, r.Header.Get(BotHeaderSignature)) {
+			t.Errorf("bad signature")
+		}
+		// 签名绑定时间戳，换个时间戳不能通过
+		if VerifyBotWebhook(secret, ts+1, body, r.Header.Get(BotHeaderSignature)) {
+			t.Errorf("signature not bound to timestamp")
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	if err := PostBotWebhook(context.Background(), client, srv.URL, secret, d); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	status = http.StatusInternalServerError
+	if err := PostBotWebhook(context.Background(), client, srv.URL, secret, d); err == nil {
+		t.Fatalf("non-2xx should fail")
+	}
+}
+
+func TestPostBotWebhookTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	d := &msgModel.BotWebhookDelivery{EventID: "e1", EventType: BotEventMessageCreate, Body: []byte(`{}`)}
+	if err := PostBotWebhook(context.Background(), client, srv.URL, "k", d); err == nil {
+		t.Fatalf("slow webhook should time out")
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	ctx := context.Background()
+	for _, raw := range []string{
+		"ftp://8.8.8.8/hook",
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.10/hook",
+		"http://172.16.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[fe80::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if err := checkWebhookURL(ctx, raw); err == nil {
+			t.Errorf("%s should be rejected", raw)
+		}
+	}
+	for _, raw := range []string{"", "https://8.8.8.8/hook", "http://[2001:4860:4860::8888]/hook"} {
+		if err := checkWebhookURL(ctx, raw); err != nil {
+			t.Errorf("%s: %v", raw, err)
+		}
+	}
+}
+
+func TestBotWebhookClientRefusesPrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request reached loopback server")
+	}))
+	defer srv.Close()
+
+	// 注册时校验过的域名后来解析到内网（DNS 重绑定），拨号时也要拦住
+	d := &msgModel.BotWebhookDelivery{EventID: "e1", EventType: BotEventMessageCreate, Body: []byte(`{}`)}
+	if err := PostBotWebhook(context.Background(), NewBotWebhookClient(time.Second), srv.URL, "k", d); err == nil {
+		t.Fatalf("loopback webhook should be refused")
+	}
+}
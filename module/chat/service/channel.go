@@ -0,0 +1,228 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/module/chat/seq"
+	online "PProject/service/storage"
+	errors "PProject/tools/errs"
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+// 广播频道（GroupType=3）：读扩散，只有一条消息流；订阅者只保存已读游标（GroupMember.LastReadSeq），
+// 没有会话记录，未读 = 频道水位 - 已读游标，查询时现算
+
+// 频道的系统事件（SystemEvent 推给本人，不在频道里广播）
+const (
+	ChannelEventPublisher = "channel_publisher" // 发布者权限变了（被授予/收回的人）
+)
+
+// channelSilentNotifies 成员相关的群通知在频道里不广播（订阅者可能上百万）
+var channelSilentNotifies = map[string]bool{
+	GroupNotifyMemberJoined:   true,
+	GroupNotifyMemberInvited:  true,
+	GroupNotifyMemberKicked:   true,
+	GroupNotifyMemberQuit:     true,
+	GroupNotifyMemberMuted:    true,
+	GroupNotifyMemberUnmuted:  true,
+	GroupNotifyMemberBanned:   true,
+	GroupNotifyMemberUnbanned: true,
+	GroupNotifyAdminGranted:   true,
+	GroupNotifyAdminRevoked:   true,
+}
+
+// channelMembershipNotifies 订阅关系变了的群通知：相关的人需要刷新网关上的频道订阅
+var channelMembershipNotifies = map[string]bool{
+	GroupNotifyCreated:       true,
+	GroupNotifyMemberJoined:  true,
+	GroupNotifyMemberInvited: true,
+	GroupNotifyMemberKicked:  true,
+	GroupNotifyMemberQuit:    true,
+	GroupNotifyMemberBanned:  true,
+}
+
+// ChannelSilentNotify 该类群通知在频道里不下发
+func ChannelSilentNotify(kind string) bool {
+	return channelSilentNotifies[kind]
+}
+
+// RefreshChannelSubscribers 频道成员变动的通知：让涉及的人所在网关重新加载频道订阅
+func RefreshChannelSubscribers(ctx context.Context, kind string, md *pb.MessageData) {
+	if !channelMembershipNotifies[kind] {
+		return
+	}
+	var n GroupNotification
+	if err := json.Unmarshal([]byte(md.GetNotificationElem().GetDetail()), &n); err != nil {
+		logger.Errorf("[Channel] parse notification type=%s err=%v", kind, err)
+		return
+	}
+	users := n.UserIDs
+	if n.OperatorUserID != "" {
+		users = append(users, n.OperatorUserID)
+	}
+	online.NotifyChannelsChanged(ctx, users...)
+}
+
+// channelMember 频道的正常成员（订阅者）；不是频道或不是成员返回 nil
+func channelMember(ctx context.Context, tenantID, userID, channelID string) (*msgModel.Group, *msgModel.GroupMember, error) {
+	gm := msgModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, channelID)
+	if err != nil || group == nil || group.GroupType != msgModel.GroupTypeChannel || group.Status == msgModel.GroupStatusDismiss {
+		return nil, nil, err
+	}
+	mm := msgModel.GroupMember{}
+	member, err := mm.GetGroupMember(ctx, tenantID, channelID, userID)
+	if err != nil || member == nil || member.Status != msgModel.GroupMemberStatusNormal {
+		return nil, nil, err
+	}
+	return group, member, nil
+}
+
+// channelReadableConversation 订阅者读频道历史时的只读会话视图
+func channelReadableConversation(ctx context.Context, tenantID, userID, channelID string) (*msgModel.Conversation, error) {
+	group, _, err := channelMember(ctx, tenantID, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		// 服务器频道同样读扩散，按频道权限给只读视图
+		return guildReadableConversation(ctx, tenantID, userID, channelID)
+	}
+	return &msgModel.Conversation{
+		TenantID:         tenantID,
+		OwnerUserID:      userID,
+		ConversationID:   seq.ChannelConvID(channelID),
+		ConversationType: int32(seq.ConvTypeChannel),
+		GroupID:          channelID,
+	}, nil
+}
+
+// ChannelItem 我订阅的频道
+type ChannelItem struct {
+	ChannelID   string `json:"channel_id"`
+	Name        string `json:"name"`
+	FaceURL     string `json:"face_url"`
+	MemberCount int32  `json:"member_count"`
+	MaxSeq      int64  `json:"max_seq"`
+	ReadSeq     int64  `json:"read_seq"`
+	Unread      int64  `json:"unread"`
+	IsPublisher bool   `json:"is_publisher"`
+}
+
+// ListMyChannels 订阅的频道和未读数（频道水位 - 已读游标）
+func ListMyChannels(ctx context.Context, tenantID, userID string) ([]*ChannelItem, error) {
+	mm := msgModel.GroupMember{}
+	rows, err := mm.ListUserGroups(ctx, tenantID, userID)
+	if err != nil || len(rows) == 0 {
+		return []*ChannelItem{}, err
+	}
+	byGroup := make(map[string]*msgModel.GroupMember, len(rows))
+	groupIDs := make([]string, 0, len(rows))
+	for _, r := range rows {
+		byGroup[r.GroupID] = r
+		groupIDs = append(groupIDs, r.GroupID)
+	}
+
+	gm := msgModel.Group{}
+	groups, err := gm.ListGroupsByType(ctx, tenantID, groupIDs, msgModel.GroupTypeChannel)
+	if err != nil {
+		return nil, err
+	}
+	convIDs := make([]string, 0, len(groups))
+	for _, g := range groups {
+		convIDs = append(convIDs, seq.ChannelConvID(g.GroupID))
+	}
+	sc := msgModel.SeqConversation{}
+	maxSeqs, err := sc.ListMaxSeqs(ctx, tenantID, convIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*ChannelItem, 0, len(groups))
+	for _, g := range groups {
+		m := byGroup[g.GroupID]
+		item := &ChannelItem{
+			ChannelID:   g.GroupID,
+			Name:        g.GroupName,
+			FaceURL:     g.FaceURL,
+			MemberCount: g.MemberCount,
+			MaxSeq:      maxSeqs[seq.ChannelConvID(g.GroupID)],
+			ReadSeq:     m.LastReadSeq,
+			IsPublisher: m.IsPublisher(),
+		}
+		if item.MaxSeq > item.ReadSeq {
+			item.Unread = item.MaxSeq - item.ReadSeq
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// MarkChannelRead 推进频道已读游标；readSeq<=0 表示读到最新，超过水位按水位算。返回推进后的游标
+func MarkChannelRead(ctx context.Context, tenantID, userID, channelID string, readSeq int64) (int64, error) {
+	if channelID == "" {
+		return 0, errors.ErrArgs.WrapMsg("channel_id is empty")
+	}
+	group, member, err := channelMember(ctx, tenantID, userID, channelID)
+	if err != nil {
+		return 0, err
+	}
+	if group == nil {
+		return 0, errors.ErrNotGroupMember.WrapMsg("not channel subscriber", "channel_id", channelID, "user_id", userID)
+	}
+
+	sc := msgModel.SeqConversation{}
+	conv, err := sc.GetSeqConversation(ctx, tenantID, seq.ChannelConvID(channelID))
+	if err != nil {
+		return 0, err
+	}
+	var maxSeq int64
+	if conv != nil {
+		maxSeq = conv.MaxSeq
+	}
+	if readSeq <= 0 || readSeq > maxSeq {
+		readSeq = maxSeq
+	}
+	if readSeq <= member.LastReadSeq {
+		return member.LastReadSeq, nil
+	}
+	mm := msgModel.GroupMember{}
+	if _, err := mm.MarkGroupRead(ctx, tenantID, channelID, userID, readSeq); err != nil {
+		return 0, err
+	}
+	return readSeq, nil
+}
+
+// SetChannelPublisher 授予/收回频道发布者（群主/管理员）；群主/管理员本身就能发，不用授予
+func SetChannelPublisher(ctx context.Context, tenantID, userID, channelID, targetID string, enable bool) error {
+	if targetID == "" {
+		return errors.ErrArgs.WrapMsg("user_id is empty")
+	}
+	group, self, err := groupOperator(ctx, tenantID, channelID, userID, 0)
+	if err != nil {
+		return err
+	}
+	if group.GroupType != msgModel.GroupTypeChannel {
+		return errors.ErrArgs.WrapMsg("not a channel", "group_id", channelID)
+	}
+	if !self.IsManager() {
+		return errors.ErrNoPermission.WrapMsg("only owner or admin can set publishers", "group_id", channelID)
+	}
+	mm := msgModel.GroupMember{}
+	ok, err := mm.SetMemberRole(ctx, tenantID, channelID, targetID, msgModel.GroupRolePublisher, enable)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrNotGroupMember.WrapMsg("not channel subscriber", "channel_id", channelID, "user_id", targetID)
+	}
+	notifySystemEvent(ctx, tenantID, ChannelEventPublisher, []string{targetID}, map[string]string{
+		"channel_id":       channelID,
+		"operator_user_id": userID,
+		"enabled":          strconv.FormatBool(enable),
+	})
+	return nil
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/service/chat"
+	online "PProject/service/storage"
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	channelRefresh = online.ChannelGatewayTTL / 3 // 网关续期频道路由的间隔
+	channelRetry   = 3 * time.Second              // Redis 订阅断开后的重连间隔
+)
+
+// ChannelHub 网关内的频道订阅（广播频道、服务器）
+// 连接鉴权后加载用户订阅的频道，本网关第一次有某频道的订阅者时登记频道路由，最后一个走了注销；
+// 数据节点按路由给每个网关只发一帧，这里按本地订阅者展开下发
+type ChannelHub struct {
+	gatewayID string
+	tenantID  string
+
+	mu    sync.RWMutex
+	conns map[string]*channelSub    // snowID -> 该连接订阅的频道
+	subs  map[string]map[string]int // 频道 -> 订阅者 -> 本网关连接数
+}
+
+type channelSub struct {
+	user     string
+	channels []string
+	filter   *chat.ConnFilter // 连接的意图/分片，决定订阅哪些路由
+}
+
+func NewChannelHub(gatewayID, tenantID string) *ChannelHub {
+	return &ChannelHub{
+		gatewayID: gatewayID,
+		tenantID:  tenantID,
+		conns:     make(map[string]*channelSub),
+		subs:      make(map[string]map[string]int),
+	}
+}
+
+var localChannelHub *ChannelHub
+
+// SetLocalChannelHub 网关启动时设置本进程的频道订阅（数据节点/API 节点没有）
+func SetLocalChannelHub(h *ChannelHub) { localChannelHub = h }
+
+// LocalChannelHub 本进程的频道订阅，非网关为 nil
+func LocalChannelHub() *ChannelHub { return localChannelHub }
+
+// ListUserChannelRoutes 用户订阅的频道路由：服务器频道按服务器ID，广播频道按群ID
+func ListUserChannelRoutes(ctx context.Context, tenantID, userID string) (guildIDs, channelIDs []string, err error) {
+	gdm := msgModel.GuildMember{}
+	guildIDs, err = gdm.ListUserGuildIDs(ctx, tenantID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mm := msgModel.GroupMember{}
+	rows, err := mm.ListUserGroups(ctx, tenantID, userID)
+	if err != nil || len(rows) == 0 {
+		return guildIDs, nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.GroupID)
+	}
+	gm := msgModel.Group{}
+	groups, err := gm.ListGroupsByType(ctx, tenantID, ids, msgModel.GroupTypeChannel)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, g := range groups {
+		channelIDs = append(channelIDs, g.GroupID)
+	}
+	return guildIDs, channelIDs, nil
+}
+
+// Subscribe 连接鉴权后订阅用户所在的频道；分片连接只订阅落在本分片的服务器
+func (h *ChannelHub) Subscribe(ctx context.Context, userID, snowID string, filter *chat.ConnFilter) error {
+	guildIDs, channelIDs, err := ListUserChannelRoutes(ctx, h.tenantID, userID)
+	if err != nil {
+		return err
+	}
+	channels := make([]string, 0, len(guildIDs)+len(channelIDs))
+	for _, id := range guildIDs {
+		if filter.AllowRoute(id, true) {
+			channels = append(channels, id)
+		}
+	}
+	for _, id := range channelIDs {
+		if filter.AllowRoute(id, false) {
+			channels = append(channels, id)
+		}
+	}
+
+	h.mu.Lock()
+	gone := h.unsubscribeLocked(snowID)
+	var added []string
+	h.conns[snowID] = &channelSub{user: userID, channels: channels, filter: filter}
+	for _, ch := range channels {
+		if h.subs[ch] == nil {
+			h.subs[ch] = make(map[string]int)
+			added = append(added, ch)
+		}
+		h.subs[ch][userID]++
+	}
+	gone = h.stillEmptyLocked(gone)
+	h.mu.Unlock()
+
+	if err := online.RegisterChannelGateway(ctx, h.gatewayID, added...); err != nil {
+		return err
+	}
+	return online.UnregisterChannelGateway(ctx, h.gatewayID, gone...)
+}
+
+// Unsubscribe 连接关闭
+func (h *ChannelHub) Unsubscribe(_, snowID string) {
+	h.mu.Lock()
+	gone := h.unsubscribeLocked(snowID)
+	h.mu.Unlock()
+	if len(gone) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := online.UnregisterChannelGateway(ctx, h.gatewayID, gone...); err != nil {
+		logger.Errorf("[ChannelHub] unregister channels=%v err=%v", gone, err)
+	}
+}
+
+// unsubscribeLocked 去掉连接的订阅，返回本网关已没有订阅者的频道
+func (h *ChannelHub) unsubscribeLocked(snowID string) []string {
+	s := h.conns[snowID]
+	if s == nil {
+		return nil
+	}
+	delete(h.conns, snowID)
+	var gone []string
+	for _, ch := range s.channels {
+		us := h.subs[ch]
+		if us[s.user]--; us[s.user] <= 0 {
+			delete(us, s.user)
+		}
+		if len(us) == 0 {
+			delete(h.subs, ch)
+			gone = append(gone, ch)
+		}
+	}
+	return gone
+}
+
+// stillEmptyLocked 过滤掉重新订阅后又有人的频道
+func (h *ChannelHub) stillEmptyLocked(channels []string) []string {
+	out := channels[:0]
+	for _, ch := range channels {
+		if _, ok := h.subs[ch]; !ok {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// Subscribers 本网关上订阅了该频道的用户
+func (h *ChannelHub) Subscribers(channelID string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]string, 0, len(h.subs[channelID]))
+	for u := range h.subs[channelID] {
+		out = append(out, u)
+	}
+	return out
+}
+
+// reload 订阅的频道变了：重新加载该用户在本网关所有连接
+func (h *ChannelHub) reload(ctx context.Context, userID string) {
+	h.mu.RLock()
+	snows := make(map[string]*chat.ConnFilter)
+	for sid, s := range h.conns {
+		if s.user == userID {
+			snows[sid] = s.filter
+		}
+	}
+	h.mu.RUnlock()
+
+	for sid, filter := range snows {
+		if err := h.Subscribe(ctx, userID, sid, filter); err != nil {
+			logger.Errorf("[ChannelHub] reload user=%s snowID=%s err=%v", userID, sid, err)
+		}
+	}
+}
+
+// refresh 续期本网关所有频道的路由
+func (h *ChannelHub) refresh(ctx context.Context) {
+	h.mu.RLock()
+	channels := make([]string, 0, len(h.subs))
+	for ch := range h.subs {
+		channels = append(channels, ch)
+	}
+	h.mu.RUnlock()
+	if err := online.RegisterChannelGateway(ctx, h.gatewayID, channels...); err != nil {
+		logger.Errorf("[ChannelHub] refresh %d channels err=%v", len(channels), err)
+	}
+}
+
+// Run 定时续期频道路由并订阅频道变更事件，阻塞到 ctx 结束
+func (h *ChannelHub) Run(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(channelRefresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				h.refresh(ctx)
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		err := online.GetManager().SubscribeChanges(ctx, func(c online.OnlineChange) {
+			if c.Kind == online.OnlineEventChannels {
+				go h.reload(ctx, c.UserID)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Errorf("[ChannelHub] subscribe online changes err=%v, retry in %v", err, channelRetry)
+		select {
+		case <-ctx.Done():
+		case <-time.After(channelRetry):
+		}
+	}
+}
+
+// RelayChannelFrame 网关收到频道广播帧：下发给本网关的订阅者，发送者自己除外（群通知例外）
+func RelayChannelFrame(frame *pb.MessageFrameData) {
+	h := LocalChannelHub()
+	if h == nil {
+		return
+	}
+	f := proto.Clone(frame).(*pb.MessageFrameData)
+	_, system := f.Meta[chat.MetaSystemNotify]
+	delete(f.Meta, chat.MetaSystemNotify)
+
+	users := h.Subscribers(f.GetMeta()[chat.MetaChannel])
+	// 服务器频道按服务器路由下发，只给能看到该频道的成员
+	if guildID := f.GetPayload().GetGuildId(); guildID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		viewers, err := FilterGuildChannelViewers(ctx, h.tenantID, guildID, f.GetPayload().GetChannelId(), users)
+		if err != nil {
+			logger.Errorf("[ChannelHub] filter guild=%s channel=%s err=%v", guildID, f.GetPayload().GetChannelId(), err)
+			return
+		}
+		users = viewers
+	}
+	recipients := users[:0]
+	for _, u := range users {
+		if system || u != f.From {
+			recipients = append(recipients, u)
+		}
+	}
+	chat.RelayFrameToUsers(f, recipients)
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestChannelHubUnsubscribe(t *testing.T) {
+	h := NewChannelHub("gw1", "t1")
+	add := func(user, snow string, channels ...string) {
+		h.conns[snow] = &channelSub{user: user, channels: channels}
+		for _, ch := range channels {
+			if h.subs[ch] == nil {
+				h.subs[ch] = make(map[string]int)
+			}
+			h.subs[ch][user]++
+		}
+	}
+	add("u1", "s1", "c1", "c2")
+	add("u1", "s2", "c1")
+	add("u2", "s3", "c1")
+
+	subs := h.Subscribers("c1")
+	slices.Sort(subs)
+	if !slices.Equal(subs, []string{"u1", "u2"}) {
+		t.Fatalf("c1 subscribers = %v", subs)
+	}
+
+	// u1 还有另一条连接订阅 c1，只有 c2 没人了
+	if gone := h.unsubscribeLocked("s1"); !slices.Equal(gone, []string{"c2"}) {
+		t.Fatalf("gone after s1 = %v", gone)
+	}
+	if gone := h.unsubscribeLocked("s2"); len(gone) != 0 {
+		t.Fatalf("gone after s2 = %v", gone)
+	}
+	if subs := h.Subscribers("c1"); !slices.Equal(subs, []string{"u2"}) {
+		t.Fatalf("c1 subscribers after u1 left = %v", subs)
+	}
+	if gone := h.unsubscribeLocked("s3"); !slices.Equal(gone, []string{"c1"}) {
+		t.Fatalf("gone after s3 = %v", gone)
+	}
+}
@@ -0,0 +1,381 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	msgModel "PProject/module/chat/model"
+	redis2 "PProject/service/storage/redis"
+	errors "PProject/tools/errs"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	convSyncDefaultPageSize = 100
+	convSyncMaxPageSize     = 500
+	convListMax             = 1000                // 会话列表接口一次最多返回的会话数
+	convVersionKeyTTL       = 30 * 24 * time.Hour // 版本计数器闲置过期；过期后按当前时间继续递增，不会回退
+	convVersionInflightTTL  = 30 * time.Second    // 分配后这么久还没写完 Mongo，视为写入方已丢失，不再挡同步游标
+)
+
+// SYNC 帧的子模式：客户端在 meta 里指定，服务端回同一种 SYNC 帧
+const (
+	MetaSyncMode          = "sync_mode"
+	MetaSyncCursor        = "cursor"
+	MetaSyncSize          = "size"
+	SyncModeConversations = "conversations" // 会话列表增量同步
+)
+
+// 会话免打扰选项（Conversation.RecvMsgOpt）
+const (
+	RecvMsgOptNormal    = 0 // 正常接收并提醒
+	RecvMsgOptNotRecv   = 1 // 不接收
+	RecvMsgOptNotNotify = 2 // 接收不提醒
+)
+
+// 用户会话版本号：计数器和当前微秒时间取大再 +1，同一用户严格递增；Redis 丢数据后从当前时间继续，旧游标仍然有效
+// 分配的版本同时记进 in-flight 集合，写进 Mongo 后移除：版本号分配和落库不是原子的，后分配的可能先落库，
+// 同步游标不能越过还没落库的版本，否则那条变更会被跳过
+// KEYS[1]=counter; KEYS[2]=inflight; ARGV[1]=nowMicro; ARGV[2]=ttlSeconds; ARGV[3]=inflightTTLSeconds
+var luaNextConvVersion = redis.NewScript(`
+  local v = tonumber(redis.call('GET', KEYS[1]) or '0')
+  local floor = tonumber(ARGV[1])
+  if v < floor then v = floor else v = v + 1 end
+  local s = string.format('%d', v)
+  redis.call('SET', KEYS[1], s, 'EX', tonumber(ARGV[2]))
+  redis.call('ZADD', KEYS[2], s, s)
+  redis.call('EXPIRE', KEYS[2], tonumber(ARGV[3]))
+  return v
+`)
+
+func convVersionKey(tenantID, userID string) string {
+	return "conv:ver:" + tenantID + ":{" + userID + "}"
+}
+
+func convInflightKey(tenantID, userID string) string {
+	return "conv:ver:inflight:" + tenantID + ":{" + userID + "}"
+}
+
+// NextConversationVersions 给一批用户各分配一个新的会话版本号（一次往返）；写完 Mongo 后要 ReleaseConversationVersions
+func NextConversationVersions(ctx context.Context, tenantID string, owners []string) (map[string]int64, error) {
+	if len(owners) == 0 {
+		return nil, nil
+	}
+	now := time.Now().UnixMicro()
+	ttl := int64(convVersionKeyTTL / time.Second)
+	inflightTTL := int64(convVersionInflightTTL / time.Second)
+	pipe := redis2.GetRedis().Pipeline()
+	cmds := make(map[string]*redis.Cmd, len(owners))
+	for _, owner := range owners {
+		if owner == "" || cmds[owner] != nil {
+			continue
+		}
+		keys := []string{convVersionKey(tenantID, owner), convInflightKey(tenantID, owner)}
+		cmds[owner] = luaNextConvVersion.Eval(ctx, pipe, keys, now, ttl, inflightTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(cmds))
+	for owner, cmd := range cmds {
+		v, err := cmd.Int64()
+		if err != nil {
+			return nil, err
+		}
+		out[owner] = v
+	}
+	return out, nil
+}
+
+// ReleaseConversationVersions 版本已写进 Mongo（或放弃写入），不再挡同步游标
+func ReleaseConversationVersions(ctx context.Context, tenantID string, versions map[string]int64) {
+	if len(versions) == 0 {
+		return
+	}
+	pipe := redis2.GetRedis().Pipeline()
+	for owner, v := range versions {
+		pipe.ZRem(ctx, convInflightKey(tenantID, owner), strconv.FormatInt(v, 10))
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+// convSyncWatermark 用户最小的未落库版本，0 表示没有；超过 convVersionInflightTTL 的视为已丢失
+func convSyncWatermark(ctx context.Context, tenantID, userID string) (int64, error) {
+	key := convInflightKey(tenantID, userID)
+	stale := time.Now().Add(-convVersionInflightTTL).UnixMicro()
+	pipe := redis2.GetRedis().Pipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(stale, 10))
+	low := pipe.ZRangeWithScores(ctx, key, 0, 0)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if zs := low.Val(); len(zs) > 0 {
+		return int64(zs[0].Score), nil
+	}
+	return 0, nil
+}
+
+// TouchConversations 会话对这些用户有变化（新消息/已读/@/设置），前移他们的会话版本，供增量同步
+func TouchConversations(ctx context.Context, tenantID, conversationID string, owners []string) error {
+	versions, err := NextConversationVersions(ctx, tenantID, owners)
+	if err != nil {
+		return err
+	}
+	defer ReleaseConversationVersions(ctx, tenantID, versions)
+	cm := msgModel.Conversation{}
+	return cm.SetVersions(ctx, tenantID, conversationID, versions)
+}
+
+// ConversationUnread 未读数 = server_max_seq - read_seq；清空过历史的部分不算未读
+func ConversationUnread(c *msgModel.Conversation) int64 {
+	read := c.ReadSeq
+	if c.MinSeq > 0 && read < c.MinSeq-1 {
+		read = c.MinSeq - 1
+	}
+	if n := c.ServerMaxSeq - read; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// BuildConversationPB Conversation -> pb.Conversation；latest 为会话最新一条消息，可以为空
+func BuildConversationPB(c *msgModel.Conversation, latest *msgModel.MessageModel) *pb.Conversation {
+	out := &pb.Conversation{
+		TenantId:         c.TenantID,
+		OwnerUserId:      c.OwnerUserID,
+		ConversationId:   c.ConversationID,
+		ConversationType: c.ConversationType,
+		UserId:           c.UserID,
+		GroupId:          c.GroupID,
+
+		ReadSeq:       c.ReadSeq,
+		ReadOutboxSeq: c.ReadOutboxSeq,
+		LocalMaxSeq:   c.LocalMaxSeq,
+		MinSeq:        c.MinSeq,
+		ServerMaxSeq:  c.ServerMaxSeq,
+
+		MentionUnread:    c.MentionUnread,
+		MentionReadSeq:   c.MentionReadSeq,
+		UnreadCount:      ConversationUnread(c),
+		PerDeviceReadSeq: c.PerDeviceReadSeq,
+
+		IsPinned:   c.IsPinned,
+		RecvMsgOpt: c.RecvMsgOpt,
+
+		UpdatedAt: c.UpdatedAt.UnixMilli(),
+		Version:   c.Version,
+	}
+	if latest != nil {
+		out.LatestMsg = BuildPBFromMessageModel(latest)
+	}
+	return out
+}
+
+// latestMessages 批量取各会话的最新一条消息（server_max_seq 处）；清空历史后不可见的不取
+func latestMessages(ctx context.Context, tenantID string, convs []*msgModel.Conversation) (map[string]*msgModel.MessageModel, error) {
+	seqs := make(map[string]int64, len(convs))
+	for _, c := range convs {
+		if c.ServerMaxSeq > 0 && c.ServerMaxSeq >= c.MinSeq {
+			seqs[c.ConversationID] = c.ServerMaxSeq
+		}
+	}
+	list, err := msgModel.GetMessagesAtSeqs(ctx, tenantID, seqs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*msgModel.MessageModel, len(list))
+	for _, m := range list {
+		out[m.ConversationID] = m
+	}
+	return out, nil
+}
+
+func buildConversationPBs(ctx context.Context, tenantID string, convs []*msgModel.Conversation) ([]*pb.Conversation, error) {
+	latest, err := latestMessages(ctx, tenantID, convs)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*pb.Conversation, 0, len(convs))
+	for _, c := range convs {
+		items = append(items, BuildConversationPB(c, latest[c.ConversationID]))
+	}
+	return items, nil
+}
+
+// convCursor 增量同步游标：<version>:<conversation_id>，空表示从头全量同步
+type convCursor struct {
+	Version        int64
+	ConversationID string
+}
+
+func (c convCursor) String() string {
+	return fmt.Sprintf("%d:%s", c.Version, c.ConversationID)
+}
+
+func parseConvCursor(s string) (convCursor, error) {
+	if s == "" {
+		return convCursor{}, nil
+	}
+	v, convID, ok := strings.Cut(s, ":")
+	if !ok {
+		return convCursor{}, fmt.Errorf("bad cursor %q", s)
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return convCursor{}, err
+	}
+	return convCursor{Version: n, ConversationID: convID}, nil
+}
+
+// SyncConversations 增量同步会话列表：返回游标之后有变化的会话（按版本升序）
+// next_cursor 始终返回，客户端保存后下次原样带回；has_more 时立即继续拉
+func SyncConversations(ctx context.Context, tenantID, userID, cursor string, size int64) (*pb.SyncConversations, error) {
+	cur, err := parseConvCursor(cursor)
+	if err != nil {
+		return nil, errors.ErrArgs.WrapMsg(err.Error())
+	}
+	if size <= 0 {
+		size = convSyncDefaultPageSize
+	}
+	if size > convSyncMaxPageSize {
+		size = convSyncMaxPageSize
+	}
+
+	// 先取水位再查：查询时还没落库的版本不能被游标越过
+	low, err := convSyncWatermark(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	cm := msgModel.Conversation{}
+	list, err := cm.ListConversationsAfter(ctx, tenantID, userID, cur.Version, cur.ConversationID, size+1)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.SyncConversations{NextCursor: cursor}
+	if int64(len(list)) > size {
+		list = list[:size]
+		resp.HasMore = true
+	}
+	list, held := holdBackConversations(list, low)
+	if held {
+		// 后面的等在途写入落库后下次同步再取
+		resp.HasMore = false
+	}
+	if len(list) > 0 {
+		last := list[len(list)-1]
+		resp.NextCursor = convCursor{Version: last.Version, ConversationID: last.ConversationID}.String()
+	}
+	if resp.Conversations, err = buildConversationPBs(ctx, tenantID, list); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// holdBackConversations 去掉版本不小于 low（最小在途版本）的会话；list 按版本升序
+func holdBackConversations(list []*msgModel.Conversation, low int64) ([]*msgModel.Conversation, bool) {
+	if low <= 0 {
+		return list, false
+	}
+	for i, c := range list {
+		if c.Version >= low {
+			return list[:i], true
+		}
+	}
+	return list, false
+}
+
+// ListConversations 会话列表（置顶在前，再按最新消息时间倒序），同时给出增量同步的起始游标
+// 会话数超过上限时 has_more=true、不给游标，客户端改用 SyncConversations 分页全量同步
+func ListConversations(ctx context.Context, tenantID, userID string) (*pb.SyncConversations, error) {
+	low, err := convSyncWatermark(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	cm := msgModel.Conversation{}
+	list, err := cm.ListUserConversations(ctx, tenantID, userID, convListMax+1)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.SyncConversations{}
+	if len(list) > convListMax {
+		list = list[:convListMax]
+		resp.HasMore = true
+	}
+	items, err := buildConversationPBs(ctx, tenantID, list)
+	if err != nil {
+		return nil, err
+	}
+
+	var maxCur convCursor
+	for _, c := range list {
+		if c.Version > maxCur.Version || (c.Version == maxCur.Version && c.ConversationID > maxCur.ConversationID) {
+			maxCur = convCursor{Version: c.Version, ConversationID: c.ConversationID}
+		}
+	}
+	// 游标不越过在途版本：退到它前面，下次同步会把它之后的再拉一遍（重复的按会话 ID 覆盖）
+	if low > 0 && maxCur.Version >= low {
+		maxCur = convCursor{Version: low - 1}
+	}
+	if !resp.HasMore && len(list) > 0 {
+		resp.NextCursor = maxCur.String()
+	}
+
+	activeAt := func(c *pb.Conversation) int64 {
+		if m := c.GetLatestMsg(); m != nil && m.GetSendTime() > 0 {
+			return m.GetSendTime()
+		}
+		return c.GetUpdatedAt()
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].GetIsPinned() != items[j].GetIsPinned() {
+			return items[i].GetIsPinned()
+		}
+		return activeAt(items[i]) > activeAt(items[j])
+	})
+	resp.Conversations = items
+	return resp, nil
+}
+
+// ConversationSettings 可修改的会话设置，nil 表示不改
+type ConversationSettings struct {
+	IsPinned   *bool  `json:"is_pinned,omitempty"`
+	RecvMsgOpt *int32 `json:"recv_msg_opt,omitempty"`
+}
+
+// UpdateConversationSettings 修改自己的会话设置（置顶/免打扰），并前移会话版本
+func UpdateConversationSettings(ctx context.Context, tenantID, userID, conversationID string, in *ConversationSettings) error {
+	if conversationID == "" || in == nil {
+		return errors.ErrArgs.WrapMsg("conversation_id is empty")
+	}
+	set := bson.M{}
+	if in.IsPinned != nil {
+		set[msgModel.ConversationFieldIsPinned] = *in.IsPinned
+	}
+	if in.RecvMsgOpt != nil {
+		switch *in.RecvMsgOpt {
+		case RecvMsgOptNormal, RecvMsgOptNotRecv, RecvMsgOptNotNotify:
+		default:
+			return errors.ErrArgs.WrapMsg("invalid recv_msg_opt", "recv_msg_opt", *in.RecvMsgOpt)
+		}
+		set[msgModel.ConversationFieldRecvMsgOpt] = *in.RecvMsgOpt
+	}
+	if len(set) == 0 {
+		return errors.ErrArgs.WrapMsg("nothing to update")
+	}
+
+	cm := msgModel.Conversation{}
+	found, err := cm.UpdateUserSettings(ctx, tenantID, userID, conversationID, set)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.ErrRecordNotFound.WrapMsg("conversation not found", "conversation_id", conversationID)
+	}
+	return TouchConversations(ctx, tenantID, conversationID, []string{userID})
+}
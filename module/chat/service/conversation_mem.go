@@ -0,0 +1,23 @@
+package service
+
+import (
+	redis2 "PProject/service/storage/redis"
+	"strconv"
+)
+
+// 内存 Redis 下 luaNextConvVersion 的等价实现（单进程开发模式）
+func init() {
+	redis2.RegisterScript(luaNextConvVersion, func(c *redis2.ScriptCall) any {
+		v, _ := c.Call("GET", c.Keys[0]).(string)
+		n, _ := strconv.ParseInt(v, 10, 64)
+		if floor := c.ArgInt(0); n < floor {
+			n = floor
+		} else {
+			n++
+		}
+		c.Call("SET", c.Keys[0], n, "EX", c.ArgInt(1))
+		c.Call("ZADD", c.Keys[1], n, n)
+		c.Call("EXPIRE", c.Keys[1], c.ArgInt(2))
+		return n
+	})
+}
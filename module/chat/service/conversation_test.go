@@ -0,0 +1,128 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	memRedisOnce sync.Once
+	memRedisErr  error
+)
+
+// useMemoryRedis 全局 Redis 只能初始化一次，包内测试共用一个内存 Redis
+func useMemoryRedis(t *testing.T) {
+	t.Helper()
+	memRedisOnce.Do(func() { _, memRedisErr = redis2.InitMemoryRedis() })
+	if memRedisErr != nil {
+		t.Fatal(memRedisErr)
+	}
+}
+
+func TestNextConversationVersionsOnMemoryRedis(t *testing.T) {
+	useMemoryRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, err := NextConversationVersions(ctx, "t1", []string{"u1", "u2", "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first["u1"] < time.Now().Add(-time.Minute).UnixMicro() {
+		t.Fatalf("first = %v", first)
+	}
+	second, err := NextConversationVersions(ctx, "t1", []string{"u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second["u1"] <= first["u1"] {
+		t.Fatalf("version not increasing: %d -> %d", first["u1"], second["u1"])
+	}
+
+	// 计数器丢了也不回退
+	if err := redis2.GetRedis().Del(ctx, convVersionKey("t1", "u1")).Err(); err != nil {
+		t.Fatal(err)
+	}
+	third, err := NextConversationVersions(ctx, "t1", []string{"u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third["u1"] <= first["u1"] {
+		t.Fatalf("version went back after reset: %d -> %d", first["u1"], third["u1"])
+	}
+}
+
+func TestConvCursor(t *testing.T) {
+	c := convCursor{Version: 1700000000000001, ConversationID: "p2p:a_b"}
+	got, err := parseConvCursor(c.String())
+	if err != nil || got != c {
+		t.Fatalf("round trip = %+v, %v", got, err)
+	}
+	if got, err := parseConvCursor(""); err != nil || got != (convCursor{}) {
+		t.Fatalf("empty = %+v, %v", got, err)
+	}
+	if _, err := parseConvCursor("abc"); err == nil {
+		t.Fatal("bad cursor should fail")
+	}
+}
+
+func TestConversationUnread(t *testing.T) {
+	cases := []struct {
+		c    msgModel.Conversation
+		want int64
+	}{
+		{msgModel.Conversation{ServerMaxSeq: 10, ReadSeq: 4}, 6},
+		{msgModel.Conversation{ServerMaxSeq: 10, ReadSeq: 12}, 0},
+		{msgModel.Conversation{ServerMaxSeq: 10, ReadSeq: 2, MinSeq: 8}, 3}, // 清空历史前的不算
+	}
+	for _, tc := range cases {
+		if got := ConversationUnread(&tc.c); got != tc.want {
+			t.Errorf("%+v unread = %d, want %d", tc.c, got, tc.want)
+		}
+	}
+}
+
+func TestConvSyncWatermark(t *testing.T) {
+	useMemoryRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if low, err := convSyncWatermark(ctx, "t2", "u1"); err != nil || low != 0 {
+		t.Fatalf("empty watermark = %d, %v", low, err)
+	}
+	first, err := NextConversationVersions(ctx, "t2", []string{"u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NextConversationVersions(ctx, "t2", []string{"u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 后分配的先落库：水位仍停在先分配、还没落库的那个
+	ReleaseConversationVersions(ctx, "t2", second)
+	if low, err := convSyncWatermark(ctx, "t2", "u1"); err != nil || low != first["u1"] {
+		t.Fatalf("watermark = %d, %v want %d", low, err, first["u1"])
+	}
+	ReleaseConversationVersions(ctx, "t2", first)
+	if low, err := convSyncWatermark(ctx, "t2", "u1"); err != nil || low != 0 {
+		t.Fatalf("watermark after release = %d, %v", low, err)
+	}
+}
+
+func TestHoldBackConversations(t *testing.T) {
+	list := []*msgModel.Conversation{{ConversationID: "a", Version: 10}, {ConversationID: "b", Version: 20}, {ConversationID: "c", Version: 30}}
+	if got, held := holdBackConversations(list, 0); len(got) != 3 || held {
+		t.Fatalf("no in-flight: %d held=%v", len(got), held)
+	}
+	if got, held := holdBackConversations(list, 20); len(got) != 1 || !held {
+		t.Fatalf("in-flight 20: %d held=%v", len(got), held)
+	}
+	if got, held := holdBackConversations(list, 40); len(got) != 3 || held {
+		t.Fatalf("in-flight after page: %d held=%v", len(got), held)
+	}
+}
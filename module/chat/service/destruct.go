@@ -0,0 +1,156 @@
+package service
+
+import (
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 销毁队列：ZSET，member = tenant|server_msg_id，score = 销毁时间（ms）
+const destructQueueKey = "im:destruct:due"
+
+// 开始倒计时时每页处理的阅后即焚消息数
+const burnCountdownBatch = 500
+
+// 重建销毁队列时每页读取的消息数
+const destructReconcileBatch = 1000
+
+// 查待销毁的消息（测试里换成内存实现）
+var listExpiringMessages = msgModel.ListExpiringMessages
+
+// 原子取出到期项：先取再删，多个数据节点同时轮询也不会重复销毁
+// KEYS[1]=queue; ARGV[1]=nowMs; ARGV[2]=limit
+var luaPopDue = redis.NewScript(`
+  local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+  if #items > 0 then
+    redis.call('ZREM', KEYS[1], unpack(items))
+  end
+  return items
+`)
+
+// DestructItem 一条到期待销毁的消息
+type DestructItem struct {
+	TenantID    string
+	ServerMsgID string
+}
+
+func destructMember(tenantID, serverMsgID string) string {
+	return tenantID + "|" + serverMsgID
+}
+
+// ApplyDestructPolicy 消息未自带销毁设置时，按发送者会话上的默认值补齐：
+// 私聊模式（is_private_chat）给出阅后即焚时长，is_msg_destruct 给出定时销毁时长
+func ApplyDestructPolicy(ctx context.Context, tenantID string, m *msgModel.MessageModel) error {
+	if m == nil || m.IsEphemeral == 1 || (m.BurnDuration > 0 && m.ExpireAtMS > 0) {
+		return nil
+	}
+	cm := msgModel.Conversation{}
+	conv, err := cm.GetUserConversation(ctx, tenantID, m.SendID, m.ConversationID)
+	if err != nil || conv == nil {
+		return err
+	}
+	if m.BurnDuration <= 0 && conv.IsPrivateChat && conv.BurnDuration > 0 {
+		m.BurnDuration = conv.BurnDuration
+	}
+	if m.ExpireAtMS <= 0 && conv.IsMsgDestruct && conv.MsgDestructTime > 0 {
+		m.ExpireAtMS = m.SendTimeMS + conv.MsgDestructTime*1000
+	}
+	return nil
+}
+
+// ScheduleDestruct 消息落库后，有销毁时间的放进销毁队列
+func ScheduleDestruct(ctx context.Context, tenantID string, m *msgModel.MessageModel) error {
+	if m == nil || m.ExpireAtMS <= 0 {
+		return nil
+	}
+	return redis2.GetRedis().ZAdd(ctx, destructQueueKey, redis.Z{
+		Score:  float64(m.ExpireAtMS),
+		Member: destructMember(tenantID, m.ServerMsgID),
+	}).Err()
+}
+
+// StartBurnCountdown 接收方已读到 readSeq：(fromSeq, readSeq] 内的阅后即焚消息开始倒计时
+// 按 seq 分页，一次读很多条也都会开始倒计时
+func StartBurnCountdown(ctx context.Context, tenantID, readerID, conversationID string, fromSeq, readSeq int64) error {
+	now := time.Now().UnixMilli()
+	for fromSeq < readSeq {
+		list, err := msgModel.ListBurnPendingMessages(ctx, tenantID, conversationID, readerID, fromSeq, readSeq, burnCountdownBatch)
+		if err != nil {
+			return err
+		}
+		for _, m := range list {
+			expireAt := now + int64(m.BurnDuration)*1000
+			ok, err := msgModel.SetMessageExpireAt(ctx, tenantID, m.ServerMsgID, expireAt)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			m.ExpireAtMS = expireAt
+			if err := ScheduleDestruct(ctx, tenantID, m); err != nil {
+				return err
+			}
+		}
+		if len(list) < burnCountdownBatch {
+			return nil
+		}
+		fromSeq = list[len(list)-1].Seq
+	}
+	return nil
+}
+
+// PopDueDestructs 取出已到期的销毁项（取出即从队列删除）
+func PopDueDestructs(ctx context.Context, nowMS int64, limit int) ([]DestructItem, error) {
+	res, err := luaPopDue.Run(ctx, redis2.GetRedis(), []string{destructQueueKey}, nowMS, limit).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]DestructItem, 0, len(res))
+	for _, member := range res {
+		tenantID, serverMsgID, ok := strings.Cut(member, "|")
+		if !ok || serverMsgID == "" {
+			continue
+		}
+		items = append(items, DestructItem{TenantID: tenantID, ServerMsgID: serverMsgID})
+	}
+	return items, nil
+}
+
+// RetryDestruct 销毁失败时延后重新入队
+func RetryDestruct(ctx context.Context, item DestructItem, delay time.Duration) error {
+	return redis2.GetRedis().ZAdd(ctx, destructQueueKey, redis.Z{
+		Score:  float64(time.Now().Add(delay).UnixMilli()),
+		Member: destructMember(item.TenantID, item.ServerMsgID),
+	}).Err()
+}
+
+// ReconcileDestructQueue 从 Mongo 重建销毁队列（Redis 丢数据或节点重启后兜底），ZADD 本身幂等
+func ReconcileDestructQueue(ctx context.Context) error {
+	var after primitive.ObjectID
+	total := 0
+	for {
+		list, err := listExpiringMessages(ctx, after, destructReconcileBatch)
+		if err != nil {
+			return err
+		}
+		for _, m := range list {
+			if err := ScheduleDestruct(ctx, m.TenantID, m); err != nil {
+				return err
+			}
+		}
+		total += len(list)
+		if len(list) < destructReconcileBatch {
+			break
+		}
+		after = list[len(list)-1].ID
+	}
+	logger.Infof("destruct queue reconciled, %d messages", total)
+	return nil
+}
@@ -0,0 +1,18 @@
+package service
+
+import redis2 "PProject/service/storage/redis"
+
+// 内存 Redis 下 luaPopDue 的等价实现（单进程开发模式）
+func init() {
+	redis2.RegisterScript(luaPopDue, func(c *redis2.ScriptCall) any {
+		items := c.CallStrings("ZRANGEBYSCORE", c.Keys[0], "-inf", c.Args[0], "LIMIT", 0, c.ArgInt(1))
+		if len(items) > 0 {
+			args := []any{"ZREM", c.Keys[0]}
+			for _, it := range items {
+				args = append(args, it)
+			}
+			c.Call(args...)
+		}
+		return items
+	})
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func resetDestructQueue(t *testing.T) {
+	t.Helper()
+	useMemoryRedis(t)
+	if err := redis2.GetRedis().Del(context.Background(), destructQueueKey).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDestructQueuePopDue(t *testing.T) {
+	resetDestructQueue(t)
+	ctx := context.Background()
+
+	for i, at := range []int64{3000, 1000, 2000, 9000} {
+		m := &msgModel.MessageModel{ServerMsgID: fmt.Sprintf("m%d", i), ExpireAtMS: at}
+		if err := ScheduleDestruct(ctx, "t1", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没设销毁时间的不入队
+	if err := ScheduleDestruct(ctx, "t1", &msgModel.MessageModel{ServerMsgID: "keep"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按到期时间先后取，limit 生效
+	items, err := PopDueDestructs(ctx, 5000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].ServerMsgID != "m1" || items[1].ServerMsgID != "m2" || items[0].TenantID != "t1" {
+		t.Fatalf("first pop = %+v", items)
+	}
+	// 取出即删除，不会被再取一次；未到期的留着
+	items, _ = PopDueDestructs(ctx, 5000, 10)
+	if len(items) != 1 || items[0].ServerMsgID != "m0" {
+		t.Fatalf("second pop = %+v", items)
+	}
+	if items, _ = PopDueDestructs(ctx, 5000, 10); len(items) != 0 {
+		t.Fatalf("third pop = %+v", items)
+	}
+
+	// 失败重试：延后重新入队，到点再取出
+	if err := RetryDestruct(ctx, DestructItem{TenantID: "t1", ServerMsgID: "m0"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ = PopDueDestructs(ctx, time.Now().UnixMilli(), 10); len(items) != 1 || items[0].ServerMsgID != "m3" {
+		t.Fatalf("retry popped early: %+v", items)
+	}
+	items, _ = PopDueDestructs(ctx, time.Now().Add(2*time.Hour).UnixMilli(), 10)
+	if len(items) != 1 || items[0].ServerMsgID != "m0" {
+		t.Fatalf("retry pop = %+v", items)
+	}
+}
+
+func TestDestructQueueConcurrentPop(t *testing.T) {
+	resetDestructQueue(t)
+	ctx := context.Background()
+	for i := 0; i < 200; i++ {
+		m := &msgModel.MessageModel{ServerMsgID: fmt.Sprintf("m%03d", i), ExpireAtMS: int64(1000 + i)}
+		if err := ScheduleDestruct(ctx, "t1", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 多个数据节点同时轮询：每一项只被取出一次
+	var (
+		mu   sync.Mutex
+		seen = map[string]int{}
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				items, err := PopDueDestructs(ctx, 5000, 7)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(items) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, it := range items {
+					seen[it.ServerMsgID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 200 {
+		t.Fatalf("popped %d distinct items", len(seen))
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Fatalf("%s popped %d times", id, n)
+		}
+	}
+}
+
+func TestReconcileDestructQueue(t *testing.T) {
+	resetDestructQueue(t)
+	ctx := context.Background()
+
+	// Mongo 里有 2500 条待销毁的消息（跨三页），Redis 队列丢了
+	all := make([]*msgModel.MessageModel, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		all = append(all, &msgModel.MessageModel{
+			ID:          primitive.NewObjectID(),
+			TenantID:    "t1",
+			ServerMsgID: fmt.Sprintf("m%04d", i),
+			ExpireAtMS:  int64(1000 + i),
+		})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID.Hex() < all[j].ID.Hex() })
+	orig := listExpiringMessages
+	t.Cleanup(func() { listExpiringMessages = orig })
+	pages := 0
+	listExpiringMessages = func(_ context.Context, after primitive.ObjectID, limit int64) ([]*msgModel.MessageModel, error) {
+		pages++
+		i := sort.Search(len(all), func(i int) bool { return all[i].ID.Hex() > after.Hex() })
+		end := min(i+int(limit), len(all))
+		return all[i:end], nil
+	}
+
+	// 重建两次：ZADD 幂等，不会重复入队
+	for round := 0; round < 2; round++ {
+		if err := ReconcileDestructQueue(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pages != 6 {
+		t.Fatalf("pages read = %d, want 3 per round", pages)
+	}
+	n, err := redis2.GetRedis().ZCard(ctx, destructQueueKey).Result()
+	if err != nil || n != 2500 {
+		t.Fatalf("queue size = %d, %v", n, err)
+	}
+	items, err := PopDueDestructs(ctx, 1000, 10)
+	if err != nil || len(items) != 1 || items[0].ServerMsgID != "m0000" {
+		t.Fatalf("first due = %+v, %v", items, err)
+	}
+}
@@ -0,0 +1,542 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/service/chat"
+	online "PProject/service/storage"
+	errors "PProject/tools/errs"
+	ids "PProject/tools/ids"
+	"context"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	friendRequestTTL       = 7 * 24 * time.Hour // 好友申请有效期
+	friendListMax          = int64(5000)
+	friendRequestListMax   = int64(100)
+	blackListMax           = int64(1000)
+	friendReqMsgMaxRunes   = 200
+	friendRemarkMaxRunes   = 64
+	friendTagsMax          = 20
+	friendDefaultAddSource = int32(4) // 未指定来源按搜索添加
+)
+
+// 好友相关的 SYSTEM_EVENT 事件类型（SystemEvent.event_type）
+const (
+	FriendEventRequest  = "friend_request"  // 收到好友申请
+	FriendEventAccepted = "friend_accepted" // 申请已通过（双方）
+	FriendEventRejected = "friend_rejected" // 申请被拒绝
+	FriendEventUpdated  = "friend_updated"  // 备注/标签变更（自己的其他设备）
+	FriendEventDeleted  = "friend_deleted"  // 好友关系已删除（双方）
+	BlackEventAdded     = "black_added"     // 拉黑（自己的其他设备）
+	BlackEventRemoved   = "black_removed"   // 移出黑名单（自己的其他设备）
+)
+
+// FriendItem 好友列表项
+type FriendItem struct {
+	FriendUserID string   `json:"friend_user_id"`
+	Remark       string   `json:"remark"`
+	Tags         []string `json:"tags"`
+	IsPinned     bool     `json:"is_pinned"`
+	IsBlocked    bool     `json:"is_blocked"`
+	IsMuted      bool     `json:"is_muted"`
+	AddSource    int32    `json:"add_source"`
+	CreateTime   int64    `json:"create_time"`
+	UpdateTime   int64    `json:"update_time"`
+}
+
+// FriendRequestItem 好友申请列表项
+type FriendRequestItem struct {
+	RequestID    string   `json:"request_id"`
+	FromUserID   string   `json:"from_user_id"`
+	ToUserID     string   `json:"to_user_id"`
+	ReqMsg       string   `json:"req_msg"`
+	Tags         []string `json:"tags,omitempty"`
+	AddSource    int32    `json:"add_source"`
+	HandleResult int32    `json:"handle_result"` // 0=未处理 1=同意 2=拒绝 3=忽略
+	HandleMsg    string   `json:"handle_msg,omitempty"`
+	Status       int32    `json:"status"` // 0=有效 1=已撤回 2=过期
+	IsRead       bool     `json:"is_read"`
+	CreateTime   int64    `json:"create_time"`
+	HandleTime   int64    `json:"handle_time,omitempty"`
+	ExpireTime   int64    `json:"expire_time"`
+}
+
+// BlackItem 黑名单列表项
+type BlackItem struct {
+	BlockUserID string `json:"block_user_id"`
+	CreateTime  int64  `json:"create_time"`
+}
+
+// FriendRequestInput 发起好友申请
+type FriendRequestInput struct {
+	ToUserID   string   `json:"to_user_id"`
+	ReqMsg     string   `json:"req_msg"`
+	RemarkName string   `json:"remark_name"` // 通过后自己这边给对方的备注
+	Tags       []string `json:"tags"`        // 通过后自己这边给对方的标签
+	AddSource  int32    `json:"add_source"`
+	AddChannel string   `json:"add_channel"`
+}
+
+// FriendRequestMeta 申请方的请求环境（审计用）
+type FriendRequestMeta struct {
+	ClientIP string
+	DeviceID string
+}
+
+// FriendSettings 可修改的好友设置，nil 表示不改
+type FriendSettings struct {
+	Remark *string   `json:"remark,omitempty"`
+	Tags   *[]string `json:"tags,omitempty"`
+}
+
+func msOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func toFriendItem(f *msgModel.Friend) *FriendItem {
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return &FriendItem{
+		FriendUserID: f.FriendUserID,
+		Remark:       f.Remark,
+		Tags:         tags,
+		IsPinned:     f.IsPinned,
+		IsBlocked:    f.IsBlocked,
+		IsMuted:      f.IsMuted,
+		AddSource:    f.AddSource,
+		CreateTime:   msOrZero(f.CreateTime),
+		UpdateTime:   msOrZero(f.UpdateTime),
+	}
+}
+
+func toFriendRequestItem(r *msgModel.FriendRequest, now time.Time) *FriendRequestItem {
+	status := r.Status
+	if status == msgModel.FriendReqStatusValid && r.HandleResult == msgModel.FriendReqResultPending && !r.ExpireTime.After(now) {
+		status = msgModel.FriendReqStatusExpired
+	}
+	return &FriendRequestItem{
+		RequestID:    r.RequestID,
+		FromUserID:   r.FromUserID,
+		ToUserID:     r.ToUserID,
+		ReqMsg:       r.ReqMsg,
+		Tags:         r.Tags,
+		AddSource:    r.AddSource,
+		HandleResult: r.HandleResult,
+		HandleMsg:    r.HandleMsg,
+		Status:       status,
+		IsRead:       r.IsRead,
+		CreateTime:   msOrZero(r.CreateTime),
+		HandleTime:   msOrZero(r.HandleTime),
+		ExpireTime:   msOrZero(r.ExpireTime),
+	}
+}
+
+func checkFriendRemark(remark string, tags []string) error {
+	if utf8.RuneCountInString(remark) > friendRemarkMaxRunes {
+		return errors.ErrArgs.WrapMsg("remark too long", "max", friendRemarkMaxRunes)
+	}
+	if len(tags) > friendTagsMax {
+		return errors.ErrArgs.WrapMsg("too many tags", "max", friendTagsMax)
+	}
+	return nil
+}
+
+// notifySystemEvent 给在线用户推一条 SYSTEM_EVENT（好友/群事件）；通知失败只记日志，客户端上线后会重新拉列表
+func notifySystemEvent(ctx context.Context, tenantID, eventType string, users []string, data map[string]string) {
+	if len(users) == 0 {
+		return
+	}
+	body, err := anypb.New(&pb.SystemEvent{EventType: eventType, Data: data})
+	if err != nil {
+		logger.Errorf("[SystemEvent] pack event=%s err=%v", eventType, err)
+		return
+	}
+	err = publishToGateways(ctx, users[0], users, func(gateway string, gwUsers []string) *pb.MessageFrameData {
+		return chat.BuildSystemEvent(gateway, tenantID, gwUsers, body)
+	})
+	if err != nil {
+		logger.Errorf("[SystemEvent] notify event=%s users=%v err=%v", eventType, users, err)
+	}
+}
+
+func friendRequestEventData(r *msgModel.FriendRequest) map[string]string {
+	return map[string]string{
+		"request_id":    r.RequestID,
+		"from_user_id":  r.FromUserID,
+		"to_user_id":    r.ToUserID,
+		"req_msg":       r.ReqMsg,
+		"handle_result": strconv.Itoa(int(r.HandleResult)),
+		"handle_msg":    r.HandleMsg,
+	}
+}
+
+// SendFriendRequest 发起好友申请：对方把自己拉黑时拒绝；已有待处理申请时刷新留言和有效期；
+// 对方也在申请加自己时直接成为好友
+func SendFriendRequest(ctx context.Context, tenantID, fromUserID string, in *FriendRequestInput, meta FriendRequestMeta) (*FriendRequestItem, error) {
+	if in == nil || in.ToUserID == "" || in.ToUserID == fromUserID {
+		return nil, errors.ErrArgs.WrapMsg("invalid to_user_id")
+	}
+	if utf8.RuneCountInString(in.ReqMsg) > friendReqMsgMaxRunes {
+		return nil, errors.ErrArgs.WrapMsg("req_msg too long", "max", friendReqMsgMaxRunes)
+	}
+	if err := checkFriendRemark(in.RemarkName, in.Tags); err != nil {
+		return nil, err
+	}
+	if in.AddSource == 0 {
+		in.AddSource = friendDefaultAddSource
+	}
+
+	fm := msgModel.Friend{}
+	isFriend, err := fm.IsFriend(ctx, tenantID, fromUserID, in.ToUserID)
+	if err != nil {
+		return nil, err
+	}
+	if isFriend {
+		return nil, errors.ErrAlreadyFriend.WrapMsg("already friends", "friend_user_id", in.ToUserID)
+	}
+	bm := msgModel.Black{}
+	blocked, err := bm.IsBlocked(ctx, tenantID, in.ToUserID, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, errors.ErrBlockedByPeer.WrapMsg("blocked by peer", "to_user_id", in.ToUserID)
+	}
+
+	now := time.Now()
+	rm := msgModel.FriendRequest{}
+
+	// 对方已经在申请加自己：视为互相同意
+	reverse, err := rm.GetPendingRequest(ctx, tenantID, in.ToUserID, fromUserID, now)
+	if err != nil {
+		return nil, err
+	}
+	if reverse != nil {
+		handled, err := acceptFriendRequest(ctx, tenantID, fromUserID, reverse.RequestID, "", &FriendSettings{Remark: &in.RemarkName, Tags: &in.Tags}, now)
+		if err != nil {
+			return nil, err
+		}
+		if handled != nil {
+			return toFriendRequestItem(handled, now), nil
+		}
+	}
+
+	req, err := rm.RefreshPendingRequest(ctx, tenantID, fromUserID, in.ToUserID, bson.M{
+		msgModel.FriendReqFieldReqMsg:     in.ReqMsg,
+		msgModel.FriendReqFieldRemarkName: in.RemarkName,
+		msgModel.FriendReqFieldTags:       in.Tags,
+		msgModel.FriendReqFieldExpireTime: now.Add(friendRequestTTL),
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		req = &msgModel.FriendRequest{
+			TenantID:     tenantID,
+			FromUserID:   fromUserID,
+			ToUserID:     in.ToUserID,
+			HandleResult: msgModel.FriendReqResultPending,
+			ReqMsg:       in.ReqMsg,
+			CreateTime:   now,
+			RequestID:    ids.GenerateString(),
+			Status:       msgModel.FriendReqStatusValid,
+			ExpireTime:   now.Add(friendRequestTTL),
+			AddSource:    in.AddSource,
+			AddChannel:   in.AddChannel,
+			ClientIP:     meta.ClientIP,
+			DeviceID:     meta.DeviceID,
+			UpdateTime:   now,
+			RemarkName:   in.RemarkName,
+			Tags:         in.Tags,
+		}
+		if err := rm.CreateFriendRequest(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	notifySystemEvent(ctx, tenantID, FriendEventRequest, []string{in.ToUserID}, friendRequestEventData(req))
+	return toFriendRequestItem(req, now), nil
+}
+
+// HandleFriendRequest 接收方同意/拒绝申请；同意时双向建立好友关系，settings 为接收方这边的备注/标签
+func HandleFriendRequest(ctx context.Context, tenantID, userID, requestID string, accept bool, handleMsg string, settings *FriendSettings) (*FriendRequestItem, error) {
+	if requestID == "" {
+		return nil, errors.ErrArgs.WrapMsg("request_id is empty")
+	}
+	if utf8.RuneCountInString(handleMsg) > friendReqMsgMaxRunes {
+		return nil, errors.ErrArgs.WrapMsg("handle_msg too long", "max", friendReqMsgMaxRunes)
+	}
+	now := time.Now()
+
+	var (
+		req *msgModel.FriendRequest
+		err error
+	)
+	if accept {
+		req, err = acceptFriendRequest(ctx, tenantID, userID, requestID, handleMsg, settings, now)
+	} else {
+		rm := msgModel.FriendRequest{}
+		req, err = rm.HandleFriendRequest(ctx, tenantID, requestID, userID, msgModel.FriendReqResultRejected, handleMsg, now)
+		if err == nil && req != nil {
+			notifySystemEvent(ctx, tenantID, FriendEventRejected, []string{req.FromUserID}, friendRequestEventData(req))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, friendRequestNotPending(ctx, tenantID, userID, requestID)
+	}
+	return toFriendRequestItem(req, now), nil
+}
+
+// friendRequestNotPending 申请处理不了时区分“不存在”和“已处理/撤回/过期”
+func friendRequestNotPending(ctx context.Context, tenantID, userID, requestID string) error {
+	rm := msgModel.FriendRequest{}
+	r, err := rm.GetFriendRequest(ctx, tenantID, requestID)
+	if err != nil {
+		return err
+	}
+	if r == nil || r.ToUserID != userID {
+		return errors.ErrRecordNotFound.WrapMsg("friend request not found", "request_id", requestID)
+	}
+	return errors.ErrFriendRequestHandled.WrapMsg("friend request is not pending", "request_id", requestID)
+}
+
+// acceptFriendRequest 同意申请并双向写好友关系；申请已不是待处理返回 nil
+func acceptFriendRequest(ctx context.Context, tenantID, userID, requestID, handleMsg string, settings *FriendSettings, now time.Time) (*msgModel.FriendRequest, error) {
+	self := msgModel.FriendSide{UserID: userID}
+	if settings != nil {
+		if settings.Remark != nil {
+			self.Remark = *settings.Remark
+		}
+		if settings.Tags != nil {
+			self.Tags = *settings.Tags
+		}
+	}
+	if err := checkFriendRemark(self.Remark, self.Tags); err != nil {
+		return nil, err
+	}
+
+	rm := msgModel.FriendRequest{}
+	req, err := rm.HandleFriendRequest(ctx, tenantID, requestID, userID, msgModel.FriendReqResultAccepted, handleMsg, now)
+	if err != nil || req == nil {
+		return nil, err
+	}
+	self.AddSource = req.AddSource
+	peer := msgModel.FriendSide{
+		UserID:    req.FromUserID,
+		Remark:    req.RemarkName,
+		Tags:      req.Tags,
+		AddSource: req.AddSource,
+	}
+
+	fm := msgModel.Friend{}
+	if err := fm.UpsertFriendPair(ctx, tenantID, peer, self, userID, now); err != nil {
+		return nil, err
+	}
+	// 反方向还挂着的申请一起了结
+	if err := rm.AcceptPendingBetween(ctx, tenantID, userID, req.FromUserID, now); err != nil {
+		logger.Errorf("[Friend] close pending requests %s<->%s err=%v", userID, req.FromUserID, err)
+	}
+
+	online.NotifyWatchListChanged(ctx, userID, req.FromUserID)
+	notifySystemEvent(ctx, tenantID, FriendEventAccepted, []string{req.FromUserID, userID}, friendRequestEventData(req))
+	return req, nil
+}
+
+// ListFriendRequests 收到（incoming）或发出的好友申请
+func ListFriendRequests(ctx context.Context, tenantID, userID string, incoming bool) ([]*FriendRequestItem, error) {
+	rm := msgModel.FriendRequest{}
+	list, err := rm.ListFriendRequests(ctx, tenantID, userID, incoming, friendRequestListMax)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	items := make([]*FriendRequestItem, 0, len(list))
+	for _, r := range list {
+		items = append(items, toFriendRequestItem(r, now))
+	}
+	return items, nil
+}
+
+// ListFriends 好友列表
+func ListFriends(ctx context.Context, tenantID, userID string) ([]*FriendItem, error) {
+	fm := msgModel.Friend{}
+	list, err := fm.ListFriends(ctx, tenantID, userID, friendListMax)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*FriendItem, 0, len(list))
+	for _, f := range list {
+		items = append(items, toFriendItem(f))
+	}
+	return items, nil
+}
+
+// UpdateFriend 修改自己对好友的备注/标签，只影响自己这一侧
+func UpdateFriend(ctx context.Context, tenantID, userID, friendUserID string, in *FriendSettings) error {
+	if friendUserID == "" || in == nil {
+		return errors.ErrArgs.WrapMsg("friend_user_id is empty")
+	}
+	set := bson.M{}
+	var remark string
+	var tags []string
+	if in.Remark != nil {
+		remark = *in.Remark
+		set[msgModel.FriendFieldRemark] = remark
+	}
+	if in.Tags != nil {
+		tags = *in.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		set[msgModel.FriendFieldTags] = tags
+	}
+	if len(set) == 0 {
+		return errors.ErrArgs.WrapMsg("nothing to update")
+	}
+	if err := checkFriendRemark(remark, tags); err != nil {
+		return err
+	}
+	set[msgModel.FriendFieldUpdateTime] = time.Now()
+
+	fm := msgModel.Friend{}
+	found, err := fm.UpdateFriendInfo(ctx, tenantID, userID, friendUserID, set)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.ErrRecordNotFound.WrapMsg("friend not found", "friend_user_id", friendUserID)
+	}
+	notifySystemEvent(ctx, tenantID, FriendEventUpdated, []string{userID}, map[string]string{"friend_user_id": friendUserID})
+	return nil
+}
+
+// DeleteFriend 删除好友：双方的记录一起删除，双方都会收到通知
+func DeleteFriend(ctx context.Context, tenantID, userID, friendUserID string) error {
+	if friendUserID == "" || friendUserID == userID {
+		return errors.ErrArgs.WrapMsg("invalid friend_user_id")
+	}
+	fm := msgModel.Friend{}
+	n, err := fm.DeleteFriendPair(ctx, tenantID, userID, friendUserID, time.Now())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.ErrRecordNotFound.WrapMsg("friend not found", "friend_user_id", friendUserID)
+	}
+	online.NotifyWatchListChanged(ctx, userID, friendUserID)
+	notifySystemEvent(ctx, tenantID, FriendEventDeleted, []string{userID, friendUserID}, map[string]string{
+		"operator_user_id": userID,
+		"friend_user_id":   friendUserID,
+	})
+	return nil
+}
+
+// AddBlack 拉黑：对方发来的单聊消息和好友申请都会被拒绝；好友关系保留，只打标记
+func AddBlack(ctx context.Context, tenantID, userID, blockUserID string) error {
+	if blockUserID == "" || blockUserID == userID {
+		return errors.ErrArgs.WrapMsg("invalid block_user_id")
+	}
+	now := time.Now()
+	bm := msgModel.Black{}
+	if err := bm.AddBlack(ctx, &msgModel.Black{
+		TenantID:       tenantID,
+		OwnerUserID:    userID,
+		BlockUserID:    blockUserID,
+		CreateTime:     now,
+		OperatorUserID: userID,
+	}); err != nil {
+		return err
+	}
+	fm := msgModel.Friend{}
+	if err := fm.SetBlocked(ctx, tenantID, userID, blockUserID, true, now); err != nil {
+		return err
+	}
+	// 双方网关重新加载关注列表，被拉黑的人不再收到在线状态
+	online.NotifyWatchListChanged(ctx, userID, blockUserID)
+	notifySystemEvent(ctx, tenantID, BlackEventAdded, []string{userID}, map[string]string{"block_user_id": blockUserID})
+	return nil
+}
+
+// RemoveBlack 移出黑名单
+func RemoveBlack(ctx context.Context, tenantID, userID, blockUserID string) error {
+	if blockUserID == "" {
+		return errors.ErrArgs.WrapMsg("block_user_id is empty")
+	}
+	bm := msgModel.Black{}
+	removed, err := bm.RemoveBlack(ctx, tenantID, userID, blockUserID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return errors.ErrRecordNotFound.WrapMsg("not in black list", "block_user_id", blockUserID)
+	}
+	fm := msgModel.Friend{}
+	if err := fm.SetBlocked(ctx, tenantID, userID, blockUserID, false, time.Now()); err != nil {
+		return err
+	}
+	online.NotifyWatchListChanged(ctx, userID, blockUserID)
+	notifySystemEvent(ctx, tenantID, BlackEventRemoved, []string{userID}, map[string]string{"block_user_id": blockUserID})
+	return nil
+}
+
+// ListBlacks 黑名单列表
+func ListBlacks(ctx context.Context, tenantID, userID string) ([]*BlackItem, error) {
+	bm := msgModel.Black{}
+	list, err := bm.ListBlacks(ctx, tenantID, userID, blackListMax)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*BlackItem, 0, len(list))
+	for _, b := range list {
+		items = append(items, &BlackItem{BlockUserID: b.BlockUserID, CreateTime: msOrZero(b.CreateTime)})
+	}
+	return items, nil
+}
+
+// CheckP2PSendPolicy 单聊发送侧校验：接收者拉黑了发送者时拒绝；租户开启“仅好友单聊”时非好友拒绝
+func CheckP2PSendPolicy(ctx context.Context, tenantID, fromUserID, toUserID string) error {
+	if fromUserID == "" || toUserID == "" || fromUserID == toUserID {
+		return nil
+	}
+	bm := msgModel.Black{}
+	blocked, err := bm.IsBlocked(ctx, tenantID, toUserID, fromUserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errors.ErrBlockedByPeer.WrapMsg("recipient has blocked the sender", "recv_id", toUserID)
+	}
+
+	tenant, err := getTenant(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if tenant == nil || !tenant.Policy.FriendOnlyP2P {
+		return nil
+	}
+	fm := msgModel.Friend{}
+	isFriend, err := fm.IsFriend(ctx, tenantID, fromUserID, toUserID)
+	if err != nil {
+		return err
+	}
+	if !isFriend {
+		return errors.ErrNotFriend.WrapMsg("recipient is not a friend", "recv_id", toUserID)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	"PProject/tools/errs"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFriendRequestItemStatus(t *testing.T) {
+	now := time.Now()
+	pending := &msgModel.FriendRequest{
+		RequestID:    "r1",
+		HandleResult: msgModel.FriendReqResultPending,
+		Status:       msgModel.FriendReqStatusValid,
+		ExpireTime:   now.Add(-time.Second),
+	}
+	if got := toFriendRequestItem(pending, now).Status; got != msgModel.FriendReqStatusExpired {
+		t.Fatalf("expired pending request status = %d", got)
+	}
+
+	pending.ExpireTime = now.Add(time.Hour)
+	if got := toFriendRequestItem(pending, now).Status; got != msgModel.FriendReqStatusValid {
+		t.Fatalf("valid pending request status = %d", got)
+	}
+
+	// 已处理的申请过了有效期也保持原状态
+	handled := &msgModel.FriendRequest{
+		HandleResult: msgModel.FriendReqResultAccepted,
+		Status:       msgModel.FriendReqStatusValid,
+		ExpireTime:   now.Add(-time.Hour),
+	}
+	if got := toFriendRequestItem(handled, now).Status; got != msgModel.FriendReqStatusValid {
+		t.Fatalf("handled request status = %d", got)
+	}
+}
+
+func TestCheckFriendRemark(t *testing.T) {
+	if err := checkFriendRemark("同事小王", []string{"同事"}); err != nil {
+		t.Fatalf("valid remark: %v", err)
+	}
+	long := strings.Repeat("好", friendRemarkMaxRunes+1)
+	if err := checkFriendRemark(long, nil); !isArgsError(err) {
+		t.Fatalf("long remark err = %v", err)
+	}
+	tags := make([]string, friendTagsMax+1)
+	if err := checkFriendRemark("", tags); !isArgsError(err) {
+		t.Fatalf("too many tags err = %v", err)
+	}
+}
+
+func isArgsError(err error) bool {
+	var codeErr *errs.CodeError
+	return errors.As(err, &codeErr) && codeErr.Code == errs.ArgsError
+}
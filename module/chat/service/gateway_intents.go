@@ -0,0 +1,37 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	usermodel "PProject/module/user/model"
+	"PProject/service/chat"
+	errors "PProject/tools/errs"
+	"context"
+)
+
+// ResolveConnFilter 连接鉴权时按声明的意图/分片/选择性订阅构造下发过滤
+// 普通账号什么都不声明时不过滤（收全部事件）；机器人不声明意图时只收非特权事件
+// 特权意图（成员、在线状态、消息内容）机器人需要开通，普通账号只是在收窄自己的事件，不受限制
+func ResolveConnFilter(ctx context.Context, userID string, intents uint64, shard *pb.ShardInfo, guildIDs, channelIDs []string) (*chat.ConnFilter, error) {
+	um := usermodel.User{}
+	user, err := um.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	bot := user != nil && user.AccountType == usermodel.AccountBot
+
+	if !bot && intents == 0 && shard.GetShardCount() == 0 && len(guildIDs) == 0 && len(channelIDs) == 0 {
+		return nil, nil
+	}
+	if intents == 0 {
+		intents = chat.IntentsAll
+		if bot {
+			intents = chat.IntentsDefault
+		}
+	}
+	if bot {
+		if missing := intents & chat.IntentsPrivileged &^ uint64(user.PrivilegedIntents); missing != 0 {
+			return nil, errors.ErrIntentsDisallowed.WrapMsg("privileged intents not enabled", "user_id", userID, "intents", missing)
+		}
+	}
+	return chat.NewConnFilter(intents, shard, guildIDs, channelIDs)
+}
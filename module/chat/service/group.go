@@ -0,0 +1,173 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	redis2 "PProject/service/storage/redis"
+	errors "PProject/tools/errs"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 慢速模式：成员上次发言的占位键，过期即可再发
+const groupSlowModeKeyFmt = "group:slow:%s:%s:%s"
+
+// CheckGroupSend 群消息发送校验：群可写、发送者是正常成员、未被封禁、不在禁言期/全员禁言（群主/管理员不受禁言限制）
+// 广播频道只有群主/管理员/发布者能发
+// md 不为空时再做内容相关的校验（媒体大小）；慢速模式不在这里占位，见 ClaimGroupSlowMode
+func CheckGroupSend(ctx context.Context, tenantID, groupID, senderID string, md *pb.MessageData) (*msgModel.Group, error) {
+	gm := msgModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+	}
+	if err := CheckGroupMemberSend(ctx, tenantID, group, senderID, md); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// CheckGroupMemberSend 同 CheckGroupSend，群已经查出来时用
+func CheckGroupMemberSend(ctx context.Context, tenantID string, group *msgModel.Group, senderID string, md *pb.MessageData) error {
+	if group.Status == msgModel.GroupStatusDismiss {
+		return errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", group.GroupID)
+	}
+
+	mm := msgModel.GroupMember{}
+	member, err := mm.GetGroupMember(ctx, tenantID, group.GroupID, senderID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var ban *msgModel.GroupBlack
+	if member != nil && member.IsBanned {
+		// is_banned 只是个快速标记，以封禁记录为准；封禁已过期/解除时顺手清掉标记
+		bm := msgModel.GroupBlack{}
+		if ban, err = bm.GetActiveBan(ctx, tenantID, group.GroupID, senderID, now); err != nil {
+			return err
+		}
+		if ban == nil {
+			clearStaleBan(ctx, tenantID, group.GroupID, senderID, now)
+		}
+	}
+	if err := checkGroupSender(group, member, ban, senderID, now); err != nil {
+		return err
+	}
+	if md == nil {
+		return nil
+	}
+	return checkGroupMedia(group, md)
+}
+
+// ClaimGroupSlowMode 慢速模式占发言位：要在幂等去重和其它所有校验都通过之后调用，只有真正要落库的消息才占位
+// 返回的 release 在落库失败时调用，把发言位还回去；群主/管理员不受限
+func ClaimGroupSlowMode(ctx context.Context, tenantID string, group *msgModel.Group, senderID string) (release func(), err error) {
+	release = func() {}
+	if group.SlowModeInterval <= 0 {
+		return release, nil
+	}
+	mm := msgModel.GroupMember{}
+	member, err := mm.GetGroupMember(ctx, tenantID, group.GroupID, senderID)
+	if err != nil {
+		return release, err
+	}
+	if member != nil && member.IsManager() {
+		return release, nil
+	}
+	return claimSlowMode(ctx, tenantID, group, senderID, time.Now())
+}
+
+// checkGroupSender 发送者身份校验（不含内容）：ban 为发送者生效中的封禁记录，没有为 nil
+func checkGroupSender(group *msgModel.Group, member *msgModel.GroupMember, ban *msgModel.GroupBlack, senderID string, now time.Time) error {
+	if group.Status != msgModel.GroupStatusNormal {
+		return errors.ErrGroupFrozen.WrapMsg("group frozen", "group_id", group.GroupID, "status", group.Status)
+	}
+	if member == nil || member.Status != msgModel.GroupMemberStatusNormal {
+		return errors.ErrNotGroupMember.WrapMsg("not group member", "group_id", group.GroupID, "user_id", senderID)
+	}
+	if ban != nil && ban.BlocksSpeak() {
+		return errors.ErrGroupMemberBan.WrapMsg("member banned", "group_id", group.GroupID, "user_id", senderID)
+	}
+	if group.GroupType == msgModel.GroupTypeChannel && !member.IsPublisher() {
+		return errors.ErrChannelPublish.WrapMsg("channel publish forbidden", "group_id", group.GroupID, "user_id", senderID)
+	}
+	if member.IsManager() {
+		return nil
+	}
+	if member.IsMuted(now) {
+		return errors.ErrGroupMemberMuted.WrapMsg("member muted", "group_id", group.GroupID, "user_id", senderID)
+	}
+	if group.MuteAll && !slices.Contains(group.MuteAllWhitelist, senderID) {
+		return errors.ErrGroupMutedAll.WrapMsg("group muted", "group_id", group.GroupID, "user_id", senderID)
+	}
+	return nil
+}
+
+// clearStaleBan 封禁过期后清掉成员上的 is_banned 标记，失败只打日志（下次发送再查封禁记录）
+func clearStaleBan(ctx context.Context, tenantID, groupID, userID string, now time.Time) {
+	mm := msgModel.GroupMember{}
+	if _, err := mm.UpdateMemberFields(ctx, tenantID, groupID, userID, bson.M{
+		msgModel.GroupMemberFieldIsBanned:   false,
+		msgModel.GroupMemberFieldBanReason:  "",
+		msgModel.GroupMemberFieldUpdateTime: now,
+	}); err != nil {
+		logger.Errorf("[Group] clear stale ban group=%s user=%s err=%v", groupID, userID, err)
+	}
+}
+
+// checkGroupMedia 媒体大小不能超过群设置的上限（MB），0 不限制
+func checkGroupMedia(group *msgModel.Group, md *pb.MessageData) error {
+	if group.MediaMaxSizeMB <= 0 {
+		return nil
+	}
+	size := mediaSize(md)
+	if limit := int64(group.MediaMaxSizeMB) << 20; size > limit {
+		return errors.ErrMediaTooLarge.WrapMsg("media too large", "group_id", group.GroupID, "size", size, "limit", limit)
+	}
+	return nil
+}
+
+// mediaSize 消息里媒体的字节数，非媒体消息为 0
+func mediaSize(md *pb.MessageData) int64 {
+	switch {
+	case md.GetPictureElem() != nil:
+		return md.GetPictureElem().GetSourcePicture().GetSize()
+	case md.GetSoundElem() != nil:
+		return md.GetSoundElem().GetDataSize()
+	case md.GetVideoElem() != nil:
+		return md.GetVideoElem().GetVideoSize()
+	case md.GetFileElem() != nil:
+		return md.GetFileElem().GetFileSize()
+	}
+	return 0
+}
+
+// claimSlowMode 每个成员在间隔内只能发一条：SET NX EX 抢占发言位；Redis 不可用时放行
+func claimSlowMode(ctx context.Context, tenantID string, group *msgModel.Group, senderID string, now time.Time) (func(), error) {
+	noop := func() {}
+	if group.SlowModeInterval <= 0 {
+		return noop, nil
+	}
+	key := fmt.Sprintf(groupSlowModeKeyFmt, tenantID, group.GroupID, senderID)
+	ok, err := redis2.GetRedis().SetNX(ctx, key, now.UnixMilli(), time.Duration(group.SlowModeInterval)*time.Second).Result()
+	if err != nil {
+		logger.Errorf("[Group] slow mode group=%s user=%s err=%v", group.GroupID, senderID, err)
+		return noop, nil
+	}
+	if !ok {
+		return noop, errors.ErrGroupSlowMode.WrapMsg("slow mode", "group_id", group.GroupID, "interval", group.SlowModeInterval)
+	}
+	return func() {
+		if err := redis2.GetRedis().Del(context.Background(), key).Err(); err != nil {
+			logger.Errorf("[Group] release slow mode group=%s user=%s err=%v", group.GroupID, senderID, err)
+		}
+	}, nil
+}
@@ -0,0 +1,1148 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/service/bus"
+	"PProject/service/chat"
+	ka "PProject/service/dispatcher/kafka"
+	util "PProject/tools"
+	errors "PProject/tools/errs"
+	ids "PProject/tools/ids"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	groupNameMaxRunes         = 64
+	groupAnnouncementMaxRunes = 2000
+	groupBatchMaxUsers        = 500 // 建群/拉人/踢人一次最多处理的人数
+	groupRequestTTL           = 7 * 24 * time.Hour
+	groupRequestListMax       = int64(200)
+	groupMemberPageDefault    = int64(100)
+	groupMemberPageMax        = int64(500)
+	groupInviteHashBytes      = 16
+)
+
+// 群通知（NotificationElem.detail 里的 type），作为消息落在群会话里
+const (
+	GroupNotifyCreated          = "group_created"
+	GroupNotifyInfoUpdated      = "group_info_updated"
+	GroupNotifyAnnouncement     = "group_announcement"
+	GroupNotifyDismissed        = "group_dismissed"
+	GroupNotifyMemberJoined     = "member_joined"
+	GroupNotifyMemberInvited    = "member_invited"
+	GroupNotifyMemberKicked     = "member_kicked"
+	GroupNotifyMemberQuit       = "member_quit"
+	GroupNotifyAdminGranted     = "admin_granted"
+	GroupNotifyAdminRevoked     = "admin_revoked"
+	GroupNotifyOwnerTransferred = "owner_transferred"
+	GroupNotifyInviteRotated    = "invite_link_rotated"
+)
+
+// 群相关的 SYSTEM_EVENT 事件类型（只发给个人，不进群会话）
+const (
+	GroupEventJoinRequest = "group_join_request" // 有新的入群申请（群主/管理员）
+	GroupEventJoinHandled = "group_join_handled" // 入群申请已处理（申请人）
+	GroupEventKicked      = "group_kicked"       // 被移出群（被踢的人已不在群里，收不到群通知）
+)
+
+// GroupNotification 群通知内容，序列化后放在 NotificationElem.detail
+type GroupNotification struct {
+	Type           string         `json:"type"`
+	GroupID        string         `json:"group_id"`
+	OperatorUserID string         `json:"operator_user_id"`
+	UserIDs        []string       `json:"user_ids,omitempty"`
+	Changes        map[string]any `json:"changes,omitempty"`
+}
+
+// GroupItem 群资料；邀请链接只返回给有权限管理的人
+type GroupItem struct {
+	GroupID                string           `json:"group_id"`
+	GroupName              string           `json:"group_name"`
+	FaceURL                string           `json:"face_url"`
+	Introduction           string           `json:"introduction"`
+	Notification           string           `json:"notification"`
+	NotificationUpdateTime int64            `json:"notification_update_time,omitempty"`
+	NotificationUserID     string           `json:"notification_user_id,omitempty"`
+	OwnerUserID            string           `json:"owner_user_id"`
+	GroupType              int32            `json:"group_type"`
+	Status                 int32            `json:"status"`
+	NeedVerification       int32            `json:"need_verification"`
+	IsDiscoverable         bool             `json:"is_discoverable"`
+	IsJoinByLink           bool             `json:"is_join_by_link"`
+	InviteLinkHash         string           `json:"invite_link_hash,omitempty"`
+	VerificationQuestions  []string         `json:"verification_questions,omitempty"`
+	VerificationTips       string           `json:"verification_tips,omitempty"`
+	MuteAll                bool             `json:"mute_all"`
+	MuteAllWhitelist       []string         `json:"mute_all_whitelist,omitempty"`
+	SlowModeInterval       int32            `json:"slow_mode_interval"`
+	MediaMaxSizeMB         int32            `json:"media_max_size_mb"`
+	MemberCount            int32            `json:"member_count"`
+	AdminCount             int32            `json:"admin_count"`
+	CreateTime             int64            `json:"create_time"`
+	Self                   *GroupMemberItem `json:"self,omitempty"` // 调用者在群里的身份，不是成员为空
+}
+
+// GroupMemberItem 群成员
+type GroupMemberItem struct {
+	UserID         string `json:"user_id"`
+	Nickname       string `json:"nickname"`
+	FaceURL        string `json:"face_url"`
+	RoleLevel      int32  `json:"role_level"`
+	PermissionMask int64  `json:"permission_mask,omitempty"`
+	JoinTime       int64  `json:"join_time"`
+	JoinSource     int32  `json:"join_source"`
+	InviterUserID  string `json:"inviter_user_id,omitempty"`
+	MuteEndTime    int64  `json:"mute_end_time,omitempty"`
+}
+
+// GroupRequestItem 入群申请
+type GroupRequestItem struct {
+	RequestID     string   `json:"request_id"`
+	GroupID       string   `json:"group_id"`
+	UserID        string   `json:"user_id"`
+	ReqMsg        string   `json:"req_msg"`
+	VerifyAnswers []string `json:"verify_answers,omitempty"`
+	HandleResult  int32    `json:"handle_result"` // 0=待处理 1=同意 2=拒绝 3=忽略 4=过期
+	HandleUserID  string   `json:"handle_user_id,omitempty"`
+	HandledMsg    string   `json:"handled_msg,omitempty"`
+	ReqTime       int64    `json:"req_time"`
+	HandledTime   int64    `json:"handled_time,omitempty"`
+	ExpireTime    int64    `json:"expire_time"`
+}
+
+// CreateGroupInput 建群
+type CreateGroupInput struct {
+	GroupName        string            `json:"group_name"`
+	FaceURL          string            `json:"face_url"`
+	Introduction     string            `json:"introduction"`
+	GroupType        int32             `json:"group_type"`
+	NeedVerification int32             `json:"need_verification"`
+	IsDiscoverable   bool              `json:"is_discoverable"`
+	IsJoinByLink     bool              `json:"is_join_by_link"`
+	VerificationQAs  []msgModel.QAItem `json:"verification_qas"`
+	VerificationTips string            `json:"verification_tips"`
+	MemberIDs        []string          `json:"member_ids"` // 建群时一起拉进来的人（不含自己）
+}
+
+// GroupInfoUpdate 可修改的群资料，nil 表示不改
+type GroupInfoUpdate struct {
+	GroupName        *string            `json:"group_name,omitempty"`
+	FaceURL          *string            `json:"face_url,omitempty"`
+	Introduction     *string            `json:"introduction,omitempty"`
+	NeedVerification *int32             `json:"need_verification,omitempty"`
+	IsDiscoverable   *bool              `json:"is_discoverable,omitempty"`
+	IsJoinByLink     *bool              `json:"is_join_by_link,omitempty"`
+	VerificationQAs  *[]msgModel.QAItem `json:"verification_qas,omitempty"`
+	VerificationTips *string            `json:"verification_tips,omitempty"`
+}
+
+// JoinGroupInput 申请入群：带 invite_hash 走邀请链接，否则按群的验证方式
+type JoinGroupInput struct {
+	GroupID    string   `json:"group_id"`
+	InviteHash string   `json:"invite_hash"`
+	ReqMsg     string   `json:"req_msg"`
+	Answers    []string `json:"answers"`
+}
+
+// JoinGroupResult joined=true 已入群；否则 request_id 为待审批的申请
+type JoinGroupResult struct {
+	Joined    bool   `json:"joined"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func toGroupItem(g *msgModel.Group, self *msgModel.GroupMember) *GroupItem {
+	out := &GroupItem{
+		GroupID:                g.GroupID,
+		GroupName:              g.GroupName,
+		FaceURL:                g.FaceURL,
+		Introduction:           g.Introduction,
+		Notification:           g.Notification,
+		NotificationUpdateTime: msOrZero(g.NotificationUpdateTime),
+		NotificationUserID:     g.NotificationUserID,
+		OwnerUserID:            g.CreatorUserID,
+		GroupType:              g.GroupType,
+		Status:                 g.Status,
+		NeedVerification:       g.NeedVerification,
+		IsDiscoverable:         g.IsDiscoverable,
+		IsJoinByLink:           g.IsJoinByLink,
+		VerificationTips:       g.VerificationTips,
+		MuteAll:                g.MuteAll,
+		MuteAllWhitelist:       g.MuteAllWhitelist,
+		SlowModeInterval:       g.SlowModeInterval,
+		MediaMaxSizeMB:         g.MediaMaxSizeMB,
+		MemberCount:            g.MemberCount,
+		AdminCount:             g.AdminCount,
+		CreateTime:             msOrZero(g.CreateTime),
+	}
+	for _, qa := range g.VerificationQAs {
+		out.VerificationQuestions = append(out.VerificationQuestions, qa.Question)
+	}
+	if self != nil && self.Status == msgModel.GroupMemberStatusNormal {
+		out.Self = toGroupMemberItem(self)
+		if self.HasPermission(msgModel.GroupPermInviteLink) {
+			out.InviteLinkHash = g.InviteLinkHash
+		}
+	}
+	return out
+}
+
+func toGroupMemberItem(m *msgModel.GroupMember) *GroupMemberItem {
+	return &GroupMemberItem{
+		UserID:         m.UserID,
+		Nickname:       m.Nickname,
+		FaceURL:        m.FaceURL,
+		RoleLevel:      m.RoleLevel,
+		PermissionMask: m.PermissionMask,
+		JoinTime:       msOrZero(m.JoinTime),
+		JoinSource:     m.JoinSource,
+		InviterUserID:  m.InviterUserID,
+		MuteEndTime:    msOrZero(m.MuteEndTime),
+	}
+}
+
+func toGroupRequestItem(r *msgModel.GroupRequest, now time.Time) *GroupRequestItem {
+	result := r.HandleResult
+	if result == msgModel.GroupReqResultPending && !r.ExpireTime.After(now) {
+		result = msgModel.GroupReqResultExpired
+	}
+	return &GroupRequestItem{
+		RequestID:     r.RequestID,
+		GroupID:       r.GroupID,
+		UserID:        r.UserID,
+		ReqMsg:        r.ReqMsg,
+		VerifyAnswers: r.VerifyAnswers,
+		HandleResult:  result,
+		HandleUserID:  r.HandleUserID,
+		HandledMsg:    r.HandledMsg,
+		ReqTime:       msOrZero(r.ReqTime),
+		HandledTime:   msOrZero(r.HandledTime),
+		ExpireTime:    msOrZero(r.ExpireTime),
+	}
+}
+
+func newInviteLinkHash() (string, error) {
+	b := make([]byte, groupInviteHashBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// normalizeUserIDs 去空、去重、去掉 exclude，超过上限报错
+func normalizeUserIDs(userIDs []string, exclude string) ([]string, error) {
+	seen := make(map[string]bool, len(userIDs))
+	out := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id == "" || id == exclude || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	if len(out) > groupBatchMaxUsers {
+		return nil, errors.ErrArgs.WrapMsg("too many users", "max", groupBatchMaxUsers)
+	}
+	return out, nil
+}
+
+func checkVerification(mode int32) error {
+	switch mode {
+	case msgModel.VerifyNone, msgModel.VerifyAdmin, msgModel.VerifyQnA, msgModel.VerifyInviteOnly:
+		return nil
+	}
+	return errors.ErrArgs.WrapMsg("invalid need_verification", "need_verification", mode)
+}
+
+// answersMatch 每个问题的回答都命中该题的任一正确答案（忽略首尾空白和大小写）
+func answersMatch(qas []msgModel.QAItem, answers []string) bool {
+	if len(answers) < len(qas) {
+		return false
+	}
+	for i, qa := range qas {
+		if len(qa.Answers) == 0 {
+			continue // 没配答案的题只要求作答
+		}
+		got := strings.TrimSpace(answers[i])
+		ok := false
+		for _, want := range qa.Answers {
+			if strings.EqualFold(got, strings.TrimSpace(want)) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSystemNotification 服务端生成的群通知帧（只有服务端能打这个标记，网关会清掉客户端帧里的）
+func IsSystemNotification(f *pb.MessageFrameData) bool {
+	return f.GetMeta()[chat.MetaSystemNotify] != "" &&
+		f.GetPayload().GetContentType() == int32(pb.ContentType_MsgNOTIFICATION)
+}
+
+// publishGroupNotification 把群通知作为一条群消息交给数据节点：和普通群消息一样分配 seq、落库、扇出
+// 群状态已经先写好，通知失败只记日志
+func publishGroupNotification(ctx context.Context, tenantID string, n *GroupNotification) {
+	detail, err := json.Marshal(n)
+	if err != nil {
+		logger.Errorf("[GroupNotify] marshal group=%s type=%s err=%v", n.GroupID, n.Type, err)
+		return
+	}
+	now := time.Now().UnixMilli()
+	frame := &pb.MessageFrameData{
+		Type:     pb.MessageFrameData_DATA,
+		From:     n.OperatorUserID,
+		To:       n.GroupID,
+		Ts:       now,
+		TenantId: tenantID,
+		Meta:     map[string]string{chat.MetaSystemNotify: n.Type},
+		Body: &pb.MessageFrameData_Payload{Payload: &pb.MessageData{
+			ClientMsgId:      "gn-" + ids.GenerateString(),
+			SendId:           n.OperatorUserID,
+			GroupId:          n.GroupID,
+			SessionType:      int32(pb.SessionType_GROUP_CHAT),
+			MsgFrom:          int32(pb.MsgFrom_SYSTEM),
+			ContentType:      int32(pb.ContentType_MsgNOTIFICATION),
+			SenderPlatformId: int32(pb.PlatformID_API),
+			CreateTime:       now,
+			SendTime:         now,
+			NotificationElem: &pb.NotificationElem{Detail: string(detail)},
+		}},
+	}
+	value, err := util.EncodeFrame(frame)
+	if err != nil {
+		logger.Errorf("[GroupNotify] encode group=%s type=%s err=%v", n.GroupID, n.Type, err)
+		return
+	}
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).SendTopicKeys()
+	topic := ka.SelectTopicByUser(n.GroupID, keys)
+	if err := bus.Publish(ctx, &bus.Message{Topic: topic, Key: []byte(n.GroupID), Value: value}); err != nil {
+		logger.Errorf("[GroupNotify] publish group=%s type=%s err=%v", n.GroupID, n.Type, err)
+	}
+}
+
+// groupOperator 校验操作人：群正常、是正常成员、有 perm 权限（perm=0 只要求是成员）
+func groupOperator(ctx context.Context, tenantID, groupID, userID string, perm int64) (*msgModel.Group, *msgModel.GroupMember, error) {
+	if groupID == "" {
+		return nil, nil, errors.ErrArgs.WrapMsg("group_id is empty")
+	}
+	gm := msgModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if group == nil || group.Status != msgModel.GroupStatusNormal {
+		return nil, nil, errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+	}
+	mm := msgModel.GroupMember{}
+	member, err := mm.GetGroupMember(ctx, tenantID, groupID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if member == nil || member.Status != msgModel.GroupMemberStatusNormal {
+		return nil, nil, errors.ErrNotGroupMember.WrapMsg("not group member", "group_id", groupID, "user_id", userID)
+	}
+	if perm != 0 && !member.HasPermission(perm) {
+		return nil, nil, errors.ErrNoPermission.WrapMsg("no group permission", "group_id", groupID, "perm", perm)
+	}
+	return group, member, nil
+}
+
+// addGroupMembers 写入成员并按实际新增的人数调整 member_count，返回新增的人
+func addGroupMembers(ctx context.Context, tenantID, groupID string, userIDs []string, source int32, inviter string, now time.Time) ([]string, error) {
+	mm := msgModel.GroupMember{}
+	added := make([]string, 0, len(userIDs))
+	var err error
+	for _, uid := range userIDs {
+		// 被禁止入群的人拉不进来
+		var banned bool
+		if banned, err = joinBanned(ctx, tenantID, groupID, uid, now); err != nil {
+			break
+		}
+		if banned {
+			continue
+		}
+		var ok bool
+		ok, err = mm.AddGroupMember(ctx, &msgModel.GroupMember{
+			TenantID:       tenantID,
+			GroupID:        groupID,
+			UserID:         uid,
+			RoleLevel:      msgModel.RoleLevelMember,
+			JoinTime:       now,
+			JoinSource:     source,
+			InviterUserID:  inviter,
+			OperatorUserID: inviter,
+			UpdateTime:     now,
+			Roles:          []string{},
+			Tags:           []string{},
+		})
+		if err != nil {
+			break
+		}
+		if ok {
+			added = append(added, uid)
+		}
+	}
+	// 中途失败也要把已经加进来的人计数
+	gm := msgModel.Group{}
+	if cerr := gm.IncGroupCounts(ctx, tenantID, groupID, int32(len(added)), 0); cerr != nil && err == nil {
+		err = cerr
+	}
+	return added, err
+}
+
+// CreateGroup 建群：创建者为群主，member_ids 一起入群
+func CreateGroup(ctx context.Context, tenantID, ownerID string, in *CreateGroupInput) (*GroupItem, error) {
+	if in == nil || strings.TrimSpace(in.GroupName) == "" {
+		return nil, errors.ErrArgs.WrapMsg("group_name is empty")
+	}
+	if utf8.RuneCountInString(in.GroupName) > groupNameMaxRunes {
+		return nil, errors.ErrArgs.WrapMsg("group_name too long", "max", groupNameMaxRunes)
+	}
+	if err := checkVerification(in.NeedVerification); err != nil {
+		return nil, err
+	}
+	members, err := normalizeUserIDs(in.MemberIDs, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if in.GroupType == 0 {
+		in.GroupType = msgModel.GroupTypeNormal
+	}
+
+	now := time.Now()
+	group := &msgModel.Group{
+		TenantID:         tenantID,
+		GroupID:          ids.GenerateString(),
+		GroupName:        in.GroupName,
+		FaceURL:          in.FaceURL,
+		Introduction:     in.Introduction,
+		CreatorUserID:    ownerID,
+		CreateTime:       now,
+		UpdateTime:       now,
+		Status:           msgModel.GroupStatusNormal,
+		GroupType:        in.GroupType,
+		NeedVerification: in.NeedVerification,
+		IsDiscoverable:   in.IsDiscoverable,
+		IsJoinByLink:     in.IsJoinByLink,
+		VerificationQAs:  in.VerificationQAs,
+		VerificationTips: in.VerificationTips,
+		AllowAtAll:       true,
+		MemberCount:      1,
+		Tags:             []string{},
+	}
+	if group.IsJoinByLink {
+		if group.InviteLinkHash, err = newInviteLinkHash(); err != nil {
+			return nil, err
+		}
+	}
+	gm := msgModel.Group{}
+	if err := gm.InsertGroup(ctx, group); err != nil {
+		return nil, err
+	}
+
+	owner := &msgModel.GroupMember{
+		TenantID:       tenantID,
+		GroupID:        group.GroupID,
+		UserID:         ownerID,
+		RoleLevel:      msgModel.RoleLevelOwner,
+		IsOwner:        true,
+		JoinTime:       now,
+		OperatorUserID: ownerID,
+		UpdateTime:     now,
+		Roles:          []string{},
+		Tags:           []string{},
+	}
+	mm := msgModel.GroupMember{}
+	if _, err := mm.AddGroupMember(ctx, owner); err != nil {
+		return nil, err
+	}
+	added, err := addGroupMembers(ctx, tenantID, group.GroupID, members, msgModel.GroupJoinSourceInvited, ownerID, now)
+	if err != nil {
+		return nil, err
+	}
+	group.MemberCount += int32(len(added))
+
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyCreated,
+		GroupID:        group.GroupID,
+		OperatorUserID: ownerID,
+		UserIDs:        added,
+	})
+	return toGroupItem(group, owner), nil
+}
+
+// GetGroupInfo 群资料：成员可见；不可被发现的群非成员看不到
+func GetGroupInfo(ctx context.Context, tenantID, userID, groupID string) (*GroupItem, error) {
+	gm := msgModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil || group.Status == msgModel.GroupStatusDismiss {
+		return nil, errors.ErrRecordNotFound.WrapMsg("group not found", "group_id", groupID)
+	}
+	mm := msgModel.GroupMember{}
+	self, err := mm.GetGroupMember(ctx, tenantID, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	isMember := self != nil && self.Status == msgModel.GroupMemberStatusNormal
+	if !isMember && !group.IsDiscoverable {
+		return nil, errors.ErrNoPermission.WrapMsg("group is private", "group_id", groupID)
+	}
+	return toGroupItem(group, self), nil
+}
+
+// UpdateGroupInfo 修改群资料/入群设置（需要改资料权限）
+func UpdateGroupInfo(ctx context.Context, tenantID, userID, groupID string, in *GroupInfoUpdate) (*GroupItem, error) {
+	if in == nil {
+		return nil, errors.ErrArgs.WrapMsg("nothing to update")
+	}
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermEditInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	changes := map[string]any{}
+	put := func(field string, v any) {
+		set[field] = v
+		changes[field] = v
+	}
+	if in.GroupName != nil {
+		name := strings.TrimSpace(*in.GroupName)
+		if name == "" || utf8.RuneCountInString(name) > groupNameMaxRunes {
+			return nil, errors.ErrArgs.WrapMsg("invalid group_name", "max", groupNameMaxRunes)
+		}
+		put(msgModel.GroupFieldGroupName, name)
+	}
+	if in.FaceURL != nil {
+		put(msgModel.GroupFieldFaceURL, *in.FaceURL)
+	}
+	if in.Introduction != nil {
+		put(msgModel.GroupFieldIntroduction, *in.Introduction)
+	}
+	if in.NeedVerification != nil {
+		if err := checkVerification(*in.NeedVerification); err != nil {
+			return nil, err
+		}
+		put(msgModel.GroupFieldNeedVerification, *in.NeedVerification)
+	}
+	if in.IsDiscoverable != nil {
+		put(msgModel.GroupFieldIsDiscoverable, *in.IsDiscoverable)
+	}
+	if in.IsJoinByLink != nil {
+		if !self.HasPermission(msgModel.GroupPermInviteLink) {
+			return nil, errors.ErrNoPermission.WrapMsg("no invite link permission", "group_id", groupID)
+		}
+		put(msgModel.GroupFieldIsJoinByLink, *in.IsJoinByLink)
+		if *in.IsJoinByLink {
+			// 重新打开链接时换一个新的，之前流出去的链接不会复活
+			hash, err := newInviteLinkHash()
+			if err != nil {
+				return nil, err
+			}
+			set[msgModel.GroupFieldInviteLinkHash] = hash
+		}
+	}
+	if in.VerificationQAs != nil {
+		// 答案不进通知，只说明问题变了
+		set[msgModel.GroupFieldVerificationQAs] = *in.VerificationQAs
+		changes[msgModel.GroupFieldVerificationQAs] = len(*in.VerificationQAs)
+	}
+	if in.VerificationTips != nil {
+		put(msgModel.GroupFieldVerificationTips, *in.VerificationTips)
+	}
+	if len(set) == 0 {
+		return nil, errors.ErrArgs.WrapMsg("nothing to update")
+	}
+	set[msgModel.GroupFieldUpdateTime] = time.Now()
+
+	gm := msgModel.Group{}
+	group, err := gm.UpdateGroupFields(ctx, tenantID, groupID, set)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyInfoUpdated,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		Changes:        changes,
+	})
+	return toGroupItem(group, self), nil
+}
+
+// SetGroupAnnouncement 发布/修改群公告（需要改资料权限）
+func SetGroupAnnouncement(ctx context.Context, tenantID, userID, groupID, text string) error {
+	if utf8.RuneCountInString(text) > groupAnnouncementMaxRunes {
+		return errors.ErrArgs.WrapMsg("announcement too long", "max", groupAnnouncementMaxRunes)
+	}
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermEditInfo); err != nil {
+		return err
+	}
+	now := time.Now()
+	gm := msgModel.Group{}
+	group, err := gm.UpdateGroupFields(ctx, tenantID, groupID, bson.M{
+		msgModel.GroupFieldNotification:           text,
+		msgModel.GroupFieldNotificationUpdateTime: now,
+		msgModel.GroupFieldNotificationUserID:     userID,
+		msgModel.GroupFieldUpdateTime:             now,
+	})
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyAnnouncement,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		Changes:        map[string]any{msgModel.GroupFieldNotification: text},
+	})
+	return nil
+}
+
+// DismissGroup 解散群（仅群主）
+func DismissGroup(ctx context.Context, tenantID, userID, groupID string) error {
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, 0)
+	if err != nil {
+		return err
+	}
+	if !self.IsOwner && self.RoleLevel != msgModel.RoleLevelOwner {
+		return errors.ErrNoPermission.WrapMsg("only owner can dismiss group", "group_id", groupID)
+	}
+	gm := msgModel.Group{}
+	ok, err := gm.DismissGroup(ctx, tenantID, groupID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrGroupUnavailable.WrapMsg("group already dismissed", "group_id", groupID)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyDismissed,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+	})
+	return nil
+}
+
+// JoinGroup 申请入群：邀请链接/无需验证/答题正确直接入群，管理员审批的生成申请
+func JoinGroup(ctx context.Context, tenantID, userID string, in *JoinGroupInput, meta FriendRequestMeta) (*JoinGroupResult, error) {
+	if in == nil || in.GroupID == "" {
+		return nil, errors.ErrArgs.WrapMsg("group_id is empty")
+	}
+	gm := msgModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, in.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil || group.Status != msgModel.GroupStatusNormal {
+		return nil, errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", in.GroupID)
+	}
+	mm := msgModel.GroupMember{}
+	cur, err := mm.GetGroupMember(ctx, tenantID, in.GroupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if cur != nil && cur.Status == msgModel.GroupMemberStatusNormal {
+		return nil, errors.ErrAlreadyGroupMember.WrapMsg("already group member", "group_id", in.GroupID)
+	}
+	banned, err := joinBanned(ctx, tenantID, in.GroupID, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		return nil, errors.ErrGroupMemberBan.WrapMsg("banned from group", "group_id", in.GroupID)
+	}
+
+	source := msgModel.GroupJoinSourceSearch
+	switch {
+	case in.InviteHash != "":
+		if !group.IsJoinByLink || group.InviteLinkHash == "" || in.InviteHash != group.InviteLinkHash {
+			return nil, errors.ErrGroupInviteInvalid.WrapMsg("invite link invalid", "group_id", in.GroupID)
+		}
+		source = msgModel.GroupJoinSourceLink
+	case group.NeedVerification == msgModel.VerifyNone:
+	case group.NeedVerification == msgModel.VerifyQnA:
+		if !answersMatch(group.VerificationQAs, in.Answers) {
+			return nil, errors.ErrGroupVerifyFailed.WrapMsg("wrong answers", "group_id", in.GroupID)
+		}
+	case group.NeedVerification == msgModel.VerifyAdmin:
+		return submitJoinRequest(ctx, tenantID, userID, group, in, meta)
+	default:
+		return nil, errors.ErrNoPermission.WrapMsg("group is invite only", "group_id", in.GroupID)
+	}
+
+	added, err := addGroupMembers(ctx, tenantID, in.GroupID, []string{userID}, source, "", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if len(added) == 0 {
+		return nil, errors.ErrAlreadyGroupMember.WrapMsg("already group member", "group_id", in.GroupID)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyMemberJoined,
+		GroupID:        in.GroupID,
+		OperatorUserID: userID,
+		UserIDs:        added,
+	})
+	return &JoinGroupResult{Joined: true}, nil
+}
+
+func submitJoinRequest(ctx context.Context, tenantID, userID string, group *msgModel.Group, in *JoinGroupInput, meta FriendRequestMeta) (*JoinGroupResult, error) {
+	if utf8.RuneCountInString(in.ReqMsg) > friendReqMsgMaxRunes {
+		return nil, errors.ErrArgs.WrapMsg("req_msg too long", "max", friendReqMsgMaxRunes)
+	}
+	now := time.Now()
+	rm := msgModel.GroupRequest{}
+	req, err := rm.UpsertPendingRequest(ctx, &msgModel.GroupRequest{
+		TenantID:      tenantID,
+		UserID:        userID,
+		GroupID:       group.GroupID,
+		HandleResult:  msgModel.GroupReqResultPending,
+		ReqMsg:        in.ReqMsg,
+		ReqTime:       now,
+		JoinSource:    msgModel.GroupJoinSourceSearch,
+		RequestID:     ids.GenerateString(),
+		Status:        msgModel.GroupReqStatusValid,
+		ExpireTime:    now.Add(groupRequestTTL),
+		VerifyAnswers: in.Answers,
+		VerifyPassed:  answersMatch(group.VerificationQAs, in.Answers),
+		ClientIP:      meta.ClientIP,
+		DeviceID:      meta.DeviceID,
+		UpdateTime:    now,
+		Tags:          []string{},
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+
+	mm := msgModel.GroupMember{}
+	managers, err := mm.ListGroupManagerIDs(ctx, tenantID, group.GroupID)
+	if err != nil {
+		logger.Errorf("[Group] list managers group=%s err=%v", group.GroupID, err)
+	}
+	notifySystemEvent(ctx, tenantID, GroupEventJoinRequest, managers, map[string]string{
+		"group_id":   group.GroupID,
+		"request_id": req.RequestID,
+		"user_id":    userID,
+		"req_msg":    req.ReqMsg,
+	})
+	return &JoinGroupResult{RequestID: req.RequestID}, nil
+}
+
+// ListGroupRequests 群的入群申请（需要审批权限）
+func ListGroupRequests(ctx context.Context, tenantID, userID, groupID string, pendingOnly bool) ([]*GroupRequestItem, error) {
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermApprove); err != nil {
+		return nil, err
+	}
+	rm := msgModel.GroupRequest{}
+	list, err := rm.ListGroupRequests(ctx, tenantID, groupID, pendingOnly, groupRequestListMax)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	items := make([]*GroupRequestItem, 0, len(list))
+	for _, r := range list {
+		items = append(items, toGroupRequestItem(r, now))
+	}
+	return items, nil
+}
+
+// HandleGroupRequest 审批入群申请（需要审批权限），同意即入群
+func HandleGroupRequest(ctx context.Context, tenantID, userID, groupID, requestID string, accept bool, handledMsg string) (*GroupRequestItem, error) {
+	if requestID == "" {
+		return nil, errors.ErrArgs.WrapMsg("request_id is empty")
+	}
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermApprove); err != nil {
+		return nil, err
+	}
+	result := msgModel.GroupReqResultRejected
+	if accept {
+		result = msgModel.GroupReqResultAccepted
+	}
+	now := time.Now()
+	rm := msgModel.GroupRequest{}
+	req, err := rm.HandleGroupRequest(ctx, tenantID, groupID, requestID, userID, result, handledMsg, now)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		r, err := rm.GetGroupRequest(ctx, tenantID, requestID)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil || r.GroupID != groupID {
+			return nil, errors.ErrRecordNotFound.WrapMsg("group request not found", "request_id", requestID)
+		}
+		return nil, errors.ErrGroupRequestHandled.WrapMsg("group request is not pending", "request_id", requestID)
+	}
+
+	if accept {
+		added, err := addGroupMembers(ctx, tenantID, groupID, []string{req.UserID}, req.JoinSource, userID, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(added) > 0 {
+			publishGroupNotification(ctx, tenantID, &GroupNotification{
+				Type:           GroupNotifyMemberJoined,
+				GroupID:        groupID,
+				OperatorUserID: userID,
+				UserIDs:        added,
+			})
+		}
+	}
+	notifySystemEvent(ctx, tenantID, GroupEventJoinHandled, []string{req.UserID}, map[string]string{
+		"group_id":      groupID,
+		"request_id":    req.RequestID,
+		"handle_result": strconv.Itoa(int(req.HandleResult)),
+		"handled_msg":   req.HandledMsg,
+	})
+	return toGroupRequestItem(req, now), nil
+}
+
+// RotateInviteLink 换一个新的邀请链接，旧链接立即失效（需要管理链接权限）
+func RotateInviteLink(ctx context.Context, tenantID, userID, groupID string) (string, error) {
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermInviteLink); err != nil {
+		return "", err
+	}
+	hash, err := newInviteLinkHash()
+	if err != nil {
+		return "", err
+	}
+	gm := msgModel.Group{}
+	group, err := gm.UpdateGroupFields(ctx, tenantID, groupID, bson.M{
+		msgModel.GroupFieldInviteLinkHash: hash,
+		msgModel.GroupFieldIsJoinByLink:   true,
+		msgModel.GroupFieldUpdateTime:     time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if group == nil {
+		return "", errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyInviteRotated,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+	})
+	return hash, nil
+}
+
+// ListGroupMembers 成员列表，按 user_id 翻页（成员可见）
+func ListGroupMembers(ctx context.Context, tenantID, userID, groupID string, page *pb.Page) ([]*GroupMemberItem, *pb.PageResp, error) {
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, 0); err != nil {
+		return nil, nil, err
+	}
+	size := int64(page.GetSize())
+	if size <= 0 {
+		size = groupMemberPageDefault
+	}
+	if size > groupMemberPageMax {
+		size = groupMemberPageMax
+	}
+	mm := msgModel.GroupMember{}
+	list, err := mm.ListGroupMembers(ctx, tenantID, groupID, page.GetCursor(), size+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := &pb.PageResp{}
+	if int64(len(list)) > size {
+		list = list[:size]
+		resp.HasMore = true
+		resp.NextCursor = list[len(list)-1].UserID
+	}
+	items := make([]*GroupMemberItem, 0, len(list))
+	for _, m := range list {
+		items = append(items, toGroupMemberItem(m))
+	}
+	return items, resp, nil
+}
+
+// InviteGroupMembers 拉人入群（需要拉人权限），被群拒绝过的也会重新加入
+func InviteGroupMembers(ctx context.Context, tenantID, userID, groupID string, userIDs []string) ([]string, error) {
+	users, err := normalizeUserIDs(userIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, errors.ErrArgs.WrapMsg("user_ids is empty")
+	}
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermInvite); err != nil {
+		return nil, err
+	}
+	added, err := addGroupMembers(ctx, tenantID, groupID, users, msgModel.GroupJoinSourceInvited, userID, time.Now())
+	if len(added) > 0 {
+		publishGroupNotification(ctx, tenantID, &GroupNotification{
+			Type:           GroupNotifyMemberInvited,
+			GroupID:        groupID,
+			OperatorUserID: userID,
+			UserIDs:        added,
+		})
+	}
+	return added, err
+}
+
+// KickGroupMembers 踢人（需要踢人权限）：群主不能被踢，管理员只能踢普通成员
+func KickGroupMembers(ctx context.Context, tenantID, userID, groupID string, userIDs []string) ([]string, error) {
+	users, err := normalizeUserIDs(userIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, errors.ErrArgs.WrapMsg("user_ids is empty")
+	}
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermKick)
+	if err != nil {
+		return nil, err
+	}
+	isOwner := self.IsOwner || self.RoleLevel == msgModel.RoleLevelOwner
+
+	mm := msgModel.GroupMember{}
+	now := time.Now()
+	kicked := make([]string, 0, len(users))
+	var admins int32
+	for _, uid := range users {
+		target, err := mm.GetGroupMember(ctx, tenantID, groupID, uid)
+		if err != nil {
+			return nil, err
+		}
+		if target == nil || target.Status != msgModel.GroupMemberStatusNormal {
+			continue
+		}
+		if target.RoleLevel == msgModel.RoleLevelOwner || target.IsOwner ||
+			(!isOwner && (target.RoleLevel == msgModel.RoleLevelAdmin || target.IsAdmin)) {
+			return nil, errors.ErrNoPermission.WrapMsg("cannot kick manager", "user_id", uid)
+		}
+		before, err := mm.RemoveGroupMember(ctx, tenantID, groupID, uid, msgModel.GroupMemberStatusKicked, userID, now)
+		if err != nil {
+			return nil, err
+		}
+		if before == nil {
+			continue
+		}
+		kicked = append(kicked, uid)
+		if before.RoleLevel == msgModel.RoleLevelAdmin {
+			admins--
+		}
+	}
+	gm := msgModel.Group{}
+	if err := gm.IncGroupCounts(ctx, tenantID, groupID, -int32(len(kicked)), admins); err != nil {
+		return nil, err
+	}
+	if len(kicked) > 0 {
+		publishGroupNotification(ctx, tenantID, &GroupNotification{
+			Type:           GroupNotifyMemberKicked,
+			GroupID:        groupID,
+			OperatorUserID: userID,
+			UserIDs:        kicked,
+		})
+		notifySystemEvent(ctx, tenantID, GroupEventKicked, kicked, map[string]string{
+			"group_id":         groupID,
+			"operator_user_id": userID,
+		})
+	}
+	return kicked, nil
+}
+
+// QuitGroup 退群；群主需要先转让或解散
+func QuitGroup(ctx context.Context, tenantID, userID, groupID string) error {
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, 0)
+	if err != nil {
+		return err
+	}
+	if self.IsOwner || self.RoleLevel == msgModel.RoleLevelOwner {
+		return errors.ErrNoPermission.WrapMsg("owner must transfer or dismiss the group", "group_id", groupID)
+	}
+	mm := msgModel.GroupMember{}
+	before, err := mm.RemoveGroupMember(ctx, tenantID, groupID, userID, msgModel.GroupMemberStatusQuit, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return errors.ErrNotGroupMember.WrapMsg("not group member", "group_id", groupID, "user_id", userID)
+	}
+	var admins int32
+	if before.RoleLevel == msgModel.RoleLevelAdmin {
+		admins = -1
+	}
+	gm := msgModel.Group{}
+	if err := gm.IncGroupCounts(ctx, tenantID, groupID, -1, admins); err != nil {
+		return err
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyMemberQuit,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		UserIDs:        []string{userID},
+	})
+	return nil
+}
+
+// SetGroupAdmin 设置/取消管理员（仅群主）；mask=0 时给默认管理员权限，已是管理员时只改权限
+func SetGroupAdmin(ctx context.Context, tenantID, userID, groupID, targetID string, grant bool, mask int64) error {
+	if targetID == "" || targetID == userID {
+		return errors.ErrArgs.WrapMsg("invalid user_id")
+	}
+	if mask & ^msgModel.GroupPermAdminDefault != 0 {
+		return errors.ErrArgs.WrapMsg("invalid permission_mask", "permission_mask", mask)
+	}
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, 0)
+	if err != nil {
+		return err
+	}
+	if !self.IsOwner && self.RoleLevel != msgModel.RoleLevelOwner {
+		return errors.ErrNoPermission.WrapMsg("only owner can set admins", "group_id", groupID)
+	}
+	if mask == 0 {
+		mask = msgModel.GroupPermAdminDefault
+	}
+
+	now := time.Now()
+	mm := msgModel.GroupMember{}
+	gm := msgModel.Group{}
+	notify := GroupNotifyAdminGranted
+	if grant {
+		promoted, err := mm.UpdateMemberRole(ctx, tenantID, groupID, targetID, msgModel.RoleLevelMember, bson.M{
+			msgModel.GroupMemberFieldRoleLevel:      msgModel.RoleLevelAdmin,
+			msgModel.GroupMemberFieldIsAdmin:        true,
+			msgModel.GroupMemberFieldPermissionMask: mask,
+			msgModel.GroupMemberFieldOperatorUserID: userID,
+			msgModel.GroupMemberFieldUpdateTime:     now,
+		})
+		if err != nil {
+			return err
+		}
+		if promoted {
+			if err := gm.IncGroupCounts(ctx, tenantID, groupID, 0, 1); err != nil {
+				return err
+			}
+		} else {
+			// 已经是管理员：只调整权限
+			updated, err := mm.UpdateMemberRole(ctx, tenantID, groupID, targetID, msgModel.RoleLevelAdmin, bson.M{
+				msgModel.GroupMemberFieldPermissionMask: mask,
+				msgModel.GroupMemberFieldOperatorUserID: userID,
+				msgModel.GroupMemberFieldUpdateTime:     now,
+			})
+			if err != nil {
+				return err
+			}
+			if !updated {
+				return errors.ErrNotGroupMember.WrapMsg("target is not a member", "group_id", groupID, "user_id", targetID)
+			}
+		}
+	} else {
+		notify = GroupNotifyAdminRevoked
+		demoted, err := mm.UpdateMemberRole(ctx, tenantID, groupID, targetID, msgModel.RoleLevelAdmin, bson.M{
+			msgModel.GroupMemberFieldRoleLevel:      msgModel.RoleLevelMember,
+			msgModel.GroupMemberFieldIsAdmin:        false,
+			msgModel.GroupMemberFieldPermissionMask: int64(0),
+			msgModel.GroupMemberFieldOperatorUserID: userID,
+			msgModel.GroupMemberFieldUpdateTime:     now,
+		})
+		if err != nil {
+			return err
+		}
+		if !demoted {
+			return errors.ErrRecordNotFound.WrapMsg("target is not an admin", "group_id", groupID, "user_id", targetID)
+		}
+		if err := gm.IncGroupCounts(ctx, tenantID, groupID, 0, -1); err != nil {
+			return err
+		}
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           notify,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		UserIDs:        []string{targetID},
+		Changes:        map[string]any{msgModel.GroupMemberFieldPermissionMask: mask},
+	})
+	return nil
+}
+
+// TransferGroupOwner 转让群主（仅群主）：先提升新群主再降级自己，中途失败最多出现两个群主，不会没有群主
+func TransferGroupOwner(ctx context.Context, tenantID, userID, groupID, newOwnerID string) error {
+	if newOwnerID == "" || newOwnerID == userID {
+		return errors.ErrArgs.WrapMsg("invalid new_owner_user_id")
+	}
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, 0)
+	if err != nil {
+		return err
+	}
+	if !self.IsOwner && self.RoleLevel != msgModel.RoleLevelOwner {
+		return errors.ErrNoPermission.WrapMsg("only owner can transfer", "group_id", groupID)
+	}
+	mm := msgModel.GroupMember{}
+	target, err := mm.GetGroupMember(ctx, tenantID, groupID, newOwnerID)
+	if err != nil {
+		return err
+	}
+	if target == nil || target.Status != msgModel.GroupMemberStatusNormal {
+		return errors.ErrNotGroupMember.WrapMsg("new owner is not a member", "group_id", groupID, "user_id", newOwnerID)
+	}
+
+	now := time.Now()
+	promoted, err := mm.UpdateMemberRole(ctx, tenantID, groupID, newOwnerID, target.RoleLevel, bson.M{
+		msgModel.GroupMemberFieldRoleLevel:      msgModel.RoleLevelOwner,
+		msgModel.GroupMemberFieldIsOwner:        true,
+		msgModel.GroupMemberFieldIsAdmin:        false,
+		msgModel.GroupMemberFieldPermissionMask: int64(0),
+		msgModel.GroupMemberFieldOperatorUserID: userID,
+		msgModel.GroupMemberFieldUpdateTime:     now,
+	})
+	if err != nil {
+		return err
+	}
+	if !promoted {
+		return errors.ErrNotGroupMember.WrapMsg("new owner changed concurrently", "group_id", groupID, "user_id", newOwnerID)
+	}
+	if _, err := mm.UpdateMemberRole(ctx, tenantID, groupID, userID, msgModel.RoleLevelOwner, bson.M{
+		msgModel.GroupMemberFieldRoleLevel:      msgModel.RoleLevelMember,
+		msgModel.GroupMemberFieldIsOwner:        false,
+		msgModel.GroupMemberFieldOperatorUserID: userID,
+		msgModel.GroupMemberFieldUpdateTime:     now,
+	}); err != nil {
+		return err
+	}
+
+	gm := msgModel.Group{}
+	if target.RoleLevel == msgModel.RoleLevelAdmin {
+		if err := gm.IncGroupCounts(ctx, tenantID, groupID, 0, -1); err != nil {
+			return err
+		}
+	}
+	if _, err := gm.UpdateGroupFields(ctx, tenantID, groupID, bson.M{
+		msgModel.GroupFieldCreatorUserID: newOwnerID,
+		msgModel.GroupFieldUpdateTime:    now,
+	}); err != nil {
+		return err
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyOwnerTransferred,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		UserIDs:        []string{newOwnerID},
+	})
+	return nil
+}
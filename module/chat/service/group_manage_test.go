@@ -0,0 +1,49 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	"testing"
+)
+
+func TestAnswersMatch(t *testing.T) {
+	qas := []msgModel.QAItem{
+		{Question: "公司名", Answers: []string{"PProject", "pp"}},
+		{Question: "随便说点什么"},
+	}
+	if !answersMatch(qas, []string{"  pproject ", "hi"}) {
+		t.Fatal("case/space-insensitive answer should match")
+	}
+	if !answersMatch(qas, []string{"PP", ""}) {
+		t.Fatal("question without answers only needs an entry")
+	}
+	if answersMatch(qas, []string{"other", "hi"}) {
+		t.Fatal("wrong answer matched")
+	}
+	if answersMatch(qas, []string{"pp"}) {
+		t.Fatal("missing answer matched")
+	}
+}
+
+func TestGroupMemberPermission(t *testing.T) {
+	owner := &msgModel.GroupMember{Status: msgModel.GroupMemberStatusNormal, RoleLevel: msgModel.RoleLevelOwner, IsOwner: true}
+	admin := &msgModel.GroupMember{Status: msgModel.GroupMemberStatusNormal, RoleLevel: msgModel.RoleLevelAdmin, IsAdmin: true}
+	member := &msgModel.GroupMember{Status: msgModel.GroupMemberStatusNormal, RoleLevel: msgModel.RoleLevelMember}
+
+	if !owner.HasPermission(msgModel.GroupPermInviteLink | msgModel.GroupPermKick) {
+		t.Fatal("owner should have all permissions")
+	}
+	if !admin.HasPermission(msgModel.GroupPermKick) {
+		t.Fatal("admin with empty mask should get defaults")
+	}
+	admin.PermissionMask = msgModel.GroupPermInvite
+	if admin.HasPermission(msgModel.GroupPermKick) || !admin.HasPermission(msgModel.GroupPermInvite) {
+		t.Fatal("admin mask not respected")
+	}
+	if member.HasPermission(msgModel.GroupPermInvite) {
+		t.Fatal("member should have no manage permission")
+	}
+	admin.Status = msgModel.GroupMemberStatusKicked
+	if admin.HasPermission(msgModel.GroupPermInvite) {
+		t.Fatal("kicked admin should lose permissions")
+	}
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	errors "PProject/tools/errs"
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	groupMuteMaxSeconds     = int64(30 * 24 * 3600) // 单次禁言最长 30 天
+	groupSlowModeMaxSeconds = int32(3600)
+	groupBanReasonMaxRunes  = 200
+	groupBanListMax         = int64(500)
+)
+
+// 群管理类通知（NotificationElem.detail 里的 type）
+const (
+	GroupNotifyMemberMuted       = "member_muted"
+	GroupNotifyMemberUnmuted     = "member_unmuted"
+	GroupNotifyModerationUpdated = "moderation_updated"
+	GroupNotifyMemberBanned      = "member_banned"
+	GroupNotifyMemberUnbanned    = "member_unbanned"
+	GroupNotifyFrozen            = "group_frozen"
+	GroupNotifyUnfrozen          = "group_unfrozen"
+)
+
+// GroupModerationUpdate 群管理开关，nil 表示不改
+type GroupModerationUpdate struct {
+	MuteAll          *bool     `json:"mute_all,omitempty"`
+	MuteAllWhitelist *[]string `json:"mute_all_whitelist,omitempty"`
+	SlowModeInterval *int32    `json:"slow_mode_interval,omitempty"` // 秒，0=关闭
+	MediaMaxSizeMB   *int32    `json:"media_max_size_mb,omitempty"`  // 0=不限制
+}
+
+// GroupBanItem 群封禁记录
+type GroupBanItem struct {
+	UserID         string `json:"user_id"`
+	BanType        int32  `json:"ban_type"` // 0=禁止入群 1=禁止发言 2=两者
+	Reason         string `json:"reason"`
+	OperatorUserID string `json:"operator_user_id"`
+	CreateTime     int64  `json:"create_time"`
+	ExpireTime     int64  `json:"expire_time,omitempty"` // 0=永久
+}
+
+func toGroupBanItem(b *msgModel.GroupBlack) *GroupBanItem {
+	return &GroupBanItem{
+		UserID:         b.BlockUserID,
+		BanType:        b.BanType,
+		Reason:         b.Reason,
+		OperatorUserID: b.OperatorUserID,
+		CreateTime:     msOrZero(b.CreateTime),
+		ExpireTime:     msOrZero(b.ExpireTime),
+	}
+}
+
+// joinBanned 是否被禁止入群
+func joinBanned(ctx context.Context, tenantID, groupID, userID string, now time.Time) (bool, error) {
+	bm := msgModel.GroupBlack{}
+	ban, err := bm.GetActiveBan(ctx, tenantID, groupID, userID, now)
+	if err != nil {
+		return false, err
+	}
+	return ban != nil && ban.BlocksJoin(), nil
+}
+
+// checkModerationTarget 群主不能被管；管理员只能管普通成员；target 不是成员时返回 nil 成员
+func checkModerationTarget(ctx context.Context, tenantID, groupID string, self *msgModel.GroupMember, targetID string) (*msgModel.GroupMember, error) {
+	if targetID == "" || targetID == self.UserID {
+		return nil, errors.ErrArgs.WrapMsg("invalid user_id")
+	}
+	mm := msgModel.GroupMember{}
+	target, err := mm.GetGroupMember(ctx, tenantID, groupID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil || target.Status != msgModel.GroupMemberStatusNormal {
+		return nil, nil
+	}
+	isOwner := self.IsOwner || self.RoleLevel == msgModel.RoleLevelOwner
+	if target.IsOwner || target.RoleLevel == msgModel.RoleLevelOwner || (!isOwner && target.IsManager()) {
+		return nil, errors.ErrNoPermission.WrapMsg("cannot moderate manager", "user_id", targetID)
+	}
+	return target, nil
+}
+
+// MuteGroupMember 禁言成员 seconds 秒，seconds<=0 解除禁言（需要禁言权限）
+func MuteGroupMember(ctx context.Context, tenantID, userID, groupID, targetID string, seconds int64) error {
+	if seconds > groupMuteMaxSeconds {
+		return errors.ErrArgs.WrapMsg("mute too long", "max", groupMuteMaxSeconds)
+	}
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermMute)
+	if err != nil {
+		return err
+	}
+	target, err := checkModerationTarget(ctx, tenantID, groupID, self, targetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return errors.ErrNotGroupMember.WrapMsg("target is not a member", "group_id", groupID, "user_id", targetID)
+	}
+
+	now := time.Now()
+	var end time.Time
+	notify := GroupNotifyMemberUnmuted
+	if seconds > 0 {
+		end = now.Add(time.Duration(seconds) * time.Second)
+		notify = GroupNotifyMemberMuted
+	}
+	mm := msgModel.GroupMember{}
+	ok, err := mm.UpdateMemberFields(ctx, tenantID, groupID, targetID, bson.M{
+		msgModel.GroupMemberFieldMuteEndTime:    end,
+		msgModel.GroupMemberFieldOperatorUserID: userID,
+		msgModel.GroupMemberFieldUpdateTime:     now,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrNotGroupMember.WrapMsg("target is not a member", "group_id", groupID, "user_id", targetID)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           notify,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		UserIDs:        []string{targetID},
+		Changes:        map[string]any{msgModel.GroupMemberFieldMuteEndTime: msOrZero(end)},
+	})
+	return nil
+}
+
+// UpdateGroupModeration 全员禁言/白名单/慢速模式/媒体上限（需要禁言权限）
+func UpdateGroupModeration(ctx context.Context, tenantID, userID, groupID string, in *GroupModerationUpdate) (*GroupItem, error) {
+	if in == nil {
+		return nil, errors.ErrArgs.WrapMsg("nothing to update")
+	}
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermMute)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	if in.MuteAll != nil {
+		set[msgModel.GroupFieldMuteAll] = *in.MuteAll
+	}
+	if in.MuteAllWhitelist != nil {
+		whitelist, err := normalizeUserIDs(*in.MuteAllWhitelist, "")
+		if err != nil {
+			return nil, err
+		}
+		set[msgModel.GroupFieldMuteAllWhitelist] = whitelist
+	}
+	if in.SlowModeInterval != nil {
+		if *in.SlowModeInterval < 0 || *in.SlowModeInterval > groupSlowModeMaxSeconds {
+			return nil, errors.ErrArgs.WrapMsg("invalid slow_mode_interval", "max", groupSlowModeMaxSeconds)
+		}
+		set[msgModel.GroupFieldSlowModeInterval] = *in.SlowModeInterval
+	}
+	if in.MediaMaxSizeMB != nil {
+		if *in.MediaMaxSizeMB < 0 {
+			return nil, errors.ErrArgs.WrapMsg("invalid media_max_size_mb")
+		}
+		set[msgModel.GroupFieldMediaMaxSizeMB] = *in.MediaMaxSizeMB
+	}
+	if len(set) == 0 {
+		return nil, errors.ErrArgs.WrapMsg("nothing to update")
+	}
+	changes := make(map[string]any, len(set))
+	for k, v := range set {
+		changes[k] = v
+	}
+	set[msgModel.GroupFieldUpdateTime] = time.Now()
+
+	gm := msgModel.Group{}
+	group, err := gm.UpdateGroupFields(ctx, tenantID, groupID, set)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyModerationUpdated,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		Changes:        changes,
+	})
+	return toGroupItem(group, self), nil
+}
+
+// BanGroupMember 封禁（需要踢人权限）：禁止入群的同时移出群，禁止发言的留在群里；seconds<=0 为永久
+func BanGroupMember(ctx context.Context, tenantID, userID, groupID, targetID string, banType int32, seconds int64, reason string) error {
+	if banType != msgModel.GroupBanJoin && banType != msgModel.GroupBanSpeak && banType != msgModel.GroupBanBoth {
+		return errors.ErrArgs.WrapMsg("invalid ban_type", "ban_type", banType)
+	}
+	if utf8.RuneCountInString(reason) > groupBanReasonMaxRunes {
+		return errors.ErrArgs.WrapMsg("reason too long", "max", groupBanReasonMaxRunes)
+	}
+	_, self, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermKick)
+	if err != nil {
+		return err
+	}
+	target, err := checkModerationTarget(ctx, tenantID, groupID, self, targetID)
+	if err != nil {
+		return err
+	}
+	// 只禁言不踢的封禁只对成员有意义；禁止入群可以预先封
+	if target == nil && banType == msgModel.GroupBanSpeak {
+		return errors.ErrNotGroupMember.WrapMsg("target is not a member", "group_id", groupID, "user_id", targetID)
+	}
+
+	now := time.Now()
+	ban := &msgModel.GroupBlack{
+		TenantID:       tenantID,
+		GroupID:        groupID,
+		BlockUserID:    targetID,
+		OperatorUserID: userID,
+		Reason:         reason,
+		CreateTime:     now,
+		Status:         msgModel.GroupBlackStatusActive,
+		BanType:        banType,
+		Scope:          "group",
+		Source:         "admin",
+		UpdateTime:     now,
+	}
+	if seconds > 0 {
+		ban.ExpireTime = now.Add(time.Duration(seconds) * time.Second)
+	}
+	bm := msgModel.GroupBlack{}
+	if err := bm.BanGroupUser(ctx, ban); err != nil {
+		return err
+	}
+
+	mm := msgModel.GroupMember{}
+	removed := false
+	if target != nil {
+		if ban.BlocksJoin() {
+			before, err := mm.RemoveGroupMember(ctx, tenantID, groupID, targetID, msgModel.GroupMemberStatusDenied, userID, now)
+			if err != nil {
+				return err
+			}
+			if before != nil {
+				removed = true
+				var admins int32
+				if before.RoleLevel == msgModel.RoleLevelAdmin {
+					admins = -1
+				}
+				gm := msgModel.Group{}
+				if err := gm.IncGroupCounts(ctx, tenantID, groupID, -1, admins); err != nil {
+					return err
+				}
+			}
+		} else if _, err := mm.UpdateMemberFields(ctx, tenantID, groupID, targetID, bson.M{
+			msgModel.GroupMemberFieldIsBanned:       true,
+			msgModel.GroupMemberFieldBanReason:      reason,
+			msgModel.GroupMemberFieldOperatorUserID: userID,
+			msgModel.GroupMemberFieldUpdateTime:     now,
+		}); err != nil {
+			return err
+		}
+	}
+
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyMemberBanned,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		UserIDs:        []string{targetID},
+		Changes:        map[string]any{"ban_type": banType, "expire_time": msOrZero(ban.ExpireTime)},
+	})
+	if removed {
+		notifySystemEvent(ctx, tenantID, GroupEventKicked, []string{targetID}, map[string]string{
+			"group_id":         groupID,
+			"operator_user_id": userID,
+		})
+	}
+	return nil
+}
+
+// UnbanGroupMember 解除封禁（需要踢人权限）；被移出的人需要重新入群
+func UnbanGroupMember(ctx context.Context, tenantID, userID, groupID, targetID string) error {
+	if targetID == "" {
+		return errors.ErrArgs.WrapMsg("user_id is empty")
+	}
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermKick); err != nil {
+		return err
+	}
+	now := time.Now()
+	bm := msgModel.GroupBlack{}
+	ban, err := bm.LiftGroupBan(ctx, tenantID, groupID, targetID, userID, now)
+	if err != nil {
+		return err
+	}
+	if ban == nil {
+		return errors.ErrRecordNotFound.WrapMsg("no active ban", "group_id", groupID, "user_id", targetID)
+	}
+	if ban.BlocksSpeak() {
+		mm := msgModel.GroupMember{}
+		if _, err := mm.UpdateMemberFields(ctx, tenantID, groupID, targetID, bson.M{
+			msgModel.GroupMemberFieldIsBanned:       false,
+			msgModel.GroupMemberFieldBanReason:      "",
+			msgModel.GroupMemberFieldOperatorUserID: userID,
+			msgModel.GroupMemberFieldUpdateTime:     now,
+		}); err != nil {
+			return err
+		}
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           GroupNotifyMemberUnbanned,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+		UserIDs:        []string{targetID},
+	})
+	return nil
+}
+
+// ListGroupBans 生效中的封禁（需要踢人权限）
+func ListGroupBans(ctx context.Context, tenantID, userID, groupID string) ([]*GroupBanItem, error) {
+	if _, _, err := groupOperator(ctx, tenantID, groupID, userID, msgModel.GroupPermKick); err != nil {
+		return nil, err
+	}
+	bm := msgModel.GroupBlack{}
+	list, err := bm.ListActiveBans(ctx, tenantID, groupID, time.Now(), groupBanListMax)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*GroupBanItem, 0, len(list))
+	for _, b := range list {
+		items = append(items, toGroupBanItem(b))
+	}
+	return items, nil
+}
+
+// SetGroupFrozen 冻结/解冻群（仅群主）：冻结后只读，任何人都不能发言；平台封禁的群不能由群主解封
+func SetGroupFrozen(ctx context.Context, tenantID, userID, groupID string, frozen bool) error {
+	if groupID == "" {
+		return errors.ErrArgs.WrapMsg("group_id is empty")
+	}
+	gm := msgModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, groupID)
+	if err != nil {
+		return err
+	}
+	if group == nil || group.Status == msgModel.GroupStatusDismiss {
+		return errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+	}
+	mm := msgModel.GroupMember{}
+	self, err := mm.GetGroupMember(ctx, tenantID, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if self == nil || self.Status != msgModel.GroupMemberStatusNormal || (!self.IsOwner && self.RoleLevel != msgModel.RoleLevelOwner) {
+		return errors.ErrNoPermission.WrapMsg("only owner can freeze group", "group_id", groupID)
+	}
+
+	from, to, notify := msgModel.GroupStatusReadOnly, msgModel.GroupStatusNormal, GroupNotifyUnfrozen
+	if frozen {
+		from, to, notify = msgModel.GroupStatusNormal, msgModel.GroupStatusReadOnly, GroupNotifyFrozen
+	}
+	ok, err := gm.SetGroupStatus(ctx, tenantID, groupID, from, to, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrGroupFrozen.WrapMsg("group status changed", "group_id", groupID, "status", group.Status)
+	}
+	publishGroupNotification(ctx, tenantID, &GroupNotification{
+		Type:           notify,
+		GroupID:        groupID,
+		OperatorUserID: userID,
+	})
+	return nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	msgModel "PProject/module/chat/model"
+	"PProject/tools/errs"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCheckGroupMedia(t *testing.T) {
+	group := &msgModel.Group{GroupID: "g1", MediaMaxSizeMB: 1}
+	small := &pb.MessageData{FileElem: &pb.FileElem{FileSize: 1 << 20}}
+	if err := checkGroupMedia(group, small); err != nil {
+		t.Fatalf("file at limit: %v", err)
+	}
+
+	big := &pb.MessageData{VideoElem: &pb.VideoElem{VideoSize: 1<<20 + 1}}
+	var codeErr *errs.CodeError
+	if err := checkGroupMedia(group, big); !errors.As(err, &codeErr) || codeErr.Code != errs.MediaTooLargeError {
+		t.Fatalf("oversize video err = %v", err)
+	}
+
+	text := &pb.MessageData{TextElem: &pb.TextElem{Content: "hi"}}
+	if err := checkGroupMedia(group, text); err != nil {
+		t.Fatalf("text message: %v", err)
+	}
+
+	group.MediaMaxSizeMB = 0
+	if err := checkGroupMedia(group, big); err != nil {
+		t.Fatalf("no limit: %v", err)
+	}
+}
+
+func codeOf(err error) int {
+	var codeErr *errs.CodeError
+	if errors.As(err, &codeErr) {
+		return codeErr.Code
+	}
+	return 0
+}
+
+func TestCheckGroupSender(t *testing.T) {
+	now := time.Now()
+	normal := &msgModel.Group{GroupID: "g1", GroupType: msgModel.GroupTypeNormal}
+	cases := []struct {
+		name   string
+		group  *msgModel.Group
+		member *msgModel.GroupMember
+		ban    *msgModel.GroupBlack
+		want   int
+	}{
+		{"member", normal, &msgModel.GroupMember{}, nil, 0},
+		{"not member", normal, nil, nil, errs.NotGroupMemberError},
+		{"banned", normal, &msgModel.GroupMember{IsBanned: true}, &msgModel.GroupBlack{BanType: msgModel.GroupBanSpeak}, errs.GroupMemberBanError},
+		// 封禁过期：GetActiveBan 查不到记录，is_banned 标记还没清也要放行
+		{"expired ban", normal, &msgModel.GroupMember{IsBanned: true}, nil, 0},
+		{"join-only ban", normal, &msgModel.GroupMember{IsBanned: true}, &msgModel.GroupBlack{BanType: msgModel.GroupBanJoin}, 0},
+		{"muted", normal, &msgModel.GroupMember{MuteEndTime: now.Add(time.Minute)}, nil, errs.GroupMemberMutedError},
+		{"mute expired", normal, &msgModel.GroupMember{MuteEndTime: now.Add(-time.Minute)}, nil, 0},
+		{"admin ignores mute", normal, &msgModel.GroupMember{IsAdmin: true, MuteEndTime: now.Add(time.Minute)}, nil, 0},
+		{"mute all", &msgModel.Group{GroupID: "g1", MuteAll: true}, &msgModel.GroupMember{UserID: "u1"}, nil, errs.GroupMutedAllError},
+		{"mute all whitelist", &msgModel.Group{GroupID: "g1", MuteAll: true, MuteAllWhitelist: []string{"u1"}}, &msgModel.GroupMember{UserID: "u1"}, nil, 0},
+		{"mute all admin", &msgModel.Group{GroupID: "g1", MuteAll: true}, &msgModel.GroupMember{IsOwner: true}, nil, 0},
+		{"admin still banned", normal, &msgModel.GroupMember{IsAdmin: true, IsBanned: true}, &msgModel.GroupBlack{BanType: msgModel.GroupBanBoth}, errs.GroupMemberBanError},
+		{"frozen", &msgModel.Group{GroupID: "g1", Status: msgModel.GroupStatusReadOnly}, &msgModel.GroupMember{IsOwner: true}, nil, errs.GroupFrozenError},
+		{"platform banned", &msgModel.Group{GroupID: "g1", Status: msgModel.GroupStatusBanned}, &msgModel.GroupMember{}, nil, errs.GroupFrozenError},
+		{"channel member", &msgModel.Group{GroupID: "g1", GroupType: msgModel.GroupTypeChannel}, &msgModel.GroupMember{}, nil, errs.ChannelPublishError},
+		{"channel publisher", &msgModel.Group{GroupID: "g1", GroupType: msgModel.GroupTypeChannel}, &msgModel.GroupMember{Roles: []string{msgModel.GroupRolePublisher}}, nil, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkGroupSender(c.group, c.member, c.ban, "u1", now); codeOf(err) != c.want {
+				t.Fatalf("err = %v, want code %d", err, c.want)
+			}
+		})
+	}
+}
+
+func TestClaimSlowMode(t *testing.T) {
+	useMemoryRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+	group := &msgModel.Group{GroupID: "slow-" + strconv.FormatInt(now.UnixNano(), 10), SlowModeInterval: 30}
+
+	release, err := claimSlowMode(ctx, "t1", group, "u1", now)
+	if err != nil {
+		t.Fatalf("first message: %v", err)
+	}
+	if _, err := claimSlowMode(ctx, "t1", group, "u1", now); codeOf(err) != errs.GroupSlowModeError {
+		t.Fatalf("second message err = %v", err)
+	}
+	// 间隔是按人算的
+	if _, err := claimSlowMode(ctx, "t1", group, "u2", now); err != nil {
+		t.Fatalf("other member: %v", err)
+	}
+	// 落库失败还回发言位
+	release()
+	if _, err := claimSlowMode(ctx, "t1", group, "u1", now); err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+
+	group.SlowModeInterval = 0
+	if _, err := claimSlowMode(ctx, "t1", group, "u1", now); err != nil {
+		t.Fatalf("slow mode off: %v", err)
+	}
+}
@@ -0,0 +1,845 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	online "PProject/service/storage"
+	errors "PProject/tools/errs"
+	ids "PProject/tools/ids"
+	"context"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	guildNameMaxRunes        = 100
+	guildChannelNameMaxRunes = 100
+	guildRolesMax            = 250
+)
+
+// GuildItem 服务器资料；Permissions 为调用者的服务器级权限
+type GuildItem struct {
+	GuildID     string `json:"guild_id"`
+	Name        string `json:"name"`
+	IconURL     string `json:"icon_url"`
+	Description string `json:"description"`
+	OwnerUserID string `json:"owner_user_id"`
+	IsPublic    bool   `json:"is_public"`
+	MemberCount int32  `json:"member_count"`
+	Permissions int64  `json:"permissions"`
+}
+
+// GuildChannelItem 频道/分类；覆盖规则只返回给有管理角色权限的人
+type GuildChannelItem struct {
+	ChannelID         string                   `json:"channel_id"`
+	GuildID           string                   `json:"guild_id"`
+	ParentID          string                   `json:"parent_id,omitempty"`
+	Type              int32                    `json:"type"`
+	Name              string                   `json:"name"`
+	Topic             string                   `json:"topic"`
+	Position          int32                    `json:"position"`
+	PermissionsSynced bool                     `json:"permissions_synced"`
+	Overwrites        []msgModel.PermOverwrite `json:"overwrites,omitempty"`
+	Permissions       int64                    `json:"permissions"`
+}
+
+// GuildRoleItem 角色
+type GuildRoleItem struct {
+	RoleID      string `json:"role_id"`
+	Name        string `json:"name"`
+	Color       int32  `json:"color"`
+	Permissions int64  `json:"permissions"`
+	Position    int32  `json:"position"`
+}
+
+// CreateGuildInput 建服务器
+type CreateGuildInput struct {
+	Name        string `json:"name"`
+	IconURL     string `json:"icon_url"`
+	Description string `json:"description"`
+	IsPublic    bool   `json:"is_public"`
+}
+
+// GuildChannelInput 建/改频道；修改时零值表示不改
+type GuildChannelInput struct {
+	Name       string                   `json:"name"`
+	Type       int32                    `json:"type"`
+	ParentID   string                   `json:"parent_id"`
+	Topic      *string                  `json:"topic,omitempty"`
+	Position   *int32                   `json:"position,omitempty"`
+	Overwrites []msgModel.PermOverwrite `json:"overwrites,omitempty"` // 仅创建时；不传且在分类下则跟随分类
+}
+
+// GuildRoleInput 建/改角色；修改时 nil 表示不改
+type GuildRoleInput struct {
+	Name        *string `json:"name,omitempty"`
+	Color       *int32  `json:"color,omitempty"`
+	Permissions *int64  `json:"permissions,omitempty"`
+	Position    *int32  `json:"position,omitempty"`
+}
+
+func toGuildItem(g *msgModel.Guild, perms int64) *GuildItem {
+	return &GuildItem{
+		GuildID:     g.GuildID,
+		Name:        g.Name,
+		IconURL:     g.IconURL,
+		Description: g.Description,
+		OwnerUserID: g.OwnerUserID,
+		IsPublic:    g.IsPublic,
+		MemberCount: g.MemberCount,
+		Permissions: perms,
+	}
+}
+
+func toGuildChannelItem(c *msgModel.GuildChannel, perms int64) *GuildChannelItem {
+	out := &GuildChannelItem{
+		ChannelID:         c.ChannelID,
+		GuildID:           c.GuildID,
+		ParentID:          c.ParentID,
+		Type:              c.Type,
+		Name:              c.Name,
+		Topic:             c.Topic,
+		Position:          c.Position,
+		PermissionsSynced: c.PermissionsSynced,
+		Permissions:       perms,
+	}
+	if perms&msgModel.GuildPermManageRoles != 0 {
+		out.Overwrites = c.Overwrites
+	}
+	return out
+}
+
+func toGuildRoleItem(r *msgModel.GuildRole) *GuildRoleItem {
+	return &GuildRoleItem{
+		RoleID:      r.RoleID,
+		Name:        r.Name,
+		Color:       r.Color,
+		Permissions: r.Permissions,
+		Position:    r.Position,
+	}
+}
+
+// guildActor 操作人：服务器可用、是成员、服务器级权限包含 need
+func guildActor(ctx context.Context, tenantID, guildID, userID string, need int64) (*guildPermState, *msgModel.GuildMember, int64, error) {
+	if guildID == "" {
+		return nil, nil, 0, errors.ErrArgs.WrapMsg("guild_id is empty")
+	}
+	state, err := loadGuildPermState(ctx, tenantID, guildID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if state == nil {
+		return nil, nil, 0, errors.ErrGuildUnavailable.WrapMsg("guild not available", "guild_id", guildID)
+	}
+	mm := msgModel.GuildMember{}
+	member, err := mm.GetGuildMember(ctx, tenantID, guildID, userID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if member == nil {
+		return nil, nil, 0, errors.ErrNoPermission.WrapMsg("not guild member", "guild_id", guildID, "user_id", userID)
+	}
+	perms := state.permissions(nil, nil, member)
+	if perms&need != need {
+		return nil, nil, 0, errors.ErrNoPermission.WrapMsg("missing guild permission", "guild_id", guildID, "need", need)
+	}
+	return state, member, perms, nil
+}
+
+// topPosition 成员最高角色的层级；所有者高于一切
+func (s *guildPermState) topPosition(member *msgModel.GuildMember) int32 {
+	if s.guild.OwnerUserID == member.UserID {
+		return math.MaxInt32
+	}
+	var top int32
+	for _, rid := range member.RoleIDs {
+		if r := s.roles[rid]; r != nil && r.Position > top {
+			top = r.Position
+		}
+	}
+	return top
+}
+
+// guildChannelOf 服务器下未删除的频道
+func guildChannelOf(ctx context.Context, tenantID, guildID, channelID string) (*msgModel.GuildChannel, error) {
+	cm := msgModel.GuildChannel{}
+	ch, err := cm.GetChannel(ctx, tenantID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil || ch.GuildID != guildID {
+		return nil, errors.ErrGuildUnavailable.WrapMsg("channel not available", "guild_id", guildID, "channel_id", channelID)
+	}
+	return ch, nil
+}
+
+// CreateGuild 建服务器：创建者为所有者，自带 @everyone 角色和一个分类 + 文字频道
+func CreateGuild(ctx context.Context, tenantID, ownerID string, in *CreateGuildInput) (*GuildItem, error) {
+	if in == nil || strings.TrimSpace(in.Name) == "" {
+		return nil, errors.ErrArgs.WrapMsg("name is empty")
+	}
+	if utf8.RuneCountInString(in.Name) > guildNameMaxRunes {
+		return nil, errors.ErrArgs.WrapMsg("name too long", "max", guildNameMaxRunes)
+	}
+
+	now := time.Now()
+	guild := &msgModel.Guild{
+		TenantID:    tenantID,
+		GuildID:     ids.GenerateString(),
+		Name:        in.Name,
+		IconURL:     in.IconURL,
+		Description: in.Description,
+		OwnerUserID: ownerID,
+		IsPublic:    in.IsPublic,
+		Status:      msgModel.GuildStatusNormal,
+		MemberCount: 1,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	gm := msgModel.Guild{}
+	if err := gm.InsertGuild(ctx, guild); err != nil {
+		return nil, err
+	}
+
+	rm := msgModel.GuildRole{}
+	if err := rm.InsertRole(ctx, &msgModel.GuildRole{
+		TenantID:    tenantID,
+		GuildID:     guild.GuildID,
+		RoleID:      guild.GuildID,
+		Name:        "@everyone",
+		Permissions: msgModel.GuildPermEveryoneDefault,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}); err != nil {
+		return nil, err
+	}
+
+	mm := msgModel.GuildMember{}
+	if _, err := mm.AddGuildMember(ctx, &msgModel.GuildMember{
+		TenantID:   tenantID,
+		GuildID:    guild.GuildID,
+		UserID:     ownerID,
+		RoleIDs:    []string{},
+		JoinTime:   now,
+		UpdateTime: now,
+	}); err != nil {
+		return nil, err
+	}
+
+	cm := msgModel.GuildChannel{}
+	category := &msgModel.GuildChannel{
+		TenantID:   tenantID,
+		GuildID:    guild.GuildID,
+		ChannelID:  ids.GenerateString(),
+		Type:       msgModel.GuildChannelTypeCategory,
+		Name:       "Text Channels",
+		Overwrites: []msgModel.PermOverwrite{},
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := cm.InsertChannel(ctx, category); err != nil {
+		return nil, err
+	}
+	if err := cm.InsertChannel(ctx, &msgModel.GuildChannel{
+		TenantID:          tenantID,
+		GuildID:           guild.GuildID,
+		ChannelID:         ids.GenerateString(),
+		ParentID:          category.ChannelID,
+		Type:              msgModel.GuildChannelTypeText,
+		Name:              "general",
+		Overwrites:        []msgModel.PermOverwrite{},
+		PermissionsSynced: true,
+		CreateTime:        now,
+		UpdateTime:        now,
+	}); err != nil {
+		return nil, err
+	}
+
+	online.NotifyChannelsChanged(ctx, ownerID)
+	return toGuildItem(guild, msgModel.GuildPermAll), nil
+}
+
+// GetGuild 服务器资料：成员可见，公开服务器所有人可见
+func GetGuild(ctx context.Context, tenantID, userID, guildID string) (*GuildItem, error) {
+	state, err := loadGuildPermState(ctx, tenantID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errors.ErrGuildUnavailable.WrapMsg("guild not available", "guild_id", guildID)
+	}
+	mm := msgModel.GuildMember{}
+	member, err := mm.GetGuildMember(ctx, tenantID, guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil && !state.guild.IsPublic {
+		return nil, errors.ErrNoPermission.WrapMsg("not guild member", "guild_id", guildID)
+	}
+	return toGuildItem(state.guild, state.permissions(nil, nil, member)), nil
+}
+
+// ListMyGuilds 我加入的服务器
+func ListMyGuilds(ctx context.Context, tenantID, userID string) ([]*GuildItem, error) {
+	mm := msgModel.GuildMember{}
+	guildIDs, err := mm.ListUserGuildIDs(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*GuildItem, 0, len(guildIDs))
+	gm := msgModel.Guild{}
+	for _, gid := range guildIDs {
+		g, err := gm.GetGuildByID(ctx, tenantID, gid)
+		if err != nil {
+			return nil, err
+		}
+		if g == nil || g.Status != msgModel.GuildStatusNormal {
+			continue
+		}
+		perms, err := GuildPermissions(ctx, tenantID, gid, "", userID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, toGuildItem(g, perms))
+	}
+	return out, nil
+}
+
+// JoinGuild 加入公开服务器
+func JoinGuild(ctx context.Context, tenantID, userID, guildID string) (*GuildItem, error) {
+	gm := msgModel.Guild{}
+	g, err := gm.GetGuildByID(ctx, tenantID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil || g.Status != msgModel.GuildStatusNormal {
+		return nil, errors.ErrGuildUnavailable.WrapMsg("guild not available", "guild_id", guildID)
+	}
+	if !g.IsPublic {
+		return nil, errors.ErrNoPermission.WrapMsg("guild is not public", "guild_id", guildID)
+	}
+	now := time.Now()
+	mm := msgModel.GuildMember{}
+	ok, err := mm.AddGuildMember(ctx, &msgModel.GuildMember{
+		TenantID:   tenantID,
+		GuildID:    guildID,
+		UserID:     userID,
+		RoleIDs:    []string{},
+		JoinTime:   now,
+		UpdateTime: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.ErrAlreadyGroupMember.WrapMsg("already guild member", "guild_id", guildID)
+	}
+	if err := gm.IncGuildMemberCount(ctx, tenantID, guildID, 1); err != nil {
+		return nil, err
+	}
+	g.MemberCount++
+	online.NotifyChannelsChanged(ctx, userID)
+
+	perms, err := GuildPermissions(ctx, tenantID, guildID, "", userID)
+	if err != nil {
+		return nil, err
+	}
+	return toGuildItem(g, perms), nil
+}
+
+// removeGuildMember 离开/被踢：成员数 -1，权限缓存失效，网关重新加载订阅
+func removeGuildMember(ctx context.Context, tenantID, guildID, userID string, status int32) error {
+	mm := msgModel.GuildMember{}
+	ok, err := mm.RemoveGuildMember(ctx, tenantID, guildID, userID, status, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrNoPermission.WrapMsg("not guild member", "guild_id", guildID, "user_id", userID)
+	}
+	gm := msgModel.Guild{}
+	if err := gm.IncGuildMemberCount(ctx, tenantID, guildID, -1); err != nil {
+		return err
+	}
+	InvalidateGuildPermissions(ctx, guildID)
+	online.NotifyChannelsChanged(ctx, userID)
+	return nil
+}
+
+// LeaveGuild 离开服务器；所有者不能离开
+func LeaveGuild(ctx context.Context, tenantID, userID, guildID string) error {
+	state, _, _, err := guildActor(ctx, tenantID, guildID, userID, 0)
+	if err != nil {
+		return err
+	}
+	if state.guild.OwnerUserID == userID {
+		return errors.ErrNoPermission.WrapMsg("owner cannot leave the guild", "guild_id", guildID)
+	}
+	return removeGuildMember(ctx, tenantID, guildID, userID, msgModel.GuildMemberStatusLeft)
+}
+
+// KickGuildMember 踢人（需要踢出权限），只能踢角色层级比自己低的人
+func KickGuildMember(ctx context.Context, tenantID, userID, guildID, targetID string) error {
+	state, actor, _, err := guildActor(ctx, tenantID, guildID, userID, msgModel.GuildPermKickMembers)
+	if err != nil {
+		return err
+	}
+	mm := msgModel.GuildMember{}
+	target, err := mm.GetGuildMember(ctx, tenantID, guildID, targetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return errors.ErrNoPermission.WrapMsg("not guild member", "guild_id", guildID, "user_id", targetID)
+	}
+	if targetID == state.guild.OwnerUserID || state.topPosition(target) >= state.topPosition(actor) {
+		return errors.ErrNoPermission.WrapMsg("cannot kick member with equal or higher role", "user_id", targetID)
+	}
+	return removeGuildMember(ctx, tenantID, guildID, targetID, msgModel.GuildMemberStatusKicked)
+}
+
+// CreateGuildChannel 建频道/分类（需要管理频道权限）
+func CreateGuildChannel(ctx context.Context, tenantID, userID, guildID string, in *GuildChannelInput) (*GuildChannelItem, error) {
+	if in == nil || strings.TrimSpace(in.Name) == "" {
+		return nil, errors.ErrArgs.WrapMsg("name is empty")
+	}
+	if utf8.RuneCountInString(in.Name) > guildChannelNameMaxRunes {
+		return nil, errors.ErrArgs.WrapMsg("name too long", "max", guildChannelNameMaxRunes)
+	}
+	switch in.Type {
+	case msgModel.GuildChannelTypeText, msgModel.GuildChannelTypeNews, msgModel.GuildChannelTypeCategory:
+	default:
+		return nil, errors.ErrArgs.WrapMsg("invalid channel type", "type", in.Type)
+	}
+	_, _, perms, err := guildActor(ctx, tenantID, guildID, userID, msgModel.GuildPermManageChannels)
+	if err != nil {
+		return nil, err
+	}
+	if in.ParentID != "" {
+		if in.Type == msgModel.GuildChannelTypeCategory {
+			return nil, errors.ErrArgs.WrapMsg("category cannot be nested")
+		}
+		parent, err := guildChannelOf(ctx, tenantID, guildID, in.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.Type != msgModel.GuildChannelTypeCategory {
+			return nil, errors.ErrArgs.WrapMsg("parent is not a category", "parent_id", in.ParentID)
+		}
+	}
+	overwrites, err := checkOverwrites(in.Overwrites, perms)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ch := &msgModel.GuildChannel{
+		TenantID:          tenantID,
+		GuildID:           guildID,
+		ChannelID:         ids.GenerateString(),
+		ParentID:          in.ParentID,
+		Type:              in.Type,
+		Name:              in.Name,
+		Overwrites:        overwrites,
+		PermissionsSynced: in.ParentID != "" && len(in.Overwrites) == 0,
+		CreateTime:        now,
+		UpdateTime:        now,
+	}
+	if in.Topic != nil {
+		ch.Topic = *in.Topic
+	}
+	if in.Position != nil {
+		ch.Position = *in.Position
+	}
+	cm := msgModel.GuildChannel{}
+	if err := cm.InsertChannel(ctx, ch); err != nil {
+		return nil, err
+	}
+	return toGuildChannelItem(ch, perms), nil
+}
+
+// UpdateGuildChannel 改频道名称/主题/排序（需要管理频道权限，且能看到该频道）
+func UpdateGuildChannel(ctx context.Context, tenantID, userID, guildID, channelID string, in *GuildChannelInput) (*GuildChannelItem, error) {
+	if in == nil {
+		return nil, errors.ErrArgs.WrapMsg("nothing to update")
+	}
+	perms, err := requireGuildChannelPerm(ctx, tenantID, userID, guildID, channelID, msgModel.GuildPermManageChannels)
+	if err != nil {
+		return nil, err
+	}
+	set := bson.M{msgModel.GuildChannelFieldUpdateTime: time.Now()}
+	if in.Name != "" {
+		if utf8.RuneCountInString(in.Name) > guildChannelNameMaxRunes {
+			return nil, errors.ErrArgs.WrapMsg("name too long", "max", guildChannelNameMaxRunes)
+		}
+		set[msgModel.GuildChannelFieldName] = in.Name
+	}
+	if in.Topic != nil {
+		set[msgModel.GuildChannelFieldTopic] = *in.Topic
+	}
+	if in.Position != nil {
+		set[msgModel.GuildChannelFieldPosition] = *in.Position
+	}
+	cm := msgModel.GuildChannel{}
+	ch, err := cm.UpdateChannelFields(ctx, tenantID, channelID, set)
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, errors.ErrGuildUnavailable.WrapMsg("channel not available", "channel_id", channelID)
+	}
+	return toGuildChannelItem(ch, perms), nil
+}
+
+// DeleteGuildChannel 删除频道（需要管理频道权限）；删除分类时子频道移到顶层
+func DeleteGuildChannel(ctx context.Context, tenantID, userID, guildID, channelID string) error {
+	if _, err := requireGuildChannelPerm(ctx, tenantID, userID, guildID, channelID, msgModel.GuildPermManageChannels); err != nil {
+		return err
+	}
+	now := time.Now()
+	cm := msgModel.GuildChannel{}
+	ch, err := cm.UpdateChannelFields(ctx, tenantID, channelID, bson.M{
+		msgModel.GuildChannelFieldStatus:     msgModel.GuildChannelStatusDeleted,
+		msgModel.GuildChannelFieldUpdateTime: now,
+	})
+	if err != nil || ch == nil {
+		return err
+	}
+	if ch.Type == msgModel.GuildChannelTypeCategory {
+		if err := cm.DetachChildren(ctx, tenantID, guildID, ch, now); err != nil {
+			return err
+		}
+		InvalidateGuildPermissions(ctx, guildID)
+	}
+	return nil
+}
+
+// ListGuildChannels 调用者能看到的频道；分类下有可见频道时分类也可见
+func ListGuildChannels(ctx context.Context, tenantID, userID, guildID string) ([]*GuildChannelItem, error) {
+	state, member, _, err := guildActor(ctx, tenantID, guildID, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	cm := msgModel.GuildChannel{}
+	channels, err := cm.ListChannels(ctx, tenantID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*msgModel.GuildChannel, len(channels))
+	for _, c := range channels {
+		byID[c.ChannelID] = c
+	}
+	permsOf := func(c *msgModel.GuildChannel) int64 {
+		overwrites := c.Overwrites
+		if p := byID[c.ParentID]; c.PermissionsSynced && p != nil {
+			overwrites = p.Overwrites
+		}
+		return state.permissions(overwrites, c, member)
+	}
+
+	visibleParent := make(map[string]bool)
+	items := make(map[string]*GuildChannelItem, len(channels))
+	for _, c := range channels {
+		perms := permsOf(c)
+		if perms&msgModel.GuildPermViewChannel == 0 {
+			continue
+		}
+		items[c.ChannelID] = toGuildChannelItem(c, perms)
+		if c.ParentID != "" {
+			visibleParent[c.ParentID] = true
+		}
+	}
+	out := make([]*GuildChannelItem, 0, len(items))
+	for _, c := range channels {
+		item := items[c.ChannelID]
+		if item == nil && c.Type == msgModel.GuildChannelTypeCategory && visibleParent[c.ChannelID] {
+			item = toGuildChannelItem(c, permsOf(c))
+		}
+		if item != nil {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// requireGuildChannelPerm 频道属于该服务器，且调用者在频道上有 need 权限
+func requireGuildChannelPerm(ctx context.Context, tenantID, userID, guildID, channelID string, need int64) (int64, error) {
+	if _, err := guildChannelOf(ctx, tenantID, guildID, channelID); err != nil {
+		return 0, err
+	}
+	perms, err := GuildPermissions(ctx, tenantID, guildID, channelID, userID)
+	if err != nil {
+		return 0, err
+	}
+	if perms&need != need {
+		return 0, errors.ErrNoPermission.WrapMsg("missing channel permission", "channel_id", channelID, "need", need)
+	}
+	return perms, nil
+}
+
+// checkOverwrites 覆盖只能涉及操作人自己拥有的权限位（管理员不受限）
+func checkOverwrites(overwrites []msgModel.PermOverwrite, actorPerms int64) ([]msgModel.PermOverwrite, error) {
+	out := make([]msgModel.PermOverwrite, 0, len(overwrites))
+	for _, ow := range overwrites {
+		if ow.TargetID == "" || (ow.Type != msgModel.OverwriteTypeRole && ow.Type != msgModel.OverwriteTypeMember) {
+			return nil, errors.ErrArgs.WrapMsg("invalid overwrite", "target_id", ow.TargetID, "type", ow.Type)
+		}
+		ow.Allow &= msgModel.GuildPermAll
+		ow.Deny &= msgModel.GuildPermAll &^ ow.Allow
+		if actorPerms&msgModel.GuildPermAdministrator == 0 && (ow.Allow|ow.Deny)&^actorPerms != 0 {
+			return nil, errors.ErrNoPermission.WrapMsg("cannot overwrite permissions you do not have", "target_id", ow.TargetID)
+		}
+		out = append(out, ow)
+	}
+	return out, nil
+}
+
+// SetChannelOverwrite 设置/替换频道上某个角色或成员的覆盖（需要管理角色权限）
+// 跟随分类的频道改覆盖后不再跟随：先拷一份分类的覆盖再修改
+func SetChannelOverwrite(ctx context.Context, tenantID, userID, guildID, channelID string, ow msgModel.PermOverwrite, remove bool) (*GuildChannelItem, error) {
+	perms, err := requireGuildChannelPerm(ctx, tenantID, userID, guildID, channelID, msgModel.GuildPermManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	checked, err := checkOverwrites([]msgModel.PermOverwrite{ow}, perms)
+	if err != nil {
+		return nil, err
+	}
+	ow = checked[0]
+
+	cm := msgModel.GuildChannel{}
+	ch, err := cm.GetChannel(ctx, tenantID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, errors.ErrGuildUnavailable.WrapMsg("channel not available", "channel_id", channelID)
+	}
+	current, err := channelOverwrites(ctx, tenantID, ch)
+	if err != nil {
+		return nil, err
+	}
+	next := make([]msgModel.PermOverwrite, 0, len(current)+1)
+	for _, o := range current {
+		if o.TargetID != ow.TargetID || o.Type != ow.Type {
+			next = append(next, o)
+		}
+	}
+	if !remove {
+		next = append(next, ow)
+	}
+	ch, err = cm.UpdateChannelFields(ctx, tenantID, channelID, bson.M{
+		msgModel.GuildChannelFieldOverwrites:      next,
+		msgModel.GuildChannelFieldPermissionsSync: false,
+		msgModel.GuildChannelFieldUpdateTime:      time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, errors.ErrGuildUnavailable.WrapMsg("channel not available", "channel_id", channelID)
+	}
+	InvalidateGuildPermissions(ctx, guildID)
+	return toGuildChannelItem(ch, perms), nil
+}
+
+// ListGuildRoles 服务器的角色（成员可见），按层级从低到高
+func ListGuildRoles(ctx context.Context, tenantID, userID, guildID string) ([]*GuildRoleItem, error) {
+	state, _, _, err := guildActor(ctx, tenantID, guildID, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	rm := msgModel.GuildRole{}
+	rows, err := rm.ListRoles(ctx, tenantID, state.guild.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*GuildRoleItem, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, toGuildRoleItem(r))
+	}
+	return out, nil
+}
+
+// checkRoleEdit 角色编辑的层级和权限位限制：只能动比自己最高角色低的位置，只能给自己拥有的权限
+func checkRoleEdit(state *guildPermState, actor *msgModel.GuildMember, actorPerms int64, position int32, permissions int64) error {
+	if position >= state.topPosition(actor) {
+		return errors.ErrNoPermission.WrapMsg("role position must be lower than your highest role", "position", position)
+	}
+	if actorPerms&msgModel.GuildPermAdministrator == 0 && permissions&^actorPerms != 0 {
+		return errors.ErrNoPermission.WrapMsg("cannot grant permissions you do not have")
+	}
+	return nil
+}
+
+// CreateGuildRole 建角色（需要管理角色权限）
+func CreateGuildRole(ctx context.Context, tenantID, userID, guildID string, in *GuildRoleInput) (*GuildRoleItem, error) {
+	if in == nil || in.Name == nil || strings.TrimSpace(*in.Name) == "" {
+		return nil, errors.ErrArgs.WrapMsg("name is empty")
+	}
+	state, actor, perms, err := guildActor(ctx, tenantID, guildID, userID, msgModel.GuildPermManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	if len(state.roles) >= guildRolesMax {
+		return nil, errors.ErrArgs.WrapMsg("too many roles", "max", guildRolesMax)
+	}
+	now := time.Now()
+	role := &msgModel.GuildRole{
+		TenantID:   tenantID,
+		GuildID:    guildID,
+		RoleID:     ids.GenerateString(),
+		Name:       *in.Name,
+		Position:   1,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if in.Color != nil {
+		role.Color = *in.Color
+	}
+	if in.Permissions != nil {
+		role.Permissions = *in.Permissions & msgModel.GuildPermAll
+	}
+	if in.Position != nil {
+		role.Position = *in.Position
+	}
+	if role.Position < 1 {
+		return nil, errors.ErrArgs.WrapMsg("position must be above @everyone", "position", role.Position)
+	}
+	if err := checkRoleEdit(state, actor, perms, role.Position, role.Permissions); err != nil {
+		return nil, err
+	}
+	rm := msgModel.GuildRole{}
+	if err := rm.InsertRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return toGuildRoleItem(role), nil
+}
+
+// UpdateGuildRole 改角色（需要管理角色权限）；@everyone 只能改权限
+func UpdateGuildRole(ctx context.Context, tenantID, userID, guildID, roleID string, in *GuildRoleInput) (*GuildRoleItem, error) {
+	if in == nil {
+		return nil, errors.ErrArgs.WrapMsg("nothing to update")
+	}
+	state, actor, perms, err := guildActor(ctx, tenantID, guildID, userID, msgModel.GuildPermManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	role := state.roles[roleID]
+	if role == nil {
+		return nil, errors.ErrRecordNotFound.WrapMsg("role not found", "role_id", roleID)
+	}
+	if !role.IsEveryone() {
+		if err := checkRoleEdit(state, actor, perms, role.Position, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	set := bson.M{msgModel.GuildRoleFieldUpdateTime: time.Now()}
+	if in.Permissions != nil {
+		p := *in.Permissions & msgModel.GuildPermAll
+		// 只看新增的位：自己没有的权限保留原样可以，但不能新加
+		if perms&msgModel.GuildPermAdministrator == 0 && (p&^role.Permissions)&^perms != 0 {
+			return nil, errors.ErrNoPermission.WrapMsg("cannot grant permissions you do not have")
+		}
+		set[msgModel.GuildRoleFieldPermissions] = p
+	}
+	if !role.IsEveryone() {
+		if in.Name != nil && strings.TrimSpace(*in.Name) != "" {
+			set[msgModel.GuildRoleFieldName] = *in.Name
+		}
+		if in.Color != nil {
+			set[msgModel.GuildRoleFieldColor] = *in.Color
+		}
+		if in.Position != nil {
+			if *in.Position < 1 {
+				return nil, errors.ErrArgs.WrapMsg("position must be above @everyone", "position", *in.Position)
+			}
+			if err := checkRoleEdit(state, actor, perms, *in.Position, 0); err != nil {
+				return nil, err
+			}
+			set[msgModel.GuildRoleFieldPosition] = *in.Position
+		}
+	}
+
+	rm := msgModel.GuildRole{}
+	updated, err := rm.UpdateRoleFields(ctx, tenantID, guildID, roleID, set)
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		return nil, errors.ErrRecordNotFound.WrapMsg("role not found", "role_id", roleID)
+	}
+	InvalidateGuildPermissions(ctx, guildID)
+	return toGuildRoleItem(updated), nil
+}
+
+// DeleteGuildRole 删除角色（需要管理角色权限）：从成员和频道覆盖里一并去掉；@everyone 不能删
+func DeleteGuildRole(ctx context.Context, tenantID, userID, guildID, roleID string) error {
+	state, actor, perms, err := guildActor(ctx, tenantID, guildID, userID, msgModel.GuildPermManageRoles)
+	if err != nil {
+		return err
+	}
+	role := state.roles[roleID]
+	if role == nil {
+		return errors.ErrRecordNotFound.WrapMsg("role not found", "role_id", roleID)
+	}
+	if role.IsEveryone() {
+		return errors.ErrArgs.WrapMsg("cannot delete @everyone")
+	}
+	if err := checkRoleEdit(state, actor, perms, role.Position, 0); err != nil {
+		return err
+	}
+	rm := msgModel.GuildRole{}
+	if _, err := rm.DeleteRole(ctx, tenantID, guildID, roleID); err != nil {
+		return err
+	}
+	mm := msgModel.GuildMember{}
+	if err := mm.PullRoleFromMembers(ctx, tenantID, guildID, roleID); err != nil {
+		return err
+	}
+	cm := msgModel.GuildChannel{}
+	if err := cm.PullRoleOverwrites(ctx, tenantID, guildID, roleID); err != nil {
+		return err
+	}
+	InvalidateGuildPermissions(ctx, guildID)
+	return nil
+}
+
+// SetGuildMemberRole 给成员加/去掉角色（需要管理角色权限，角色层级低于自己）
+func SetGuildMemberRole(ctx context.Context, tenantID, userID, guildID, targetID, roleID string, enable bool) error {
+	state, actor, perms, err := guildActor(ctx, tenantID, guildID, userID, msgModel.GuildPermManageRoles)
+	if err != nil {
+		return err
+	}
+	role := state.roles[roleID]
+	if role == nil || role.IsEveryone() {
+		return errors.ErrRecordNotFound.WrapMsg("role not found", "role_id", roleID)
+	}
+	if err := checkRoleEdit(state, actor, perms, role.Position, 0); err != nil {
+		return err
+	}
+	mm := msgModel.GuildMember{}
+	ok, err := mm.SetMemberRole(ctx, tenantID, guildID, targetID, roleID, enable)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrNoPermission.WrapMsg("not guild member", "guild_id", guildID, "user_id", targetID)
+	}
+	InvalidateGuildPermissions(ctx, guildID)
+	return nil
+}
+
+// GetMyGuildPermissions 调用者在服务器（channelID 为空）或频道上的权限
+func GetMyGuildPermissions(ctx context.Context, tenantID, userID, guildID, channelID string) (int64, error) {
+	if channelID != "" {
+		if _, err := guildChannelOf(ctx, tenantID, guildID, channelID); err != nil {
+			return 0, err
+		}
+	}
+	return GuildPermissions(ctx, tenantID, guildID, channelID, userID)
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/module/chat/seq"
+	redis2 "PProject/service/storage/redis"
+	errors "PProject/tools/errs"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ===== 服务器权限计算 =====
+// 服务器级：所有者全部权限；否则 @everyone | 成员所有角色；带管理员位直接全部权限
+// 频道级：@everyone 覆盖 -> 角色覆盖（所有角色的 allow/deny 合并后一次生效）-> 成员覆盖；看不到频道的其余权限全部失效
+// 结果按 (服务器, 权限版本, 频道, 用户) 缓存在 Redis；角色/覆盖/成员角色变更时版本号 +1，旧缓存自然失效
+
+const guildPermCacheTTL = 10 * time.Minute
+
+func guildPermVersionKey(guildID string) string { return "guild:permver:{" + guildID + "}" }
+
+func guildPermCacheKey(guildID string, version int64, channelID, userID string) string {
+	return fmt.Sprintf("guild:perm:{%s}:%d:%s:%s", guildID, version, channelID, userID)
+}
+
+// ComputeBasePermissions 服务器级权限
+func ComputeBasePermissions(guild *msgModel.Guild, roles map[string]*msgModel.GuildRole, member *msgModel.GuildMember) int64 {
+	if member == nil {
+		return 0
+	}
+	if guild.OwnerUserID == member.UserID {
+		return msgModel.GuildPermAll
+	}
+	var perms int64
+	if everyone := roles[guild.GuildID]; everyone != nil {
+		perms = everyone.Permissions
+	}
+	for _, rid := range member.RoleIDs {
+		if r := roles[rid]; r != nil {
+			perms |= r.Permissions
+		}
+	}
+	if perms&msgModel.GuildPermAdministrator != 0 {
+		return msgModel.GuildPermAll
+	}
+	return perms
+}
+
+// ComputeOverwrites 在服务器级权限上叠加频道覆盖；管理员不受覆盖影响
+func ComputeOverwrites(base int64, guildID string, overwrites []msgModel.PermOverwrite, member *msgModel.GuildMember) int64 {
+	if base&msgModel.GuildPermAdministrator != 0 {
+		return msgModel.GuildPermAll
+	}
+	if member == nil {
+		return 0
+	}
+	perms := base
+
+	hasRole := make(map[string]bool, len(member.RoleIDs))
+	for _, rid := range member.RoleIDs {
+		hasRole[rid] = true
+	}
+	var roleAllow, roleDeny int64
+	var memberOW *msgModel.PermOverwrite
+	for i := range overwrites {
+		ow := &overwrites[i]
+		switch {
+		case ow.Type == msgModel.OverwriteTypeRole && ow.TargetID == guildID:
+			perms &^= ow.Deny
+			perms |= ow.Allow
+		case ow.Type == msgModel.OverwriteTypeRole && hasRole[ow.TargetID]:
+			roleAllow |= ow.Allow
+			roleDeny |= ow.Deny
+		case ow.Type == msgModel.OverwriteTypeMember && ow.TargetID == member.UserID:
+			memberOW = ow
+		}
+	}
+	// @everyone 必须先于角色覆盖生效，所以角色覆盖在循环外统一应用
+	perms &^= roleDeny
+	perms |= roleAllow
+	if memberOW != nil {
+		perms &^= memberOW.Deny
+		perms |= memberOW.Allow
+	}
+
+	if perms&msgModel.GuildPermViewChannel == 0 {
+		return 0
+	}
+	return perms
+}
+
+// guildPermState 一次权限计算需要的服务器和角色
+type guildPermState struct {
+	guild *msgModel.Guild
+	roles map[string]*msgModel.GuildRole
+}
+
+func loadGuildPermState(ctx context.Context, tenantID, guildID string) (*guildPermState, error) {
+	gm := msgModel.Guild{}
+	guild, err := gm.GetGuildByID(ctx, tenantID, guildID)
+	if err != nil || guild == nil || guild.Status != msgModel.GuildStatusNormal {
+		return nil, err
+	}
+	rm := msgModel.GuildRole{}
+	rows, err := rm.ListRoles(ctx, tenantID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]*msgModel.GuildRole, len(rows))
+	for _, r := range rows {
+		roles[r.RoleID] = r
+	}
+	return &guildPermState{guild: guild, roles: roles}, nil
+}
+
+// channelOverwrites 频道生效的覆盖：跟随分类的用分类的
+func channelOverwrites(ctx context.Context, tenantID string, ch *msgModel.GuildChannel) ([]msgModel.PermOverwrite, error) {
+	if ch == nil {
+		return nil, nil
+	}
+	if !ch.PermissionsSynced || ch.ParentID == "" {
+		return ch.Overwrites, nil
+	}
+	cm := msgModel.GuildChannel{}
+	parent, err := cm.GetChannel(ctx, tenantID, ch.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return ch.Overwrites, nil
+	}
+	return parent.Overwrites, nil
+}
+
+// permissions 成员在频道（ch 为 nil 时为服务器级）的最终权限
+func (s *guildPermState) permissions(overwrites []msgModel.PermOverwrite, ch *msgModel.GuildChannel, member *msgModel.GuildMember) int64 {
+	base := ComputeBasePermissions(s.guild, s.roles, member)
+	if ch == nil {
+		return base
+	}
+	return ComputeOverwrites(base, s.guild.GuildID, overwrites, member)
+}
+
+// guildPermVersion 服务器当前的权限版本号；Redis 不可用返回 -1（不走缓存）
+func guildPermVersion(ctx context.Context, guildID string) int64 {
+	v, err := redis2.GetRedis().Get(ctx, guildPermVersionKey(guildID)).Int64()
+	if err != nil && err != redis.Nil {
+		logger.Errorf("[GuildPerm] get version guild=%s err=%v", guildID, err)
+		return -1
+	}
+	return v
+}
+
+// InvalidateGuildPermissions 角色/覆盖/成员角色变了：服务器的权限缓存整体失效
+func InvalidateGuildPermissions(ctx context.Context, guildID string) {
+	if err := redis2.GetRedis().Incr(ctx, guildPermVersionKey(guildID)).Err(); err != nil {
+		logger.Errorf("[GuildPerm] invalidate guild=%s err=%v", guildID, err)
+	}
+}
+
+// GuildPermissions 用户在服务器（channelID 为空）或频道里的权限；不是成员为 0
+func GuildPermissions(ctx context.Context, tenantID, guildID, channelID, userID string) (int64, error) {
+	out, err := guildPermissionsBatch(ctx, tenantID, guildID, channelID, []string{userID})
+	if err != nil {
+		return 0, err
+	}
+	return out[userID], nil
+}
+
+// FilterGuildChannelViewers 过滤出能看到该频道的用户（网关下发频道消息用）
+func FilterGuildChannelViewers(ctx context.Context, tenantID, guildID, channelID string, userIDs []string) ([]string, error) {
+	perms, err := guildPermissionsBatch(ctx, tenantID, guildID, channelID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	out := userIDs[:0:0]
+	for _, u := range userIDs {
+		if perms[u]&msgModel.GuildPermViewChannel != 0 {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// guildPermissionsBatch 先查缓存，没命中的一次加载服务器/角色/频道/成员后计算并回写；只缓存成员的结果
+func guildPermissionsBatch(ctx context.Context, tenantID, guildID, channelID string, userIDs []string) (map[string]int64, error) {
+	out := make(map[string]int64, len(userIDs))
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+
+	version := guildPermVersion(ctx, guildID)
+	missing := userIDs
+	if version >= 0 {
+		keys := make([]string, len(userIDs))
+		for i, u := range userIDs {
+			keys[i] = guildPermCacheKey(guildID, version, channelID, u)
+		}
+		vals, err := redis2.GetRedis().MGet(ctx, keys...).Result()
+		if err != nil {
+			logger.Errorf("[GuildPerm] mget guild=%s err=%v", guildID, err)
+		} else {
+			missing = make([]string, 0, len(userIDs))
+			for i, v := range vals {
+				s, ok := v.(string)
+				if !ok {
+					missing = append(missing, userIDs[i])
+					continue
+				}
+				p, _ := strconv.ParseInt(s, 10, 64)
+				out[userIDs[i]] = p
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	state, err := loadGuildPermState(ctx, tenantID, guildID)
+	if err != nil || state == nil {
+		return out, err
+	}
+	var ch *msgModel.GuildChannel
+	var overwrites []msgModel.PermOverwrite
+	if channelID != "" {
+		cm := msgModel.GuildChannel{}
+		if ch, err = cm.GetChannel(ctx, tenantID, channelID); err != nil {
+			return nil, err
+		}
+		if ch == nil || ch.GuildID != guildID {
+			return out, nil
+		}
+		if overwrites, err = channelOverwrites(ctx, tenantID, ch); err != nil {
+			return nil, err
+		}
+	}
+	mm := msgModel.GuildMember{}
+	members, err := mm.ListGuildMembersByIDs(ctx, tenantID, guildID, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := redis2.GetRedis().Pipeline()
+	for _, m := range members {
+		p := state.permissions(overwrites, ch, m)
+		out[m.UserID] = p
+		if version >= 0 {
+			pipe.Set(ctx, guildPermCacheKey(guildID, version, channelID, m.UserID), p, guildPermCacheTTL)
+		}
+	}
+	if version >= 0 && len(members) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.Errorf("[GuildPerm] cache guild=%s err=%v", guildID, err)
+		}
+	}
+	return out, nil
+}
+
+// 读频道历史/检索需要的权限
+const guildReadPerms = msgModel.GuildPermViewChannel | msgModel.GuildPermReadMessageHistory
+
+// CheckGuildChannelPerm 频道权限校验：不是服务器频道返回 nil, nil；缺少 need 里任何一位返回无权限
+func CheckGuildChannelPerm(ctx context.Context, tenantID, userID, channelID string, need int64) (*msgModel.GuildChannel, error) {
+	cm := msgModel.GuildChannel{}
+	ch, err := cm.GetChannel(ctx, tenantID, channelID)
+	if err != nil || ch == nil {
+		return nil, err
+	}
+	perms, err := GuildPermissions(ctx, tenantID, ch.GuildID, channelID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if perms&need != need {
+		return nil, errors.ErrNoPermission.WrapMsg("missing channel permission", "channel_id", channelID, "need", need)
+	}
+	return ch, nil
+}
+
+// CheckGuildSend 服务器频道发消息：频道存在且能发消息，发送者有查看+发消息权限；@全体、带附件还需要对应权限
+func CheckGuildSend(ctx context.Context, tenantID, senderID string, md *pb.MessageData) (*msgModel.GuildChannel, error) {
+	cm := msgModel.GuildChannel{}
+	ch, err := cm.GetChannel(ctx, tenantID, md.GetChannelId())
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil || ch.GuildID != md.GetGuildId() || ch.Type == msgModel.GuildChannelTypeCategory {
+		return nil, errors.ErrGuildUnavailable.WrapMsg("channel not available", "guild_id", md.GetGuildId(), "channel_id", md.GetChannelId())
+	}
+
+	need := msgModel.GuildPermViewChannel | msgModel.GuildPermSendMessages
+	if hasAtAll(md.GetAtTextElem().GetAtUserList()) {
+		need |= msgModel.GuildPermMentionEveryone
+	}
+	if mediaSize(md) > 0 {
+		need |= msgModel.GuildPermAttachFiles
+	}
+	perms, err := GuildPermissions(ctx, tenantID, ch.GuildID, ch.ChannelID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if perms&need != need {
+		return nil, errors.ErrNoPermission.WrapMsg("missing channel permission", "channel_id", ch.ChannelID, "need", need, "have", perms)
+	}
+	return ch, nil
+}
+
+// guildReadableConversation 服务器频道的只读视图：能看频道且能读历史；不是服务器频道返回 nil
+func guildReadableConversation(ctx context.Context, tenantID, userID, channelID string) (*msgModel.Conversation, error) {
+	ch, err := CheckGuildChannelPerm(ctx, tenantID, userID, channelID, guildReadPerms)
+	if err != nil || ch == nil {
+		return nil, err
+	}
+	return &msgModel.Conversation{
+		TenantID:         tenantID,
+		OwnerUserID:      userID,
+		ConversationID:   seq.ChannelConvID(channelID),
+		ConversationType: int32(seq.ConvTypeChannel),
+	}, nil
+}
+
+// ensureGuildReadState 服务器频道标已读：要能看到频道，已读游标落在懒建的会话记录上
+func ensureGuildReadState(ctx context.Context, tenantID, userID, conversationID string) error {
+	channelID, ok := seq.ChannelIDOf(conversationID)
+	if !ok {
+		return nil
+	}
+	ch, err := CheckGuildChannelPerm(ctx, tenantID, userID, channelID, msgModel.GuildPermViewChannel)
+	if err != nil || ch == nil {
+		return err
+	}
+	cm := msgModel.Conversation{}
+	return cm.EnsureGroupConversations(ctx, tenantID, conversationID, "", int32(seq.ConvTypeChannel), []string{userID}, 0)
+}
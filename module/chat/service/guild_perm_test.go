@@ -0,0 +1,61 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	"testing"
+)
+
+func TestGuildPermissions(t *testing.T) {
+	guild := &msgModel.Guild{GuildID: "g1", OwnerUserID: "owner"}
+	roles := map[string]*msgModel.GuildRole{
+		"g1":    {RoleID: "g1", Permissions: msgModel.GuildPermViewChannel | msgModel.GuildPermSendMessages},
+		"mod":   {RoleID: "mod", Permissions: msgModel.GuildPermManageMessages},
+		"admin": {RoleID: "admin", Permissions: msgModel.GuildPermAdministrator},
+	}
+	member := &msgModel.GuildMember{UserID: "u1", RoleIDs: []string{"mod"}}
+	view, send := msgModel.GuildPermViewChannel, msgModel.GuildPermSendMessages
+
+	base := ComputeBasePermissions(guild, roles, member)
+	if want := view | send | msgModel.GuildPermManageMessages; base != want {
+		t.Fatalf("base = %b, want %b", base, want)
+	}
+	if p := ComputeBasePermissions(guild, roles, &msgModel.GuildMember{UserID: "owner"}); p != msgModel.GuildPermAll {
+		t.Fatalf("owner base = %b", p)
+	}
+	if p := ComputeBasePermissions(guild, roles, &msgModel.GuildMember{UserID: "u2", RoleIDs: []string{"admin"}}); p != msgModel.GuildPermAll {
+		t.Fatalf("admin base = %b", p)
+	}
+
+	// @everyone 拒绝查看，角色覆盖再放开：角色覆盖在 @everyone 之后生效
+	private := []msgModel.PermOverwrite{
+		{TargetID: "mod", Type: msgModel.OverwriteTypeRole, Allow: view},
+		{TargetID: "g1", Type: msgModel.OverwriteTypeRole, Deny: view | send},
+	}
+	if p := ComputeOverwrites(base, "g1", private, member); p&view == 0 || p&send != 0 {
+		t.Fatalf("mod in private channel = %b", p)
+	}
+	if p := ComputeOverwrites(base, "g1", private, &msgModel.GuildMember{UserID: "u3"}); p != 0 {
+		t.Fatalf("@everyone in private channel = %b", p)
+	}
+
+	// 成员覆盖最后生效，盖过角色覆盖
+	withMember := append(private, msgModel.PermOverwrite{TargetID: "u1", Type: msgModel.OverwriteTypeMember, Deny: view})
+	if p := ComputeOverwrites(base, "g1", withMember, member); p != 0 {
+		t.Fatalf("member denied = %b", p)
+	}
+
+	// 同一层的角色覆盖 allow 优先于 deny
+	roleConflict := []msgModel.PermOverwrite{
+		{TargetID: "mod", Type: msgModel.OverwriteTypeRole, Deny: send},
+		{TargetID: "extra", Type: msgModel.OverwriteTypeRole, Allow: send},
+	}
+	two := &msgModel.GuildMember{UserID: "u1", RoleIDs: []string{"mod", "extra"}}
+	if p := ComputeOverwrites(base, "g1", roleConflict, two); p&send == 0 {
+		t.Fatalf("role allow should win over role deny: %b", p)
+	}
+
+	// 管理员不受覆盖影响
+	if p := ComputeOverwrites(msgModel.GuildPermAll, "g1", withMember, member); p != msgModel.GuildPermAll {
+		t.Fatalf("admin bypass = %b", p)
+	}
+}
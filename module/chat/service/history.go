@@ -0,0 +1,284 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	sessionpb "PProject/gen/session"
+	msgModel "PProject/module/chat/model"
+	"PProject/module/chat/seq"
+	errors "PProject/tools/errs"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyDefaultPageSize = 20
+	historyMaxPageSize     = 100
+
+	historyCursorSeq  = "s" // s:<seq>
+	historyCursorTime = "t" // t:<send_time_ms>:<seq>
+)
+
+// historyCursor 游标（服务端生成，客户端原样带回）
+type historyCursor struct {
+	ByTime bool
+	TMS    int64
+	Seq    int64
+}
+
+func (c historyCursor) String() string {
+	if c.ByTime {
+		return fmt.Sprintf("%s:%d:%d", historyCursorTime, c.TMS, c.Seq)
+	}
+	return fmt.Sprintf("%s:%d", historyCursorSeq, c.Seq)
+}
+
+func parseHistoryCursor(s string) (*historyCursor, error) {
+	parts := strings.Split(s, ":")
+	switch {
+	case len(parts) == 2 && parts[0] == historyCursorSeq:
+		v, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &historyCursor{Seq: v}, nil
+	case len(parts) == 3 && parts[0] == historyCursorTime:
+		t, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		v, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &historyCursor{ByTime: true, TMS: t, Seq: v}, nil
+	}
+	return nil, fmt.Errorf("bad cursor %q", s)
+}
+
+// ResolveConversationID 根据请求里的路由字段算出会话ID；优先级 thread > channel > group > 单聊
+func ResolveConversationID(userID string, req *sessionpb.ListHistoryReq) string {
+	switch {
+	case req.GetThreadId() != "":
+		return seq.ThreadConvID(req.GetThreadId())
+	case req.GetChannelId() != "":
+		return seq.ChannelConvID(req.GetChannelId())
+	case req.GetGroupId() != "":
+		return seq.GroupConvID(req.GetGroupId())
+	case req.GetUserPeerId() != "":
+		return seq.BuildP2PConvID(userID, req.GetUserPeerId())
+	}
+	return ""
+}
+
+// retentionCutoffMS 计算留存边界（ms）：群和租户同时配置时取更严格的那个；0=不限
+func retentionCutoffMS(ctx context.Context, tenantID, groupID string, now time.Time) (int64, error) {
+	var tenantDays, groupDays int32
+	tenant, err := getTenant(ctx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	if tenant != nil {
+		tenantDays = tenant.RetentionDays
+	}
+
+	if groupID != "" {
+		gm := msgModel.Group{}
+		group, err := gm.GetGroupByID(ctx, tenantID, groupID)
+		if err != nil {
+			return 0, err
+		}
+		if group != nil {
+			groupDays = group.RetentionDays
+		}
+	}
+	return retentionCutoff(now, tenantDays, groupDays), nil
+}
+
+// retentionCutoff 多个留存天数里取最严格的（<=0 表示不限），算出可见的最早发送时间（ms）；0=不限
+func retentionCutoff(now time.Time, days ...int32) int64 {
+	strictest := int32(0)
+	for _, d := range days {
+		if d > 0 && (strictest == 0 || d < strictest) {
+			strictest = d
+		}
+	}
+	if strictest == 0 {
+		return 0
+	}
+	return now.Add(-time.Duration(strictest) * 24 * time.Hour).UnixMilli()
+}
+
+// retentionGroupOf 留存天数按哪个群/频道算：和 ResolveConversationID 同样的优先级，话题跟随根消息所在的群/频道
+func retentionGroupOf(ctx context.Context, tenantID, threadID, channelID, groupID string) (string, error) {
+	switch {
+	case threadID != "":
+		root, err := GetThreadRoot(ctx, tenantID, threadID)
+		if err != nil {
+			return "", err
+		}
+		return rootRetentionGroup(root), nil
+	case channelID != "":
+		return channelID, nil
+	}
+	return groupID, nil
+}
+
+// rootRetentionGroup 话题根消息所在的群/频道
+func rootRetentionGroup(root *msgModel.MessageModel) string {
+	if root.ChannelID != "" {
+		return root.ChannelID
+	}
+	return root.GroupID
+}
+
+// ListHistory 拉取历史消息
+// 翻页方式：
+//   - page.cursor：上一页返回的 next_cursor，按原模式（seq/时间）继续翻
+//   - anchor_client_msg_id：以某条消息为锚点，按 seq 向前/向后翻（不含锚点）
+//   - before/after：按发送时间翻页
+//   - 都不传：向旧方向从最新一条开始，向新方向从可见的第一条开始
+//
+// 可见范围：调用者会话的 min_seq（清空历史）、群/租户留存天数；临时消息和墓碑默认不返回
+func ListHistory(ctx context.Context, tenantID, userID string, req *sessionpb.ListHistoryReq) (*sessionpb.ListHistoryResp, error) {
+	if req == nil {
+		return nil, errors.ErrArgs.WrapMsg("nil request")
+	}
+	convID := ResolveConversationID(userID, req)
+	if convID == "" {
+		return nil, errors.ErrArgs.WrapMsg("conversation target is empty")
+	}
+
+	if req.GetChannelId() != "" {
+		// 服务器频道每次按频道权限校验，有会话记录也不能绕过
+		if _, err := CheckGuildChannelPerm(ctx, tenantID, userID, req.GetChannelId(), guildReadPerms); err != nil {
+			return nil, err
+		}
+	}
+
+	// 只能查自己有会话记录的历史
+	cm := msgModel.Conversation{}
+	conv, err := cm.GetUserConversation(ctx, tenantID, userID, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil && req.GetThreadId() != "" {
+		// 没订阅话题的人，只要能看父会话就能看话题
+		conv, err = threadReadableConversation(ctx, tenantID, userID, req.GetThreadId())
+		if err != nil {
+			return nil, err
+		}
+	} else if conv == nil && req.GetChannelId() != "" {
+		// 广播频道读扩散，订阅者没有会话记录
+		conv, err = channelReadableConversation(ctx, tenantID, userID, req.GetChannelId())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conv == nil {
+		return nil, errors.ErrNoPermission.WrapMsg("conversation not found", "conversation_id", convID)
+	}
+
+	retentionGroup, err := retentionGroupOf(ctx, tenantID, req.GetThreadId(), req.GetChannelId(), req.GetGroupId())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cutoff, err := retentionCutoffMS(ctx, tenantID, retentionGroup, now)
+	if err != nil {
+		return nil, err
+	}
+
+	page := req.GetPage()
+	size := int64(page.GetSize())
+	if size <= 0 {
+		size = historyDefaultPageSize
+	}
+	if size > historyMaxPageSize {
+		size = historyMaxPageSize
+	}
+	forward := page.GetForward()
+
+	q := &msgModel.HistoryQuery{
+		TenantID:        tenantID,
+		ConversationID:  convID,
+		MinSeq:          conv.MinSeq,
+		MinSendTMS:      cutoff,
+		Forward:         forward,
+		Limit:           size + 1, // 多取一条判断 has_more
+		ContentTypes:    req.GetContentTypes(),
+		IncludeDeleted:  req.GetIncludeDeleted(),
+		IncludeRecalled: req.GetIncludeRecalled(),
+		BeforeTMS:       req.GetBefore(),
+		AfterTMS:        req.GetAfter(),
+	}
+
+	switch {
+	case page.GetCursor() != "":
+		cur, err := parseHistoryCursor(page.GetCursor())
+		if err != nil {
+			return nil, errors.ErrArgs.WrapMsg(err.Error())
+		}
+		q.ByTime = cur.ByTime
+		q.CursorSeq = cur.Seq
+		q.CursorTMS = cur.TMS
+		q.CursorSeqT = cur.Seq
+
+	case req.GetAnchorClientMsgId() != "":
+		anchor, err := msgModel.GetMessageByClientMsgID(ctx, tenantID, convID, req.GetAnchorClientMsgId())
+		if err != nil {
+			return nil, err
+		}
+		if anchor == nil {
+			return nil, errors.ErrRecordNotFound.WrapMsg("anchor not found", "client_msg_id", req.GetAnchorClientMsgId())
+		}
+		q.CursorSeq = anchor.Seq
+
+	case req.GetBefore() > 0 || req.GetAfter() > 0:
+		q.ByTime = true
+	}
+
+	// 时间模式下不需要 before/after 之外的 seq 游标；seq 模式下忽略 before/after
+	if !q.ByTime {
+		q.BeforeTMS, q.AfterTMS = 0, 0
+	}
+
+	list, err := msgModel.ListHistoryMessages(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	list, hasMore, next := trimHistoryPage(list, size, forward, q.ByTime)
+	items := make([]*pb.MessageData, 0, len(list))
+	for _, m := range list {
+		items = append(items, BuildPBFromMessageModel(m))
+	}
+	return &sessionpb.ListHistoryResp{
+		Items: items,
+		Page:  &pb.PageResp{HasMore: hasMore, NextCursor: next},
+	}, nil
+}
+
+// trimHistoryPage 去掉为判断 has_more 多取的那一条（list 按 seq 升序），算出下一页游标
+func trimHistoryPage(list []*msgModel.MessageModel, size int64, forward, byTime bool) ([]*msgModel.MessageModel, bool, string) {
+	hasMore := int64(len(list)) > size
+	if !hasMore {
+		return list, false, ""
+	}
+	// 多取的那一条在翻页方向的最远端
+	if forward {
+		list = list[:size]
+	} else {
+		list = list[int64(len(list))-size:]
+	}
+	if len(list) == 0 {
+		return list, true, ""
+	}
+	edge := list[0] // 向旧翻：最旧的一条
+	if forward {
+		edge = list[len(list)-1] // 向新翻：最新的一条
+	}
+	return list, true, historyCursor{ByTime: byTime, TMS: edge.SendTimeMS, Seq: edge.Seq}.String()
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	manageModel "PProject/module/manage/model"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHistoryCursorRoundTrip(t *testing.T) {
+	for _, c := range []historyCursor{
+		{Seq: 42},
+		{ByTime: true, TMS: 1_700_000_000_123, Seq: 7},
+	} {
+		got, err := parseHistoryCursor(c.String())
+		if err != nil || *got != c {
+			t.Fatalf("parse(%q) = %+v, %v", c.String(), got, err)
+		}
+	}
+
+	for _, bad := range []string{"", "42", "s:", "s:x", "t:1", "t:x:1", "t:1:x", "x:1", "s:1:2"} {
+		if _, err := parseHistoryCursor(bad); err == nil {
+			t.Errorf("parse(%q) accepted", bad)
+		}
+	}
+}
+
+func historyList(seqs ...int64) []*msgModel.MessageModel {
+	list := make([]*msgModel.MessageModel, 0, len(seqs))
+	for _, s := range seqs {
+		list = append(list, &msgModel.MessageModel{Seq: s, SendTimeMS: 1000 + s})
+	}
+	return list
+}
+
+func seqsOf(list []*msgModel.MessageModel) []int64 {
+	out := make([]int64, 0, len(list))
+	for _, m := range list {
+		out = append(out, m.Seq)
+	}
+	return out
+}
+
+func TestTrimHistoryPage(t *testing.T) {
+	// 向旧翻：多取的是最旧的一条，游标指向本页最旧的一条
+	list, more, next := trimHistoryPage(historyList(4, 5, 6, 7), 3, false, false)
+	if got := seqsOf(list); !more || next != "s:5" || len(got) != 3 || got[0] != 5 || got[2] != 7 {
+		t.Fatalf("backward page = %v more=%v next=%q", got, more, next)
+	}
+
+	// 向新翻：多取的是最新的一条，游标指向本页最新的一条；时间模式带上发送时间
+	list, more, next = trimHistoryPage(historyList(4, 5, 6, 7), 3, true, true)
+	if got := seqsOf(list); !more || next != "t:1006:6" || len(got) != 3 || got[0] != 4 || got[2] != 6 {
+		t.Fatalf("forward page = %v more=%v next=%q", got, more, next)
+	}
+
+	// 不足一页：没有下一页
+	list, more, next = trimHistoryPage(historyList(4, 5), 3, false, false)
+	if len(list) != 2 || more || next != "" {
+		t.Fatalf("last page = %v more=%v next=%q", seqsOf(list), more, next)
+	}
+
+	// 游标带回去能接着翻到下一页的起点
+	cur, err := parseHistoryCursor("t:1006:6")
+	if err != nil || !cur.ByTime || cur.TMS != 1006 || cur.Seq != 6 {
+		t.Fatalf("cursor = %+v, %v", cur, err)
+	}
+}
+
+func TestRetentionCutoff(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	day := int64(24 * time.Hour / time.Millisecond)
+
+	if got := retentionCutoff(now); got != 0 {
+		t.Fatalf("no retention = %d", got)
+	}
+	if got := retentionCutoff(now, 0, 0); got != 0 {
+		t.Fatalf("unlimited = %d", got)
+	}
+	// 群和租户都配置时取更严格（更短）的
+	if got := retentionCutoff(now, 30, 7); got != now.UnixMilli()-7*day {
+		t.Fatalf("group stricter = %d", got)
+	}
+	if got := retentionCutoff(now, 3, 7); got != now.UnixMilli()-3*day {
+		t.Fatalf("tenant stricter = %d", got)
+	}
+	if got := retentionCutoff(now, 0, 7); got != now.UnixMilli()-7*day {
+		t.Fatalf("group only = %d", got)
+	}
+
+	// 租户配置走进程内缓存
+	tenantCache.Store("t-retention", tenantCacheEntry{
+		tenant:  &manageModel.Tenant{TenantID: "t-retention", RetentionDays: 30},
+		expires: time.Now().Add(time.Minute),
+	})
+	t.Cleanup(func() { tenantCache.Delete("t-retention") })
+	got, err := retentionCutoffMS(context.Background(), "t-retention", "", now)
+	if err != nil || got != now.UnixMilli()-30*day {
+		t.Fatalf("tenant cutoff = %d, %v", got, err)
+	}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	errors "PProject/tools/errs"
+	"context"
+	"time"
+)
+
+// MentionItem 未读 @ 列表项（带被 @ 消息的简要快照，便于客户端“跳转到 @ 我的消息”）
+type MentionItem struct {
+	ConversationID string `json:"conversation_id"`
+	Seq            int64  `json:"seq"`
+	Kind           string `json:"kind"`
+	CreatedAt      int64  `json:"created_at"`
+	ServerMsgID    string `json:"server_msg_id,omitempty"`
+	SendID         string `json:"send_id,omitempty"`
+	ContentText    string `json:"content_text,omitempty"`
+}
+
+// hasAtAll 消息里是否 @全体
+func hasAtAll(atUsers []string) bool {
+	for _, u := range atUsers {
+		if u == msgModel.AtAllTag {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAtAllPolicy 发送侧校验 @全体：群关闭 AllowAtAll 时只有群主/管理员可以 @全体
+func CheckAtAllPolicy(ctx context.Context, tenantID string, md *pb.MessageData) error {
+	if md == nil || md.GetGroupId() == "" || !hasAtAll(md.GetAtTextElem().GetAtUserList()) {
+		return nil
+	}
+
+	gm := msgModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, md.GetGroupId())
+	if err != nil {
+		return err
+	}
+	if group == nil || group.AllowAtAll {
+		return nil
+	}
+
+	mm := msgModel.GroupMember{}
+	member, err := mm.GetGroupMember(ctx, tenantID, md.GetGroupId(), md.GetSendId())
+	if err != nil {
+		return err
+	}
+	if member != nil && member.IsManager() {
+		return nil
+	}
+	return errors.ErrAtAllForbidden.WrapMsg("at all is not allowed", "group_id", md.GetGroupId())
+}
+
+// IndexMentions 消息落库后写 @ 索引：@某人、@全体、回复/引用；并给被 @ 的人 @未读 +1
+// 同一条消息对同一个人只记一次，优先级 mention > reply > all
+func IndexMentions(ctx context.Context, tenantID string, m *msgModel.MessageModel) error {
+	if m == nil || m.IsEphemeral == 1 {
+		return nil
+	}
+
+	conv := msgModel.Conversation{}
+
+	// @全体：会话内除发送者以外的所有人
+	var allOwners []string
+	if m.AtTextElem != nil && hasAtAll(m.AtTextElem.AtUserList) {
+		owners, err := conv.ListConversationOwners(ctx, tenantID, m.ConversationID)
+		if err != nil {
+			return err
+		}
+		allOwners = owners
+	}
+
+	// 回复：被回复消息的发送者
+	replySender := ""
+	if m.ReplyTo != "" {
+		origin, err := msgModel.GetMessageByServerMsgID(ctx, m.ReplyTo)
+		if err != nil {
+			return err
+		}
+		if origin != nil {
+			replySender = origin.SendID
+		}
+	}
+
+	targets := mentionTargets(m, allOwners, replySender)
+	if len(targets) == 0 {
+		return nil
+	}
+	// 只给会话里的人写 @：@了会话外的人、回复/引用了已经退出的人都不记
+	if err := keepConversationOwners(ctx, tenantID, m.ConversationID, targets); err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixMilli()
+	list := make([]*msgModel.MentionIndex, 0, len(targets))
+	for u, kind := range targets {
+		list = append(list, &msgModel.MentionIndex{
+			TenantID:       tenantID,
+			ConversationID: m.ConversationID,
+			TargetUserID:   u,
+			Seq:            m.Seq,
+			Kind:           kind,
+			CreatedAt:      now,
+		})
+	}
+
+	// 重复调用（扇出续跑）时已经写过的不再 +1
+	owners, err := msgModel.InsertMentions(ctx, list)
+	if err != nil {
+		return err
+	}
+	if len(owners) == 0 {
+		return nil
+	}
+	if err := conv.IncMentionUnread(ctx, tenantID, m.ConversationID, owners); err != nil {
+		return err
+	}
+	return TouchConversations(ctx, tenantID, m.ConversationID, owners)
+}
+
+// mentionTargets 被 @ 的人 -> 类型；发送者自己不记，同一个人按 mention > reply > all 只保留一种
+func mentionTargets(m *msgModel.MessageModel, allOwners []string, replySender string) map[string]string {
+	targets := map[string]string{}
+	add := func(userID, kind string) {
+		if userID == "" || userID == m.SendID {
+			return
+		}
+		if old, ok := targets[userID]; ok {
+			if old == msgModel.MentionKindMention || kind == msgModel.MentionKindAll {
+				return
+			}
+		}
+		targets[userID] = kind
+	}
+
+	for _, u := range allOwners {
+		add(u, msgModel.MentionKindAll)
+	}
+
+	// 回复/引用：被回复、被引用消息的发送者
+	add(replySender, msgModel.MentionKindReply)
+	if m.QuoteElem != nil && m.QuoteElem.QuoteMessage != nil {
+		add(m.QuoteElem.QuoteMessage.SendID, msgModel.MentionKindReply)
+	}
+	if m.AtTextElem != nil && m.AtTextElem.QuoteMessage != nil {
+		add(m.AtTextElem.QuoteMessage.SendID, msgModel.MentionKindReply)
+	}
+
+	// @某人
+	if m.AtTextElem != nil {
+		for _, u := range m.AtTextElem.AtUserList {
+			if u != msgModel.AtAllTag {
+				add(u, msgModel.MentionKindMention)
+			}
+		}
+	}
+	return targets
+}
+
+// keepConversationOwners 去掉 targets 里在该会话下没有会话记录的用户（@全体 的目标本来就取自会话记录，不再查）
+func keepConversationOwners(ctx context.Context, tenantID, conversationID string, targets map[string]string) error {
+	users := make([]string, 0, len(targets))
+	for u, kind := range targets {
+		if kind != msgModel.MentionKindAll {
+			users = append(users, u)
+		}
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	cm := msgModel.Conversation{}
+	convs, err := cm.ListConversationsByOwners(ctx, tenantID, conversationID, users)
+	if err != nil {
+		return err
+	}
+	dropNonOwners(targets, convs)
+	return nil
+}
+
+// dropNonOwners 去掉 targets 里不在 convs（会话记录）中的用户，@全体 的目标不动
+func dropNonOwners(targets map[string]string, convs []*msgModel.Conversation) {
+	owners := make(map[string]struct{}, len(convs))
+	for _, c := range convs {
+		owners[c.OwnerUserID] = struct{}{}
+	}
+	for u, kind := range targets {
+		if _, ok := owners[u]; !ok && kind != msgModel.MentionKindAll {
+			delete(targets, u)
+		}
+	}
+}
+
+// ListUnreadMentions 某个用户的未读 @ 列表（跨会话），已读游标之前的不返回
+func ListUnreadMentions(ctx context.Context, tenantID, userID, conversationID string, limit int64) ([]*MentionItem, error) {
+	if limit <= 0 || limit > historyMaxPageSize {
+		limit = historyMaxPageSize
+	}
+	list, err := msgModel.ListUnreadMentions(ctx, tenantID, userID, conversationID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按会话聚合，批量取消息快照，同时用会话已读游标兜底过滤
+	byConv := map[string][]int64{}
+	for _, mi := range list {
+		byConv[mi.ConversationID] = append(byConv[mi.ConversationID], mi.Seq)
+	}
+	readSeq := map[string]int64{}
+	snapshots := map[string]map[int64]*msgModel.MessageModel{}
+	cm := msgModel.Conversation{}
+	for convID, seqs := range byConv {
+		conv, err := cm.GetUserConversation(ctx, tenantID, userID, convID)
+		if err != nil {
+			return nil, err
+		}
+		if conv == nil {
+			// 不在会话里（退群/从未加入）的 @ 不返回消息快照
+			continue
+		}
+		readSeq[convID] = conv.ReadSeq
+		msgs, err := msgModel.GetMessagesBySeqs(ctx, tenantID, convID, seqs)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[convID] = make(map[int64]*msgModel.MessageModel, len(msgs))
+		for _, m := range msgs {
+			snapshots[convID][m.Seq] = m
+		}
+	}
+
+	return unreadMentionItems(list, readSeq, snapshots), nil
+}
+
+// unreadMentionItems 按会话已读游标过滤并带上消息快照；readSeq 里没有的会话（不在会话里）整个不返回
+func unreadMentionItems(list []*msgModel.MentionIndex, readSeq map[string]int64, snapshots map[string]map[int64]*msgModel.MessageModel) []*MentionItem {
+	items := make([]*MentionItem, 0, len(list))
+	for _, mi := range list {
+		rs, ok := readSeq[mi.ConversationID]
+		if !ok || mi.Seq <= rs {
+			continue
+		}
+		item := &MentionItem{
+			ConversationID: mi.ConversationID,
+			Seq:            mi.Seq,
+			Kind:           mi.Kind,
+			CreatedAt:      mi.CreatedAt,
+		}
+		if m := snapshots[mi.ConversationID][mi.Seq]; m != nil {
+			// 撤回/删除的消息不再提示
+			if m.Status == msgModel.MsgStatusRevoked || m.Status == msgModel.MsgStatusDeleted {
+				continue
+			}
+			item.ServerMsgID = m.ServerMsgID
+			item.SendID = m.SendID
+			item.ContentText = m.ContentText
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// MarkRead 推进已读游标并清理已读范围内的 @；readSeq<=0 表示读到会话最新，超过最新 seq 的按最新算
+func MarkRead(ctx context.Context, tenantID, userID, conversationID string, readSeq int64) error {
+	if err := ensureGuildReadState(ctx, tenantID, userID, conversationID); err != nil {
+		return err
+	}
+	cm := msgModel.Conversation{}
+	conv, err := cm.GetUserConversation(ctx, tenantID, userID, conversationID)
+	if err != nil {
+		return err
+	}
+	if conv == nil {
+		return errors.ErrRecordNotFound.WrapMsg("conversation not found", "conversation_id", conversationID)
+	}
+	// 已读不能超过会话当前最大 seq：客户端传得再大，也不能提前已读（并触发阅后即焚）还没到的消息
+	maxSeq := conv.ServerMaxSeq
+	sm := msgModel.SeqConversation{}
+	sc, err := sm.GetSeqConversation(ctx, tenantID, conversationID)
+	if err != nil {
+		return err
+	}
+	if sc != nil && sc.MaxSeq > maxSeq {
+		maxSeq = sc.MaxSeq
+	}
+	if readSeq <= 0 || readSeq > maxSeq {
+		readSeq = maxSeq
+	}
+	if readSeq < conv.ReadSeq {
+		readSeq = conv.ReadSeq
+	}
+
+	// 已读回执：阅后即焚消息从这里开始倒计时，失败不影响已读上报
+	if err := StartBurnCountdown(ctx, tenantID, userID, conversationID, conv.ReadSeq, readSeq); err != nil {
+		logger.Errorf("conv:%v user:%v StartBurnCountdown error: %s", conversationID, userID, err)
+	}
+
+	remaining, err := msgModel.ClearMentionsUpTo(ctx, tenantID, conversationID, userID, readSeq)
+	if err != nil {
+		return err
+	}
+	if err := cm.UpdateReadSeq(ctx, tenantID, userID, conversationID, readSeq, remaining); err != nil {
+		return err
+	}
+	return TouchConversations(ctx, tenantID, conversationID, []string{userID})
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	msgModel "PProject/module/chat/model"
+	"maps"
+	"testing"
+)
+
+func TestMentionTargets(t *testing.T) {
+	m := &msgModel.MessageModel{
+		SendID: "sender",
+		AtTextElem: &msgModel.AtTextElem{
+			AtUserList:   []string{msgModel.AtAllTag, "u1", "sender"},
+			QuoteMessage: &msgModel.MessageLite{SendID: "u3"},
+		},
+		QuoteElem: &msgModel.QuoteElem{QuoteMessage: &msgModel.MessageLite{SendID: "u4"}},
+	}
+	got := mentionTargets(m, []string{"sender", "u1", "u2", "u3", "u5"}, "u2")
+	want := map[string]string{
+		"u1": msgModel.MentionKindMention, // @某人 优先于 @全体
+		"u2": msgModel.MentionKindReply,   // 回复优先于 @全体
+		"u3": msgModel.MentionKindReply,   // AtTextElem 里的引用
+		"u4": msgModel.MentionKindReply,   // 不在 @全体 名单里的被引用者也记
+		"u5": msgModel.MentionKindAll,
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("targets = %v want %v", got, want)
+	}
+
+	// 回复自己、@自己都不记
+	self := &msgModel.MessageModel{SendID: "s", AtTextElem: &msgModel.AtTextElem{AtUserList: []string{"s"}}}
+	if got := mentionTargets(self, nil, "s"); len(got) != 0 {
+		t.Fatalf("self targets = %v", got)
+	}
+
+	// 回复之后又 @ 同一个人：记成 mention
+	both := &msgModel.MessageModel{SendID: "s", AtTextElem: &msgModel.AtTextElem{AtUserList: []string{"u1"}}}
+	if got := mentionTargets(both, nil, "u1"); got["u1"] != msgModel.MentionKindMention {
+		t.Fatalf("reply+mention = %v", got)
+	}
+}
+
+func TestDropNonOwners(t *testing.T) {
+	targets := map[string]string{
+		"member":   msgModel.MentionKindMention,
+		"stranger": msgModel.MentionKindMention,
+		"left":     msgModel.MentionKindReply,
+		"all":      msgModel.MentionKindAll, // 本来就取自会话记录
+	}
+	dropNonOwners(targets, []*msgModel.Conversation{{OwnerUserID: "member"}})
+	want := map[string]string{"member": msgModel.MentionKindMention, "all": msgModel.MentionKindAll}
+	if !maps.Equal(targets, want) {
+		t.Fatalf("targets = %v want %v", targets, want)
+	}
+}
+
+func TestUnreadMentionItems(t *testing.T) {
+	list := []*msgModel.MentionIndex{
+		{ConversationID: "grp:a", Seq: 9, Kind: msgModel.MentionKindMention},
+		{ConversationID: "grp:a", Seq: 5, Kind: msgModel.MentionKindAll},      // 已读
+		{ConversationID: "grp:a", Seq: 8, Kind: msgModel.MentionKindReply},    // 撤回了
+		{ConversationID: "grp:gone", Seq: 3, Kind: msgModel.MentionKindReply}, // 没有会话记录
+		{ConversationID: "grp:b", Seq: 2, Kind: msgModel.MentionKindMention},  // 消息快照没查到
+	}
+	readSeq := map[string]int64{"grp:a": 5, "grp:b": 0}
+	snapshots := map[string]map[int64]*msgModel.MessageModel{
+		"grp:a": {
+			9: {ServerMsgID: "m9", SendID: "u1", ContentText: "hi @you"},
+			8: {ServerMsgID: "m8", Status: msgModel.MsgStatusRevoked, ContentText: "secret"},
+		},
+	}
+
+	items := unreadMentionItems(list, readSeq, snapshots)
+	if len(items) != 2 {
+		t.Fatalf("items = %+v", items)
+	}
+	if it := items[0]; it.ConversationID != "grp:a" || it.Seq != 9 || it.ServerMsgID != "m9" || it.ContentText != "hi @you" {
+		t.Fatalf("first = %+v", it)
+	}
+	// 没有快照时只返回位置，不带内容
+	if it := items[1]; it.ConversationID != "grp:b" || it.ServerMsgID != "" || it.ContentText != "" {
+		t.Fatalf("second = %+v", it)
+	}
+}
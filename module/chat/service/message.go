@@ -6,9 +6,13 @@ import (
 	util "PProject/tools"
 	errors "PProject/tools/errs"
 	ids "PProject/tools/ids"
+	"encoding/json"
 	"time"
 
+	"google.golang.org/protobuf/encoding/protojson"
+
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // 入口：把 pb.MessageData 转成可落库的 MessageModel
@@ -61,8 +65,16 @@ func BuildMessageModelFromPB(
 		Tags:         md.GetTags(),
 		ReplyTo:      md.GetReplyTo(),
 		IsEphemeral:  util.Bool2i(md.GetIsEphemeral()),
-		// Rich / Automod 如需强类型映射，按你的定义处理；这里示例略过
+		BurnDuration: md.GetAttachedInfoElem().GetBurnDuration(),
+		// Automod 如需强类型映射，按你的定义处理；这里示例略过
+	}
+
+	// Rich（嵌入/组件）按 protojson 存成文档：机器人交互要按 custom_id 找回原消息的组件
+	rich, err := RichToMap(md.GetRich())
+	if err != nil {
+		return nil, err
 	}
+	m.Rich = rich
 
 	// OfflinePush 映射（可选）
 	if md.OfflinePush != nil {
@@ -347,37 +359,21 @@ func copyAtInfos(src []*pb.AtInfo) []*msgModel.AtInfo {
 func BuildSyncFrameConversations(userID string,
 	convList []*msgModel.Conversation,
 ) (*pb.MessageFrameData, error) {
-	now := time.Now().UnixMilli()
-
 	// 转换 Conversation -> pb.Conversation
 	items := make([]*pb.Conversation, 0, len(convList))
 	for _, c := range convList {
 		if c == nil {
 			continue
 		}
-		items = append(items, &pb.Conversation{
-			TenantId:         c.TenantID,
-			OwnerUserId:      c.OwnerUserID,
-			ConversationId:   c.ConversationID,
-			ConversationType: c.ConversationType,
-			UserId:           c.UserID,
-			GroupId:          c.GroupID,
-
-			ReadSeq:       c.ReadSeq,
-			ReadOutboxSeq: c.ReadOutboxSeq,
-			LocalMaxSeq:   c.LocalMaxSeq,
-			MinSeq:        c.MinSeq,
-			ServerMaxSeq:  c.ServerMaxSeq,
-
-			MentionUnread:    c.MentionUnread,
-			MentionReadSeq:   c.MentionReadSeq,
-			PerDeviceReadSeq: c.PerDeviceReadSeq,
-
-			UpdatedAt: c.UpdatedAt.UnixMilli(),
-		})
+		items = append(items, BuildConversationPB(c, nil))
 	}
+	return BuildSyncFrame(userID, &pb.SyncConversations{Conversations: items})
+}
+
+// BuildSyncFrame 会话同步帧（any_payload = SyncConversations）
+func BuildSyncFrame(userID string, payload *pb.SyncConversations) (*pb.MessageFrameData, error) {
+	now := time.Now().UnixMilli()
 
-	payload := &pb.SyncConversations{Conversations: items}
 	anyPayload, err := anypb.New(payload)
 	if err != nil {
 		return nil, err
@@ -400,3 +396,295 @@ func BuildSyncFrameConversations(userID string,
 
 	return frame, nil
 }
+
+// BuildPBFromMessageModel 把落库的 MessageModel 还原成 pb.MessageData（历史/检索等下发用）
+func BuildPBFromMessageModel(m *msgModel.MessageModel) *pb.MessageData {
+	if m == nil {
+		return nil
+	}
+
+	ex := ""
+	if m.Thread != nil {
+		// 话题摘要没有对应的 pb 字段，随 ex 下发（ex.thread）
+		merged := make(map[string]interface{}, len(m.Ex)+1)
+		for k, v := range m.Ex {
+			merged[k] = v
+		}
+		merged["thread"] = m.Thread
+		ex, _ = util.AnyToJSONString(merged)
+	} else if len(m.Ex) > 0 {
+		ex, _ = util.AnyToJSONString(m.Ex)
+	}
+
+	md := &pb.MessageData{
+		ClientMsgId:      m.ClientMsgID,
+		ServerMsgId:      m.ServerMsgID,
+		CreateTime:       m.CreateTimeMS,
+		SendTime:         m.SendTimeMS,
+		SessionType:      int32(m.SessionType),
+		SendId:           m.SendID,
+		RecvId:           m.RecvID,
+		MsgFrom:          int32(m.MsgFrom),
+		ContentType:      int32(m.ContentType),
+		SenderPlatformId: int32(m.SenderPlatformID),
+		SenderNickname:   m.SenderNickname,
+		SenderFaceUrl:    m.SenderFaceURL,
+		GroupId:          m.GroupID,
+		Seq:              m.Seq,
+		IsRead:           m.IsRead == 1,
+		Status:           int32(m.Status),
+
+		AttachedInfo: m.AttachedInfo,
+		Ex:           ex,
+		LocalEx:      m.LocalEx,
+
+		IsEdited:    m.IsEdited == 1,
+		EditedAt:    m.EditedAtMS,
+		EditVersion: m.EditVersion,
+		ExpireAt:    m.ExpireAtMS,
+		AccessLevel: m.AccessLevel,
+		TraceId:     m.TraceID,
+		SessionId:   m.SessionTrace,
+		Tags:        m.Tags,
+
+		GuildId:     m.GuildID,
+		ChannelId:   m.ChannelID,
+		ThreadId:    m.ThreadID,
+		ReplyTo:     m.ReplyTo,
+		IsEphemeral: m.IsEphemeral == 1,
+	}
+
+	if m.OfflinePush != nil {
+		md.OfflinePush = &pb.OfflinePushInfo{
+			Title:                     m.OfflinePush.Title,
+			Desc:                      m.OfflinePush.Desc,
+			Ex:                        m.OfflinePush.Ex,
+			IosBadgeCountPlus1:        m.OfflinePush.IOSBadgeCountPlus1,
+			IosCategory:               m.OfflinePush.IOSCategory,
+			IosSound:                  m.OfflinePush.IosSound,
+			AndroidVivoClassification: m.OfflinePush.AndroidVivoClassification,
+		}
+	}
+
+	if m.BurnDuration > 0 {
+		md.AttachedInfoElem = &pb.AttachedInfoElem{IsPrivateChat: true, BurnDuration: m.BurnDuration}
+	}
+
+	// 墓碑消息只下发占位，不下发内容
+	if m.Status == msgModel.MsgStatusDeleted {
+		return md
+	}
+
+	md.Rich = RichFromMap(m.Rich)
+	if m.TextElem != nil {
+		md.TextElem = &pb.TextElem{Content: m.TextElem.Content}
+	}
+	if m.AdvancedTextElem != nil {
+		md.AdvancedTextElem = &pb.AdvancedTextElem{
+			Text:              m.AdvancedTextElem.Text,
+			MessageEntityList: toPBEntities(m.AdvancedTextElem.MessageEntityList),
+		}
+	}
+	if m.MarkdownTextElem != nil {
+		md.MarkdownTextElem = &pb.MarkdownTextElem{Content: m.MarkdownTextElem.Content}
+	}
+	if m.PictureElem != nil {
+		md.PictureElem = &pb.PictureElem{
+			SourcePicture:   toPBPic(m.PictureElem.SourcePicture),
+			BigPicture:      toPBPic(m.PictureElem.BigPicture),
+			SnapshotPicture: toPBPic(m.PictureElem.SnapshotPicture),
+		}
+	}
+	if m.SoundElem != nil {
+		md.SoundElem = &pb.SoundElem{
+			Uuid:      m.SoundElem.UUID,
+			SoundPath: m.SoundElem.SoundPath,
+			SourceUrl: m.SoundElem.SourceURL,
+			DataSize:  m.SoundElem.DataSize,
+			Duration:  m.SoundElem.Duration,
+			SoundType: m.SoundElem.SoundType,
+		}
+	}
+	if m.VideoElem != nil {
+		md.VideoElem = &pb.VideoElem{
+			VideoPath:      m.VideoElem.VideoPath,
+			VideoUuid:      m.VideoElem.VideoUUID,
+			VideoUrl:       m.VideoElem.VideoURL,
+			VideoType:      m.VideoElem.VideoType,
+			VideoSize:      m.VideoElem.VideoSize,
+			Duration:       m.VideoElem.Duration,
+			SnapshotPath:   m.VideoElem.SnapshotPath,
+			SnapshotUuid:   m.VideoElem.SnapshotUUID,
+			SnapshotSize:   m.VideoElem.SnapshotSize,
+			SnapshotUrl:    m.VideoElem.SnapshotURL,
+			SnapshotWidth:  m.VideoElem.SnapshotWidth,
+			SnapshotHeight: m.VideoElem.SnapshotHeight,
+			SnapshotType:   m.VideoElem.SnapshotType,
+		}
+	}
+	if m.FileElem != nil {
+		md.FileElem = &pb.FileElem{
+			Uuid:      m.FileElem.UUID,
+			SourceUrl: m.FileElem.SourceURL,
+			FileName:  m.FileElem.FileName,
+			FileSize:  m.FileElem.FileSize,
+			FileType:  m.FileElem.FileType,
+		}
+	}
+	if m.LocationElem != nil {
+		md.LocationElem = &pb.LocationElem{
+			Description: m.LocationElem.Description,
+			Longitude:   m.LocationElem.Longitude,
+			Latitude:    m.LocationElem.Latitude,
+		}
+	}
+	if m.CardElem != nil {
+		md.CardElem = &pb.CardElem{
+			UserId:   m.CardElem.UserID,
+			Nickname: m.CardElem.Nickname,
+			FaceUrl:  m.CardElem.FaceURL,
+			Ex:       m.CardElem.Ex,
+		}
+	}
+	if m.AtTextElem != nil {
+		md.AtTextElem = &pb.AtTextElem{
+			Text:         m.AtTextElem.Text,
+			AtUserList:   m.AtTextElem.AtUserList,
+			AtUsersInfo:  toPBAtInfos(m.AtTextElem.AtUsersInfo),
+			QuoteMessage: toPBLite(m.AtTextElem.QuoteMessage),
+			IsAtSelf:     m.AtTextElem.IsAtSelf,
+		}
+	}
+	if m.FaceElem != nil {
+		data, _ := structpb.NewStruct(m.FaceElem.Data)
+		md.FaceElem = &pb.FaceElem{Index: m.FaceElem.Index, Data: data}
+	}
+	if m.MergeElem != nil {
+		multi := make([]*pb.MessageData, 0, len(m.MergeElem.MultiMessage))
+		for _, x := range m.MergeElem.MultiMessage {
+			multi = append(multi, toPBLite(x))
+		}
+		md.MergeElem = &pb.MergeElem{
+			Title:             m.MergeElem.Title,
+			AbstractList:      m.MergeElem.AbstractList,
+			MultiMessage:      multi,
+			MessageEntityList: toPBEntities(m.MergeElem.MessageEntityList),
+		}
+	}
+	if m.QuoteElem != nil {
+		md.QuoteElem = &pb.QuoteElem{
+			Text:         m.QuoteElem.Text,
+			QuoteMessage: toPBLite(m.QuoteElem.QuoteMessage),
+		}
+	}
+	if m.CustomElem != nil {
+		data, _ := structpb.NewStruct(m.CustomElem.Data)
+		md.CustomElem = &pb.CustomElem{
+			Data:        data,
+			Description: m.CustomElem.Description,
+			Extension:   m.CustomElem.Extension,
+		}
+	}
+	if m.NotificationElem != nil {
+		md.NotificationElem = &pb.NotificationElem{Detail: m.NotificationElem.Detail}
+	}
+
+	return md
+}
+
+func toPBPic(p *msgModel.PictureBaseInfo) *pb.PictureBaseInfo {
+	if p == nil {
+		return nil
+	}
+	return &pb.PictureBaseInfo{
+		Uuid: p.UUID, Type: p.Type, Size: p.Size,
+		Width: p.Width, Height: p.Height, Url: p.URL,
+	}
+}
+
+func toPBEntities(src []*msgModel.MessageEntity) []*pb.MessageEntity {
+	if len(src) == 0 {
+		return nil
+	}
+	out := make([]*pb.MessageEntity, 0, len(src))
+	for _, e := range src {
+		if e == nil {
+			continue
+		}
+		out = append(out, &pb.MessageEntity{
+			Type: e.Type, Offset: e.Offset, Length: e.Length,
+			Url: e.URL, Ex: e.Ex,
+		})
+	}
+	return out
+}
+
+func toPBLite(m *msgModel.MessageLite) *pb.MessageData {
+	if m == nil {
+		return nil
+	}
+	ret := &pb.MessageData{
+		ServerMsgId: m.ServerMsgID,
+		ContentType: int32(m.ContentType),
+		SendTime:    m.SendTimeMS,
+		SendId:      m.SendID,
+		RecvId:      m.RecvID,
+		SessionType: int32(m.SessionType),
+	}
+	if m.TextElem != nil {
+		ret.TextElem = &pb.TextElem{Content: m.TextElem.Content}
+	}
+	return ret
+}
+
+func toPBAtInfos(src []*msgModel.AtInfo) []*pb.AtInfo {
+	if len(src) == 0 {
+		return nil
+	}
+	out := make([]*pb.AtInfo, 0, len(src))
+	for _, a := range src {
+		if a == nil {
+			continue
+		}
+		out = append(out, &pb.AtInfo{
+			AtUserId:      a.AtUserID,
+			GroupNickname: a.GroupNickname,
+		})
+	}
+	return out
+}
+
+// RichToMap 富消息转成可落库的文档（protojson 字段名）
+func RichToMap(rich *pb.RichMessage) (map[string]interface{}, error) {
+	if rich == nil {
+		return nil, nil
+	}
+	data, err := protojson.Marshal(rich)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// RichFromMap 落库的富消息文档还原成 pb；解析失败按没有富内容处理
+func RichFromMap(doc map[string]interface{}) *pb.RichMessage {
+	if len(doc) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	rich := &pb.RichMessage{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, rich); err != nil {
+		return nil
+	}
+	return rich
+}
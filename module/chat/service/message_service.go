@@ -0,0 +1,64 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	sessionpb "PProject/gen/session"
+	"PProject/global"
+	"PProject/global/config"
+	msgModel "PProject/module/chat/model"
+	errors "PProject/tools/errs"
+	"context"
+	"time"
+)
+
+// MessageServer MessageService 的 gRPC 实现；未实现的方法走 Unimplemented
+type MessageServer struct {
+	sessionpb.UnimplementedMessageServiceServer
+}
+
+func NewMessageServer() *MessageServer {
+	return &MessageServer{}
+}
+
+// ListHistory 历史消息分页
+func (s *MessageServer) ListHistory(ctx context.Context, req *sessionpb.ListHistoryReq) (*sessionpb.ListHistoryResp, error) {
+	authInfo, err := global.GetAuthInfoFromContext(ctx)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid.WrapMsg(err.Error())
+	}
+	return ListHistory(ctx, config.GetTenantID(), authInfo.UserId, req)
+}
+
+// MarkRead 标记已读到某条消息（不传则读到最新），同时清理已读范围内的 @
+func (s *MessageServer) MarkRead(ctx context.Context, req *sessionpb.MarkReadReq) (*pb.AckData, error) {
+	authInfo, err := global.GetAuthInfoFromContext(ctx)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid.WrapMsg(err.Error())
+	}
+	if req.GetConversationId() == "" {
+		return nil, errors.ErrArgs.WrapMsg("conversation_id is empty")
+	}
+
+	tenantID := config.GetTenantID()
+	readSeq := int64(0)
+	if req.GetUpToClientMsgId() != "" {
+		m, err := msgModel.GetMessageByClientMsgID(ctx, tenantID, req.GetConversationId(), req.GetUpToClientMsgId())
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, errors.ErrRecordNotFound.WrapMsg("message not found", "client_msg_id", req.GetUpToClientMsgId())
+		}
+		readSeq = m.Seq
+	}
+
+	if err := MarkRead(ctx, tenantID, authInfo.UserId, req.GetConversationId(), readSeq); err != nil {
+		return nil, err
+	}
+	return &pb.AckData{
+		Ok:            true,
+		Code:          "OK",
+		ServerTime:    time.Now().UnixMilli(),
+		CorrelationId: req.GetCorrelationId(),
+	}, nil
+}
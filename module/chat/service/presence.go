@@ -0,0 +1,144 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	msgModel "PProject/module/chat/model"
+	"PProject/module/chat/seq"
+	"PProject/service/bus"
+	"PProject/service/chat"
+	ka "PProject/service/dispatcher/kafka"
+	online "PProject/service/storage"
+	util "PProject/tools"
+	errors "PProject/tools/errs"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	typingThrottle        = 3 * time.Second // 同一用户同一会话的输入状态最多 3 秒推一次
+	typingMaxGroupMembers = 500             // 超过该人数的群不推输入状态
+)
+
+// UpdatePresence 用户主动设置状态（online/away/dnd/invisible + 文案）
+func UpdatePresence(ctx context.Context, userID string, up *pb.PresenceUpdate) (*online.Presence, error) {
+	return online.SetPresence(ctx, userID, up.GetStatus(), up.GetActivity())
+}
+
+// TypingParticipants 输入状态要通知的会话成员（不含自己）
+// channel_id 为会话 ID：单聊 p2p:<a>_<b>，群聊 grp:<group_id>；userID 必须是会话成员
+func TypingParticipants(ctx context.Context, tenantID, userID, channelID string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(channelID, "p2p:"):
+		pair := strings.TrimPrefix(channelID, "p2p:")
+		var peer string
+		if rest, ok := strings.CutPrefix(pair, userID+"_"); ok {
+			peer = rest
+		} else if rest, ok := strings.CutSuffix(pair, "_"+userID); ok {
+			peer = rest
+		}
+		if peer == "" || seq.BuildP2PConvID(userID, peer) != channelID {
+			return nil, errors.ErrNoPermission.WrapMsg("not a participant", "channel_id", channelID)
+		}
+		return []string{peer}, nil
+
+	case strings.HasPrefix(channelID, "grp:"):
+		groupID := strings.TrimPrefix(channelID, "grp:")
+		gm := msgModel.Group{}
+		group, err := gm.GetGroupByID(ctx, tenantID, groupID)
+		if err != nil {
+			return nil, err
+		}
+		if group == nil || group.Status != msgModel.GroupStatusNormal {
+			return nil, errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID)
+		}
+		mm := msgModel.GroupMember{}
+		member, err := mm.GetGroupMember(ctx, tenantID, groupID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil || member.Status != msgModel.GroupMemberStatusNormal {
+			return nil, errors.ErrNotGroupMember.WrapMsg("not group member", "group_id", groupID, "user_id", userID)
+		}
+		if group.MemberCount > typingMaxGroupMembers {
+			return nil, nil
+		}
+		ids, err := mm.ListGroupMemberIDs(ctx, tenantID, groupID, "", typingMaxGroupMembers)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if id != userID {
+				out = append(out, id)
+			}
+		}
+		return out, nil
+	}
+	return nil, errors.ErrArgs.WrapMsg("unsupported channel_id", "channel_id", channelID)
+}
+
+// RelayTyping 把"正在输入"推给会话里在线的其他成员
+// 只走实时通道：不落库、不进离线队列、不要求回执；节流期内的重复上报直接丢弃
+func RelayTyping(ctx context.Context, tenantID, userID string, t *pb.TypingStart) error {
+	channelID := t.GetChannelId()
+	if channelID == "" {
+		return errors.ErrArgs.WrapMsg("channel_id is empty")
+	}
+	recipients, err := TypingParticipants(ctx, tenantID, userID, channelID)
+	if err != nil {
+		return err
+	}
+
+	ok, err := online.AllowTyping(ctx, userID, channelID, typingThrottle)
+	if err != nil || !ok {
+		return err
+	}
+
+	ev := &pb.TypingStart{ChannelId: channelID, UserId: userID, StartedAt: t.GetStartedAt()}
+	if ev.StartedAt == 0 {
+		ev.StartedAt = time.Now().UnixMilli()
+	}
+	// 后端订阅方（PresenceService.SubscribePresence include_typing）也能收到
+	online.PublishPresence(ctx, &pb.PresenceUpdate{UserId: userID, Status: online.StatusTyping, Activity: channelID})
+
+	if len(recipients) == 0 {
+		return nil
+	}
+	return deliverPresence(ctx, tenantID, userID, channelID, recipients, ev)
+}
+
+// deliverPresence 按网关聚合在线接收者，每个网关发一帧 PRESENCE；离线的直接忽略
+func deliverPresence(ctx context.Context, tenantID, from, selector string, users []string, body proto.Message) error {
+	anyBody, err := anypb.New(body)
+	if err != nil {
+		return err
+	}
+	return publishToGateways(ctx, selector, users, func(gateway string, gwUsers []string) *pb.MessageFrameData {
+		return chat.BuildPresenceDeliver(gateway, tenantID, from, gwUsers, anyBody)
+	})
+}
+
+// publishToGateways 在线用户按所在网关分组，每个网关发一帧（帧里带本网关的接收者列表），不在线的忽略
+func publishToGateways(ctx context.Context, selector string, users []string, build func(gateway string, gwUsers []string) *pb.MessageFrameData) error {
+	byGateway, _, err := online.GetManager().GroupUsersByGateway(ctx, users)
+	if err != nil {
+		return err
+	}
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).ReceiveTopicKeys(false)
+	for gateway, gwUsers := range byGateway {
+		value, err := util.EncodeFrame(build(gateway, gwUsers))
+		if err != nil {
+			return err
+		}
+		topic := fmt.Sprintf("%v_%v", gateway, ka.SelectCAckTopicByUser(selector, keys))
+		if err := bus.Publish(ctx, &bus.Message{Topic: topic, Key: []byte(selector), Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
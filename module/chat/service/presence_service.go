@@ -0,0 +1,97 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	sessionpb "PProject/gen/session"
+	"PProject/global"
+	"PProject/global/config"
+	usermodel "PProject/module/user/model"
+	online "PProject/service/storage"
+	errors "PProject/tools/errs"
+	"context"
+	"time"
+)
+
+// PresenceServer PresenceService 的 gRPC 实现
+type PresenceServer struct {
+	sessionpb.UnimplementedPresenceServiceServer
+}
+
+func NewPresenceServer() *PresenceServer {
+	return &PresenceServer{}
+}
+
+// UpdatePresence 设置当前用户的状态（user_id 以 token 为准）
+func (s *PresenceServer) UpdatePresence(ctx context.Context, req *pb.PresenceUpdate) (*pb.AckData, error) {
+	authInfo, err := global.GetAuthInfoFromContext(ctx)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid.WrapMsg(err.Error())
+	}
+	if _, err := UpdatePresence(ctx, authInfo.UserId, req); err != nil {
+		return nil, err
+	}
+	return &pb.AckData{Ok: true, Code: "OK", ServerTime: time.Now().UnixMilli()}, nil
+}
+
+// Typing 当前用户在 channel_id（会话 ID）里正在输入
+func (s *PresenceServer) Typing(ctx context.Context, req *pb.TypingStart) (*pb.AckData, error) {
+	authInfo, err := global.GetAuthInfoFromContext(ctx)
+	if err != nil {
+		return nil, errors.ErrTokenInvalid.WrapMsg(err.Error())
+	}
+	if err := RelayTyping(ctx, config.GetTenantID(), authInfo.UserId, req); err != nil {
+		return nil, err
+	}
+	return &pb.AckData{Ok: true, Code: "OK", ServerTime: time.Now().UnixMilli()}, nil
+}
+
+// SubscribePresence 后端服务订阅状态变更（全量状态和输入，只对应用管理员凭证开放）；user_ids 为空表示全部用户
+// include_typing 时输入状态以 status=typing、activity=会话 ID 的形式推送，可用 channel_ids 过滤会话
+func (s *PresenceServer) SubscribePresence(req *sessionpb.PresenceSubscribeReq, stream sessionpb.PresenceService_SubscribePresenceServer) error {
+	authInfo, err := global.GetAuthInfoFromContext(stream.Context())
+	if err != nil {
+		return errors.ErrTokenInvalid.WrapMsg(err.Error())
+	}
+	if err := requireAppManager(stream.Context(), authInfo.UserId); err != nil {
+		return err
+	}
+	users := toSet(req.GetUserIds())
+	channels := toSet(req.GetChannelIds())
+
+	err = online.SubscribePresence(stream.Context(), func(up *pb.PresenceUpdate) error {
+		if len(users) > 0 && !users[up.GetUserId()] {
+			return nil
+		}
+		if up.GetStatus() == online.StatusTyping {
+			if !req.GetIncludeTyping() || (len(channels) > 0 && !channels[up.GetActivity()]) {
+				return nil
+			}
+		}
+		return stream.Send(up)
+	})
+	if stream.Context().Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// requireAppManager 应用管理员（User.AppMangerLevel >= 1）
+func requireAppManager(ctx context.Context, userID string) error {
+	um := usermodel.User{}
+	user, err := um.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.AppMangerLevel < 1 {
+		return errors.ErrNoPermission.WrapMsg("presence stream requires app manager")
+	}
+	return nil
+}
+
+func toSet(items []string) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, it := range items {
+		m[it] = true
+	}
+	return m
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/service/chat"
+	online "PProject/service/storage"
+	errors "PProject/tools/errs"
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	presenceCoalesce = 2 * time.Second // 上下线抖动合并窗口：窗口内状态回到原样不推
+	presenceWatchMax = 2000            // 单用户最多关注的人数（好友 + 显式订阅）
+	presenceRetry    = 3 * time.Second // Redis 订阅断开后的重连间隔
+)
+
+// MetaLastSeen PRESENCE 帧 meta：对方最后在线时间（ms），离线且隐私允许时才带
+const MetaLastSeen = "last_seen"
+
+// PresenceHub 网关内的在线状态订阅
+// 连接鉴权后关注该用户的好友（Status=1）和显式订阅的人；Redis 上任何一个被关注者的上下线/状态变更
+// 先记下，按窗口合并后查一次当前状态，和上次推过的不同才推给本网关的关注者，并按对方的隐私设置过滤
+type PresenceHub struct {
+	gatewayID string
+	tenantID  string
+	coalesce  time.Duration
+
+	mu       sync.Mutex
+	conns    map[string]*presenceWatch     // snowID -> 该连接关注的人
+	watchers map[string]map[string]int     // 被关注者 -> 关注者 -> 本网关连接数
+	pending  map[string]bool               // 待推送的被关注者 -> 是否强制重推（隐私设置变了）
+	last     map[string]*pb.PresenceUpdate // 被关注者 -> 上次推送的状态
+}
+
+type presenceWatch struct {
+	user    string
+	targets []string
+}
+
+func NewPresenceHub(gatewayID, tenantID string) *PresenceHub {
+	return &PresenceHub{
+		gatewayID: gatewayID,
+		tenantID:  tenantID,
+		coalesce:  presenceCoalesce,
+		conns:     make(map[string]*presenceWatch),
+		watchers:  make(map[string]map[string]int),
+		pending:   make(map[string]bool),
+		last:      make(map[string]*pb.PresenceUpdate),
+	}
+}
+
+// WatchTargets 用户默认关注的人：已同意的好友 + 显式订阅，和用户之间有拉黑关系的都去掉
+func WatchTargets(ctx context.Context, tenantID, userID string) ([]string, error) {
+	fm := msgModel.Friend{}
+	friends, err := fm.ListFriendIDs(ctx, tenantID, userID, presenceWatchMax)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := online.ListPresenceSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(friends)+len(subs))
+	out := make([]string, 0, len(friends)+len(subs))
+	for _, id := range append(friends, subs...) {
+		if id == "" || id == userID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+		if len(out) >= presenceWatchMax {
+			break
+		}
+	}
+	return withoutBlockPairs(ctx, tenantID, userID, out)
+}
+
+// withoutBlockPairs 去掉 users 中和 userID 之间有拉黑关系（任意方向）的人
+func withoutBlockPairs(ctx context.Context, tenantID, userID string, users []string) ([]string, error) {
+	bm := msgModel.Black{}
+	blocked, err := bm.FilterBlockPairs(ctx, tenantID, userID, users)
+	if err != nil || len(blocked) == 0 {
+		return users, err
+	}
+	out := make([]string, 0, len(users))
+	for _, u := range users {
+		if !slices.Contains(blocked, u) {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// Watch 连接鉴权后开始关注，并把被关注者当前的状态推一次
+func (h *PresenceHub) Watch(ctx context.Context, userID, snowID string) error {
+	targets, err := WatchTargets(ctx, h.tenantID, userID)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.unwatchLocked(snowID)
+	h.conns[snowID] = &presenceWatch{user: userID, targets: targets}
+	for _, t := range targets {
+		if h.watchers[t] == nil {
+			h.watchers[t] = make(map[string]int)
+		}
+		h.watchers[t][userID]++
+	}
+	h.mu.Unlock()
+
+	return h.snapshot(ctx, userID, targets)
+}
+
+// Unwatch 连接关闭
+func (h *PresenceHub) Unwatch(_, snowID string) {
+	h.mu.Lock()
+	h.unwatchLocked(snowID)
+	h.mu.Unlock()
+}
+
+func (h *PresenceHub) unwatchLocked(snowID string) {
+	w := h.conns[snowID]
+	if w == nil {
+		return
+	}
+	delete(h.conns, snowID)
+	for _, t := range w.targets {
+		ws := h.watchers[t]
+		if ws[w.user]--; ws[w.user] <= 0 {
+			delete(ws, w.user)
+		}
+		if len(ws) == 0 {
+			delete(h.watchers, t)
+			delete(h.last, t)
+			delete(h.pending, t)
+		}
+	}
+}
+
+// reload 显式订阅变了：重新加载该用户在本网关所有连接的关注列表
+func (h *PresenceHub) reload(ctx context.Context, userID string) {
+	h.mu.Lock()
+	var snows []string
+	for sid, w := range h.conns {
+		if w.user == userID {
+			snows = append(snows, sid)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, sid := range snows {
+		if err := h.Watch(ctx, userID, sid); err != nil {
+			logger.Errorf("[PresenceHub] reload user=%s snowID=%s err=%v", userID, sid, err)
+		}
+	}
+}
+
+// mark 记下待推送的被关注者；本网关没人关注的直接忽略
+func (h *PresenceHub) mark(userID string, force bool) {
+	h.mu.Lock()
+	if _, ok := h.watchers[userID]; ok {
+		h.pending[userID] = h.pending[userID] || force
+	}
+	h.mu.Unlock()
+}
+
+// Run 订阅 Redis 上的变更事件并定时合并推送，阻塞到 ctx 结束
+func (h *PresenceHub) Run(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(h.coalesce)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				h.flush(ctx)
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		err := online.GetManager().SubscribeChanges(ctx, func(c online.OnlineChange) {
+			switch c.Kind {
+			case online.OnlineEventSubs:
+				go h.reload(ctx, c.UserID)
+			case online.OnlineEventPrivacy:
+				h.mark(c.UserID, true)
+			case online.OnlineEventChannels:
+				// 频道订阅变化由 ChannelHub 处理
+			default:
+				h.mark(c.UserID, false)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Errorf("[PresenceHub] subscribe online changes err=%v, retry in %v", err, presenceRetry)
+		select {
+		case <-ctx.Done():
+		case <-time.After(presenceRetry):
+		}
+	}
+}
+
+// flush 推送窗口内有变化的被关注者
+func (h *PresenceHub) flush(ctx context.Context) {
+	h.mu.Lock()
+	if len(h.pending) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	pending := h.pending
+	h.pending = make(map[string]bool)
+	h.mu.Unlock()
+
+	for target, force := range pending {
+		if err := h.push(ctx, target, force); err != nil {
+			logger.Errorf("[PresenceHub] push presence user=%s err=%v", target, err)
+		}
+	}
+}
+
+// push 查 target 当前状态，变了（或 force）才推给本网关的关注者
+// 隐私不允许的关注者平时收不到任何变更；force 时给他们推一次 offline，收回之前看到的状态
+func (h *PresenceHub) push(ctx context.Context, target string, force bool) error {
+	p, err := online.GetPresence(ctx, target)
+	if err != nil {
+		return err
+	}
+	up := p.Public()
+
+	h.mu.Lock()
+	prev := h.last[target]
+	watchers := make([]string, 0, len(h.watchers[target]))
+	for u := range h.watchers[target] {
+		watchers = append(watchers, u)
+	}
+	if len(watchers) > 0 {
+		h.last[target] = up
+	}
+	h.mu.Unlock()
+
+	if len(watchers) == 0 {
+		return nil
+	}
+	if !force && prev != nil && prev.GetStatus() == up.GetStatus() && prev.GetActivity() == up.GetActivity() {
+		return nil // 窗口内上下线抖动，最终状态没变
+	}
+
+	visible, hidden, err := h.splitByPrivacy(ctx, target, watchers)
+	if err != nil {
+		return err
+	}
+	if err := h.deliver(ctx, target, up, visible, true); err != nil {
+		return err
+	}
+	if force && len(hidden) > 0 {
+		return h.deliver(ctx, target, &pb.PresenceUpdate{UserId: target, Status: online.StatusOffline}, hidden, false)
+	}
+	return nil
+}
+
+// snapshot 刚鉴权的连接：把关注的人当前状态各推一帧（隐私不允许的跳过）
+func (h *PresenceHub) snapshot(ctx context.Context, watcher string, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	fm := msgModel.Friend{}
+	contactOf, err := fm.FilterOwnersOf(ctx, h.tenantID, watcher, targets)
+	if err != nil {
+		return err
+	}
+	isContact := make(map[string]bool, len(contactOf))
+	for _, id := range contactOf {
+		isContact[id] = true
+	}
+
+	for _, t := range targets {
+		level, err := online.GetLastSeenPrivacy(ctx, t)
+		if err != nil {
+			return err
+		}
+		if !online.LastSeenVisible(level, isContact[t]) {
+			continue
+		}
+		p, err := online.GetPresence(ctx, t)
+		if err != nil {
+			return err
+		}
+		if err := h.deliver(ctx, t, p.Public(), []string{watcher}, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitByPrivacy 按 target 的隐私设置把关注者分成可见 / 不可见；和 target 有拉黑关系的一律不可见
+func (h *PresenceHub) splitByPrivacy(ctx context.Context, target string, watchers []string) (visible, hidden []string, err error) {
+	level, err := online.GetLastSeenPrivacy(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	allowed, err := withoutBlockPairs(ctx, h.tenantID, target, watchers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(allowed) < len(watchers) {
+		for _, w := range watchers {
+			if !slices.Contains(allowed, w) {
+				hidden = append(hidden, w)
+			}
+		}
+		watchers = allowed
+	}
+	switch level {
+	case online.LastSeenEveryone:
+		return watchers, hidden, nil
+	case online.LastSeenNobody:
+		return nil, append(hidden, watchers...), nil
+	}
+
+	fm := msgModel.Friend{}
+	contacts, err := fm.FilterFriendIDs(ctx, h.tenantID, target, watchers)
+	if err != nil {
+		return nil, nil, err
+	}
+	isContact := make(map[string]bool, len(contacts))
+	for _, id := range contacts {
+		isContact[id] = true
+	}
+	for _, w := range watchers {
+		if online.LastSeenVisible(level, isContact[w]) {
+			visible = append(visible, w)
+		} else {
+			hidden = append(hidden, w)
+		}
+	}
+	return visible, hidden, nil
+}
+
+// deliver 本网关内下发，不走总线；withLastSeen 时离线状态带上最后在线时间
+func (h *PresenceHub) deliver(ctx context.Context, target string, up *pb.PresenceUpdate, recipients []string, withLastSeen bool) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	body, err := anypb.New(up)
+	if err != nil {
+		return err
+	}
+	frame := chat.BuildPresenceDeliver(h.gatewayID, h.tenantID, target, recipients, body)
+	if withLastSeen && up.GetStatus() == online.StatusOffline {
+		if at, err := online.GetLastSeen(ctx, target); err == nil && at > 0 {
+			frame.Meta[MetaLastSeen] = strconv.FormatInt(at, 10)
+		}
+	}
+	chat.RelayFrameToRecipients(frame)
+	return nil
+}
+
+// SubscribePresence 显式订阅 userIDs 的在线状态；已在线的网关会重新加载关注列表
+// 拉黑了订阅者的人不能订阅
+func SubscribePresence(ctx context.Context, tenantID, userID string, userIDs []string) error {
+	allowed, err := withoutBlockPairs(ctx, tenantID, userID, userIDs)
+	if err != nil {
+		return err
+	}
+	if len(allowed) < len(userIDs) {
+		bm := msgModel.Black{}
+		for _, u := range userIDs {
+			if slices.Contains(allowed, u) {
+				continue
+			}
+			blocked, err := bm.IsBlocked(ctx, tenantID, u, userID)
+			if err != nil {
+				return err
+			}
+			if blocked {
+				return errors.ErrBlockedByPeer.WrapMsg("blocked by user", "user_id", u)
+			}
+		}
+	}
+	return online.AddPresenceSubscriptions(ctx, userID, allowed)
+}
+
+// UnsubscribePresence 取消显式订阅（好友关系带来的关注不受影响）
+func UnsubscribePresence(ctx context.Context, userID string, userIDs []string) error {
+	return online.RemovePresenceSubscriptions(ctx, userID, userIDs)
+}
+
+// SetLastSeenPrivacy 最后在线可见范围：everyone / contacts / nobody
+func SetLastSeenPrivacy(ctx context.Context, userID, level string) error {
+	return online.SetLastSeenPrivacy(ctx, userID, level)
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	usermodel "PProject/module/user/model"
+	"PProject/service/push"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// 推送正文预览最多字符数
+const pushPreviewMaxRunes = 100
+
+// 不需要离线推送的消息类型（状态类/信令类）
+var noPushContentTypes = map[msgModel.ContentType]bool{
+	msgModel.TYPING:          true,
+	msgModel.REACTION:        true,
+	msgModel.REVOKE:          true,
+	msgModel.MsgNOTIFICATION: true, // 群通知等系统消息
+}
+
+// NotifyOfflinePush 消息落库下发后调用：recipients 为接收者（不含发送者），offline 为其中不在线的用户
+// 不在线的用户推送到其全部设备，在线的用户只推送到处于后台的设备；异步执行，不阻塞消息链路
+func NotifyOfflinePush(tenantID string, m *msgModel.MessageModel, recipients, offline []string) {
+	if m == nil || len(recipients) == 0 || noPushContentTypes[m.ContentType] {
+		return
+	}
+	push.Default().Go(func(ctx context.Context) {
+		if err := sendOfflinePush(ctx, tenantID, m, recipients, offline); err != nil {
+			logger.Errorf("msg:%v offline push error: %s", m.ServerMsgID, err)
+		}
+	})
+}
+
+func sendOfflinePush(ctx context.Context, tenantID string, m *msgModel.MessageModel, recipients, offline []string) error {
+	pd := usermodel.PushDevice{}
+	devices, err := pd.ListPushDevices(ctx, tenantID, recipients)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+
+	offlineSet := make(map[string]bool, len(offline))
+	for _, uid := range offline {
+		offlineSet[uid] = true
+	}
+	targets := make(map[string][]*usermodel.PushDevice)
+	for _, d := range devices {
+		if offlineSet[d.UserID] || d.Background {
+			targets[d.UserID] = append(targets[d.UserID], d)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	userIDs := make([]string, 0, len(targets))
+	for uid := range targets {
+		userIDs = append(userIDs, uid)
+	}
+	if err := filterPushReceivers(ctx, tenantID, m.ConversationID, targets, userIDs); err != nil {
+		return err
+	}
+
+	title, body := renderPush(ctx, tenantID, m)
+	for uid, list := range targets {
+		badge := int64(-1)
+		if m.OfflinePush == nil || m.OfflinePush.IOSBadgeCountPlus1 {
+			if badge, err = push.IncrBadge(ctx, tenantID, uid); err != nil {
+				logger.Errorf("user:%v incr badge error: %s", uid, err)
+				badge = -1
+			}
+		}
+		for _, d := range list {
+			n := buildNotification(m, d, title, body, badge)
+			err := push.Default().Send(ctx, n)
+			if errors.Is(err, push.ErrTokenInvalid) {
+				logger.Infof("user:%v device:%v push token invalid, remove", uid, d.DeviceID)
+				if err := pd.RemovePushToken(ctx, tenantID, d.Token); err != nil {
+					logger.Errorf("user:%v remove push token error: %s", uid, err)
+				}
+				continue
+			}
+			if err != nil {
+				logger.Errorf("user:%v device:%v push msg:%v error: %s", uid, d.DeviceID, m.ServerMsgID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// filterPushReceivers 去掉设置了免打扰的用户：会话级 RecvMsgOpt、用户全局 GlobalRecvMsgOpt、全局免打扰时段
+func filterPushReceivers(ctx context.Context, tenantID, conversationID string, targets map[string][]*usermodel.PushDevice, userIDs []string) error {
+	conv := msgModel.Conversation{}
+	convs, err := conv.ListConversationsByOwners(ctx, tenantID, conversationID, userIDs)
+	if err != nil {
+		return err
+	}
+	for _, c := range convs {
+		if c.RecvMsgOpt != usermodel.RecvNotifyAll {
+			delete(targets, c.OwnerUserID)
+		}
+	}
+
+	u := usermodel.User{}
+	users, err := u.ListUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, user := range users {
+		if user.GlobalRecvMsgOpt != usermodel.RecvNotifyAll || (user.MuteUntil != nil && user.MuteUntil.After(now)) {
+			delete(targets, user.UserID)
+		}
+	}
+	return nil
+}
+
+// renderPush 推送标题/正文：优先用发送方指定的 OfflinePush，否则按 发送者昵称 + 内容摘要 生成
+func renderPush(ctx context.Context, tenantID string, m *msgModel.MessageModel) (title, body string) {
+	if op := m.OfflinePush; op != nil && op.Title != "" && op.Desc != "" {
+		return op.Title, op.Desc
+	}
+
+	sender := m.SenderNickname
+	if sender == "" {
+		sender = m.SendID
+		u := usermodel.User{}
+		if users, err := u.ListUsersByIDs(ctx, []string{m.SendID}); err == nil && len(users) > 0 && users[0].Nickname != "" {
+			sender = users[0].Nickname
+		}
+	}
+
+	title, body = sender, pushPreview(m)
+	if m.GroupID != "" {
+		g := msgModel.Group{}
+		if grp, err := g.GetGroupByID(ctx, tenantID, m.GroupID); err == nil && grp != nil && grp.GroupName != "" {
+			title = grp.GroupName
+			body = sender + ": " + body
+		}
+	}
+	if op := m.OfflinePush; op != nil {
+		if op.Title != "" {
+			title = op.Title
+		}
+		if op.Desc != "" {
+			body = op.Desc
+		}
+	}
+	return title, body
+}
+
+// pushPreview 按消息类型生成摘要；阅后即焚消息不展示内容
+func pushPreview(m *msgModel.MessageModel) string {
+	if m.BurnDuration > 0 {
+		return "[阅后即焚消息]"
+	}
+	var text string
+	switch m.ContentType {
+	case msgModel.TEXT:
+		if m.TextElem != nil {
+			text = m.TextElem.Content
+		}
+	case msgModel.ADVANCED_TEXT:
+		if m.AdvancedTextElem != nil {
+			text = m.AdvancedTextElem.Text
+		}
+	case msgModel.MARKDOWN:
+		if m.MarkdownTextElem != nil {
+			text = m.MarkdownTextElem.Content
+		}
+	case msgModel.AT_TEXT:
+		if m.AtTextElem != nil {
+			text = m.AtTextElem.Text
+		}
+	case msgModel.QUOTE:
+		if m.QuoteElem != nil {
+			text = m.QuoteElem.Text
+		}
+	case msgModel.PICTURE:
+		return "[图片]"
+	case msgModel.SOUND:
+		return "[语音]"
+	case msgModel.VIDEO:
+		return "[视频]"
+	case msgModel.FILE:
+		return "[文件]"
+	case msgModel.LOCATION:
+		return "[位置]"
+	case msgModel.CARD:
+		return "[名片]"
+	case msgModel.FACE:
+		return "[表情]"
+	case msgModel.MERGE:
+		return "[聊天记录]"
+	case msgModel.CUSTOM:
+		return "[自定义消息]"
+	}
+	if text == "" {
+		text = m.ContentText
+	}
+	if text == "" {
+		return "[新消息]"
+	}
+	if r := []rune(text); len(r) > pushPreviewMaxRunes {
+		text = string(r[:pushPreviewMaxRunes]) + "…"
+	}
+	return text
+}
+
+func buildNotification(m *msgModel.MessageModel, d *usermodel.PushDevice, title, body string, badge int64) *push.Notification {
+	n := &push.Notification{
+		Token:      d.Token,
+		Platform:   d.Platform,
+		Title:      title,
+		Body:       body,
+		Badge:      badge,
+		Sound:      "default",
+		CollapseID: m.ServerMsgID,
+		Data: map[string]string{
+			"conversation_id": m.ConversationID,
+			"server_msg_id":   m.ServerMsgID,
+			"seq":             strconv.FormatInt(m.Seq, 10),
+		},
+	}
+	if op := m.OfflinePush; op != nil {
+		if op.IosSound != "" {
+			n.Sound = op.IosSound
+		}
+		n.Category = op.IOSCategory
+		if op.AndroidVivoClassification {
+			n.AndroidVivoClassification = 1
+		}
+		if op.Ex != "" {
+			n.Data["ex"] = op.Ex
+		}
+	}
+	return n
+}
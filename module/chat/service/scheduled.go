@@ -0,0 +1,237 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	msgModel "PProject/module/chat/model"
+	"PProject/module/chat/seq"
+	errors "PProject/tools/errs"
+	ids "PProject/tools/ids"
+	"context"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	scheduleMinAhead   = 10 * time.Second    // 至少提前这么久
+	scheduleMaxAhead   = 30 * 24 * time.Hour // 最多提前 30 天
+	scheduleMaxPending = int64(100)          // 每人最多待发送条数
+	scheduleListLimit  = int64(100)
+)
+
+// ScheduledMessageItem 定时消息列表项
+type ScheduledMessageItem struct {
+	ScheduleID     string          `json:"schedule_id"`
+	ConversationID string          `json:"conversation_id"`
+	ClientMsgID    string          `json:"client_msg_id"`
+	SendAtMS       int64           `json:"send_at_ms"`
+	Status         int32           `json:"status"`
+	Version        int64           `json:"version"`
+	ServerMsgID    string          `json:"server_msg_id,omitempty"`
+	Message        *pb.MessageData `json:"message"`
+}
+
+// scheduledConversationID 定时消息的目标会话：话题 > 群 > 单聊
+func scheduledConversationID(userID string, md *pb.MessageData) string {
+	switch {
+	case md.GetThreadId() != "":
+		return seq.ThreadConvID(md.GetThreadId())
+	case md.GetGroupId() != "":
+		return seq.GroupConvID(md.GetGroupId())
+	case md.GetRecvId() != "":
+		return seq.BuildP2PConvID(userID, md.GetRecvId())
+	}
+	return ""
+}
+
+func checkScheduleTime(sendAtMS int64) error {
+	now := time.Now()
+	if sendAtMS < now.Add(scheduleMinAhead).UnixMilli() || sendAtMS > now.Add(scheduleMaxAhead).UnixMilli() {
+		return errors.ErrArgs.WrapMsg("send_at out of range", "send_at_ms", sendAtMS)
+	}
+	return nil
+}
+
+// CreateScheduledMessage 新建定时消息；发送者固定为当前用户，client_msg_id 没带就生成一个
+func CreateScheduledMessage(ctx context.Context, tenantID, userID string, sendAtMS int64, md *pb.MessageData) (*ScheduledMessageItem, error) {
+	if md == nil {
+		return nil, errors.ErrArgs.WrapMsg("message is required")
+	}
+	if err := checkScheduleTime(sendAtMS); err != nil {
+		return nil, err
+	}
+	md.SendId = userID
+	if md.GetClientMsgId() == "" {
+		md.ClientMsgId = ids.GenerateString()
+	}
+	convID := scheduledConversationID(userID, md)
+	if convID == "" {
+		return nil, errors.ErrArgs.WrapMsg("recv_id, group_id or thread_id is required")
+	}
+	// 提前校验内容，避免到点才发现发不出去
+	if _, err := BuildMessageModelFromPB(tenantID, md, 0, convID); err != nil {
+		return nil, errors.ErrArgs.WrapMsg(err.Error())
+	}
+
+	sm := msgModel.ScheduledMessage{}
+	pending, err := sm.CountPendingScheduledMessages(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending >= scheduleMaxPending {
+		return nil, errors.ErrArgs.WrapMsg("too many scheduled messages", "pending", pending)
+	}
+
+	payload, err := proto.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	m := &msgModel.ScheduledMessage{
+		TenantID:       tenantID,
+		ScheduleID:     ids.GenerateString(),
+		OwnerUserID:    userID,
+		ConversationID: convID,
+		ClientMsgID:    md.GetClientMsgId(),
+		SendAtMS:       sendAtMS,
+		Payload:        payload,
+	}
+	if err := sm.InsertScheduledMessage(ctx, m); err != nil {
+		return nil, err
+	}
+	return toScheduledItem(m, md), nil
+}
+
+// ListScheduledMessages 当前用户的定时消息（默认只列待发送的）
+func ListScheduledMessages(ctx context.Context, tenantID, userID string, statuses []int32) ([]*ScheduledMessageItem, error) {
+	sm := msgModel.ScheduledMessage{}
+	list, err := sm.ListScheduledMessages(ctx, tenantID, userID, statuses, scheduleListLimit)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*ScheduledMessageItem, 0, len(list))
+	for _, m := range list {
+		md, err := DecodeScheduledPayload(m)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, toScheduledItem(m, md))
+	}
+	return items, nil
+}
+
+// UpdateScheduledMessage 修改发送时间和/或内容；只能改待发送的，会话不允许改
+func UpdateScheduledMessage(ctx context.Context, tenantID, userID, scheduleID string, sendAtMS int64, md *pb.MessageData) (*ScheduledMessageItem, error) {
+	sm := msgModel.ScheduledMessage{}
+	cur, err := sm.GetScheduledMessage(ctx, tenantID, userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if cur == nil {
+		return nil, errors.ErrRecordNotFound.WrapMsg("scheduled message not found", "schedule_id", scheduleID)
+	}
+	if sendAtMS > 0 {
+		if err := checkScheduleTime(sendAtMS); err != nil {
+			return nil, err
+		}
+	}
+
+	var payload []byte
+	if md != nil {
+		md.SendId = userID
+		md.ClientMsgId = cur.ClientMsgID // 幂等键不随编辑变化
+		if scheduledConversationID(userID, md) != cur.ConversationID {
+			return nil, errors.ErrArgs.WrapMsg("conversation cannot be changed", "schedule_id", scheduleID)
+		}
+		if _, err := BuildMessageModelFromPB(tenantID, md, 0, cur.ConversationID); err != nil {
+			return nil, errors.ErrArgs.WrapMsg(err.Error())
+		}
+		if payload, err = proto.Marshal(md); err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := sm.UpdatePendingScheduledMessage(ctx, tenantID, userID, scheduleID, sendAtMS, payload)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.ErrScheduledMsgNotPending.WrapMsg("scheduled message is not pending", "schedule_id", scheduleID)
+	}
+	if md == nil {
+		if md, err = DecodeScheduledPayload(m); err != nil {
+			return nil, err
+		}
+	}
+	return toScheduledItem(m, md), nil
+}
+
+// CancelScheduledMessage 取消定时消息；已发出/已取消的返回 ErrScheduledMsgNotPending
+func CancelScheduledMessage(ctx context.Context, tenantID, userID, scheduleID string) error {
+	sm := msgModel.ScheduledMessage{}
+	ok, err := sm.CancelScheduledMessage(ctx, tenantID, userID, scheduleID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	cur, err := sm.GetScheduledMessage(ctx, tenantID, userID, scheduleID)
+	if err != nil {
+		return err
+	}
+	if cur == nil {
+		return errors.ErrRecordNotFound.WrapMsg("scheduled message not found", "schedule_id", scheduleID)
+	}
+	return errors.ErrScheduledMsgNotPending.WrapMsg("scheduled message is not pending", "schedule_id", scheduleID)
+}
+
+// DecodeScheduledPayload 反序列化定时消息里保存的 MessageData
+func DecodeScheduledPayload(m *msgModel.ScheduledMessage) (*pb.MessageData, error) {
+	md := &pb.MessageData{}
+	if err := proto.Unmarshal(m.Payload, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// BuildScheduledFrame 到点后构造一条普通的 DATA 帧，交给正常的发送链路
+func BuildScheduledFrame(m *msgModel.ScheduledMessage) (*pb.MessageFrameData, error) {
+	md, err := DecodeScheduledPayload(m)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	md.SendTime = now
+	return &pb.MessageFrameData{
+		Type:     pb.MessageFrameData_DATA,
+		From:     m.OwnerUserID,
+		To:       md.GetRecvId(),
+		Ts:       now,
+		TenantId: m.TenantID,
+		DedupId:  "sched-" + m.ScheduleID,
+		Meta:     map[string]string{"schedule_id": m.ScheduleID},
+		Body:     &pb.MessageFrameData_Payload{Payload: md},
+	}, nil
+}
+
+// ScheduledDeliveredMsgID 定时消息是否已经落库（按 client_msg_id 查），已落库返回 server_msg_id
+func ScheduledDeliveredMsgID(ctx context.Context, m *msgModel.ScheduledMessage) (string, error) {
+	msg, err := msgModel.GetMessageByClientMsgID(ctx, m.TenantID, m.ConversationID, m.ClientMsgID)
+	if err != nil || msg == nil {
+		return "", err
+	}
+	return msg.ServerMsgID, nil
+}
+
+func toScheduledItem(m *msgModel.ScheduledMessage, md *pb.MessageData) *ScheduledMessageItem {
+	return &ScheduledMessageItem{
+		ScheduleID:     m.ScheduleID,
+		ConversationID: m.ConversationID,
+		ClientMsgID:    m.ClientMsgID,
+		SendAtMS:       m.SendAtMS,
+		Status:         m.Status,
+		Version:        m.Version,
+		ServerMsgID:    m.ServerMsgID,
+		Message:        md,
+	}
+}
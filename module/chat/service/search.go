@@ -0,0 +1,462 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	sessionpb "PProject/gen/session"
+	"PProject/logger"
+	msgModel "PProject/module/chat/model"
+	"PProject/module/chat/seq"
+	errors "PProject/tools/errs"
+	"PProject/tools/segment"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	searchDefaultPageSize = 20
+	searchMaxPageSize     = 100
+	searchMaxConvs        = 2000 // 单次检索最多覆盖的会话数（按最近活跃）
+	searchSnippetRunes    = 80
+	searchRebuildBatch    = 500
+
+	SearchHighlightPre  = "<em>"
+	SearchHighlightPost = "</em>"
+)
+
+// searchCursor 游标：上一页最后一条的 send_time_ms + 索引 _id
+type searchCursor struct {
+	TMS int64
+	ID  primitive.ObjectID
+}
+
+func (c searchCursor) String() string {
+	return fmt.Sprintf("%d:%s", c.TMS, c.ID.Hex())
+}
+
+func parseSearchCursor(s string) (*searchCursor, error) {
+	ts, hex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("bad cursor %q", s)
+	}
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, err
+	}
+	return &searchCursor{TMS: t, ID: id}, nil
+}
+
+// searchText 参与检索的文本：各类消息里用户能看到的文字；都没有时退回 content_text
+func searchText(m *msgModel.MessageModel) string {
+	var parts []string
+	add := func(s ...string) {
+		for _, v := range s {
+			if v = strings.TrimSpace(v); v != "" {
+				parts = append(parts, v)
+			}
+		}
+	}
+	if e := m.TextElem; e != nil {
+		add(e.Content)
+	}
+	if e := m.AdvancedTextElem; e != nil {
+		add(e.Text)
+	}
+	if e := m.MarkdownTextElem; e != nil {
+		add(e.Content)
+	}
+	if e := m.AtTextElem; e != nil {
+		add(e.Text)
+	}
+	if e := m.QuoteElem; e != nil {
+		add(e.Text)
+	}
+	if e := m.FileElem; e != nil {
+		add(e.FileName)
+	}
+	if e := m.LocationElem; e != nil {
+		add(e.Description)
+	}
+	if e := m.CardElem; e != nil {
+		add(e.Nickname)
+	}
+	if e := m.MergeElem; e != nil {
+		add(e.Title)
+		add(e.AbstractList...)
+	}
+	if e := m.CustomElem; e != nil {
+		add(e.Description)
+	}
+	if len(parts) == 0 {
+		add(m.ContentText)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// searchable 能出现在检索结果里的消息：正常状态、非临时、未到销毁时间
+func searchable(m *msgModel.MessageModel, nowMS int64) bool {
+	if m == nil || m.Status != msgModel.MsgStatusNormal || m.IsEphemeral == 1 {
+		return false
+	}
+	return m.ExpireAtMS == 0 || m.ExpireAtMS > nowMS
+}
+
+// IndexMessageSearch 消息落库/编辑后写检索索引；撤回、删除、临时消息、没有文字的消息移出索引
+// 失败不影响消息本身，索引可以用 RebuildSearchIndex 从消息表重建
+func IndexMessageSearch(ctx context.Context, tenantID string, m *msgModel.MessageModel) error {
+	if m == nil {
+		return nil
+	}
+	text := searchText(m)
+	tokens := segment.Tokenize(text)
+	if !searchable(m, time.Now().UnixMilli()) || (len(tokens) == 0 && len(m.Tags) == 0) {
+		return msgModel.DeleteMessageSearch(ctx, tenantID, m.ConversationID, m.Seq)
+	}
+	if tokens == nil {
+		tokens = []string{}
+	}
+	return msgModel.UpsertMessageSearch(ctx, &msgModel.MessageSearch{
+		TenantID:       tenantID,
+		ConversationID: m.ConversationID,
+		Seq:            m.Seq,
+		ServerMsgID:    m.ServerMsgID,
+		SendID:         m.SendID,
+		ContentType:    int32(m.ContentType),
+		SendTimeMS:     m.SendTimeMS,
+		GuildID:        m.GuildID,
+		ChannelID:      m.ChannelID,
+		ThreadID:       m.ThreadID,
+		Tags:           m.Tags,
+		Tokens:         tokens,
+		Text:           text,
+	})
+}
+
+// RemoveMessageSearch 撤回/销毁后移出索引
+func RemoveMessageSearch(ctx context.Context, tenantID string, m *msgModel.MessageModel) error {
+	if m == nil {
+		return nil
+	}
+	return msgModel.DeleteMessageSearch(ctx, tenantID, m.ConversationID, m.Seq)
+}
+
+// searchRebuilds 进行中的重建：tenant|conversation -> 已写入条数
+var searchRebuilds sync.Map
+
+// RebuildSearchIndex 后台从消息表重建检索索引；conversationID 为空重建整个租户
+// 逐条 upsert，不先清空，重建期间检索照常可用；消息表里已经没有的索引在检索命中时清掉
+// 同一范围已经在重建时不重复启动，started=false，indexed 为进行中那次已写入的条数
+func RebuildSearchIndex(tenantID, conversationID string) (started bool, indexed int64) {
+	key := tenantID + "|" + conversationID
+	n := new(atomic.Int64)
+	if v, loaded := searchRebuilds.LoadOrStore(key, n); loaded {
+		return false, v.(*atomic.Int64).Load()
+	}
+	go func() {
+		defer searchRebuilds.Delete(key)
+		ctx := context.Background()
+		err := msgModel.ScanMessages(ctx, tenantID, conversationID, searchRebuildBatch, func(m *msgModel.MessageModel) error {
+			if err := IndexMessageSearch(ctx, tenantID, m); err != nil {
+				return err
+			}
+			n.Add(1)
+			return nil
+		})
+		if err != nil {
+			logger.Errorf("[Search] rebuild conv=%s indexed=%d err=%v", conversationID, n.Load(), err)
+			return
+		}
+		logger.Infof("[Search] rebuild conv=%s indexed=%d done", conversationID, n.Load())
+	}()
+	return true, 0
+}
+
+// SearchHit 一条检索结果：消息 + 高亮摘要
+type SearchHit struct {
+	Message *pb.MessageData `json:"message"`
+	Snippet string          `json:"snippet"`
+}
+
+// SearchResult 检索结果页
+type SearchResult struct {
+	Items []*SearchHit `json:"items"`
+	Page  *pb.PageResp `json:"page"`
+}
+
+// searchScopes 调用者能检索的会话；指定 channel/thread 时只查这一个
+// 默认范围：自己的会话 + 订阅的广播频道 + 所在服务器里能看且能读历史的频道（读扩散，没有个人会话记录）
+// 只给了 guild_id 时只查这个服务器的频道
+func searchScopes(ctx context.Context, tenantID, userID string, req *sessionpb.SearchReq) ([]*msgModel.Conversation, error) {
+	cm := msgModel.Conversation{}
+	var convID string
+	switch {
+	case req.GetThreadId() != "":
+		convID = seq.ThreadConvID(req.GetThreadId())
+	case req.GetChannelId() != "":
+		convID = seq.ChannelConvID(req.GetChannelId())
+	case req.GetGuildId() != "":
+		return guildSearchScopes(ctx, tenantID, userID, req.GetGuildId())
+	default:
+		return defaultSearchScopes(ctx, tenantID, userID)
+	}
+
+	if req.GetChannelId() != "" {
+		// 服务器频道每次按频道权限校验，有会话记录也不能绕过
+		if _, err := CheckGuildChannelPerm(ctx, tenantID, userID, req.GetChannelId(), guildReadPerms); err != nil {
+			return nil, err
+		}
+	}
+
+	conv, err := cm.GetUserConversation(ctx, tenantID, userID, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil && req.GetThreadId() != "" {
+		conv, err = threadReadableConversation(ctx, tenantID, userID, req.GetThreadId())
+		if err != nil {
+			return nil, err
+		}
+		if conv != nil {
+			// 只读视图给的是父会话，检索的是话题会话
+			conv.ConversationID = convID
+		}
+	} else if conv == nil && req.GetChannelId() != "" {
+		conv, err = channelReadableConversation(ctx, tenantID, userID, req.GetChannelId())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conv == nil {
+		return nil, errors.ErrNoPermission.WrapMsg("conversation not found", "conversation_id", convID)
+	}
+	// 群留存按会话上的 GroupID 过滤；话题和频道的会话记录上没有，这里补上
+	if conv.GroupID, err = retentionGroupOf(ctx, tenantID, req.GetThreadId(), req.GetChannelId(), conv.GroupID); err != nil {
+		return nil, err
+	}
+	return []*msgModel.Conversation{conv}, nil
+}
+
+// defaultSearchScopes 不指定范围时的检索范围，最多 searchMaxConvs 个会话
+func defaultSearchScopes(ctx context.Context, tenantID, userID string) ([]*msgModel.Conversation, error) {
+	cm := msgModel.Conversation{}
+	list, err := cm.ListUserConversations(ctx, tenantID, userID, searchMaxConvs)
+	if err != nil {
+		return nil, err
+	}
+	// 频道的会话记录只是懒建的已读状态，不代表现在还能看，频道统一按下面的订阅/权限重新算
+	convs := make([]*msgModel.Conversation, 0, len(list))
+	for _, c := range list {
+		if _, ok := seq.ChannelIDOf(c.ConversationID); ok {
+			continue
+		}
+		if tid, ok := seq.ThreadIDOf(c.ConversationID); ok {
+			// 话题按根消息所在群的留存过滤；根消息已经不在的话题跳过
+			root, err := msgModel.GetMessageByServerMsgID(ctx, tid)
+			if err != nil {
+				return nil, err
+			}
+			if root == nil || root.TenantID != tenantID {
+				continue
+			}
+			c.GroupID = rootRetentionGroup(root)
+		}
+		convs = append(convs, c)
+	}
+
+	guildIDs, channelIDs, err := ListUserChannelRoutes(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range channelIDs {
+		convs = append(convs, &msgModel.Conversation{
+			TenantID:       tenantID,
+			OwnerUserID:    userID,
+			ConversationID: seq.ChannelConvID(id),
+			GroupID:        id,
+		})
+	}
+	for _, gid := range guildIDs {
+		if len(convs) >= searchMaxConvs {
+			break
+		}
+		gc, err := guildSearchScopes(ctx, tenantID, userID, gid)
+		if err != nil {
+			return nil, err
+		}
+		convs = append(convs, gc...)
+	}
+	if len(convs) > searchMaxConvs {
+		convs = convs[:searchMaxConvs]
+	}
+	return convs, nil
+}
+
+// guildSearchScopes 服务器里调用者能看且能读历史的频道；不是成员时没有权限，返回空
+func guildSearchScopes(ctx context.Context, tenantID, userID, guildID string) ([]*msgModel.Conversation, error) {
+	cm := msgModel.GuildChannel{}
+	channels, err := cm.ListChannels(ctx, tenantID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	var convs []*msgModel.Conversation
+	for _, ch := range channels {
+		if ch.Type == msgModel.GuildChannelTypeCategory {
+			continue
+		}
+		perms, err := GuildPermissions(ctx, tenantID, guildID, ch.ChannelID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if perms&guildReadPerms != guildReadPerms {
+			continue
+		}
+		convs = append(convs, &msgModel.Conversation{
+			TenantID:       tenantID,
+			OwnerUserID:    userID,
+			ConversationID: seq.ChannelConvID(ch.ChannelID),
+		})
+	}
+	return convs, nil
+}
+
+// Search 检索调用者所在会话的消息（min_seq 之后、留存期内），按发送时间倒序，page.cursor 继续翻
+// q 按 segment.QueryTerms 分词后全部命中；q 和 tags 至少给一个
+func Search(ctx context.Context, tenantID, userID string, req *sessionpb.SearchReq) (*SearchResult, error) {
+	if req == nil {
+		return nil, errors.ErrArgs.WrapMsg("nil request")
+	}
+	terms := segment.QueryTerms(req.GetQ())
+	if len(terms) == 0 && len(req.GetTags()) == 0 {
+		return nil, errors.ErrArgs.WrapMsg("q and tags are both empty")
+	}
+
+	convs, err := searchScopes(ctx, tenantID, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchResult{Items: []*SearchHit{}, Page: &pb.PageResp{}}
+	if len(convs) == 0 {
+		return result, nil
+	}
+
+	now := time.Now()
+	cutoff, err := retentionCutoffMS(ctx, tenantID, "", now)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(req.GetPage().GetSize())
+	if size <= 0 {
+		size = searchDefaultPageSize
+	}
+	if size > searchMaxPageSize {
+		size = searchMaxPageSize
+	}
+
+	q := &msgModel.SearchQuery{
+		TenantID:     tenantID,
+		Terms:        terms,
+		Tags:         req.GetTags(),
+		ContentTypes: req.GetContentTypes(),
+		GuildID:      req.GetGuildId(),
+		ChannelID:    req.GetChannelId(),
+		ThreadID:     req.GetThreadId(),
+		FromMS:       req.GetTimeFrom(),
+		ToMS:         req.GetTimeTo(),
+		Limit:        size + 1, // 多取一条判断 has_more
+	}
+	if cutoff > q.FromMS {
+		q.FromMS = cutoff
+	}
+	groups := make(map[string]string, len(convs)) // 会话 -> 群，群留存按会话单独过滤
+	for _, c := range convs {
+		q.Scopes = append(q.Scopes, msgModel.SearchScope{ConversationID: c.ConversationID, MinSeq: c.MinSeq})
+		if c.GroupID != "" {
+			groups[c.ConversationID] = c.GroupID
+		}
+	}
+	if c := req.GetPage().GetCursor(); c != "" {
+		cur, err := parseSearchCursor(c)
+		if err != nil {
+			return nil, errors.ErrArgs.WrapMsg(err.Error())
+		}
+		q.CursorTMS, q.CursorID = cur.TMS, cur.ID
+	}
+
+	hits, err := msgModel.SearchMessages(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(hits)) > size {
+		hits = hits[:size]
+		last := hits[len(hits)-1]
+		result.Page.HasMore = true
+		result.Page.NextCursor = searchCursor{TMS: last.SendTimeMS, ID: last.ID}.String()
+	}
+
+	msgs, err := hydrateSearchHits(ctx, tenantID, hits)
+	if err != nil {
+		return nil, err
+	}
+
+	groupCutoff := make(map[string]int64)
+	nowMS := now.UnixMilli()
+	for _, h := range hits {
+		m := msgs[h.ConversationID][h.Seq]
+		if !searchable(m, nowMS) {
+			// 索引落后于消息表（撤回/销毁时没同步上），顺手清掉
+			if err := msgModel.DeleteMessageSearch(ctx, tenantID, h.ConversationID, h.Seq); err != nil {
+				logger.Errorf("[Search] drop stale index conv=%s seq=%d err=%v", h.ConversationID, h.Seq, err)
+			}
+			continue
+		}
+		if gid := groups[h.ConversationID]; gid != "" {
+			gc, ok := groupCutoff[gid]
+			if !ok {
+				if gc, err = retentionCutoffMS(ctx, tenantID, gid, now); err != nil {
+					return nil, err
+				}
+				groupCutoff[gid] = gc
+			}
+			if gc > 0 && m.SendTimeMS < gc {
+				continue
+			}
+		}
+		result.Items = append(result.Items, &SearchHit{
+			Message: BuildPBFromMessageModel(m),
+			Snippet: segment.Highlight(h.Text, req.GetQ(), searchSnippetRunes, SearchHighlightPre, SearchHighlightPost),
+		})
+	}
+	return result, nil
+}
+
+// hydrateSearchHits 按会话批量回表取消息：conversation_id -> seq -> 消息
+func hydrateSearchHits(ctx context.Context, tenantID string, hits []*msgModel.MessageSearch) (map[string]map[int64]*msgModel.MessageModel, error) {
+	seqs := make(map[string][]int64)
+	for _, h := range hits {
+		seqs[h.ConversationID] = append(seqs[h.ConversationID], h.Seq)
+	}
+	out := make(map[string]map[int64]*msgModel.MessageModel, len(seqs))
+	for convID, list := range seqs {
+		msgs, err := msgModel.GetMessagesBySeqs(ctx, tenantID, convID, list)
+		if err != nil {
+			return nil, err
+		}
+		bySeq := make(map[int64]*msgModel.MessageModel, len(msgs))
+		for _, m := range msgs {
+			bySeq[m.Seq] = m
+		}
+		out[convID] = bySeq
+	}
+	return out, nil
+}
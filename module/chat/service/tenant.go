@@ -0,0 +1,35 @@
+package service
+
+import (
+	manageModel "PProject/module/manage/model"
+	"context"
+	"sync"
+	"time"
+)
+
+// 租户配置（单聊策略、留存天数）很少变更，发消息/拉历史时每次都查 Mongo 太重，进程内缓存一小段时间
+const tenantCacheTTL = 30 * time.Second
+
+type tenantCacheEntry struct {
+	tenant  *manageModel.Tenant // nil 表示租户不存在
+	expires time.Time
+}
+
+var tenantCache sync.Map // tenantID -> tenantCacheEntry
+
+// getTenant 带进程内缓存的租户查询，不存在返回 nil, nil
+func getTenant(ctx context.Context, tenantID string) (*manageModel.Tenant, error) {
+	now := time.Now()
+	if v, ok := tenantCache.Load(tenantID); ok {
+		if e := v.(tenantCacheEntry); now.Before(e.expires) {
+			return e.tenant, nil
+		}
+	}
+	tm := manageModel.Tenant{}
+	tenant, err := tm.GetTenantByID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	tenantCache.Store(tenantID, tenantCacheEntry{tenant: tenant, expires: now.Add(tenantCacheTTL)})
+	return tenant, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	pb "PProject/gen/message"
+	msgModel "PProject/module/chat/model"
+	errors "PProject/tools/errs"
+	"context"
+)
+
+// GetThreadRoot 话题ID即根消息的 server_msg_id
+func GetThreadRoot(ctx context.Context, tenantID, threadID string) (*msgModel.MessageModel, error) {
+	root, err := msgModel.GetMessageByServerMsgID(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil || root.TenantID != tenantID {
+		return nil, errors.ErrRecordNotFound.WrapMsg("thread root not found", "thread_id", threadID)
+	}
+	if root.ThreadID != "" {
+		// 话题里的回复不能再开话题
+		return nil, errors.ErrArgs.WrapMsg("nested thread is not allowed", "thread_id", threadID)
+	}
+	return root, nil
+}
+
+// CheckThreadAccess 在话题里发消息前校验：能看到父会话才能参与话题
+// 群里的话题按群的发言规则校验 md（禁言、媒体大小等），返回父群，慢速模式由调用方用它占位；单聊话题返回 nil
+func CheckThreadAccess(ctx context.Context, tenantID, userID string, root *msgModel.MessageModel, md *pb.MessageData) (*msgModel.Group, error) {
+	if root.GroupID != "" {
+		return CheckGroupSend(ctx, tenantID, root.GroupID, userID, md)
+	}
+	cm := msgModel.Conversation{}
+	parent, err := cm.GetUserConversation(ctx, tenantID, userID, root.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, errors.ErrNoPermission.WrapMsg("no access to parent conversation", "conversation_id", root.ConversationID)
+	}
+	return nil, nil
+}
+
+// threadReadableConversation 未订阅话题但能看父会话时，给一个只读的会话视图（无 min_seq 限制）
+func threadReadableConversation(ctx context.Context, tenantID, userID, threadID string) (*msgModel.Conversation, error) {
+	root, err := GetThreadRoot(ctx, tenantID, threadID)
+	if err != nil {
+		return nil, err
+	}
+	cm := msgModel.Conversation{}
+	parent, err := cm.GetUserConversation(ctx, tenantID, userID, root.ConversationID)
+	if err != nil || parent == nil {
+		return nil, err
+	}
+	// 父会话清过历史且根消息在清理范围内，话题一并不可见
+	if root.Seq < parent.MinSeq {
+		return nil, nil
+	}
+	return &msgModel.Conversation{
+		TenantID:       tenantID,
+		OwnerUserID:    userID,
+		ConversationID: root.ConversationID,
+	}, nil
+}
@@ -313,6 +313,14 @@ type AgentBot struct {
 	Description string             `bson:"description,omitempty" json:"description,omitempty"` // 描述
 	WebhookURL  string             `bson:"webhook_url,omitempty" json:"webhook_url,omitempty"` // 回调 Webhook 地址
 
+	// —— 开放平台 —— //
+	UserID        string `bson:"user_id,omitempty"        json:"user_id,omitempty"`       // 机器人账号（User.AccountType=2）
+	OwnerUserID   string `bson:"owner_user_id,omitempty"  json:"owner_user_id,omitempty"` // 创建者
+	WebhookSecret string `bson:"webhook_secret,omitempty" json:"-"`                       // Webhook 签名密钥
+	TokenHash     string `bson:"token_hash,omitempty"     json:"-"`                       // SHA256(API Token)
+	// 创建者申请的特权意图；实际开通的在 User.PrivilegedIntents，由应用管理员审批
+	RequestedIntents int64 `bson:"requested_intents,omitempty" json:"requested_intents,omitempty"`
+
 	Status    string    `bson:"status"           json:"status"` // 启用/禁用
 	CreatedAt time.Time `bson:"created_at"       json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at"       json:"updated_at"`
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AgentBot collection field constants
+const (
+	BotFieldID            = "_id"
+	BotFieldTenantID      = "tenant_id"
+	BotFieldName          = "name"
+	BotFieldAvatarURL     = "avatar_url"
+	BotFieldDescription   = "description"
+	BotFieldWebhookURL    = "webhook_url"
+	BotFieldUserID        = "user_id"
+	BotFieldOwnerUserID   = "owner_user_id"
+	BotFieldWebhookSecret = "webhook_secret"
+	BotFieldTokenHash     = "token_hash"
+	BotFieldRequested     = "requested_intents"
+	BotFieldStatus        = "status"
+	BotFieldCreatedAt     = "created_at"
+	BotFieldUpdatedAt     = "updated_at"
+)
+
+// Status
+const (
+	BotStatusEnabled  = "enabled"
+	BotStatusDisabled = "disabled"
+)
+
+// Enabled 机器人可用：可以调 API、接收事件
+func (sess *AgentBot) Enabled() bool {
+	return sess.Status == BotStatusEnabled
+}
+
+// InsertBot 新建机器人
+func (sess *AgentBot) InsertBot(ctx context.Context, b *AgentBot) error {
+	now := time.Now()
+	b.CreatedAt = now
+	b.UpdatedAt = now
+	_, err := sess.Collection().InsertOne(ctx, b)
+	return err
+}
+
+// GetBotByUserID 按机器人账号查，不存在返回 nil
+func (sess *AgentBot) GetBotByUserID(ctx context.Context, tenantID, userID string) (*AgentBot, error) {
+	var out AgentBot
+	err := sess.Collection().FindOne(ctx, bson.M{
+		BotFieldTenantID: tenantID,
+		BotFieldUserID:   userID,
+	}).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateBotFields 更新机器人字段，返回是否命中
+func (sess *AgentBot) UpdateBotFields(ctx context.Context, tenantID, userID string, set bson.M) (bool, error) {
+	set[BotFieldUpdatedAt] = time.Now()
+	res, err := sess.Collection().UpdateOne(ctx,
+		bson.M{BotFieldTenantID: tenantID, BotFieldUserID: userID},
+		bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ListBotsByOwner 某个用户创建的机器人
+func (sess *AgentBot) ListBotsByOwner(ctx context.Context, tenantID, ownerUserID string) ([]*AgentBot, error) {
+	return sess.findBots(ctx, bson.M{
+		BotFieldTenantID:    tenantID,
+		BotFieldOwnerUserID: ownerUserID,
+	})
+}
+
+// ListTenantWebhookBots 租户下启用了、配置了 Webhook 的全部机器人（读扩散频道没有成员会话，按机器人反查成员）
+func (sess *AgentBot) ListTenantWebhookBots(ctx context.Context, tenantID string) ([]*AgentBot, error) {
+	return sess.findBots(ctx, bson.M{
+		BotFieldTenantID:   tenantID,
+		BotFieldUserID:     bson.M{"$gt": ""},
+		BotFieldStatus:     BotStatusEnabled,
+		BotFieldWebhookURL: bson.M{"$gt": ""},
+	})
+}
+
+func (sess *AgentBot) findBots(ctx context.Context, filter bson.M) ([]*AgentBot, error) {
+	cur, err := sess.Collection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var list []*AgentBot
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
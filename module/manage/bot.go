@@ -0,0 +1,38 @@
+package manage
+
+import (
+	"PProject/global"
+	"PProject/global/config"
+	"PProject/logger"
+	chatService "PProject/module/chat/service"
+	"PProject/tools/errs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GrantBotIntentsParams struct {
+	BotUserID         string `json:"bot_user_id"`
+	PrivilegedIntents int64  `json:"privileged_intents"` // 开通后的完整集合，必须是申请过的子集；0 收回全部
+}
+
+// HandlerGrantBotIntents 审批机器人的特权意图（成员/在线状态/消息内容），创建者只能申请
+func HandlerGrantBotIntents(c *gin.Context) {
+	if !requireAppManager(c) {
+		return
+	}
+	var in GrantBotIntentsParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	bot, err := chatService.GrantBotIntents(c.Request.Context(), config.GetTenantID(), in.BotUserID, in.PrivilegedIntents)
+	if err != nil {
+		logger.Errorf("grant bot intents bot=%s intents=%d err=%v", in.BotUserID, in.PrivilegedIntents, err)
+		c.JSON(http.StatusOK, errs.ErrArgs.WrapMsg(err.Error()))
+		return
+	}
+	logger.Infof("grant bot intents bot=%s intents=%d", in.BotUserID, in.PrivilegedIntents)
+	c.JSON(http.StatusOK, global.Sucess(bot))
+}
@@ -0,0 +1,110 @@
+package manage
+
+import (
+	"PProject/global"
+	"PProject/logger"
+	usermodel "PProject/module/user/model"
+	"PProject/service/dispatcher/kafka"
+	"PProject/tools/errs"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 死信运维接口：只对应用管理员开放（User.AppMangerLevel >= 1）
+
+const (
+	dlqDefaultLimit = 50
+	dlqMaxLimit     = 500
+	dlqReadTimeout  = 10 * time.Second
+)
+
+type ListDLQParams struct {
+	Topic     string `json:"topic"`     // 原 topic 或死信 topic（xxx.dlq）
+	Partition int32  `json:"partition"` // -1 表示所有分区
+	Offset    int64  `json:"offset"`    // 起始 offset，0 表示从最早
+	Limit     int    `json:"limit"`
+}
+
+type ReplayDLQParams struct {
+	Topic      string `json:"topic"`
+	Partition  int32  `json:"partition"`
+	FromOffset int64  `json:"from_offset"`
+	ToOffset   int64  `json:"to_offset"` // 闭区间
+}
+
+// requireAppManager 校验登录用户是应用管理员
+func requireAppManager(c *gin.Context) bool {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return false
+	}
+	u := usermodel.User{}
+	users, err := u.ListUsersByIDs(c.Request.Context(), []string{authInfo.UserId})
+	if err != nil {
+		logger.Errorf("load user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, errs.ErrInternalServer)
+		return false
+	}
+	if len(users) == 0 || users[0].AppMangerLevel < 1 {
+		c.JSON(http.StatusOK, errs.ErrNoPermission)
+		return false
+	}
+	return true
+}
+
+// HandlerListDLQ 查看死信
+func HandlerListDLQ(c *gin.Context) {
+	if !requireAppManager(c) {
+		return
+	}
+	var in ListDLQParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.Topic == "" {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+	if in.Limit <= 0 {
+		in.Limit = dlqDefaultLimit
+	}
+	if in.Limit > dlqMaxLimit {
+		in.Limit = dlqMaxLimit
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), dlqReadTimeout)
+	defer cancel()
+	list, err := kafka.InspectDLQ(ctx, in.Topic, in.Partition, in.Offset, in.Limit)
+	if err != nil {
+		logger.Errorf("inspect dlq topic=%s err=%v", in.Topic, err)
+		c.JSON(http.StatusOK, errs.ErrInternalServer.WrapMsg(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, global.Sucess(list))
+}
+
+// HandlerReplayDLQ 把一段死信回放到原 topic
+func HandlerReplayDLQ(c *gin.Context) {
+	if !requireAppManager(c) {
+		return
+	}
+	var in ReplayDLQParams
+	if err := c.ShouldBindJSON(&in); err != nil || in.Topic == "" || in.Partition < 0 ||
+		in.ToOffset < in.FromOffset || in.ToOffset-in.FromOffset >= dlqMaxLimit {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), dlqReadTimeout)
+	defer cancel()
+	n, err := kafka.ReplayDLQ(ctx, in.Topic, in.Partition, in.FromOffset, in.ToOffset)
+	if err != nil {
+		logger.Errorf("replay dlq topic=%s partition=%d [%d,%d] replayed=%d err=%v",
+			in.Topic, in.Partition, in.FromOffset, in.ToOffset, n, err)
+		c.JSON(http.StatusOK, errs.ErrInternalServer.WrapMsg(err.Error()))
+		return
+	}
+	logger.Infof("replay dlq topic=%s partition=%d [%d,%d] replayed=%d", in.Topic, in.Partition, in.FromOffset, in.ToOffset, n)
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"replayed": n}))
+}
@@ -1,6 +1,14 @@
 package model
 
-import "time"
+import (
+	"PProject/service/mgo"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
 type Tenant struct {
 	TenantID      string       `bson:"tenant_id"` // PK
@@ -10,6 +18,7 @@ type Tenant struct {
 	Status        int32        `bson:"status"`         // 0=normal,1=suspended,2=closed
 	RetentionDays int32        `bson:"retention_days"` // 消息留存
 	Limits        TenantLimits `bson:"limits"`         // 并发/群成员上限/文件大小等
+	Policy        TenantPolicy `bson:"policy"`         // 业务策略
 	Ex            string       `bson:"ex"`             // 扩展
 	CreateTime    time.Time    `bson:"create_time"`
 	UpdateTime    time.Time    `bson:"update_time"`
@@ -20,3 +29,28 @@ type TenantLimits struct {
 	MaxUploadMB     int32 `bson:"max_upload_mb"`
 	MaxConnPerAgent int32 `bson:"max_conn_per_agent"`
 }
+
+type TenantPolicy struct {
+	FriendOnlyP2P bool `bson:"friend_only_p2p"` // 单聊只允许好友之间发送
+}
+
+func (sess *Tenant) GetTableName() string {
+	return "tenant"
+}
+
+func (sess *Tenant) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// GetTenantByID 根据 TenantID 查询租户
+func (sess *Tenant) GetTenantByID(ctx context.Context, tenantID string) (*Tenant, error) {
+	var t Tenant
+	err := sess.Collection().FindOne(ctx, bson.M{"tenant_id": tenantID}).Decode(&t)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil // 没找到
+		}
+		return nil, err
+	}
+	return &t, nil
+}
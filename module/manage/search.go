@@ -0,0 +1,32 @@
+package manage
+
+import (
+	"PProject/global"
+	"PProject/global/config"
+	"PProject/logger"
+	chatService "PProject/module/chat/service"
+	"PProject/tools/errs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RebuildSearchParams struct {
+	ConversationID string `json:"conversation_id"` // 为空重建整个租户
+}
+
+// HandlerRebuildSearchIndex 从消息表重建检索索引（分词规则调整后、索引丢失时用），后台执行，立即返回
+func HandlerRebuildSearchIndex(c *gin.Context) {
+	if !requireAppManager(c) {
+		return
+	}
+	var in RebuildSearchParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	started, n := chatService.RebuildSearchIndex(config.GetTenantID(), in.ConversationID)
+	logger.Infof("rebuild search index conv=%s started=%v indexed=%d", in.ConversationID, started, n)
+	c.JSON(http.StatusOK, global.Sucess(gin.H{"started": started, "indexed": n}))
+}
@@ -0,0 +1,85 @@
+package message
+
+import (
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	chatService "PProject/module/chat/service"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	botWebhookPollInterval  = 500 * time.Millisecond
+	botWebhookBatchSize     = 100
+	botWebhookConcurrent    = 16               // 同时进行的投递数，慢机器人不拖住其它机器人
+	botWebhookTimeout       = 5 * time.Second  // 单次 POST 超时
+	botWebhookLease         = 30 * time.Second // 领取后这么久没有结果，视为投递进程已宕机，可被重新领取
+	botWebhookMaxAttempts   = 8
+	botWebhookRetryBase     = 2 * time.Second
+	botWebhookRetryMaxDelay = 10 * time.Minute
+)
+
+var botWebhookClient = chatService.NewBotWebhookClient(botWebhookTimeout)
+
+// StartBotWebhookDispatcher 把待投递的机器人事件 POST 到机器人的 Webhook，失败按指数退避重试
+// 每个数据节点都可以跑：通过租约领取，同一条事件同一时刻只有一个节点在投递
+func StartBotWebhookDispatcher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(botWebhookPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runBotWebhookOnce(ctx)
+			}
+		}
+	}()
+}
+
+func runBotWebhookOnce(ctx context.Context) {
+	dm := chatModel.BotWebhookDelivery{}
+	sem := make(chan struct{}, botWebhookConcurrent)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < botWebhookBatchSize; i++ {
+		now := time.Now()
+		d, err := dm.ClaimPendingBotWebhook(ctx, now.UnixMilli(), now.Add(botWebhookLease).UnixMilli())
+		if err != nil {
+			logger.Errorf("claim bot webhook error: %s", err)
+			return
+		}
+		if d == nil {
+			return
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			deliverBotWebhook(ctx, d)
+		}()
+	}
+}
+
+func deliverBotWebhook(ctx context.Context, d *chatModel.BotWebhookDelivery) {
+	dm := chatModel.BotWebhookDelivery{}
+	permanent, err := chatService.DeliverBotWebhook(ctx, botWebhookClient, d)
+	if err == nil {
+		if err := dm.MarkBotWebhookSent(ctx, d.ID); err != nil {
+			logger.Errorf("bot webhook:%v mark sent error: %s", d.ID.Hex(), err)
+		}
+		return
+	}
+
+	failed := permanent || d.Attempts >= botWebhookMaxAttempts
+	delay := botWebhookRetryBase << uint(d.Attempts)
+	if delay <= 0 || delay > botWebhookRetryMaxDelay {
+		delay = botWebhookRetryMaxDelay
+	}
+	logger.Errorf("bot webhook:%v bot:%v event:%v attempt:%d error: %s", d.ID.Hex(), d.BotUserID, d.EventType, d.Attempts, err)
+	if err := dm.RetryBotWebhook(ctx, d.ID, time.Now().Add(delay).UnixMilli(), err.Error(), failed); err != nil {
+		logger.Errorf("bot webhook:%v requeue error: %s", d.ID.Hex(), err)
+	}
+}
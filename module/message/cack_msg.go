@@ -2,6 +2,7 @@ package message
 
 import (
 	pb "PProject/gen/message"
+	"PProject/global/config"
 	"PProject/logger"
 	chatmodel "PProject/module/chat/model"
 	"PProject/module/chat/service"
@@ -27,14 +28,14 @@ func HandlerCAckTopicMessage(topic string, key, value []byte) error {
 			if message != nil {
 				seq := msg.GetPayload().Seq
 				conversation := chatmodel.Conversation{}
-				minSeq, err := conversation.UpdateMinSeq(ctx, "tenant_001", message.ConversationID, seq)
+				minSeq, err := conversation.UpdateMinSeq(ctx, config.GetTenantID(), message.ConversationID, seq)
 				if err != nil {
 					return err
 				}
 				logger.Infof("topic key :%v Update min seq:%v", topic, minSeq)
 
 				c := chatmodel.Conversation{}
-				conv, err := c.GetConversationByID(ctx, "tenant_001", message.ConversationID)
+				conv, err := c.GetConversationByID(ctx, config.GetTenantID(), message.ConversationID)
 				if err != nil {
 					return err
 				}
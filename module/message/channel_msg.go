@@ -0,0 +1,166 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	seq2 "PProject/module/chat/seq"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	ka "PProject/service/dispatcher/kafka"
+	"PProject/service/mgo"
+	online "PProject/service/storage"
+	"PProject/service/storage/redis"
+	util "PProject/tools"
+	"context"
+	"fmt"
+)
+
+// handleChannelMessage 广播频道（GroupType=3）：读扩散
+// 整个频道只有一条消息流，落库一次；不写成员会话、不进离线队列、不推送，
+// 在线下发按频道路由给每个网关发一帧，订阅者的未读由已读游标和频道水位现算
+// serverMsgID 为调用方已经通过幂等占住的 ID
+func handleChannelMessage(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData, tenantID string, system bool, serverMsgID string) error {
+	payload := msg.GetPayload()
+	channelID := payload.GetGroupId()
+
+	if system {
+		kind := msg.GetMeta()[chat.MetaSystemNotify]
+		chatService.RefreshChannelSubscribers(ctx, kind, payload)
+		// 成员进出/禁言之类的通知不在频道里广播
+		if chatService.ChannelSilentNotify(kind) {
+			return nil
+		}
+	}
+
+	return handleStreamMessage(ctx, topic, key, msg, &streamTarget{
+		tenantID:  tenantID,
+		convID:    seq2.ChannelConvID(channelID),
+		channelID: channelID,
+		route:     channelID,
+		system:    system,
+		reserved:  true,
+		serverID:  serverMsgID,
+	})
+}
+
+// streamTarget 读扩散消息流：落在哪个会话、按哪个路由广播
+type streamTarget struct {
+	tenantID  string
+	convID    string
+	channelID string // 消息上的 channel_id / recv_id
+	route     string // 频道路由键：广播频道为群ID，服务器频道为服务器ID
+	system    bool
+	reserved  bool // 调用方已经做过幂等，serverID 为占住的 server_msg_id
+	serverID  string
+}
+
+// handleStreamMessage 读扩散消息流的公共链路：幂等 -> 分配 seq -> 落库一次 -> 按网关广播 -> 回执
+func handleStreamMessage(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData, st *streamTarget) error {
+	tenantID, convID := st.tenantID, st.convID
+	if _, err := seq2.EnsureSeqConversationByID(ctx, tenantID, convID); err != nil {
+		return err
+	}
+
+	serverMsgID := st.serverID
+	if !st.reserved {
+		sid, dup, err := reserveServerMsgID(ctx, tenantID, convID, msg)
+		if err != nil {
+			return err
+		}
+		if dup != nil {
+			if st.system {
+				return nil
+			}
+			return ackDuplicate(ctx, topic, key, msg, dup)
+		}
+		serverMsgID = sid
+	}
+
+	alloc := &seq2.Allocator{
+		Rdb:      redis.GetRedis(),
+		DAO:      &seq2.DAO{DB: mgo.GetDB()},
+		MaxRetry: 5,
+	}
+	start, _, err := alloc.Malloc(ctx, tenantID, convID, 1)
+	if err != nil {
+		return err
+	}
+
+	newMsg, err := chatService.BuildMessageModelFromPB(tenantID, msg.GetPayload(), start, convID)
+	if err != nil {
+		logger.Errorf("topic key:%v build stream msg error: %s", topic, err)
+		return err
+	}
+	if serverMsgID != "" {
+		newMsg.ServerMsgID = serverMsgID
+	}
+	newMsg.DedupID = msg.GetDedupId()
+	newMsg.RecvID = st.channelID
+	newMsg.ChannelID = st.channelID
+	newMsg.SessionType = chatModel.SUPER_GROUP
+
+	// 广播帧和发送回执和消息、seq 水位在同一个事务里写进 outbox，提交后直接发布
+	events, err := channelBroadcastEvents(ctx, tenantID, newMsg.ServerMsgID, key, st.route, chatService.BuildPBFromMessageModel(newMsg), msg)
+	if err != nil {
+		// 订阅者能按游标拉历史补齐，路由查不到不挡住落库
+		logger.Errorf("topic key:%v stream:%v broadcast route error: %s", topic, st.route, err)
+		events = nil
+	}
+	if !st.system {
+		ack, err := ackToSenderEvent(ctx, tenantID, topic, key, msg, newMsg.ServerMsgID, newMsg.Seq)
+		if err != nil {
+			return err
+		}
+		if ack != nil {
+			events = append(events, ack)
+		}
+	}
+	events, err = persistMessageTx(ctx, newMsg, func(context.Context) ([]*chatModel.OutboxEvent, error) {
+		return events, nil
+	})
+	if err != nil {
+		if dup := duplicateOnInsert(ctx, tenantID, convID, msg, err); dup != nil {
+			if st.system {
+				return nil
+			}
+			return ackDuplicate(ctx, topic, key, msg, dup)
+		}
+		logger.Errorf("topic key:%v persist stream msg error: %s", topic, err)
+		return err
+	}
+	publishOutbox(ctx, events)
+
+	if err := chatService.IndexMessageSearch(ctx, tenantID, newMsg); err != nil {
+		logger.Errorf("topic key:%v IndexMessageSearch error: %s", topic, err)
+	}
+
+	if st.system {
+		return nil
+	}
+	chatService.NotifyBotMessage(ctx, tenantID, newMsg)
+	return nil
+}
+
+// channelBroadcastEvents 给频道路由里的每个网关生成一帧（不发送），用于写进 outbox
+func channelBroadcastEvents(ctx context.Context, tenantID, aggregateID string, key []byte, channelID string, md *pb.MessageData, req *pb.MessageFrameData) ([]*chatModel.OutboxEvent, error) {
+	gateways, err := online.ListChannelGateways(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).ReceiveTopicKeys(false)
+	events := make([]*chatModel.OutboxEvent, 0, len(gateways))
+	for _, gateway := range gateways {
+		frame := chat.BuildChannelBroadcast(gateway, channelID, md, req)
+		if v := req.GetMeta()[chat.MetaSystemNotify]; v != "" {
+			frame.Meta[chat.MetaSystemNotify] = v
+		}
+		value, err := util.EncodeFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+		topicKey := fmt.Sprintf("%v_%v", gateway, ka.SelectCAckTopicByUser(channelID, keys))
+		events = append(events, chatModel.NewOutboxEvent(tenantID, aggregateID, topicKey, string(key), value))
+	}
+	return events, nil
+}
@@ -0,0 +1,124 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	"PProject/service/storage/redis"
+	"PProject/tools/ids"
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 幂等窗口里的键：client_msg_id 和帧上的 dedup_id 分开存，任意一个命中都算重复
+const (
+	dedupKeyClientMsg = "c:"
+	dedupKeyFrame     = "d:"
+)
+
+var (
+	msgIndexOnce sync.Once
+	msgIndex     *ClientMsgIndex
+)
+
+// 查已落库的原消息（测试里换成内存实现）
+var (
+	getMessageByServerMsgID = chatModel.GetMessageByServerMsgID
+	getMessageByClientMsgID = chatModel.GetMessageByClientMsgID
+	getMessageByDedupID     = chatModel.GetMessageByDedupID
+)
+
+// clientMsgIndex redis 在启动配置后才可用，首次使用时再构造
+func clientMsgIndex() *ClientMsgIndex {
+	msgIndexOnce.Do(func() {
+		msgIndex = NewClientMsgIndex(redis.GetRedis(), WithSIDGenerator(ids.GenerateString))
+	})
+	return msgIndex
+}
+
+func dedupKeys(msg *pb.MessageFrameData) []string {
+	var keys []string
+	if cid := msg.GetPayload().GetClientMsgId(); cid != "" {
+		keys = append(keys, dedupKeyClientMsg+cid)
+	}
+	if did := msg.GetDedupId(); did != "" {
+		keys = append(keys, dedupKeyFrame+did)
+	}
+	return keys
+}
+
+// reserveServerMsgID 分配 seq 之前占住 server_msg_id：
+// - dup != nil：这条消息已经落过库（Kafka 重投/客户端重发），直接回原来的回执，不再分配 seq
+// - 否则返回本次要用的 server_msg_id（上次处理到一半中断时沿用上次占住的 ID）；没有幂等键时返回空
+func reserveServerMsgID(ctx context.Context, tenantID, convID string, msg *pb.MessageFrameData) (serverMsgID string, dup *chatModel.MessageModel, err error) {
+	keys := dedupKeys(msg)
+	if len(keys) == 0 {
+		return "", nil, nil
+	}
+
+	idx := clientMsgIndex()
+	proposed := ids.GenerateString()
+	var reserved []string
+	for _, k := range keys {
+		sid, existed, err := idx.Ensure(ctx, tenantID, msg.From, k, proposed)
+		if err != nil {
+			// 幂等窗口不可用：退回到按 client_msg_id/dedup_id 查库，唯一索引兜底
+			logger.Errorf("client msg index ensure key=%s err=%v", k, err)
+			return findDuplicate(ctx, tenantID, convID, msg)
+		}
+		if existed && sid != proposed {
+			reserved = append(reserved, sid)
+		}
+	}
+
+	for _, sid := range reserved {
+		m, err := getMessageByServerMsgID(ctx, sid)
+		if err != nil {
+			return "", nil, err
+		}
+		if m != nil {
+			return "", m, nil
+		}
+	}
+	if len(reserved) > 0 {
+		return reserved[0], nil, nil
+	}
+	return proposed, nil, nil
+}
+
+// findDuplicate 按 client_msg_id、dedup_id 查库（幂等窗口不可用/插入撞唯一索引时兜底）
+func findDuplicate(ctx context.Context, tenantID, convID string, msg *pb.MessageFrameData) (string, *chatModel.MessageModel, error) {
+	if cid := msg.GetPayload().GetClientMsgId(); cid != "" {
+		m, err := getMessageByClientMsgID(ctx, tenantID, convID, cid)
+		if err != nil || m != nil {
+			return "", m, err
+		}
+	}
+	if did := msg.GetDedupId(); did != "" {
+		m, err := getMessageByDedupID(ctx, tenantID, convID, did)
+		return "", m, err
+	}
+	return "", nil, nil
+}
+
+// duplicateOnInsert 插入撞唯一索引时，确认是不是同一条消息（client_msg_id 或 dedup_id 相同）
+func duplicateOnInsert(ctx context.Context, tenantID, convID string, msg *pb.MessageFrameData, insertErr error) *chatModel.MessageModel {
+	if !mongo.IsDuplicateKeyError(insertErr) {
+		return nil
+	}
+	_, m, err := findDuplicate(ctx, tenantID, convID, msg)
+	if err != nil {
+		logger.Errorf("find duplicate msg client_msg_id=%s dedup_id=%s err=%v", msg.GetPayload().GetClientMsgId(), msg.GetDedupId(), err)
+		return nil
+	}
+	return m
+}
+
+// ackDuplicate 重复消息：用原来的 server_msg_id/seq 回成功回执
+func ackDuplicate(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData, dup *chatModel.MessageModel) error {
+	logger.Infof("topic key:%v duplicate msg client_msg_id=%s dedup_id=%s server_msg_id=%s seq=%d",
+		topic, msg.GetPayload().GetClientMsgId(), msg.GetDedupId(), dup.ServerMsgID, dup.Seq)
+	return sendAckToSender(ctx, topic, key, msg, dup.ServerMsgID, dup.Seq)
+}
@@ -0,0 +1,150 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	chatModel "PProject/module/chat/model"
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fakeMessages 代替消息表：按 server_msg_id/client_msg_id/dedup_id 查原消息
+type fakeMessages []*chatModel.MessageModel
+
+func (f *fakeMessages) install(t *testing.T) {
+	t.Helper()
+	bySID, byCID, byDID := getMessageByServerMsgID, getMessageByClientMsgID, getMessageByDedupID
+	t.Cleanup(func() {
+		getMessageByServerMsgID, getMessageByClientMsgID, getMessageByDedupID = bySID, byCID, byDID
+	})
+	find := func(match func(m *chatModel.MessageModel) bool) (*chatModel.MessageModel, error) {
+		for _, m := range *f {
+			if match(m) {
+				return m, nil
+			}
+		}
+		return nil, nil
+	}
+	getMessageByServerMsgID = func(_ context.Context, sid string) (*chatModel.MessageModel, error) {
+		return find(func(m *chatModel.MessageModel) bool { return m.ServerMsgID == sid })
+	}
+	getMessageByClientMsgID = func(_ context.Context, tenantID, convID, cid string) (*chatModel.MessageModel, error) {
+		return find(func(m *chatModel.MessageModel) bool {
+			return m.TenantID == tenantID && m.ConversationID == convID && m.ClientMsgID == cid
+		})
+	}
+	getMessageByDedupID = func(_ context.Context, tenantID, convID, did string) (*chatModel.MessageModel, error) {
+		return find(func(m *chatModel.MessageModel) bool {
+			return m.TenantID == tenantID && m.ConversationID == convID && m.DedupID == did
+		})
+	}
+}
+
+// useMsgIndex 幂等窗口换成独立的内存 Redis；down=true 时模拟 Redis 不可用
+func useMsgIndex(t *testing.T, down bool) {
+	t.Helper()
+	srv, err := redis2.StartMemoryServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := srv.NewClient()
+	if down {
+		_ = srv.Close()
+	}
+	msgIndexOnce.Do(func() {})
+	old := msgIndex
+	msgIndex = NewClientMsgIndex(rdb)
+	t.Cleanup(func() {
+		msgIndex = old
+		_ = rdb.Close()
+		_ = srv.Close()
+	})
+}
+
+func dataFrame(clientMsgID, dedupID string) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:    pb.MessageFrameData_DATA,
+		From:    "u1",
+		To:      "u2",
+		DedupId: dedupID,
+		Body:    &pb.MessageFrameData_Payload{Payload: &pb.MessageData{ClientMsgId: clientMsgID}},
+	}
+}
+
+func TestReserveServerMsgID(t *testing.T) {
+	useMsgIndex(t, false)
+	store := &fakeMessages{}
+	store.install(t)
+	ctx := context.Background()
+
+	if sid, dup, err := reserveServerMsgID(ctx, "t1", "c1", dataFrame("", "")); sid != "" || dup != nil || err != nil {
+		t.Fatalf("no dedup keys: sid=%q dup=%v err=%v", sid, dup, err)
+	}
+
+	msg := dataFrame("cid-1", "did-1")
+	sid, dup, err := reserveServerMsgID(ctx, "t1", "c1", msg)
+	if err != nil || dup != nil || sid == "" {
+		t.Fatalf("first reserve: sid=%q dup=%v err=%v", sid, dup, err)
+	}
+
+	// 上次处理到一半中断（没落库）：沿用占住的 ID
+	again, dup, err := reserveServerMsgID(ctx, "t1", "c1", msg)
+	if err != nil || dup != nil || again != sid {
+		t.Fatalf("resume: sid=%q want %q dup=%v err=%v", again, sid, dup, err)
+	}
+
+	// 落库后重投：回原消息
+	*store = append(*store, &chatModel.MessageModel{TenantID: "t1", ConversationID: "c1", ServerMsgID: sid, ClientMsgID: "cid-1", DedupID: "did-1", Seq: 7})
+	_, dup, err = reserveServerMsgID(ctx, "t1", "c1", msg)
+	if err != nil || dup == nil || dup.ServerMsgID != sid {
+		t.Fatalf("replay: dup=%v err=%v", dup, err)
+	}
+
+	// 只带 dedup_id 的重投也能识别
+	_, dup, err = reserveServerMsgID(ctx, "t1", "c1", dataFrame("", "did-1"))
+	if err != nil || dup == nil || dup.Seq != 7 {
+		t.Fatalf("replay by dedup_id: dup=%v err=%v", dup, err)
+	}
+}
+
+func TestReserveFallsBackWhenRedisDown(t *testing.T) {
+	useMsgIndex(t, true)
+	store := &fakeMessages{{TenantID: "t1", ConversationID: "c1", ServerMsgID: "s1", DedupID: "did-1"}}
+	store.install(t)
+	ctx := context.Background()
+
+	_, dup, err := reserveServerMsgID(ctx, "t1", "c1", dataFrame("", "did-1"))
+	if err != nil || dup == nil || dup.ServerMsgID != "s1" {
+		t.Fatalf("fallback by dedup_id: dup=%v err=%v", dup, err)
+	}
+	if sid, dup, err := reserveServerMsgID(ctx, "t1", "c1", dataFrame("cid-new", "")); sid != "" || dup != nil || err != nil {
+		t.Fatalf("fallback new msg: sid=%q dup=%v err=%v", sid, dup, err)
+	}
+}
+
+func TestDuplicateOnInsert(t *testing.T) {
+	store := &fakeMessages{
+		{TenantID: "t1", ConversationID: "c1", ServerMsgID: "s1", ClientMsgID: "cid-1"},
+		{TenantID: "t1", ConversationID: "c1", ServerMsgID: "s2", DedupID: "did-2"},
+	}
+	store.install(t)
+	ctx := context.Background()
+	dupKey := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key"}}}
+
+	if m := duplicateOnInsert(ctx, "t1", "c1", dataFrame("cid-1", ""), dupKey); m == nil || m.ServerMsgID != "s1" {
+		t.Fatalf("race by client_msg_id: %v", m)
+	}
+	// 服务端代发（机器人/定时消息）只有 dedup_id
+	if m := duplicateOnInsert(ctx, "t1", "c1", dataFrame("", "did-2"), dupKey); m == nil || m.ServerMsgID != "s2" {
+		t.Fatalf("race by dedup_id: %v", m)
+	}
+	if m := duplicateOnInsert(ctx, "t1", "c1", dataFrame("", "did-2"), errors.New("boom")); m != nil {
+		t.Fatalf("non duplicate-key error: %v", m)
+	}
+	if m := duplicateOnInsert(ctx, "t1", "c1", dataFrame("cid-x", "did-x"), dupKey); m != nil {
+		t.Fatalf("unknown message: %v", m)
+	}
+}
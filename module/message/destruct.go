@@ -0,0 +1,90 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	"context"
+	"time"
+)
+
+const (
+	destructPollInterval = time.Second
+	destructBatchSize    = 200
+	destructRetryDelay   = 30 * time.Second
+)
+
+// StartDestructScheduler 数据节点上的消息销毁调度：轮询销毁队列，到期的消息删内容留墓碑，并通知会话内所有端
+// 多个数据节点可以同时运行，到期项由 Redis 脚本原子取出，不会重复处理
+func StartDestructScheduler(ctx context.Context) {
+	go func() {
+		if err := chatService.ReconcileDestructQueue(ctx); err != nil {
+			logger.Errorf("destruct queue reconcile error: %s", err)
+		}
+
+		ticker := time.NewTicker(destructPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runDestructOnce(ctx)
+			}
+		}
+	}()
+}
+
+// runDestructOnce 一次把到期项处理完（每批 destructBatchSize 条）
+func runDestructOnce(ctx context.Context) {
+	for {
+		items, err := chatService.PopDueDestructs(ctx, time.Now().UnixMilli(), destructBatchSize)
+		if err != nil {
+			logger.Errorf("pop destruct queue error: %s", err)
+			return
+		}
+		for _, item := range items {
+			if err := destructMessage(ctx, item); err != nil {
+				logger.Errorf("destruct msg:%v error: %s", item.ServerMsgID, err)
+				if err := chatService.RetryDestruct(ctx, item, destructRetryDelay); err != nil {
+					logger.Errorf("requeue destruct msg:%v error: %s", item.ServerMsgID, err)
+				}
+			}
+		}
+		if len(items) < destructBatchSize {
+			return
+		}
+	}
+}
+
+// destructMessage 销毁单条消息并通知会话内所有成员（包括发送者的其他端）
+func destructMessage(ctx context.Context, item chatService.DestructItem) error {
+	tomb, err := chatModel.TombstoneMessage(ctx, item.TenantID, item.ServerMsgID)
+	if err != nil {
+		return err
+	}
+	if tomb == nil {
+		// 已销毁或已被删除
+		return nil
+	}
+	if err := chatService.RemoveMessageSearch(ctx, item.TenantID, tomb); err != nil {
+		logger.Errorf("destruct msg:%v remove search index error: %s", item.ServerMsgID, err)
+	}
+
+	conv := chatModel.Conversation{}
+	owners, err := conv.ListConversationOwners(ctx, item.TenantID, tomb.ConversationID)
+	if err != nil {
+		return err
+	}
+	data := chatService.BuildPBFromMessageModel(tomb)
+	_, err = deliverByGateway(ctx, []byte(tomb.ConversationID), tomb.ConversationID, owners, func(gateway string, users []string) *pb.MessageFrameData {
+		return chat.BuildMessageDestructed(gateway, item.TenantID, tomb.ConversationID, users, data)
+	})
+	if err != nil {
+		// 内容已删，通知失败时客户端靠 SYNC/历史里的墓碑对齐，不再重试
+		logger.Errorf("conv:%v destruct notify error: %s", tomb.ConversationID, err)
+	}
+	return nil
+}
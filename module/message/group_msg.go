@@ -0,0 +1,437 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/global/config"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	seq2 "PProject/module/chat/seq"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	ka "PProject/service/dispatcher/kafka"
+	"PProject/service/mgo"
+	online "PProject/service/storage"
+	"PProject/service/storage/redis"
+	util "PProject/tools"
+	errors "PProject/tools/errs"
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	groupFanoutBatchSize  = 500  // 每批处理的成员数（会话水位 + 在线路由）
+	groupLargeThreshold   = 2000 // 超过该成员数走异步分批扇出，不阻塞消费
+	groupFanoutConcurrent = 8    // 异步扇出的并发上限
+	groupFanoutTimeout    = 5 * time.Minute
+	groupFanoutLease      = 2 * time.Minute // 每处理完一批续租；这么久没进展视为执行方已丢失，由续跑任务接手
+	groupFanoutPoll       = 5 * time.Second
+	groupFanoutMaxAttempt = 5
+)
+
+// groupFanoutSem 限制同时进行的异步扇出数量；满了会阻塞消费，形成背压
+var groupFanoutSem = make(chan struct{}, groupFanoutConcurrent)
+
+// handleGroupMessage 群消息：校验 -> 一次分配 seq -> 落库一次 -> 按网关扇出；广播频道走 handleChannelMessage
+func handleGroupMessage(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData) error {
+	tenantID := config.GetTenantID()
+	payload := msg.GetPayload()
+	groupID := payload.GetGroupId()
+	senderID := msg.From
+
+	// 服务端生成的群通知：不走发言校验（群可能刚解散），操作人也要收到，不回 ACK
+	system := chatService.IsSystemNotification(msg)
+
+	gm := chatModel.Group{}
+	group, err := gm.GetGroupByID(ctx, tenantID, groupID)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		if system {
+			logger.Infof("topic key:%v group:%v not found, drop notification", topic, groupID)
+			return nil
+		}
+		return sendNackToSender(ctx, topic, key, msg, errors.ErrGroupUnavailable.WrapMsg("group not available", "group_id", groupID))
+	}
+
+	convID := seq2.GroupConvID(groupID)
+	if group.GroupType == chatModel.GroupTypeChannel {
+		convID = seq2.ChannelConvID(groupID)
+	}
+	if _, err := seq2.EnsureSeqConversationByID(ctx, tenantID, convID); err != nil {
+		return err
+	}
+
+	// 幂等放在发言校验之前：已经收下的消息重投/重发时回原来的回执，不会被禁言、慢速模式拒掉
+	serverMsgID, dup, err := reserveServerMsgID(ctx, tenantID, convID, msg)
+	if err != nil {
+		return err
+	}
+	if dup != nil {
+		if system {
+			return nil
+		}
+		return ackDuplicate(ctx, topic, key, msg, dup)
+	}
+
+	// 慢速模式最后占位，落库失败时还回去
+	release := func() {}
+	if !system {
+		err = chatService.CheckGroupMemberSend(ctx, tenantID, group, senderID, payload)
+		if err == nil {
+			err = chatService.CheckAtAllPolicy(ctx, tenantID, payload)
+		}
+		if err == nil {
+			release, err = chatService.ClaimGroupSlowMode(ctx, tenantID, group, senderID)
+		}
+		if err != nil {
+			logger.Errorf("topic key:%v reject group msg error: %s", topic, err)
+			return sendNackToSender(ctx, topic, key, msg, err)
+		}
+	}
+	persisted := false
+	defer func() {
+		if !persisted {
+			release()
+		}
+	}()
+
+	if group.GroupType == chatModel.GroupTypeChannel {
+		err := handleChannelMessage(ctx, topic, key, msg, tenantID, system, serverMsgID)
+		persisted = err == nil
+		return err
+	}
+
+	alloc := &seq2.Allocator{
+		Rdb:      redis.GetRedis(),
+		DAO:      &seq2.DAO{DB: mgo.GetDB()},
+		MaxRetry: 5,
+	}
+	start, _, err := alloc.Malloc(ctx, tenantID, convID, 1)
+	if err != nil {
+		return err
+	}
+
+	newMsg, err := chatService.BuildMessageModelFromPB(tenantID, payload, start, convID)
+	if err != nil {
+		logger.Errorf("topic key:%v build group msg error: %s", topic, err)
+		return err
+	}
+	if serverMsgID != "" {
+		newMsg.ServerMsgID = serverMsgID
+	}
+	newMsg.DedupID = msg.GetDedupId()
+	newMsg.RecvID = groupID
+	if newMsg.SessionType == chatModel.SessionTypeUnspecified {
+		newMsg.SessionType = chatModel.GROUP_CHAT
+	}
+
+	if err := chatService.ApplyDestructPolicy(ctx, tenantID, newMsg); err != nil {
+		logger.Errorf("topic key:%v ApplyDestructPolicy error: %s", topic, err)
+	}
+
+	// 发送回执先生成好，和消息、seq 水位、发送者会话在同一个事务里写进 outbox；提交后直接发布，失败由 relay 补发
+	var acks []*chatModel.OutboxEvent
+	if !system {
+		ack, err := ackToSenderEvent(ctx, tenantID, topic, key, msg, newMsg.ServerMsgID, newMsg.Seq)
+		if err != nil {
+			return err
+		}
+		if ack != nil {
+			acks = append(acks, ack)
+		}
+	}
+	// 扇出任务和消息一起提交：回执发出后扇出即使丢了（进程崩溃、后台任务中断），也能按 cursor 续跑
+	frame, err := util.EncodeFrame(msg)
+	if err != nil {
+		return err
+	}
+	job := &chatModel.GroupFanoutJob{
+		TenantID:       tenantID,
+		GroupID:        groupID,
+		ConversationID: convID,
+		ServerMsgID:    newMsg.ServerMsgID,
+		Seq:            start,
+		Key:            string(key),
+		Frame:          frame,
+		IncludeSender:  system,
+		OfflineQueue:   group.MemberCount <= groupLargeThreshold,
+	}
+	events, err := persistMessageTx(ctx, newMsg, func(ctx context.Context) ([]*chatModel.OutboxEvent, error) {
+		fj := chatModel.GroupFanoutJob{}
+		if err := fj.InsertGroupFanoutJob(ctx, job, time.Now().Add(groupFanoutLease).UnixMilli()); err != nil {
+			return nil, err
+		}
+		// 发送者自己的会话先落好，@全体 依赖会话记录，扇出前需要成员会话存在
+		if !system {
+			conv := chatModel.Conversation{}
+			if err := conv.EnsureGroupConversations(ctx, tenantID, convID, groupID, int32(seq2.ConvTypeGroup), []string{senderID}, start); err != nil {
+				return nil, err
+			}
+		}
+		return acks, nil
+	})
+	if err != nil {
+		if dup := duplicateOnInsert(ctx, tenantID, convID, msg, err); dup != nil {
+			if system {
+				return nil
+			}
+			return ackDuplicate(ctx, topic, key, msg, dup)
+		}
+		logger.Errorf("topic key:%v persist group msg error: %s", topic, err)
+		return err
+	}
+	persisted = true
+	publishOutbox(ctx, events)
+
+	if err := chatService.ScheduleDestruct(ctx, tenantID, newMsg); err != nil {
+		logger.Errorf("topic key:%v ScheduleDestruct error: %s", topic, err)
+	}
+
+	fan := newGroupFanout(job, msg, newMsg)
+	if group.MemberCount > groupLargeThreshold {
+		// 大群：消息和扇出任务已落库，扇出放到后台分批进行；中途失败由续跑任务接着做
+		groupFanoutSem <- struct{}{}
+		go func() {
+			defer func() { <-groupFanoutSem }()
+			bg, cancel := context.WithTimeout(context.Background(), groupFanoutTimeout)
+			defer cancel()
+			if err := fan.run(bg); err != nil {
+				logger.Errorf("topic key:%v group:%v async fanout error: %s", topic, groupID, err)
+			}
+		}()
+	} else if err := fan.run(ctx); err != nil {
+		logger.Errorf("topic key:%v group:%v fanout error: %s", topic, groupID, err)
+	}
+
+	if system {
+		return nil
+	}
+	// 群里的机器人通过 Webhook 收消息
+	chatService.NotifyBotMessage(ctx, tenantID, newMsg)
+	return nil
+}
+
+// groupFanout 一条群消息的扇出上下文
+type groupFanout struct {
+	tenantID string
+	groupID  string
+	convID   string
+	seq      int64
+	key      []byte
+	req      *pb.MessageFrameData
+	model    *chatModel.MessageModel
+	data     *pb.MessageData
+	job      *chatModel.GroupFanoutJob
+
+	includeSender bool // 群通知：操作人自己也要收到
+	offlineQueue  bool // 离线成员是否进离线队列
+}
+
+func newGroupFanout(job *chatModel.GroupFanoutJob, req *pb.MessageFrameData, model *chatModel.MessageModel) *groupFanout {
+	return &groupFanout{
+		tenantID: job.TenantID,
+		groupID:  job.GroupID,
+		convID:   job.ConversationID,
+		seq:      job.Seq,
+		key:      []byte(job.Key),
+		req:      req,
+		model:    model,
+		data:     chatService.BuildPBFromMessageModel(model),
+		job:      job,
+
+		includeSender: job.IncludeSender,
+		offlineQueue:  job.OfflineQueue,
+	}
+}
+
+// run 从任务的 cursor 起按 user_id 分页遍历成员：刷新会话水位（离线成员的未读也随之增加），在线成员按网关聚合下发
+// 每批处理完推进 cursor 并续租；中途出错直接返回，任务留给续跑（重跑的那一批可能重复下发，客户端按 server_msg_id 去重）
+func (f *groupFanout) run(ctx context.Context) error {
+	gm := chatModel.GroupMember{}
+	conv := chatModel.Conversation{}
+	fj := chatModel.GroupFanoutJob{}
+
+	after := f.job.Cursor
+	for {
+		members, err := gm.ListGroupMemberIDs(ctx, f.tenantID, f.groupID, after, groupFanoutBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			break
+		}
+		after = members[len(members)-1]
+
+		if err := conv.EnsureGroupConversations(ctx, f.tenantID, f.convID, f.groupID, int32(seq2.ConvTypeGroup), members, f.seq); err != nil {
+			return err
+		}
+		if err := chatService.TouchConversations(ctx, f.tenantID, f.convID, members); err != nil {
+			logger.Errorf("group:%v TouchConversations error: %s", f.groupID, err)
+		}
+
+		recipients := make([]string, 0, len(members))
+		for _, uid := range members {
+			if f.includeSender || uid != f.req.From {
+				recipients = append(recipients, uid)
+			}
+		}
+
+		offline, err := deliverByGateway(ctx, f.key, f.groupID, recipients, func(gateway string, users []string) *pb.MessageFrameData {
+			return chat.BuildGroupDeliver(gateway, users, f.data, f.req)
+		})
+		if err != nil {
+			return err
+		}
+		// 大群的离线成员不进离线队列，上线后靠会话水位 SYNC 补齐
+		if f.offlineQueue {
+			enqueueOffline(ctx, offline, f.data, f.req)
+		}
+		chatService.NotifyOfflinePush(f.tenantID, f.model, recipients, offline)
+
+		if err := fj.SaveGroupFanoutCursor(ctx, f.job.ID, after, time.Now().Add(groupFanoutLease).UnixMilli()); err != nil {
+			logger.Errorf("group:%v fanout:%v save cursor error: %s", f.groupID, f.job.ID.Hex(), err)
+		}
+		if len(members) < groupFanoutBatchSize {
+			break
+		}
+	}
+
+	// 成员会话全部就绪后再写 @ 索引（@全体 需要完整的会话记录）
+	if err := chatService.IndexMentions(ctx, f.tenantID, f.model); err != nil {
+		logger.Errorf("group:%v IndexMentions error: %s", f.groupID, err)
+	}
+	if err := chatService.IndexMessageSearch(ctx, f.tenantID, f.model); err != nil {
+		logger.Errorf("group:%v IndexMessageSearch error: %s", f.groupID, err)
+	}
+	if err := fj.FinishGroupFanoutJob(ctx, f.job.ID, "", false); err != nil {
+		logger.Errorf("group:%v fanout:%v finish error: %s", f.groupID, f.job.ID.Hex(), err)
+	}
+	return nil
+}
+
+// StartGroupFanoutResumer 续跑租约过期的扇出任务（执行方崩溃、后台扇出超时/出错）
+// 每个数据节点都可以跑：通过租约领取，同一个任务同一时刻只有一个执行方
+func StartGroupFanoutResumer(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(groupFanoutPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				resumeGroupFanouts(ctx)
+			}
+		}
+	}()
+}
+
+func resumeGroupFanouts(ctx context.Context) {
+	fj := chatModel.GroupFanoutJob{}
+	for {
+		now := time.Now()
+		job, err := fj.ClaimGroupFanoutJob(ctx, now.UnixMilli(), now.Add(groupFanoutLease).UnixMilli())
+		if err != nil {
+			logger.Errorf("claim group fanout error: %s", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		resumeGroupFanout(ctx, job)
+	}
+}
+
+func resumeGroupFanout(ctx context.Context, job *chatModel.GroupFanoutJob) {
+	fj := chatModel.GroupFanoutJob{}
+	req, err := util.DecodeFrame(job.Frame)
+	if err != nil {
+		_ = fj.FinishGroupFanoutJob(ctx, job.ID, "decode frame: "+err.Error(), true)
+		return
+	}
+	model, err := getMessageByServerMsgID(ctx, job.ServerMsgID)
+	if err != nil {
+		logger.Errorf("group:%v fanout:%v load message error: %s", job.GroupID, job.ID.Hex(), err)
+		return
+	}
+	if model == nil {
+		// 消息已被删除/销毁，没什么可扇出的
+		_ = fj.FinishGroupFanoutJob(ctx, job.ID, "message not found", true)
+		return
+	}
+
+	logger.Infof("group:%v fanout:%v resume after:%q attempt:%d", job.GroupID, job.ID.Hex(), job.Cursor, job.Attempts)
+	runCtx, cancel := context.WithTimeout(ctx, groupFanoutTimeout)
+	defer cancel()
+	if err := newGroupFanout(job, req, model).run(runCtx); err != nil {
+		logger.Errorf("group:%v fanout:%v resume error: %s", job.GroupID, job.ID.Hex(), err)
+		if job.Attempts >= groupFanoutMaxAttempt {
+			_ = fj.FinishGroupFanoutJob(ctx, job.ID, err.Error(), true)
+		}
+	}
+}
+
+// deliverByGateway 把在线用户按网关聚合，每个网关发一帧（帧内带接收者列表），selector 用来选网关下的 topic 分区
+// 返回不在线的用户，由调用方决定是否进离线队列
+func deliverByGateway(ctx context.Context, key []byte, selector string, users []string, build func(gateway string, users []string) *pb.MessageFrameData) (offline []string, err error) {
+	events, offline, err := gatewayDeliveries(ctx, "", "", key, selector, users, build)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		if err := MessageProducerHandler(e.Topic, e.Key, e.Value); err != nil {
+			logger.Errorf("selector:%v topic:%v deliver error: %s", selector, e.Topic, err)
+		}
+	}
+	return offline, nil
+}
+
+// gatewayDeliveries 只生成每个网关要发的帧（不发送），用于写进 outbox；aggregateID 为关联的 server_msg_id
+func gatewayDeliveries(ctx context.Context, tenantID, aggregateID string, key []byte, selector string, users []string, build func(gateway string, users []string) *pb.MessageFrameData) (events []*chatModel.OutboxEvent, offline []string, err error) {
+	byGateway, offline, err := online.GetManager().GroupUsersByGateway(ctx, users)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).ReceiveTopicKeys(false)
+	for gateway, gwUsers := range byGateway {
+		value, err := util.EncodeFrame(build(gateway, gwUsers))
+		if err != nil {
+			return nil, nil, err
+		}
+		topicKey := fmt.Sprintf("%v_%v", gateway, ka.SelectCAckTopicByUser(selector, keys))
+		events = append(events, chatModel.NewOutboxEvent(tenantID, aggregateID, topicKey, string(key), value))
+	}
+	return events, offline, nil
+}
+
+// sendAckToSender 给发送者回发送成功回执（带上服务端 ID 和 seq）
+func sendAckToSender(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData, serverMsgID string, seq int64) error {
+	e, err := ackToSenderEvent(ctx, "", topic, key, msg, serverMsgID, seq)
+	if err != nil || e == nil {
+		return err
+	}
+	return MessageProducerHandler(e.Topic, e.Key, e.Value)
+}
+
+// ackToSenderEvent 生成发送成功回执（不发送）；发送者不在线时返回 nil
+func ackToSenderEvent(ctx context.Context, tenantID, topic string, key []byte, msg *pb.MessageFrameData, serverMsgID string, seq int64) (*chatModel.OutboxEvent, error) {
+	gateway, err := online.GetManager().GetUserGateway(ctx, msg.From)
+	if err != nil || gateway == "" {
+		logger.Infof("topic key:%v sender %v offline, drop ack", topic, msg.From)
+		return nil, nil
+	}
+
+	deliverMsg := chat.BuildSendSuccessAckDeliver(msg.From, msg.GetPayload().GetClientMsgId(), serverMsgID, msg)
+	deliverMsg.GetPayload().Seq = seq
+	data, err := util.EncodeFrame(deliverMsg)
+	if err != nil {
+		logger.Errorf("topic key:%v encode deliver msg error: %s", topic, err)
+		return nil, err
+	}
+
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).ReceiveTopicKeys(false)
+	topicKey := fmt.Sprintf("%v_%v", gateway, ka.SelectCAckTopicByUser(msg.From, keys))
+	return chatModel.NewOutboxEvent(tenantID, serverMsgID, topicKey, string(key), data), nil
+}
@@ -0,0 +1,30 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/global/config"
+	"PProject/logger"
+	seq2 "PProject/module/chat/seq"
+	chatService "PProject/module/chat/service"
+	"context"
+)
+
+// handleGuildMessage 服务器频道消息：按频道权限校验后走读扩散消息流
+// 会话为 chan:<channel_id>，按服务器路由广播，网关再按查看频道权限过滤接收者
+func handleGuildMessage(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData) error {
+	tenantID := config.GetTenantID()
+	payload := msg.GetPayload()
+
+	ch, err := chatService.CheckGuildSend(ctx, tenantID, msg.From, payload)
+	if err != nil {
+		logger.Errorf("topic key:%v reject guild msg error: %s", topic, err)
+		return sendNackToSender(ctx, topic, key, msg, err)
+	}
+
+	return handleStreamMessage(ctx, topic, key, msg, &streamTarget{
+		tenantID:  tenantID,
+		convID:    seq2.ChannelConvID(ch.ChannelID),
+		channelID: ch.ChannelID,
+		route:     ch.GuildID,
+	})
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	pb "PProject/gen/message"
 	"PProject/logger"
+	chatService "PProject/module/chat/service"
 	"PProject/service/chat"
 	online "PProject/service/storage"
 	errors "PProject/tools/errs"
@@ -66,8 +67,14 @@ func (h *AuthHandler) Run() {
 					continue
 				}
 
+				// 离线补发同样按连接声明的意图/分片过滤
+				frame, ok := h.ctx.S.ConnMgr().Filter(connID).Apply(msg.Conn.UserId, msg.Frame)
+				if !ok {
+					continue
+				}
+
 				// 序列化（一次性）
-				data, err := marshaller.Marshal(msg.Frame)
+				data, err := marshaller.Marshal(frame)
 				if err != nil {
 					logger.Infof("[AuthHandler] marshal frame failed: conn_id=%s err=%v", connID, err)
 					continue
@@ -82,6 +89,8 @@ func (h *AuthHandler) Run() {
 					h.ctx.S.ConnMgr().Remove(connID)
 					continue
 				}
+				// 补发的离线消息同样等待 CACK，超时重传
+				h.ctx.S.Qos().Track(connID, msg.Conn.UserId, msg.Frame)
 			}
 		}
 	}()
@@ -107,8 +116,18 @@ func (h *AuthHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, conn *
 		return nil
 	}
 
-	// ★ FIX：Authorize 第三参传 ConnId
+	// 声明的意图/分片/选择性订阅：校验不过直接回 NACK 断开，不登记在线
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	filter, ferr := chatService.ResolveConnFilter(ctx, ap.UserID, f.GetIntents(), f.GetShard(), ap.GuildIDs, ap.ChannelIDs)
+	cancel()
+	if ferr != nil {
+		logger.Errorf("[AuthHandler] reject intents user=%s conn=%s intents=%d: %v", ap.UserID, f.GetSessionId(), f.GetIntents(), ferr)
+		h.rejectAuth(conn, f, ap.UserID, ferr)
+		return nil
+	}
+
+	// ★ FIX：Authorize 第三参传 ConnId
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
 	_, aerr := online.GetManager().Authorize(ctx, ap.UserID, f.GetSessionId())
 	cancel()
 	if aerr != nil && !aerr.Is(&errors.ErrorRecordIsExist) {
@@ -120,10 +139,17 @@ func (h *AuthHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, conn *
 	if err != nil {
 		logger.Errorf("[AuthHandler] bind user err: %v", err)
 	}
+	// 过滤器要在回执和离线补发之前挂上
+	h.ctx.S.ConnMgr().SetFilter(f.GetSessionId(), filter)
 
 	rec := h.ctx.S.ConnMgr().GetClient(conn.Conn)
 
 	ack := chat.BuildAuthAck(f)
+	if filter != nil {
+		// 回显生效的意图/分片（未声明意图时为默认值）
+		ack.Intents = filter.Intents
+		ack.Shard = &pb.ShardInfo{ShardId: filter.ShardID, ShardCount: filter.ShardCount}
+	}
 
 	h.data <- &chat.WSConnectionMsg{
 		Frame: ack,
@@ -131,5 +157,30 @@ func (h *AuthHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, conn *
 		Req:   f,
 	}
 
+	// 鉴权回执之后补发离线消息（同一个写协程，保证先到回执再到离线消息）
+	h.drainOffline(ap.UserID, rec, f)
+
+	// 关注好友/订阅对象的在线状态，并推一次当前状态
+	if ph, ok := h.ctx.S.Disp().GetHandler(pb.MessageFrameData_PRESENCE).(*PresenceHandler); ok {
+		go ph.Watch(ap.UserID, f.GetSessionId())
+	}
+	// 订阅所在的广播频道/服务器
+	go subscribeChannels(ap.UserID, f.GetSessionId(), filter)
+
 	return nil
 }
+
+// rejectAuth 鉴权被拒：回 NACK 后断开。连接还没授权，只有连接回执写过它，这里直接写
+func (h *AuthHandler) rejectAuth(conn *chat.WsConn, f *pb.MessageFrameData, userID string, cause error) {
+	codeErr, ok := errors.Unwrap(cause).(*errors.CodeError)
+	if !ok {
+		codeErr = &errors.ErrInternalServer
+	}
+	nack := chat.BuildSendNack(userID, "", codeErr.Code, codeErr.Error(), f)
+	if data, err := protojson.Marshal(nack); err == nil {
+		if err := chat.WriteJSONWithDeadline(conn.Conn, data, 5*time.Second); err != nil {
+			logger.Infof("[AuthHandler] send auth nack failed: conn_id=%s err=%v", f.GetSessionId(), err)
+		}
+	}
+	h.ctx.S.ConnMgr().RemoveBySnow(f.GetSessionId())
+}
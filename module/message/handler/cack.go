@@ -5,6 +5,9 @@ import (
 	"PProject/logger"
 	"PProject/service/chat"
 	ka "PProject/service/dispatcher/kafka"
+	online "PProject/service/storage"
+	"context"
+	"time"
 
 	"google.golang.org/protobuf/encoding/protojson"
 )
@@ -27,6 +30,18 @@ func (h *CAckHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, conn *
 	// 判断接收者是否在线 如果不在线 就发松mq 落库 如果在线 看下 在那个节点， 找到那个节点 发送节点相关的topic
 	logger.Infof("[WS] 接收到消息  MessageFrameData_CACK =%v toUser:%v ", f.From, to)
 
+	// 至少一次下发：收到回执后停止重传
+	h.ctx.S.Qos().Ack(f.GetSessionId(), f.GetAckId(), f.GetPayload().GetServerMsgId())
+
+	// 客户端确认收到：从离线队列删除（补发的离线消息只有 CACK 后才删）
+	if msgID := f.GetPayload().GetServerMsgId(); msgID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := online.AckOffline(ctx, f.From, msgID); err != nil {
+			logger.Errorf("[CAckHandler] ack offline user=%s msg=%s err=%v", f.From, msgID, err)
+		}
+		cancel()
+	}
+
 	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_CACK).SendTopicKeys()
 	topicKey := ka.SelectCAckTopicByUser(f.To, keys)
 
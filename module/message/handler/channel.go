@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"PProject/global/config"
+	"PProject/logger"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	"context"
+	"time"
+)
+
+// StartChannelHub 网关启动广播频道订阅：鉴权后订阅、连接关闭时取消，后台续期频道路由
+func StartChannelHub(ctx *chat.ChatContext) {
+	hub := chatService.NewChannelHub(ctx.S.ConnMgr().GwId(), config.GetTenantID())
+	chatService.SetLocalChannelHub(hub)
+	ctx.S.OnConnClose(hub.Unsubscribe)
+	go hub.Run(context.Background())
+}
+
+// subscribeChannels 连接鉴权成功后调用，失败只影响频道消息的实时下发（客户端仍可拉历史）
+func subscribeChannels(userID, snowID string, filter *chat.ConnFilter) {
+	hub := chatService.LocalChannelHub()
+	if hub == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Subscribe(ctx, userID, snowID, filter); err != nil {
+		logger.Errorf("[ChannelHub] subscribe channels user=%s snowID=%s err=%v", userID, snowID, err)
+	}
+}
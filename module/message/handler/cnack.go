@@ -0,0 +1,54 @@
+package handler
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	"PProject/service/chat"
+	online "PProject/service/storage"
+	"context"
+	"time"
+)
+
+// CNACK 的 meta：reason 失败原因（render/decrypt/storage...），retry=1 表示客户端希望重发
+const (
+	cnackMetaReason = "reason"
+	cnackMetaRetry  = "retry"
+)
+
+type CNackHandler struct {
+	ctx *chat.ChatContext
+}
+
+func (h *CNackHandler) IsHandler() bool {
+	return false
+}
+
+func NewCNackHandler(ctx *chat.ChatContext) chat.Handler { return &CNackHandler{ctx: ctx} }
+
+func (h *CNackHandler) Type() pb.MessageFrameData_Type { return pb.MessageFrameData_CNACK }
+
+// Handle 客户端否定回执：要求重发的立即重传（仍受重传次数限制）；
+// 否则停止重传并从离线队列删除，避免每次上线都补发一条客户端处理不了的消息
+func (h *CNackHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, _ *chat.WsConn) error {
+	msgID := f.GetPayload().GetServerMsgId()
+	reason := f.GetMeta()[cnackMetaReason]
+	retry := f.GetMeta()[cnackMetaRetry] == "1"
+
+	frame := h.ctx.S.Qos().Nack(f.GetSessionId(), retry, f.GetAckId(), msgID)
+	logger.Infof("[CNackHandler] user=%s conn=%s msg=%s ack_id=%s reason=%s retry=%v tracked=%v",
+		f.From, f.GetSessionId(), msgID, f.GetAckId(), reason, retry, frame != nil)
+	if retry || msgID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := online.AckOffline(ctx, f.From, msgID); err != nil {
+		logger.Errorf("[CNackHandler] drop offline user=%s msg=%s err=%v", f.From, msgID, err)
+	}
+	return nil
+}
+
+func (h *CNackHandler) Run() {
+
+}
@@ -28,7 +28,7 @@ func NewConnectHandler(ctx *chat.ChatContext) chat.Handler {
 	conf := online.OnlineConfig{
 		NodeID:        ctx.S.ConnMgr().GwId(),
 		TTL:           presenceTTL,
-		ChannelName:   "online_changes",
+		ChannelName:   online.OnlineChannelName,
 		SnowflakeNode: 1,
 		UseClusterTag: true,
 		MaxSessions:   5,
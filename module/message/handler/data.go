@@ -31,6 +31,15 @@ func (h *DataHandler) Type() pb.MessageFrameData_Type { return pb.MessageFrameDa
 
 func (h *DataHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, conn *chat.WsConn) error {
 
+	// 发送者以连接上鉴权的用户为准，不信任客户端填的 from（黑名单/好友校验依赖它）
+	rec := h.ctx.S.ConnMgr().GetClient(conn.Conn)
+	if rec == nil || !rec.Authorized || rec.UserId == "" {
+		logger.Infof("[DataHandler] drop data from unauthorized conn=%s", f.GetSessionId())
+		return nil
+	}
+	f.From = rec.UserId
+	delete(f.Meta, chat.MetaSystemNotify)
+
 	to := f.To // 接收者
 	// 判断接收者是否在线 如果不在线 就发松mq 落库 如果在线 看下 在那个节点， 找到那个节点 发送节点相关的topic
 	logger.Infof("[WS] 接收到消息  fromUser =%v toUser:%v ", f.From, to)
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	pb "PProject/gen/message"
+	"PProject/global/config"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	online "PProject/service/storage"
+	util "PProject/tools"
+	"context"
+	"time"
+)
+
+const (
+	offlineDrainPage     = 200
+	offlineSyncConvLimit = 200 // 溢出改走 SYNC 时下发的会话数
+)
+
+// 溢出后下发的会话列表（测试里换成内存实现）
+var listUserConversations = func(ctx context.Context, tenantID, userID string, limit int64) ([]*chatModel.Conversation, error) {
+	cm := chatModel.Conversation{}
+	return cm.ListUserConversations(ctx, tenantID, userID, limit)
+}
+
+// drainOffline 鉴权成功后把离线队列按入队顺序补发给新连接；条目在客户端 CACK 后才删除，
+// 补发途中断线的话下次登录会再补一次（客户端按 server_msg_id 去重）
+// 队列溢出过说明已经丢了最旧的消息，这时整队丢弃，改为下发会话水位让客户端走 SYNC 补齐
+func (h *AuthHandler) drainOffline(userID string, rec *chat.WsConn, req *pb.MessageFrameData) {
+	if rec == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	overflowed, err := online.TakeOfflineOverflow(ctx, userID)
+	if err != nil {
+		logger.Errorf("[AuthHandler] offline overflow check user=%s err=%v", userID, err)
+		return
+	}
+	if overflowed {
+		h.syncAfterOverflow(ctx, userID, rec, req)
+		return
+	}
+
+	for offset := 0; offset < online.OfflineQueueCap; offset += offlineDrainPage {
+		list, err := online.FetchOffline(ctx, userID, offset, offlineDrainPage)
+		if err != nil {
+			logger.Errorf("[AuthHandler] fetch offline user=%s err=%v", userID, err)
+			return
+		}
+		for _, m := range list {
+			frame, err := util.DecodeFrame(m.Payload)
+			if err != nil {
+				logger.Errorf("[AuthHandler] decode offline msg=%s user=%s err=%v", m.ID, userID, err)
+				continue
+			}
+			frame.To = userID
+			frame.GatewayId = req.GatewayId
+			frame.ConnId = req.ConnId
+			frame.SessionId = req.SessionId
+			frame.AckRequired = true
+			h.data <- &chat.WSConnectionMsg{Frame: frame, Conn: rec, Req: req}
+		}
+		if len(list) < offlineDrainPage {
+			break
+		}
+	}
+}
+
+// syncAfterOverflow 离线队列溢出：清空队列，下发会话水位（SYNC），客户端按 read_seq/server_max_seq 拉取缺失消息
+func (h *AuthHandler) syncAfterOverflow(ctx context.Context, userID string, rec *chat.WsConn, req *pb.MessageFrameData) {
+	if err := online.ClearOffline(ctx, userID); err != nil {
+		logger.Errorf("[AuthHandler] clear offline user=%s err=%v", userID, err)
+	}
+
+	convList, err := listUserConversations(ctx, config.GetTenantID(), userID, offlineSyncConvLimit)
+	if err != nil {
+		logger.Errorf("[AuthHandler] list conversations user=%s err=%v", userID, err)
+		return
+	}
+	frame, err := chatService.BuildSyncFrameConversations(userID, convList)
+	if err != nil {
+		logger.Errorf("[AuthHandler] build sync frame user=%s err=%v", userID, err)
+		return
+	}
+	frame.GatewayId = req.GatewayId
+	frame.ConnId = req.ConnId
+	frame.SessionId = req.SessionId
+	frame.Meta = map[string]string{"reason": "offline_overflow"}
+	h.data <- &chat.WSConnectionMsg{Frame: frame, Conn: rec, Req: req}
+}
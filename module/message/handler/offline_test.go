@@ -0,0 +1,128 @@
+package handler
+
+import (
+	pb "PProject/gen/message"
+	chatModel "PProject/module/chat/model"
+	"PProject/service/chat"
+	online "PProject/service/storage"
+	redis2 "PProject/service/storage/redis"
+	util "PProject/tools"
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var (
+	memRedisOnce sync.Once
+	memRedisErr  error
+)
+
+// useOffline 离线队列用内存 Redis（全局客户端只能初始化一次，包内共用），会话列表换成固定数据
+func useOffline(t *testing.T, convs []*chatModel.Conversation) {
+	t.Helper()
+	memRedisOnce.Do(func() { _, memRedisErr = redis2.InitMemoryRedis() })
+	if memRedisErr != nil {
+		t.Fatal(memRedisErr)
+	}
+	old := listUserConversations
+	t.Cleanup(func() { listUserConversations = old })
+	listUserConversations = func(context.Context, string, string, int64) ([]*chatModel.Conversation, error) {
+		return convs, nil
+	}
+}
+
+func enqueue(t *testing.T, user string, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		value, err := util.EncodeFrame(&pb.MessageFrameData{
+			Type: pb.MessageFrameData_DELIVER,
+			From: "u1",
+			Body: &pb.MessageFrameData_Payload{Payload: &pb.MessageData{ServerMsgId: id}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := online.EnqueueOffline(context.Background(), user, id, "u1", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func drain(h *AuthHandler) []*pb.MessageFrameData {
+	var out []*pb.MessageFrameData
+	for {
+		select {
+		case m := <-h.data:
+			out = append(out, m.Frame)
+		default:
+			return out
+		}
+	}
+}
+
+func TestDrainOfflineInOrder(t *testing.T) {
+	useOffline(t, nil)
+	user := "drain1"
+	t.Cleanup(func() { _ = online.ClearOffline(context.Background(), user) })
+	enqueue(t, user, "a", "b", "c")
+
+	h := &AuthHandler{data: make(chan *chat.WSConnectionMsg, 16)}
+	req := &pb.MessageFrameData{GatewayId: "gw1", ConnId: "c1", SessionId: "s1"}
+	h.drainOffline(user, &chat.WsConn{}, req)
+
+	frames := drain(h)
+	if len(frames) != 3 {
+		t.Fatalf("frames = %d", len(frames))
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		f := frames[i]
+		if f.GetPayload().GetServerMsgId() != id || f.To != user || f.ConnId != "c1" || !f.AckRequired {
+			t.Fatalf("frame %d = %+v", i, f)
+		}
+	}
+
+	// 没有 CACK 的条目下次登录会再补一次
+	h.drainOffline(user, &chat.WsConn{}, req)
+	if frames := drain(h); len(frames) != 3 {
+		t.Fatalf("redelivered = %d", len(frames))
+	}
+}
+
+func TestDrainOfflineOverflowFallsBackToSync(t *testing.T) {
+	useOffline(t, []*chatModel.Conversation{{ConversationID: "si_u1_drain2"}})
+	user := "drain2"
+	ctx := context.Background()
+	t.Cleanup(func() { _ = online.ClearOffline(ctx, user) })
+
+	ids := make([]string, 0, online.OfflineQueueCap+1)
+	for i := 0; i <= online.OfflineQueueCap; i++ {
+		ids = append(ids, "m"+strconv.Itoa(i))
+	}
+	enqueue(t, user, ids...)
+
+	h := &AuthHandler{data: make(chan *chat.WSConnectionMsg, 16)}
+	h.drainOffline(user, &chat.WsConn{}, &pb.MessageFrameData{ConnId: "c1"})
+
+	frames := drain(h)
+	if len(frames) != 1 {
+		t.Fatalf("frames = %d want a single SYNC", len(frames))
+	}
+	f := frames[0]
+	if f.Type != pb.MessageFrameData_SYNC || f.Meta["reason"] != "offline_overflow" || f.ConnId != "c1" {
+		t.Fatalf("sync frame = %+v", f)
+	}
+	sync := &pb.SyncConversations{}
+	if err := f.GetAnyPayload().UnmarshalTo(sync); err != nil || len(sync.Conversations) != 1 {
+		t.Fatalf("sync payload = %+v, %v", sync, err)
+	}
+
+	// 队列已清空，溢出标记已消费：下次登录不会再补旧消息
+	if msgs, _ := online.FetchOffline(ctx, user, 0, 10); len(msgs) != 0 {
+		t.Fatalf("queue left = %d", len(msgs))
+	}
+	h.drainOffline(user, &chat.WsConn{}, &pb.MessageFrameData{})
+	if frames := drain(h); len(frames) != 0 {
+		t.Fatalf("second login frames = %d", len(frames))
+	}
+}
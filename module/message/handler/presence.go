@@ -0,0 +1,82 @@
+package handler
+
+import (
+	pb "PProject/gen/message"
+	"PProject/global/config"
+	"PProject/logger"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	"context"
+	"time"
+)
+
+// PresenceHandler PRESENCE 帧：any_payload 为 PresenceUpdate（设置状态）或 TypingStart（正在输入）
+// 两者都不落消息库、不回执；用户 ID 取连接上鉴权绑定的，不信任帧里的 from
+// 同时持有本网关的 PresenceHub：鉴权后关注好友/订阅对象的上下线，连接关闭时取消
+type PresenceHandler struct {
+	ctx    *chat.ChatContext
+	hub    *chatService.PresenceHub
+	cancel context.CancelFunc
+}
+
+func NewPresenceHandler(ctx *chat.ChatContext) chat.Handler {
+	h := &PresenceHandler{
+		ctx: ctx,
+		hub: chatService.NewPresenceHub(ctx.S.ConnMgr().GwId(), config.GetTenantID()),
+	}
+	ctx.S.OnConnClose(h.hub.Unwatch)
+	return h
+}
+
+func (h *PresenceHandler) IsHandler() bool { return false }
+
+func (h *PresenceHandler) Type() pb.MessageFrameData_Type { return pb.MessageFrameData_PRESENCE }
+
+func (h *PresenceHandler) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go h.hub.Run(ctx)
+}
+
+// Watch 连接鉴权成功后调用，失败只影响在线状态推送
+func (h *PresenceHandler) Watch(userID, snowID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.hub.Watch(ctx, userID, snowID); err != nil {
+		logger.Errorf("[PresenceHandler] watch presence user=%s snowID=%s err=%v", userID, snowID, err)
+	}
+}
+
+func (h *PresenceHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, conn *chat.WsConn) error {
+	rec := h.ctx.S.ConnMgr().GetClient(conn.Conn)
+	if rec == nil || !rec.Authorized || rec.UserId == "" {
+		logger.Infof("[PresenceHandler] drop presence from unauthorized conn=%s", f.GetSessionId())
+		return nil
+	}
+	body := f.GetAnyPayload()
+	if body == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	msg, err := body.UnmarshalNew()
+	if err != nil {
+		logger.Errorf("[PresenceHandler] unmarshal any_payload user=%s err=%v", rec.UserId, err)
+		return nil
+	}
+	switch v := msg.(type) {
+	case *pb.PresenceUpdate:
+		if _, err := chatService.UpdatePresence(ctx, rec.UserId, v); err != nil {
+			logger.Errorf("[PresenceHandler] update presence user=%s err=%v", rec.UserId, err)
+		}
+	case *pb.TypingStart:
+		if err := chatService.RelayTyping(ctx, config.GetTenantID(), rec.UserId, v); err != nil {
+			logger.Errorf("[PresenceHandler] relay typing user=%s channel=%s err=%v", rec.UserId, v.GetChannelId(), err)
+		}
+	default:
+		logger.Infof("[PresenceHandler] unsupported presence body %s", body.GetTypeUrl())
+	}
+	return nil
+}
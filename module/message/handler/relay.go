@@ -74,13 +74,13 @@ func (h *RelayHandler) Run() {
 					// 序列化（一次性）
 					data, err := marshaller.Marshal(msg)
 					if err != nil {
-						logger.Errorf("[RelayHandler] 解析数据出错 failed: conn_id=%s err=%v", err)
+						logger.Errorf("[RelayHandler] 解析数据出错 failed: conn_id=%s err=%v", msg.GetConnId(), err)
 						continue
 					}
 
 					// 发送（带写超时）
 					if err := chat.WriteJSONWithDeadline(conn, data, 5*time.Second); err != nil {
-						logger.Errorf("[RelayHandler] send failed: conn_id=%s err=%v", err)
+						logger.Errorf("[RelayHandler] send failed: conn_id=%s err=%v", msg.GetConnId(), err)
 						// 发送失败：关闭并从管理器移除，防止死连接占用资源
 						_ = conn.Close()
 						h.ctx.S.ConnMgr().Remove(msg.To)
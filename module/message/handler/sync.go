@@ -0,0 +1,62 @@
+package handler
+
+import (
+	pb "PProject/gen/message"
+	"PProject/global/config"
+	"PProject/logger"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	"context"
+	"strconv"
+	"time"
+)
+
+// SyncHandler 客户端发起的 SYNC 帧：meta.sync_mode 选择子模式，结果只回给发起的连接
+//   - conversations：meta.cursor 为上次的 next_cursor（空=全量），meta.size 为页大小
+type SyncHandler struct {
+	ctx *chat.ChatContext
+}
+
+func NewSyncHandler(ctx *chat.ChatContext) chat.Handler {
+	return &SyncHandler{ctx: ctx}
+}
+
+func (h *SyncHandler) IsHandler() bool { return false }
+
+func (h *SyncHandler) Type() pb.MessageFrameData_Type { return pb.MessageFrameData_SYNC }
+
+func (h *SyncHandler) Run() {}
+
+func (h *SyncHandler) Handle(_ *chat.ChatContext, f *pb.MessageFrameData, conn *chat.WsConn) error {
+	rec := h.ctx.S.ConnMgr().GetClient(conn.Conn)
+	if rec == nil || !rec.Authorized || rec.UserId == "" {
+		logger.Infof("[SyncHandler] drop sync from unauthorized conn=%s", f.GetSessionId())
+		return nil
+	}
+
+	meta := f.GetMeta()
+	switch mode := meta[chatService.MetaSyncMode]; mode {
+	case chatService.SyncModeConversations:
+		size, _ := strconv.ParseInt(meta[chatService.MetaSyncSize], 10, 64)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		payload, err := chatService.SyncConversations(ctx, config.GetTenantID(), rec.UserId, meta[chatService.MetaSyncCursor], size)
+		if err != nil {
+			logger.Errorf("[SyncHandler] sync conversations user=%s err=%v", rec.UserId, err)
+			return nil
+		}
+		frame, err := chatService.BuildSyncFrame(rec.UserId, payload)
+		if err != nil {
+			return err
+		}
+		// 请求-响应：不进 QoS 重传，丢了客户端用同一个游标重拉
+		frame.AckRequired = false
+		frame.AckId = f.GetAckId()
+		frame.Meta = map[string]string{chatService.MetaSyncMode: mode}
+		chat.WsRelayBound <- &chat.WSReplayMsg{Frame: frame, ConnectId: rec.SnowID}
+	default:
+		logger.Infof("[SyncHandler] unsupported sync mode=%q user=%s", mode, rec.UserId)
+	}
+	return nil
+}
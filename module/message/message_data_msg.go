@@ -6,7 +6,6 @@ import (
 	"PProject/logger"
 	seq2 "PProject/module/chat/seq"
 	"PProject/service/chat"
-	ka "PProject/service/dispatcher/kafka"
 	"PProject/service/mgo"
 	msgcli "PProject/service/msg"
 	"PProject/service/storage/redis"
@@ -17,142 +16,222 @@ import (
 
 	chatModel "PProject/module/chat/model"
 	chatService "PProject/module/chat/service"
-	online "PProject/service/storage"
 )
 
+// HandlerTopicMessage 按节点类型处理总线上的帧：数据节点落库并转发，其他节点下发到本地连接
 func HandlerTopicMessage(topic string, key, value []byte) error {
+	if config.Global.NodeType == config.NodeTypeDataNode {
+		return HandlerDataNodeMessage(topic, key, value)
+	}
+	return HandlerGatewayMessage(topic, key, value)
+}
 
+// HandlerDataNodeMessage 数据节点：写库、分配 seq，再转发给接收者所在的网关
+func HandlerDataNodeMessage(topic string, key, value []byte) error {
 	msg, err := util.DecodeFrame(value)
 	if err != nil {
 		logger.Errorf("topic key :%v Parse msg error: %s", topic, err)
 		return err
 	}
 
-	nodeType := config.Global.NodeType
+	ctx := context.Context(context.Background())
+	/// 写数据库
+	if msg.Type == pb.MessageFrameData_DATA {
 
-	// 如果是数据节点， 处理了数据 就转发 如果不是 直接就回复就可以了
-	if nodeType == config.NodeTypeDataNode {
-		ctx := context.Context(context.Background())
-		/// 写数据库
-		if msg.Type == pb.MessageFrameData_DATA {
+		// 创建索引
+		_ = seq2.EnsureIndexes(ctx)
 
-			// 创建索引
-			_ = seq2.EnsureIndexes(ctx)
-			// 获取到回话ID
-			convId, _, _ := seq2.EnsureSeqConversation(ctx, "tenant_001", msg.From, msg.To, int32(seq2.ConvTypeP2P))
+		// 话题回复走话题的发送链路（话题有独立的会话和 seq）
+		if msg.GetPayload().GetThreadId() != "" {
+			return handleThreadMessage(ctx, topic, key, msg)
+		}
 
-			logger.Infof("topic key:%v convId:%v", topic, convId)
+		// 服务器频道消息：权限校验 + 读扩散
+		if msg.GetPayload().GetGuildId() != "" {
+			return handleGuildMessage(ctx, topic, key, msg)
+		}
 
-			dao := &seq2.DAO{DB: mgo.GetDB()}
+		// 群消息走群的发送链路
+		if msg.GetPayload().GetGroupId() != "" {
+			return handleGroupMessage(ctx, topic, key, msg)
+		}
 
-			// 分配seq
-			alloc := &seq2.Allocator{
-				Rdb: redis.GetRedis(),
-				DAO: dao,
-				// 下面两个可选，不设就用默认：
-				BlockSizeFn: nil, // 自适应段大小，nil 用默认策略
-				KeyFn:       nil, // Redis key 生成规则，nil 用 "seq:blk:tenant:conv"
-				MaxRetry:    5,   // 缺段/冲突时重试次数，默认10
-			}
+		tenantID := config.GetTenantID()
 
-			// 获取到seq
-			start, mill, err := alloc.Malloc(ctx, "tenant_001", convId, 1)
-			_, _, err = seq2.EnsureTwoSidesByKnownConvID(ctx, "tenant_001", convId, int32(seq2.ConvTypeP2P), msg.From, msg.To, start)
-			if err != nil {
-				logger.Errorf("topic key:%v Parse msg error: %s", topic, err)
-			}
+		// 获取到回话ID
+		convId, _, _ := seq2.EnsureSeqConversation(ctx, tenantID, msg.From, msg.To, int32(seq2.ConvTypeP2P))
 
-			logger.Infof("topic key:%v start:%v mill:%v", topic, start, mill)
+		logger.Infof("topic key:%v convId:%v", topic, convId)
 
-			// 根据seq 插入消息
-			newMsg, err := chatService.BuildMessageModelFromPB("tenant_001", msg.GetPayload(), start, convId)
-			if err != nil {
-				logger.Errorf("topic key:%v build msg error: %s", topic, err)
-				return err
-			}
+		// 幂等：Kafka 重投/客户端重发的消息直接回原来的回执，不再分配 seq
+		serverMsgID, dup, err := reserveServerMsgID(ctx, tenantID, convId, msg)
+		if err != nil {
+			return err
+		}
+		if dup != nil {
+			return ackDuplicate(ctx, topic, key, msg, dup)
+		}
+
+		// 单聊：被对方拉黑 / 租户要求仅好友单聊时拒绝
+		// 放在去重之后：已经收下的消息重发时仍回原来的回执，不受之后拉黑的影响
+		if err := chatService.CheckP2PSendPolicy(ctx, tenantID, msg.From, msg.To); err != nil {
+			logger.Errorf("topic key:%v reject p2p msg from:%v to:%v error: %s", topic, msg.From, msg.To, err)
+			return sendNackToSender(ctx, topic, key, msg, err)
+		}
+
+		dao := &seq2.DAO{DB: mgo.GetDB()}
+
+		// 分配seq
+		alloc := &seq2.Allocator{
+			Rdb: redis.GetRedis(),
+			DAO: dao,
+			// 下面两个可选，不设就用默认：
+			BlockSizeFn: nil, // 自适应段大小，nil 用默认策略
+			KeyFn:       nil, // Redis key 生成规则，nil 用 "seq:blk:tenant:conv"
+			MaxRetry:    5,   // 缺段/冲突时重试次数，默认10
+		}
+
+		// 获取到seq
+		start, mill, err := alloc.Malloc(ctx, tenantID, convId, 1)
+		if err != nil {
+			return err
+		}
+		logger.Infof("topic key:%v start:%v mill:%v", topic, start, mill)
 
+		// 根据seq 插入消息
+		newMsg, err := chatService.BuildMessageModelFromPB(tenantID, msg.GetPayload(), start, convId)
+		if err != nil {
+			logger.Errorf("topic key:%v build msg error: %s", topic, err)
+			return err
+		}
+		if serverMsgID != "" {
+			newMsg.ServerMsgID = serverMsgID
+		}
+		newMsg.DedupID = msg.GetDedupId()
+
+		// 阅后即焚/定时销毁：消息没带就用会话默认
+		if err := chatService.ApplyDestructPolicy(ctx, tenantID, newMsg); err != nil {
+			logger.Errorf("topic key:%v ApplyDestructPolicy error: %s", topic, err)
+		}
+
+		// 下发帧和发送回执先生成好，和消息、会话、seq 水位在同一个事务里写进 outbox
+		// 提交后直接发布；发布失败或进程在发布前崩溃，由 outbox relay 补发
+		data := chatService.BuildPBFromMessageModel(newMsg)
+		events, offline, err := gatewayDeliveries(ctx, tenantID, newMsg.ServerMsgID, key, msg.To, []string{msg.To}, func(gateway string, users []string) *pb.MessageFrameData {
+			return chat.BuildDeliver(msg.To, data, msg)
+		})
+		if err != nil {
+			// 路由查不到就按不在线处理，走离线队列
+			logger.Errorf("topic key:%v route %v error: %s", topic, msg.To, err)
+			events, offline = nil, []string{msg.To}
+		}
+		ack, err := ackToSenderEvent(ctx, tenantID, topic, key, msg, newMsg.ServerMsgID, newMsg.Seq)
+		if err != nil {
+			return err
+		}
+		if ack != nil {
+			events = append(events, ack)
+		}
+
+		err = mgo.GetTx().Transaction(ctx, func(ctx context.Context) error {
 			// 插入消息
-			err = chatModel.InsertMessage(ctx, newMsg)
-			if err != nil {
-				logger.Errorf("topic key:%v InsertMessage  error: %s", topic, err)
+			if err := chatModel.InsertMessage(ctx, newMsg); err != nil {
+				return err
+			}
+			if _, _, err := seq2.EnsureTwoSidesByKnownConvID(ctx, tenantID, convId, int32(seq2.ConvTypeP2P), msg.From, msg.To, start); err != nil {
 				return err
 			}
-
 			// 设置最大的seq
 			seq, err := seq2.UpdateMaxSeq(ctx, convId, start)
 			if err != nil {
 				return err
 			}
-
 			if seq != start {
-				logger.Errorf("topic key:%v UpdateMaxSeq  error: %s", topic, err)
 				return fmt.Errorf("topic key:%v seq diff error", topic)
 			}
-
-			gateway, err := online.GetManager().GetUserGateway(ctx, msg.From)
-			if err != nil {
-				logger.Errorf("topic key:%v BatchListOnlineConnList  error: %s", topic, err)
+			return writeOutbox(ctx, events)
+		})
+		if err != nil {
+			if dup := duplicateOnInsert(ctx, tenantID, convId, msg, err); dup != nil {
+				return ackDuplicate(ctx, topic, key, msg, dup)
 			}
+			logger.Errorf("topic key:%v persist msg error: %s", topic, err)
+			return err
+		}
+		publishOutbox(ctx, events)
 
-			logger.Infof("topic key:%v connList:%v", topic, gateway)
+		// 会话列表增量同步：两边的会话都有新消息
+		if err := chatService.TouchConversations(ctx, tenantID, convId, []string{msg.From, msg.To}); err != nil {
+			logger.Errorf("topic key:%v TouchConversations error: %s", topic, err)
+		}
 
-			keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).ReceiveTopicKeys(false)
-			topicKey := ka.SelectCAckTopicByUser(msg.From, keys)
-			topicKey = fmt.Sprintf("%v_%v", gateway, topicKey)
+		if err := chatService.ScheduleDestruct(ctx, tenantID, newMsg); err != nil {
+			logger.Errorf("topic key:%v ScheduleDestruct error: %s", topic, err)
+		}
 
-			err = MessageProducerHandler(topicKey, string(key), value)
-			if err != nil {
-				return err
-			}
+		// 写 @ 索引（@某人/@全体/回复），失败不影响消息投递
+		if err := chatService.IndexMentions(ctx, tenantID, newMsg); err != nil {
+			logger.Errorf("topic key:%v IndexMentions error: %s", topic, err)
+		}
+		if err := chatService.IndexMessageSearch(ctx, tenantID, newMsg); err != nil {
+			logger.Errorf("topic key:%v IndexMessageSearch error: %s", topic, err)
+		}
 
-			deliverMsg := chat.BuildSendSuccessAckDeliver(msg.From, msg.GetPayload().ClientMsgId, msg.GetPayload().ServerMsgId, msg)
-			deliverMsgData, err := util.EncodeFrame(deliverMsg)
-			if err != nil {
-				logger.Errorf("topic key:%v encode deliver msg error: %s", topic, err)
-				return err
-			}
+		// 接收者不在线就进离线队列，上线后补发
+		enqueueOffline(ctx, offline, data, msg)
+		chatService.NotifyOfflinePush(tenantID, newMsg, []string{msg.To}, offline)
+		// 接收者是机器人时推给它的 Webhook
+		chatService.NotifyBotMessage(ctx, tenantID, newMsg)
+		return nil
 
-			topicKey = ka.SelectCAckTopicByUser(msg.From, keys)
-			topicKey = fmt.Sprintf("%v_%v", gateway, topicKey)
+	}
 
-			err = MessageProducerHandler(topicKey, string(key), deliverMsgData)
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-		}
+// HandlerGatewayMessage 网关：把数据节点转发来的帧下发到本网关的连接
+func HandlerGatewayMessage(topic string, key, value []byte) error {
+	msg, err := util.DecodeFrame(value)
+	if err != nil {
+		logger.Errorf("topic key :%v Parse msg error: %s", topic, err)
+		return err
+	}
 
-	} else {
-		// 其他节点方式处理
-		//msg.WsRelayBound <- msg
+	// 其他节点方式处理
+	//msg.WsRelayBound <- msg
 
-		if msg.Type == pb.MessageFrameData_DATA {
-			err = msgcli.ReplayMsg(value, "")
-			if err != nil {
-				logger.Infof("topic key :%v Replay msg error: %s", topic, err)
-				return err
-			}
-		} else if msg.Type == pb.MessageFrameData_DELIVER {
-			err = msgcli.ReplayMsg(value, msg.GetSessionId())
-			if err != nil {
-				logger.Infof("topic key :%v Replay msg error: %s", topic, err)
-				return err
-			}
+	if msg.Type == pb.MessageFrameData_DATA {
+		err = msgcli.ReplayMsg(value, "")
+		if err != nil {
+			logger.Infof("topic key :%v Replay msg error: %s", topic, err)
+			return err
+		}
+	} else if msg.GetMeta()[chat.MetaChannel] != "" {
+		// 广播频道：每个网关一帧，按本地订阅者展开
+		chatService.RelayChannelFrame(msg)
+	} else if msg.GetMeta()[chat.MetaRecipients] != "" {
+		// 群消息/话题通知：按网关聚合的帧，拆给本网关上的接收者
+		chat.RelayFrameToRecipients(msg)
+	} else if msg.Type == pb.MessageFrameData_DELIVER || msg.Type == pb.MessageFrameData_NACK {
+		err = msgcli.ReplayMsg(value, msg.GetSessionId())
+		if err != nil {
+			logger.Infof("topic key :%v Replay msg error: %s", topic, err)
+			return err
 		}
-
-		//deliverMsg := chat.BuildSendSuccessAckDeliver(msg.From, msg.GetPayload().ClientMsgId, msg.GetPayload().ServerMsgId, msg)
-		//deliverMsgData, err := util.EncodeFrame(deliverMsg)
-		//if err != nil {
-		//	logger.Errorf("BuildSendSuccessAckDeliver EncodeFrame topic key :%v Replay msg error: %s", topic, err)
-		//	return err
-		//}
-		//err = msgcli.ReplayMsg(deliverMsgData, msg.GetSessionId())
-		//if err != nil {
-		//	logger.Errorf("BuildSendSuccessAckDeliverv ReplayMsg topic key :%v Replay msg error: %s", topic, err)
-		//	return err
-		//}
 	}
 
+	//deliverMsg := chat.BuildSendSuccessAckDeliver(msg.From, msg.GetPayload().ClientMsgId, msg.GetPayload().ServerMsgId, msg)
+	//deliverMsgData, err := util.EncodeFrame(deliverMsg)
+	//if err != nil {
+	//	logger.Errorf("BuildSendSuccessAckDeliver EncodeFrame topic key :%v Replay msg error: %s", topic, err)
+	//	return err
+	//}
+	//err = msgcli.ReplayMsg(deliverMsgData, msg.GetSessionId())
+	//if err != nil {
+	//	logger.Errorf("BuildSendSuccessAckDeliverv ReplayMsg topic key :%v Replay msg error: %s", topic, err)
+	//	return err
+	//}
+
 	// 下发给自己
 	return nil
 }
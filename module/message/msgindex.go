@@ -9,6 +9,21 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// Lua：原子 SETNX + PEXPIRE；若已存在则 GET 返回旧值
+var luaEnsureClientMsgID = redis.NewScript(`
+local k = KEYS[1]
+local v = ARGV[1]
+local ttl_ms = tonumber(ARGV[2])
+local ok = redis.call('SETNX', k, v)
+if ok == 1 then
+  redis.call('PEXPIRE', k, ttl_ms)
+  return {0, v}  -- 0=新写入
+else
+  local old = redis.call('GET', k)
+  return {1, old} -- 1=命中已有
+end
+`)
+
 // ClientMsgIndex 负责管理 “ClientMsgID -> ServerMsgID” 的幂等窗口
 type ClientMsgIndex struct {
 	rdb    redis.UniversalClient
@@ -65,21 +80,7 @@ func (m *ClientMsgIndex) Ensure(ctx context.Context, tenant, sender, clientMsgID
 	if sid == "" {
 		sid = m.genSID()
 	}
-	// Lua：原子 SETNX + PEXPIRE；若已存在则 GET 返回旧值
-	const lua = `
-local k = KEYS[1]
-local v = ARGV[1]
-local ttl_ms = tonumber(ARGV[2])
-local ok = redis.call('SETNX', k, v)
-if ok == 1 then
-  redis.call('PEXPIRE', k, ttl_ms)
-  return {0, v}  -- 0=新写入
-else
-  local old = redis.call('GET', k)
-  return {1, old} -- 1=命中已有
-end
-`
-	res, err := m.rdb.Eval(ctx, lua, []string{key}, sid, int64(m.ttl/time.Millisecond)).Result()
+	res, err := luaEnsureClientMsgID.Run(ctx, m.rdb, []string{key}, sid, int64(m.ttl/time.Millisecond)).Result()
 	if err != nil {
 		return "", false, err
 	}
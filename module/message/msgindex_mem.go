@@ -0,0 +1,15 @@
+package message
+
+import redis2 "PProject/service/storage/redis"
+
+// 内存 Redis 下 luaEnsureClientMsgID 的等价实现（单进程开发模式）
+func init() {
+	redis2.RegisterScript(luaEnsureClientMsgID, func(c *redis2.ScriptCall) any {
+		k, v := c.Keys[0], c.Args[0]
+		if c.CallInt("SETNX", k, v) == 1 {
+			c.Call("PEXPIRE", k, c.ArgInt(1))
+			return []any{0, v}
+		}
+		return []any{1, c.Call("GET", k)}
+	})
+}
@@ -0,0 +1,41 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	"PProject/service/chat"
+	ka "PProject/service/dispatcher/kafka"
+	online "PProject/service/storage"
+	util "PProject/tools"
+	"PProject/tools/errs"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// sendNackToSender 发送侧校验不通过时给发送者回 NACK
+// 只有业务错误（errs.CodeError）回 NACK 并吞掉错误；其它错误原样返回，交给上层重试
+func sendNackToSender(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData, cause error) error {
+	var codeErr *errs.CodeError
+	if !errors.As(cause, &codeErr) {
+		return cause
+	}
+
+	gateway, err := online.GetManager().GetUserGateway(ctx, msg.From)
+	if err != nil || gateway == "" {
+		// 发送者已离线，没有回执可回
+		logger.Infof("topic key:%v sender %v offline, drop nack code:%v", topic, msg.From, codeErr.Code)
+		return nil
+	}
+
+	nack := chat.BuildSendNack(msg.From, msg.GetPayload().GetClientMsgId(), codeErr.Code, codeErr.Error(), msg)
+	data, err := util.EncodeFrame(nack)
+	if err != nil {
+		logger.Errorf("topic key:%v encode nack error: %s", topic, err)
+		return err
+	}
+
+	keys := ka.Cfg.GetMessageHandlerConfig(pb.MessageFrameData_DATA).ReceiveTopicKeys(false)
+	topicKey := fmt.Sprintf("%v_%v", gateway, ka.SelectCAckTopicByUser(msg.From, keys))
+	return MessageProducerHandler(topicKey, string(key), data)
+}
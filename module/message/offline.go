@@ -0,0 +1,30 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/logger"
+	"PProject/service/chat"
+	online "PProject/service/storage"
+	util "PProject/tools"
+	"context"
+)
+
+// enqueueOffline 接收者不在线：把下发帧存进其离线队列，上线鉴权后由网关按序补发，CACK 后删除
+// 队列满了会丢最旧的并打上溢出标记，该用户上线后改走 SYNC 补齐
+func enqueueOffline(ctx context.Context, users []string, md *pb.MessageData, req *pb.MessageFrameData) {
+	for _, uid := range users {
+		value, err := util.EncodeFrame(chat.BuildDeliver(uid, md, req))
+		if err != nil {
+			logger.Errorf("user:%v encode offline frame error: %s", uid, err)
+			continue
+		}
+		overflowed, err := online.EnqueueOffline(ctx, uid, md.GetServerMsgId(), req.From, value)
+		if err != nil {
+			logger.Errorf("user:%v enqueue offline msg:%v error: %s", uid, md.GetServerMsgId(), err)
+			continue
+		}
+		if overflowed {
+			logger.Infof("user:%v offline queue overflowed, will SYNC on next login", uid)
+		}
+	}
+}
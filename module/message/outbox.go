@@ -0,0 +1,149 @@
+package message
+
+import (
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	seq2 "PProject/module/chat/seq"
+	"PProject/service/bus"
+	"PProject/service/mgo"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	outboxInlineGrace   = 5 * time.Second // 提交后先由本流程直接发布，这段时间内 relay 不领取
+	outboxPollInterval  = 500 * time.Millisecond
+	outboxBatchSize     = 200
+	outboxLease         = 30 * time.Second // 领取后这么久没有结果，视为 relay 已宕机，可被重新领取
+	outboxMaxAttempts   = 10
+	outboxRetryBase     = time.Second
+	outboxRetryMaxDelay = time.Minute
+)
+
+// outbox 表和 Kafka 发布（测试里换成内存实现）
+var (
+	claimPendingOutboxEvent = func(ctx context.Context, nowMS, leaseUntilMS int64) (*chatModel.OutboxEvent, error) {
+		ob := chatModel.OutboxEvent{}
+		return ob.ClaimPendingOutboxEvent(ctx, nowMS, leaseUntilMS)
+	}
+	markOutboxSent = func(ctx context.Context, ids ...primitive.ObjectID) error {
+		ob := chatModel.OutboxEvent{}
+		return ob.MarkOutboxSent(ctx, ids...)
+	}
+	retryOutboxEvent = func(ctx context.Context, id primitive.ObjectID, retryAtMS int64, lastError string, failed bool) error {
+		ob := chatModel.OutboxEvent{}
+		return ob.RetryOutboxEvent(ctx, id, retryAtMS, lastError, failed)
+	}
+	publishOutboxMessage = publishMessage
+)
+
+// writeOutbox 在事务里写入待发布的 Kafka 消息（ctx 必须是事务的 ctx）
+func writeOutbox(ctx context.Context, events []*chatModel.OutboxEvent) error {
+	ob := chatModel.OutboxEvent{}
+	return ob.InsertOutboxEvents(ctx, events, time.Now().Add(outboxInlineGrace).UnixMilli())
+}
+
+// persistMessageTx 消息、seq 水位、write 里的其它写入（会话、话题摘要等）和 outbox 在同一个事务里提交
+// write 在事务里执行并返回要发布的事件，事务重试时会重新生成；提交后由调用方 publishOutbox
+func persistMessageTx(ctx context.Context, newMsg *chatModel.MessageModel, write func(ctx context.Context) ([]*chatModel.OutboxEvent, error)) ([]*chatModel.OutboxEvent, error) {
+	var events []*chatModel.OutboxEvent
+	err := mgo.GetTx().Transaction(ctx, func(ctx context.Context) error {
+		events = nil
+		if err := chatModel.InsertMessage(ctx, newMsg); err != nil {
+			return err
+		}
+		if _, err := seq2.UpdateMaxSeq(ctx, newMsg.ConversationID, newMsg.Seq); err != nil {
+			return err
+		}
+		if write != nil {
+			var err error
+			if events, err = write(ctx); err != nil {
+				return err
+			}
+		}
+		return writeOutbox(ctx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// publishOutbox 事务提交后直接发布；失败的留在 outbox 里，由 relay 重试
+func publishOutbox(ctx context.Context, events []*chatModel.OutboxEvent) {
+	sent := make([]primitive.ObjectID, 0, len(events))
+	for _, e := range events {
+		if err := publishOutboxEvent(e); err != nil {
+			logger.Errorf("outbox:%v topic:%v publish error, leave to relay: %s", e.ID.Hex(), e.Topic, err)
+			continue
+		}
+		sent = append(sent, e.ID)
+	}
+	if err := markOutboxSent(ctx, sent...); err != nil {
+		// 标记失败会被 relay 再发一次：下游按 server_msg_id/ack_id 去重
+		logger.Errorf("outbox mark sent error: %s", err)
+	}
+}
+
+// publishOutboxEvent 以 outbox 记录 ID 作消息 ID：标记已发送失败后 relay 再发的同一条，消费端按 ID 去重
+func publishOutboxEvent(e *chatModel.OutboxEvent) error {
+	var headers map[string]string
+	if !e.ID.IsZero() {
+		headers = map[string]string{bus.HeaderMsgID: e.ID.Hex()}
+	}
+	return publishOutboxMessage(e.Topic, e.Key, e.Value, headers)
+}
+
+// StartOutboxRelay 发布 outbox 中未发布的记录（提交后直接发布失败的、发布前进程崩溃的）
+// 每个数据节点都可以跑：通过租约领取，同一条记录同一时刻只有一个 relay 在发
+func StartOutboxRelay(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runOutboxRelayOnce(ctx)
+			}
+		}
+	}()
+}
+
+func runOutboxRelayOnce(ctx context.Context) {
+	for i := 0; i < outboxBatchSize; i++ {
+		now := time.Now()
+		e, err := claimPendingOutboxEvent(ctx, now.UnixMilli(), now.Add(outboxLease).UnixMilli())
+		if err != nil {
+			logger.Errorf("claim outbox error: %s", err)
+			return
+		}
+		if e == nil {
+			return
+		}
+		relayOutboxEvent(ctx, e)
+	}
+}
+
+func relayOutboxEvent(ctx context.Context, e *chatModel.OutboxEvent) {
+	err := publishOutboxEvent(e)
+	if err == nil {
+		if err := markOutboxSent(ctx, e.ID); err != nil {
+			logger.Errorf("outbox:%v mark sent error: %s", e.ID.Hex(), err)
+		}
+		return
+	}
+
+	failed := e.Attempts >= outboxMaxAttempts
+	delay := outboxRetryBase << uint(e.Attempts)
+	if delay <= 0 || delay > outboxRetryMaxDelay {
+		delay = outboxRetryMaxDelay
+	}
+	logger.Errorf("outbox:%v topic:%v attempt:%d publish error: %s", e.ID.Hex(), e.Topic, e.Attempts, err)
+	if err := retryOutboxEvent(ctx, e.ID, time.Now().Add(delay).UnixMilli(), err.Error(), failed); err != nil {
+		logger.Errorf("outbox:%v requeue error: %s", e.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,220 @@
+package message
+
+import (
+	chatModel "PProject/module/chat/model"
+	"PProject/service/bus"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeOutbox 代替 outbox 表和 Kafka：领取/标记/重试的条件与 Mongo 里的过滤条件一致
+type fakeOutbox struct {
+	mu        sync.Mutex
+	items     []*chatModel.OutboxEvent
+	published []string // 发布成功的 X-Msg-Id，按发布顺序
+	fail      func(topic string) error
+}
+
+func (f *fakeOutbox) install(t *testing.T) {
+	t.Helper()
+	claim, mark, retry, publish := claimPendingOutboxEvent, markOutboxSent, retryOutboxEvent, publishOutboxMessage
+	t.Cleanup(func() {
+		claimPendingOutboxEvent, markOutboxSent, retryOutboxEvent, publishOutboxMessage = claim, mark, retry, publish
+	})
+
+	claimPendingOutboxEvent = func(_ context.Context, nowMS, leaseUntilMS int64) (*chatModel.OutboxEvent, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		sort.SliceStable(f.items, func(i, j int) bool { return f.items[i].NextAttemptMS < f.items[j].NextAttemptMS })
+		for _, e := range f.items {
+			if e.Status != chatModel.OutboxStatusPending || e.NextAttemptMS > nowMS {
+				continue
+			}
+			e.NextAttemptMS = leaseUntilMS
+			e.Attempts++
+			cp := *e
+			return &cp, nil
+		}
+		return nil, nil
+	}
+	markOutboxSent = func(_ context.Context, ids ...primitive.ObjectID) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, id := range ids {
+			if e := f.find(id); e != nil && e.Status == chatModel.OutboxStatusPending {
+				e.Status = chatModel.OutboxStatusSent
+			}
+		}
+		return nil
+	}
+	retryOutboxEvent = func(_ context.Context, id primitive.ObjectID, retryAtMS int64, lastError string, failed bool) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if e := f.find(id); e != nil && e.Status == chatModel.OutboxStatusPending {
+			e.NextAttemptMS, e.LastError = retryAtMS, lastError
+			if failed {
+				e.Status = chatModel.OutboxStatusFailed
+			}
+		}
+		return nil
+	}
+	publishOutboxMessage = func(topic, _ string, _ []byte, headers map[string]string) error {
+		if f.fail != nil {
+			if err := f.fail(topic); err != nil {
+				return err
+			}
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.published = append(f.published, headers[bus.HeaderMsgID])
+		return nil
+	}
+}
+
+func (f *fakeOutbox) find(id primitive.ObjectID) *chatModel.OutboxEvent {
+	for _, e := range f.items {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// add 写入一条记录（相当于事务提交），返回发布方拿到的副本
+func (f *fakeOutbox) add(topic string, availableAtMS int64) *chatModel.OutboxEvent {
+	e := chatModel.NewOutboxEvent("t1", "sid-"+topic, topic, "k", []byte(topic))
+	e.NextAttemptMS = availableAtMS
+	f.items = append(f.items, e)
+	cp := *e
+	return &cp
+}
+
+func (f *fakeOutbox) get(id primitive.ObjectID) chatModel.OutboxEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return *f.find(id)
+}
+
+func TestPublishOutboxMarksOnlyPublished(t *testing.T) {
+	store := &fakeOutbox{fail: func(topic string) error {
+		if topic == "bad" {
+			return errors.New("kafka down")
+		}
+		return nil
+	}}
+	store.install(t)
+	grace := time.Now().Add(outboxInlineGrace).UnixMilli()
+	events := []*chatModel.OutboxEvent{store.add("a", grace), store.add("bad", grace), store.add("b", grace)}
+
+	publishOutbox(context.Background(), events)
+
+	if a, bad, b := store.get(events[0].ID), store.get(events[1].ID), store.get(events[2].ID); a.Status != chatModel.OutboxStatusSent ||
+		bad.Status != chatModel.OutboxStatusPending || b.Status != chatModel.OutboxStatusSent {
+		t.Fatalf("status = %d %d %d", a.Status, bad.Status, b.Status)
+	}
+	// 消息 ID 用 outbox 记录 ID，relay 再发同一条时消费端能去重
+	if len(store.published) != 2 || store.published[0] != events[0].ID.Hex() || store.published[1] != events[2].ID.Hex() {
+		t.Fatalf("published = %v", store.published)
+	}
+
+	// 提交后的宽限期内 relay 领不到，宽限期过后补发失败的那条
+	runOutboxRelayOnce(context.Background())
+	if len(store.published) != 2 {
+		t.Fatalf("relay claimed within grace: %v", store.published)
+	}
+	e, _ := claimPendingOutboxEvent(context.Background(), grace, time.Now().Add(outboxLease).UnixMilli())
+	if e == nil || e.ID != events[1].ID {
+		t.Fatalf("claim after grace = %+v", e)
+	}
+}
+
+func TestOutboxRelayPublishesDueAndStops(t *testing.T) {
+	store := &fakeOutbox{}
+	store.install(t)
+	now := time.Now().UnixMilli()
+	due := []*chatModel.OutboxEvent{store.add("a", now-2000), store.add("b", now-1000)}
+	later := store.add("c", now+time.Hour.Milliseconds())
+
+	runOutboxRelayOnce(context.Background())
+
+	if len(store.published) != 2 || store.published[0] != due[0].ID.Hex() || store.published[1] != due[1].ID.Hex() {
+		t.Fatalf("published = %v", store.published)
+	}
+	for _, e := range due {
+		if got := store.get(e.ID); got.Status != chatModel.OutboxStatusSent || got.Attempts != 1 {
+			t.Fatalf("%s = status %d attempts %d", e.Topic, got.Status, got.Attempts)
+		}
+	}
+	if got := store.get(later.ID); got.Status != chatModel.OutboxStatusPending || got.Attempts != 0 {
+		t.Fatalf("future event touched: %+v", got)
+	}
+}
+
+func TestOutboxLeaseAfterRelayCrash(t *testing.T) {
+	store := &fakeOutbox{}
+	store.install(t)
+	ctx := context.Background()
+	now := time.Now()
+	e := store.add("a", now.UnixMilli()-1000)
+
+	// relay A 领取后崩溃，租约期内别的 relay 领不到
+	if c, _ := claimPendingOutboxEvent(ctx, now.UnixMilli(), now.Add(outboxLease).UnixMilli()); c == nil {
+		t.Fatal("first claim failed")
+	}
+	if c, _ := claimPendingOutboxEvent(ctx, now.Add(outboxLease-time.Second).UnixMilli(), now.Add(2*outboxLease).UnixMilli()); c != nil {
+		t.Fatalf("claimed within lease: %+v", c)
+	}
+
+	// 租约到期后重新领取并发布
+	after := now.Add(outboxLease)
+	c, _ := claimPendingOutboxEvent(ctx, after.UnixMilli(), after.Add(outboxLease).UnixMilli())
+	if c == nil || c.ID != e.ID || c.Attempts != 2 {
+		t.Fatalf("reclaim = %+v", c)
+	}
+	relayOutboxEvent(ctx, c)
+	if got := store.get(e.ID); got.Status != chatModel.OutboxStatusSent || len(store.published) != 1 {
+		t.Fatalf("status %d published %v", got.Status, store.published)
+	}
+}
+
+func TestOutboxRelayRetryBackoffThenFail(t *testing.T) {
+	store := &fakeOutbox{fail: func(string) error { return errors.New("kafka down") }}
+	store.install(t)
+	ctx := context.Background()
+	e := store.add("a", time.Now().UnixMilli()-1000)
+	farFuture := time.Now().Add(24 * time.Hour).UnixMilli()
+
+	for attempt := int32(1); attempt <= outboxMaxAttempts; attempt++ {
+		c, err := claimPendingOutboxEvent(ctx, farFuture, farFuture)
+		if err != nil || c == nil {
+			t.Fatalf("attempt %d claim = %v, %v", attempt, c, err)
+		}
+		before := time.Now()
+		relayOutboxEvent(ctx, c)
+
+		got := store.get(e.ID)
+		if attempt == outboxMaxAttempts {
+			if got.Status != chatModel.OutboxStatusFailed || got.LastError != "kafka down" {
+				t.Fatalf("last attempt = status %d err %q", got.Status, got.LastError)
+			}
+			break
+		}
+		delay := outboxRetryBase << uint(attempt)
+		if delay > outboxRetryMaxDelay {
+			delay = outboxRetryMaxDelay
+		}
+		want := before.Add(delay).UnixMilli()
+		if got.Status != chatModel.OutboxStatusPending || got.NextAttemptMS < want || got.NextAttemptMS > want+1000 {
+			t.Fatalf("attempt %d = status %d next +%dms want +%dms", attempt, got.Status, got.NextAttemptMS-before.UnixMilli(), delay.Milliseconds())
+		}
+	}
+	if c, _ := claimPendingOutboxEvent(ctx, farFuture*2, farFuture*2); c != nil {
+		t.Fatalf("failed event claimed again: %+v", c)
+	}
+}
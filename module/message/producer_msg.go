@@ -2,24 +2,29 @@ package message
 
 import (
 	"PProject/logger"
-	ka "PProject/service/dispatcher/kafka"
-
-	"github.com/Shopify/sarama"
+	"PProject/service/bus"
+	"context"
 )
 
+// MessageProducerHandler 通过消息总线发送（Kafka / NATS 由配置决定）
 func MessageProducerHandler(topic, key string, value []byte) error {
-	logger.Infof("topic key value is %s", string(key))
-	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Key:   sarama.ByteEncoder([]byte(key)), // ★ 用 userId 作为 Key（HashPartitioner 生效）
-		Value: sarama.ByteEncoder(value),
-	}
+	return publishMessage(topic, key, value, nil)
+}
 
-	partition, offset, err := ka.Producer.SendMessage(msg)
+// publishMessage 带消息头发送（如 bus.HeaderMsgID，消费端据此去重）
+func publishMessage(topic, key string, value []byte, headers map[string]string) error {
+	logger.Infof("topic key value is %s", string(key))
+	err := bus.Publish(context.Background(), &bus.Message{
+		Topic:   topic,
+		Key:     []byte(key), // ★ 用 userId 作为 Key（同一用户的消息有序）
+		Value:   value,
+		Headers: headers,
+	})
 	if err != nil {
 		logger.Errorf("send message fail, %s", err)
+		return err
 	}
 
-	logger.Infof("send message success, partition is %d offset:%d", partition, offset)
+	logger.Infof("send message success, topic is %s", topic)
 	return nil
 }
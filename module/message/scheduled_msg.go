@@ -0,0 +1,139 @@
+package message
+
+import (
+	"PProject/global/config"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	chatService "PProject/module/chat/service"
+	"PProject/service/storage/redis"
+	util "PProject/tools"
+	"context"
+	"time"
+)
+
+const (
+	scheduleLeaderKey    = "im:schedule:leader"
+	scheduleLeaderTTL    = 10 * time.Second
+	schedulePollInterval = time.Second
+	scheduleBatchSize    = 100
+	scheduleStaleAfter   = 2 * time.Minute // 领取后这么久还没完成，视为领取者已宕机
+	scheduleMaxAttempts  = 5
+	scheduleRetryBase    = 5 * time.Second
+)
+
+// 定时消息表、落库查询和注入入口（测试里换成内存实现）
+var (
+	claimDueScheduledMessage = func(ctx context.Context, nowMS, staleBeforeMS int64, nodeID string) (*chatModel.ScheduledMessage, error) {
+		sm := chatModel.ScheduledMessage{}
+		return sm.ClaimDueScheduledMessage(ctx, nowMS, staleBeforeMS, nodeID)
+	}
+	finishScheduledMessage = func(ctx context.Context, m *chatModel.ScheduledMessage, status int32, serverMsgID, lastError string, retryAtMS int64) error {
+		sm := chatModel.ScheduledMessage{}
+		return sm.FinishScheduledMessage(ctx, m.ID, m.ClaimedAtMS, status, serverMsgID, lastError, retryAtMS)
+	}
+	scheduledDeliveredMsgID = chatService.ScheduledDeliveredMsgID
+	injectScheduledFrame    = HandlerTopicMessage
+)
+
+// StartScheduledMessageScheduler 定时消息调度：数据节点之间通过 Redis 锁选主，只有 leader 领取到期消息
+// 到期消息以普通 DATA 帧注入 HandlerTopicMessage，分配 seq/落库/下发与实时消息完全一致
+func StartScheduledMessageScheduler(ctx context.Context) {
+	leader := redis.NewLeader(scheduleLeaderKey, config.InstanceID(), scheduleLeaderTTL)
+	go func() {
+		ticker := time.NewTicker(schedulePollInterval)
+		defer ticker.Stop()
+		defer func() { _ = leader.Release(context.Background()) }()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ok, err := leader.TryAcquire(ctx)
+				if err != nil {
+					logger.Errorf("schedule leader acquire error: %s", err)
+					continue
+				}
+				if ok {
+					runScheduledOnce(ctx)
+				}
+			}
+		}
+	}()
+}
+
+// runScheduledOnce 每轮最多处理 scheduleBatchSize 条，避免长时间占用导致锁过期
+func runScheduledOnce(ctx context.Context) {
+	for i := 0; i < scheduleBatchSize; i++ {
+		now := time.Now()
+		m, err := claimDueScheduledMessage(ctx, now.UnixMilli(), now.Add(-scheduleStaleAfter).UnixMilli(), config.InstanceID())
+		if err != nil {
+			logger.Errorf("claim scheduled message error: %s", err)
+			return
+		}
+		if m == nil {
+			return
+		}
+		fireScheduledMessage(ctx, m)
+	}
+}
+
+// fireScheduledMessage 投递一条定时消息
+// 只发一次：投递前后都按 client_msg_id 查一次消息表，已落库就直接标记完成，不会重复注入
+func fireScheduledMessage(ctx context.Context, m *chatModel.ScheduledMessage) {
+	serverMsgID, err := scheduledDeliveredMsgID(ctx, m)
+	if err != nil {
+		retryScheduledMessage(ctx, m, err)
+		return
+	}
+	if serverMsgID != "" {
+		// 上次注入成功但没来得及标记（节点重启）
+		if err := finishScheduledMessage(ctx, m, chatModel.ScheduledMsgStatusSent, serverMsgID, "", 0); err != nil {
+			logger.Errorf("schedule:%v mark sent error: %s", m.ScheduleID, err)
+		}
+		return
+	}
+
+	frame, err := chatService.BuildScheduledFrame(m)
+	if err != nil {
+		// 内容坏了，重试也没用
+		_ = finishScheduledMessage(ctx, m, chatModel.ScheduledMsgStatusFailed, "", err.Error(), 0)
+		return
+	}
+	value, err := util.EncodeFrame(frame)
+	if err != nil {
+		_ = finishScheduledMessage(ctx, m, chatModel.ScheduledMsgStatusFailed, "", err.Error(), 0)
+		return
+	}
+
+	if err := injectScheduledFrame("scheduled", []byte(m.OwnerUserID), value); err != nil {
+		retryScheduledMessage(ctx, m, err)
+		return
+	}
+
+	serverMsgID, err = scheduledDeliveredMsgID(ctx, m)
+	if err != nil {
+		// 状态保持 sending，过期后重新领取时会先查到已落库的消息
+		logger.Errorf("schedule:%v lookup delivered msg error: %s", m.ScheduleID, err)
+		return
+	}
+	status, lastErr := chatModel.ScheduledMsgStatusSent, ""
+	if serverMsgID == "" {
+		// 发送链路回了 NACK（不是群成员/被禁言等），不重试
+		status, lastErr = chatModel.ScheduledMsgStatusFailed, "rejected by send policy"
+	}
+	if err := finishScheduledMessage(ctx, m, status, serverMsgID, lastErr, 0); err != nil {
+		logger.Errorf("schedule:%v finish error: %s", m.ScheduleID, err)
+	}
+}
+
+// retryScheduledMessage 投递失败：按次数退避后放回待发送，超过上限标记失败
+func retryScheduledMessage(ctx context.Context, m *chatModel.ScheduledMessage, cause error) {
+	logger.Errorf("schedule:%v attempt:%d fire error: %s", m.ScheduleID, m.Attempts, cause)
+	status, retryAt := chatModel.ScheduledMsgStatusPending, time.Now().Add(scheduleRetryBase<<uint(m.Attempts)).UnixMilli()
+	if m.Attempts >= scheduleMaxAttempts {
+		status, retryAt = chatModel.ScheduledMsgStatusFailed, 0
+	}
+	if err := finishScheduledMessage(ctx, m, status, "", cause.Error(), retryAt); err != nil {
+		logger.Errorf("schedule:%v requeue error: %s", m.ScheduleID, err)
+	}
+}
@@ -0,0 +1,268 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	chatModel "PProject/module/chat/model"
+	util "PProject/tools"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeSchedule 代替定时消息表和消息表：领取/结束的条件与 Mongo 里的过滤条件一致
+type fakeSchedule struct {
+	mu        sync.Mutex
+	items     []*chatModel.ScheduledMessage
+	delivered map[string]string // client_msg_id -> server_msg_id
+	injects   int
+
+	// inject 注入一帧；默认落库成功
+	inject func(s *fakeSchedule, m *chatModel.ScheduledMessage) error
+	// lookupErr 为 true 时查落库结果失败
+	lookupErr bool
+}
+
+func (f *fakeSchedule) install(t *testing.T) {
+	t.Helper()
+	claim, finish, lookup, inject := claimDueScheduledMessage, finishScheduledMessage, scheduledDeliveredMsgID, injectScheduledFrame
+	t.Cleanup(func() {
+		claimDueScheduledMessage, finishScheduledMessage, scheduledDeliveredMsgID, injectScheduledFrame = claim, finish, lookup, inject
+	})
+	if f.delivered == nil {
+		f.delivered = map[string]string{}
+	}
+
+	claimDueScheduledMessage = func(_ context.Context, nowMS, staleBeforeMS int64, nodeID string) (*chatModel.ScheduledMessage, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		sort.SliceStable(f.items, func(i, j int) bool { return f.items[i].SendAtMS < f.items[j].SendAtMS })
+		for _, m := range f.items {
+			due := m.Status == chatModel.ScheduledMsgStatusPending && m.SendAtMS <= nowMS
+			stale := m.Status == chatModel.ScheduledMsgStatusSending && m.ClaimedAtMS < staleBeforeMS
+			if !due && !stale {
+				continue
+			}
+			m.Status, m.ClaimedBy, m.ClaimedAtMS = chatModel.ScheduledMsgStatusSending, nodeID, nowMS
+			m.Attempts++
+			cp := *m
+			return &cp, nil
+		}
+		return nil, nil
+	}
+	finishScheduledMessage = func(_ context.Context, c *chatModel.ScheduledMessage, status int32, serverMsgID, lastError string, retryAtMS int64) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, m := range f.items {
+			if m.ID != c.ID || m.Status != chatModel.ScheduledMsgStatusSending || m.ClaimedAtMS != c.ClaimedAtMS {
+				continue
+			}
+			m.Status = status
+			if serverMsgID != "" {
+				m.ServerMsgID = serverMsgID
+			}
+			if lastError != "" {
+				m.LastError = lastError
+			}
+			if status == chatModel.ScheduledMsgStatusPending && retryAtMS > 0 {
+				m.SendAtMS = retryAtMS
+			}
+		}
+		return nil
+	}
+	scheduledDeliveredMsgID = func(_ context.Context, m *chatModel.ScheduledMessage) (string, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.lookupErr {
+			return "", errors.New("mongo down")
+		}
+		return f.delivered[m.ClientMsgID], nil
+	}
+	injectScheduledFrame = func(_ string, _ []byte, value []byte) error {
+		frame, err := util.DecodeFrame(value)
+		if err != nil {
+			return err
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.injects++
+		var m *chatModel.ScheduledMessage
+		for _, it := range f.items {
+			if it.ScheduleID == frame.GetMeta()["schedule_id"] {
+				m = it
+			}
+		}
+		if m == nil {
+			return errors.New("unknown schedule")
+		}
+		if f.inject != nil {
+			return f.inject(f, m)
+		}
+		f.delivered[m.ClientMsgID] = "sid-" + m.ScheduleID
+		return nil
+	}
+}
+
+func (f *fakeSchedule) add(t *testing.T, scheduleID string, sendAtMS int64) {
+	t.Helper()
+	payload, err := proto.Marshal(&pb.MessageData{ClientMsgId: "cid-" + scheduleID, RecvId: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.items = append(f.items, &chatModel.ScheduledMessage{
+		ID:             primitive.NewObjectID(),
+		TenantID:       "t1",
+		ScheduleID:     scheduleID,
+		OwnerUserID:    "u1",
+		ConversationID: "si_u1_u2",
+		ClientMsgID:    "cid-" + scheduleID,
+		SendAtMS:       sendAtMS,
+		Status:         chatModel.ScheduledMsgStatusPending,
+		Payload:        payload,
+	})
+}
+
+func (f *fakeSchedule) get(scheduleID string) chatModel.ScheduledMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.items {
+		if m.ScheduleID == scheduleID {
+			return *m
+		}
+	}
+	return chatModel.ScheduledMessage{}
+}
+
+func TestScheduledDeliveredOnce(t *testing.T) {
+	store := &fakeSchedule{}
+	store.install(t)
+	now := time.Now().UnixMilli()
+	store.add(t, "s1", now-1000)
+	store.add(t, "s2", now-500)
+	store.add(t, "s3", now+time.Hour.Milliseconds())
+
+	runScheduledOnce(context.Background())
+	runScheduledOnce(context.Background())
+
+	if store.injects != 2 {
+		t.Fatalf("injects = %d want 2", store.injects)
+	}
+	for _, id := range []string{"s1", "s2"} {
+		m := store.get(id)
+		if m.Status != chatModel.ScheduledMsgStatusSent || m.ServerMsgID != "sid-"+id || m.Attempts != 1 {
+			t.Fatalf("%s = status %d sid %q attempts %d", id, m.Status, m.ServerMsgID, m.Attempts)
+		}
+	}
+	if m := store.get("s3"); m.Status != chatModel.ScheduledMsgStatusPending || m.Attempts != 0 {
+		t.Fatalf("future message touched: %+v", m)
+	}
+}
+
+func TestScheduledAlreadyDeliveredNotReinjected(t *testing.T) {
+	store := &fakeSchedule{delivered: map[string]string{"cid-s1": "sid-old"}}
+	store.install(t)
+	store.add(t, "s1", time.Now().UnixMilli()-1000)
+
+	runScheduledOnce(context.Background())
+
+	if store.injects != 0 {
+		t.Fatalf("injects = %d want 0", store.injects)
+	}
+	if m := store.get("s1"); m.Status != chatModel.ScheduledMsgStatusSent || m.ServerMsgID != "sid-old" {
+		t.Fatalf("s1 = %+v", m)
+	}
+}
+
+func TestScheduledRejectedBySendPolicy(t *testing.T) {
+	// 发送链路回 NACK：注入成功但没有落库，标记失败且不重试
+	store := &fakeSchedule{inject: func(*fakeSchedule, *chatModel.ScheduledMessage) error { return nil }}
+	store.install(t)
+	store.add(t, "s1", time.Now().UnixMilli()-1000)
+
+	runScheduledOnce(context.Background())
+	runScheduledOnce(context.Background())
+
+	m := store.get("s1")
+	if m.Status != chatModel.ScheduledMsgStatusFailed || m.LastError != "rejected by send policy" || store.injects != 1 {
+		t.Fatalf("s1 = status %d err %q injects %d", m.Status, m.LastError, store.injects)
+	}
+}
+
+func TestScheduledRetryBackoffThenFail(t *testing.T) {
+	store := &fakeSchedule{inject: func(*fakeSchedule, *chatModel.ScheduledMessage) error { return errors.New("kafka down") }}
+	store.install(t)
+	store.add(t, "s1", time.Now().UnixMilli()-1000)
+	ctx := context.Background()
+
+	for attempt := int32(1); attempt <= scheduleMaxAttempts; attempt++ {
+		// 退避后的 send_at 在将来，直接用足够晚的时间领取
+		m, err := claimDueScheduledMessage(ctx, time.Now().Add(24*time.Hour).UnixMilli(), 0, "n1")
+		if err != nil || m == nil {
+			t.Fatalf("attempt %d claim = %v, %v", attempt, m, err)
+		}
+		before := time.Now()
+		fireScheduledMessage(ctx, m)
+
+		got := store.get("s1")
+		if attempt < scheduleMaxAttempts {
+			want := before.Add(scheduleRetryBase << uint(attempt)).UnixMilli()
+			if got.Status != chatModel.ScheduledMsgStatusPending || got.SendAtMS < want || got.SendAtMS > want+1000 {
+				t.Fatalf("attempt %d = status %d send_at +%dms", attempt, got.Status, got.SendAtMS-before.UnixMilli())
+			}
+			continue
+		}
+		if got.Status != chatModel.ScheduledMsgStatusFailed || got.LastError != "kafka down" {
+			t.Fatalf("last attempt = status %d err %q", got.Status, got.LastError)
+		}
+	}
+	if store.injects != scheduleMaxAttempts {
+		t.Fatalf("injects = %d want %d", store.injects, scheduleMaxAttempts)
+	}
+	if m, _ := claimDueScheduledMessage(ctx, time.Now().Add(24*time.Hour).UnixMilli(), 0, "n1"); m != nil {
+		t.Fatalf("failed message claimed again: %+v", m)
+	}
+}
+
+func TestScheduledReclaimAfterCrashDoesNotReinject(t *testing.T) {
+	store := &fakeSchedule{}
+	store.install(t)
+	now := time.Now()
+	store.add(t, "s1", now.UnixMilli()-1000)
+	ctx := context.Background()
+
+	// 节点 A 注入成功，但查落库结果失败，状态停在 sending（相当于标记前宕机）
+	m, _ := claimDueScheduledMessage(ctx, now.UnixMilli(), now.Add(-scheduleStaleAfter).UnixMilli(), "a")
+	store.inject = func(s *fakeSchedule, m *chatModel.ScheduledMessage) error {
+		s.delivered[m.ClientMsgID] = "sid-" + m.ScheduleID
+		s.lookupErr = true
+		return nil
+	}
+	fireScheduledMessage(ctx, m)
+	if got := store.get("s1"); got.Status != chatModel.ScheduledMsgStatusSending {
+		t.Fatalf("after crash status = %d", got.Status)
+	}
+	store.lookupErr = false
+
+	// 未过期不能被重新领取
+	if m, _ := claimDueScheduledMessage(ctx, now.Add(time.Minute).UnixMilli(), now.Add(time.Minute-scheduleStaleAfter).UnixMilli(), "b"); m != nil {
+		t.Fatalf("claimed before stale: %+v", m)
+	}
+
+	// 过期后节点 B 重新领取：查到已落库，直接标记完成
+	later := now.Add(scheduleStaleAfter + time.Second)
+	m, _ = claimDueScheduledMessage(ctx, later.UnixMilli(), later.Add(-scheduleStaleAfter).UnixMilli(), "b")
+	if m == nil || m.ClaimedBy != "b" || m.Attempts != 2 {
+		t.Fatalf("reclaim = %+v", m)
+	}
+	fireScheduledMessage(ctx, m)
+
+	got := store.get("s1")
+	if got.Status != chatModel.ScheduledMsgStatusSent || got.ServerMsgID != "sid-s1" || store.injects != 1 {
+		t.Fatalf("s1 = status %d sid %q injects %d", got.Status, got.ServerMsgID, store.injects)
+	}
+}
@@ -0,0 +1,186 @@
+package message
+
+import (
+	pb "PProject/gen/message"
+	"PProject/global/config"
+	"PProject/logger"
+	chatModel "PProject/module/chat/model"
+	seq2 "PProject/module/chat/seq"
+	chatService "PProject/module/chat/service"
+	"PProject/service/chat"
+	"PProject/service/mgo"
+	"PProject/service/storage/redis"
+	"context"
+)
+
+// handleThreadMessage 话题回复：话题ID=根消息 server_msg_id，会话ID=thread:<id>，seq 独立
+// 回复只下发给话题订阅者；父会话只收到根消息的“N 条回复”精简更新
+func handleThreadMessage(ctx context.Context, topic string, key []byte, msg *pb.MessageFrameData) error {
+	tenantID := config.GetTenantID()
+	payload := msg.GetPayload()
+	threadID := payload.GetThreadId()
+	senderID := msg.From
+
+	root, err := chatService.GetThreadRoot(ctx, tenantID, threadID)
+	if err != nil {
+		logger.Errorf("topic key:%v reject thread msg error: %s", topic, err)
+		return sendNackToSender(ctx, topic, key, msg, err)
+	}
+
+	convID := seq2.ThreadConvID(threadID)
+	if _, err := seq2.EnsureSeqConversationByID(ctx, tenantID, convID); err != nil {
+		return err
+	}
+
+	// 幂等放在发言校验之前：重投/重发的消息回原来的回执，不再分配 seq
+	serverMsgID, dup, err := reserveServerMsgID(ctx, tenantID, convID, msg)
+	if err != nil {
+		return err
+	}
+	if dup != nil {
+		return ackDuplicate(ctx, topic, key, msg, dup)
+	}
+
+	// 群里的话题和群消息一样受禁言、媒体大小、慢速模式限制；慢速模式最后占位，落库失败还回去
+	group, err := chatService.CheckThreadAccess(ctx, tenantID, senderID, root, payload)
+	if err == nil {
+		err = chatService.CheckAtAllPolicy(ctx, tenantID, payload)
+	}
+	release := func() {}
+	if err == nil && group != nil {
+		release, err = chatService.ClaimGroupSlowMode(ctx, tenantID, group, senderID)
+	}
+	if err != nil {
+		logger.Errorf("topic key:%v reject thread msg error: %s", topic, err)
+		return sendNackToSender(ctx, topic, key, msg, err)
+	}
+	persisted := false
+	defer func() {
+		if !persisted {
+			release()
+		}
+	}()
+
+	alloc := &seq2.Allocator{
+		Rdb:      redis.GetRedis(),
+		DAO:      &seq2.DAO{DB: mgo.GetDB()},
+		MaxRetry: 5,
+	}
+	start, _, err := alloc.Malloc(ctx, tenantID, convID, 1)
+	if err != nil {
+		return err
+	}
+
+	newMsg, err := chatService.BuildMessageModelFromPB(tenantID, payload, start, convID)
+	if err != nil {
+		logger.Errorf("topic key:%v build thread msg error: %s", topic, err)
+		return err
+	}
+	if serverMsgID != "" {
+		newMsg.ServerMsgID = serverMsgID
+	}
+	newMsg.DedupID = msg.GetDedupId()
+	newMsg.ThreadID = threadID
+	newMsg.GroupID = root.GroupID
+	if newMsg.ReplyTo == "" {
+		newMsg.ReplyTo = threadID
+	}
+
+	if err := chatService.ApplyDestructPolicy(ctx, tenantID, newMsg); err != nil {
+		logger.Errorf("topic key:%v ApplyDestructPolicy error: %s", topic, err)
+	}
+
+	// 自动订阅：根消息作者 + 本次回复者；订阅即在话题会话下有一条会话记录，未读按话题独立计算
+	subscribers := []string{root.SendID}
+	if senderID != root.SendID {
+		subscribers = append(subscribers, senderID)
+	}
+	ack, err := ackToSenderEvent(ctx, tenantID, topic, key, msg, newMsg.ServerMsgID, newMsg.Seq)
+	if err != nil {
+		return err
+	}
+
+	// 消息、seq 水位、订阅者会话、话题摘要在同一个事务里提交；回复下发、父会话更新和发送回执一起写进 outbox
+	data := chatService.BuildPBFromMessageModel(newMsg)
+	var recipients, offline []string
+	events, err := persistMessageTx(ctx, newMsg, func(ctx context.Context) ([]*chatModel.OutboxEvent, error) {
+		conv := chatModel.Conversation{}
+		if err := conv.EnsureGroupConversations(ctx, tenantID, convID, root.GroupID, int32(seq2.ConvTypeThread), subscribers, start); err != nil {
+			return nil, err
+		}
+		summary, err := chatModel.UpdateThreadSummary(ctx, tenantID, root.ServerMsgID, threadID, subscribers, start, newMsg.SendTimeMS)
+		if err != nil {
+			return nil, err
+		}
+
+		// 1) 回复下发给话题订阅者（发送者自己走成功回执）
+		owners, err := conv.ListConversationOwners(ctx, tenantID, convID)
+		if err != nil {
+			return nil, err
+		}
+		recipients = make([]string, 0, len(owners))
+		for _, uid := range owners {
+			if uid != senderID {
+				recipients = append(recipients, uid)
+			}
+		}
+		events, off, err := gatewayDeliveries(ctx, tenantID, newMsg.ServerMsgID, key, convID, recipients, func(gateway string, users []string) *pb.MessageFrameData {
+			return chat.BuildGroupDeliver(gateway, users, data, msg)
+		})
+		if err != nil {
+			logger.Errorf("topic key:%v thread:%v route error: %s", topic, threadID, err)
+			events, off = nil, recipients
+		}
+		offline = off
+
+		// 2) 父会话只收根消息的精简更新
+		parentOwners, err := conv.ListConversationOwners(ctx, tenantID, root.ConversationID)
+		if err != nil {
+			return nil, err
+		}
+		rootLite := &pb.MessageData{
+			ServerMsgId: root.ServerMsgID,
+			ClientMsgId: root.ClientMsgID,
+			Seq:         root.Seq,
+			GroupId:     root.GroupID,
+			SessionType: int32(root.SessionType),
+		}
+		updates, _, err := gatewayDeliveries(ctx, tenantID, newMsg.ServerMsgID, key, root.ConversationID, parentOwners, func(gateway string, users []string) *pb.MessageFrameData {
+			return chat.BuildThreadUpdate(gateway, users, rootLite, summary.ReplyCount, summary.LastReplyMS, msg)
+		})
+		if err != nil {
+			logger.Errorf("topic key:%v thread:%v parent route error: %s", topic, threadID, err)
+		}
+		events = append(events, updates...)
+		if ack != nil {
+			events = append(events, ack)
+		}
+		return events, nil
+	})
+	if err != nil {
+		if dup := duplicateOnInsert(ctx, tenantID, convID, msg, err); dup != nil {
+			return ackDuplicate(ctx, topic, key, msg, dup)
+		}
+		logger.Errorf("topic key:%v persist thread msg error: %s", topic, err)
+		return err
+	}
+	persisted = true
+	publishOutbox(ctx, events)
+
+	if err := chatService.ScheduleDestruct(ctx, tenantID, newMsg); err != nil {
+		logger.Errorf("topic key:%v ScheduleDestruct error: %s", topic, err)
+	}
+	if err := chatService.TouchConversations(ctx, tenantID, convID, subscribers); err != nil {
+		logger.Errorf("topic key:%v TouchConversations error: %s", topic, err)
+	}
+	if err := chatService.IndexMentions(ctx, tenantID, newMsg); err != nil {
+		logger.Errorf("topic key:%v IndexMentions error: %s", topic, err)
+	}
+	if err := chatService.IndexMessageSearch(ctx, tenantID, newMsg); err != nil {
+		logger.Errorf("topic key:%v IndexMessageSearch error: %s", topic, err)
+	}
+
+	enqueueOffline(ctx, offline, data, msg)
+	chatService.NotifyOfflinePush(tenantID, newMsg, recipients, offline)
+	return nil
+}
@@ -0,0 +1,107 @@
+package node
+
+import (
+	"PProject/global/config"
+	"PProject/logger"
+	"PProject/module/chat/seq"
+	msg "PProject/module/message"
+	"PProject/service/bus"
+	"PProject/service/chat"
+	"PProject/service/mgo"
+	"PProject/service/storage/redis"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AllInOne 单进程开发模式：网关、数据节点、API 节点跑在一个进程里
+// Kafka、Redis、Consul 都换成进程内实现，只有 MongoDB 仍需外部实例（MONGO_URI / MONGO_DB 指定）
+// MongoDB 必须是副本集：消息、会话、发件箱在一个事务里写，单机 mongod 不支持事务
+// 依赖的全局单例（redis、registry、总线）只能初始化一次，所以一个进程只能 Start 一次
+type AllInOne struct {
+	Engine *gin.Engine // /chat WebSocket + API 接口
+	Server *chat.Server
+	Bus    *bus.MemoryBus
+	Redis  *redis.MemoryServer
+}
+
+// StartAllInOne 装配所有组件并启动后台任务；mongoWait 内 MongoDB 没连上时返回错误
+func StartAllInOne(ctx context.Context, mongoWait time.Duration) (*AllInOne, error) {
+	config.Global = config.MessageAllInOneConfig
+	config.RunMemoryService("chat-service", config.Global.NodeId, config.Global.Port,
+		map[string]string{"nodeId": config.Global.NodeId})
+	config.ConfigIds()
+	rs := config.ConfigMemoryRedis()
+	if rs == nil {
+		return nil, errors.New("start memory redis failed")
+	}
+	config.ConfigMgo()
+	config.ConfigMiddleware()
+	config.ConfigPush()
+
+	if err := waitMongo(ctx, mongoWait); err != nil {
+		_ = rs.Close()
+		return nil, err
+	}
+	if err := seq.EnsureIndexes(ctx); err != nil {
+		logger.Errorf("ensure indexes error: %v", err)
+	}
+
+	// 网关
+	conn := chat.NewConnManager(config.Global.NodeId)
+	g, err := chat.NewServer(config.Global.NodeId, "", conn, msg.MessageProducerHandler)
+	if err != nil {
+		_ = rs.Close()
+		return nil, err
+	}
+	chatCtx := &chat.ChatContext{S: g}
+	RegisterGatewayHandlers(chatCtx)
+	if err := g.Disp().Run(chatCtx); err != nil {
+		_ = rs.Close()
+		return nil, err
+	}
+	// 没有独立的 router 进程，只跑本地下发循环
+	g.LoopRelayData(ctx)
+
+	// 总线：数据节点和网关在同一进程里各自消费
+	mb := config.ConfigMemoryBus(msg.HandlerDataNodeMessage, msg.HandlerGatewayMessage)
+
+	// 数据节点的后台任务
+	msg.StartDestructScheduler(ctx)
+	msg.StartScheduledMessageScheduler(ctx)
+	msg.StartOutboxRelay(ctx)
+	msg.StartGroupFanoutResumer(ctx)
+	msg.StartBotWebhookDispatcher(ctx)
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET("/chat", g.HandleWS)
+	r.GET("/debug/qos", func(c *gin.Context) { c.JSON(http.StatusOK, g.Qos().Stats()) })
+	RegisterApiRoutes(r)
+
+	return &AllInOne{Engine: r, Server: g, Bus: mb, Redis: rs}, nil
+}
+
+// waitMongo ConfigMgo 是异步连接的，这里轮询到可用为止
+func waitMongo(ctx context.Context, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		if _, ok := mgo.TryGetDB(); ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err := mgo.Err(); err != nil {
+				return err
+			}
+			return errors.New("mongo not ready")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package node
+
+import (
+	pb "PProject/gen/message"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// 端到端：两个客户端连到单进程节点，A 发单聊消息，B 收到下发，A 收到发送成功回执
+// Kafka/Redis/Consul 都在进程内，只需要一个 MongoDB 副本集（消息落库用事务）：
+// PATH 里有 mongod 时测试自己起一个临时副本集，也可以用 PPCHAT_TEST_MONGO_URI 指定现成的
+func TestAllInOneP2P(t *testing.T) {
+	uri := testMongoURI(t)
+	t.Setenv("MONGO_URI", uri)
+	t.Setenv("MONGO_DB", "ppchat_e2e")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	app, err := StartAllInOne(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer app.Redis.Close()
+	defer app.Bus.Close()
+
+	srv := httptest.NewServer(app.Engine)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/chat"
+
+	suffix := time.Now().Format("150405.000")
+	alice, aliceConn := dialAndAuth(t, wsURL, "alice_"+suffix)
+	defer alice.Close()
+	bob, _ := dialAndAuth(t, wsURL, "bob_"+suffix)
+	defer bob.Close()
+
+	clientMsgID := "e2e-" + suffix
+	send := &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_DATA,
+		From:      "alice_" + suffix,
+		To:        "bob_" + suffix,
+		ConnId:    aliceConn,
+		SessionId: aliceConn,
+		Ts:        time.Now().UnixMilli(),
+		Body: &pb.MessageFrameData_Payload{Payload: &pb.MessageData{
+			ClientMsgId: clientMsgID,
+			SendId:      "alice_" + suffix,
+			RecvId:      "bob_" + suffix,
+			ContentType: int32(pb.ContentType_TEXT),
+			TextElem:    &pb.TextElem{Content: "hello from e2e"},
+		}},
+	}
+	writeFrame(t, alice, send)
+
+	got := readUntil(t, bob, func(f *pb.MessageFrameData) bool {
+		return f.GetPayload().GetClientMsgId() == clientMsgID && f.GetPayload().GetTextElem() != nil
+	})
+	if got.GetPayload().GetTextElem().GetContent() != "hello from e2e" {
+		t.Fatalf("bob got %v", got)
+	}
+	if got.GetPayload().GetSeq() <= 0 {
+		t.Fatalf("deliver without seq: %v", got)
+	}
+
+	ack := readUntil(t, alice, func(f *pb.MessageFrameData) bool {
+		return f.GetPayload().GetClientMsgId() == clientMsgID && f.GetPayload().GetServerMsgId() != ""
+	})
+	if ack.GetPayload().GetServerMsgId() != got.GetPayload().GetServerMsgId() {
+		t.Fatalf("ack server_msg_id %q != deliver %q", ack.GetPayload().GetServerMsgId(), got.GetPayload().GetServerMsgId())
+	}
+}
+
+// dialAndAuth 建连、等 CONN 回执拿到连接 ID，再发 AUTH 等鉴权回执
+func dialAndAuth(t *testing.T, url, user string) (*websocket.Conn, string) {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn := readUntil(t, ws, func(f *pb.MessageFrameData) bool { return f.Type == pb.MessageFrameData_CONN })
+	connID := conn.GetConnId()
+
+	data, _ := structpb.NewStruct(map[string]any{"type": "auth", "user_id": user})
+	writeFrame(t, ws, &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_AUTH,
+		From:      user,
+		ConnId:    connID,
+		SessionId: connID,
+		Ts:        time.Now().UnixMilli(),
+		Body: &pb.MessageFrameData_Payload{Payload: &pb.MessageData{
+			CustomElem: &pb.CustomElem{Data: data, Description: "auth"},
+		}},
+	})
+	readUntil(t, ws, func(f *pb.MessageFrameData) bool { return f.Type == pb.MessageFrameData_AUTH })
+	return ws, connID
+}
+
+func writeFrame(t *testing.T, ws *websocket.Conn, f *pb.MessageFrameData) {
+	t.Helper()
+	data, err := protojson.Marshal(f)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// readUntil 读到满足条件的帧为止（中间的 PING 等其它帧跳过）
+func readUntil(t *testing.T, ws *websocket.Conn, match func(*pb.MessageFrameData) bool) *pb.MessageFrameData {
+	t.Helper()
+	_ = ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		f := &pb.MessageFrameData{}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, f); err != nil {
+			continue
+		}
+		if match(f) {
+			return f
+		}
+	}
+}
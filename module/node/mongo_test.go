@@ -0,0 +1,106 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testMongoURI 端到端测试用的 MongoDB 副本集
+// 优先用 PPCHAT_TEST_MONGO_URI；没有时在临时目录起一个单节点副本集（需要 PATH 里有 mongod），都没有才跳过
+func testMongoURI(t *testing.T) string {
+	t.Helper()
+	if uri := os.Getenv("PPCHAT_TEST_MONGO_URI"); uri != "" {
+		return uri
+	}
+	bin, err := exec.LookPath("mongod")
+	if err != nil {
+		t.Skip("all-in-one needs a MongoDB replica set: set PPCHAT_TEST_MONGO_URI or put mongod in PATH")
+	}
+
+	port := freePort(t)
+	dir := t.TempDir()
+	cmd := exec.Command(bin,
+		"--dbpath", dir,
+		"--port", fmt.Sprint(port),
+		"--bind_ip", "127.0.0.1",
+		"--replSet", "rs0",
+		"--logpath", filepath.Join(dir, "mongod.log"),
+	)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start mongod: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	host := fmt.Sprintf("127.0.0.1:%d", port)
+	if err := initReplicaSet(host, 30*time.Second); err != nil {
+		t.Fatalf("init replica set: %v (log: %s)", err, filepath.Join(dir, "mongod.log"))
+	}
+	return fmt.Sprintf("mongodb://%s/?replicaSet=rs0", host)
+}
+
+// initReplicaSet 直连新起的 mongod，初始化成单节点副本集并等到它成为主节点
+func initReplicaSet(host string, wait time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://"+host+"/?directConnection=true"))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	admin := client.Database("admin")
+
+	cfg := bson.D{{Key: "_id", Value: "rs0"}, {Key: "members", Value: bson.A{
+		bson.D{{Key: "_id", Value: 0}, {Key: "host", Value: host}},
+	}}}
+	for {
+		err := admin.RunCommand(ctx, bson.D{{Key: "replSetInitiate", Value: cfg}}).Err()
+		if err == nil {
+			break
+		}
+		if ce, ok := err.(mongo.CommandError); ok && ce.Name == "AlreadyInitialized" {
+			break
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond) // mongod 还没开始监听
+	}
+
+	for {
+		var hello struct {
+			IsWritablePrimary bool `bson:"isWritablePrimary"`
+		}
+		if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err == nil && hello.IsWritablePrimary {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
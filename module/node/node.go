@@ -0,0 +1,118 @@
+package node
+
+import (
+	mid "PProject/middleware"
+	chatApi "PProject/module/chat"
+	"PProject/module/manage"
+	"PProject/module/message/handler"
+	"PProject/module/user"
+	"PProject/service/chat"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 各节点共用的装配：网关的帧处理器、API 节点的 HTTP 路由
+// chatgateway.go / chatDataNode.go / chatApiNode.go 和单进程模式都从这里注册，避免几份列表各改各的
+
+// RegisterGatewayHandlers 注册网关处理 WS 帧的 handler
+func RegisterGatewayHandlers(chatCtx *chat.ChatContext) {
+	d := chatCtx.S.Disp()
+	d.Register(handler.NewConnectHandler(chatCtx))
+	d.Register(handler.NewPingHandler(chatCtx))
+	d.Register(handler.NewAuthHandler(chatCtx))
+	d.Register(handler.NewAckHandler(chatCtx))
+	d.Register(handler.NewDataHandler(chatCtx))
+	d.Register(handler.NewCAckHandler(chatCtx))
+	d.Register(handler.NewCNackHandler(chatCtx))
+	d.Register(handler.NewRelayHandler(chatCtx))
+	d.Register(handler.NewPresenceHandler(chatCtx))
+	d.Register(handler.NewSyncHandler(chatCtx))
+	handler.StartChannelHub(chatCtx)
+}
+
+// RegisterApiRoutes 注册 API 节点的 HTTP 接口
+func RegisterApiRoutes(r gin.IRoutes) {
+	mid.POST(r, "/login", user.HandlerLogin, mid.RouteOpt{IsAuth: false})
+	mid.POST(r, "/check", user.HandlerCheck, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/user", user.HandleUserInfo, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/user/push/register", user.HandlerRegisterPushDevice, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/user/push/unregister", user.HandlerUnregisterPushDevice, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/user/push/background", user.HandlerPushBackground, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/user/push/badge", user.HandlerResetBadge, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/history", chatApi.HandlerListHistory, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/search", chatApi.HandlerSearchMessages, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/mentions", chatApi.HandlerListMentions, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/read", chatApi.HandlerMarkRead, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/schedule", chatApi.HandlerScheduleMessage, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/schedule/list", chatApi.HandlerListScheduledMessages, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/schedule/update", chatApi.HandlerUpdateScheduledMessage, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/message/schedule/cancel", chatApi.HandlerCancelScheduledMessage, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/conversation/list", chatApi.HandlerListConversations, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/conversation/sync", chatApi.HandlerSyncConversations, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/conversation/update", chatApi.HandlerUpdateConversation, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/presence/subscribe", chatApi.HandlerSubscribePresence, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/presence/unsubscribe", chatApi.HandlerUnsubscribePresence, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/presence/privacy", chatApi.HandlerSetLastSeenPrivacy, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/friend/request", chatApi.HandlerSendFriendRequest, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/friend/request/handle", chatApi.HandlerHandleFriendRequest, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/friend/request/list", chatApi.HandlerListFriendRequests, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/friend/list", chatApi.HandlerListFriends, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/friend/update", chatApi.HandlerUpdateFriend, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/friend/delete", chatApi.HandlerDeleteFriend, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/black/add", chatApi.HandlerAddBlack, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/black/remove", chatApi.HandlerRemoveBlack, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/black/list", chatApi.HandlerListBlacks, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/create", chatApi.HandlerCreateGroup, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/info", chatApi.HandlerGetGroupInfo, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/update", chatApi.HandlerUpdateGroup, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/announcement", chatApi.HandlerSetGroupAnnouncement, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/dismiss", chatApi.HandlerDismissGroup, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/join", chatApi.HandlerJoinGroup, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/quit", chatApi.HandlerQuitGroup, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/request/list", chatApi.HandlerListGroupRequests, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/request/handle", chatApi.HandlerHandleGroupRequest, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/link/rotate", chatApi.HandlerRotateGroupInviteLink, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/member/list", chatApi.HandlerListGroupMembers, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/member/add", chatApi.HandlerAddGroupMembers, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/member/kick", chatApi.HandlerKickGroupMembers, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/admin/set", chatApi.HandlerSetGroupAdmin, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/transfer", chatApi.HandlerTransferGroupOwner, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/member/mute", chatApi.HandlerMuteGroupMember, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/moderation", chatApi.HandlerUpdateGroupModeration, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/ban", chatApi.HandlerBanGroupMember, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/unban", chatApi.HandlerUnbanGroupMember, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/ban/list", chatApi.HandlerListGroupBans, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/group/freeze", chatApi.HandlerFreezeGroup, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/channel/list", chatApi.HandlerListChannels, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/channel/read", chatApi.HandlerMarkChannelRead, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/channel/publisher", chatApi.HandlerSetChannelPublisher, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/create", chatApi.HandlerCreateGuild, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/info", chatApi.HandlerGetGuild, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/list", chatApi.HandlerListGuilds, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/join", chatApi.HandlerJoinGuild, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/leave", chatApi.HandlerLeaveGuild, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/member/kick", chatApi.HandlerKickGuildMember, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/member/role", chatApi.HandlerSetGuildMemberRole, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/channel/create", chatApi.HandlerCreateGuildChannel, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/channel/update", chatApi.HandlerUpdateGuildChannel, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/channel/delete", chatApi.HandlerDeleteGuildChannel, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/channel/list", chatApi.HandlerListGuildChannels, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/channel/overwrite", chatApi.HandlerSetChannelOverwrite, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/role/list", chatApi.HandlerListGuildRoles, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/role/create", chatApi.HandlerCreateGuildRole, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/role/update", chatApi.HandlerUpdateGuildRole, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/role/delete", chatApi.HandlerDeleteGuildRole, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/guild/permissions", chatApi.HandlerGetGuildPermissions, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/bot/create", chatApi.HandlerCreateBot, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/bot/update", chatApi.HandlerUpdateBot, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/bot/token/reset", chatApi.HandlerResetBotToken, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/bot/list", chatApi.HandlerListBots, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/bot/interaction", chatApi.HandlerCreateInteraction, mid.RouteOpt{IsAuth: true})
+	// 机器人 API 用 Bot token 鉴权，不走用户 JWT
+	mid.POST(r, "/bot/message/send", chatApi.HandlerBotSendMessage, mid.RouteOpt{IsAuth: false})
+	mid.POST(r, "/bot/interaction/respond", chatApi.HandlerRespondInteraction, mid.RouteOpt{IsAuth: false})
+	mid.POST(r, "/admin/kafka/dlq/list", manage.HandlerListDLQ, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/admin/kafka/dlq/replay", manage.HandlerReplayDLQ, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/admin/search/rebuild", manage.HandlerRebuildSearchIndex, mid.RouteOpt{IsAuth: true})
+	mid.POST(r, "/admin/bot/intents", manage.HandlerGrantBotIntents, mid.RouteOpt{IsAuth: true})
+}
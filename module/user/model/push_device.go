@@ -0,0 +1,133 @@
+package model
+
+import (
+	mgo "PProject/service/mgo"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PushDevice collection field constants
+const (
+	PushDeviceFieldTenantID   = "tenant_id"
+	PushDeviceFieldUserID     = "user_id"
+	PushDeviceFieldDeviceID   = "device_id"
+	PushDeviceFieldPlatform   = "platform"
+	PushDeviceFieldToken      = "token"
+	PushDeviceFieldBackground = "background"
+	PushDeviceFieldCreateTime = "create_time"
+	PushDeviceFieldUpdateTime = "update_time"
+)
+
+// PushDevice 用户设备的离线推送 token，一台设备一条（唯一键: tenant_id+user_id+device_id）
+type PushDevice struct {
+	TenantID   string    `bson:"tenant_id" json:"tenant_id"`
+	UserID     string    `bson:"user_id" json:"user_id"`
+	DeviceID   string    `bson:"device_id" json:"device_id"`
+	Platform   string    `bson:"platform" json:"platform"`     // ios/android
+	Token      string    `bson:"token" json:"token"`           // APNs device token / FCM registration token
+	Background bool      `bson:"background" json:"background"` // App 在后台（连接还在也需要推送）
+	CreateTime time.Time `bson:"create_time" json:"create_time"`
+	UpdateTime time.Time `bson:"update_time" json:"update_time"`
+}
+
+func (sess *PushDevice) GetTableName() string {
+	return "push_device"
+}
+
+func (sess *PushDevice) Collection() *mongo.Collection {
+	return mgo.GetDB().Collection(sess.GetTableName())
+}
+
+// UpsertPushDevice 注册/刷新设备 token；同一个 token 换了账号登录时，从旧账号上摘掉
+func (sess *PushDevice) UpsertPushDevice(ctx context.Context, d *PushDevice) error {
+	now := time.Now()
+	_, err := sess.Collection().DeleteMany(ctx, bson.M{
+		PushDeviceFieldTenantID: d.TenantID,
+		PushDeviceFieldToken:    d.Token,
+		"$or": bson.A{
+			bson.M{PushDeviceFieldUserID: bson.M{"$ne": d.UserID}},
+			bson.M{PushDeviceFieldDeviceID: bson.M{"$ne": d.DeviceID}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = sess.Collection().UpdateOne(ctx,
+		bson.M{
+			PushDeviceFieldTenantID: d.TenantID,
+			PushDeviceFieldUserID:   d.UserID,
+			PushDeviceFieldDeviceID: d.DeviceID,
+		},
+		bson.M{
+			"$set": bson.M{
+				PushDeviceFieldPlatform:   d.Platform,
+				PushDeviceFieldToken:      d.Token,
+				PushDeviceFieldBackground: d.Background,
+				PushDeviceFieldUpdateTime: now,
+			},
+			"$setOnInsert": bson.M{PushDeviceFieldCreateTime: now},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// RemovePushDevice 注销设备（登出/关闭推送）
+func (sess *PushDevice) RemovePushDevice(ctx context.Context, tenantID, userID, deviceID string) error {
+	_, err := sess.Collection().DeleteOne(ctx, bson.M{
+		PushDeviceFieldTenantID: tenantID,
+		PushDeviceFieldUserID:   userID,
+		PushDeviceFieldDeviceID: deviceID,
+	})
+	return err
+}
+
+// RemovePushToken 推送通道反馈 token 失效时删除
+func (sess *PushDevice) RemovePushToken(ctx context.Context, tenantID, token string) error {
+	_, err := sess.Collection().DeleteMany(ctx, bson.M{
+		PushDeviceFieldTenantID: tenantID,
+		PushDeviceFieldToken:    token,
+	})
+	return err
+}
+
+// SetDeviceBackground 客户端切前台/后台时上报
+func (sess *PushDevice) SetDeviceBackground(ctx context.Context, tenantID, userID, deviceID string, background bool) (bool, error) {
+	res, err := sess.Collection().UpdateOne(ctx,
+		bson.M{
+			PushDeviceFieldTenantID: tenantID,
+			PushDeviceFieldUserID:   userID,
+			PushDeviceFieldDeviceID: deviceID,
+		},
+		bson.M{"$set": bson.M{
+			PushDeviceFieldBackground: background,
+			PushDeviceFieldUpdateTime: time.Now(),
+		}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ListPushDevices 一批用户的推送设备
+func (sess *PushDevice) ListPushDevices(ctx context.Context, tenantID string, userIDs []string) ([]*PushDevice, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	cur, err := sess.Collection().Find(ctx, bson.M{
+		PushDeviceFieldTenantID: tenantID,
+		PushDeviceFieldUserID:   bson.M{"$in": userIDs},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []*PushDevice
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -1,10 +1,13 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	mgo "PProject/service/mgo"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -22,6 +25,14 @@ const (
 	RoleOwner int32 = 2
 )
 
+// AccountType
+const (
+	AccountUser   int32 = 0
+	AccountAgent  int32 = 1
+	AccountBot    int32 = 2
+	AccountSystem int32 = 3
+)
+
 // Status
 const (
 	UserNormal   int32 = 0
@@ -47,6 +58,9 @@ type User struct {
 	IsDeleted      bool       `bson:"is_deleted,omitempty" json:"IsDeleted"`     // 逻辑删除标记
 	DeletedAt      *time.Time `bson:"deleted_at,omitempty" json:"DeletedAt"`     // 逻辑删除时间
 
+	// —— 网关 ——
+	PrivilegedIntents int64 `bson:"privileged_intents,omitempty" json:"PrivilegedIntents"` // 已开通的特权意图（机器人）
+
 	// —— 全局消息偏好/通知 ——
 	GlobalRecvMsgOpt int32      `bson:"global_recv_msg_opt" json:"GlobalRecvMsgOpt"` // 0=接收并提醒,1=接收不提醒,2=屏蔽
 	MuteUntil        *time.Time `bson:"mute_until,omitempty" json:"MuteUntil"`       // 全局免打扰至某时（可空）
@@ -97,3 +111,32 @@ func (u *User) GetTableName() string {
 func (u *User) Collection() *mongo.Collection {
 	return mgo.GetDB().Collection(u.GetTableName())
 }
+
+// GetUserByID 查用户主档，不存在返回 nil
+func (u *User) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	var out User
+	err := u.Collection().FindOne(ctx, bson.M{"user_id": userID}).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListUsersByIDs 批量查用户主档
+func (u *User) ListUsersByIDs(ctx context.Context, userIDs []string) ([]*User, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	cur, err := u.Collection().Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var list []*User
+	if err := cur.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,123 @@
+package user
+
+import (
+	"PProject/global"
+	"PProject/global/config"
+	"PProject/logger"
+	usermodel "PProject/module/user/model"
+	service "PProject/module/user/service"
+	"PProject/tools/errs"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PushDeviceParams struct {
+	DeviceID   string `json:"device_id"`
+	Platform   string `json:"platform"` // ios/android
+	Token      string `json:"token"`
+	Background bool   `json:"background"`
+}
+
+type BadgeParams struct {
+	Unread int64 `json:"unread"` // 客户端当前未读总数
+}
+
+func toCodeError(err error) *errs.CodeError {
+	var codeErr *errs.CodeError
+	if errors.As(err, &codeErr) {
+		return codeErr
+	}
+	return &errs.ErrInternalServer
+}
+
+// HandlerRegisterPushDevice 上报/刷新推送 token
+func HandlerRegisterPushDevice(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+	var in PushDeviceParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	err = service.RegisterPushDevice(c.Request.Context(), &usermodel.PushDevice{
+		TenantID:   config.GetTenantID(),
+		UserID:     authInfo.UserId,
+		DeviceID:   in.DeviceID,
+		Platform:   in.Platform,
+		Token:      in.Token,
+		Background: in.Background,
+	})
+	if err != nil {
+		logger.Errorf("register push device user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerUnregisterPushDevice 注销推送设备
+func HandlerUnregisterPushDevice(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+	var in PushDeviceParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := service.UnregisterPushDevice(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.DeviceID); err != nil {
+		logger.Errorf("unregister push device user=%s err=%v", authInfo.UserId, err)
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerPushBackground 客户端切前台/后台
+func HandlerPushBackground(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+	var in PushDeviceParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := service.SetPushBackground(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.DeviceID, in.Background); err != nil {
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
+
+// HandlerResetBadge 重置角标
+func HandlerResetBadge(c *gin.Context) {
+	authInfo, err := global.GetAuthInfo(c)
+	if err != nil {
+		c.JSON(http.StatusOK, errs.ErrTokenInvalid)
+		return
+	}
+	var in BadgeParams
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusOK, errs.ErrArgs)
+		return
+	}
+
+	if err := service.ResetBadge(c.Request.Context(), config.GetTenantID(), authInfo.UserId, in.Unread); err != nil {
+		c.JSON(http.StatusOK, toCodeError(err))
+		return
+	}
+	c.JSON(http.StatusOK, global.Sucess(nil))
+}
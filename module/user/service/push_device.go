@@ -0,0 +1,49 @@
+package service
+
+import (
+	usermodel "PProject/module/user/model"
+	"PProject/service/push"
+	"PProject/tools/errs"
+	"context"
+	"strings"
+)
+
+// RegisterPushDevice 客户端登录/token 刷新后上报推送 token
+func RegisterPushDevice(ctx context.Context, d *usermodel.PushDevice) error {
+	d.Token = strings.TrimSpace(d.Token)
+	if d.UserID == "" || d.DeviceID == "" || d.Token == "" {
+		return errs.ErrArgs.WrapMsg("user_id/device_id/token required")
+	}
+	if d.Platform != push.PlatformIOS && d.Platform != push.PlatformAndroid {
+		return errs.ErrArgs.WrapMsg("unsupported platform", "platform", d.Platform)
+	}
+	pd := usermodel.PushDevice{}
+	return pd.UpsertPushDevice(ctx, d)
+}
+
+// UnregisterPushDevice 登出/关闭通知时注销设备
+func UnregisterPushDevice(ctx context.Context, tenantID, userID, deviceID string) error {
+	if deviceID == "" {
+		return errs.ErrArgs.WrapMsg("device_id required")
+	}
+	pd := usermodel.PushDevice{}
+	return pd.RemovePushDevice(ctx, tenantID, userID, deviceID)
+}
+
+// SetPushBackground 客户端切前后台：在后台时即使长连接还在也推送
+func SetPushBackground(ctx context.Context, tenantID, userID, deviceID string, background bool) error {
+	pd := usermodel.PushDevice{}
+	ok, err := pd.SetDeviceBackground(ctx, tenantID, userID, deviceID, background)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errs.ErrRecordNotFound.WrapMsg("push device not registered", "device_id", deviceID)
+	}
+	return nil
+}
+
+// ResetBadge 客户端打开/已读后上报当前未读总数，作为新的角标基数
+func ResetBadge(ctx context.Context, tenantID, userID string, unread int64) error {
+	return push.SetBadge(ctx, tenantID, userID, unread)
+}
@@ -0,0 +1,128 @@
+package bus
+
+import (
+	"PProject/service/natsx"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ===== 消息总线：节点只依赖这里，后端（Kafka / NATS JetStream）由配置决定 =====
+
+const (
+	BackendKafka = "kafka"
+	BackendNats  = "nats"
+)
+
+// HeaderMsgID 消息唯一 ID（发布方填），幂等中间件按它去重
+const HeaderMsgID = "X-Msg-Id"
+
+// Message 统一消息：Key 决定分区/顺序
+// 顺序保证：Kafka 同一个 key 落同一分区，按发送顺序消费；内存总线同一个 key 串行
+// NATS 没有分区，默认同一消费组内并发投递、重投会插队，同一个 key 也可能乱序；需要顺序时开 NatsConfig.Ordered
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Handler 处理函数：返回 nil 即确认；返回错误交给后端重投（Kafka 走重试 topic/死信，JetStream Nak）
+type Handler func(ctx context.Context, m *Message) error
+
+// Middleware 中间件（幂等、日志、指标等），两种后端都生效
+type Middleware func(Handler) Handler
+
+// Chain 组合中间件：mws[0] 在最外层
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Bus 后端需要实现的能力
+type Bus interface {
+	Name() string
+	// Publish 发送一条消息
+	Publish(ctx context.Context, m *Message) error
+	// Subscribe 以消费组 group 订阅 topics：同组内负载分摊，不同组各收一份；不阻塞，ctx 结束后停止消费
+	Subscribe(ctx context.Context, group string, topics []string, h Handler) error
+	Close() error
+}
+
+var (
+	mu         sync.RWMutex
+	defaultBus Bus
+	globalMws  []Middleware
+)
+
+// SetDefault 设置全局总线（启动时由配置选择后端）
+func SetDefault(b Bus) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultBus = b
+}
+
+// Default 全局总线，未配置时为 nil
+func Default() Bus {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultBus
+}
+
+// Use 追加全局中间件；在 Subscribe 之前调用才会生效
+func Use(mws ...Middleware) {
+	mu.Lock()
+	defer mu.Unlock()
+	globalMws = append(globalMws, mws...)
+}
+
+func middlewares() []Middleware {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Middleware(nil), globalMws...)
+}
+
+// Publish 通过全局总线发送
+func Publish(ctx context.Context, m *Message) error {
+	b := Default()
+	if b == nil {
+		return errors.New("message bus not configured")
+	}
+	return b.Publish(ctx, m)
+}
+
+// FromMessageHandler 适配老的 (topic, key, value) 处理函数
+func FromMessageHandler(h func(topic string, key, value []byte) error) Handler {
+	return func(_ context.Context, m *Message) error {
+		return h(m.Topic, m.Key, m.Value)
+	}
+}
+
+// WithMsgID 只对带 HeaderMsgID 的消息套用 mw：没有 ID 的消息无法可靠去重，按内容猜 ID 会误吞相同内容的消息
+func WithMsgID(mw Middleware) Middleware {
+	return func(next Handler) Handler {
+		wrapped := mw(next)
+		return func(ctx context.Context, m *Message) error {
+			if m.Headers[HeaderMsgID] == "" {
+				return next(ctx, m)
+			}
+			return wrapped(ctx, m)
+		}
+	}
+}
+
+// FromNatsx 把 natsx 的中间件（如 NatsxIdemMiddleware）用在总线上
+func FromNatsx(mw natsx.NatsxMiddleware) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *Message) error {
+			inner := mw(func(ctx context.Context, nm natsx.NatsxMessage) error {
+				out := *m
+				out.Topic, out.Value, out.Headers = nm.Subject, nm.Data, nm.Header
+				return next(ctx, &out)
+			})
+			return inner(ctx, natsx.NatsxMessage{Subject: m.Topic, Data: m.Value, Header: m.Headers})
+		}
+	}
+}
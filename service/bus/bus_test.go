@@ -0,0 +1,223 @@
+package bus
+
+import (
+	"PProject/service/natsx"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFromNatsxIdemMiddleware(t *testing.T) {
+	calls := 0
+	h := Chain(func(ctx context.Context, m *Message) error {
+		calls++
+		if string(m.Key) != "u1" {
+			t.Fatalf("key lost through natsx middleware: %q", m.Key)
+		}
+		return nil
+	}, FromNatsx(natsx.NatsxIdemMiddleware(natsx.NewMemIdem(time.Minute), time.Minute, time.Minute)))
+
+	m := &Message{Topic: "t", Key: []byte("u1"), Value: []byte("v"), Headers: map[string]string{"X-Msg-Id": "m1"}}
+	for i := 0; i < 3; i++ {
+		if err := h(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+
+	m2 := &Message{Topic: "t", Key: []byte("u1"), Value: []byte("v"), Headers: map[string]string{"X-Msg-Id": "m2"}}
+	if err := h(context.Background(), m2); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestIdemOnlyWithMsgIDAndRetryAfterFailure(t *testing.T) {
+	calls, fail := 0, true
+	h := Chain(func(ctx context.Context, m *Message) error {
+		calls++
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	}, WithMsgID(FromNatsx(natsx.NatsxIdemMiddleware(natsx.NewMemIdem(time.Minute), time.Minute, time.Minute))))
+
+	// 没有消息 ID 的不去重：相同内容的两条都要处理
+	fail = false
+	plain := &Message{Topic: "t", Value: []byte("same")}
+	_ = h(context.Background(), plain)
+	_ = h(context.Background(), plain)
+	if calls != 2 {
+		t.Fatalf("messages without id deduped: calls=%d", calls)
+	}
+
+	// 处理失败的重投还要再处理一次，成功后才去重
+	calls, fail = 0, true
+	m := &Message{Topic: "t", Value: []byte("v"), Headers: map[string]string{HeaderMsgID: "m1"}}
+	if err := h(context.Background(), m); err == nil {
+		t.Fatal("expected failure")
+	}
+	fail = false
+	_ = h(context.Background(), m)
+	_ = h(context.Background(), m)
+	if calls != 2 {
+		t.Fatalf("calls = %d, want 2 (failed + redelivered)", calls)
+	}
+}
+
+func TestIdemCrashAndConcurrentDelivery(t *testing.T) {
+	store := natsx.NewMemIdem(time.Minute)
+	calls, fail := 0, false
+	h := Chain(func(ctx context.Context, m *Message) error {
+		calls++
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	}, WithMsgID(FromNatsx(natsx.NatsxIdemMiddleware(store, 50*time.Millisecond, time.Minute))))
+	m := &Message{Topic: "t", Value: []byte("v"), Headers: map[string]string{HeaderMsgID: "m1"}}
+
+	// 上一次投递写了处理中标记后进程崩溃：标记有效期内的重投不能 ack，过期后要能再处理
+	if _, _, err := store.Begin("m1", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := h(context.Background(), m); !errors.Is(err, natsx.ErrIdemInFlight) {
+		t.Fatalf("redelivery during processing: err=%v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := h(context.Background(), m); err != nil || calls != 1 {
+		t.Fatalf("redelivery after crash: err=%v calls=%d", err, calls)
+	}
+	if err := h(context.Background(), m); err != nil || calls != 1 {
+		t.Fatalf("duplicate after success: err=%v calls=%d", err, calls)
+	}
+
+	// 并发的重复投递被拒后，第一次处理失败：重投还要再处理
+	m2 := &Message{Topic: "t", Value: []byte("v"), Headers: map[string]string{HeaderMsgID: "m2"}}
+	calls, fail = 0, true
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := Chain(func(ctx context.Context, m *Message) error {
+		close(started)
+		<-release
+		return errors.New("boom")
+	}, WithMsgID(FromNatsx(natsx.NatsxIdemMiddleware(store, time.Minute, time.Minute))))
+	errC := make(chan error, 1)
+	go func() { errC <- slow(context.Background(), m2) }()
+	<-started
+	if err := h(context.Background(), m2); !errors.Is(err, natsx.ErrIdemInFlight) {
+		t.Fatalf("concurrent duplicate: err=%v", err)
+	}
+	close(release)
+	if err := <-errC; err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+	fail = false
+	if err := h(context.Background(), m2); err != nil || calls != 1 {
+		t.Fatalf("redelivery after failed attempt: err=%v calls=%d", err, calls)
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, m *Message) error {
+				order = append(order, name)
+				return next(ctx, m)
+			}
+		}
+	}
+	h := Chain(func(ctx context.Context, m *Message) error {
+		order = append(order, "h")
+		return nil
+	}, mw("a"), mw("b"))
+	_ = h(context.Background(), &Message{})
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "h" {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
+
+func TestMemoryBusGroupsAndOrder(t *testing.T) {
+	b := NewMemoryBus(MemoryConfig{Partitions: 3, RetryDelays: []time.Duration{time.Millisecond}})
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	got := map[string][]string{}
+	record := func(group string) Handler {
+		return func(_ context.Context, m *Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[group+"|"+string(m.Key)] = append(got[group+"|"+string(m.Key)], string(m.Value))
+			return nil
+		}
+	}
+	// 同组两个订阅者分摊，另一个组各收一份
+	_ = b.Subscribe(ctx, "g1", []string{"t"}, record("g1"))
+	_ = b.Subscribe(ctx, "g1", []string{"t"}, record("g1"))
+	_ = b.Subscribe(ctx, "g2", []string{"t"}, record("g2"))
+
+	for i := 0; i < 20; i++ {
+		for _, k := range []string{"a", "b"} {
+			_ = b.Publish(ctx, &Message{Topic: "t", Key: []byte(k), Value: []byte(fmt.Sprint(i))})
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := 0
+		for _, v := range got {
+			n += len(v)
+		}
+		mu.Unlock()
+		if n == 80 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivered %d of 80", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for k, vals := range got {
+		for i, v := range vals {
+			if v != fmt.Sprint(i) {
+				t.Fatalf("%s out of order: %v", k, vals)
+			}
+		}
+	}
+}
+
+func TestMemoryBusRetryThenDeadLetter(t *testing.T) {
+	b := NewMemoryBus(MemoryConfig{RetryDelays: []time.Duration{time.Millisecond, time.Millisecond}})
+	defer b.Close()
+
+	var calls atomic.Int32
+	_ = b.Subscribe(context.Background(), "g", []string{"t"}, func(context.Context, *Message) error {
+		calls.Add(1)
+		return errors.New("boom")
+	})
+	_ = b.Publish(context.Background(), &Message{Topic: "t", Value: []byte("x")})
+
+	deadline := time.Now().Add(time.Second)
+	for len(b.DeadLetters()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("message never reached dead letters")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("calls = %d, want 3", calls.Load())
+	}
+}
@@ -0,0 +1,65 @@
+package bus
+
+import (
+	"PProject/logger"
+	ka "PProject/service/dispatcher/kafka"
+	"context"
+	"errors"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaBus Kafka 后端：复用 dispatcher/kafka 的生产者、消费组和失败重试/死信
+type KafkaBus struct {
+	cfg *ka.AppConfig
+}
+
+func NewKafkaBus(cfg *ka.AppConfig) *KafkaBus {
+	return &KafkaBus{cfg: cfg}
+}
+
+func (b *KafkaBus) Name() string { return BackendKafka }
+
+func (b *KafkaBus) Publish(_ context.Context, m *Message) error {
+	if ka.Producer == nil {
+		return errors.New("kafka producer not initialized")
+	}
+	pm := &sarama.ProducerMessage{
+		Topic: m.Topic,
+		Key:   sarama.ByteEncoder(m.Key),
+		Value: sarama.ByteEncoder(m.Value),
+	}
+	for k, v := range m.Headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	_, _, err := ka.Producer.SendMessage(pm)
+	return err
+}
+
+// Bind 只注册处理函数（带全局中间件），消费组由调用方启动（ka.BootConsumers）
+func (b *KafkaBus) Bind(topics []string, h Handler) {
+	h = Chain(h, middlewares()...)
+	for _, t := range topics {
+		ka.RegisterRecordHandler(t, func(ctx context.Context, r *ka.Record) error {
+			return h(ctx, &Message{Topic: r.Topic, Key: r.Key, Value: r.Value, Headers: r.Headers})
+		})
+	}
+}
+
+func (b *KafkaBus) Subscribe(ctx context.Context, group string, topics []string, h Handler) error {
+	b.Bind(topics, h)
+	all := append(append([]string(nil), topics...), b.cfg.RetryTopicsFor(topics)...)
+	go func() {
+		if err := ka.StartConsumerGroupCtx(ctx, b.cfg.Brokers, group, all); err != nil {
+			logger.Errorf("[bus] kafka consumer group %s quit: %v", group, err)
+		}
+	}()
+	return nil
+}
+
+func (b *KafkaBus) Close() error {
+	if ka.Producer != nil {
+		return ka.Producer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package bus
+
+import (
+	"PProject/logger"
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const BackendMemory = "memory"
+
+// MemoryConfig 进程内总线配置
+type MemoryConfig struct {
+	Partitions  int             // 每个 topic 的分区数，默认 4；同一个 key 固定落在同一分区
+	RetryDelays []time.Duration // 处理失败后的重投间隔，用完后进死信；默认 50ms/200ms/1s
+}
+
+// DeadLetter 重投用尽仍失败的消息
+type DeadLetter struct {
+	Group   string
+	Message Message
+	Err     string
+	At      time.Time
+}
+
+// MemoryBus 进程内总线（单进程开发模式、端到端测试用），语义对齐 Kafka 后端：
+// 同一 key 按发送顺序消费；同组内按分区分摊，不同组各收一份；失败按 RetryDelays 重投，最终进死信
+// 发布时还没有任何消费组订阅的 topic，消息直接丢弃
+type MemoryBus struct {
+	cfg MemoryConfig
+
+	mu     sync.Mutex
+	topics map[string]map[string]*memGroup // topic -> group
+	dead   []DeadLetter
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewMemoryBus(cfg MemoryConfig) *MemoryBus {
+	if cfg.Partitions <= 0 {
+		cfg.Partitions = 4
+	}
+	if cfg.RetryDelays == nil {
+		cfg.RetryDelays = []time.Duration{50 * time.Millisecond, 200 * time.Millisecond, time.Second}
+	}
+	return &MemoryBus{cfg: cfg, topics: make(map[string]map[string]*memGroup)}
+}
+
+func (b *MemoryBus) Name() string { return BackendMemory }
+
+func partitionOf(key []byte, n int) int {
+	if len(key) == 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(n))
+}
+
+func (b *MemoryBus) Publish(_ context.Context, m *Message) error {
+	cp := cloneMessage(m)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("memory bus closed")
+	}
+	p := partitionOf(cp.Key, b.cfg.Partitions)
+	for _, g := range b.topics[cp.Topic] {
+		g.parts[p].push(cp)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, group string, topics []string, h Handler) error {
+	h = Chain(h, middlewares()...)
+	sub := &memSub{h: h, ctx: ctx}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errors.New("memory bus closed")
+	}
+	groups := make([]*memGroup, 0, len(topics))
+	for _, t := range topics {
+		if b.topics[t] == nil {
+			b.topics[t] = make(map[string]*memGroup)
+		}
+		g := b.topics[t][group]
+		if g == nil {
+			g = b.newGroup(group)
+			b.topics[t][group] = g
+		}
+		g.add(sub)
+		groups = append(groups, g)
+	}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		for _, g := range groups {
+			g.remove(sub)
+		}
+	}()
+	return nil
+}
+
+// DeadLetters 重投用尽的消息（排查用）
+func (b *MemoryBus) DeadLetters() []DeadLetter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]DeadLetter(nil), b.dead...)
+}
+
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	for _, groups := range b.topics {
+		for _, g := range groups {
+			for _, q := range g.parts {
+				q.close()
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return nil
+}
+
+func cloneMessage(m *Message) *Message {
+	cp := &Message{
+		Topic: m.Topic,
+		Key:   append([]byte(nil), m.Key...),
+		Value: append([]byte(nil), m.Value...),
+	}
+	if m.Headers != nil {
+		cp.Headers = make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			cp.Headers[k] = v
+		}
+	}
+	return cp
+}
+
+// ---------- 消费组 ----------
+
+type memSub struct {
+	h   Handler
+	ctx context.Context
+}
+
+// memGroup 一个 topic 上的一个消费组：每个分区一个协程顺序消费，分区按下标分给组内订阅者
+type memGroup struct {
+	name  string
+	parts []*memQueue
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	subs []*memSub
+}
+
+func (b *MemoryBus) newGroup(name string) *memGroup {
+	g := &memGroup{name: name, parts: make([]*memQueue, b.cfg.Partitions)}
+	g.cond = sync.NewCond(&g.mu)
+	for i := range g.parts {
+		g.parts[i] = newMemQueue()
+		b.wg.Add(1)
+		go b.consume(g, i)
+	}
+	return g
+}
+
+func (g *memGroup) add(s *memSub) {
+	g.mu.Lock()
+	g.subs = append(g.subs, s)
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+func (g *memGroup) remove(s *memSub) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, x := range g.subs {
+		if x == s {
+			g.subs = append(g.subs[:i], g.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// owner 分区的当前订阅者；组内暂时没有订阅者时等待（消息留在队列里）
+func (g *memGroup) owner(part int, q *memQueue) *memSub {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for len(g.subs) == 0 {
+		if q.isClosed() {
+			return nil
+		}
+		g.cond.Wait()
+	}
+	return g.subs[part%len(g.subs)]
+}
+
+func (b *MemoryBus) consume(g *memGroup, part int) {
+	defer b.wg.Done()
+	q := g.parts[part]
+	go func() {
+		// 队列关闭时唤醒等待订阅者的 owner
+		<-q.done
+		g.mu.Lock()
+		g.cond.Broadcast()
+		g.mu.Unlock()
+	}()
+	for {
+		m, ok := q.pop()
+		if !ok {
+			return
+		}
+		sub := g.owner(part, q)
+		if sub == nil {
+			return
+		}
+		b.deliver(g.name, sub, m, q)
+	}
+}
+
+// deliver 失败按 RetryDelays 重投（期间阻塞本分区，保证同 key 有序），用完后进死信
+func (b *MemoryBus) deliver(group string, sub *memSub, m *Message, q *memQueue) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = sub.h(sub.ctx, cloneMessage(m)); err == nil {
+			return
+		}
+		if attempt >= len(b.cfg.RetryDelays) {
+			break
+		}
+		select {
+		case <-time.After(b.cfg.RetryDelays[attempt]):
+		case <-q.done:
+			return
+		}
+	}
+	logger.Errorf("[bus] memory dead letter group=%s topic=%s: %v", group, m.Topic, err)
+	b.mu.Lock()
+	b.dead = append(b.dead, DeadLetter{Group: group, Message: *m, Err: err.Error(), At: time.Now()})
+	b.mu.Unlock()
+}
+
+// memQueue 无界队列：发布方永远不会被慢消费者阻塞（处理函数里再发布也不会死锁）
+type memQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []*Message
+	closed bool
+	done   chan struct{}
+}
+
+func newMemQueue() *memQueue {
+	q := &memQueue{done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *memQueue) push(m *Message) {
+	q.mu.Lock()
+	q.items = append(q.items, m)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+func (q *memQueue) pop() (*Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	m := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	return m, true
+}
+
+func (q *memQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+func (q *memQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
@@ -0,0 +1,145 @@
+package bus
+
+import (
+	"PProject/logger"
+	"PProject/service/natsx"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderKey NATS 没有消息 key，放在 header 里透传
+const HeaderKey = "x-bus-key"
+
+// NatsConfig JetStream 后端配置
+type NatsConfig struct {
+	Servers       []string
+	Name          string
+	Stream        string        // 默认 PPCHAT
+	SubjectPrefix string        // topic 映射为 <prefix>.<topic>，默认 im
+	MaxAge        time.Duration // stream 保留时间，默认 7 天
+	AckWait       time.Duration // 超时未确认即重投，默认 30s
+	MaxAckPending int
+	// Ordered 严格按发布顺序消费：每个消费者同时只有一条未确认（MaxAckPending=1），吞吐换顺序
+	// 关闭时同一个 key 的消息可能并发处理或因重投乱序
+	Ordered bool
+}
+
+// NatsBus NATS JetStream 后端：topic 一一映射为 subject，消费组映射为 queue group + durable consumer
+type NatsBus struct {
+	cfg NatsConfig
+	mgr *natsx.NatsManager
+
+	mu     sync.Mutex
+	routes map[string]struct{}
+}
+
+func NewNatsBus(cfg NatsConfig) (*NatsBus, error) {
+	if cfg.Stream == "" {
+		cfg.Stream = "PPCHAT"
+	}
+	if cfg.SubjectPrefix == "" {
+		cfg.SubjectPrefix = "im"
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 7 * 24 * time.Hour
+	}
+	if cfg.Ordered {
+		cfg.MaxAckPending = 1
+	}
+	mgr, err := natsx.NewNatsManager(natsx.NatsxConfig{Servers: cfg.Servers, Name: cfg.Name})
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.EnsureStream(cfg.Stream, []string{cfg.SubjectPrefix + ".>"}, cfg.MaxAge); err != nil {
+		_ = mgr.Close()
+		return nil, err
+	}
+	return &NatsBus{cfg: cfg, mgr: mgr, routes: make(map[string]struct{})}, nil
+}
+
+func (b *NatsBus) Name() string { return BackendNats }
+
+func (b *NatsBus) subject(topic string) string { return b.cfg.SubjectPrefix + "." + topic }
+
+// durableName durable 名不能带 . * >
+func durableName(group, topic string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(group + "_" + topic)
+}
+
+// ensureRoute natsx 按 biz 路由：发布用 topic，订阅用 group|topic
+func (b *NatsBus) ensureRoute(biz, topic, group string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.routes[biz]; ok {
+		return nil
+	}
+	r := natsx.NatsxRoute{
+		Biz:           biz,
+		Subject:       b.subject(topic),
+		Mode:          natsx.JetStreamPush,
+		AckWait:       b.cfg.AckWait,
+		MaxAckPending: b.cfg.MaxAckPending,
+	}
+	if group != "" {
+		r.Queue = group
+		r.Durable = durableName(group, topic)
+	}
+	if err := b.mgr.RegisterRoute(r); err != nil {
+		return err
+	}
+	b.routes[biz] = struct{}{}
+	return nil
+}
+
+func (b *NatsBus) Publish(ctx context.Context, m *Message) error {
+	if err := b.ensureRoute(m.Topic, m.Topic, ""); err != nil {
+		return err
+	}
+	hdr := make(map[string]string, len(m.Headers)+1)
+	for k, v := range m.Headers {
+		hdr[k] = v
+	}
+	if len(m.Key) > 0 {
+		hdr[HeaderKey] = string(m.Key)
+	}
+	return b.mgr.Publish(ctx, m.Topic, m.Value, hdr)
+}
+
+func (b *NatsBus) Subscribe(ctx context.Context, group string, topics []string, h Handler) error {
+	h = Chain(h, middlewares()...)
+	bizs := make([]string, 0, len(topics))
+	for _, t := range topics {
+		topic, biz := t, group+"|"+t
+		if err := b.ensureRoute(biz, topic, group); err != nil {
+			return err
+		}
+		err := b.mgr.Subscribe(biz, func(ctx context.Context, nm natsx.NatsxMessage) error {
+			return h(ctx, &Message{
+				Topic:   topic,
+				Key:     []byte(nm.Header[HeaderKey]),
+				Value:   nm.Data,
+				Headers: nm.Header,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		bizs = append(bizs, biz)
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, biz := range bizs {
+			if err := b.mgr.Unsubscribe(biz); err != nil {
+				logger.Errorf("[bus] nats unsubscribe %s: %v", biz, err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *NatsBus) Close() error {
+	return b.mgr.Close()
+}
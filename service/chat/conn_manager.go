@@ -54,6 +54,8 @@ type WsConn struct {
 	TTL       time.Duration // 当前 TTL（随授权态切换）
 	ExpireAt  time.Time     // 到期时间（过期由 sweeper 清理）
 	Heartbeat time.Time     // 最近心跳时间
+
+	Filter *ConnFilter // 鉴权时声明的意图/分片，nil 表示不过滤
 }
 
 type ConnManager struct {
@@ -281,6 +283,7 @@ func (c *WsConn) Release() {
 	c.CreatedAt = time.Time{}
 	c.UpdatedAt = time.Time{}
 	c.Heartbeat = time.Time{}
+	c.Filter = nil
 
 	wsConnPool.Put(c)
 }
@@ -593,6 +596,28 @@ func (m *ConnManager) ListUserConns(user string) map[string]*websocket.Conn {
 	return out
 }
 
+// SetFilter 设置连接的下发过滤（鉴权时）
+func (m *ConnManager) SetFilter(snowID string, f *ConnFilter) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.bySnow[snowID]
+	if !ok {
+		return false
+	}
+	w.Filter = f
+	return true
+}
+
+// Filter 连接的下发过滤，没有返回 nil
+func (m *ConnManager) Filter(snowID string) *ConnFilter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if w, ok := m.bySnow[snowID]; ok {
+		return w.Filter
+	}
+	return nil
+}
+
 // ===== 清理协程 =====
 
 func (m *ConnManager) sweeper() {
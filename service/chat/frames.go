@@ -6,10 +6,13 @@ import (
 	decode "PProject/tools/decode"
 	errors "PProject/tools/errs"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -43,6 +46,9 @@ type AuthPayload struct {
 	DeviceID  string   `json:"device_id,omitempty"`
 	Scope     []string `json:"scope,omitempty"`
 	Sig       string   `json:"sig,omitempty"`
+	// 选择性订阅（GatewaySubscribe）：只收这些服务器/频道的事件
+	GuildIDs   []string `json:"guild_ids,omitempty"`
+	ChannelIDs []string `json:"channel_ids,omitempty"`
 }
 
 func ExtractAuthPayload(msg *pb.MessageData) (*AuthPayload, error) {
@@ -210,6 +216,206 @@ func BuildSendSuccessAckDeliver(toUser string, clientMsgID string, serverMsgID s
 	}
 }
 
+// BuildGroupDeliver 群消息按网关聚合的下发帧：一条消息体 + 本网关上的接收者列表
+func BuildGroupDeliver(gatewayID string, recipients []string, md *pb.MessageData, req *pb.MessageFrameData) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:        pb.MessageFrameData_DELIVER,
+		From:        req.From,
+		Ts:          time.Now().UnixMilli(),
+		GatewayId:   gatewayID,
+		TenantId:    req.TenantId,
+		AppId:       req.AppId,
+		Qos:         pb.MessageFrameData_QOS_AT_LEAST_ONCE,
+		AckRequired: true,
+		DedupId:     "deliver-" + md.GetServerMsgId(),
+		Meta: map[string]string{
+			MetaRecipients: strings.Join(recipients, ","),
+		},
+		Body: &pb.MessageFrameData_Payload{Payload: md},
+	}
+}
+
+// BuildChannelBroadcast 广播频道的下发帧：每个网关一帧，网关按本地订阅者展开
+// 至多一次、不要求回执：频道是读扩散，丢了由客户端按已读游标拉历史补齐
+func BuildChannelBroadcast(gatewayID, channelID string, md *pb.MessageData, req *pb.MessageFrameData) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_DELIVER,
+		From:      req.From,
+		Ts:        time.Now().UnixMilli(),
+		GatewayId: gatewayID,
+		TenantId:  req.TenantId,
+		AppId:     req.AppId,
+		Qos:       pb.MessageFrameData_QOS_AT_MOST_ONCE,
+		DedupId:   "deliver-" + md.GetServerMsgId(),
+		Meta: map[string]string{
+			MetaChannel: channelID,
+		},
+		Body: &pb.MessageFrameData_Payload{Payload: md},
+	}
+}
+
+// BuildDeliver 发给单个用户的下发帧（离线队列里存的就是它，上线后原样补发）
+func BuildDeliver(toUser string, md *pb.MessageData, req *pb.MessageFrameData) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:        pb.MessageFrameData_DELIVER,
+		From:        req.From,
+		To:          toUser,
+		Ts:          time.Now().UnixMilli(),
+		TenantId:    req.TenantId,
+		AppId:       req.AppId,
+		Qos:         pb.MessageFrameData_QOS_AT_LEAST_ONCE,
+		AckRequired: true,
+		DedupId:     "deliver-" + md.GetServerMsgId(),
+		Body:        &pb.MessageFrameData_Payload{Payload: md},
+	}
+}
+
+// BuildThreadUpdate 父会话里话题根消息的精简更新（"N 条回复"），不下发回复本身
+func BuildThreadUpdate(gatewayID string, recipients []string, root *pb.MessageData, replyCount, lastReplyMS int64, req *pb.MessageFrameData) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_MESSAGE_UPDATE,
+		From:      req.From,
+		Ts:        time.Now().UnixMilli(),
+		GatewayId: gatewayID,
+		TenantId:  req.TenantId,
+		AppId:     req.AppId,
+		DedupId:   fmt.Sprintf("thread-%s-%d", root.GetServerMsgId(), replyCount),
+		Meta: map[string]string{
+			MetaRecipients:    strings.Join(recipients, ","),
+			"thread_id":       root.GetServerMsgId(),
+			"reply_count":     strconv.FormatInt(replyCount, 10),
+			"last_reply_time": strconv.FormatInt(lastReplyMS, 10),
+		},
+		Body: &pb.MessageFrameData_Payload{Payload: root},
+	}
+}
+
+// BuildMessageDestructed 消息销毁（阅后即焚/定时删除）通知：payload 为墓碑，客户端据此删除本地内容
+func BuildMessageDestructed(gatewayID, tenantID, conversationID string, recipients []string, tombstone *pb.MessageData) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_MESSAGE_UPDATE,
+		From:      "im_server",
+		Ts:        time.Now().UnixMilli(),
+		GatewayId: gatewayID,
+		TenantId:  tenantID,
+		DedupId:   "destruct-" + tombstone.GetServerMsgId(),
+		Meta: map[string]string{
+			MetaRecipients:    strings.Join(recipients, ","),
+			"event":           "msg_destructed",
+			"conversation_id": conversationID,
+			"seq":             strconv.FormatInt(tombstone.GetSeq(), 10),
+		},
+		Body: &pb.MessageFrameData_Payload{Payload: tombstone},
+	}
+}
+
+// BuildMessageEdited 消息被编辑（机器人回应交互更新原消息等）：payload 为编辑后的完整消息
+// recipients 为空时按频道路由下发（读扩散频道，meta 带 channel，网关按本地订阅者展开）
+func BuildMessageEdited(gatewayID, tenantID, from, conversationID, channelRoute string, recipients []string, md *pb.MessageData) *pb.MessageFrameData {
+	meta := map[string]string{
+		"event":           "msg_edited",
+		"conversation_id": conversationID,
+		"edit_version":    strconv.FormatInt(int64(md.GetEditVersion()), 10),
+	}
+	if channelRoute != "" {
+		meta[MetaChannel] = channelRoute
+	} else {
+		meta[MetaRecipients] = strings.Join(recipients, ",")
+	}
+	return &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_MESSAGE_UPDATE,
+		From:      from,
+		Ts:        time.Now().UnixMilli(),
+		GatewayId: gatewayID,
+		TenantId:  tenantID,
+		DedupId:   fmt.Sprintf("edit-%s-%d", md.GetServerMsgId(), md.GetEditVersion()),
+		Meta:      meta,
+		Body:      &pb.MessageFrameData_Payload{Payload: md},
+	}
+}
+
+// BuildEphemeralDeliver 仅接收者可见的消息（机器人交互回复）：不落库、不进离线队列，至多一次
+func BuildEphemeralDeliver(gatewayID, tenantID, from string, recipients []string, md *pb.MessageData) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_DELIVER,
+		From:      from,
+		Ts:        time.Now().UnixMilli(),
+		GatewayId: gatewayID,
+		TenantId:  tenantID,
+		Qos:       pb.MessageFrameData_QOS_AT_MOST_ONCE,
+		DedupId:   "ephemeral-" + md.GetServerMsgId(),
+		Meta: map[string]string{
+			MetaRecipients: strings.Join(recipients, ","),
+		},
+		Body: &pb.MessageFrameData_Payload{Payload: md},
+	}
+}
+
+// BuildPresenceDeliver 在线状态/正在输入下发帧：body 为 PresenceUpdate 或 TypingStart（any_payload）
+// 至多一次、不要求回执，丢了也不补发
+func BuildPresenceDeliver(gatewayID, tenantID, from string, recipients []string, body *anypb.Any) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_PRESENCE,
+		From:      from,
+		Ts:        time.Now().UnixMilli(),
+		GatewayId: gatewayID,
+		TenantId:  tenantID,
+		Qos:       pb.MessageFrameData_QOS_AT_MOST_ONCE,
+		Meta: map[string]string{
+			MetaRecipients: strings.Join(recipients, ","),
+		},
+		Body: &pb.MessageFrameData_AnyPayload{AnyPayload: body},
+	}
+}
+
+// BuildSystemEvent 系统事件下发帧（好友申请/通过、黑名单变更等）：body 为 SystemEvent（any_payload）
+// 不进离线队列，客户端上线后通过接口拉取最新状态
+func BuildSystemEvent(gatewayID, tenantID string, recipients []string, body *anypb.Any) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_SYSTEM_EVENT,
+		From:      "im_server",
+		Ts:        time.Now().UnixMilli(),
+		GatewayId: gatewayID,
+		TenantId:  tenantID,
+		Qos:       pb.MessageFrameData_QOS_AT_MOST_ONCE,
+		Meta: map[string]string{
+			MetaRecipients: strings.Join(recipients, ","),
+		},
+		Body: &pb.MessageFrameData_AnyPayload{AnyPayload: body},
+	}
+}
+
+// BuildSendNack 消息被拒绝的否定回执（code 对应 errs 中的错误码，客户端据此提示）
+func BuildSendNack(toUser string, clientMsgID string, code int, reason string, req *pb.MessageFrameData) *pb.MessageFrameData {
+	now := time.Now().UnixMilli()
+	frame := &pb.MessageFrameData{
+		Type:      pb.MessageFrameData_NACK, // 12：否定确认
+		From:      "im_server" + req.GatewayId,
+		To:        toUser,
+		Ts:        now,
+		GatewayId: req.GatewayId,
+		ConnId:    req.ConnId,
+		SessionId: req.SessionId,
+		TenantId:  req.TenantId,
+		AppId:     req.AppId,
+		AckId:     req.AckId,
+		DedupId:   "nack-" + clientMsgID,
+	}
+
+	ack := &pb.AckData{
+		AckId:         req.AckId,
+		Ok:            false,
+		Code:          strconv.Itoa(code),
+		Message:       reason,
+		ServerTime:    now,
+		CorrelationId: clientMsgID, // 回显幂等键，客户端据此定位发送失败的消息
+	}
+	if anyPayload, err := anypb.New(ack); err == nil {
+		frame.Body = &pb.MessageFrameData_AnyPayload{AnyPayload: anyPayload}
+	}
+	return frame
+}
+
 func BuildPing(connID, gatewayID, sessionID, nodeID string) *pb.MessageFrameData {
 	now := time.Now().UnixMilli()
 	return &pb.MessageFrameData{
@@ -0,0 +1,239 @@
+package chat
+
+import (
+	pb "PProject/gen/message"
+	errors "PProject/tools/errs"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 网关意图（Discord 风格）：连接鉴权时在 AUTH 帧的 intents 上声明要收的事件，
+// 没声明的事件网关不下发；ACK/NACK/同步等连接自身的帧不受影响
+const (
+	IntentGuilds         uint64 = 1 << 0  // 服务器/频道/角色变更事件
+	IntentGuildMembers   uint64 = 1 << 1  // 服务器成员事件（特权）
+	IntentPresences      uint64 = 1 << 8  // 在线状态（特权）
+	IntentGuildMessages  uint64 = 1 << 9  // 服务器频道消息
+	IntentTyping         uint64 = 1 << 11 // 正在输入
+	IntentDirectMessages uint64 = 1 << 12 // 单聊消息
+	IntentMessageContent uint64 = 1 << 15 // 消息内容（特权）：没有时只给自己发的、单聊和 @自己 的消息带内容
+	IntentGroupMessages  uint64 = 1 << 20 // 群/广播频道/话题消息
+	IntentGroupEvents    uint64 = 1 << 21 // 群事件（入群申请、被踢、发布者变更等）
+	IntentRelations      uint64 = 1 << 22 // 好友/黑名单事件
+
+	// IntentsPrivileged 特权意图：机器人需要开通后才能声明
+	IntentsPrivileged = IntentGuildMembers | IntentPresences | IntentMessageContent
+	// IntentsAll 全部意图
+	IntentsAll = IntentGuilds | IntentGuildMembers | IntentPresences | IntentGuildMessages | IntentTyping |
+		IntentDirectMessages | IntentMessageContent | IntentGroupMessages | IntentGroupEvents | IntentRelations
+	// IntentsDefault 机器人未声明意图时的默认值：全部非特权意图
+	IntentsDefault = IntentsAll &^ IntentsPrivileged
+)
+
+// ShardCountMax 单个账号的最大分片数
+const ShardCountMax = 1024
+
+// 系统事件类型前缀 -> 意图（长前缀在前）
+var eventIntents = []struct {
+	prefix string
+	intent uint64
+}{
+	{"guild_member_", IntentGuildMembers},
+	{"guild_", IntentGuilds},
+	{"group_", IntentGroupEvents},
+	{"channel_", IntentGroupEvents},
+	{"friend_", IntentRelations},
+	{"black_", IntentRelations},
+}
+
+// ConnFilter 连接级的下发过滤：意图、分片、选择性订阅；nil 表示不过滤
+type ConnFilter struct {
+	Intents    uint64
+	ShardID    int32
+	ShardCount int32               // 0 表示不分片
+	Guilds     map[string]struct{} // 只收这些服务器，空表示不限
+	Channels   map[string]struct{} // 只收这些频道/群，空表示不限
+}
+
+// NewConnFilter 校验分片参数并构造过滤器；意图的合法性（特权）由调用方按账号校验
+func NewConnFilter(intents uint64, shard *pb.ShardInfo, guildIDs, channelIDs []string) (*ConnFilter, error) {
+	if intents&^IntentsAll != 0 {
+		return nil, errors.ErrArgs.WrapMsg("unknown intents", "intents", intents)
+	}
+	cf := &ConnFilter{Intents: intents}
+	if shard != nil && shard.GetShardCount() > 0 {
+		if shard.GetShardCount() > ShardCountMax || shard.GetShardId() < 0 || shard.GetShardId() >= shard.GetShardCount() {
+			return nil, errors.ErrArgs.WrapMsg("invalid shard", "shard_id", shard.GetShardId(), "shard_count", shard.GetShardCount())
+		}
+		cf.ShardID, cf.ShardCount = shard.GetShardId(), shard.GetShardCount()
+	}
+	cf.Guilds = toSet(guildIDs)
+	cf.Channels = toSet(channelIDs)
+	return cf, nil
+}
+
+func toSet(ids []string) map[string]struct{} {
+	if len(ids) == 0 {
+		return nil
+	}
+	out := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			out[id] = struct{}{}
+		}
+	}
+	return out
+}
+
+// ShardOf 服务器所在的分片：按服务器ID哈希取模
+func ShardOf(guildID string, shardCount int32) int32 {
+	if shardCount <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(guildID))
+	return int32(h.Sum32() % uint32(shardCount))
+}
+
+// AllowGuild 该服务器的事件是否发到本连接：分片命中且在选择性订阅内
+func (cf *ConnFilter) AllowGuild(guildID string) bool {
+	if cf == nil {
+		return true
+	}
+	if cf.ShardCount > 0 && ShardOf(guildID, cf.ShardCount) != cf.ShardID {
+		return false
+	}
+	if cf.Guilds != nil {
+		if _, ok := cf.Guilds[guildID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowChannel 该频道/群的消息是否发到本连接（选择性订阅）
+func (cf *ConnFilter) AllowChannel(channelID string) bool {
+	if cf == nil || cf.Channels == nil {
+		return true
+	}
+	_, ok := cf.Channels[channelID]
+	return ok
+}
+
+// AllowRoute 频道路由要不要在本连接订阅：服务器路由按分片/选择性订阅，广播频道按频道
+func (cf *ConnFilter) AllowRoute(routeID string, guild bool) bool {
+	if cf == nil {
+		return true
+	}
+	if guild {
+		return cf.Intents&IntentGuildMessages != 0 && cf.AllowGuild(routeID)
+	}
+	return cf.Intents&IntentGroupMessages != 0 && cf.primaryShard() && cf.AllowChannel(routeID)
+}
+
+// primaryShard 不属于任何服务器的事件（单聊、群、好友等）只发到 0 号分片，避免多个分片各收一份
+func (cf *ConnFilter) primaryShard() bool {
+	return cf.ShardCount == 0 || cf.ShardID == 0
+}
+
+// FrameIntent 下发帧需要的意图，0 表示不受意图控制
+func FrameIntent(f *pb.MessageFrameData) uint64 {
+	switch f.GetType() {
+	case pb.MessageFrameData_PRESENCE:
+		if f.GetAnyPayload().MessageIs(&pb.TypingStart{}) {
+			return IntentTyping
+		}
+		return IntentPresences
+	case pb.MessageFrameData_SYSTEM_EVENT:
+		ev := &pb.SystemEvent{}
+		if f.GetAnyPayload() == nil || f.GetAnyPayload().UnmarshalTo(ev) != nil {
+			return 0
+		}
+		for _, e := range eventIntents {
+			if strings.HasPrefix(ev.GetEventType(), e.prefix) {
+				return e.intent
+			}
+		}
+		return 0
+	case pb.MessageFrameData_DATA, pb.MessageFrameData_DELIVER, pb.MessageFrameData_MESSAGE_UPDATE:
+		md := f.GetPayload()
+		if md == nil {
+			return 0
+		}
+		switch {
+		case md.GetGuildId() != "":
+			return IntentGuildMessages
+		case md.GetGroupId() != "" || md.GetChannelId() != "" || md.GetThreadId() != "":
+			return IntentGroupMessages
+		}
+		return IntentDirectMessages
+	}
+	return 0
+}
+
+// Apply 按过滤器处理发给 userID 的帧：不该收的返回 false；没有消息内容意图时返回去掉内容的副本
+func (cf *ConnFilter) Apply(userID string, f *pb.MessageFrameData) (*pb.MessageFrameData, bool) {
+	if cf == nil {
+		return f, true
+	}
+	intent := FrameIntent(f)
+	if intent == 0 {
+		return f, true
+	}
+	if cf.Intents&intent == 0 {
+		return nil, false
+	}
+
+	md := f.GetPayload()
+	if guildID := md.GetGuildId(); guildID != "" {
+		if !cf.AllowGuild(guildID) {
+			return nil, false
+		}
+	} else if !cf.primaryShard() {
+		return nil, false
+	}
+	if md == nil {
+		return f, true
+	}
+	target := md.GetChannelId()
+	if target == "" {
+		target = md.GetGroupId()
+	}
+	if target != "" && !cf.AllowChannel(target) {
+		return nil, false
+	}
+
+	if cf.Intents&IntentMessageContent != 0 || intent == IntentDirectMessages ||
+		md.GetSendId() == userID || slices.Contains(md.GetAtTextElem().GetAtUserList(), userID) {
+		return f, true
+	}
+	out := proto.Clone(f).(*pb.MessageFrameData)
+	stripContent(out.GetPayload())
+	return out, true
+}
+
+// stripContent 去掉消息内容，只留路由/发送者/时间等元信息和 @ 列表
+func stripContent(md *pb.MessageData) {
+	md.Content = ""
+	md.TextElem = nil
+	md.CardElem = nil
+	md.PictureElem = nil
+	md.SoundElem = nil
+	md.VideoElem = nil
+	md.FileElem = nil
+	md.MergeElem = nil
+	md.FaceElem = nil
+	md.LocationElem = nil
+	md.CustomElem = nil
+	md.QuoteElem = nil
+	md.AdvancedTextElem = nil
+	md.MarkdownTextElem = nil
+	md.Rich = nil
+	if at := md.GetAtTextElem(); at != nil {
+		at.Text = ""
+		at.QuoteMessage = nil
+	}
+}
@@ -0,0 +1,194 @@
+package chat
+
+import (
+	pb "PProject/gen/message"
+	"fmt"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func anyFrame(t *testing.T, typ pb.MessageFrameData_Type, m proto.Message) *pb.MessageFrameData {
+	t.Helper()
+	a, err := anypb.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pb.MessageFrameData{Type: typ, Body: &pb.MessageFrameData_AnyPayload{AnyPayload: a}}
+}
+
+func msgFrame(md *pb.MessageData) *pb.MessageFrameData {
+	return &pb.MessageFrameData{Type: pb.MessageFrameData_DELIVER, Body: &pb.MessageFrameData_Payload{Payload: md}}
+}
+
+func sysEvent(t *testing.T, eventType string) *pb.MessageFrameData {
+	return anyFrame(t, pb.MessageFrameData_SYSTEM_EVENT, &pb.SystemEvent{EventType: eventType})
+}
+
+func TestFrameIntent(t *testing.T) {
+	cases := []struct {
+		name  string
+		frame *pb.MessageFrameData
+		want  uint64
+	}{
+		{"typing", anyFrame(t, pb.MessageFrameData_PRESENCE, &pb.TypingStart{}), IntentTyping},
+		{"presence", anyFrame(t, pb.MessageFrameData_PRESENCE, &pb.SystemEvent{}), IntentPresences},
+		{"guild member event", sysEvent(t, "guild_member_join"), IntentGuildMembers},
+		{"guild event", sysEvent(t, "guild_channel_create"), IntentGuilds},
+		{"group event", sysEvent(t, "group_member_kicked"), IntentGroupEvents},
+		{"channel event", sysEvent(t, "channel_publisher_set"), IntentGroupEvents},
+		{"friend event", sysEvent(t, "friend_added"), IntentRelations},
+		{"black event", sysEvent(t, "black_added"), IntentRelations},
+		{"unknown event", sysEvent(t, "session_kicked"), 0},
+		{"system event without payload", &pb.MessageFrameData{Type: pb.MessageFrameData_SYSTEM_EVENT}, 0},
+		{"guild message", msgFrame(&pb.MessageData{GuildId: "gd", ChannelId: "c"}), IntentGuildMessages},
+		{"group message", msgFrame(&pb.MessageData{GroupId: "g"}), IntentGroupMessages},
+		{"channel message", msgFrame(&pb.MessageData{ChannelId: "c"}), IntentGroupMessages},
+		{"thread message", msgFrame(&pb.MessageData{ThreadId: "th"}), IntentGroupMessages},
+		{"direct message", msgFrame(&pb.MessageData{RecvId: "u2"}), IntentDirectMessages},
+		{"edit", &pb.MessageFrameData{Type: pb.MessageFrameData_MESSAGE_UPDATE, Body: &pb.MessageFrameData_Payload{Payload: &pb.MessageData{GroupId: "g"}}}, IntentGroupMessages},
+		{"ack", &pb.MessageFrameData{Type: pb.MessageFrameData_ACK}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := FrameIntent(c.frame); got != c.want {
+				t.Fatalf("FrameIntent = %b want %b", got, c.want)
+			}
+		})
+	}
+}
+
+func TestConnFilterApply(t *testing.T) {
+	// 找一个在 2 分片下落到 1 号分片的服务器
+	guild := ""
+	for i := 0; guild == ""; i++ {
+		if id := fmt.Sprintf("gd%d", i); ShardOf(id, 2) == 1 {
+			guild = id
+		}
+	}
+	text := &pb.TextElem{Content: "secret"}
+	cases := []struct {
+		name        string
+		filter      *ConnFilter
+		md          *pb.MessageData
+		wantOK      bool
+		wantContent bool
+	}{
+		{"nil filter", nil, &pb.MessageData{GroupId: "g", TextElem: text}, true, true},
+		{"intent missing", &ConnFilter{Intents: IntentDirectMessages}, &pb.MessageData{GroupId: "g"}, false, false},
+		{"content intent", &ConnFilter{Intents: IntentGroupMessages | IntentMessageContent}, &pb.MessageData{GroupId: "g", TextElem: text}, true, true},
+		{"stripped", &ConnFilter{Intents: IntentGroupMessages}, &pb.MessageData{GroupId: "g", TextElem: text}, true, false},
+		{"direct keeps content", &ConnFilter{Intents: IntentDirectMessages}, &pb.MessageData{RecvId: "bot", TextElem: text}, true, true},
+		{"own message keeps content", &ConnFilter{Intents: IntentGroupMessages}, &pb.MessageData{GroupId: "g", SendId: "bot", TextElem: text}, true, true},
+		{"mention keeps content", &ConnFilter{Intents: IntentGroupMessages},
+			&pb.MessageData{GroupId: "g", TextElem: text, AtTextElem: &pb.AtTextElem{AtUserList: []string{"bot"}}}, true, true},
+		{"non-guild on shard 1", &ConnFilter{Intents: IntentsAll, ShardID: 1, ShardCount: 2}, &pb.MessageData{GroupId: "g", TextElem: text}, false, false},
+		{"non-guild on shard 0", &ConnFilter{Intents: IntentsAll, ShardID: 0, ShardCount: 2}, &pb.MessageData{GroupId: "g", TextElem: text}, true, true},
+		{"guild on its shard", &ConnFilter{Intents: IntentsAll, ShardID: 1, ShardCount: 2}, &pb.MessageData{GuildId: guild, ChannelId: "c", TextElem: text}, true, true},
+		{"guild on other shard", &ConnFilter{Intents: IntentsAll, ShardID: 0, ShardCount: 2}, &pb.MessageData{GuildId: guild, ChannelId: "c"}, false, false},
+		{"guild not subscribed", &ConnFilter{Intents: IntentsAll, Guilds: toSet([]string{"other"})}, &pb.MessageData{GuildId: guild, ChannelId: "c"}, false, false},
+		{"channel subscribed", &ConnFilter{Intents: IntentsAll, Channels: toSet([]string{"c"})}, &pb.MessageData{GuildId: guild, ChannelId: "c", TextElem: text}, true, true},
+		{"channel not subscribed", &ConnFilter{Intents: IntentsAll, Channels: toSet([]string{"c"})}, &pb.MessageData{GuildId: guild, ChannelId: "c2"}, false, false},
+		{"group not subscribed", &ConnFilter{Intents: IntentsAll, Channels: toSet([]string{"c"})}, &pb.MessageData{GroupId: "g"}, false, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			in := msgFrame(c.md)
+			out, ok := c.filter.Apply("bot", in)
+			if ok != c.wantOK {
+				t.Fatalf("ok = %v want %v", ok, c.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if hasContent := out.GetPayload().GetTextElem() != nil; hasContent != c.wantContent {
+				t.Fatalf("content = %v want %v", hasContent, c.wantContent)
+			}
+			if in.GetPayload().GetTextElem() != c.md.GetTextElem() {
+				t.Fatal("Apply modified the shared frame")
+			}
+		})
+	}
+
+	// 不受意图控制的帧和系统事件
+	cf := &ConnFilter{Intents: IntentGuilds, ShardID: 1, ShardCount: 2}
+	if _, ok := cf.Apply("bot", &pb.MessageFrameData{Type: pb.MessageFrameData_ACK}); !ok {
+		t.Fatal("ack filtered")
+	}
+	if _, ok := cf.Apply("bot", sysEvent(t, "group_member_kicked")); ok {
+		t.Fatal("group event without intent delivered")
+	}
+	if _, ok := cf.Apply("bot", sysEvent(t, "guild_channel_create")); ok {
+		t.Fatal("non-guild-scoped event delivered to shard 1")
+	}
+}
+
+func TestShardOf(t *testing.T) {
+	if ShardOf("gd1", 0) != 0 || ShardOf("gd1", 1) != 0 {
+		t.Fatal("unsharded should be shard 0")
+	}
+	seen := map[int32]int{}
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("gd%d", i)
+		s := ShardOf(id, 8)
+		if s < 0 || s >= 8 {
+			t.Fatalf("ShardOf(%s) = %d out of range", id, s)
+		}
+		if ShardOf(id, 8) != s {
+			t.Fatalf("ShardOf(%s) not stable", id)
+		}
+		seen[s]++
+	}
+	if len(seen) != 8 {
+		t.Fatalf("shards used = %v", seen)
+	}
+	// 钉住 FNV-1a：哈希算法变了会让已有连接的分片全部错位
+	if got := ShardOf("guild-123", 16); got != int32(fnv32a("guild-123")%16) {
+		t.Fatalf("ShardOf(guild-123, 16) = %d", got)
+	}
+}
+
+func fnv32a(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func TestNewConnFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		intents uint64
+		shard   *pb.ShardInfo
+		wantErr bool
+	}{
+		{"no shard", IntentsDefault, nil, false},
+		{"zero count", IntentsDefault, &pb.ShardInfo{ShardId: 3}, false},
+		{"valid shard", IntentsDefault, &pb.ShardInfo{ShardId: 1, ShardCount: 4}, false},
+		{"last shard", IntentsDefault, &pb.ShardInfo{ShardId: 3, ShardCount: 4}, false},
+		{"id out of range", IntentsDefault, &pb.ShardInfo{ShardId: 4, ShardCount: 4}, true},
+		{"negative id", IntentsDefault, &pb.ShardInfo{ShardId: -1, ShardCount: 4}, true},
+		{"too many shards", IntentsDefault, &pb.ShardInfo{ShardId: 0, ShardCount: ShardCountMax + 1}, true},
+		{"unknown intent", 1 << 40, nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cf, err := NewConnFilter(c.intents, c.shard, []string{"gd1", ""}, nil)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v wantErr %v", err, c.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.shard.GetShardCount() > 0 && (cf.ShardID != c.shard.GetShardId() || cf.ShardCount != c.shard.GetShardCount()) {
+				t.Fatalf("shard = %d/%d", cf.ShardID, cf.ShardCount)
+			}
+			if len(cf.Guilds) != 1 || cf.Channels != nil {
+				t.Fatalf("subscriptions guilds=%v channels=%v", cf.Guilds, cf.Channels)
+			}
+		})
+	}
+}
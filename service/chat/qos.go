@@ -0,0 +1,341 @@
+package chat
+
+import (
+	pb "PProject/gen/message"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ===== QOS_AT_LEAST_ONCE：下发后等待客户端 CACK，超时按指数退避重传 =====
+
+type QosConf struct {
+	AckTimeout time.Duration // 首次等待 CACK 的时间（如 5s）
+	MaxBackoff time.Duration // 重传间隔上限（每次翻倍）
+	MaxRetries int           // 重传次数上限，超过即认为连接已死
+	ScanEvery  time.Duration // 超时扫描周期
+	Clock      func() time.Time
+}
+
+func (c *QosConf) norm() {
+	if c.Clock == nil {
+		c.Clock = time.Now
+	}
+	if c.AckTimeout <= 0 {
+		c.AckTimeout = 5 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 60 * time.Second
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 5
+	}
+	if c.ScanEvery <= 0 {
+		c.ScanEvery = 500 * time.Millisecond
+	}
+}
+
+// pendingDeliver 一条已写出、尚未 CACK 的下发
+type pendingDeliver struct {
+	userID    string
+	frame     *pb.MessageFrameData
+	firstSent time.Time
+	deadline  time.Time
+	retries   int
+}
+
+// QosStats 计数快照
+type QosStats struct {
+	Pending         int64 `json:"pending"`
+	Tracked         int64 `json:"tracked"`
+	Acked           int64 `json:"acked"`
+	Nacked          int64 `json:"nacked"`
+	Retransmits     int64 `json:"retransmits"`
+	Deferred        int64 `json:"deferred"` // 写队列满没能重传、延到下一轮的次数（不计入重传次数）
+	DeadConns       int64 `json:"dead_conns"`
+	Requeued        int64 `json:"requeued"` // 转入离线队列的帧数
+	AckLatencyCount int64 `json:"ack_latency_count"`
+	AckLatencySumMS int64 `json:"ack_latency_sum_ms"`
+	AckLatencyMaxMS int64 `json:"ack_latency_max_ms"`
+}
+
+type qosCounters struct {
+	tracked, acked, nacked, retransmits, deferred, deadConns, requeued atomic.Int64
+	latCount, latSumMS, latMaxMS                                       atomic.Int64
+}
+
+// QosTracker 按连接跟踪未确认的下发
+// resend 负责把帧重新写到该连接，写队列满等原因没能发出时返回 false；orphan 处理连接关闭/判死后剩下的未确认帧（转离线队列）
+type QosTracker struct {
+	conf QosConf
+
+	mu      sync.Mutex
+	pending map[string]map[string]*pendingDeliver // snowID -> ack key -> entry
+
+	resend func(snowID string, f *pb.MessageFrameData) bool
+	orphan func(snowID, userID string, frames []*pb.MessageFrameData, dead bool)
+
+	stats    qosCounters
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+func NewQosTracker(conf QosConf, resend func(snowID string, f *pb.MessageFrameData) bool,
+	orphan func(snowID, userID string, frames []*pb.MessageFrameData, dead bool)) *QosTracker {
+	conf.norm()
+	t := &QosTracker{
+		conf:    conf,
+		pending: make(map[string]map[string]*pendingDeliver),
+		resend:  resend,
+		orphan:  orphan,
+		stopCh:  make(chan struct{}),
+	}
+	go t.scanner()
+	return t
+}
+
+func (t *QosTracker) Close() {
+	t.stopOnce.Do(func() { close(t.stopCh) })
+}
+
+// NeedAck 只有要求 CACK 的至少一次下发才跟踪
+func NeedAck(f *pb.MessageFrameData) bool {
+	return f != nil &&
+		f.GetType() == pb.MessageFrameData_DELIVER &&
+		f.GetQos() != pb.MessageFrameData_QOS_AT_MOST_ONCE &&
+		f.GetAckRequired() &&
+		qosKey(f) != ""
+}
+
+// qosKey 确认键：优先 server_msg_id，其次 ack_id
+func qosKey(f *pb.MessageFrameData) string {
+	if id := f.GetPayload().GetServerMsgId(); id != "" {
+		return id
+	}
+	return f.GetAckId()
+}
+
+// Track 帧写出成功后登记；重传写出时已存在，不重复登记
+func (t *QosTracker) Track(snowID, userID string, f *pb.MessageFrameData) {
+	if snowID == "" || !NeedAck(f) {
+		return
+	}
+	key := qosKey(f)
+	now := t.conf.Clock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	mm := t.pending[snowID]
+	if mm == nil {
+		mm = make(map[string]*pendingDeliver)
+		t.pending[snowID] = mm
+	}
+	if _, ok := mm[key]; ok {
+		return
+	}
+	mm[key] = &pendingDeliver{
+		userID:    userID,
+		frame:     f,
+		firstSent: now,
+		deadline:  now.Add(t.conf.AckTimeout),
+	}
+	t.stats.tracked.Add(1)
+}
+
+// Ack 客户端 CACK：keys 可以是 server_msg_id 或 ack_id，命中任意一个即确认
+func (t *QosTracker) Ack(snowID string, keys ...string) bool {
+	now := t.conf.Clock()
+	t.mu.Lock()
+	p := t.removeLocked(snowID, keys)
+	t.mu.Unlock()
+	if p == nil {
+		return false
+	}
+	t.stats.acked.Add(1)
+	t.observeLatency(now.Sub(p.firstSent))
+	return true
+}
+
+// Nack 客户端 CNACK：retry=true 时立即重传（仍计入重传次数），否则不再重传，返回原帧交给调用方处理
+func (t *QosTracker) Nack(snowID string, retry bool, keys ...string) *pb.MessageFrameData {
+	t.stats.nacked.Add(1)
+	t.mu.Lock()
+	if retry {
+		mm := t.pending[snowID]
+		for _, k := range keys {
+			if p, ok := mm[k]; ok {
+				p.deadline = t.conf.Clock()
+				t.mu.Unlock()
+				return p.frame
+			}
+		}
+		t.mu.Unlock()
+		return nil
+	}
+	p := t.removeLocked(snowID, keys)
+	t.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.frame
+}
+
+// Release 连接关闭：未确认的帧交给 orphan（转离线队列，下次上线补发）
+func (t *QosTracker) Release(snowID string) {
+	t.mu.Lock()
+	mm := t.pending[snowID]
+	delete(t.pending, snowID)
+	t.mu.Unlock()
+	t.handOff(snowID, mm, false)
+}
+
+func (t *QosTracker) removeLocked(snowID string, keys []string) *pendingDeliver {
+	mm := t.pending[snowID]
+	if mm == nil {
+		return nil
+	}
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		if p, ok := mm[k]; ok {
+			delete(mm, k)
+			if len(mm) == 0 {
+				delete(t.pending, snowID)
+			}
+			return p
+		}
+	}
+	return nil
+}
+
+func (t *QosTracker) handOff(snowID string, mm map[string]*pendingDeliver, dead bool) {
+	if len(mm) == 0 {
+		return
+	}
+	var userID string
+	frames := make([]*pb.MessageFrameData, 0, len(mm))
+	for _, p := range mm {
+		userID = p.userID
+		frames = append(frames, p.frame)
+	}
+	t.stats.requeued.Add(int64(len(frames)))
+	if t.orphan != nil {
+		t.orphan(snowID, userID, frames, dead)
+	}
+}
+
+func (t *QosTracker) observeLatency(d time.Duration) {
+	ms := d.Milliseconds()
+	t.stats.latCount.Add(1)
+	t.stats.latSumMS.Add(ms)
+	for {
+		cur := t.stats.latMaxMS.Load()
+		if ms <= cur || t.stats.latMaxMS.CompareAndSwap(cur, ms) {
+			return
+		}
+	}
+}
+
+// backoff 第 n 次重传后的等待时间：AckTimeout * 2^n，封顶 MaxBackoff
+func (t *QosTracker) backoff(n int) time.Duration {
+	d := t.conf.AckTimeout
+	for i := 0; i < n && d < t.conf.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > t.conf.MaxBackoff {
+		d = t.conf.MaxBackoff
+	}
+	return d
+}
+
+func (t *QosTracker) scanner() {
+	tk := time.NewTicker(t.conf.ScanEvery)
+	defer tk.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-tk.C:
+			t.scanOnce(t.conf.Clock())
+		}
+	}
+}
+
+type resendItem struct {
+	snowID string
+	frame  *pb.MessageFrameData
+}
+
+func (t *QosTracker) scanOnce(now time.Time) {
+	var resends []resendItem
+	dead := make(map[string]map[string]*pendingDeliver)
+
+	t.mu.Lock()
+	for snowID, mm := range t.pending {
+		for _, p := range mm {
+			if now.Before(p.deadline) {
+				continue
+			}
+			if p.retries >= t.conf.MaxRetries {
+				// 连续多次没有回执：连接判死，整条连接的未确认帧一起转走
+				dead[snowID] = mm
+				delete(t.pending, snowID)
+				break
+			}
+			p.retries++
+			p.deadline = now.Add(t.backoff(p.retries))
+			resends = append(resends, resendItem{snowID: snowID, frame: p.frame})
+		}
+	}
+	t.mu.Unlock()
+
+	for _, r := range resends {
+		if _, ok := dead[r.snowID]; ok {
+			continue
+		}
+		if t.resend != nil && !t.resend(r.snowID, r.frame) {
+			t.deferResend(r.snowID, r.frame, now)
+			continue
+		}
+		t.stats.retransmits.Add(1)
+	}
+	for snowID, mm := range dead {
+		t.stats.deadConns.Add(1)
+		t.handOff(snowID, mm, true)
+	}
+}
+
+// deferResend 重传没发出去（网关自己忙，不是客户端没回）：退回这次重传计数，下一轮扫描再试，避免把正常连接判死
+func (t *QosTracker) deferResend(snowID string, f *pb.MessageFrameData, now time.Time) {
+	t.stats.deferred.Add(1)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.pending[snowID][qosKey(f)]; ok && p.retries > 0 {
+		p.retries--
+		p.deadline = now.Add(t.conf.ScanEvery)
+	}
+}
+
+// Stats 计数快照
+func (t *QosTracker) Stats() QosStats {
+	t.mu.Lock()
+	var pending int64
+	for _, mm := range t.pending {
+		pending += int64(len(mm))
+	}
+	t.mu.Unlock()
+	return QosStats{
+		Pending:         pending,
+		Tracked:         t.stats.tracked.Load(),
+		Acked:           t.stats.acked.Load(),
+		Nacked:          t.stats.nacked.Load(),
+		Retransmits:     t.stats.retransmits.Load(),
+		Deferred:        t.stats.deferred.Load(),
+		DeadConns:       t.stats.deadConns.Load(),
+		Requeued:        t.stats.requeued.Load(),
+		AckLatencyCount: t.stats.latCount.Load(),
+		AckLatencySumMS: t.stats.latSumMS.Load(),
+		AckLatencyMaxMS: t.stats.latMaxMS.Load(),
+	}
+}
@@ -0,0 +1,198 @@
+package chat
+
+import (
+	pb "PProject/gen/message"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// qosHarness 手动推进时钟、直接调 scanOnce，记录重传和转离线
+type qosHarness struct {
+	t   *QosTracker
+	now time.Time
+
+	mu       sync.Mutex
+	resent   []string
+	full     bool // 模拟写队列满
+	orphaned map[string][]string
+	dead     map[string]bool
+}
+
+func newQosHarness(tb testing.TB) *qosHarness {
+	h := &qosHarness{now: time.Unix(1_700_000_000, 0), orphaned: map[string][]string{}, dead: map[string]bool{}}
+	h.t = NewQosTracker(QosConf{
+		AckTimeout: time.Second,
+		MaxBackoff: 4 * time.Second,
+		MaxRetries: 3,
+		ScanEvery:  time.Hour, // 不让后台扫描干扰
+		Clock:      func() time.Time { return h.now },
+	}, func(snowID string, f *pb.MessageFrameData) bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.full {
+			return false
+		}
+		h.resent = append(h.resent, qosKey(f))
+		return true
+	}, func(snowID, userID string, frames []*pb.MessageFrameData, dead bool) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, f := range frames {
+			h.orphaned[snowID] = append(h.orphaned[snowID], qosKey(f))
+		}
+		h.dead[snowID] = dead
+	})
+	tb.Cleanup(h.t.Close)
+	return h
+}
+
+func (h *qosHarness) advance(d time.Duration) {
+	h.now = h.now.Add(d)
+	h.t.scanOnce(h.now)
+}
+
+func (h *qosHarness) takeResent() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := h.resent
+	h.resent = nil
+	return out
+}
+
+func ackFrame(serverMsgID string) *pb.MessageFrameData {
+	return &pb.MessageFrameData{
+		Type:        pb.MessageFrameData_DELIVER,
+		Qos:         pb.MessageFrameData_QOS_AT_LEAST_ONCE,
+		AckRequired: true,
+		Body:        &pb.MessageFrameData_Payload{Payload: &pb.MessageData{ServerMsgId: serverMsgID}},
+	}
+}
+
+func TestQosTrackAndAck(t *testing.T) {
+	h := newQosHarness(t)
+
+	// 不要求回执的帧不跟踪
+	h.t.Track("s1", "u1", &pb.MessageFrameData{Type: pb.MessageFrameData_DELIVER, Qos: pb.MessageFrameData_QOS_AT_MOST_ONCE})
+	h.t.Track("", "u1", ackFrame("m0"))
+	h.t.Track("s1", "u1", ackFrame("m1"))
+	h.t.Track("s1", "u1", ackFrame("m1")) // 重传写出时重复登记
+	h.t.Track("s1", "u1", ackFrame("m2"))
+	if st := h.t.Stats(); st.Pending != 2 || st.Tracked != 2 {
+		t.Fatalf("stats = %+v", st)
+	}
+
+	h.now = h.now.Add(300 * time.Millisecond)
+	if !h.t.Ack("s1", "", "m1") {
+		t.Fatal("ack m1")
+	}
+	if h.t.Ack("s1", "m1") || h.t.Ack("s2", "m2") {
+		t.Fatal("ack of unknown key/conn should miss")
+	}
+	st := h.t.Stats()
+	if st.Pending != 1 || st.Acked != 1 || st.AckLatencyMaxMS != 300 {
+		t.Fatalf("stats after ack = %+v", st)
+	}
+}
+
+func TestQosBackoff(t *testing.T) {
+	h := newQosHarness(t)
+	for n, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if got := h.t.backoff(n); got != want {
+			t.Fatalf("backoff(%d) = %v want %v", n, got, want)
+		}
+	}
+
+	h.t.Track("s1", "u1", ackFrame("m1"))
+	h.advance(999 * time.Millisecond)
+	if got := h.takeResent(); len(got) != 0 {
+		t.Fatalf("resent before timeout: %v", got)
+	}
+	h.advance(time.Millisecond)
+	if got := h.takeResent(); !slices.Equal(got, []string{"m1"}) {
+		t.Fatalf("first retransmit = %v", got)
+	}
+	// 第 1 次重传后等 2s
+	h.advance(1999 * time.Millisecond)
+	if got := h.takeResent(); len(got) != 0 {
+		t.Fatalf("resent before backoff: %v", got)
+	}
+	h.advance(time.Millisecond)
+	if got := h.takeResent(); !slices.Equal(got, []string{"m1"}) {
+		t.Fatalf("second retransmit = %v", got)
+	}
+}
+
+func TestQosDeadConn(t *testing.T) {
+	h := newQosHarness(t)
+	h.t.Track("s1", "u1", ackFrame("m1"))
+	h.t.Track("s1", "u1", ackFrame("m2"))
+	h.t.Track("s2", "u2", ackFrame("m3"))
+	h.t.Ack("s2", "m3")
+
+	for i := 0; i < 3; i++ {
+		h.advance(4 * time.Second)
+	}
+	if st := h.t.Stats(); st.Retransmits != 6 || st.DeadConns != 0 {
+		t.Fatalf("stats after retries = %+v", st)
+	}
+	h.advance(4 * time.Second)
+	got := h.orphaned["s1"]
+	slices.Sort(got)
+	if !h.dead["s1"] || !slices.Equal(got, []string{"m1", "m2"}) {
+		t.Fatalf("dead conn handoff = %v dead=%v", got, h.dead["s1"])
+	}
+	if st := h.t.Stats(); st.DeadConns != 1 || st.Pending != 0 || st.Requeued != 2 {
+		t.Fatalf("stats after dead = %+v", st)
+	}
+}
+
+func TestQosDeferredResendKeepsConnAlive(t *testing.T) {
+	h := newQosHarness(t)
+	h.t.Track("s1", "u1", ackFrame("m1"))
+
+	// 网关写队列一直满：重传发不出去，不能算客户端没回执，下一轮扫描（ScanEvery）再试
+	h.full = true
+	for i := 0; i < 10; i++ {
+		h.advance(time.Hour)
+	}
+	if st := h.t.Stats(); st.DeadConns != 0 || st.Retransmits != 0 || st.Deferred != 10 || st.Pending != 1 {
+		t.Fatalf("stats while full = %+v", st)
+	}
+
+	h.full = false
+	h.advance(time.Hour)
+	if got := h.takeResent(); !slices.Equal(got, []string{"m1"}) {
+		t.Fatalf("resent after queue drained = %v", got)
+	}
+}
+
+func TestQosRelease(t *testing.T) {
+	h := newQosHarness(t)
+	h.t.Track("s1", "u1", ackFrame("m1"))
+	h.t.Release("s1")
+	if h.dead["s1"] || !slices.Equal(h.orphaned["s1"], []string{"m1"}) {
+		t.Fatalf("release handoff = %v dead=%v", h.orphaned["s1"], h.dead["s1"])
+	}
+	if h.t.Ack("s1", "m1") {
+		t.Fatal("released frame still tracked")
+	}
+	h.t.Release("s1") // 没有未确认帧时不回调
+	if len(h.orphaned["s1"]) != 1 {
+		t.Fatalf("second release handed off again: %v", h.orphaned["s1"])
+	}
+
+	// retry=true 的 CNACK 立即重传；retry=false 的直接移除
+	h.t.Track("s2", "u2", ackFrame("m2"))
+	if f := h.t.Nack("s2", true, "m2"); f == nil {
+		t.Fatal("nack retry")
+	}
+	h.advance(0)
+	if got := h.takeResent(); !slices.Equal(got, []string{"m2"}) {
+		t.Fatalf("nack retry resent = %v", got)
+	}
+	if f := h.t.Nack("s2", false, "m2"); f == nil || h.t.Stats().Pending != 0 {
+		t.Fatal("nack drop")
+	}
+}
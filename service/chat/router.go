@@ -4,14 +4,18 @@ import (
 	pb "PProject/gen/message"
 	"PProject/logger"
 	ka "PProject/service/dispatcher/kafka"
+	online "PProject/service/storage"
+	util "PProject/tools"
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 type Server struct {
@@ -28,6 +32,8 @@ type Server struct {
 	dataOutbound chan *WSConnectionMsg     // 普通数据处理
 	disp         *Dispatcher               // 处理器
 	connMgr      *ConnManager              // connection manager
+	qos          *QosTracker               // 至少一次下发：未确认帧跟踪/重传
+	closeHooks   []func(userID, snowID string)
 
 	MsgHandler ka.ProducerHandler
 }
@@ -44,7 +50,7 @@ type WSReplayMsg struct {
 }
 
 func NewServer(gwID, routerAddr string, conn *ConnManager, msgHandler ka.ProducerHandler) (*Server, error) {
-	return &Server{
+	s := &Server{
 		gwID:       gwID,
 		routerAddr: routerAddr,
 		reg:        NewRegistry(),
@@ -52,7 +58,55 @@ func NewServer(gwID, routerAddr string, conn *ConnManager, msgHandler ka.Produce
 		connMgr:    conn,
 		disp:       NewDispatcher(),
 		MsgHandler: msgHandler,
-	}, nil
+	}
+	s.qos = NewQosTracker(QosConf{}, s.qosResend, s.qosOrphan)
+	return s, nil
+}
+
+func (s *Server) Qos() *QosTracker {
+	return s.qos
+}
+
+// OnConnClose 注册连接关闭回调（启动时注册，userID 为空表示未授权连接）
+func (s *Server) OnConnClose(fn func(userID, snowID string)) {
+	s.closeHooks = append(s.closeHooks, fn)
+}
+
+// qosResend 重传走写队列，和正常下发由同一个协程写连接；队列满时告诉 tracker 本轮没发出去
+func (s *Server) qosResend(snowID string, f *pb.MessageFrameData) bool {
+	select {
+	case WsRelayBound <- &WSReplayMsg{Frame: f, ConnectId: snowID}:
+		return true
+	default:
+		logger.Infof("[QOS] relay bound full, retransmit deferred snowID=%s", snowID)
+		return false
+	}
+}
+
+// qosOrphan 连接关闭或被判死：未确认帧转入用户离线队列，下次上线补发；判死的连接主动断开
+func (s *Server) qosOrphan(snowID, userID string, frames []*pb.MessageFrameData, dead bool) {
+	if dead {
+		logger.Infof("[QOS] conn dead after retransmits snowID=%s user=%s pending=%d", snowID, userID, len(frames))
+		s.connMgr.RemoveBySnow(snowID)
+	}
+	if userID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, f := range frames {
+		cp := proto.Clone(f).(*pb.MessageFrameData)
+		cp.To = userID
+		cp.SessionId, cp.ConnId, cp.GatewayId = "", "", ""
+		value, err := util.EncodeFrame(cp)
+		if err != nil {
+			logger.Errorf("[QOS] encode frame user=%s err=%v", userID, err)
+			continue
+		}
+		if _, err := online.EnqueueOffline(ctx, userID, qosKey(cp), cp.From, value); err != nil {
+			logger.Errorf("[QOS] requeue offline user=%s msg=%s err=%v", userID, qosKey(cp), err)
+		}
+	}
 }
 
 func (s *Server) ConnMgr() *ConnManager {
@@ -139,46 +193,57 @@ func (s *Server) LoopRelayData(ctx context.Context) {
 					ws, success := s.connMgr.Get(msg.Frame.To, msg.ConnectId)
 					if !success {
 						logger.Infof("[数据处理] 没有获取到有效的客户端")
+						continue
+					}
+					frame, ok := s.connMgr.Filter(msg.ConnectId).Apply(msg.Frame.To, msg.Frame)
+					if !ok {
+						continue
 					}
 
-					data, err := marshaller.Marshal(msg.Frame)
+					data, err := marshaller.Marshal(frame)
 					if err != nil {
-						logger.Errorf("[数据处理] 解析数据出错 failed: conn_id=%s err=%v", err)
+						logger.Errorf("[数据处理] 解析数据出错 failed: conn_id=%s err=%v", msg.ConnectId, err)
 						continue
 					}
 
 					// 发送（带写超时）
 					if err := writeJSONWithDeadline(ws, data, 5*time.Second); err != nil {
-						logger.Errorf("[loopConnect] send failed: conn_id=%s err=%v", err)
+						logger.Errorf("[loopConnect] send failed: conn_id=%s err=%v", msg.ConnectId, err)
 						// 发送失败：关闭并从管理器移除，防止死连接占用资源
 						_ = ws.Close()
 						s.connMgr.Remove(msg.Frame.To)
 						continue
 					}
+					s.qos.Track(msg.ConnectId, msg.Frame.To, msg.Frame)
 
 				} else {
-					connList := s.connMgr.GetAll(msg.Frame.To)
+					connList := s.connMgr.ListUserConns(msg.Frame.To)
 					if len(connList) == 0 {
 						logger.Infof("[数据处理] 没有获取到有效的客户端")
 						continue
 					}
 
-					for _, conn := range connList {
-						// 序列化（一次性）
-						data, err := marshaller.Marshal(msg.Frame)
+					for snowID, conn := range connList {
+						// 按连接声明的意图/分片过滤
+						frame, ok := s.connMgr.Filter(snowID).Apply(msg.Frame.To, msg.Frame)
+						if !ok {
+							continue
+						}
+						data, err := marshaller.Marshal(frame)
 						if err != nil {
-							logger.Errorf("[数据处理] 解析数据出错 failed: conn_id=%s err=%v", err)
+							logger.Errorf("[数据处理] 解析数据出错 failed: conn_id=%s err=%v", snowID, err)
 							continue
 						}
 
 						// 发送（带写超时）
 						if err := writeJSONWithDeadline(conn, data, 5*time.Second); err != nil {
-							logger.Errorf("[loopConnect] send failed: conn_id=%s err=%v", err)
+							logger.Errorf("[loopConnect] send failed: conn_id=%s err=%v", snowID, err)
 							// 发送失败：关闭并从管理器移除，防止死连接占用资源
 							_ = conn.Close()
 							s.connMgr.Remove(msg.Frame.To)
 							continue
 						}
+						s.qos.Track(snowID, msg.Frame.To, msg.Frame)
 					}
 				}
 
@@ -264,6 +329,33 @@ func RelayMsg(msgData []byte, conectId string) error {
 	return nil
 }
 
+// MetaRecipients 按网关聚合下发时，frame.Meta 中携带本网关接收者列表（逗号分隔）
+const MetaRecipients = "recipients"
+
+// MetaSystemNotify 服务端生成的通知消息（群通知等）不做发送者校验；网关会去掉客户端帧里的这个标记，防止伪造
+const MetaSystemNotify = "system_notify"
+
+// MetaChannel 广播频道帧：frame.Meta 中携带频道ID，网关按本地订阅者下发，不带接收者列表
+const MetaChannel = "channel_id"
+
+// RelayFrameToRecipients 把按网关聚合的帧拆成每个接收者一帧，投递到本地连接
+func RelayFrameToRecipients(frame *pb.MessageFrameData) {
+	RelayFrameToUsers(frame, strings.Split(frame.GetMeta()[MetaRecipients], ","))
+}
+
+// RelayFrameToUsers 给本网关上的每个用户投递一份帧
+func RelayFrameToUsers(frame *pb.MessageFrameData, users []string) {
+	for _, uid := range users {
+		if uid == "" {
+			continue
+		}
+		f := proto.Clone(frame).(*pb.MessageFrameData)
+		delete(f.Meta, MetaRecipients)
+		f.To = uid
+		WsRelayBound <- &WSReplayMsg{Frame: f}
+	}
+}
+
 // WsOutbound package-scope channel shared with ws_server.go for simplicity
 var WsOutbound = make(chan *pb.MessageFrame, 8192)
 
@@ -110,7 +110,23 @@ func (s *Server) HandleWS(c *gin.Context) {
 				continue
 			}
 
-		} else if msg.Type == pb.MessageFrameData_DATA || msg.Type == pb.MessageFrameData_CACK {
+		} else if msg.Type == pb.MessageFrameData_PRESENCE {
+
+			// 状态/正在输入：用户以连接上绑定的为准
+			msg.SessionId = rec.SnowID
+			if err := dataHandler.Handle(&ChatContext{S: s}, msg, &WsConn{Conn: ws}); err != nil {
+				logger.Infof("[HandleWS] presence handler err=%v", err)
+			}
+
+		} else if msg.Type == pb.MessageFrameData_SYNC {
+
+			// 客户端拉取同步（会话列表等），结果只回给本连接
+			msg.SessionId = rec.SnowID
+			if err := dataHandler.Handle(&ChatContext{S: s}, msg, &WsConn{Conn: ws}); err != nil {
+				logger.Infof("[HandleWS] sync handler err=%v", err)
+			}
+
+		} else if msg.Type == pb.MessageFrameData_DATA || msg.Type == pb.MessageFrameData_CACK || msg.Type == pb.MessageFrameData_CNACK {
 
 			//to := msg.To // 接收者
 			// 判断接收者是否在线 如果不在线 就发松mq 落库 如果在线 看下 在那个节点， 找到那个节点 发送节点相关的topic
@@ -148,6 +164,13 @@ func (s *Server) HandleWS(c *gin.Context) {
 		// 已授权连接：如果你有对应 API，可在这里做 Offline(user, snowID, ...)
 	}
 
+	// 还没 CACK 的下发转入离线队列，下次上线补发
+	s.qos.Release(rec.SnowID)
+
+	for _, fn := range s.closeHooks {
+		fn(rec.UserId, rec.SnowID)
+	}
+
 	// 向全局广播 UNREGISTER（非阻塞）
 	select {
 	case WsOutbound <- &pb.MessageFrame{Type: pb.MessageFrame_UNREGISTER, From: rec.UserId}:
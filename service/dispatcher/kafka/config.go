@@ -3,6 +3,7 @@ package kafka
 import (
 	pb "PProject/gen/message"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/Shopify/sarama"
@@ -83,6 +84,8 @@ type AppConfig struct {
 	AutoCreateTopicsOnStart bool
 	ReplicationFactor       int
 	PartitionsPerTopic      int
+	Retry                   RetryPolicy            // 默认的失败重试/死信策略
+	TopicRetry              map[string]RetryPolicy // 按 topic 覆盖：key 为完整 topic 名，或 MessageHandlerConfig 的 Send/ReceiveTopicPattern
 }
 
 func NewAppConfig() *AppConfig {
@@ -118,6 +121,26 @@ func (c *AppConfig) GetAllTopicKeys() []string {
 	return out
 }
 
+// RetryPolicyFor topic 的失败策略：完整 topic 名 > 所属 pattern > 默认
+func (c *AppConfig) RetryPolicyFor(topic string) RetryPolicy {
+	if p, ok := c.TopicRetry[topic]; ok {
+		return p
+	}
+	for _, mc := range c.MessageConfigs {
+		for _, pattern := range []string{mc.SendTopicPattern, mc.ReceiveTopicPattern} {
+			p, ok := c.TopicRetry[pattern]
+			if pattern == "" || !ok {
+				continue
+			}
+			if slices.Contains(mc.genKeys(pattern, mc.TopicCount, true), topic) ||
+				slices.Contains(mc.genKeys(pattern, mc.TopicCount, false), topic) {
+				return p
+			}
+		}
+	}
+	return c.Retry
+}
+
 //TopicPattern            string // 例如 "im.shard-%02d"
 //TopicCount              int    // 32/64/128…
 //PartitionsPerTopic      int32  // Demo: 8；生产：512~1024
@@ -141,6 +164,7 @@ var Cfg = AppConfig{
 	ConsumerInitialOffset:   "newest",
 	KafkaVersion:            sarama.V2_1_0_0,
 	AutoCreateTopicsOnStart: true,
+	Retry:                   DefaultRetryPolicy,
 }
 
 var CAckCfg = AppConfig{
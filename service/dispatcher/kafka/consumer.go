@@ -55,53 +55,81 @@ func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 	defer commitTicker.Stop()
 
 	logger.Infof("[claim start] topic=%s partition=%d initial=%d",
-		claim.Topic(), claim.Partition(), claim.InitialOffset)
+		claim.Topic(), claim.Partition(), claim.InitialOffset())
+
+	// 提交到 ants：只做业务处理，不触碰 session；重试 topic 上的消息交给原 topic 的 handler
+	ctx := session.Context()
+	dispatch := func(msg *sarama.ConsumerMessage) {
+		// 背压
+		inflight <- struct{}{}
+
+		origTopic, attempt := deliveryOf(msg)
+		hdr, err := getRecordHandler(origTopic)
+		if err != nil {
+			logger.Errorf("No handler for topic=%s: %v", origTopic, err)
+			<-inflight
+			ackC <- ack{off: msg.Offset, ok: false}
+			return
+		}
+		submitErr := pool.Submit(func(m *sarama.ConsumerMessage, h RecordHandler) func() {
+			return func() {
+				defer func() { <-inflight }()
+				if e := h(ctx, toRecord(origTopic, m)); e != nil {
+					logger.Errorf("handler error topic=%s partition=%d offset=%d attempt=%d err=%v",
+						m.Topic, m.Partition, m.Offset, attempt+1, e)
+					// 转到重试/死信 topic 成功才推进，投递失败仍停在这里
+					if re := routeFailure(m, origTopic, attempt+1, e); re != nil {
+						logger.Errorf("route failure topic=%s offset=%d err=%v", m.Topic, m.Offset, re)
+						ackC <- ack{off: m.Offset, ok: false}
+						return
+					}
+				}
+				ackC <- ack{off: m.Offset, ok: true}
+			}
+		}(msg, hdr))
+		if submitErr != nil {
+			// 极端情况下 pool.Submit 失败（例如被关闭）
+			logger.Errorf("pool submit failed: %v", submitErr)
+			<-inflight
+			ackC <- ack{off: msg.Offset, ok: false}
+		}
+	}
+
+	// 重试消息没到期：暂停读这个分区（不占 worker 和在途名额），到期后再派发，期间照常处理回执
+	var delayed *sarama.ConsumerMessage
+	dueTimer := time.NewTimer(time.Hour)
+	dueTimer.Stop()
+	defer dueTimer.Stop()
 
 	for {
+		msgs := claim.Messages()
+		var due <-chan time.Time
+		if delayed != nil {
+			msgs, due = nil, dueTimer.C
+		}
+
 		select {
-		case msg, ok := <-claim.Messages():
+		case msg, ok := <-msgs:
 			if !ok {
 				// 分区被回收
 				logger.Errorf("[claim done] topic=%s partition=%d", claim.Topic(), claim.Partition())
 				return nil
 			}
-			// 提前拷贝（如你的业务会修改 msg.Value/Key；若只读可不拷贝）
-			// key := append([]byte(nil), msg.Key...)
-			// val := append([]byte(nil), msg.Value...)
-
-			// 背压
-			inflight <- struct{}{}
-
-			// 提交到 ants：只做业务处理，不触碰 session
-			hdr, err := GetHandler(msg.Topic)
-			if err != nil {
-				logger.Errorf("No handler for topic=%s: %v", msg.Topic, err)
-				<-inflight
-				ackC <- ack{off: msg.Offset, ok: false}
+			if d := retryDelay(msg, time.Now()); d > 0 {
+				delayed = msg
+				dueTimer.Reset(d)
 				break
 			}
-			submitErr := pool.Submit(func(m *sarama.ConsumerMessage, h func(string, []byte, []byte) error) func() {
-				return func() {
-					defer func() { <-inflight }()
-					if e := h(m.Topic, m.Key, m.Value); e != nil {
-						logger.Errorf("handler error topic=%s partition=%d offset=%d err=%v",
-							m.Topic, m.Partition, m.Offset, e)
-						ackC <- ack{off: m.Offset, ok: false}
-						return
-					}
-					ackC <- ack{off: m.Offset, ok: true}
-				}
-			}(msg, hdr))
-			if submitErr != nil {
-				// 极端情况下 pool.Submit 失败（例如被关闭）
-				logger.Errorf("pool submit failed: %v", submitErr)
-				<-inflight
-				ackC <- ack{off: msg.Offset, ok: false}
-			}
+			dispatch(msg)
+
+		case <-due:
+			msg := delayed
+			delayed = nil
+			dispatch(msg)
 
 		case a := <-ackC:
 			if !a.ok {
-				// 失败：不推进提交点（可在这里做重试/DLQ）
+				// 失败且没能转到重试/死信 topic：不推进提交点
 				break
 			}
 			pendingOK[a.off] = struct{}{}
@@ -142,7 +170,32 @@ func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 	}
 }
 
+func toRecord(topic string, m *sarama.ConsumerMessage) *Record {
+	var hs map[string]string
+	if len(m.Headers) > 0 {
+		hs = make(map[string]string, len(m.Headers))
+		for _, h := range m.Headers {
+			if h != nil {
+				hs[string(h.Key)] = string(h.Value)
+			}
+		}
+	}
+	return &Record{
+		Topic:     topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Value:     m.Value,
+		Headers:   hs,
+	}
+}
+
 func StartConsumerGroup(brokers []string, groupID string, topics []string) error {
+	return StartConsumerGroupCtx(context.Background(), brokers, groupID, topics)
+}
+
+// StartConsumerGroupCtx 阻塞消费，parent 结束时退出
+func StartConsumerGroupCtx(parent context.Context, brokers []string, groupID string, topics []string) error {
 	cfg := sarama.NewConfig()
 	cfg.Version = sarama.V2_1_0_0
 
@@ -174,7 +227,7 @@ func StartConsumerGroup(brokers []string, groupID string, topics []string) error
 	}()
 
 	// 优雅退出
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
 	defer cancel()
 	go func() {
 		//signal.Ignored()
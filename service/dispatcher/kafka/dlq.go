@@ -0,0 +1,192 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ===== 死信查看 / 回放 =====
+
+// 回放时去掉的失败信息 headers
+var failureHeaderKeys = map[string]bool{
+	HeaderOriginalTopic:     true,
+	HeaderOriginalPartition: true,
+	HeaderOriginalOffset:    true,
+	HeaderAttempt:           true,
+	HeaderError:             true,
+	HeaderFailedAt:          true,
+	HeaderNotBefore:         true,
+	HeaderReplayedAt:        true,
+}
+
+// DLQMessage 一条死信
+type DLQMessage struct {
+	Topic         string            `json:"topic"`
+	Partition     int32             `json:"partition"`
+	Offset        int64             `json:"offset"`
+	Key           string            `json:"key"`
+	Value         []byte            `json:"value"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Headers       map[string]string `json:"headers"`
+	OriginalTopic string            `json:"original_topic"`
+	Attempt       int               `json:"attempt"`
+	Error         string            `json:"error"`
+	FailedAt      int64             `json:"failed_at"`
+}
+
+func toDLQMessage(m *sarama.ConsumerMessage) *DLQMessage {
+	hs := make(map[string]string, len(m.Headers))
+	for _, h := range m.Headers {
+		if h != nil {
+			hs[string(h.Key)] = string(h.Value)
+		}
+	}
+	orig := hs[HeaderOriginalTopic]
+	if orig == "" {
+		orig = strings.TrimSuffix(m.Topic, dlqTopicSuffix)
+	}
+	attempt, _ := strconv.Atoi(hs[HeaderAttempt])
+	failedAt, _ := strconv.ParseInt(hs[HeaderFailedAt], 10, 64)
+	return &DLQMessage{
+		Topic:         m.Topic,
+		Partition:     m.Partition,
+		Offset:        m.Offset,
+		Key:           string(m.Key),
+		Value:         m.Value,
+		Timestamp:     m.Timestamp,
+		Headers:       hs,
+		OriginalTopic: orig,
+		Attempt:       attempt,
+		Error:         hs[HeaderError],
+		FailedAt:      failedAt,
+	}
+}
+
+// readPartition 从 offset 起读最多 limit 条，读到分区末尾或 ctx 结束即返回
+func readPartition(ctx context.Context, topic string, partition int32, offset int64, limit int) ([]*sarama.ConsumerMessage, error) {
+	if KafkaClient == nil {
+		return nil, fmt.Errorf("kafka client not initialized")
+	}
+	newest, err := KafkaClient.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, err
+	}
+	oldest, err := KafkaClient.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, err
+	}
+	if offset < oldest {
+		offset = oldest
+	}
+	if offset >= newest || limit <= 0 {
+		return nil, nil
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(KafkaClient)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+	pc, err := consumer.ConsumePartition(topic, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+
+	var out []*sarama.ConsumerMessage
+	for len(out) < limit {
+		select {
+		case <-ctx.Done():
+			return out, nil
+		case e := <-pc.Errors():
+			return out, e
+		case m := <-pc.Messages():
+			out = append(out, m)
+			if m.Offset+1 >= newest {
+				return out, nil
+			}
+		}
+	}
+	return out, nil
+}
+
+// InspectDLQ 查看死信：partition < 0 表示所有分区，每个分区从 offset 起最多 limit 条
+func InspectDLQ(ctx context.Context, dlqTopic string, partition int32, offset int64, limit int) ([]*DLQMessage, error) {
+	if !strings.HasSuffix(dlqTopic, dlqTopicSuffix) {
+		dlqTopic = DLQTopic(dlqTopic)
+	}
+	if KafkaClient == nil {
+		return nil, fmt.Errorf("kafka client not initialized")
+	}
+	parts := []int32{partition}
+	if partition < 0 {
+		ps, err := KafkaClient.Partitions(dlqTopic)
+		if err != nil {
+			return nil, err
+		}
+		parts = ps
+	}
+
+	var out []*DLQMessage
+	for _, p := range parts {
+		msgs, err := readPartition(ctx, dlqTopic, p, offset, limit)
+		if err != nil {
+			return out, fmt.Errorf("read %s/%d: %w", dlqTopic, p, err)
+		}
+		for _, m := range msgs {
+			out = append(out, toDLQMessage(m))
+		}
+	}
+	return out, nil
+}
+
+// ReplayDLQ 把死信 [from, to] 区间回放到原 topic；去掉失败信息，从第一次处理重新开始，返回回放条数
+func ReplayDLQ(ctx context.Context, dlqTopic string, partition int32, from, to int64) (int, error) {
+	if !strings.HasSuffix(dlqTopic, dlqTopicSuffix) {
+		dlqTopic = DLQTopic(dlqTopic)
+	}
+	if to < from {
+		return 0, fmt.Errorf("invalid offset range [%d, %d]", from, to)
+	}
+	if Producer == nil {
+		return 0, fmt.Errorf("producer not initialized")
+	}
+	msgs, err := readPartition(ctx, dlqTopic, partition, from, int(to-from+1))
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for _, m := range msgs {
+		if m.Offset > to {
+			break
+		}
+		d := toDLQMessage(m)
+		headers := make([]sarama.RecordHeader, 0, len(m.Headers)+1)
+		for _, h := range m.Headers {
+			if h == nil || failureHeaderKeys[string(h.Key)] {
+				continue
+			}
+			headers = append(headers, sarama.RecordHeader{Key: h.Key, Value: h.Value})
+		}
+		headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderReplayedAt), Value: []byte(now)})
+
+		_, _, err := Producer.SendMessage(&sarama.ProducerMessage{
+			Topic:   d.OriginalTopic,
+			Key:     sarama.ByteEncoder(m.Key),
+			Value:   sarama.ByteEncoder(m.Value),
+			Headers: headers,
+		})
+		if err != nil {
+			return replayed, fmt.Errorf("replay %s/%d@%d: %w", dlqTopic, partition, m.Offset, err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
@@ -9,11 +10,50 @@ import (
 type MessageHandler func(topic string, key, value []byte) error
 type ProducerHandler func(topic, key string, value []byte) error
 
+// Record 消费到的一条消息（带 headers）；重试 topic 上的消息 Topic 已还原成原 topic
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// RecordHandler 需要 headers/ctx 的处理函数（消息总线用），优先于 MessageHandler
+type RecordHandler func(ctx context.Context, r *Record) error
+
 var (
-	handlerMap = make(map[string]MessageHandler)
-	mu         sync.RWMutex
+	handlerMap       = make(map[string]MessageHandler)
+	recordHandlerMap = make(map[string]RecordHandler)
+	mu               sync.RWMutex
 )
 
+// RegisterRecordHandler 注册带 headers 的处理函数；同一 topic 后注册的覆盖先注册的
+func RegisterRecordHandler(topic string, handler RecordHandler) {
+	if handler == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	recordHandlerMap[topic] = handler
+}
+
+// getRecordHandler 先找 RecordHandler，没有再把 MessageHandler 包一层
+func getRecordHandler(topic string) (RecordHandler, error) {
+	mu.RLock()
+	rh, ok := recordHandlerMap[topic]
+	mu.RUnlock()
+	if ok {
+		return rh, nil
+	}
+	h, err := GetHandler(topic)
+	if err != nil {
+		return nil, err
+	}
+	return func(_ context.Context, r *Record) error { return h(r.Topic, r.Key, r.Value) }, nil
+}
+
 func RegisterHandler(topic string, handler MessageHandler) (ok bool, duplicated bool) {
 	if handler == nil {
 		return false, false
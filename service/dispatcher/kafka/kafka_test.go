@@ -2,11 +2,23 @@ package kafka
 
 import (
 	"log"
+	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 )
 
+// testBrokers 集成测试需要真实的 Kafka：PPCHAT_TEST_KAFKA=localhost:9092 go test ./service/dispatcher/kafka/
+func testBrokers(t *testing.T) []string {
+	t.Helper()
+	v := os.Getenv("PPCHAT_TEST_KAFKA")
+	if v == "" {
+		t.Skip("PPCHAT_TEST_KAFKA not set")
+	}
+	return strings.Split(v, ",")
+}
+
 func handleTestTopic(topic string, key, value []byte) error {
 	log.Printf("[TestTopic] key=%s, value=%s", key, value)
 	return nil
@@ -14,9 +26,9 @@ func handleTestTopic(topic string, key, value []byte) error {
 
 func TestConnectKafka(t *testing.T) {
 
-	brokers := []string{"localhost:9092"}
+	Cfg.Brokers = testBrokers(t)
 
-	if err := InitKafkaClient(brokers); err != nil {
+	if err := InitKafkaClient(); err != nil {
 		log.Fatal("InitKafkaClient failed:", err)
 	}
 
@@ -30,11 +42,11 @@ func TestConnectKafka(t *testing.T) {
 
 func TestSendKafkaMessage(t *testing.T) {
 
-	brokers := []string{"localhost:9092"}
+	Cfg.Brokers = testBrokers(t)
 	topic := "test-topic"
 	message := "send kafka system msg"
 
-	if err := InitKafkaClient(brokers); err != nil {
+	if err := InitKafkaClient(); err != nil {
 		t.Fatalf("InitKafkaClient failed: %v", err)
 	}
 
@@ -51,6 +63,7 @@ func TestSendKafkaMessage(t *testing.T) {
 }
 
 func TestKafkaConsumerGroup(t *testing.T) {
+	brokers := testBrokers(t)
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -59,7 +72,7 @@ func TestKafkaConsumerGroup(t *testing.T) {
 
 	go func() {
 		err := StartConsumerGroup(
-			[]string{"localhost:9092"},
+			brokers,
 			"my-test-group",
 			[]string{"test-topic", "log-topic"},
 		)
@@ -0,0 +1,194 @@
+package kafka
+
+import (
+	"PProject/logger"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ===== 失败重试阶梯 + 死信 =====
+// handler 返回错误时，消息投到 <topic>.retry.<n>，延迟 Delays[n-1] 后重新交给原 topic 的 handler；
+// 重试用完投到 <topic>.dlq（带原始 headers、错误原因、尝试次数），原分区位点照常推进，不会被毒消息卡住
+
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderAttempt           = "x-attempt"          // 已失败次数
+	HeaderError             = "x-error"            // 最近一次失败原因
+	HeaderFailedAt          = "x-failed-at"        // 最近一次失败时间（unix ms）
+	HeaderNotBefore         = "x-retry-not-before" // 重试消息不早于该时间（unix ms）处理
+	HeaderReplayedAt        = "x-dlq-replayed-at"  // 从死信回放的时间（unix ms）
+)
+
+const (
+	retryTopicInfix = ".retry."
+	dlqTopicSuffix  = ".dlq"
+	maxErrorHeader  = 1024
+)
+
+// RetryPolicy 单个 topic 的失败处理策略
+type RetryPolicy struct {
+	Delays     []time.Duration // 各级重试延迟（逐级递增，如 5s/30s/5m）；为空则失败直接进死信
+	DisableDLQ bool            // 重试用完后丢弃（只记日志），不进死信
+}
+
+// DefaultRetryPolicy 默认三级重试
+var DefaultRetryPolicy = RetryPolicy{
+	Delays: []time.Duration{5 * time.Second, 30 * time.Second, 5 * time.Minute},
+}
+
+// MaxAttempts 最多处理次数（首次 + 重试）
+func (p RetryPolicy) MaxAttempts() int { return len(p.Delays) + 1 }
+
+func RetryTopic(topic string, level int) string {
+	return fmt.Sprintf("%s%s%d", topic, retryTopicInfix, level)
+}
+
+func DLQTopic(topic string) string { return topic + dlqTopicSuffix }
+
+// parseRetryTopic <topic>.retry.<n> -> topic, n
+func parseRetryTopic(topic string) (string, int, bool) {
+	i := strings.LastIndex(topic, retryTopicInfix)
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(topic[i+len(retryTopicInfix):])
+	if err != nil || n <= 0 {
+		return "", 0, false
+	}
+	return topic[:i], n, true
+}
+
+// RetryTopicsFor 一组主 topic 对应的全部重试 topic（消费组需要一起订阅）
+func (c *AppConfig) RetryTopicsFor(topics []string) []string {
+	var out []string
+	for _, t := range topics {
+		for i := range c.RetryPolicyFor(t).Delays {
+			out = append(out, RetryTopic(t, i+1))
+		}
+	}
+	return out
+}
+
+func headerValue(headers []*sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func headerInt64(headers []*sarama.RecordHeader, key string) int64 {
+	v, _ := strconv.ParseInt(headerValue(headers, key), 10, 64)
+	return v
+}
+
+// deliveryOf 消息要交给哪个 topic 的 handler、之前已失败几次；重试 topic 上的消息还原成原 topic
+func deliveryOf(m *sarama.ConsumerMessage) (origTopic string, attempt int) {
+	orig, _, ok := parseRetryTopic(m.Topic)
+	if !ok {
+		return m.Topic, 0
+	}
+	if t := headerValue(m.Headers, HeaderOriginalTopic); t != "" {
+		orig = t
+	}
+	return orig, int(headerInt64(m.Headers, HeaderAttempt))
+}
+
+// retryDelay 重试消息距 not-before 还要等多久；不是重试消息或已到期返回 0
+// 不在 worker 里睡：ConsumeClaim 看到未到期的消息就暂停读这个分区，到期再交给 worker
+// 同一重试 topic 延迟相同，分区内 not-before 递增，队头没到期后面的也不会到期
+func retryDelay(m *sarama.ConsumerMessage, now time.Time) time.Duration {
+	nb := headerInt64(m.Headers, HeaderNotBefore)
+	if nb <= 0 {
+		return 0
+	}
+	if d := time.UnixMilli(nb).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// failureHeaders 保留原始 headers，覆盖失败信息；原始位置只在第一次失败时记录
+func failureHeaders(m *sarama.ConsumerMessage, origTopic string, attempt int, cause error, now time.Time) []sarama.RecordHeader {
+	override := map[string]string{
+		HeaderAttempt:  strconv.Itoa(attempt),
+		HeaderError:    truncateErr(cause),
+		HeaderFailedAt: strconv.FormatInt(now.UnixMilli(), 10),
+	}
+	if headerValue(m.Headers, HeaderOriginalTopic) == "" {
+		override[HeaderOriginalTopic] = origTopic
+		override[HeaderOriginalPartition] = strconv.Itoa(int(m.Partition))
+		override[HeaderOriginalOffset] = strconv.FormatInt(m.Offset, 10)
+	}
+
+	out := make([]sarama.RecordHeader, 0, len(m.Headers)+len(override))
+	for _, h := range m.Headers {
+		if h == nil {
+			continue
+		}
+		k := string(h.Key)
+		if _, ok := override[k]; ok || k == HeaderNotBefore {
+			continue
+		}
+		out = append(out, sarama.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	for k, v := range override {
+		out = append(out, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return out
+}
+
+func truncateErr(err error) string {
+	if err == nil {
+		return ""
+	}
+	s := err.Error()
+	if len(s) > maxErrorHeader {
+		s = s[:maxErrorHeader]
+	}
+	return s
+}
+
+// routeFailure 第 attempt 次处理失败：投到下一级重试 topic 或死信 topic；返回 nil 表示已转走，可以推进位点
+func routeFailure(m *sarama.ConsumerMessage, origTopic string, attempt int, cause error) error {
+	policy := Cfg.RetryPolicyFor(origTopic)
+	now := time.Now()
+	headers := failureHeaders(m, origTopic, attempt, cause, now)
+
+	var target string
+	switch {
+	case attempt <= len(policy.Delays):
+		target = RetryTopic(origTopic, attempt)
+		nb := now.Add(policy.Delays[attempt-1]).UnixMilli()
+		headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderNotBefore), Value: []byte(strconv.FormatInt(nb, 10))})
+	case policy.DisableDLQ:
+		logger.Errorf("[kafka] drop message after %d attempts topic=%s partition=%d offset=%d err=%v",
+			attempt, origTopic, m.Partition, m.Offset, cause)
+		return nil
+	default:
+		target = DLQTopic(origTopic)
+	}
+
+	if Producer == nil {
+		return fmt.Errorf("producer not initialized")
+	}
+	_, _, err := Producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   target,
+		Key:     sarama.ByteEncoder(m.Key),
+		Value:   sarama.ByteEncoder(m.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("route to %s: %w", target, err)
+	}
+	logger.Infof("[kafka] message routed to %s attempt=%d from topic=%s partition=%d offset=%d",
+		target, attempt, m.Topic, m.Partition, m.Offset)
+	return nil
+}
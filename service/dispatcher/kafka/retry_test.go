@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestParseRetryTopic(t *testing.T) {
+	cases := []struct {
+		topic string
+		orig  string
+		level int
+		ok    bool
+	}{
+		{RetryTopic("im.data-1", 2), "im.data-1", 2, true},
+		{"n1_im.retry.data.retry.3", "n1_im.retry.data", 3, true},
+		{"im.data-1", "", 0, false},
+		{"im.data-1.retry.", "", 0, false},
+		{"im.data-1.retry.x", "", 0, false},
+		{"im.data-1.retry.0", "", 0, false},
+		{".retry.1", "", 0, false},
+		{DLQTopic("im.data-1"), "", 0, false},
+	}
+	for _, c := range cases {
+		orig, level, ok := parseRetryTopic(c.topic)
+		if orig != c.orig || level != c.level || ok != c.ok {
+			t.Errorf("parseRetryTopic(%q) = %q, %d, %v", c.topic, orig, level, ok)
+		}
+	}
+}
+
+func TestRetryPolicyFor(t *testing.T) {
+	fast := RetryPolicy{Delays: []time.Duration{time.Second}}
+	none := RetryPolicy{DisableDLQ: true}
+	cfg := &AppConfig{
+		Retry: DefaultRetryPolicy,
+		MessageConfigs: []MessageHandlerConfig{{
+			NodeId:              "n1",
+			SendTopicPattern:    "im.send-%d",
+			ReceiveTopicPattern: "im.recv-{i}",
+			TopicCount:          2,
+		}},
+		TopicRetry: map[string]RetryPolicy{
+			"im.send-%d":   fast, // 按 pattern 覆盖
+			"n1_im.recv-1": none, // 按完整 topic 覆盖
+		},
+	}
+
+	for topic, want := range map[string]RetryPolicy{
+		"n1_im.send-0": fast,
+		"n1_im.send-1": fast,
+		"n1_im.recv-1": none,
+		"n1_im.recv-0": DefaultRetryPolicy,
+		"other":        DefaultRetryPolicy,
+	} {
+		if got := cfg.RetryPolicyFor(topic); !slices.Equal(got.Delays, want.Delays) || got.DisableDLQ != want.DisableDLQ {
+			t.Errorf("RetryPolicyFor(%s) = %+v want %+v", topic, got, want)
+		}
+	}
+
+	got := cfg.RetryTopicsFor([]string{"n1_im.send-0", "n1_im.recv-1", "other"})
+	want := []string{"n1_im.send-0.retry.1", "other.retry.1", "other.retry.2", "other.retry.3"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("RetryTopicsFor = %v want %v", got, want)
+	}
+}
+
+func header(m *sarama.ConsumerMessage, key, value string) {
+	m.Headers = append(m.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func headersMap(hs []sarama.RecordHeader) map[string]string {
+	out := make(map[string]string, len(hs))
+	for _, h := range hs {
+		if _, dup := out[string(h.Key)]; dup {
+			out["dup:"+string(h.Key)] = string(h.Value)
+		}
+		out[string(h.Key)] = string(h.Value)
+	}
+	return out
+}
+
+func TestFailureHeaders(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+
+	// 第一次失败：记下原始位置，保留业务 header
+	m := &sarama.ConsumerMessage{Topic: "im.data-1", Partition: 3, Offset: 42}
+	header(m, "trace-id", "abc")
+	got := headersMap(failureHeaders(m, "im.data-1", 1, errors.New("boom"), now))
+	want := map[string]string{
+		"trace-id":              "abc",
+		HeaderAttempt:           "1",
+		HeaderError:             "boom",
+		HeaderFailedAt:          strconv.FormatInt(now.UnixMilli(), 10),
+		HeaderOriginalTopic:     "im.data-1",
+		HeaderOriginalPartition: "3",
+		HeaderOriginalOffset:    "42",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("headers = %v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q want %q", k, got[k], v)
+		}
+	}
+
+	// 重试 topic 上再失败：原始位置不变，旧的 attempt/not-before 被替换，超长错误截断
+	r := &sarama.ConsumerMessage{Topic: RetryTopic("im.data-1", 1), Partition: 0, Offset: 7}
+	for k, v := range want {
+		header(r, k, v)
+	}
+	header(r, HeaderNotBefore, "123")
+	got = headersMap(failureHeaders(r, "im.data-1", 2, errors.New(strings.Repeat("x", maxErrorHeader+10)), now))
+	if got[HeaderOriginalPartition] != "3" || got[HeaderOriginalOffset] != "42" || got[HeaderAttempt] != "2" {
+		t.Fatalf("retry headers = %v", got)
+	}
+	if _, ok := got[HeaderNotBefore]; ok {
+		t.Fatal("not-before carried over")
+	}
+	if len(got[HeaderError]) != maxErrorHeader {
+		t.Fatalf("error header len = %d", len(got[HeaderError]))
+	}
+	for k := range got {
+		if strings.HasPrefix(k, "dup:") {
+			t.Fatalf("duplicate header %s", k)
+		}
+	}
+}
+
+func TestDeliveryOfAndRetryDelay(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+
+	m := &sarama.ConsumerMessage{Topic: "im.data-1"}
+	if topic, attempt := deliveryOf(m); topic != "im.data-1" || attempt != 0 {
+		t.Fatalf("deliveryOf(main) = %s, %d", topic, attempt)
+	}
+	if d := retryDelay(m, now); d != 0 {
+		t.Fatalf("main topic delay = %v", d)
+	}
+
+	r := &sarama.ConsumerMessage{Topic: RetryTopic("n1_im.data-1", 2)}
+	header(r, HeaderOriginalTopic, "n1_im.data-1")
+	header(r, HeaderAttempt, "2")
+	header(r, HeaderNotBefore, strconv.FormatInt(now.Add(30*time.Second).UnixMilli(), 10))
+	if topic, attempt := deliveryOf(r); topic != "n1_im.data-1" || attempt != 2 {
+		t.Fatalf("deliveryOf(retry) = %s, %d", topic, attempt)
+	}
+	if d := retryDelay(r, now); d != 30*time.Second {
+		t.Fatalf("retry delay = %v", d)
+	}
+	if d := retryDelay(r, now.Add(time.Minute)); d != 0 {
+		t.Fatalf("overdue delay = %v", d)
+	}
+}
@@ -210,6 +210,36 @@ func EnsureTopics(ctx context.Context, app AppConfig) error {
 			}
 		}
 
+		// 重试/死信 topic：按实际消费的 topic 展开；死信保留更久，方便排查和回放
+		dlqRetentionMs := fmt.Sprintf("%d", 30*24*60*60*1000) // 30天
+		dlqCfgs := make(map[string]*string, len(cfgs))
+		for k, v := range cfgs {
+			dlqCfgs[k] = v
+		}
+		dlqCfgs["retention.ms"] = &dlqRetentionMs
+
+		consumed := append(mc.Keys(), candidates...)
+		for _, t := range app.RetryTopicsFor(consumed) {
+			if _, ok := existing[t]; ok {
+				continue
+			}
+			if _, dup := planMap[t]; !dup {
+				planMap[t] = topicPlan{name: t, partitions: partitions, replicationFactor: rep, configEntries: cfgs}
+			}
+		}
+		for _, t := range consumed {
+			if app.RetryPolicyFor(t).DisableDLQ {
+				continue
+			}
+			d := DLQTopic(t)
+			if _, ok := existing[d]; ok {
+				continue
+			}
+			if _, dup := planMap[d]; !dup {
+				planMap[d] = topicPlan{name: d, partitions: partitions, replicationFactor: rep, configEntries: dlqCfgs}
+			}
+		}
+
 		// —— 注册 handler —— //
 		switch {
 		case hasMethod(mc, "SendTopicKeys") && hasMethod(mc, "ReceiveTopicKeys"):
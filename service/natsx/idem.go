@@ -2,35 +2,49 @@ package natsx
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"sync"
 	"time"
 )
 
+// ErrIdemInFlight 同一个消息 ID 的另一次投递还在处理中：返回错误交给重投，不能当成已处理 ack 掉
+var ErrIdemInFlight = errors.New("natsx: message is being processed by another delivery")
+
 // ----- 抽象存储 -----
+// IdemStore 两阶段标记：处理中标记（短 TTL）只挡并发的重复投递，handler 成功后才升级成完成标记
+// 进程在处理中崩溃时处理中标记自然过期，重投还能再处理，保证至少一次
 type IdemStore interface {
-	SeenOnce(key string, ttl time.Duration) (seen bool, err error)
+	// Begin 开始处理：done=true 已处理完成，busy=true 另一次投递正在处理
+	Begin(key string, processingTTL time.Duration) (done, busy bool, err error)
+	// Done 处理成功，写完成标记并去掉处理中标记
+	Done(key string, ttl time.Duration) error
+	// Abort 处理失败，去掉处理中标记
+	Abort(key string)
 }
 
 // ----- 内存实现（单进程） -----
 type memIdem struct {
-	mu  sync.Mutex
-	m   map[string]int64 // key -> expireUnix
-	ttl time.Duration
+	mu         sync.Mutex
+	processing map[string]time.Time // key -> 过期时间
+	done       map[string]time.Time
+	ttl        time.Duration
 }
 
 func NewMemIdem(defaultTTL time.Duration) IdemStore {
-	mi := &memIdem{m: make(map[string]int64), ttl: defaultTTL}
+	mi := &memIdem{processing: make(map[string]time.Time), done: make(map[string]time.Time), ttl: defaultTTL}
 	// 清理协程
 	go func() {
 		t := time.NewTicker(time.Minute)
 		defer t.Stop()
 		for range t.C {
-			now := time.Now().Unix()
+			now := time.Now()
 			mi.mu.Lock()
-			for k, exp := range mi.m {
-				if exp <= now {
-					delete(mi.m, k)
+			for _, m := range []map[string]time.Time{mi.processing, mi.done} {
+				for k, exp := range m {
+					if !exp.After(now) {
+						delete(m, k)
+					}
 				}
 			}
 			mi.mu.Unlock()
@@ -39,18 +53,35 @@ func NewMemIdem(defaultTTL time.Duration) IdemStore {
 	return mi
 }
 
-func (mi *memIdem) SeenOnce(key string, ttl time.Duration) (bool, error) {
+func (mi *memIdem) Begin(key string, processingTTL time.Duration) (bool, bool, error) {
+	now := time.Now()
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	if exp, ok := mi.done[key]; ok && exp.After(now) {
+		return true, false, nil
+	}
+	if exp, ok := mi.processing[key]; ok && exp.After(now) {
+		return false, true, nil
+	}
+	mi.processing[key] = now.Add(processingTTL)
+	return false, false, nil
+}
+
+func (mi *memIdem) Done(key string, ttl time.Duration) error {
 	if ttl <= 0 {
 		ttl = mi.ttl
 	}
-	exp := time.Now().Add(ttl).Unix()
 	mi.mu.Lock()
 	defer mi.mu.Unlock()
-	if old, ok := mi.m[key]; ok && old > time.Now().Unix() {
-		return true, nil // 已见过
-	}
-	mi.m[key] = exp
-	return false, nil
+	mi.done[key] = time.Now().Add(ttl)
+	delete(mi.processing, key)
+	return nil
+}
+
+func (mi *memIdem) Abort(key string) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	delete(mi.processing, key)
 }
 
 // ----- 从消息头提取 msgID -----
@@ -65,8 +96,9 @@ func msgIDFromHeader(h map[string]string) string {
 }
 
 // ----- 幂等中间件 -----
-// 用法：NewNatsxConsumer(client, NatsxIdemMiddleware(store, ttl))
-func NatsxIdemMiddleware(store IdemStore, ttl time.Duration) NatsxMiddleware {
+// 用法：NewNatsxConsumer(client, NatsxIdemMiddleware(store, time.Minute, 24*time.Hour))
+// processingTTL 要覆盖一次处理的最长耗时；doneTTL 是去重窗口
+func NatsxIdemMiddleware(store IdemStore, processingTTL, doneTTL time.Duration) NatsxMiddleware {
 	return func(next NatsxHandler) NatsxHandler {
 		return func(ctx context.Context, msg NatsxMessage) error {
 			id := msgIDFromHeader(msg.Header)
@@ -74,12 +106,25 @@ func NatsxIdemMiddleware(store IdemStore, ttl time.Duration) NatsxMiddleware {
 				// 无ID时根据 subject+内容构造一个弱ID（谨慎使用）
 				id = msg.Subject + "|" + strings.TrimSpace(string(msg.Data))
 			}
-			seen, _ := store.SeenOnce(id, ttl)
-			if seen {
-				// 已处理过，直接跳过（记录日志可选）
+			done, busy, err := store.Begin(id, processingTTL)
+			if err != nil {
+				// 存储不可用时直接处理：宁可重复不丢
+				return next(ctx, msg)
+			}
+			if done {
+				// 已处理完成，直接跳过
 				return nil
 			}
-			return next(ctx, msg)
+			if busy {
+				return ErrIdemInFlight
+			}
+			if err := next(ctx, msg); err != nil {
+				// 失败要交给重投，不能被当成已处理
+				store.Abort(id)
+				return err
+			}
+			_ = store.Done(id, doneTTL)
+			return nil
 		}
 	}
 }
@@ -80,3 +80,19 @@ func (m *NatsManager) PullConsume(
 	}
 	return m.consumer.PullConsume(ctx, biz, batch, wait, h)
 }
+
+// EnsureStream 确保 JetStream stream 存在
+func (m *NatsManager) EnsureStream(name string, subjects []string, maxAge time.Duration) error {
+	if m == nil || m.client == nil {
+		return fmt.Errorf("manager not initialized")
+	}
+	return m.client.EnsureStream(name, subjects, maxAge)
+}
+
+// Unsubscribe 取消订阅
+func (m *NatsManager) Unsubscribe(biz string) error {
+	if m == nil || m.client == nil {
+		return fmt.Errorf("manager not initialized")
+	}
+	return m.client.Unsubscribe(biz)
+}
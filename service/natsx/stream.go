@@ -0,0 +1,56 @@
+package natsx
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// EnsureStream 确保 JetStream stream 存在；已存在时把缺少的 subjects 补上
+func (c *NatsxClient) EnsureStream(name string, subjects []string, maxAge time.Duration) error {
+	if err := c.ensureJS(); err != nil {
+		return err
+	}
+	info, err := c.js.StreamInfo(name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = c.js.AddStream(&nats.StreamConfig{
+			Name:      name,
+			Subjects:  subjects,
+			Retention: nats.LimitsPolicy,
+			Storage:   nats.FileStorage,
+			MaxAge:    maxAge,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg := info.Config
+	changed := false
+	for _, s := range subjects {
+		if !slices.Contains(cfg.Subjects, s) {
+			cfg.Subjects = append(cfg.Subjects, s)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	_, err = c.js.UpdateStream(&cfg)
+	return err
+}
+
+// Unsubscribe 取消某个 Biz 的订阅（Drain：处理完已收到的再退出）
+func (c *NatsxClient) Unsubscribe(biz string) error {
+	c.mu.Lock()
+	sub, ok := c.subs[biz]
+	delete(c.subs, biz)
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return sub.Drain()
+}
@@ -0,0 +1,105 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// APNsProvider 走 APNs HTTP/2 接口：POST {Endpoint}/3/device/{token}
+// AuthToken 返回 provider token（JWT，由调用方签发/缓存）
+type APNsProvider struct {
+	Endpoint  string // https://api.push.apple.com 或 sandbox
+	Topic     string // bundle id
+	AuthToken func() (string, error)
+	Client    *http.Client
+}
+
+func NewAPNsProvider(endpoint, topic string, authToken func() (string, error)) *APNsProvider {
+	return &APNsProvider{
+		Endpoint:  endpoint,
+		Topic:     topic,
+		AuthToken: authToken,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *APNsProvider) Name() string { return "apns" }
+
+type apnsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type apnsAps struct {
+	Alert    apnsAlert `json:"alert"`
+	Badge    *int64    `json:"badge,omitempty"`
+	Sound    string    `json:"sound,omitempty"`
+	Category string    `json:"category,omitempty"`
+}
+
+func (p *APNsProvider) Send(ctx context.Context, n *Notification) error {
+	payload := map[string]any{}
+	aps := apnsAps{
+		Alert:    apnsAlert{Title: n.Title, Body: n.Body},
+		Sound:    n.Sound,
+		Category: n.Category,
+	}
+	if n.Badge >= 0 {
+		badge := n.Badge
+		aps.Badge = &badge
+	}
+	payload["aps"] = aps
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/3/device/%s", p.Endpoint, n.Token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apns-topic", p.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	if n.CollapseID != "" {
+		req.Header.Set("apns-collapse-id", n.CollapseID)
+	}
+	if p.AuthToken != nil {
+		token, err := p.AuthToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("authorization", "bearer "+token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return &TemporaryError{Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reason struct {
+		Reason string `json:"reason"`
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	_ = json.Unmarshal(raw, &reason)
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		reason.Reason == "BadDeviceToken", reason.Reason == "Unregistered", reason.Reason == "DeviceTokenNotForTopic":
+		return ErrTokenInvalid
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return &TemporaryError{Err: fmt.Errorf("apns status %d %s", resp.StatusCode, reason.Reason)}
+	}
+	return fmt.Errorf("apns status %d %s", resp.StatusCode, reason.Reason)
+}
@@ -0,0 +1,176 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APNs provider token 有效期 1 小时，且 20 分钟内不允许重复签发，这里 50 分钟换一次
+const apnsTokenTTL = 50 * time.Minute
+
+// FCM access token 过期前提前刷新的余量
+const fcmRefreshSkew = 5 * time.Minute
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// cachedToken 缓存一个带过期时间的 token，过期后调用 fetch 重新获取
+type cachedToken struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	now     func() time.Time
+	fetch   func(now time.Time) (token string, expires time.Time, err error)
+}
+
+func (c *cachedToken) Token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.token != "" && now.Before(c.expires) {
+		return c.token, nil
+	}
+	token, expires, err := c.fetch(now)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, expires
+	return token, nil
+}
+
+// NewAPNsTokenSource 用 .p8 私钥（ES256）签发 APNs provider token，进程内缓存并定期重签
+func NewAPNsTokenSource(keyPEM []byte, keyID, teamID string) (func() (string, error), error) {
+	if keyID == "" || teamID == "" {
+		return nil, errors.New("push: apns key id and team id required")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("push: parse apns key: %w", err)
+	}
+	return newAPNsTokenSource(key, keyID, teamID, time.Now), nil
+}
+
+func newAPNsTokenSource(key *ecdsa.PrivateKey, keyID, teamID string, now func() time.Time) func() (string, error) {
+	c := &cachedToken{now: now, fetch: func(now time.Time) (string, time.Time, error) {
+		tok := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"iss": teamID,
+			"iat": now.Unix(),
+		})
+		tok.Header["kid"] = keyID
+		signed, err := tok.SignedString(key)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("push: sign apns token: %w", err)
+		}
+		return signed, now.Add(apnsTokenTTL), nil
+	}}
+	return c.Token
+}
+
+// serviceAccount Google 服务账号 JSON 里用到的字段
+type serviceAccount struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// FCMTokenSource 用服务账号换取 FCM OAuth2 access token（JWT bearer grant），进程内缓存，过期前刷新
+type FCMTokenSource struct {
+	ProjectID string // 服务账号所属项目
+
+	cache *cachedToken
+}
+
+// NewFCMTokenSource 解析服务账号 JSON；client 为空时使用 10s 超时的默认 client
+func NewFCMTokenSource(serviceAccountJSON []byte, client *http.Client) (*FCMTokenSource, error) {
+	var sa serviceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &sa); err != nil {
+		return nil, fmt.Errorf("push: parse fcm service account: %w", err)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("push: fcm service account missing client_email or private_key")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("push: parse fcm private key: %w", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	fetch := func(now time.Time) (string, time.Time, error) {
+		assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   sa.ClientEmail,
+			"scope": fcmScope,
+			"aud":   sa.TokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		})
+		if sa.PrivateKeyID != "" {
+			assertion.Header["kid"] = sa.PrivateKeyID
+		}
+		signed, err := assertion.SignedString(key)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("push: sign fcm assertion: %w", err)
+		}
+
+		form := url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {signed},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), client.Timeout+time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sa.TokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", time.Time{}, &TemporaryError{Err: err}
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			err := fmt.Errorf("fcm token status %d: %s", resp.StatusCode, raw)
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+				return "", time.Time{}, &TemporaryError{Err: err}
+			}
+			return "", time.Time{}, err
+		}
+		var out struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int64  `json:"expires_in"`
+		}
+		if err := json.Unmarshal(raw, &out); err != nil || out.AccessToken == "" {
+			return "", time.Time{}, fmt.Errorf("push: bad fcm token response: %s", raw)
+		}
+		ttl := time.Duration(out.ExpiresIn)*time.Second - fcmRefreshSkew
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+		return out.AccessToken, now.Add(ttl), nil
+	}
+
+	return &FCMTokenSource{
+		ProjectID: sa.ProjectID,
+		cache:     &cachedToken{now: time.Now, fetch: fetch},
+	}, nil
+}
+
+// Token 返回当前有效的 access token，作为 FCMProvider.AuthToken
+func (s *FCMTokenSource) Token() (string, error) { return s.cache.Token() }
@@ -0,0 +1,117 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAPNsTokenSourceSignsAndRefreshes(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// .p8 文件就是 PKCS8 PEM
+	if _, err := NewAPNsTokenSource(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), "KEY123", "TEAM456"); err != nil {
+		t.Fatalf("parse p8: %v", err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	source := newAPNsTokenSource(key, "KEY123", "TEAM456", func() time.Time { return now })
+
+	first, err := source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jwt.Parse(first, func(*jwt.Token) (any, error) { return &key.PublicKey, nil },
+		jwt.WithValidMethods([]string{"ES256"}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	claims := parsed.Claims.(jwt.MapClaims)
+	if parsed.Header["kid"] != "KEY123" || claims["iss"] != "TEAM456" || int64(claims["iat"].(float64)) != now.Unix() {
+		t.Fatalf("header %v claims %v", parsed.Header, claims)
+	}
+
+	now = now.Add(apnsTokenTTL - time.Second)
+	if again, _ := source(); again != first {
+		t.Fatal("token re-signed before ttl")
+	}
+	now = now.Add(time.Second)
+	if again, _ := source(); again == first {
+		t.Fatal("token not re-signed after ttl")
+	}
+}
+
+func TestFCMTokenSourceExchangesAndCaches(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tok, err := jwt.Parse(r.PostForm.Get("assertion"), func(*jwt.Token) (any, error) { return &key.PublicKey, nil },
+			jwt.WithValidMethods([]string{"RS256"}))
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims := tok.Claims.(jwt.MapClaims)
+		if claims["iss"] != "push@proj.iam.gserviceaccount.com" || claims["scope"] != fcmScope {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"access_token":"at-%d","expires_in":3600,"token_type":"Bearer"}`, calls)
+	}))
+	defer srv.Close()
+
+	sa, _ := json.Marshal(map[string]string{
+		"project_id":   "proj",
+		"private_key":  string(keyPEM),
+		"client_email": "push@proj.iam.gserviceaccount.com",
+		"token_uri":    srv.URL,
+	})
+	src, err := NewFCMTokenSource(sa, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.ProjectID != "proj" {
+		t.Fatalf("project = %q", src.ProjectID)
+	}
+
+	now := time.Now()
+	src.cache.now = func() time.Time { return now }
+	if tok, err := src.Token(); err != nil || tok != "at-1" {
+		t.Fatalf("token = %q, %v", tok, err)
+	}
+	if tok, _ := src.Token(); tok != "at-1" || calls != 1 {
+		t.Fatalf("cached token = %q after %d calls", tok, calls)
+	}
+	// 过期前 fcmRefreshSkew 内刷新
+	now = now.Add(time.Hour - fcmRefreshSkew)
+	if tok, _ := src.Token(); tok != "at-2" {
+		t.Fatalf("refreshed token = %q", tok)
+	}
+}
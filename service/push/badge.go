@@ -0,0 +1,32 @@
+package push
+
+import (
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"time"
+)
+
+// 角标：每个用户一个计数，推送时 +1，客户端打开/上报未读总数时重置
+const badgeTTL = 30 * 24 * time.Hour
+
+func badgeKey(tenantID, userID string) string { return "im:push:badge:" + tenantID + ":" + userID }
+
+// IncrBadge 角标 +1，返回新值
+func IncrBadge(ctx context.Context, tenantID, userID string) (int64, error) {
+	rdb := redis2.GetRedis()
+	pipe := rdb.TxPipeline()
+	incr := pipe.Incr(ctx, badgeKey(tenantID, userID))
+	pipe.Expire(ctx, badgeKey(tenantID, userID), badgeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// SetBadge 以客户端上报的未读总数为准重置角标，<=0 直接清掉
+func SetBadge(ctx context.Context, tenantID, userID string, n int64) error {
+	if n <= 0 {
+		return redis2.GetRedis().Del(ctx, badgeKey(tenantID, userID)).Err()
+	}
+	return redis2.GetRedis().Set(ctx, badgeKey(tenantID, userID), n, badgeTTL).Err()
+}
@@ -0,0 +1,64 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// FakeProvider 内存实现，用于测试和本地开发：记录发出的推送，可以模拟 token 失效和临时失败
+type FakeProvider struct {
+	mu        sync.Mutex
+	name      string
+	sent      []*Notification
+	invalid   map[string]bool // token -> 失效
+	failTimes map[string]int  // token -> 前 N 次返回临时错误
+}
+
+func NewFakeProvider(name string) *FakeProvider {
+	return &FakeProvider{
+		name:      name,
+		invalid:   make(map[string]bool),
+		failTimes: make(map[string]int),
+	}
+}
+
+func (p *FakeProvider) Name() string { return p.name }
+
+func (p *FakeProvider) Send(_ context.Context, n *Notification) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.invalid[n.Token] {
+		return ErrTokenInvalid
+	}
+	if p.failTimes[n.Token] > 0 {
+		p.failTimes[n.Token]--
+		return &TemporaryError{Err: errors.New("fake temporary failure")}
+	}
+	cp := *n
+	p.sent = append(p.sent, &cp)
+	return nil
+}
+
+// InvalidateToken 之后发往该 token 的推送返回 ErrTokenInvalid
+func (p *FakeProvider) InvalidateToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.invalid[token] = true
+}
+
+// FailNext 该 token 接下来 times 次返回临时错误
+func (p *FakeProvider) FailNext(token string, times int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failTimes[token] = times
+}
+
+// Sent 已成功发出的推送
+func (p *FakeProvider) Sent() []*Notification {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]*Notification, len(p.sent))
+	copy(out, p.sent)
+	return out
+}
@@ -0,0 +1,98 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FCMProvider 走 FCM HTTP v1 接口：POST {Endpoint}/v1/projects/{ProjectID}/messages:send
+// AuthToken 返回 OAuth2 access token（由调用方刷新/缓存）
+type FCMProvider struct {
+	Endpoint  string // https://fcm.googleapis.com
+	ProjectID string
+	AuthToken func() (string, error)
+	Client    *http.Client
+}
+
+func NewFCMProvider(endpoint, projectID string, authToken func() (string, error)) *FCMProvider {
+	return &FCMProvider{
+		Endpoint:  endpoint,
+		ProjectID: projectID,
+		AuthToken: authToken,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *FCMProvider) Name() string { return "fcm" }
+
+func (p *FCMProvider) Send(ctx context.Context, n *Notification) error {
+	data := make(map[string]string, len(n.Data)+1)
+	for k, v := range n.Data {
+		data[k] = v
+	}
+	if n.Badge >= 0 {
+		data["badge"] = strconv.FormatInt(n.Badge, 10)
+	}
+	android := map[string]any{
+		"notification": map[string]any{"sound": n.Sound},
+	}
+	if n.CollapseID != "" {
+		android["collapse_key"] = n.CollapseID
+	}
+	if n.AndroidVivoClassification > 0 {
+		data["vivo_classification"] = strconv.Itoa(int(n.AndroidVivoClassification))
+	}
+	body, err := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token":        n.Token,
+			"notification": map[string]string{"title": n.Title, "body": n.Body},
+			"android":      android,
+			"data":         data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/projects/%s/messages:send", p.Endpoint, p.ProjectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.AuthToken != nil {
+		token, err := p.AuthToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return &TemporaryError{Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	raw, _ := io.ReadAll(resp.Body)
+	msg := string(raw)
+	switch {
+	case resp.StatusCode == http.StatusNotFound, strings.Contains(msg, "UNREGISTERED"):
+		return ErrTokenInvalid
+	case resp.StatusCode == http.StatusBadRequest && strings.Contains(msg, "registration token"):
+		return ErrTokenInvalid
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return &TemporaryError{Err: fmt.Errorf("fcm status %d", resp.StatusCode)}
+	}
+	return fmt.Errorf("fcm status %d: %s", resp.StatusCode, msg)
+}
@@ -0,0 +1,137 @@
+package push
+
+import (
+	"PProject/logger"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Manager 按平台选择推送通道，负责重试和异步执行
+type Manager struct {
+	mu        sync.RWMutex
+	providers map[string]PushProvider // platform -> provider
+
+	maxAttempts int
+	backoff     time.Duration // 首次重试间隔，之后翻倍
+
+	tasks chan func(ctx context.Context)
+	once  sync.Once
+}
+
+type Option func(*Manager)
+
+func WithMaxAttempts(n int) Option {
+	return func(m *Manager) {
+		if n > 0 {
+			m.maxAttempts = n
+		}
+	}
+}
+
+func WithBackoff(d time.Duration) Option {
+	return func(m *Manager) { m.backoff = d }
+}
+
+// WithQueueSize 异步任务队列长度，队列满时新任务直接丢弃（推送允许丢，不能拖慢消息链路）
+func WithQueueSize(n int) Option {
+	return func(m *Manager) { m.tasks = make(chan func(ctx context.Context), n) }
+}
+
+func NewManager(opts ...Option) *Manager {
+	m := &Manager{
+		providers:   make(map[string]PushProvider),
+		maxAttempts: 3,
+		backoff:     200 * time.Millisecond,
+		tasks:       make(chan func(ctx context.Context), 10000),
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Register 给平台挂一个推送通道
+func (m *Manager) Register(platform string, p PushProvider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providers[platform] = p
+}
+
+func (m *Manager) provider(platform string) PushProvider {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.providers[platform]
+}
+
+// Send 同步发送：临时错误按指数退避重试，token 失效立即返回 ErrTokenInvalid
+func (m *Manager) Send(ctx context.Context, n *Notification) error {
+	p := m.provider(n.Platform)
+	if p == nil {
+		return fmt.Errorf("push: no provider for platform %q", n.Platform)
+	}
+
+	delay := m.backoff
+	var err error
+	for attempt := 1; attempt <= m.maxAttempts; attempt++ {
+		err = p.Send(ctx, n)
+		if err == nil || errors.Is(err, ErrTokenInvalid) || !IsTemporary(err) {
+			return err
+		}
+		if attempt == m.maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// Start 启动 workers 个后台协程执行 Go 提交的任务
+func (m *Manager) Start(workers int) {
+	m.once.Do(func() {
+		for i := 0; i < workers; i++ {
+			go func() {
+				for task := range m.tasks {
+					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					m.runTask(ctx, task)
+					cancel()
+				}
+			}()
+		}
+	})
+}
+
+func (m *Manager) runTask(ctx context.Context, task func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("[push] task panic recovered: %v", r)
+		}
+	}()
+	task(ctx)
+}
+
+// Go 异步执行推送任务；队列满时丢弃并返回 false
+func (m *Manager) Go(task func(ctx context.Context)) bool {
+	select {
+	case m.tasks <- task:
+		return true
+	default:
+		logger.Errorf("[push] task queue full, drop")
+		return false
+	}
+}
+
+var defaultManager = NewManager()
+
+// Init 替换默认的 Manager（启动时调用）
+func Init(m *Manager) { defaultManager = m }
+
+// Default 默认的 Manager
+func Default() *Manager { return defaultManager }
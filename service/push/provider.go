@@ -0,0 +1,54 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 设备平台
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+)
+
+// ErrTokenInvalid 设备 token 已失效（卸载/重装/过期），调用方应删除该 token，不重试
+var ErrTokenInvalid = errors.New("push: device token invalid")
+
+// TemporaryError 可重试的错误（限流、服务端 5xx、网络超时等）
+type TemporaryError struct {
+	Err error
+}
+
+func (e *TemporaryError) Error() string { return fmt.Sprintf("push: temporary: %v", e.Err) }
+func (e *TemporaryError) Unwrap() error { return e.Err }
+
+// IsTemporary 是否可重试
+func IsTemporary(err error) bool {
+	var te *TemporaryError
+	return errors.As(err, &te)
+}
+
+// Notification 一条发往单个设备的推送
+type Notification struct {
+	Token    string
+	Platform string
+
+	Title string
+	Body  string
+	Badge int64 // <0 表示不设置角标
+
+	Sound                     string
+	Category                  string // iOS category
+	AndroidVivoClassification int32  // vivo 消息分类：0=运营 1=系统
+
+	CollapseID string            // 同一条消息多次推送时合并
+	Data       map[string]string // 透传给客户端（conversation_id/server_msg_id/ex）
+}
+
+// PushProvider 推送通道（APNs/FCM/厂商通道/测试用的 Fake）
+// Send 返回 ErrTokenInvalid 表示 token 失效，返回 *TemporaryError 表示可重试，其它错误不重试
+type PushProvider interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
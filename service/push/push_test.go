@@ -0,0 +1,78 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManagerRetriesTemporaryErrors(t *testing.T) {
+	fake := NewFakeProvider("fake")
+	fake.FailNext("tk", 2)
+	m := NewManager(WithMaxAttempts(3), WithBackoff(0))
+	m.Register(PlatformIOS, fake)
+
+	if err := m.Send(context.Background(), &Notification{Token: "tk", Platform: PlatformIOS}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got := len(fake.Sent()); got != 1 {
+		t.Fatalf("sent = %d, want 1", got)
+	}
+
+	fake.FailNext("tk", 3)
+	if err := m.Send(context.Background(), &Notification{Token: "tk", Platform: PlatformIOS}); !IsTemporary(err) {
+		t.Fatalf("want temporary error after exhausting attempts, got %v", err)
+	}
+}
+
+func TestManagerInvalidTokenNotRetried(t *testing.T) {
+	fake := NewFakeProvider("fake")
+	fake.InvalidateToken("dead")
+	m := NewManager(WithBackoff(0))
+	m.Register(PlatformAndroid, fake)
+
+	err := m.Send(context.Background(), &Notification{Token: "dead", Platform: PlatformAndroid})
+	if !errors.Is(err, ErrTokenInvalid) {
+		t.Fatalf("want ErrTokenInvalid, got %v", err)
+	}
+	if err := m.Send(context.Background(), &Notification{Token: "x", Platform: PlatformIOS}); err == nil {
+		t.Fatal("want error for platform without provider")
+	}
+}
+
+func TestProviderStatusMapping(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{http.StatusOK, "", func(err error) bool { return err == nil }},
+		{http.StatusGone, `{"reason":"Unregistered"}`, func(err error) bool { return errors.Is(err, ErrTokenInvalid) }},
+		{http.StatusBadRequest, `{"reason":"BadDeviceToken"}`, func(err error) bool { return errors.Is(err, ErrTokenInvalid) }},
+		{http.StatusTooManyRequests, "", IsTemporary},
+		{http.StatusServiceUnavailable, "", IsTemporary},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			_, _ = w.Write([]byte(tc.body))
+		}))
+		p := NewAPNsProvider(srv.URL, "com.example.app", nil)
+		err := p.Send(context.Background(), &Notification{Token: "tk", Badge: -1})
+		if !tc.check(err) {
+			t.Errorf("apns status %d: unexpected err %v", tc.status, err)
+		}
+		srv.Close()
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+	}))
+	defer srv.Close()
+	if err := NewFCMProvider(srv.URL, "proj", nil).Send(context.Background(), &Notification{Token: "tk"}); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("fcm unregistered: want ErrTokenInvalid, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryRegistry 进程内注册中心（单进程开发模式、测试用），实现与 Consul 相同的 Registry 接口
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	services map[string]map[string]Instance // service -> id -> inst
+	version  map[string]uint64
+	changed  chan struct{} // 任意服务变化时关闭并换新，唤醒所有 Watcher
+	closed   bool
+}
+
+func NewMemory() *MemoryRegistry {
+	return &MemoryRegistry{
+		services: make(map[string]map[string]Instance),
+		version:  make(map[string]uint64),
+		changed:  make(chan struct{}),
+	}
+}
+
+// notifyLocked 调用方持有 r.mu
+func (r *MemoryRegistry) notifyLocked(service string) {
+	r.version[service]++
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *MemoryRegistry) Register(_ context.Context, inst Instance, _ RegisterOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.services[inst.Service] == nil {
+		r.services[inst.Service] = make(map[string]Instance)
+	}
+	meta := make(map[string]string, len(inst.Metadata))
+	for k, v := range inst.Metadata {
+		meta[k] = v
+	}
+	inst.Metadata = meta
+	r.services[inst.Service][inst.ID] = inst
+	r.notifyLocked(inst.Service)
+	return nil
+}
+
+// Deregister service 为空时按 ID 在所有服务里查找（和 Consul 一样只靠 ID 也能摘除）
+func (r *MemoryRegistry) Deregister(_ context.Context, service, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, insts := range r.services {
+		if service != "" && name != service {
+			continue
+		}
+		if _, ok := insts[id]; ok {
+			delete(insts, id)
+			r.notifyLocked(name)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRegistry) listLocked(service string) []Instance {
+	out := make([]Instance, 0, len(r.services[service]))
+	for _, inst := range r.services[service] {
+		out = append(out, inst)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (r *MemoryRegistry) List(_ context.Context, service string) ([]Instance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.listLocked(service), nil
+}
+
+func (r *MemoryRegistry) Watch(ctx context.Context, service string) (Watcher, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &memoryWatcher{r: r, ctx: ctx, service: service, seen: r.version[service], stop: make(chan struct{})}, nil
+}
+
+func (r *MemoryRegistry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.closed = true
+		close(r.changed)
+	}
+	return nil
+}
+
+// UpdateTTL 内存实例没有健康检查，上报直接忽略
+func (r *MemoryRegistry) UpdateTTL(string, string, string) error { return nil }
+
+type memoryWatcher struct {
+	r       *MemoryRegistry
+	ctx     context.Context
+	service string
+	seen    uint64
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// Next 阻塞到该服务有变化，返回最新的全量列表
+func (w *memoryWatcher) Next() ([]Instance, error) {
+	for {
+		w.r.mu.Lock()
+		if w.r.closed {
+			w.r.mu.Unlock()
+			return nil, ErrStopped
+		}
+		if v := w.r.version[w.service]; v != w.seen {
+			w.seen = v
+			list := w.r.listLocked(w.service)
+			w.r.mu.Unlock()
+			return list, nil
+		}
+		ch := w.r.changed
+		w.r.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-w.stop:
+			return nil, ErrStopped
+		case <-w.ctx.Done():
+			return nil, ErrStopped
+		}
+	}
+}
+
+func (w *memoryWatcher) Stop() error {
+	w.once.Do(func() { close(w.stop) })
+	return nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ===== 广播频道路由：频道 -> 有订阅者在线的网关 =====
+// 频道消息只按网关广播一帧，不按成员写记录；网关定时续期，过期未续的视为已下线
+
+// ChannelGatewayTTL 网关注册的有效期，网关应在 TTL 内续期
+const ChannelGatewayTTL = 90 * time.Second
+
+func channelGatewaysKey(channelID string) string { return "channel:gw:{" + channelID + "}" }
+
+// RegisterChannelGateway 网关上有该频道的订阅者：登记/续期
+func RegisterChannelGateway(ctx context.Context, gatewayID string, channelIDs ...string) error {
+	if len(channelIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	pipe := redis2.GetRedis().Pipeline()
+	for _, ch := range channelIDs {
+		key := channelGatewaysKey(ch)
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: gatewayID})
+		pipe.Expire(ctx, key, 2*ChannelGatewayTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// UnregisterChannelGateway 网关上该频道已没有订阅者
+func UnregisterChannelGateway(ctx context.Context, gatewayID string, channelIDs ...string) error {
+	if len(channelIDs) == 0 {
+		return nil
+	}
+	pipe := redis2.GetRedis().Pipeline()
+	for _, ch := range channelIDs {
+		pipe.ZRem(ctx, channelGatewaysKey(ch), gatewayID)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ListChannelGateways 频道当前需要广播的网关（TTL 内续期过的），顺带清掉过期的
+func ListChannelGateways(ctx context.Context, channelID string) ([]string, error) {
+	key := channelGatewaysKey(channelID)
+	cutoff := time.Now().Add(-ChannelGatewayTTL).UnixMilli()
+	_ = redis2.GetRedis().ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(cutoff, 10)).Err()
+	return redis2.GetRedis().ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatInt(cutoff, 10),
+		Max: "+inf",
+	}).Result()
+}
+
+// NotifyChannelsChanged 用户订阅的频道变了（加入/退出/被踢）：通知所在网关重新加载
+func NotifyChannelsChanged(ctx context.Context, users ...string) {
+	for _, u := range users {
+		_ = redis2.GetRedis().Publish(ctx, OnlineChannelName, OnlineEventChannels+":"+u).Err()
+	}
+}
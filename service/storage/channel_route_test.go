@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChannelGatewaysOnMemoryRedis(t *testing.T) {
+	useMemoryRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := RegisterChannelGateway(ctx, "gw1", "c1", "c2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterChannelGateway(ctx, "gw2", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	gws, err := ListChannelGateways(ctx, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(gws)
+	if !slices.Equal(gws, []string{"gw1", "gw2"}) {
+		t.Fatalf("c1 gateways = %v", gws)
+	}
+
+	if err := UnregisterChannelGateway(ctx, "gw1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if gws, _ := ListChannelGateways(ctx, "c1"); !slices.Equal(gws, []string{"gw2"}) {
+		t.Fatalf("c1 gateways after unregister = %v", gws)
+	}
+	if gws, _ := ListChannelGateways(ctx, "c2"); !slices.Equal(gws, []string{"gw1"}) {
+		t.Fatalf("c2 gateways = %v", gws)
+	}
+}
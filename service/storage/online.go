@@ -532,6 +532,8 @@ func (m *OnlineStore) Authorize(ctx context.Context, userID, snowID string) (boo
 	}
 	switch rc {
 	case 1:
+		// 事件：ONLINE:<authKey>
+		_ = redis2.GetRedis().Publish(ctx, m.conf.ChannelName, OnlineEventOnline+":"+kAuth).Err()
 		return true, nil
 	case 0:
 		return false, nil
@@ -562,6 +564,9 @@ func (m *OnlineStore) Offline(ctx context.Context, userID, snowID string, publis
 		return false, err
 	}
 	ok := rc == 1
+	if ok {
+		m.afterOffline(ctx, userID)
+	}
 	if publish && ok {
 		// 事件：OFFLINE:<authKey>:<reason>
 		msg := fmt.Sprintf("OFFLINE:%s:%s", kAuth, reason)
@@ -577,6 +582,9 @@ func (m *OnlineStore) ForceLogoutUser(ctx context.Context, userID string, publis
 	if err != nil {
 		return nil, err
 	}
+	if len(keys) > 0 {
+		m.afterOffline(ctx, userID)
+	}
 	if publish && len(keys) > 0 {
 		// 事件：FORCE_LOGOUT:<userID>:<reason>:<k1,k2,...>
 		payload := fmt.Sprintf("FORCE_LOGOUT:%s:%s:%s", userID, reason, strings.Join(keys, ","))
@@ -594,6 +602,9 @@ func (m *OnlineStore) SweepAuthedUser(ctx context.Context, userID string, publis
 	if err != nil {
 		return nil, err
 	}
+	if len(victims) > 0 {
+		m.afterOffline(ctx, userID)
+	}
 	if publish && len(victims) > 0 {
 		// 事件：EXPIRE_CLEAN:<userID>:<k1,k2,...>
 		payload := fmt.Sprintf("EXPIRE_CLEAN:%s:%s", userID, strings.Join(victims, ","))
@@ -669,6 +680,77 @@ func (m *OnlineStore) GetUserGateway(ctx context.Context, userID string) (string
 	return gateway, nil
 }
 
+// groupByGatewayScanThreshold 用户数超过该值时改为一次全量 SCAN，避免逐个用户 SCAN
+const groupByGatewayScanThreshold = 32
+
+// GroupUsersByGateway 把一批用户按所在网关分组；offline 为当前不在线的用户
+// 一个用户多端登录在不同网关时，会同时出现在多个网关下
+func (m *OnlineStore) GroupUsersByGateway(ctx context.Context, userIDs []string) (byGateway map[string][]string, offline []string, err error) {
+	byGateway = make(map[string][]string)
+	if len(userIDs) == 0 {
+		return byGateway, nil, nil
+	}
+
+	userGateways := make(map[string]map[string]struct{}, len(userIDs))
+	addKey := func(key string) {
+		gateway, user := ExtractGateway(key), extractUser(key)
+		if gateway == "" || user == "" {
+			return
+		}
+		if userGateways[user] == nil {
+			userGateways[user] = make(map[string]struct{})
+		}
+		userGateways[user][gateway] = struct{}{}
+	}
+
+	if len(userIDs) <= groupByGatewayScanThreshold {
+		for _, uid := range userIDs {
+			keys, err := m.BatchListOnlineConnList(ctx, uid)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, k := range keys {
+				addKey(k)
+			}
+		}
+	} else {
+		iter := redis2.GetRedis().Scan(ctx, 0, "nidx:{*}", 1000).Iterator()
+		for iter.Next(ctx) {
+			addKey(iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, uid := range userIDs {
+		gws, ok := userGateways[uid]
+		if !ok {
+			offline = append(offline, uid)
+			continue
+		}
+		for gw := range gws {
+			byGateway[gw] = append(byGateway[gw], uid)
+		}
+	}
+	return byGateway, offline, nil
+}
+
+// extractUser 从 key 里提取 userId
+// 例如: "nidx:{gateway_01:user_10001}" -> "user_10001"
+func extractUser(key string) string {
+	start := strings.IndexByte(key, '{')
+	end := strings.IndexByte(key, '}')
+	if start == -1 || end == -1 || end <= start+1 {
+		return ""
+	}
+	parts := strings.SplitN(key[start+1:end], ":", 2)
+	if len(parts) == 2 {
+		return parts[1]
+	}
+	return ""
+}
+
 // ExtractGateway 从 key 里提取 gatewayId
 // 例如: "nidx:{gateway_01:user_10001}" -> "gateway_01"
 func ExtractGateway(key string) string {
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	redis2 "PProject/service/storage/redis"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 内存 Redis 下在线状态、离线队列脚本的等价实现（单进程开发模式），逐段对照 online.go / redis_messages.go 里的 Lua
+func init() {
+	redis2.RegisterScript(redis.NewScript(luaBindUser), memBindUser)
+	redis2.RegisterScript(redis.NewScript(luaSweepUnauth), memSweepUnauth)
+	redis2.RegisterScript(redis.NewScript(luaOfflineUnauthOne), memOfflineOne)
+	redis2.RegisterScript(redis.NewScript(luaOfflineOne), memOfflineOne)
+	redis2.RegisterScript(redis.NewScript(luaLogoutAll), memLogoutAll)
+	redis2.RegisterScript(redis.NewScript(luaSweepAuthed), memSweepUnauth)
+	redis2.RegisterScript(redis.NewScript(luaGetActiveAndSweep), memGetActiveAndSweep)
+	redis2.RegisterScript(redis.NewScript(luaIsOnline), memIsOnline)
+	redis2.RegisterScript(redis.NewScript(luaGetNewestActive), memGetNewestActive)
+	redis2.RegisterScript(redis.NewScript(luaHeartbeatAuth), memHeartbeatAuth)
+	redis2.RegisterScript(luaEnqueueOffline, memEnqueueOffline)
+}
+
+func memBindUser(c *redis2.ScriptCall) any {
+	unauthZ, userZ := c.Keys[0], c.Keys[1]
+	kUnauth, kAuth := c.Args[0], c.Args[1]
+	ttl, expAt, useEXAT := c.ArgInt(2), c.ArgInt(4), c.ArgInt(5)
+
+	if c.CallInt("EXISTS", kAuth) == 1 {
+		return -1
+	}
+	if c.CallInt("EXISTS", kUnauth) == 0 {
+		c.Call("ZREM", unauthZ, kUnauth)
+		return 0
+	}
+
+	c.Call("ZREM", unauthZ, kUnauth)
+	c.Call("DEL", kUnauth)
+
+	if useEXAT == 1 {
+		c.Call("SET", kAuth, "1")
+		c.Call("PEXPIREAT", kAuth, expAt*1000)
+	} else {
+		c.Call("SET", kAuth, "1", "EX", ttl)
+	}
+	c.Call("ZADD", userZ, expAt, kAuth)
+	c.Call("EXPIRE", userZ, ttl*2)
+	return 1
+}
+
+// sweepExpired 删掉索引里 score<=now 的成员及其会话键
+func sweepExpired(c *redis2.ScriptCall, z string, now int64) []string {
+	victims := c.CallStrings("ZRANGEBYSCORE", z, "-inf", now)
+	for _, v := range victims {
+		c.Call("ZREM", z, v)
+		c.Call("DEL", v)
+	}
+	return victims
+}
+
+// keepIndex 索引非空时给一个兜底 TTL
+func keepIndex(c *redis2.ScriptCall, z string) {
+	if c.CallInt("ZCARD", z) > 0 {
+		c.Call("EXPIRE", z, 3600)
+	}
+}
+
+// memSweepUnauth luaSweepUnauth 与 luaSweepAuthed 逻辑相同
+func memSweepUnauth(c *redis2.ScriptCall) any {
+	victims := sweepExpired(c, c.Keys[0], c.ArgInt(0))
+	keepIndex(c, c.Keys[0])
+	return victims
+}
+
+// memOfflineOne luaOfflineUnauthOne 与 luaOfflineOne 逻辑相同
+func memOfflineOne(c *redis2.ScriptCall) any {
+	existed := c.Call("DEL", c.Args[0])
+	c.Call("ZREM", c.Keys[0], c.Args[0])
+	return existed
+}
+
+func memLogoutAll(c *redis2.ScriptCall) any {
+	members := c.CallStrings("ZRANGE", c.Keys[0], 0, -1)
+	for _, k := range members {
+		c.Call("DEL", k)
+	}
+	c.Call("DEL", c.Keys[0])
+	return members
+}
+
+func memGetActiveAndSweep(c *redis2.ScriptCall) any {
+	userZ, now := c.Keys[0], c.ArgInt(0)
+	sweepExpired(c, userZ, now)
+	actives := c.CallStrings("ZRANGEBYSCORE", userZ, now+1, "+inf")
+	keepIndex(c, userZ)
+	return actives
+}
+
+func memIsOnline(c *redis2.ScriptCall) any {
+	userZ, now := c.Keys[0], c.ArgInt(0)
+	sweepExpired(c, userZ, now)
+	cnt := c.CallInt("ZCOUNT", userZ, now+1, "+inf")
+	keepIndex(c, userZ)
+	if cnt > 0 {
+		return []any{1, cnt}
+	}
+	return []any{0, 0}
+}
+
+func memGetNewestActive(c *redis2.ScriptCall) any {
+	userZ, now := c.Keys[0], c.ArgInt(0)
+	sweepExpired(c, userZ, now)
+	items := c.CallStrings("ZREVRANGEBYSCORE", userZ, "+inf", now+1, "LIMIT", 0, 1)
+	keepIndex(c, userZ)
+	if len(items) > 0 {
+		return items[0]
+	}
+	return ""
+}
+
+func memHeartbeatAuth(c *redis2.ScriptCall) any {
+	zUser, kConn := c.Keys[0], c.Keys[1]
+	ttlSec, nowUnix, expAt := c.ArgInt(0), c.ArgInt(1), c.ArgInt(2)
+	useEXAT := c.ArgInt(3) == 1
+	memberStr := c.Args[4]
+	zUserTTL := c.ArgInt(5)
+	refreshIdx := len(c.Args) < 7 || c.ArgInt(6) == 1
+	cleanExp := len(c.Args) < 8 || c.ArgInt(7) == 1
+
+	if c.CallInt("EXISTS", kConn) == 0 {
+		return 0
+	}
+	if useEXAT {
+		c.Call("EXPIREAT", kConn, expAt)
+	} else {
+		c.Call("EXPIRE", kConn, ttlSec)
+	}
+	if cleanExp {
+		c.Call("ZREMRANGEBYSCORE", zUser, "-inf", nowUnix)
+	}
+	c.Call("ZADD", zUser, expAt, memberStr)
+	if zUserTTL > 0 {
+		if refreshIdx || c.CallInt("TTL", zUser) == -1 {
+			c.Call("EXPIRE", zUser, zUserTTL)
+		}
+	}
+	return 1
+}
+
+func memEnqueueOffline(c *redis2.ScriptCall) any {
+	if c.CallInt("HEXISTS", c.Keys[1], c.Args[0]) == 1 {
+		return 0
+	}
+	s := c.CallInt("INCR", c.Keys[3])
+	c.Call("ZADD", c.Keys[0], s, c.Args[0])
+	c.Call("HSET", c.Keys[1], c.Args[0], c.Args[1])
+	ret := 1
+	over := c.CallInt("ZCARD", c.Keys[0]) - c.ArgInt(2)
+	if over > 0 {
+		old := c.CallStrings("ZRANGE", c.Keys[0], 0, over-1)
+		c.Call("ZREMRANGEBYRANK", c.Keys[0], 0, over-1)
+		args := []any{"HDEL", c.Keys[1]}
+		for _, id := range old {
+			args = append(args, id)
+		}
+		c.Call(args...)
+		c.Call("SET", c.Keys[2], "1")
+		ret = 2
+	}
+	for i := 0; i < 4; i++ {
+		c.Call("EXPIRE", c.Keys[i], c.ArgInt(3))
+	}
+	return ret
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	redis2 "PProject/service/storage/redis"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	memRedisOnce sync.Once
+	memRedisErr  error
+)
+
+// useMemoryRedis 全局 redis 客户端只能初始化一次，包内测试共用一个内存 Redis
+func useMemoryRedis(t *testing.T) {
+	t.Helper()
+	memRedisOnce.Do(func() { _, memRedisErr = redis2.InitMemoryRedis() })
+	if memRedisErr != nil {
+		t.Fatal(memRedisErr)
+	}
+}
+
+func TestOnlineStoreOnMemoryRedis(t *testing.T) {
+	useMemoryRedis(t)
+
+	ctx := context.Background()
+	m := newOnlineStore(OnlineConfig{
+		NodeID:        "gw_t",
+		TTL:           time.Minute,
+		UseClusterTag: true,
+		UseEXAT:       true,
+		UnauthTTL:     30 * time.Second,
+		UserIndexTTL:  2 * time.Minute,
+	})
+
+	_, snow, err := m.Connect(ctx)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if ok, cerr := m.Authorize(ctx, "u1", snow); cerr != nil || !ok {
+		t.Fatalf("authorize = %v, %v", ok, cerr)
+	}
+	if online, n, err := m.IsOnline(ctx, "u1"); err != nil || !online || n != 1 {
+		t.Fatalf("isOnline = %v %d %v", online, n, err)
+	}
+	if ok, herr := m.HeartbeatAuthorized("gw_t", "u1", snow); herr != nil || !ok {
+		t.Fatalf("heartbeat = %v, %v", ok, herr)
+	}
+
+	byGw, offline, err := m.GroupUsersByGateway(ctx, []string{"u1", "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byGw["gw_t"]) != 1 || len(offline) != 1 || offline[0] != "u2" {
+		t.Fatalf("group = %v offline = %v", byGw, offline)
+	}
+
+	if ok, err := m.Offline(ctx, "u1", snow, false, "test"); err != nil || !ok {
+		t.Fatalf("offline = %v, %v", ok, err)
+	}
+	if online, _, _ := m.IsOnline(ctx, "u1"); online {
+		t.Fatal("u1 should be offline")
+	}
+
+	for _, id := range []string{"m1", "m2", "m1"} {
+		if _, err := EnqueueOffline(ctx, "u2", id, "u1", []byte(id)); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	msgs, err := FetchOffline(ctx, "u2", 0, 10)
+	if err != nil || len(msgs) != 2 || msgs[0].ID != "m1" || msgs[1].ID != "m2" {
+		t.Fatalf("fetch = %+v, %v", msgs, err)
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	pb "PProject/gen/message"
+	redis2 "PProject/service/storage/redis"
+	"PProject/tools/errs"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ===== 用户状态（online/away/dnd/invisible + 自定义文案），和 OnlineStore 的连接在线分开存 =====
+// 连接在线由网关维护；这里是用户主动设置的状态，带 TTL，过期后退回按连接判断 online/offline
+
+const (
+	StatusOnline    = "online"
+	StatusAway      = "away"
+	StatusDND       = "dnd"
+	StatusInvisible = "invisible" // 自己可见；对外一律显示 offline
+	StatusOffline   = "offline"
+
+	// StatusTyping 只出现在变更通知里（Activity 为会话 ID），不落存储
+	StatusTyping = "typing"
+)
+
+const (
+	PresenceTTL         = 10 * time.Minute // 状态有效期，客户端需在过期前重新上报
+	PresenceChannelName = "presence_changes"
+	presenceTextMaxLen  = 128
+)
+
+func userStatusKey(user string) string { return "presence:status:{" + user + "}" }
+func typingKey(user, channel string) string {
+	return "presence:typing:{" + user + "}:" + channel
+}
+
+// Presence 一个用户当前的状态
+type Presence struct {
+	UserID    string
+	Status    string
+	Text      string
+	UpdatedAt int64 // ms
+}
+
+// Public 对其他人展示的状态：隐身显示为离线
+func (p *Presence) Public() *pb.PresenceUpdate {
+	up := &pb.PresenceUpdate{UserId: p.UserID, Status: p.Status, Activity: p.Text}
+	if p.Status == StatusInvisible {
+		up.Status, up.Activity = StatusOffline, ""
+	}
+	return up
+}
+
+// ValidPresenceStatus 客户端可以设置的状态
+func ValidPresenceStatus(status string) bool {
+	switch status {
+	case StatusOnline, StatusAway, StatusDND, StatusInvisible:
+		return true
+	}
+	return false
+}
+
+// SetPresence 写入用户状态并广播（广播的是对外状态）
+func SetPresence(ctx context.Context, user, status, text string) (*Presence, error) {
+	if user == "" {
+		return nil, errs.ErrArgs.WrapMsg("user_id is empty")
+	}
+	if !ValidPresenceStatus(status) {
+		return nil, errs.ErrArgs.WrapMsg("invalid presence status", "status", status)
+	}
+	if len([]rune(text)) > presenceTextMaxLen {
+		text = string([]rune(text)[:presenceTextMaxLen])
+	}
+
+	p := &Presence{UserID: user, Status: status, Text: text, UpdatedAt: time.Now().UnixMilli()}
+	key := userStatusKey(user)
+	pipe := redis2.GetRedis().TxPipeline()
+	pipe.HSet(ctx, key, "status", p.Status, "text", p.Text, "updated_at", p.UpdatedAt)
+	pipe.Expire(ctx, key, PresenceTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	PublishPresence(ctx, p.Public())
+	return p, nil
+}
+
+// GetPresence 用户状态；不在线时一律 offline（顺手清掉残留的主动状态），在线且没有主动设置时给 online
+func GetPresence(ctx context.Context, user string) (*Presence, error) {
+	if manager != nil {
+		online, err := manager.IsUserOnline(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if !online {
+			_ = ClearPresence(ctx, user)
+			return &Presence{UserID: user, Status: StatusOffline}, nil
+		}
+	}
+
+	vals, err := redis2.GetRedis().HGetAll(ctx, userStatusKey(user)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if st := vals["status"]; st != "" {
+		at, _ := strconv.ParseInt(vals["updated_at"], 10, 64)
+		return &Presence{UserID: user, Status: st, Text: vals["text"], UpdatedAt: at}, nil
+	}
+	if manager == nil {
+		return &Presence{UserID: user, Status: StatusOffline}, nil
+	}
+	return &Presence{UserID: user, Status: StatusOnline}, nil
+}
+
+// ClearPresence 删除主动设置的状态（用户所有连接都下线时调用）
+func ClearPresence(ctx context.Context, user string) error {
+	return redis2.GetRedis().Del(ctx, userStatusKey(user)).Err()
+}
+
+// AllowTyping 输入状态节流：同一用户在同一会话 interval 内只放行一次（跨网关生效）
+func AllowTyping(ctx context.Context, user, channel string, interval time.Duration) (bool, error) {
+	return redis2.GetRedis().SetNX(ctx, typingKey(user, channel), 1, interval).Result()
+}
+
+// PublishPresence 广播状态变更，失败只影响实时通知，不返回错误
+func PublishPresence(ctx context.Context, up *pb.PresenceUpdate) {
+	data, err := protojson.Marshal(up)
+	if err != nil {
+		return
+	}
+	_ = redis2.GetRedis().Publish(ctx, PresenceChannelName, data).Err()
+}
+
+// SubscribePresence 订阅状态变更，阻塞到 ctx 结束；fn 返回错误时停止订阅
+func SubscribePresence(ctx context.Context, fn func(*pb.PresenceUpdate) error) error {
+	sub := redis2.GetRedis().Subscribe(ctx, PresenceChannelName)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok := <-ch:
+			if !ok {
+				return errors.New("presence subscription closed")
+			}
+			up := &pb.PresenceUpdate{}
+			if err := protojson.Unmarshal([]byte(m.Payload), up); err != nil {
+				continue
+			}
+			if err := fn(up); err != nil {
+				return err
+			}
+		}
+	}
+}
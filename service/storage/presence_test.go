@@ -0,0 +1,188 @@
+package storage
+
+import (
+	pb "PProject/gen/message"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPresenceOnMemoryRedis(t *testing.T) {
+	useMemoryRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan *pb.PresenceUpdate, 4)
+	subscribed := make(chan struct{})
+	go func() {
+		close(subscribed)
+		_ = SubscribePresence(ctx, func(up *pb.PresenceUpdate) error {
+			got <- up
+			return nil
+		})
+	}()
+	<-subscribed
+
+	if _, err := SetPresence(ctx, "p1", "busy", ""); err == nil {
+		t.Fatal("unknown status should be rejected")
+	}
+
+	// 订阅在后台建立，重试直到收到第一条
+	var up *pb.PresenceUpdate
+	for up == nil {
+		if _, err := SetPresence(ctx, "p1", StatusDND, "in a meeting"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case up = <-got:
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no presence change received")
+		}
+	}
+	if up.GetUserId() != "p1" || up.GetStatus() != StatusDND || up.GetActivity() != "in a meeting" {
+		t.Fatalf("change = %v", up)
+	}
+
+	p, err := GetPresence(ctx, "p1")
+	if err != nil || p.Status != StatusDND || p.Text != "in a meeting" {
+		t.Fatalf("get = %+v, %v", p, err)
+	}
+
+	// 隐身：自己读到 invisible，对外是 offline
+	if _, err := SetPresence(ctx, "p1", StatusInvisible, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = GetPresence(ctx, "p1")
+	if p.Status != StatusInvisible || p.Public().GetStatus() != StatusOffline || p.Public().GetActivity() != "" {
+		t.Fatalf("invisible = %+v public = %v", p, p.Public())
+	}
+
+	// 没设置过状态、也没有连接：offline
+	if p, _ := GetPresence(ctx, "nobody"); p.Status != StatusOffline {
+		t.Fatalf("default = %+v", p)
+	}
+
+	ok, err := AllowTyping(ctx, "p1", "p2p:p1_p2", time.Second)
+	if err != nil || !ok {
+		t.Fatalf("first typing = %v, %v", ok, err)
+	}
+	if ok, _ := AllowTyping(ctx, "p1", "p2p:p1_p2", time.Second); ok {
+		t.Fatal("typing inside throttle window should be dropped")
+	}
+	if ok, _ := AllowTyping(ctx, "p1", "grp:g1", time.Second); !ok {
+		t.Fatal("throttle is per channel")
+	}
+}
+
+func TestParseOnlineChange(t *testing.T) {
+	cases := []struct {
+		payload string
+		kind    string
+		user    string
+	}{
+		{"ONLINE:n:{gw1:u1}:id:123", OnlineEventOnline, "u1"},
+		{"OFFLINE:n:{gw1:u1}:id:123:offline", OnlineEventOffline, "u1"},
+		{"OFFLINE:n:gw1:id:123:u:u2:offline", OnlineEventOffline, "u2"},
+		{"FORCE_LOGOUT:u3:kick:n:{gw1:u3}:id:1", OnlineEventForceLogout, "u3"},
+		{"EXPIRE_CLEAN:u4:n:{gw1:u4}:id:1", OnlineEventExpireClean, "u4"},
+		{"PRESENCE_SUBS:u5", OnlineEventSubs, "u5"},
+		{"PRIVACY:u6", OnlineEventPrivacy, "u6"},
+		{"CHANNELS:u7", OnlineEventChannels, "u7"},
+		{"UNAUTH_OFFLINE:n:{gw1}:id:1:offline", "", ""},
+		{"garbage", "", ""},
+	}
+	for _, c := range cases {
+		got, ok := ParseOnlineChange(c.payload)
+		if ok != (c.kind != "") || got.Kind != c.kind || got.UserID != c.user {
+			t.Errorf("%q => %+v, %v", c.payload, got, ok)
+		}
+	}
+}
+
+func TestPresenceWatchOnMemoryRedis(t *testing.T) {
+	useMemoryRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := newOnlineStore(OnlineConfig{NodeID: "gw_w", TTL: time.Minute, ChannelName: OnlineChannelName, UseClusterTag: true, UseEXAT: true, UnauthTTL: 30 * time.Second})
+
+	got := make(chan OnlineChange, 16)
+	go func() { _ = m.SubscribeChanges(ctx, func(c OnlineChange) { got <- c }) }()
+
+	// 订阅在后台建立，先用显式订阅事件探测
+	for ready := false; !ready; {
+		if err := AddPresenceSubscriptions(ctx, "w1", []string{"w2"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case c := <-got:
+			ready = c.Kind == OnlineEventSubs && c.UserID == "w1"
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no change received")
+		}
+	}
+	if subs, _ := ListPresenceSubscriptions(ctx, "w1"); len(subs) != 1 || subs[0] != "w2" {
+		t.Fatalf("subs = %v", subs)
+	}
+	if err := AddPresenceSubscriptions(ctx, "w1", []string{"w1"}); err == nil {
+		t.Fatal("subscribing to self should be rejected")
+	}
+
+	wait := func(kind string) {
+		t.Helper()
+		for {
+			select {
+			case c := <-got:
+				if c.Kind == kind {
+					if c.UserID != "w2" {
+						t.Fatalf("%s user = %s", kind, c.UserID)
+					}
+					return
+				}
+			case <-ctx.Done():
+				t.Fatalf("no %s event", kind)
+			}
+		}
+	}
+
+	_, snow, err := m.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, cerr := m.Authorize(ctx, "w2", snow); cerr != nil || !ok {
+		t.Fatalf("authorize = %v, %v", ok, cerr)
+	}
+	wait(OnlineEventOnline)
+	if online, err := m.IsUserOnline(ctx, "w2"); err != nil || !online {
+		t.Fatalf("online = %v, %v", online, err)
+	}
+
+	if ok, err := m.Offline(ctx, "w2", snow, true, "bye"); err != nil || !ok {
+		t.Fatalf("offline = %v, %v", ok, err)
+	}
+	wait(OnlineEventOffline)
+	if at, err := GetLastSeen(ctx, "w2"); err != nil || at == 0 {
+		t.Fatalf("last seen = %v, %v", at, err)
+	}
+
+	if level, _ := GetLastSeenPrivacy(ctx, "w2"); level != LastSeenEveryone {
+		t.Fatalf("default privacy = %s", level)
+	}
+	if err := SetLastSeenPrivacy(ctx, "w2", "friends"); err == nil {
+		t.Fatal("invalid privacy should be rejected")
+	}
+	if err := SetLastSeenPrivacy(ctx, "w2", LastSeenContacts); err != nil {
+		t.Fatal(err)
+	}
+	wait(OnlineEventPrivacy)
+	if level, _ := GetLastSeenPrivacy(ctx, "w2"); !LastSeenVisible(level, true) || LastSeenVisible(level, false) {
+		t.Fatalf("contacts privacy = %s", level)
+	}
+
+	if _, err := SetPresence(ctx, "w2", StatusAway, ""); err != nil {
+		t.Fatal(err)
+	}
+	wait(OnlineEventPresence)
+}
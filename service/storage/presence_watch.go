@@ -0,0 +1,256 @@
+package storage
+
+import (
+	pb "PProject/gen/message"
+	redis2 "PProject/service/storage/redis"
+	"PProject/tools/errs"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ===== 在线状态订阅：最后在线时间 / 隐私设置 / 显式订阅 / 变更事件 =====
+
+// 最后在线（含在线状态）对谁可见
+const (
+	LastSeenEveryone = "everyone"
+	LastSeenContacts = "contacts" // 仅好友
+	LastSeenNobody   = "nobody"
+)
+
+// OnlineChannelName 网关连接上下线事件的 Pub/Sub 频道（OnlineConfig.ChannelName）
+// API 节点没有 OnlineStore，发布订阅变更时直接用这个名字
+const OnlineChannelName = "online_changes"
+
+// 变更事件类型；OFFLINE / FORCE_LOGOUT / EXPIRE_CLEAN 沿用 OnlineStore 已有的事件
+const (
+	OnlineEventOnline      = "ONLINE"        // ONLINE:<authKey>
+	OnlineEventOffline     = "OFFLINE"       // OFFLINE:<authKey>:<reason>
+	OnlineEventForceLogout = "FORCE_LOGOUT"  // FORCE_LOGOUT:<userID>:<reason>:<keys>
+	OnlineEventExpireClean = "EXPIRE_CLEAN"  // EXPIRE_CLEAN:<userID>:<keys>
+	OnlineEventSubs        = "PRESENCE_SUBS" // PRESENCE_SUBS:<userID> 显式订阅变了
+	OnlineEventPrivacy     = "PRIVACY"       // PRIVACY:<userID> 最后在线可见范围变了
+	OnlineEventPresence    = "PRESENCE"      // PresenceChannelName 上的主动状态变更
+	OnlineEventChannels    = "CHANNELS"      // CHANNELS:<userID> 订阅的广播频道变了
+)
+
+const presenceSubsMax = 1000 // 单用户显式订阅上限
+
+func lastSeenKey(user string) string     { return "presence:lastseen:{" + user + "}" }
+func privacyKey(user string) string      { return "presence:privacy:{" + user + "}" }
+func presenceSubsKey(user string) string { return "presence:subs:{" + user + "}" }
+
+// ValidLastSeenPrivacy 可设置的隐私级别
+func ValidLastSeenPrivacy(level string) bool {
+	switch level {
+	case LastSeenEveryone, LastSeenContacts, LastSeenNobody:
+		return true
+	}
+	return false
+}
+
+// LastSeenVisible 按隐私级别判断观察者能否看到状态；isContact 表示观察者在对方好友列表里
+func LastSeenVisible(level string, isContact bool) bool {
+	switch level {
+	case LastSeenNobody:
+		return false
+	case LastSeenContacts:
+		return isContact
+	}
+	return true
+}
+
+// SetLastSeenPrivacy 设置最后在线可见范围（长期有效）
+func SetLastSeenPrivacy(ctx context.Context, user, level string) error {
+	if !ValidLastSeenPrivacy(level) {
+		return errs.ErrArgs.WrapMsg("invalid last seen privacy", "privacy", level)
+	}
+	if err := redis2.GetRedis().Set(ctx, privacyKey(user), level, 0).Err(); err != nil {
+		return err
+	}
+	// 可见范围变了，让各网关按新设置重推一次
+	_ = redis2.GetRedis().Publish(ctx, OnlineChannelName, OnlineEventPrivacy+":"+user).Err()
+	return nil
+}
+
+// GetLastSeenPrivacy 默认所有人可见
+func GetLastSeenPrivacy(ctx context.Context, user string) (string, error) {
+	level, err := redis2.GetRedis().Get(ctx, privacyKey(user)).Result()
+	if errors.Is(err, redis.Nil) || (err == nil && !ValidLastSeenPrivacy(level)) {
+		return LastSeenEveryone, nil
+	}
+	return level, err
+}
+
+// touchLastSeen 会话下线时记录最后在线时间，失败不影响下线
+func touchLastSeen(ctx context.Context, user string) {
+	if user == "" {
+		return
+	}
+	_ = redis2.GetRedis().Set(ctx, lastSeenKey(user), time.Now().UnixMilli(), 0).Err()
+}
+
+// afterOffline 会话下线后记最后在线时间；最后一个会话也没了就清掉主动状态，免得残留到 PresenceTTL
+func (m *OnlineStore) afterOffline(ctx context.Context, user string) {
+	touchLastSeen(ctx, user)
+	if online, err := m.IsUserOnline(ctx, user); err == nil && !online {
+		_ = ClearPresence(ctx, user)
+	}
+}
+
+// GetLastSeen 最后在线时间（ms），没有记录为 0
+func GetLastSeen(ctx context.Context, user string) (int64, error) {
+	v, err := redis2.GetRedis().Get(ctx, lastSeenKey(user)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return v, err
+}
+
+// AddPresenceSubscriptions 显式订阅 targets 的在线状态（好友默认已订阅，不用加）
+func AddPresenceSubscriptions(ctx context.Context, user string, targets []string) error {
+	members := make([]interface{}, 0, len(targets))
+	for _, t := range targets {
+		if t != "" && t != user {
+			members = append(members, t)
+		}
+	}
+	if len(members) == 0 {
+		return errs.ErrArgs.WrapMsg("user_ids is empty")
+	}
+	key := presenceSubsKey(user)
+	n, err := redis2.GetRedis().SCard(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if n+int64(len(members)) > presenceSubsMax {
+		return errs.ErrArgs.WrapMsg("too many presence subscriptions", "max", presenceSubsMax)
+	}
+	if err := redis2.GetRedis().SAdd(ctx, key, members...).Err(); err != nil {
+		return err
+	}
+	publishSubsChanged(ctx, user)
+	return nil
+}
+
+// RemovePresenceSubscriptions 取消显式订阅
+func RemovePresenceSubscriptions(ctx context.Context, user string, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	members := make([]interface{}, 0, len(targets))
+	for _, t := range targets {
+		members = append(members, t)
+	}
+	if err := redis2.GetRedis().SRem(ctx, presenceSubsKey(user), members...).Err(); err != nil {
+		return err
+	}
+	publishSubsChanged(ctx, user)
+	return nil
+}
+
+// ListPresenceSubscriptions 显式订阅的用户
+func ListPresenceSubscriptions(ctx context.Context, user string) ([]string, error) {
+	return redis2.GetRedis().SMembers(ctx, presenceSubsKey(user)).Result()
+}
+
+// NotifyWatchListChanged 好友关系变了：通知这些用户所在网关重新加载关注列表
+func NotifyWatchListChanged(ctx context.Context, users ...string) {
+	for _, u := range users {
+		publishSubsChanged(ctx, u)
+	}
+}
+
+// publishSubsChanged 通知用户所在网关重新加载订阅
+func publishSubsChanged(ctx context.Context, user string) {
+	_ = redis2.GetRedis().Publish(ctx, OnlineChannelName, OnlineEventSubs+":"+user).Err()
+}
+
+// OnlineChange 解析后的状态变更事件
+type OnlineChange struct {
+	Kind   string
+	UserID string
+}
+
+// ParseOnlineChange 解析 OnlineChannelName 上的事件；未授权连接的事件忽略
+func ParseOnlineChange(payload string) (OnlineChange, bool) {
+	kind, rest, ok := strings.Cut(payload, ":")
+	if !ok {
+		return OnlineChange{}, false
+	}
+	var user string
+	switch kind {
+	case OnlineEventOnline:
+		user = sessionKeyUser(rest)
+	case OnlineEventOffline:
+		if i := strings.LastIndexByte(rest, ':'); i > 0 {
+			user = sessionKeyUser(rest[:i])
+		}
+	case OnlineEventForceLogout, OnlineEventExpireClean:
+		user, _, _ = strings.Cut(rest, ":")
+	case OnlineEventSubs, OnlineEventPrivacy, OnlineEventChannels:
+		user = rest
+	default:
+		return OnlineChange{}, false
+	}
+	if user == "" {
+		return OnlineChange{}, false
+	}
+	return OnlineChange{Kind: kind, UserID: user}, true
+}
+
+// sessionKeyUser 已授权会话键里的用户：n:{<node>:<user>}:id:<snow> 或 n:<node>:id:<snow>:u:<user>
+func sessionKeyUser(key string) string {
+	if u := extractUser(key); u != "" {
+		return u
+	}
+	if i := strings.LastIndex(key, ":u:"); i >= 0 {
+		return key[i+3:]
+	}
+	return ""
+}
+
+// SubscribeChanges 订阅连接上下线和主动状态变更，阻塞到 ctx 结束；正在输入不在这里推
+func (m *OnlineStore) SubscribeChanges(ctx context.Context, fn func(OnlineChange)) error {
+	sub := redis2.GetRedis().Subscribe(ctx, m.conf.ChannelName, PresenceChannelName)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return errors.New("online subscription closed")
+			}
+			if msg.Channel != PresenceChannelName {
+				if c, ok := ParseOnlineChange(msg.Payload); ok {
+					fn(c)
+				}
+				continue
+			}
+			up := &pb.PresenceUpdate{}
+			if err := protojson.Unmarshal([]byte(msg.Payload), up); err != nil || up.GetUserId() == "" || up.GetStatus() == StatusTyping {
+				continue
+			}
+			fn(OnlineChange{Kind: OnlineEventPresence, UserID: up.GetUserId()})
+		}
+	}
+}
+
+// IsUserOnline 用户在任意网关上有会话即在线（IsOnline 只看本节点）
+func (m *OnlineStore) IsUserOnline(ctx context.Context, userID string) (bool, error) {
+	keys, err := m.BatchListOnlineConnList(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(keys) > 0, nil
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 续期：只有持有者才能续期；KEYS[1]=key; ARGV[1]=id; ARGV[2]=ttlMs
+var luaRenewLeader = redis.NewScript(`
+  if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  end
+  return 0
+`)
+
+// 释放：只删自己持有的锁
+var luaReleaseLeader = redis.NewScript(`
+  if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+  end
+  return 0
+`)
+
+// Leader 基于 Redis 锁的简单选主：SET NX PX 抢锁，持有者在 TTL 内反复调用 TryAcquire 续期
+// 持有者宕机后锁自然过期，其它节点在下一轮接管
+type Leader struct {
+	key string
+	id  string
+	ttl time.Duration
+}
+
+func NewLeader(key, id string, ttl time.Duration) *Leader {
+	return &Leader{key: key, id: id, ttl: ttl}
+}
+
+// TryAcquire 抢锁或续期，返回当前是否为 leader
+func (l *Leader) TryAcquire(ctx context.Context) (bool, error) {
+	rdb := GetRedis()
+	renewed, err := luaRenewLeader.Run(ctx, rdb, []string{l.key}, l.id, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	if renewed == 1 {
+		return true, nil
+	}
+	return rdb.SetNX(ctx, l.key, l.id, l.ttl).Result()
+}
+
+// Release 主动让出（节点退出时调用）
+func (l *Leader) Release(ctx context.Context) error {
+	return luaReleaseLeader.Run(ctx, GetRedis(), []string{l.key}, l.id).Err()
+}
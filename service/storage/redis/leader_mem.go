@@ -0,0 +1,17 @@
+package redis
+
+// 内存 Redis 下 luaRenewLeader / luaReleaseLeader 的等价实现
+func init() {
+	RegisterScript(luaRenewLeader, func(c *ScriptCall) any {
+		if v, _ := c.Call("GET", c.Keys[0]).(string); v == c.Args[0] {
+			return c.Call("PEXPIRE", c.Keys[0], c.Args[1])
+		}
+		return 0
+	})
+	RegisterScript(luaReleaseLeader, func(c *ScriptCall) any {
+		if v, _ := c.Call("GET", c.Keys[0]).(string); v == c.Args[0] {
+			return c.Call("DEL", c.Keys[0])
+		}
+		return 0
+	})
+}
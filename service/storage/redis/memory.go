@@ -0,0 +1,1321 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== 内存版 Redis：本地开发 / 单进程模式用，只实现项目里用到的命令 =====
+
+// status 简单字符串回复（+OK）
+type status string
+
+var (
+	errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = errors.New("ERR value is not an integer or out of range")
+	errNotFloat  = errors.New("ERR value is not a valid float")
+	errSyntax    = errors.New("ERR syntax error")
+)
+
+const (
+	kindString = "string"
+	kindHash   = "hash"
+	kindZSet   = "zset"
+	kindSet    = "set"
+	kindStream = "stream"
+)
+
+type memStreamEntry struct {
+	ID     string
+	Fields []string
+}
+
+type memEntry struct {
+	kind     string
+	str      string
+	hash     map[string]string
+	zset     map[string]float64
+	set      map[string]struct{}
+	stream   []memStreamEntry
+	expireAt time.Time // 零值表示不过期
+}
+
+type zItem struct {
+	Member string
+	Score  float64
+}
+
+// memStore 所有命令在一把锁下串行执行，脚本执行期间同样持锁，保证原子性
+type memStore struct {
+	mu      sync.Mutex
+	data    map[string]*memEntry
+	now     func() time.Time
+	lastXID [2]int64
+
+	publish func(channel, msg string) int64 // 由 MemoryServer 挂上，投递给订阅连接
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string]*memEntry), now: time.Now}
+}
+
+func (s *memStore) exec(args []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.execLocked(args)
+}
+
+// execMulti MULTI/EXEC：整批命令一次执行完
+func (s *memStore) execMulti(cmds [][]string) []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]any, 0, len(cmds))
+	for _, c := range cmds {
+		out = append(out, s.execLocked(c))
+	}
+	return out
+}
+
+// purgeExpired 定期清掉已过期的 key（访问时也会惰性删除）
+func (s *memStore) purgeExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for k, e := range s.data {
+		if !e.expireAt.IsZero() && !now.Before(e.expireAt) {
+			delete(s.data, k)
+		}
+	}
+}
+
+func (s *memStore) get(key string) *memEntry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !s.now().Before(e.expireAt) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+func (s *memStore) getKind(key, kind string) (*memEntry, error) {
+	e := s.get(key)
+	if e != nil && e.kind != kind {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+func (s *memStore) getOrCreate(key, kind string) (*memEntry, error) {
+	e, err := s.getKind(key, kind)
+	if err != nil || e != nil {
+		return e, err
+	}
+	e = &memEntry{kind: kind}
+	switch kind {
+	case kindHash:
+		e.hash = make(map[string]string)
+	case kindZSet:
+		e.zset = make(map[string]float64)
+	case kindSet:
+		e.set = make(map[string]struct{})
+	}
+	s.data[key] = e
+	return e, nil
+}
+
+// dropIfEmpty 和 Redis 一样，集合类 key 元素删光后 key 也不存在了
+func (s *memStore) dropIfEmpty(key string, e *memEntry) {
+	if (e.kind == kindHash && len(e.hash) == 0) || (e.kind == kindZSet && len(e.zset) == 0) || (e.kind == kindSet && len(e.set) == 0) {
+		delete(s.data, key)
+	}
+}
+
+func wrongArgs(cmd string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))
+}
+
+func (s *memStore) execLocked(args []string) any {
+	if len(args) == 0 {
+		return errors.New("ERR empty command")
+	}
+	cmd := strings.ToUpper(args[0])
+	h, ok := memCommands[cmd]
+	if !ok {
+		return fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+	if len(args)-1 < h.minArgs {
+		return wrongArgs(cmd)
+	}
+	return h.fn(s, args[1:])
+}
+
+// named 同一个实现处理一组相近的命令（EXPIRE/PEXPIRE、ZRANGE/ZREVRANGE ...）
+func named(cmd string, fn func(s *memStore, a []string, cmd string) any) func(s *memStore, a []string) any {
+	return func(s *memStore, a []string) any { return fn(s, a, cmd) }
+}
+
+type memCommand struct {
+	minArgs int
+	fn      func(s *memStore, a []string) any
+}
+
+var memCommands map[string]memCommand
+
+func init() {
+	memCommands = map[string]memCommand{
+		"PING":             {0, cmdPing},
+		"ECHO":             {1, func(_ *memStore, a []string) any { return a[0] }},
+		"SELECT":           {1, cmdOK},
+		"AUTH":             {1, cmdOK},
+		"CLIENT":           {1, cmdOK},
+		"READONLY":         {0, cmdOK},
+		"WATCH":            {1, cmdOK},
+		"UNWATCH":          {0, cmdOK},
+		"FLUSHALL":         {0, cmdFlush},
+		"FLUSHDB":          {0, cmdFlush},
+		"DBSIZE":           {0, cmdDBSize},
+		"GET":              {1, cmdGet},
+		"SET":              {2, cmdSet},
+		"SETNX":            {2, cmdSetNX},
+		"SETEX":            {3, named("SETEX", cmdSetEX)},
+		"PSETEX":           {3, named("PSETEX", cmdSetEX)},
+		"MGET":             {1, cmdMGet},
+		"INCR":             {1, named("INCR", cmdIncrBy)},
+		"INCRBY":           {2, named("INCRBY", cmdIncrBy)},
+		"DECR":             {1, named("DECR", cmdIncrBy)},
+		"DECRBY":           {2, named("DECRBY", cmdIncrBy)},
+		"DEL":              {1, cmdDel},
+		"UNLINK":           {1, cmdDel},
+		"EXISTS":           {1, cmdExists},
+		"TYPE":             {1, cmdType},
+		"EXPIRE":           {2, named("EXPIRE", cmdExpire)},
+		"PEXPIRE":          {2, named("PEXPIRE", cmdExpire)},
+		"EXPIREAT":         {2, named("EXPIREAT", cmdExpire)},
+		"PEXPIREAT":        {2, named("PEXPIREAT", cmdExpire)},
+		"PERSIST":          {1, cmdPersist},
+		"TTL":              {1, named("TTL", cmdTTL)},
+		"PTTL":             {1, named("PTTL", cmdTTL)},
+		"HSET":             {3, named("HSET", cmdHSet)},
+		"HMSET":            {3, named("HMSET", cmdHSet)},
+		"HSETNX":           {3, cmdHSetNX},
+		"HGET":             {2, cmdHGet},
+		"HMGET":            {2, cmdHMGet},
+		"HDEL":             {2, cmdHDel},
+		"HEXISTS":          {2, cmdHExists},
+		"HLEN":             {1, cmdHLen},
+		"HGETALL":          {1, cmdHGetAll},
+		"HINCRBY":          {3, cmdHIncrBy},
+		"SADD":             {2, cmdSAdd},
+		"SREM":             {2, cmdSRem},
+		"SMEMBERS":         {1, cmdSMembers},
+		"SISMEMBER":        {2, cmdSIsMember},
+		"SCARD":            {1, cmdSCard},
+		"ZADD":             {3, cmdZAdd},
+		"ZINCRBY":          {3, cmdZIncrBy},
+		"ZREM":             {2, cmdZRem},
+		"ZSCORE":           {2, cmdZScore},
+		"ZCARD":            {1, cmdZCard},
+		"ZCOUNT":           {3, cmdZCount},
+		"ZRANGE":           {3, named("ZRANGE", cmdZRange)},
+		"ZREVRANGE":        {3, named("ZREVRANGE", cmdZRange)},
+		"ZRANGEBYSCORE":    {3, named("ZRANGEBYSCORE", cmdZRangeByScore)},
+		"ZREVRANGEBYSCORE": {3, named("ZREVRANGEBYSCORE", cmdZRangeByScore)},
+		"ZREMRANGEBYSCORE": {3, cmdZRemRangeByScore},
+		"ZREMRANGEBYRANK":  {3, cmdZRemRangeByRank},
+		"SCAN":             {1, cmdScan},
+		"KEYS":             {1, cmdKeys},
+		"PUBLISH":          {2, cmdPublish},
+		"XADD":             {4, cmdXAdd},
+		"XLEN":             {1, cmdXLen},
+		"EVAL":             {2, cmdEval},
+		"EVALSHA":          {2, cmdEval},
+		"SCRIPT":           {1, cmdScript},
+	}
+}
+
+// ---------- 通用 ----------
+
+func cmdOK(_ *memStore, _ []string) any { return status("OK") }
+
+func cmdPing(_ *memStore, a []string) any {
+	if len(a) > 0 {
+		return a[0]
+	}
+	return status("PONG")
+}
+
+func cmdFlush(s *memStore, _ []string) any {
+	s.data = make(map[string]*memEntry)
+	return status("OK")
+}
+
+func cmdDBSize(s *memStore, _ []string) any {
+	var n int64
+	for k := range s.data {
+		if s.get(k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdDel(s *memStore, a []string) any {
+	var n int64
+	for _, k := range a {
+		if s.get(k) != nil {
+			delete(s.data, k)
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(s *memStore, a []string) any {
+	var n int64
+	for _, k := range a {
+		if s.get(k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(s *memStore, a []string) any {
+	if e := s.get(a[0]); e != nil {
+		return status(e.kind)
+	}
+	return status("none")
+}
+
+// cmdExpire EXPIRE/PEXPIRE/EXPIREAT/PEXPIREAT，过去的时间点直接删除 key
+func cmdExpire(s *memStore, a []string, cmd string) any {
+	e := s.get(a[0])
+	n, err := strconv.ParseInt(a[1], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	if e == nil {
+		return int64(0)
+	}
+	var at time.Time
+	switch cmd {
+	case "EXPIRE":
+		at = s.now().Add(time.Duration(n) * time.Second)
+	case "PEXPIRE":
+		at = s.now().Add(time.Duration(n) * time.Millisecond)
+	case "EXPIREAT":
+		at = time.Unix(n, 0)
+	default:
+		at = time.UnixMilli(n)
+	}
+	if !s.now().Before(at) {
+		delete(s.data, a[0])
+		return int64(1)
+	}
+	e.expireAt = at
+	return int64(1)
+}
+
+func cmdPersist(s *memStore, a []string) any {
+	e := s.get(a[0])
+	if e == nil || e.expireAt.IsZero() {
+		return int64(0)
+	}
+	e.expireAt = time.Time{}
+	return int64(1)
+}
+
+func cmdTTL(s *memStore, a []string, cmd string) any {
+	e := s.get(a[0])
+	if e == nil {
+		return int64(-2)
+	}
+	if e.expireAt.IsZero() {
+		return int64(-1)
+	}
+	d := e.expireAt.Sub(s.now())
+	if cmd == "PTTL" {
+		return d.Milliseconds()
+	}
+	return int64(math.Ceil(d.Seconds() - 0.5))
+}
+
+// ---------- string ----------
+
+func cmdGet(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindString)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	return e.str
+}
+
+func cmdMGet(s *memStore, a []string) any {
+	out := make([]any, len(a))
+	for i, k := range a {
+		if e := s.get(k); e != nil && e.kind == kindString {
+			out[i] = e.str
+		}
+	}
+	return out
+}
+
+// cmdSet SET key value [EX s|PX ms|EXAT s|PXAT ms|KEEPTTL] [NX|XX] [GET]
+func cmdSet(s *memStore, a []string) any {
+	key, val := a[0], a[1]
+	var (
+		at              time.Time
+		keepTTL         bool
+		nx, xx, withGet bool
+	)
+	for i := 2; i < len(a); i++ {
+		opt := strings.ToUpper(a[i])
+		switch opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			withGet = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(a) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(a[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errors.New("ERR invalid expire time in 'set' command")
+			}
+			i++
+			switch opt {
+			case "EX":
+				at = s.now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				at = s.now().Add(time.Duration(n) * time.Millisecond)
+			case "EXAT":
+				at = time.Unix(n, 0)
+			default:
+				at = time.UnixMilli(n)
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	old, err := s.getKind(key, kindString)
+	if err != nil && withGet {
+		return err
+	}
+	exists := s.get(key) != nil
+	var prev any
+	if old != nil {
+		prev = old.str
+	}
+	if (nx && exists) || (xx && !exists) {
+		if withGet {
+			return prev
+		}
+		return nil
+	}
+	e := &memEntry{kind: kindString, str: val, expireAt: at}
+	if keepTTL && old != nil {
+		e.expireAt = old.expireAt
+	}
+	s.data[key] = e
+	if withGet {
+		return prev
+	}
+	return status("OK")
+}
+
+func cmdSetNX(s *memStore, a []string) any {
+	if s.get(a[0]) != nil {
+		return int64(0)
+	}
+	s.data[a[0]] = &memEntry{kind: kindString, str: a[1]}
+	return int64(1)
+}
+
+func cmdSetEX(s *memStore, a []string, cmd string) any {
+	n, err := strconv.ParseInt(a[1], 10, 64)
+	if err != nil || n <= 0 {
+		return errors.New("ERR invalid expire time in 'setex' command")
+	}
+	d := time.Duration(n) * time.Second
+	if cmd == "PSETEX" {
+		d = time.Duration(n) * time.Millisecond
+	}
+	s.data[a[0]] = &memEntry{kind: kindString, str: a[2], expireAt: s.now().Add(d)}
+	return status("OK")
+}
+
+func cmdIncrBy(s *memStore, a []string, cmd string) any {
+	by := int64(1)
+	if len(a) > 1 {
+		n, err := strconv.ParseInt(a[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		by = n
+	}
+	if cmd == "DECR" || cmd == "DECRBY" {
+		by = -by
+	}
+	e, err := s.getKind(a[0], kindString)
+	if err != nil {
+		return err
+	}
+	var cur int64
+	if e != nil {
+		if cur, err = strconv.ParseInt(e.str, 10, 64); err != nil {
+			return errNotInt
+		}
+	} else {
+		e = &memEntry{kind: kindString}
+		s.data[a[0]] = e
+	}
+	cur += by
+	e.str = strconv.FormatInt(cur, 10)
+	return cur
+}
+
+// ---------- hash ----------
+
+func cmdHSet(s *memStore, a []string, cmd string) any {
+	if len(a)%2 != 1 {
+		return wrongArgs(cmd)
+	}
+	e, err := s.getOrCreate(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	var added int64
+	for i := 1; i < len(a); i += 2 {
+		if _, ok := e.hash[a[i]]; !ok {
+			added++
+		}
+		e.hash[a[i]] = a[i+1]
+	}
+	if cmd == "HMSET" {
+		return status("OK")
+	}
+	return added
+}
+
+func cmdHSetNX(s *memStore, a []string) any {
+	e, err := s.getOrCreate(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.hash[a[1]]; ok {
+		return int64(0)
+	}
+	e.hash[a[1]] = a[2]
+	return int64(1)
+}
+
+func cmdHGet(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	if v, ok := e.hash[a[1]]; ok {
+		return v
+	}
+	return nil
+}
+
+func cmdHMGet(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	out := make([]any, len(a)-1)
+	for i, f := range a[1:] {
+		if e == nil {
+			continue
+		}
+		if v, ok := e.hash[f]; ok {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func cmdHDel(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindHash)
+	if err != nil || e == nil {
+		if err != nil {
+			return err
+		}
+		return int64(0)
+	}
+	var n int64
+	for _, f := range a[1:] {
+		if _, ok := e.hash[f]; ok {
+			delete(e.hash, f)
+			n++
+		}
+	}
+	s.dropIfEmpty(a[0], e)
+	return n
+}
+
+func cmdHExists(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		if _, ok := e.hash[a[1]]; ok {
+			return int64(1)
+		}
+	}
+	return int64(0)
+}
+
+func cmdHLen(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return int64(0)
+	}
+	return int64(len(e.hash))
+}
+
+func cmdHGetAll(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	out := []any{}
+	if e == nil {
+		return out
+	}
+	fields := make([]string, 0, len(e.hash))
+	for f := range e.hash {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		out = append(out, f, e.hash[f])
+	}
+	return out
+}
+
+func cmdHIncrBy(s *memStore, a []string) any {
+	by, err := strconv.ParseInt(a[2], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	e, err := s.getOrCreate(a[0], kindHash)
+	if err != nil {
+		return err
+	}
+	var cur int64
+	if v, ok := e.hash[a[1]]; ok {
+		if cur, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return errors.New("ERR hash value is not an integer")
+		}
+	}
+	cur += by
+	e.hash[a[1]] = strconv.FormatInt(cur, 10)
+	return cur
+}
+
+// ---------- set ----------
+
+func cmdSAdd(s *memStore, a []string) any {
+	e, err := s.getOrCreate(a[0], kindSet)
+	if err != nil {
+		return err
+	}
+	var added int64
+	for _, m := range a[1:] {
+		if _, ok := e.set[m]; !ok {
+			e.set[m] = struct{}{}
+			added++
+		}
+	}
+	return added
+}
+
+func cmdSRem(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindSet)
+	if err != nil || e == nil {
+		if err != nil {
+			return err
+		}
+		return int64(0)
+	}
+	var n int64
+	for _, m := range a[1:] {
+		if _, ok := e.set[m]; ok {
+			delete(e.set, m)
+			n++
+		}
+	}
+	s.dropIfEmpty(a[0], e)
+	return n
+}
+
+func cmdSMembers(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindSet)
+	if err != nil {
+		return err
+	}
+	out := []any{}
+	if e == nil {
+		return out
+	}
+	members := make([]string, 0, len(e.set))
+	for m := range e.set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	for _, m := range members {
+		out = append(out, m)
+	}
+	return out
+}
+
+func cmdSIsMember(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindSet)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		if _, ok := e.set[a[1]]; ok {
+			return int64(1)
+		}
+	}
+	return int64(0)
+}
+
+func cmdSCard(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindSet)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return int64(0)
+	}
+	return int64(len(e.set))
+}
+
+// ---------- zset ----------
+
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func parseScore(v string) (float64, error) {
+	switch strings.ToLower(v) {
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
+
+// scoreBound ZRANGEBYSCORE 的区间端点，"(" 前缀表示开区间
+type scoreBound struct {
+	v    float64
+	open bool
+}
+
+func parseBound(v string) (scoreBound, error) {
+	open := strings.HasPrefix(v, "(")
+	if open {
+		v = v[1:]
+	}
+	f, err := parseScore(v)
+	if err != nil {
+		return scoreBound{}, errors.New("ERR min or max is not a float")
+	}
+	return scoreBound{v: f, open: open}, nil
+}
+
+func (b scoreBound) belowOrAt(f float64) bool { // f >= min
+	if b.open {
+		return f > b.v
+	}
+	return f >= b.v
+}
+
+func (b scoreBound) aboveOrAt(f float64) bool { // f <= max
+	if b.open {
+		return f < b.v
+	}
+	return f <= b.v
+}
+
+func sortedZ(z map[string]float64) []zItem {
+	items := make([]zItem, 0, len(z))
+	for m, sc := range z {
+		items = append(items, zItem{Member: m, Score: sc})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Score != items[j].Score {
+			return items[i].Score < items[j].Score
+		}
+		return items[i].Member < items[j].Member
+	})
+	return items
+}
+
+// cmdZAdd ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member ...
+func cmdZAdd(s *memStore, a []string) any {
+	key := a[0]
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+flags:
+	for ; i < len(a); i++ {
+		switch strings.ToUpper(a[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+	pairs := a[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (incr && len(pairs) != 2) {
+		return errSyntax
+	}
+	e, err := s.getOrCreate(key, kindZSet)
+	if err != nil {
+		return err
+	}
+	var added, changed int64
+	var last any
+	for j := 0; j < len(pairs); j += 2 {
+		sc, err := parseScore(pairs[j])
+		if err != nil {
+			s.dropIfEmpty(key, e)
+			return err
+		}
+		m := pairs[j+1]
+		old, exists := e.zset[m]
+		if (nx && exists) || (xx && !exists) {
+			last = nil
+			continue
+		}
+		if incr && exists {
+			sc += old
+		}
+		if exists && ((gt && sc <= old) || (lt && sc >= old)) {
+			last = nil
+			continue
+		}
+		if !exists {
+			added++
+		} else if old != sc {
+			changed++
+		}
+		e.zset[m] = sc
+		last = formatScore(sc)
+	}
+	s.dropIfEmpty(key, e)
+	if incr {
+		return last
+	}
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZIncrBy(s *memStore, a []string) any {
+	by, err := parseScore(a[1])
+	if err != nil {
+		return err
+	}
+	e, err := s.getOrCreate(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	e.zset[a[2]] += by
+	return formatScore(e.zset[a[2]])
+}
+
+func cmdZRem(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, m := range a[1:] {
+		if _, ok := e.zset[m]; ok {
+			delete(e.zset, m)
+			n++
+		}
+	}
+	s.dropIfEmpty(a[0], e)
+	return n
+}
+
+func cmdZScore(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	if sc, ok := e.zset[a[1]]; ok {
+		return formatScore(sc)
+	}
+	return nil
+}
+
+func cmdZCard(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return int64(0)
+	}
+	return int64(len(e.zset))
+}
+
+func cmdZCount(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	lo, err := parseBound(a[1])
+	if err != nil {
+		return err
+	}
+	hi, err := parseBound(a[2])
+	if err != nil {
+		return err
+	}
+	var n int64
+	if e != nil {
+		for _, sc := range e.zset {
+			if lo.belowOrAt(sc) && hi.aboveOrAt(sc) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// rankRange 把 start/stop（支持负数）换成 [from, to) 下标
+func rankRange(startS, stopS string, n int) (int, int, error) {
+	start, err1 := strconv.Atoi(startS)
+	stop, err2 := strconv.Atoi(stopS)
+	if err1 != nil || err2 != nil {
+		return 0, 0, errNotInt
+	}
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, nil
+	}
+	return start, stop + 1, nil
+}
+
+func zReply(items []zItem, withScores bool) []any {
+	out := make([]any, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.Member)
+		if withScores {
+			out = append(out, formatScore(it.Score))
+		}
+	}
+	return out
+}
+
+func reverseZ(items []zItem) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+}
+
+// cmdZRange ZRANGE/ZREVRANGE key start stop [WITHSCORES]
+func cmdZRange(s *memStore, a []string, cmd string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	withScores := false
+	for _, opt := range a[3:] {
+		if strings.ToUpper(opt) != "WITHSCORES" {
+			return errSyntax
+		}
+		withScores = true
+	}
+	if e == nil {
+		return []any{}
+	}
+	items := sortedZ(e.zset)
+	if cmd == "ZREVRANGE" {
+		reverseZ(items)
+	}
+	from, to, err := rankRange(a[1], a[2], len(items))
+	if err != nil {
+		return err
+	}
+	return zReply(items[from:to], withScores)
+}
+
+// zByScore 按分数区间筛选（升序）；rev 为 true 时 a[1] 是 max、a[2] 是 min
+func zByScore(e *memEntry, a []string, rev bool) ([]zItem, error) {
+	loS, hiS := a[1], a[2]
+	if rev {
+		loS, hiS = a[2], a[1]
+	}
+	lo, err := parseBound(loS)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseBound(hiS)
+	if err != nil {
+		return nil, err
+	}
+	var out []zItem
+	if e == nil {
+		return out, nil
+	}
+	for _, it := range sortedZ(e.zset) {
+		if lo.belowOrAt(it.Score) && hi.aboveOrAt(it.Score) {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// cmdZRangeByScore ZRANGEBYSCORE key min max / ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func cmdZRangeByScore(s *memStore, a []string, cmd string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	rev := cmd == "ZREVRANGEBYSCORE"
+	items, err := zByScore(e, a, rev)
+	if err != nil {
+		return err
+	}
+	if rev {
+		reverseZ(items)
+	}
+	withScores := false
+	offset, count := 0, -1
+	for i := 3; i < len(a); i++ {
+		switch strings.ToUpper(a[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(a) {
+				return errSyntax
+			}
+			o, err1 := strconv.Atoi(a[i+1])
+			c, err2 := strconv.Atoi(a[i+2])
+			if err1 != nil || err2 != nil {
+				return errNotInt
+			}
+			offset, count = o, c
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	if offset < 0 || offset >= len(items) {
+		return []any{}
+	}
+	items = items[offset:]
+	if count >= 0 && count < len(items) {
+		items = items[:count]
+	}
+	return zReply(items, withScores)
+}
+
+func cmdZRemRangeByScore(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	items, err := zByScore(e, a, false)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		delete(e.zset, it.Member)
+	}
+	if e != nil {
+		s.dropIfEmpty(a[0], e)
+	}
+	return int64(len(items))
+}
+
+func cmdZRemRangeByRank(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindZSet)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return int64(0)
+	}
+	items := sortedZ(e.zset)
+	from, to, err := rankRange(a[1], a[2], len(items))
+	if err != nil {
+		return err
+	}
+	for _, it := range items[from:to] {
+		delete(e.zset, it.Member)
+	}
+	s.dropIfEmpty(a[0], e)
+	return int64(to - from)
+}
+
+// ---------- keyspace ----------
+
+func (s *memStore) matchKeys(pattern, kind string) []string {
+	var out []string
+	for k := range s.data {
+		e := s.get(k)
+		if e == nil || (kind != "" && e.kind != kind) {
+			continue
+		}
+		if pattern == "" || globMatch(pattern, k) {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// cmdScan 内存里数据量小，一次返回全部匹配的 key，游标固定回 0
+func cmdScan(s *memStore, a []string) any {
+	pattern, kind := "", ""
+	for i := 1; i+1 < len(a); i += 2 {
+		switch strings.ToUpper(a[i]) {
+		case "MATCH":
+			pattern = a[i+1]
+		case "TYPE":
+			kind = strings.ToLower(a[i+1])
+		case "COUNT":
+		default:
+			return errSyntax
+		}
+	}
+	keys := s.matchKeys(pattern, kind)
+	arr := make([]any, len(keys))
+	for i, k := range keys {
+		arr[i] = k
+	}
+	return []any{"0", arr}
+}
+
+func cmdKeys(s *memStore, a []string) any {
+	keys := s.matchKeys(a[0], "")
+	out := make([]any, len(keys))
+	for i, k := range keys {
+		out[i] = k
+	}
+	return out
+}
+
+// cmdPublish 返回收到消息的订阅连接数
+func cmdPublish(s *memStore, a []string) any {
+	if s.publish == nil {
+		return int64(0)
+	}
+	return s.publish(a[0], a[1])
+}
+
+// ---------- stream ----------
+
+// cmdXAdd XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] n] [LIMIT n] *|id field value ...
+func cmdXAdd(s *memStore, a []string) any {
+	key := a[0]
+	maxLen := -1
+	i := 1
+	for ; i < len(a); i++ {
+		switch strings.ToUpper(a[i]) {
+		case "NOMKSTREAM":
+			if s.get(key) == nil {
+				return nil
+			}
+			continue
+		case "MAXLEN", "MINID":
+			opt := strings.ToUpper(a[i])
+			i++
+			if i < len(a) && (a[i] == "=" || a[i] == "~") {
+				i++
+			}
+			if i >= len(a) {
+				return errSyntax
+			}
+			if opt == "MAXLEN" {
+				n, err := strconv.Atoi(a[i])
+				if err != nil {
+					return errNotInt
+				}
+				maxLen = n
+			}
+			continue
+		case "LIMIT":
+			i++
+			continue
+		}
+		break
+	}
+	if i >= len(a) || (len(a)-i-1)%2 != 0 || len(a)-i-1 == 0 {
+		return wrongArgs("XADD")
+	}
+	e, err := s.getOrCreate(key, kindStream)
+	if err != nil {
+		return err
+	}
+	id := a[i]
+	if id == "*" {
+		ms := s.now().UnixMilli()
+		if ms <= s.lastXID[0] {
+			ms = s.lastXID[0]
+			s.lastXID[1]++
+		} else {
+			s.lastXID = [2]int64{ms, 0}
+		}
+		id = fmt.Sprintf("%d-%d", s.lastXID[0], s.lastXID[1])
+	}
+	e.stream = append(e.stream, memStreamEntry{ID: id, Fields: append([]string(nil), a[i+1:]...)})
+	if maxLen >= 0 && len(e.stream) > maxLen {
+		e.stream = e.stream[len(e.stream)-maxLen:]
+	}
+	return id
+}
+
+func cmdXLen(s *memStore, a []string) any {
+	e, err := s.getKind(a[0], kindStream)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return int64(0)
+	}
+	return int64(len(e.stream))
+}
+
+// globMatch Redis 风格的通配：* ? [abc] [^a] [a-z] 以及 \ 转义
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		case '[':
+			if s == "" {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				if s[0] != '[' {
+					return false
+				}
+				break
+			}
+			class := pattern[1 : end+1]
+			neg := strings.HasPrefix(class, "^")
+			if neg {
+				class = class[1:]
+			}
+			hit := false
+			for j := 0; j < len(class); j++ {
+				if j+2 < len(class) && class[j+1] == '-' {
+					if class[j] <= s[0] && s[0] <= class[j+2] {
+						hit = true
+					}
+					j += 2
+				} else if class[j] == s[0] {
+					hit = true
+				}
+			}
+			if hit == neg {
+				return false
+			}
+			pattern, s = pattern[end+2:], s[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
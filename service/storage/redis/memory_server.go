@@ -0,0 +1,382 @@
+package redis
+
+import (
+	"PProject/logger"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MemoryServer 进程内的 RESP 服务：go-redis 客户端照常连接，业务代码不用区分真假 Redis
+// 只监听回环地址，也可以用 redis-cli 连上去排查数据
+type MemoryServer struct {
+	ln    net.Listener
+	store *memStore
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	psMu sync.Mutex
+	subs map[string]map[*memConn]struct{} // channel -> 订阅连接
+}
+
+// memConn 一个客户端连接；发布消息和命令回复都可能写它，写操作加锁
+type memConn struct {
+	wmu      sync.Mutex
+	w        *bufio.Writer
+	channels map[string]struct{} // 已订阅的频道，受 MemoryServer.psMu 保护
+}
+
+func (c *memConn) write(replies ...any) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for _, r := range replies {
+		writeReply(c.w, r)
+	}
+	return c.w.Flush()
+}
+
+// StartMemoryServer 在 addr 上启动内存 Redis，addr 为空时随机端口
+func StartMemoryServer(addr string) (*MemoryServer, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &MemoryServer{
+		ln:    ln,
+		store: newMemStore(),
+		conns: make(map[net.Conn]struct{}),
+		done:  make(chan struct{}),
+		subs:  make(map[string]map[*memConn]struct{}),
+	}
+	s.store.publish = s.publish
+	s.wg.Add(2)
+	go s.acceptLoop()
+	go s.purgeLoop()
+	return s, nil
+}
+
+func (s *MemoryServer) Addr() string { return s.ln.Addr().String() }
+
+// NewClient 连到本服务的 go-redis 客户端
+func (s *MemoryServer) NewClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:            s.Addr(),
+		Protocol:        2,
+		DisableIdentity: true,
+	})
+}
+
+func (s *MemoryServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *MemoryServer) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+func (s *MemoryServer) purgeLoop() {
+	defer s.wg.Done()
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.store.purgeExpired()
+		}
+	}
+}
+
+func (s *MemoryServer) serve(c net.Conn) {
+	r := bufio.NewReader(c)
+	mc := &memConn{w: bufio.NewWriter(c), channels: make(map[string]struct{})}
+
+	defer s.wg.Done()
+	defer func() {
+		s.unsubscribe(mc, nil)
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		_ = c.Close()
+	}()
+
+	var (
+		inMulti bool
+		queued  [][]string
+	)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Infof("[MemRedis] read command: %v", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		var replies []any
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "HELLO":
+			// 只说 RESP2，go-redis 收到错误后按 RESP2 继续
+			replies = []any{errors.New("ERR unknown command 'HELLO'")}
+		case cmd == "QUIT":
+			_ = mc.write(status("OK"))
+			return
+		case cmd == "SUBSCRIBE":
+			replies = s.subscribe(mc, args[1:])
+		case cmd == "UNSUBSCRIBE":
+			replies = s.unsubscribe(mc, args[1:])
+		case cmd == "PING" && s.subscribed(mc):
+			// 订阅模式下 PING 回数组
+			msg := ""
+			if len(args) > 1 {
+				msg = args[1]
+			}
+			replies = []any{[]any{"pong", msg}}
+		case cmd == "MULTI":
+			if inMulti {
+				replies = []any{errors.New("ERR MULTI calls can not be nested")}
+			} else {
+				inMulti, queued = true, nil
+				replies = []any{status("OK")}
+			}
+		case cmd == "DISCARD":
+			inMulti, queued = false, nil
+			replies = []any{status("OK")}
+		case cmd == "EXEC":
+			if !inMulti {
+				replies = []any{errors.New("ERR EXEC without MULTI")}
+				break
+			}
+			res := s.store.execMulti(queued)
+			inMulti, queued = false, nil
+			replies = []any{res}
+		case inMulti:
+			queued = append(queued, args)
+			replies = []any{status("QUEUED")}
+		default:
+			replies = []any{s.store.exec(args)}
+		}
+
+		// 管道里还有命令就先攒着，一起写回
+		mc.wmu.Lock()
+		for _, rep := range replies {
+			writeReply(mc.w, rep)
+		}
+		if r.Buffered() == 0 {
+			err = mc.w.Flush()
+		}
+		mc.wmu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ---------- pub/sub ----------
+
+func (s *MemoryServer) subscribed(mc *memConn) bool {
+	s.psMu.Lock()
+	defer s.psMu.Unlock()
+	return len(mc.channels) > 0
+}
+
+func (s *MemoryServer) subscribe(mc *memConn, channels []string) []any {
+	s.psMu.Lock()
+	defer s.psMu.Unlock()
+	out := make([]any, 0, len(channels))
+	for _, ch := range channels {
+		if s.subs[ch] == nil {
+			s.subs[ch] = make(map[*memConn]struct{})
+		}
+		s.subs[ch][mc] = struct{}{}
+		mc.channels[ch] = struct{}{}
+		out = append(out, []any{"subscribe", ch, int64(len(mc.channels))})
+	}
+	return out
+}
+
+// unsubscribe channels 为空时退订全部
+func (s *MemoryServer) unsubscribe(mc *memConn, channels []string) []any {
+	s.psMu.Lock()
+	defer s.psMu.Unlock()
+	if len(channels) == 0 {
+		for ch := range mc.channels {
+			channels = append(channels, ch)
+		}
+		if len(channels) == 0 {
+			return []any{[]any{"unsubscribe", nil, int64(0)}}
+		}
+	}
+	out := make([]any, 0, len(channels))
+	for _, ch := range channels {
+		delete(mc.channels, ch)
+		if m := s.subs[ch]; m != nil {
+			delete(m, mc)
+			if len(m) == 0 {
+				delete(s.subs, ch)
+			}
+		}
+		out = append(out, []any{"unsubscribe", ch, int64(len(mc.channels))})
+	}
+	return out
+}
+
+// publish 同步写给每个订阅连接（回环地址上足够快，保证同一频道的消息有序）
+func (s *MemoryServer) publish(channel, msg string) int64 {
+	s.psMu.Lock()
+	targets := make([]*memConn, 0, len(s.subs[channel]))
+	for mc := range s.subs[channel] {
+		targets = append(targets, mc)
+	}
+	s.psMu.Unlock()
+
+	for _, mc := range targets {
+		_ = mc.write([]any{"message", channel, msg})
+	}
+	return int64(len(targets))
+}
+
+// readCommand 读取一条 RESP 数组命令（客户端总是发 *N\r\n$len\r\n...）
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("bad array header %q", line)
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		hdr, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if hdr == "" || hdr[0] != '$' {
+			return nil, fmt.Errorf("bad bulk header %q", hdr)
+		}
+		size, err := strconv.Atoi(hdr[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("bad bulk header %q", hdr)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, v any) {
+	switch r := v.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case status:
+		_, _ = w.WriteString("+" + string(r) + "\r\n")
+	case error:
+		_, _ = w.WriteString("-" + strings.ReplaceAll(r.Error(), "\r\n", " ") + "\r\n")
+	case int64:
+		_, _ = w.WriteString(":" + strconv.FormatInt(r, 10) + "\r\n")
+	case string:
+		_, _ = w.WriteString("$" + strconv.Itoa(len(r)) + "\r\n" + r + "\r\n")
+	case []any:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(r)) + "\r\n")
+		for _, x := range r {
+			writeReply(w, x)
+		}
+	default:
+		writeReply(w, fmt.Sprint(r))
+	}
+}
+
+// InitMemoryRedis 用进程内的内存 Redis 初始化全局客户端（单进程开发模式）
+func InitMemoryRedis() (*MemoryServer, error) {
+	var (
+		srv     *MemoryServer
+		initErr error
+	)
+	redisOnce.Do(func() {
+		srv, initErr = StartMemoryServer("")
+		if initErr != nil {
+			return
+		}
+		rdb := srv.NewClient()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			initErr = err
+			_ = srv.Close()
+			return
+		}
+		redisMgr = &RedisManager{client: rdb}
+	})
+	if initErr == nil && srv == nil {
+		initErr = errors.New("redis already initialized")
+	}
+	return srv, initErr
+}
@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestMemory(t *testing.T) *redis.Client {
+	t.Helper()
+	srv, err := StartMemoryServer("")
+	if err != nil {
+		t.Fatalf("start memory redis: %v", err)
+	}
+	rdb := srv.NewClient()
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = srv.Close()
+	})
+	return rdb
+}
+
+func TestMemoryServerCommands(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestMemory(t)
+
+	if err := rdb.Set(ctx, "k", "v", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rdb.Get(ctx, "k").Result(); v != "v" {
+		t.Fatalf("get = %q", v)
+	}
+	if ok, _ := rdb.SetNX(ctx, "k", "x", 0).Result(); ok {
+		t.Fatal("setnx on existing key should fail")
+	}
+	if _, err := rdb.Get(ctx, "missing").Result(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("missing key err = %v", err)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, "z", redis.Z{Score: 3, Member: "c"}, redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: "b"})
+	incr := pipe.Incr(ctx, "n")
+	pipe.Expire(ctx, "z", time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if incr.Val() != 1 {
+		t.Fatalf("incr = %d", incr.Val())
+	}
+	got, _ := rdb.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: "(1", Max: "+inf"}).Result()
+	if len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Fatalf("zrangebyscore = %v", got)
+	}
+
+	if n, _ := rdb.SAdd(ctx, "s", "b", "a", "b").Result(); n != 2 {
+		t.Fatalf("sadd = %d", n)
+	}
+	_ = rdb.SRem(ctx, "s", "b").Err()
+	if m, _ := rdb.SMembers(ctx, "s").Result(); len(m) != 1 || m[0] != "a" {
+		t.Fatalf("smembers = %v", m)
+	}
+	_ = rdb.SRem(ctx, "s", "a").Err()
+	if n, _ := rdb.Exists(ctx, "s").Result(); n != 0 {
+		t.Fatal("empty set should be removed")
+	}
+
+	_ = rdb.Set(ctx, "nidx:{gw1:u1}", "1", 0).Err()
+	_ = rdb.Set(ctx, "nidx:{gw1:u2}", "1", 0).Err()
+	var keys []string
+	iter := rdb.Scan(ctx, 0, "nidx:{*:u1}", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if len(keys) != 1 || keys[0] != "nidx:{gw1:u1}" {
+		t.Fatalf("scan = %v", keys)
+	}
+
+	_ = rdb.Set(ctx, "short", "1", 50*time.Millisecond).Err()
+	time.Sleep(80 * time.Millisecond)
+	if n, _ := rdb.Exists(ctx, "short").Result(); n != 0 {
+		t.Fatal("key should have expired")
+	}
+}
+
+func TestMemoryServerScripts(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestMemory(t)
+
+	// 登记了 Go 实现的脚本：EVALSHA 先 NOSCRIPT，go-redis 回退 EVAL 后执行成功
+	if n, err := luaRenewLeader.Run(ctx, rdb, []string{"lk"}, "node-1", 1000).Int64(); err != nil || n != 0 {
+		t.Fatalf("renew without lock = %d, %v", n, err)
+	}
+	_ = rdb.Set(ctx, "lk", "node-1", time.Second).Err()
+	if n, err := luaRenewLeader.Run(ctx, rdb, []string{"lk"}, "node-1", 5000).Int64(); err != nil || n != 1 {
+		t.Fatalf("renew by holder = %d, %v", n, err)
+	}
+	if n, err := luaReleaseLeader.Run(ctx, rdb, []string{"lk"}, "node-2").Int64(); err != nil || n != 0 {
+		t.Fatalf("release by other = %d, %v", n, err)
+	}
+
+	// 没有 Go 实现的脚本明确报错，而不是静默返回
+	if err := redis.NewScript(`return 1`).Run(ctx, rdb, nil).Err(); err == nil {
+		t.Fatal("unknown script should fail")
+	}
+}
+
+func TestMemoryServerPubSub(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestMemory(t)
+
+	sub := rdb.Subscribe(ctx, "ch1")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	n, err := rdb.Publish(ctx, "ch1", "hello").Result()
+	if err != nil || n != 1 {
+		t.Fatalf("publish = %d, %v", n, err)
+	}
+	if n, _ := rdb.Publish(ctx, "other", "x").Result(); n != 0 {
+		t.Fatalf("publish to channel without subscribers = %d", n)
+	}
+
+	select {
+	case m := <-sub.Channel():
+		if m.Channel != "ch1" || m.Payload != "hello" {
+			t.Fatalf("got %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	if err := sub.Unsubscribe(ctx, "ch1"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n, _ := rdb.Publish(ctx, "ch1", "again").Result()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("still subscribed after unsubscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,210 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ===== 内存版 Redis 的脚本：没有 Lua 解释器，每段脚本按 SHA1 对应一个等价的 Go 实现 =====
+// 脚本所在的包在 init 里 RegisterScript，Go 实现逐行对照 Lua 写，redis.call 换成 c.Call
+
+// ScriptFunc 脚本的 Go 实现；返回值规则同 Lua：int/int64 -> 整数，string -> 字符串，切片 -> 数组，nil/false -> nil
+type ScriptFunc func(c *ScriptCall) any
+
+var (
+	scriptsMu sync.RWMutex
+	scripts   = make(map[string]ScriptFunc)
+)
+
+// RegisterScript 登记脚本的 Go 实现（和 EVALSHA 用同一个 SHA1）
+func RegisterScript(s *redis.Script, fn ScriptFunc) {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	scripts[s.Hash()] = fn
+}
+
+func lookupScript(sha string) (ScriptFunc, bool) {
+	scriptsMu.RLock()
+	defer scriptsMu.RUnlock()
+	fn, ok := scripts[strings.ToLower(sha)]
+	return fn, ok
+}
+
+func scriptSHA(src string) string {
+	h := sha1.Sum([]byte(src))
+	return hex.EncodeToString(h[:])
+}
+
+// scriptError redis.call 出错时中断脚本，和 Lua 一样把错误返回给调用方
+type scriptError struct{ err error }
+
+// ScriptCall 一次脚本执行：Keys/Args 对应 KEYS/ARGV（下标从 0 开始）
+type ScriptCall struct {
+	Keys  []string
+	Args  []string
+	store *memStore
+}
+
+// Call 等价于 redis.call；命令出错时中断整个脚本
+func (c *ScriptCall) Call(args ...any) any {
+	strs := make([]string, len(args))
+	for i, a := range args {
+		strs[i] = scriptArg(a)
+	}
+	res := c.store.execLocked(strs)
+	if err, ok := res.(error); ok {
+		panic(scriptError{err})
+	}
+	if st, ok := res.(status); ok {
+		return string(st)
+	}
+	return res
+}
+
+// CallInt 返回整数的命令
+func (c *ScriptCall) CallInt(args ...any) int64 {
+	n, _ := c.Call(args...).(int64)
+	return n
+}
+
+// CallStrings 返回数组的命令（ZRANGE 等）
+func (c *ScriptCall) CallStrings(args ...any) []string {
+	arr, _ := c.Call(args...).([]any)
+	out := make([]string, 0, len(arr))
+	for _, v := range arr {
+		if str, ok := v.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return out
+}
+
+// ArgInt 等价于 tonumber(ARGV[i+1])，转换失败为 0
+func (c *ScriptCall) ArgInt(i int) int64 {
+	if i >= len(c.Args) {
+		return 0
+	}
+	f, err := strconv.ParseFloat(c.Args[i], 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f)
+}
+
+func scriptArg(a any) string {
+	switch v := a.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatScore(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// scriptReply 按 Lua 到 RESP 的转换规则整理返回值
+func scriptReply(v any) any {
+	switch r := v.(type) {
+	case nil:
+		return nil
+	case bool:
+		if r {
+			return int64(1)
+		}
+		return nil
+	case int:
+		return int64(r)
+	case int64, string, error:
+		return r
+	case float64:
+		return int64(r)
+	case []string:
+		out := make([]any, len(r))
+		for i, s := range r {
+			out[i] = s
+		}
+		return out
+	case []any:
+		out := make([]any, len(r))
+		for i, x := range r {
+			out[i] = scriptReply(x)
+		}
+		return out
+	default:
+		return fmt.Sprint(r)
+	}
+}
+
+// cmdEval EVAL script numkeys key... arg... / EVALSHA sha1 numkeys ...
+// EVALSHA 找不到实现时回 NOSCRIPT，go-redis 会自动改用 EVAL 重试
+func cmdEval(s *memStore, a []string) (out any) {
+	isSHA := len(a[0]) == 40 && !strings.ContainsAny(a[0], " \n")
+	sha := a[0]
+	if !isSHA {
+		sha = scriptSHA(a[0])
+	}
+	fn, ok := lookupScript(sha)
+	if !ok {
+		if isSHA {
+			return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return fmt.Errorf("ERR memory redis has no Go implementation for script %s", sha)
+	}
+	n, err := strconv.Atoi(a[1])
+	if err != nil || n < 0 || n > len(a)-2 {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	c := &ScriptCall{Keys: a[2 : 2+n], Args: a[2+n:], store: s}
+
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(scriptError)
+			if !ok {
+				panic(r)
+			}
+			out = fmt.Errorf("ERR Error running script %s: %v", sha, se.err)
+		}
+	}()
+	return scriptReply(fn(c))
+}
+
+// cmdScript SCRIPT LOAD/EXISTS/FLUSH
+func cmdScript(_ *memStore, a []string) any {
+	switch strings.ToUpper(a[0]) {
+	case "LOAD":
+		if len(a) < 2 {
+			return wrongArgs("SCRIPT")
+		}
+		sha := scriptSHA(a[1])
+		if _, ok := lookupScript(sha); !ok {
+			return fmt.Errorf("ERR memory redis has no Go implementation for script %s", sha)
+		}
+		return sha
+	case "EXISTS":
+		out := make([]any, 0, len(a)-1)
+		for _, sha := range a[1:] {
+			if _, ok := lookupScript(sha); ok {
+				out = append(out, int64(1))
+			} else {
+				out = append(out, int64(0))
+			}
+		}
+		return out
+	case "FLUSH":
+		return status("OK")
+	}
+	return errSyntax
+}
@@ -1,9 +1,12 @@
 package storage
 
 import (
+	redis2 "PProject/service/storage/redis"
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -24,68 +27,123 @@ func AppendStream(stream string, fields map[string]any) (string, error) {
 	return rdb.XAdd(ctx, args).Result()
 }
 
-// —— Offline queue: one List per user ——
+// —— Offline queue: per user, ZSET keeps order, HASH keeps payloads ——
+// Entries are removed only after the client CACKs them. When the queue exceeds
+// its cap the oldest entries are trimmed and an overflow flag is set, so the
+// user falls back to SYNC-based catch-up on the next login.
+
+const (
+	OfflineQueueCap = 1000               // max entries per user
+	offlineQueueTTL = 7 * 24 * time.Hour // idle queues expire
+)
 
 type OfflineMsg struct {
+	ID      string `json:"id"` // server_msg_id, used to delete after CACK
 	From    string `json:"from"`
-	Payload []byte `json:"payload"`
+	Payload []byte `json:"payload"` // encoded MessageFrameData
 }
 
-func offlineKey(user string) string { return "im:offline:" + user }
+func offlineIDsKey(user string) string      { return "im:offline:{" + user + "}:ids" }
+func offlineDataKey(user string) string     { return "im:offline:{" + user + "}:data" }
+func offlineOverflowKey(user string) string { return "im:offline:{" + user + "}:overflow" }
+func offlineSeqKey(user string) string      { return "im:offline:{" + user + "}:seq" }
 
-// EnqueueOffline stores a msg into the user's offline queue
-func EnqueueOffline(user, from string, payload []byte) error {
-	if rdb == nil {
-		return fmt.Errorf("redis not initialized")
+// KEYS: ids, data, overflow, seq; ARGV: id, entry, cap, ttlSec
+// Returns 0 = duplicate, 1 = queued, 2 = queued and oldest entries trimmed
+var luaEnqueueOffline = redis.NewScript(`
+  if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+    return 0
+  end
+  local s = redis.call('INCR', KEYS[4])
+  redis.call('ZADD', KEYS[1], s, ARGV[1])
+  redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+  local ret = 1
+  local over = redis.call('ZCARD', KEYS[1]) - tonumber(ARGV[3])
+  if over > 0 then
+    local old = redis.call('ZRANGE', KEYS[1], 0, over - 1)
+    redis.call('ZREMRANGEBYRANK', KEYS[1], 0, over - 1)
+    redis.call('HDEL', KEYS[2], unpack(old))
+    redis.call('SET', KEYS[3], '1')
+    ret = 2
+  end
+  for i = 1, 4 do
+    redis.call('EXPIRE', KEYS[i], tonumber(ARGV[4]))
+  end
+  return ret
+`)
+
+// EnqueueOffline stores a frame into the user's offline queue; overflowed
+// reports that older entries were trimmed to respect the cap
+func EnqueueOffline(ctx context.Context, user, id, from string, payload []byte) (overflowed bool, err error) {
+	b, err := json.Marshal(OfflineMsg{ID: id, From: from, Payload: payload})
+	if err != nil {
+		return false, err
 	}
-	b, _ := json.Marshal(OfflineMsg{From: from, Payload: payload})
-	// Use LPUSH + LTRIM to implement a rolling window (keep the most recent N messages)
-	pipe := rdb.TxPipeline()
-	pipe.LPush(ctx, offlineKey(user), b)
-	pipe.LTrim(ctx, offlineKey(user), 0, 9999) // Keep only the most recent 10,000 messages
-	_, err := pipe.Exec(ctx)
-	return err
+	keys := []string{offlineIDsKey(user), offlineDataKey(user), offlineOverflowKey(user), offlineSeqKey(user)}
+	ret, err := luaEnqueueOffline.Run(ctx, redis2.GetRedis(), keys, id, b, OfflineQueueCap, int64(offlineQueueTTL.Seconds())).Int64()
+	if err != nil {
+		return false, err
+	}
+	return ret == 2, nil
 }
 
-// FetchOffline retrieves and clears up to n offline messages in bulk
-// (starting from the tail to ensure FIFO order)
-func FetchOffline(user string, n int) ([]OfflineMsg, error) {
-	if rdb == nil {
-		return nil, fmt.Errorf("redis not initialized")
-	}
+// FetchOffline reads up to n entries starting at offset, in enqueue order.
+// Entries stay in the queue until AckOffline is called.
+func FetchOffline(ctx context.Context, user string, offset, n int) ([]OfflineMsg, error) {
 	if n <= 0 {
 		n = 100
 	}
-
-	// Get current length, then get the range
-	llen, err := rdb.LLen(ctx, offlineKey(user)).Result()
-	if err != nil {
+	rdb := redis2.GetRedis()
+	ids, err := rdb.ZRange(ctx, offlineIDsKey(user), int64(offset), int64(offset+n-1)).Result()
+	if err != nil || len(ids) == 0 {
 		return nil, err
 	}
-	if llen == 0 {
-		return nil, nil
-	}
-	if int64(n) > llen {
-		n = int(llen)
-	}
-
-	// Get the last n items in reverse order (to maintain FIFO): index range [llen-n, llen-1]
-	start := llen - int64(n)
-	vals, err := rdb.LRange(ctx, offlineKey(user), start, llen-1).Result()
+	vals, err := rdb.HMGet(ctx, offlineDataKey(user), ids...).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	// Trim the retrieved part
-	if err := rdb.LTrim(ctx, offlineKey(user), 0, start-1).Err(); err != nil {
-		return nil, err
-	}
-
 	out := make([]OfflineMsg, 0, len(vals))
 	for _, v := range vals {
+		str, ok := v.(string)
+		if !ok {
+			continue // acked concurrently
+		}
 		var m OfflineMsg
-		_ = json.Unmarshal([]byte(v), &m)
+		if err := json.Unmarshal([]byte(str), &m); err != nil {
+			continue
+		}
 		out = append(out, m)
 	}
 	return out, nil
 }
+
+// AckOffline removes delivered entries after the client CACKs them
+func AckOffline(ctx context.Context, user string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	members := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, id)
+	}
+	pipe := redis2.GetRedis().TxPipeline()
+	pipe.ZRem(ctx, offlineIDsKey(user), members...)
+	pipe.HDel(ctx, offlineDataKey(user), ids...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TakeOfflineOverflow reports and clears the overflow flag
+func TakeOfflineOverflow(ctx context.Context, user string) (bool, error) {
+	n, err := redis2.GetRedis().Del(ctx, offlineOverflowKey(user)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ClearOffline drops the whole queue (used after falling back to SYNC)
+func ClearOffline(ctx context.Context, user string) error {
+	return redis2.GetRedis().Del(ctx, offlineIDsKey(user), offlineDataKey(user), offlineOverflowKey(user)).Err()
+}
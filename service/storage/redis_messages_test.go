@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestOfflineQueueOverflow(t *testing.T) {
+	useMemoryRedis(t)
+	ctx := context.Background()
+	user := "ov1"
+	t.Cleanup(func() { _ = ClearOffline(ctx, user) })
+
+	for i := 0; i < OfflineQueueCap; i++ {
+		id := "m" + strconv.Itoa(i)
+		overflowed, err := EnqueueOffline(ctx, user, id, "u1", []byte(id))
+		if err != nil || overflowed {
+			t.Fatalf("enqueue %s = %v, %v", id, overflowed, err)
+		}
+	}
+	if over, _ := TakeOfflineOverflow(ctx, user); over {
+		t.Fatal("overflow flag set before cap")
+	}
+
+	// 满了再进：丢掉最旧的，打上溢出标记；重复 ID 不算
+	for i := OfflineQueueCap; i < OfflineQueueCap+5; i++ {
+		id := "m" + strconv.Itoa(i)
+		overflowed, err := EnqueueOffline(ctx, user, id, "u1", []byte(id))
+		if err != nil || !overflowed {
+			t.Fatalf("enqueue %s = %v, %v", id, overflowed, err)
+		}
+	}
+	if overflowed, err := EnqueueOffline(ctx, user, "m10", "u1", []byte("dup")); err != nil || overflowed {
+		t.Fatalf("duplicate = %v, %v", overflowed, err)
+	}
+
+	msgs, err := FetchOffline(ctx, user, 0, OfflineQueueCap+10)
+	if err != nil || len(msgs) != OfflineQueueCap {
+		t.Fatalf("fetch = %d, %v", len(msgs), err)
+	}
+	if msgs[0].ID != "m5" || msgs[len(msgs)-1].ID != "m"+strconv.Itoa(OfflineQueueCap+4) || string(msgs[5].Payload) != "m10" {
+		t.Fatalf("queue = %s .. %s", msgs[0].ID, msgs[len(msgs)-1].ID)
+	}
+
+	// 溢出标记只报一次
+	if over, err := TakeOfflineOverflow(ctx, user); err != nil || !over {
+		t.Fatalf("take overflow = %v, %v", over, err)
+	}
+	if over, _ := TakeOfflineOverflow(ctx, user); over {
+		t.Fatal("overflow reported twice")
+	}
+
+	if err := AckOffline(ctx, user, "m5", "m6"); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ := FetchOffline(ctx, user, 0, 1); len(msgs) != 1 || msgs[0].ID != "m7" {
+		t.Fatalf("after ack = %+v", msgs)
+	}
+
+	if err := ClearOffline(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ := FetchOffline(ctx, user, 0, 10); len(msgs) != 0 {
+		t.Fatalf("after clear = %d", len(msgs))
+	}
+}
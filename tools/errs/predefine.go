@@ -19,6 +19,39 @@ const (
 	OrgUserNoPermissionError = 1520
 
 	RecordIsExist = 2000
+
+	// Message send path rejections (NACK).
+	AtAllForbiddenError    = 2101 // @all is not allowed in this group
+	NotGroupMemberError    = 2102 // Sender is not a member of the group
+	GroupMemberMutedError  = 2103 // Sender is muted in the group
+	GroupMemberBanError    = 2104 // Sender is banned from the group
+	GroupUnavailableError  = 2105 // Group does not exist or is not writable
+	BlockedByPeerError     = 2106 // Recipient has blocked the sender
+	NotFriendError         = 2107 // Tenant only allows 1:1 messages between friends
+	GroupMutedAllError     = 2108 // Group is in mute-all mode and sender is not whitelisted
+	GroupSlowModeError     = 2109 // Sender is sending faster than the group slow mode allows
+	MediaTooLargeError     = 2110 // Media exceeds the group size limit
+	GroupFrozenError       = 2111 // Group is frozen (read-only) or banned by the platform
+	ChannelPublishError    = 2112 // Only publishers and admins may post in a broadcast channel
+	GuildUnavailableError  = 2113 // Guild or guild channel does not exist, or the channel cannot hold messages
+	IntentsDisallowedError = 2114 // Connection declared privileged gateway intents that are not enabled for the account
+
+	// Scheduled messages.
+	ScheduledMsgNotPendingError = 2201 // Scheduled message already fired or canceled
+
+	// Friends.
+	AlreadyFriendError        = 2301 // Users are already friends
+	FriendRequestHandledError = 2302 // Friend request already handled, revoked or expired
+
+	// Groups.
+	AlreadyGroupMemberError  = 2401 // User is already a member of the group
+	GroupVerifyFailedError   = 2402 // Join answers do not match the group questions
+	GroupInviteInvalidError  = 2403 // Invite link disabled, rotated or unknown
+	GroupRequestHandledError = 2404 // Join request already handled or expired
+
+	// Bots.
+	BotUnavailableError     = 2501 // Bot does not exist or is disabled
+	InteractionInvalidError = 2502 // Component interaction unknown, expired or already answered
 )
 
 var (
@@ -36,4 +69,27 @@ var (
 	ErrTokenNotExist            = NewCodeError(TokenNotExistError, "TokenNotExistError")
 	ErrOrgUserNoPermissionError = NewCodeError(OrgUserNoPermissionError, "OrgUserNoPermissionError")
 	ErrorRecordIsExist          = NewCodeError(RecordIsExist, "recordIsExist")
+	ErrAtAllForbidden           = NewCodeError(AtAllForbiddenError, "AtAllForbiddenError")
+	ErrNotGroupMember           = NewCodeError(NotGroupMemberError, "NotGroupMemberError")
+	ErrGroupMemberMuted         = NewCodeError(GroupMemberMutedError, "GroupMemberMutedError")
+	ErrGroupMemberBan           = NewCodeError(GroupMemberBanError, "GroupMemberBanError")
+	ErrGroupUnavailable         = NewCodeError(GroupUnavailableError, "GroupUnavailableError")
+	ErrScheduledMsgNotPending   = NewCodeError(ScheduledMsgNotPendingError, "ScheduledMsgNotPendingError")
+	ErrBlockedByPeer            = NewCodeError(BlockedByPeerError, "BlockedByPeerError")
+	ErrNotFriend                = NewCodeError(NotFriendError, "NotFriendError")
+	ErrGroupMutedAll            = NewCodeError(GroupMutedAllError, "GroupMutedAllError")
+	ErrGroupSlowMode            = NewCodeError(GroupSlowModeError, "GroupSlowModeError")
+	ErrMediaTooLarge            = NewCodeError(MediaTooLargeError, "MediaTooLargeError")
+	ErrGroupFrozen              = NewCodeError(GroupFrozenError, "GroupFrozenError")
+	ErrChannelPublish           = NewCodeError(ChannelPublishError, "ChannelPublishError")
+	ErrGuildUnavailable         = NewCodeError(GuildUnavailableError, "GuildUnavailableError")
+	ErrIntentsDisallowed        = NewCodeError(IntentsDisallowedError, "IntentsDisallowedError")
+	ErrAlreadyFriend            = NewCodeError(AlreadyFriendError, "AlreadyFriendError")
+	ErrFriendRequestHandled     = NewCodeError(FriendRequestHandledError, "FriendRequestHandledError")
+	ErrAlreadyGroupMember       = NewCodeError(AlreadyGroupMemberError, "AlreadyGroupMemberError")
+	ErrGroupVerifyFailed        = NewCodeError(GroupVerifyFailedError, "GroupVerifyFailedError")
+	ErrGroupInviteInvalid       = NewCodeError(GroupInviteInvalidError, "GroupInviteInvalidError")
+	ErrGroupRequestHandled      = NewCodeError(GroupRequestHandledError, "GroupRequestHandledError")
+	ErrBotUnavailable           = NewCodeError(BotUnavailableError, "BotUnavailableError")
+	ErrInteractionInvalid       = NewCodeError(InteractionInvalidError, "InteractionInvalidError")
 )
@@ -0,0 +1,189 @@
+package segment
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 检索用的轻量分词，不依赖词典：
+//   - 中日韩连续片段：索引时切成单字 + 相邻二元组；查询时片段长 1 用单字，否则用二元组
+//   - 其它字母/数字连续片段：整词小写
+//
+// 查询词全部命中才算匹配，二元组可以覆盖任意长度的中文短语（“消息撤回” -> 消息/息撤/撤回）
+
+const maxWordLen = 64 // 超长的字母数字串（链接、哈希等）截断后再索引
+
+// IsCJK 中日韩文字
+func IsCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+// run 一段同类字符
+type run struct {
+	cjk   bool
+	runes []rune
+}
+
+func splitRuns(text string) []run {
+	var out []run
+	var cur *run
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		var cjk bool
+		switch {
+		case IsCJK(r):
+			cjk = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		default:
+			cur = nil
+			continue
+		}
+		if cur == nil || cur.cjk != cjk {
+			out = append(out, run{cjk: cjk})
+			cur = &out[len(out)-1]
+		}
+		cur.runes = append(cur.runes, r)
+	}
+	return out
+}
+
+func word(rs []rune) string {
+	if len(rs) > maxWordLen {
+		rs = rs[:maxWordLen]
+	}
+	return string(rs)
+}
+
+// Tokenize 索引词（去重，保持首次出现顺序）
+func Tokenize(text string) []string {
+	seen := make(map[string]struct{})
+	var out []string
+	add := func(t string) {
+		if _, ok := seen[t]; ok {
+			return
+		}
+		seen[t] = struct{}{}
+		out = append(out, t)
+	}
+	for _, r := range splitRuns(text) {
+		if !r.cjk {
+			add(word(r.runes))
+			continue
+		}
+		for i := range r.runes {
+			add(string(r.runes[i]))
+			if i+1 < len(r.runes) {
+				add(string(r.runes[i : i+2]))
+			}
+		}
+	}
+	return out
+}
+
+// QueryTerms 查询词（去重）；文档需包含全部查询词
+func QueryTerms(q string) []string {
+	seen := make(map[string]struct{})
+	var out []string
+	add := func(t string) {
+		if _, ok := seen[t]; ok {
+			return
+		}
+		seen[t] = struct{}{}
+		out = append(out, t)
+	}
+	for _, r := range splitRuns(q) {
+		switch {
+		case !r.cjk:
+			add(word(r.runes))
+		case len(r.runes) == 1:
+			add(string(r.runes))
+		default:
+			for i := 0; i+1 < len(r.runes); i++ {
+				add(string(r.runes[i : i+2]))
+			}
+		}
+	}
+	return out
+}
+
+// Highlight 截取包含第一个命中的摘要（最多 maxRunes 个字符），命中部分用 pre/post 包住
+// 命中按查询里的片段（空白/标点分隔）在原文中不区分大小写匹配；没有命中时返回开头一段
+func Highlight(text, q string, maxRunes int, pre, post string) string {
+	src := []rune(text)
+	lower := make([]rune, len(src))
+	for i, r := range src {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// 命中区间（按起点排序合并）
+	hit := make([]bool, len(src))
+	first := -1
+	for _, r := range splitRuns(q) {
+		frag := r.runes
+		for i := 0; i+len(frag) <= len(lower); i++ {
+			if !runesEqual(lower[i:i+len(frag)], frag) {
+				continue
+			}
+			for j := i; j < i+len(frag); j++ {
+				hit[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start, end := 0, len(src)
+	if maxRunes > 0 && len(src) > maxRunes {
+		if first > 0 {
+			// 命中前留一小段上下文
+			start = first - maxRunes/4
+			if start < 0 {
+				start = 0
+			}
+		}
+		end = start + maxRunes
+		if end > len(src) {
+			end = len(src)
+			start = end - maxRunes
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	in := false
+	for i := start; i < end; i++ {
+		if hit[i] && !in {
+			b.WriteString(pre)
+			in = true
+		} else if !hit[i] && in {
+			b.WriteString(post)
+			in = false
+		}
+		b.WriteRune(src[i])
+	}
+	if in {
+		b.WriteString(post)
+	}
+	if end < len(src) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func runesEqual(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
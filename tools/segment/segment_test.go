@@ -0,0 +1,60 @@
+package segment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("撤回消息 Hello, World! 2024")
+	want := []string{"撤", "撤回", "回", "回消", "消", "消息", "息", "hello", "world", "2024"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tokenize = %v", got)
+	}
+	if got := Tokenize("  ,.!  "); len(got) != 0 {
+		t.Fatalf("punctuation only = %v", got)
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	cases := map[string][]string{
+		"消息撤回":        {"消息", "息撤", "撤回"},
+		"消":           {"消"},
+		"Go 消息":       {"go", "消息"},
+		"hello,hello": {"hello"},
+	}
+	for q, want := range cases {
+		if got := QueryTerms(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q => %v, want %v", q, got, want)
+		}
+	}
+
+	// 查询词都在索引词里，才能用 $all 命中
+	index := map[string]bool{}
+	for _, tk := range Tokenize("今天下午开会讨论消息撤回的需求") {
+		index[tk] = true
+	}
+	for _, q := range []string{"消息撤回", "开会", "需"} {
+		for _, term := range QueryTerms(q) {
+			if !index[term] {
+				t.Errorf("query %q term %q not indexed", q, term)
+			}
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	if got := Highlight("明天讨论消息撤回", "消息撤回", 0, "<em>", "</em>"); got != "明天讨论<em>消息撤回</em>" {
+		t.Fatalf("highlight = %q", got)
+	}
+	if got := Highlight("Hello World", "world", 0, "[", "]"); got != "Hello [World]" {
+		t.Fatalf("case insensitive = %q", got)
+	}
+	got := Highlight("一二三四五六七八九十abcdefghij关键字结尾", "关键字", 8, "[", "]")
+	if got != "…hij[关键字]结尾" {
+		t.Fatalf("snippet = %q", got)
+	}
+	if got := Highlight("没有命中的内容", "xyz", 3, "[", "]"); got != "没有命…" {
+		t.Fatalf("no hit = %q", got)
+	}
+}